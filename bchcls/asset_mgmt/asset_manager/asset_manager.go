@@ -33,6 +33,18 @@ type AssetManager interface {
 	// assetKey              - a sym key used to encrypt the asset's PrivateData field.
 	// giveAccessToCaller    - if true, the caller will be given access to the assetKey. This access can be revoked later.
 	//                       - if false, the caller will only be adding the asset and not given access to the assetKey.
+	//
+	// If the asset's namespace has an access policy (see the abac package), its write rule must allow the caller.
+	//
+	// To sign the asset with the caller's private key, call asset.SetSignerID(caller.ID) before adding it.
+	//
+	// If any of the asset's datatypes has a schema, PublicData and PrivateData must conform to it, or a
+	// custom_errors.SchemaValidationError is returned.
+	//
+	// To encrypt each top-level field of PrivateData with its own key derived from assetKey, call
+	// asset.SetFieldEncryption(true) before adding it. PrivateData must then be a JSON object, and read access
+	// to individual fields can be given with AddAccessToAsset. Field-level encryption is not supported for
+	// assets stored in an off-chain datastore.
 	AddAsset(asset data_model.Asset, assetKey data_model.Key, giveAccessToCaller bool) error
 
 	// UpdateAsset updates an existing asset on the ledger.
@@ -44,25 +56,126 @@ type AssetManager interface {
 	//                       - if true, it returns an error if the asset does not exist.
 	//                       - if false, it adds a new asset if it does not exist.
 	//
-	// Caller must have access to the asset to update.
+	// Caller must have access to the asset to update. If the asset's namespace has an access policy (see the abac package),
+	// its write rule must also allow the caller. The write rule is checked for both the stored asset and the updated asset,
+	// so an asset can't be moved out of a namespace, or have its attributes changed, to get around the policy.
+	//
+	// If any of the asset's datatypes has a schema, PublicData and PrivateData must conform to it, or a
+	// custom_errors.SchemaValidationError is returned. Unchanged private data is also validated, so assetKey is needed.
+	//
+	// To sign the asset with the caller's private key, call asset.SetSignerID(caller.ID) before updating it.
+	// Otherwise any existing signature is removed, since it is no longer valid for the updated asset.
 	UpdateAsset(asset data_model.Asset, assetKey data_model.Key, strictUpdate ...bool) error
 
+	// UpdateAssetWithVersion updates an existing asset on the ledger like UpdateAsset with strictUpdate set to true,
+	// as long as the asset's current Version is expectedVersion.
+	// Pass the Version of the asset that was read before the update. If the asset was updated since,
+	// it returns a custom_errors.VersionConflictError instead of overwriting the other update.
+	// If the asset doesn't exist, a VersionConflictError is returned for a non-zero expectedVersion,
+	// and the update fails as it does for UpdateAsset otherwise.
+	UpdateAssetWithVersion(asset data_model.Asset, assetKey data_model.Key, expectedVersion int64) error
+
 	// DeleteAsset deletes the asset for the given assetId, as long as the caller has write access.
 	// Also updates any existing indices for this asset.
+	// The asset is removed permanently; use SoftDeleteAsset if the asset must be kept for a retention period.
 	DeleteAsset(assetId string, assetKey data_model.Key) error
 
+	// SoftDeleteAsset marks the asset for the given assetId as deleted without removing it from the ledger.
+	// The time of deletion and the caller's ID are saved in the asset's Metadata, and the asset's private data,
+	// index values, and signature are kept. The asset's index row keeps the time of deletion in its
+	// asset_mgmt.INDEX_DELETED_AT_FIELD field as a tombstone. A soft deleted asset is not returned by GetAsset or
+	// GetAssetIter unless includeDeleted is set, and it can't be updated until it is restored.
+	// Caller must have write access to the asset. Returns a custom_errors.AssetDeletedError if the asset is already deleted.
+	//
+	// SoftDeleteAsset, RestoreAsset, and PurgeAsset each save a transaction log in the asset_mgmt.ASSET_LOG_NAMESPACE
+	// namespace, encrypted with assetKey. The log's TransactionID is the ID of the transaction followed by "-", the
+	// assetId, "-", and the name of the method, its FunctionName is the name of the method, and its Field1 is the assetId.
+	SoftDeleteAsset(assetId string, assetKey data_model.Key) error
+
+	// RestoreAsset restores an asset that was soft deleted by SoftDeleteAsset, and clears the tombstone in its index row.
+	// Caller must have write access to the asset.
+	RestoreAsset(assetId string, assetKey data_model.Key) error
+
+	// PurgeAsset permanently deletes an asset that was soft deleted by SoftDeleteAsset, along with its index values,
+	// for example when its retention period is over. The transaction log of the purge is kept.
+	// Caller must have write access to the asset. Returns an error if the asset is not soft deleted.
+	PurgeAsset(assetId string, assetKey data_model.Key) error
+
+	// RotateAssetKey replaces the sym key of an existing asset, for example after a reader's access was revoked.
+	// oldKey                - the current asset key
+	// newKey                - the new asset key; it can have a new key ID, and its key bytes must be different from oldKey
+	//
+	// PrivateData is re-encrypted with newKey, including private data stored in an off-chain datastore.
+	// Every user, group, datatype, and consent that currently has access to oldKey is given access to newKey,
+	// and the asset's AssetKeyId and AssetKeyHash are updated in the same transaction.
+	// Write only access is kept, whichever user gave it.
+	// Users whose access was revoked before the rotation can't decrypt data saved with newKey.
+	// For a field encrypted asset, new field keys are derived from newKey, and field access given to users and groups is moved to the new field keys.
+	// Caller must have write access to the asset and access to the asset owner's datatype sym keys.
+	RotateAssetKey(assetId string, oldKey data_model.Key, newKey data_model.Key) error
+
 	// GetAsset finds and decrypts the asset for the given assetId.
 	// Caller must have access to the asset.
 	// Returns empty asset if the passed assetId does not match any existing assets. It is the caller's responsibility to check if returned asset is empty.
 	// If assetKey is an empty key, there will be no attempt to get the PrivateData of the asset. This can be a good speed optimization if private data is not needed.
 	// If assetKey does not belong to the passed in assetID, it returns an error.
-	GetAsset(assetId string, assetKey data_model.Key) (*data_model.Asset, error)
+	// includeDeleted is an optional bool flag (default = false). If it's set to true, a soft deleted asset is returned;
+	// otherwise an empty asset is returned for a soft deleted asset.
+	// For a field encrypted asset, if the private data can't be decrypted with assetKey, PrivateData is set to a JSON object
+	// with only the fields the caller has been given access to, if any.
+	// If the asset's namespace has an access policy (see the abac package) whose read rule does not allow the caller,
+	// an error is returned.
+	GetAsset(assetId string, assetKey data_model.Key, includeDeleted ...bool) (*data_model.Asset, error)
+
+	// VerifyAssetSignature checks that the asset was signed by the user returned by asset.GetSignerID().
+	// The signer's public key is obtained from the signer's user data.
+	// Returns a custom_errors.InvalidSignatureError if the asset is not signed or the signature is invalid.
+	// Caller must have access to assetKey.
+	VerifyAssetSignature(assetId string, assetKey data_model.Key) error
+
+	// GetAssetHistory returns every version of the asset for the given assetId, oldest first,
+	// with the ID and timestamp of the transaction that wrote each version.
+	// A version's PrivateData is decrypted if assetKey is the asset key of that version; otherwise it is
+	// returned encrypted, e.g. for versions saved before the asset key was rotated.
+	// Versions written by a delete have IsDelete set to true and an empty asset.
+	// Requires the peer's history database to be enabled.
+	GetAssetHistory(assetId string, assetKey data_model.Key) ([]data_model.AssetVersion, error)
+
+	// GetAssetAtTime returns the asset for the given assetId as it was at timestamp, in seconds since the epoch.
+	// PrivateData is decrypted as described in GetAssetHistory.
+	// Returns an empty asset if the asset did not exist or was deleted at that time. It is the caller's responsibility to check if returned asset is empty.
+	// Requires the peer's history database to be enabled.
+	GetAssetAtTime(assetId string, assetKey data_model.Key, timestamp int64) (*data_model.Asset, error)
+
+	// MigrateAssets transforms the data of assets of datatypeID from fromVersion to toVersion of the datatype, using the
+	// migration rules added by datatype.AddDatatypeVersion, and saves them with UpdateAsset.
+	// Only assets whose data is at fromVersion, and that the caller can decrypt and has write access to, are migrated.
+	// The migrated assets' datatype version is set to toVersion, and they must conform to the schema of toVersion.
+	// Assets are found with the index used by GetAssetsByDatatype, so assets added before the index existed are only
+	// migrated after RebuildDatatypeAssetIndex is called.
+	// previousKey           - the last key returned by the previous call; pass empty string "" to start from the beginning
+	// limit                 - the max number of assets of datatypeID to check in this call; if limit = -1, all assets are checked
+	//
+	// Returns the IDs of the migrated assets and the key to pass as previousKey to continue, which is empty if all assets
+	// have been checked.
+	MigrateAssets(datatypeID string, fromVersion int, toVersion int, previousKey string, limit int) ([]string, string, error)
+
+	// RebuildDatatypeAssetIndex adds the index rows used by GetAssetsByDatatype for assets on the ledger.
+	// Assets added before the index was created by Init are not returned by GetAssetsByDatatype until it is called.
+	// Caller must be a system admin. Index rows only contain the assets' datatypes and owners, so no asset key is needed.
+	// previousKey           - the last key returned by the previous call; pass empty string "" to start from the beginning
+	// limit                 - the max number of assets to index in this call; if limit = -1, all assets are indexed
+	//
+	// Returns the IDs of the indexed assets and the key to pass as previousKey to continue, which is empty if all assets
+	// have been indexed.
+	RebuildDatatypeAssetIndex(previousKey string, limit int) ([]string, string, error)
 
 	// GetAssetKey finds an asset key using the key path passed in.
 	// The first key ID in the key path should be the caller's private key ID,
 	// and the last key ID should be the assetKey ID.
 	// Returns an empty asset key if the assetId passed in does not exist.
-	// If keyPath is invalid, it returns an error.
+	// If keyPath is invalid, if an edge of keyPath is time-bound access that is not in effect, or if the caller or
+	// one of the caller's groups has a deny entry for the asset, it returns an error.
 	GetAssetKey(assetId string, keyPath []string) (data_model.Key, error)
 
 	// AddAccessToAsset adds read or write access from user to asset.
@@ -71,6 +184,13 @@ type AssetManager interface {
 	// Adding write access will give both read and write access.
 	// allowAddAccessBeforeAssetIsCreated is an optional bool flag (default = false).
 	// If it's set to true, access is processed even if the asset is not yet created.
+	// If accessControl.Fields is set, read access is given to only those private data fields of a field encrypted asset,
+	// by adding access from user's public key to each field key. The asset must exist.
+	// If accessControl.NotBefore or accessControl.ExpirationDate is set, the access is only in effect from NotBefore
+	// and until ExpirationDate, based on the transaction timestamp. Expired access can be removed with RemoveExpiredAccessFromAsset.
+	// If accessControl.Access is ACCESS_DENY, a deny entry is added for the user or group instead. A deny entry takes
+	// precedence over any access the user has, including access through groups and consents. Owners can't be denied.
+	// The asset must exist.
 	// Caller must be asset owner.
 	AddAccessToAsset(accessControl data_model.AccessControl, allowAddAccessBeforeAssetIsCreated ...bool) error
 
@@ -78,12 +198,26 @@ type AssetManager interface {
 	// Write access is removed by updating access type of access graph edge data to "read".
 	// Removing read access will remove both read and write access and will delete access graph edge.
 	// Removing write access will keep read access.
+	// If accessControl.Fields is set, only read access to those private data fields is removed.
+	// If accessControl.Access is ACCESS_DENY, the deny entry of the user or group is removed.
 	// Caller must be asset owner.
 	RemoveAccessFromAsset(accessControl data_model.AccessControl) error
 
+	// RemoveExpiredAccessFromAsset removes access to the asset that was given with an ExpirationDate which has passed,
+	// including write only and field access. Expired access no longer gives access to the asset; this removes its
+	// access graph edges from the ledger.
+	// Returns the IDs of the start keys whose access was removed.
+	// Caller must be asset owner, like for RemoveAccessFromAsset. This includes access given by other callers, such as
+	// write only access grantors or callers of AddAccessToAsset with allowAddAccessBeforeAssetIsCreated, who can't
+	// remove it themselves. Expired access doesn't give access to the asset whether or not it has been removed.
+	RemoveExpiredAccessFromAsset(assetId string) ([]string, error)
+
 	// CheckAccessToAsset returns true if the specified access has been given from user to asset.
 	// Caller can only check caller's own access.
 	// To check the access of another user, first get access control manager with that user as the caller. This requires caller to have access to that user's keys.
+	// The access policy of the asset's namespace, if any, is also evaluated (see the abac package).
+	// It returns false if the user or one of the user's groups has a deny entry for the asset.
+	// Access given with NotBefore or ExpirationDate is only counted while it is in effect.
 	CheckAccessToAsset(accessControl data_model.AccessControl) (bool, error)
 
 	// GetAssetIter performs an index query and returns an asset iterator on the result.
@@ -100,6 +234,7 @@ type AssetManager interface {
 	// returnPrivateAssetsOnly - if returnPrivateAssetsOnly is true, only assets that caller has access to, will be returned
 	//                       - If returnPrivateAssetsOnly is false, it will return all assets that matched the search query.
 	//                       - returnPrivateAssetsOnly is enforced even if you set decryptPrivateData to false
+	//                       - assets the caller's access to has expired or is not yet in effect are not private assets
 	// assetKeyPath          - This param is used to specify key path for access to the asset. This is used internally to call GetAssetKey func to access/decrypt the private portion of the asset.
 	//											 - It can be one of the following types: asset_key_func.AssetKeyPathFunc, asset_key_func.AssetKeyByteFunc, string, or []string
 	//                       - if assetKeyPath is string type, it's converted to []string, and processed as []string input
@@ -119,6 +254,8 @@ type AssetManager interface {
 	//                       - examples to return only public assets (when decrypPrivateData is set to true):
 	//                         {"not": [{"bool": [{"var":"private_data.encrypted"}]}]}
 	//                         This filter rule returns true if private_data.encryped field does not exist.
+	// includeDeleted        - (optional) default = false
+	//                       - if true, soft deleted assets are returned as well
 	// NOTE 1:    startValues & endValues should be identical except for the last entry.
 	//            The first n-1 entries will be used for filtering, the last entry can be used for a range query.
 	//            Range queries are between the startKey (inclusive) and endKey (exclusive).
@@ -139,6 +276,25 @@ type AssetManager interface {
 		previousKey string,
 		limit int,
 		filterRule *simple_rule.Rule,
+		includeDeleted ...bool,
+	) (AssetIteratorInterface, error)
+
+	// GetAssetsByDatatype returns an asset iterator on the assets of the given datatype that are owned by ownerID.
+	// Assets of descendant datatypes are returned as well. Since an asset's datatypes are normalized
+	// (see datatype.NormalizeDatatypes), an asset of a child datatype is only indexed under the child datatype.
+	// Assets are returned ordered by datatype, then by index row.
+	// Assets added before the index existed are only returned after RebuildDatatypeAssetIndex is called.
+	// All other params are the same as for GetAssetIter.
+	GetAssetsByDatatype(
+		datatypeID string,
+		ownerID string,
+		decryptPrivateData bool,
+		returnOnlyPrivateAssets bool,
+		assetKeyPath interface{},
+		previousKey string,
+		limit int,
+		filterRule *simple_rule.Rule,
+		includeDeleted ...bool,
 	) (AssetIteratorInterface, error)
 }
 
@@ -17,6 +17,7 @@ import (
 	"common/bchcls/data_model"
 	"common/bchcls/internal/asset_mgmt_i"
 	"common/bchcls/internal/asset_mgmt_i/asset_mgmt_c"
+	"common/bchcls/internal/common/global"
 	"common/bchcls/internal/metering_i"
 	"common/bchcls/utils"
 
@@ -25,6 +26,14 @@ import (
 
 var logger = shim.NewLogger("asset_mgmt")
 
+// INDEX_DELETED_AT_FIELD is the field of an asset's index row that holds the time at which the asset was
+// soft deleted. Add an index on it to find soft deleted assets. The field is only in the index rows of soft deleted
+// assets, unless the table has an index on it, in which case it is an empty string for assets that are not deleted.
+const INDEX_DELETED_AT_FIELD = global.INDEX_DELETED_AT_FIELD
+
+// ASSET_LOG_NAMESPACE is the transaction log namespace for soft deletes, restores, and purges of assets.
+const ASSET_LOG_NAMESPACE = global.ASSET_LOG_NAMESPACE
+
 // ------------------------------------------------------
 // ---------------------- INIT FUNCTIONS ----------------
 // ------------------------------------------------------
@@ -101,3 +110,15 @@ func GetAssetPrivateData(stub cached_stub.CachedStubInterface, assetData data_mo
 
 	return asset_mgmt_i.GetAssetPrivateData(stub, assetData, assetKey)
 }
+
+// VerifyAssetSignature checks that an asset was signed by the user returned by asset.GetSignerID().
+// assetData must contain decrypted PrivateData, for example an asset returned by AssetManager's GetAsset function.
+// The signer's public key is obtained from the signer's user data.
+// Returns a custom_errors.InvalidSignatureError if the asset is not signed or the signature is invalid.
+func VerifyAssetSignature(stub cached_stub.CachedStubInterface, assetData data_model.Asset) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return asset_mgmt_i.VerifyAssetSignature(stub, assetData)
+}
@@ -37,6 +37,21 @@ const ACCESS_WRITE = global.ACCESS_WRITE
 // ACCESS_DENY is a Consent.Access option that specifies deny access.
 const ACCESS_DENY = global.ACCESS_DENY
 
+// PURPOSE_TREATMENT is a Consent.Purposes option for the purpose of treatment.
+const PURPOSE_TREATMENT = global.PURPOSE_TREATMENT
+
+// PURPOSE_RESEARCH is a Consent.Purposes option for the purpose of research.
+const PURPOSE_RESEARCH = global.PURPOSE_RESEARCH
+
+// PURPOSE_BILLING is a Consent.Purposes option for the purpose of billing.
+const PURPOSE_BILLING = global.PURPOSE_BILLING
+
+// CONTEXT_PURPOSE is the ValidateConsent request context key of the purpose of use.
+const CONTEXT_PURPOSE = global.CONSENT_CONTEXT_PURPOSE
+
+// CONSENT_MAX_BATCH_SIZE is the maximum number of consents that can be put in one PutConsents call.
+const CONSENT_MAX_BATCH_SIZE = global.CONSENT_MAX_BATCH_SIZE
+
 // ------------------------------------------------------
 // ---------------------- INIT FUNCTIONS ----------------
 // ------------------------------------------------------
@@ -60,6 +75,7 @@ var ConsentKeyFunc asset_key_func.AssetKeyPathFunc = consent_mgmt_i.ConsentKeyFu
 // PutConsent updates an existing consent or adds a new consent.
 // Consent can be given to a datatype (all assets of a particular datatype).
 // Caller must either be consent owner or have access to the owner's private key.
+// Each change is saved in the consent's history, see GetConsentHistory.
 //
 // args = [consent, consentKeyB64]
 //
@@ -89,6 +105,245 @@ func PutConsentWithParams(stub cached_stub.CachedStubInterface, caller data_mode
 	return consent_mgmt_i.PutConsentWithParams(stub, caller, consent, consentKeyBytes)
 }
 
+// PutConsents updates existing consents or adds new consents in one transaction, such as a batch of consents
+// collected off-chain. Caller must either be the owner of each consent or have access to the owner's private key.
+// Returns a list of data_model.ConsentResult, one for each consent, in the same order.
+// Consents that fail validation are skipped and their results have an Error, while the other consents are put.
+// If putting a valid consent fails, an error is returned and none of the consents are put.
+// Since consents can be collected before they are put, ConsentDate can be any time up to the transaction timestamp.
+//
+// args = [consents, consentKeysB64]
+//
+// consents is a JSON list of consent objects, with at most CONSENT_MAX_BATCH_SIZE consents.
+// consentKeysB64 is a JSON list of base64 encoded consent keys, one for each consent. A consent key is only required
+// for a new consent, pass "" for an existing consent. consentKeysB64 can be omitted if all consents exist.
+func PutConsents(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.PutConsents(stub, caller, args)
+}
+
+// PutConsentsWithParams updates existing consents or adds new consents in one transaction.
+// It takes a list of consent objects, and a list of consentKeys with one consent key for each consent,
+// as arguments instead of args in JSON format. A consent key is only passed for a new consent.
+// Returns a data_model.ConsentResult for each consent.
+// "WithParams" functions should only be called from within the chaincode.
+func PutConsentsWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consents []data_model.Consent, consentKeys [][]byte) ([]data_model.ConsentResult, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consents: %v, consentKeys len: %v", caller.ID, len(consents), len(consentKeys))
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.PutConsentsWithParams(stub, caller, consents, consentKeys)
+}
+
+// AmendConsent updates an existing consent.
+// Unlike PutConsent, it returns an error if the consent does not exist, and it can't be used to revoke the consent.
+// Use RevokeConsent instead. If consent.ConsentDate is not set, the transaction timestamp is used.
+// Consents delegated from the consent are amended so that they don't give more access than the amended consent.
+// Caller must either be consent owner or have access to the owner's private key.
+//
+// args = [consent]
+func AmendConsent(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.AmendConsent(stub, caller, args)
+}
+
+// AmendConsentWithParams updates an existing consent.
+// It takes consent object data_model.Consent as argument instead of an args string slice.
+// "WithParams" functions should only be called from within the chaincode.
+func AmendConsentWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consent data_model.Consent) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consent: %v", caller.ID, consent)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.AmendConsentWithParams(stub, caller, consent)
+}
+
+// RevokeConsent revokes an existing consent by setting its access to deny.
+// The time of revocation is saved as the consent's ConsentDate and in the consent's history.
+// Caller must either be consent owner or have access to the owner's private key.
+// A delegated consent can also be revoked by the target of the consent it was delegated from.
+// Revoking a consent also revokes all consents delegated from it, through the whole delegation chain.
+//
+// args: [datatypeID, targetID, ownerID]
+func RevokeConsent(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.RevokeConsent(stub, caller, args)
+}
+
+// RevokeConsentWithParams revokes the consent with the given consentID.
+// Returns an error if the consent does not exist or is already revoked.
+// "WithParams" functions should only be called from within the chaincode.
+func RevokeConsentWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consentID string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consentID: %v", caller.ID, consentID)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.RevokeConsentWithParams(stub, caller, consentID)
+}
+
+// DelegateConsent delegates a consent to another target, for example from a hospital to a contracted lab.
+// consent.ParentConsentID is the ID of the consent being delegated, and caller must be its target.
+// If the consent was already delegated to the same target, it's updated.
+//
+// The delegated consent must have the owner and datatype of the parent consent, and can't give more access than it:
+// a read consent can only be delegated as read. Its ExpirationDate can't be later than the parent's, and is the
+// parent's if not set. NotBefore, ValidityWindows, Purposes, Condition, and MaxDelegationDepth are copied from
+// the parent consent. A consent can be delegated if the chain of consents delegated from the root consent is shorter
+// than MaxDelegationDepth. Revoking a consent revokes all consents delegated from it, and amending a consent
+// applies these rules to the consents delegated from it again, through the whole delegation chain.
+//
+// args = [consent, consentKeyB64]
+//
+// consentKeyB64 is only required when delegating a new consent. A unique consent key must be used for each new consent.
+func DelegateConsent(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.DelegateConsent(stub, caller, args)
+}
+
+// DelegateConsentWithParams delegates a consent to another target.
+// It takes consent object data_model.Consent, and consentKeyBytes []byte as arguments instead of args in JSON format.
+// "WithParams" functions should only be called from within the chaincode.
+func DelegateConsentWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consent data_model.Consent, consentKeyBytes []byte) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consent: %v, consentKey len: %v", caller.ID, consent, len(consentKeyBytes))
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.DelegateConsentWithParams(stub, caller, consent, consentKeyBytes)
+}
+
+// GetConsentHistory returns every version of a consent, oldest first, as a list of data_model.ConsentVersion.
+// Every change made by PutConsent, PutConsents, AmendConsent, RevokeConsent, or DelegateConsent is saved as a transaction log, so each version
+// records who changed the consent, when, and with which function.
+// Caller can be anyone with access to the consent key.
+//
+// args: [consentID]
+func GetConsentHistory(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("args: %v", args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.GetConsentHistory(stub, caller, args)
+}
+
+// GetConsentHistoryWithParams returns every version of the consent with the given consentID, oldest first.
+// "WithParams" functions should only be called from within the chaincode.
+func GetConsentHistoryWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consentID string) ([]data_model.ConsentVersion, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("caller: %v, consentID: %v", caller.ID, consentID)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.GetConsentHistoryWithParams(stub, caller, consentID)
+}
+
+// ExportConsentReceipt returns a consent receipt for a consent, signed with the consent owner's private key,
+// so the owner has a verifiable record of the consent. The receipt follows the Kantara Initiative
+// Consent Receipt Specification v1.1, see data_model.ConsentReceipt.
+// Caller must have access to the consent key, and either be the owner of the consent or have access to
+// the owner's private key.
+// Returns a data_model.SignedConsentReceipt.
+//
+// args = [consentID, receiptTemplate]
+//
+// receiptTemplate is optional. It's a data_model.ConsentReceipt in JSON format with the fields that are not set
+// from the consent, such as Jurisdiction, CollectionMethod, Language, PIIControllers, and PolicyURL.
+func ExportConsentReceipt(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.ExportConsentReceipt(stub, caller, args)
+}
+
+// ExportConsentReceiptWithParams returns a consent receipt for the consent with the given consentID,
+// signed with the consent owner's private key.
+// The fields of receiptTemplate that are set from the consent are ignored.
+// "WithParams" functions should only be called from within the chaincode.
+func ExportConsentReceiptWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consentID string, receiptTemplate data_model.ConsentReceipt) (data_model.SignedConsentReceipt, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consentID: %v", caller.ID, consentID)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.ExportConsentReceiptWithParams(stub, caller, consentID, receiptTemplate)
+}
+
+// VerifyConsentReceipt checks that a consent receipt was signed by the consent owner.
+// The owner's current public key is used, so receipts signed before the owner's keys were rotated are invalid.
+// Returns an error if the receipt is invalid.
+//
+// args = [signedReceipt]
+//
+// signedReceipt is a data_model.SignedConsentReceipt in JSON format, returned by ExportConsentReceipt.
+func VerifyConsentReceipt(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.VerifyConsentReceipt(stub, caller, args)
+}
+
+// VerifyConsentReceiptWithParams checks that a consent receipt was signed by the consent owner.
+// It takes a data_model.SignedConsentReceipt as argument instead of args in JSON format.
+// "WithParams" functions should only be called from within the chaincode.
+func VerifyConsentReceiptWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, signedReceipt data_model.SignedConsentReceipt) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consentID: %v", caller.ID, signedReceipt.Receipt.ConsentID)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.VerifyConsentReceiptWithParams(stub, caller, signedReceipt)
+}
+
+// UpdateConsentEdgeData saves the NotBefore, ExpirationDate, and ValidityWindows of an existing consent in
+// the key graph, so that CheckAccess enforces them. Consents put before these were saved in the key graph
+// give access at any time in CheckAccess until they are updated by this function, PutConsent, or AmendConsent.
+// Caller can be anyone with access to the consent key.
+//
+// args: [consentID]
+func UpdateConsentEdgeData(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.UpdateConsentEdgeData(stub, caller, args)
+}
+
+// UpdateConsentEdgeDataWithParams saves the time constraints of the consent with the given consentID in the key graph.
+// "WithParams" functions should only be called from within the chaincode.
+func UpdateConsentEdgeDataWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consentID string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consentID: %v", caller.ID, consentID)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return consent_mgmt_i.UpdateConsentEdgeDataWithParams(stub, caller, consentID)
+}
+
 // GetConsent returns the specified consent asset.
 // Returns an error if no consent is found.
 // Caller can be anyone with access to the consent key.
@@ -119,15 +374,20 @@ func GetConsentWithParams(stub cached_stub.CachedStubInterface, caller data_mode
 	return consent_mgmt_i.GetConsentWithParams(stub, caller, consentID, consentKey...)
 }
 
-// ValidateConsent gets the specified consent asset. If consent is found and if it passes the expiration date and access level checks, it returns filter rules and the consent key.
+// ValidateConsent gets the specified consent asset. If consent is found and if it passes the access level, NotBefore, expiration date, and validity window checks, it returns filter rules and the consent key.
 // Filter rule is a simple rule that contains consent owner ID, which can be applied against an asset's owner ID, and consent
 // datatype ID, which can be applied against asset's datatypeID, to filter out assets.
 //
-// args: [datatypeID, ownerID, targetID, access, currTime]
+// args: [datatypeID, ownerID, targetID, access, currTime, requestContext]
 //
 // targetID is the ID of the consent recipient.
 // access is the desired access level that will be validated against the access recorded in the consent object.
 // currTime is the current timestamp generated.
+// requestContext is optional. It's a JSON map describing the request, such as {"purpose": "treatment", "org": "org1"}.
+// If the consent has Purposes, requestContext must have one of them as "purpose".
+// If the consent has a Condition, it is evaluated against requestContext, to which the following keys are added:
+// "caller_id" and "caller_role" of the caller, "current_time" (currTime), and "hour" (the UTC hour of currTime).
+// If the consent does not give access, a custom_errors.ConsentAccessError with the reason is returned.
 func ValidateConsent(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) (simple_rule.Rule, data_model.Key, error) {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 	logger.Debugf("args: %v", args)
@@ -13,8 +13,10 @@ package crypto
 import (
 	"common/bchcls/custom_errors"
 
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
@@ -22,8 +24,10 @@ import (
 	"crypto/sha512"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
 	"io"
 	"strings"
+	"sync/atomic"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/pkg/errors"
@@ -45,8 +49,198 @@ func DecryptWithPrivateKey(privateKey *rsa.PrivateKey, data []byte) ([]byte, err
 	return rsa.DecryptPKCS1v15(r, privateKey, data)
 }
 
+// EncryptWithPublicKeyOAEP encrypts data using RSA-OAEP with SHA-256 and the provided RSA public key.
+// Unlike EncryptWithPublicKey, a random source is used, so the ciphertext is different each time.
+func EncryptWithPublicKeyOAEP(publicKey *rsa.PublicKey, data []byte) ([]byte, error) {
+	if publicKey == nil {
+		logger.Errorf("Public key is nil")
+		return nil, errors.New("Public key is nil")
+	}
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, data, nil)
+}
+
+// DecryptWithPrivateKeyOAEP decrypts data encrypted by EncryptWithPublicKeyOAEP using the provided RSA private key.
+func DecryptWithPrivateKeyOAEP(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
+	if privateKey == nil {
+		logger.Errorf("Private key is nil")
+		return nil, errors.New("Private key is nil")
+	}
+	return rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, data, nil)
+}
+
+// PUBLIC_KEY_HEADER_HYBRID is the version byte prepended to ciphertexts returned by EncryptWithPublicKeyHybrid.
+// Each public key envelope has its own header value.
+const PUBLIC_KEY_HEADER_HYBRID byte = 0x03
+
+// EncryptWithPublicKeyHybrid encrypts data of any size for the owner of the provided RSA public key
+// (for example, a data_model.User's PublicKey).
+// A fresh sym key is generated and encrypted with RSA-OAEP, and data is encrypted with the sym key
+// using AES-GCM. The returned ciphertext is
+// PUBLIC_KEY_HEADER_HYBRID || length of encrypted sym key (2 bytes) || encrypted sym key || encrypted data.
+func EncryptWithPublicKeyHybrid(publicKey *rsa.PublicKey, data []byte) ([]byte, error) {
+	symKey := GenerateSymKey()
+	encryptedSymKey, err := EncryptWithPublicKeyOAEP(publicKey, symKey)
+	if err != nil {
+		custom_err := &custom_errors.EncryptionError{ToEncrypt: "sym key", EncryptionKey: "public key"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	encryptedData, err := EncryptWithSymKeyGCM(symKey, data)
+	if err != nil {
+		custom_err := &custom_errors.EncryptionError{ToEncrypt: "data", EncryptionKey: "sym key"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	ciphertext := make([]byte, 3, 3+len(encryptedSymKey)+len(encryptedData))
+	ciphertext[0] = PUBLIC_KEY_HEADER_HYBRID
+	binary.BigEndian.PutUint16(ciphertext[1:3], uint16(len(encryptedSymKey)))
+	ciphertext = append(ciphertext, encryptedSymKey...)
+	return append(ciphertext, encryptedData...), nil
+}
+
+// DecryptWithPrivateKeyHybrid decrypts data encrypted by EncryptWithPublicKeyHybrid using the provided RSA private key.
+func DecryptWithPrivateKeyHybrid(privateKey *rsa.PrivateKey, encryptedData []byte) ([]byte, error) {
+	if encryptedData == nil {
+		err := errors.WithStack(&custom_errors.CiphertextEmptyError{})
+		logger.Errorf("%v", err)
+		return nil, err
+	}
+	if len(encryptedData) < 3 || encryptedData[0] != PUBLIC_KEY_HEADER_HYBRID {
+		logger.Errorf("Invalid hybrid ciphertext header")
+		return nil, errors.New("Invalid hybrid ciphertext header")
+	}
+	keyLength := int(binary.BigEndian.Uint16(encryptedData[1:3]))
+	if len(encryptedData) < 3+keyLength {
+		err := errors.WithStack(&custom_errors.CiphertextLengthError{})
+		logger.Errorf("%v", err)
+		return nil, err
+	}
+
+	symKey, err := DecryptWithPrivateKeyOAEP(privateKey, encryptedData[3:3+keyLength])
+	if err != nil {
+		custom_err := &custom_errors.DecryptionError{ToDecrypt: "sym key", DecryptionKey: "private key"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	data, err := DecryptWithSymKey(symKey, encryptedData[3+keyLength:])
+	if err != nil {
+		custom_err := &custom_errors.DecryptionError{ToDecrypt: "data", DecryptionKey: "sym key"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	return data, nil
+}
+
+// Sym key encryption modes.
+// SYM_KEY_MODE_CBC is the legacy AES-CBC mode. Its IV is derived from the plaintext, so
+// encrypting the same data twice produces the same ciphertext.
+// SYM_KEY_MODE_GCM is AES-GCM with a random nonce and an authentication tag. Ciphertexts start
+// with SYM_KEY_ENVELOPE_PREFIX and a version byte so that DecryptWithSymKey can tell them apart
+// from legacy CBC ciphertexts.
+const (
+	SYM_KEY_MODE_CBC = "cbc"
+	SYM_KEY_MODE_GCM = "gcm"
+
+	// SYM_KEY_ENVELOPE_PREFIX is the magic prefix of versioned sym key ciphertexts.
+	SYM_KEY_ENVELOPE_PREFIX = "\x89BCSYM\r\n"
+
+	// SYM_KEY_VERSION_GCM is the version byte that follows SYM_KEY_ENVELOPE_PREFIX in AES-GCM ciphertexts.
+	SYM_KEY_VERSION_GCM byte = 0x01
+)
+
+// gcmNonceSize is the size of the random nonce stored after the version byte.
+const gcmNonceSize = 12
+
+// gcmHeaderSize is the size of the envelope prefix and version byte.
+const gcmHeaderSize = len(SYM_KEY_ENVELOPE_PREFIX) + 1
+
+var symKeyEncryptionMode = SYM_KEY_MODE_CBC
+
+// symKeyEncryptionModeFixed is set to 1 once EncryptWithSymKey has been called.
+var symKeyEncryptionModeFixed int32
+
+// SetSymKeyEncryptionMode sets the mode used by EncryptWithSymKey, and therefore by asset private data,
+// key graph edges, and encrypted index rows. Valid modes are SYM_KEY_MODE_CBC (default) and SYM_KEY_MODE_GCM.
+// The mode is a constant of the chaincode process: call SetSymKeyEncryptionMode from the chaincode's main function
+// before shim.Start. Once EncryptWithSymKey has been called, the mode can't be changed and an error is returned.
+// Since GCM uses random nonces, ciphertexts differ between peers. Only use SYM_KEY_MODE_GCM if the
+// endorsement policy does not require more than one peer to produce identical write sets.
+// DecryptWithSymKey handles both modes regardless of this setting.
+func SetSymKeyEncryptionMode(mode string) error {
+	if mode != SYM_KEY_MODE_CBC && mode != SYM_KEY_MODE_GCM {
+		logger.Errorf("Invalid sym key encryption mode: %v", mode)
+		return errors.Errorf("Invalid sym key encryption mode: %v", mode)
+	}
+	if mode == symKeyEncryptionMode {
+		return nil
+	}
+	if atomic.LoadInt32(&symKeyEncryptionModeFixed) == 1 {
+		logger.Errorf("Sym key encryption mode can't be changed after data has been encrypted")
+		return errors.New("Sym key encryption mode can't be changed after data has been encrypted")
+	}
+	symKeyEncryptionMode = mode
+	return nil
+}
+
+// GetSymKeyEncryptionMode returns the mode used by EncryptWithSymKey.
+func GetSymKeyEncryptionMode() string {
+	return symKeyEncryptionMode
+}
+
 // EncryptWithSymKey encrypts data using the provided AES sym key.
+// The mode is set by SetSymKeyEncryptionMode; the default is AES-CBC.
 func EncryptWithSymKey(symKey []byte, data []byte) ([]byte, error) {
+	if atomic.LoadInt32(&symKeyEncryptionModeFixed) == 0 {
+		atomic.StoreInt32(&symKeyEncryptionModeFixed, 1)
+	}
+	if symKeyEncryptionMode == SYM_KEY_MODE_CBC {
+		return EncryptWithSymKeyCBC(symKey, data)
+	}
+	return EncryptWithSymKeyGCM(symKey, data)
+}
+
+// EncryptWithSymKeyGCM encrypts data using the provided AES sym key in GCM mode.
+// The returned ciphertext is SYM_KEY_ENVELOPE_PREFIX || SYM_KEY_VERSION_GCM || nonce || sealed data.
+func EncryptWithSymKeyGCM(symKey []byte, data []byte) ([]byte, error) {
+	// Check that symKey is a valid AES sym key
+	if !ValidateSymKey(symKey) {
+		err := errors.WithStack(&custom_errors.InvalidSymKeyError{})
+		logger.Errorf("%v", err)
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(symKey)
+	if err != nil {
+		logger.Errorf("Failed aes.NewCipher: %v", err)
+		return nil, errors.Wrap(err, "Failed aes.NewCipher")
+	}
+
+	aesgcm, err := cipher.NewGCMWithNonceSize(block, gcmNonceSize)
+	if err != nil {
+		logger.Errorf("Failed cipher.NewGCM: %v", err)
+		return nil, errors.Wrap(err, "Failed cipher.NewGCM")
+	}
+
+	ciphertext := make([]byte, gcmHeaderSize+gcmNonceSize, gcmHeaderSize+gcmNonceSize+len(data)+aesgcm.Overhead())
+	copy(ciphertext, SYM_KEY_ENVELOPE_PREFIX)
+	ciphertext[gcmHeaderSize-1] = SYM_KEY_VERSION_GCM
+	nonce := ciphertext[gcmHeaderSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		logger.Errorf("Failed to generate nonce: %v", err)
+		return nil, errors.Wrap(err, "Failed to generate nonce")
+	}
+
+	return aesgcm.Seal(ciphertext, nonce, data, nil), nil
+}
+
+// EncryptWithSymKeyCBC encrypts data using the provided AES sym key in legacy CBC mode.
+// Since the IV is copied from the data, data that starts with SYM_KEY_ENVELOPE_PREFIX can't be encrypted
+// in CBC mode, and an error is returned. Such ciphertexts written before versioned ciphertexts existed
+// can still be decrypted by DecryptWithSymKey.
+func EncryptWithSymKeyCBC(symKey []byte, data []byte) ([]byte, error) {
 	// Check that symKey is a valid AES sym key
 	if !ValidateSymKey(symKey) {
 		err := errors.WithStack(&custom_errors.InvalidSymKeyError{})
@@ -58,6 +252,12 @@ func EncryptWithSymKey(symKey []byte, data []byte) ([]byte, error) {
 	// next whole block.
 	data = pad(data)
 
+	// the IV is copied from the data, so CBC ciphertexts must not look like versioned ciphertexts
+	if bytes.HasPrefix(data, []byte(SYM_KEY_ENVELOPE_PREFIX)) {
+		logger.Errorf("Data starting with the sym key envelope prefix can't be encrypted in CBC mode")
+		return nil, errors.New("Data starting with the sym key envelope prefix can't be encrypted in CBC mode")
+	}
+
 	// Create a new cipher using the key you want to use.
 	block, err := aes.NewCipher(symKey)
 	if err != nil {
@@ -84,6 +284,11 @@ func EncryptWithSymKey(symKey []byte, data []byte) ([]byte, error) {
 }
 
 // DecryptWithSymKey decrypts data with the provided AES sym key.
+// Both AES-GCM ciphertexts (starting with SYM_KEY_ENVELOPE_PREFIX) and legacy AES-CBC ciphertexts
+// are supported. A ciphertext starting with SYM_KEY_ENVELOPE_PREFIX that can't be decrypted as GCM
+// is decrypted as CBC, since legacy CBC ciphertexts of data starting with the prefix start with it too.
+// It is only accepted if its first block matches its IV, as it does for all legacy CBC ciphertexts.
+// Otherwise, if a GCM ciphertext fails authentication, an error is returned.
 func DecryptWithSymKey(symKey []byte, encryptedData []byte) ([]byte, error) {
 	// Check that symKey is a valid AES sym key
 	if !ValidateSymKey(symKey) {
@@ -105,21 +310,72 @@ func DecryptWithSymKey(symKey []byte, encryptedData []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	if bytes.HasPrefix(encryptedData, []byte(SYM_KEY_ENVELOPE_PREFIX)) {
+		plaintext, err := decryptWithSymKeyGCM(block, encryptedData)
+		if err == nil {
+			return plaintext, nil
+		}
+		// the IV of legacy CBC ciphertexts is the first block of the padded data
+		plaintext, cbcErr := decryptWithSymKeyCBC(block, encryptedData)
+		if cbcErr == nil && bytes.Equal(pad(plaintext)[:aes.BlockSize], encryptedData[:aes.BlockSize]) {
+			logger.Debugf("Decrypted legacy CBC ciphertext starting with the sym key envelope prefix")
+			return plaintext, nil
+		}
+		return nil, err
+	}
+
+	return decryptWithSymKeyCBC(block, encryptedData)
+}
+
+// decryptWithSymKeyGCM decrypts a versioned AES-GCM ciphertext.
+func decryptWithSymKeyGCM(block cipher.Block, encryptedData []byte) ([]byte, error) {
+	if len(encryptedData) < gcmHeaderSize || encryptedData[gcmHeaderSize-1] != SYM_KEY_VERSION_GCM {
+		logger.Errorf("Unsupported sym key ciphertext version")
+		return nil, errors.New("Unsupported sym key ciphertext version")
+	}
+
+	aesgcm, err := cipher.NewGCMWithNonceSize(block, gcmNonceSize)
+	if err != nil {
+		logger.Errorf("Failed cipher.NewGCM: %v", err)
+		return nil, errors.Wrap(err, "Failed cipher.NewGCM")
+	}
+	if len(encryptedData) < gcmHeaderSize+gcmNonceSize+aesgcm.Overhead() {
+		err := errors.WithStack(&custom_errors.CiphertextLengthError{})
+		logger.Errorf("%v", err)
+		return nil, err
+	}
+
+	nonce := encryptedData[gcmHeaderSize : gcmHeaderSize+gcmNonceSize]
+	plaintext, err := aesgcm.Open(nil, nonce, encryptedData[gcmHeaderSize+gcmNonceSize:], nil)
+	if err != nil {
+		custom_err := &custom_errors.DecryptionError{ToDecrypt: "ciphertext", DecryptionKey: "sym key"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	if plaintext == nil {
+		plaintext = []byte{}
+	}
+	return plaintext, nil
+}
+
+// decryptWithSymKeyCBC decrypts a legacy AES-CBC ciphertext.
+func decryptWithSymKeyCBC(block cipher.Block, encryptedData []byte) ([]byte, error) {
 	// The IV needs to be unique, but not secure. Therefore it's common to
 	// include it at the beginning of the ciphertext.
 	if len(encryptedData) < aes.BlockSize {
-		err = errors.WithStack(&custom_errors.CiphertextLengthError{})
+		err := errors.WithStack(&custom_errors.CiphertextLengthError{})
 		logger.Errorf("%v", err)
 		return nil, err
 	}
 	iv := encryptedData[:aes.BlockSize]
 	//logger.Debugf("iv: %x", iv)
-	encryptedData = encryptedData[aes.BlockSize:]
+	// copy so that the caller's ciphertext is not overwritten
+	encryptedData = append([]byte{}, encryptedData[aes.BlockSize:]...)
 	//logger.Debugf("text: %x", ciphertext)
 
 	// CBC mode always works in whole blocks.
 	if len(encryptedData)%aes.BlockSize != 0 {
-		err = errors.WithStack(&custom_errors.CiphertextBlockSizeError{})
+		err := errors.WithStack(&custom_errors.CiphertextBlockSizeError{})
 		logger.Errorf("%v", err)
 		return nil, err
 	}
@@ -139,7 +395,7 @@ func DecryptWithSymKey(symKey []byte, encryptedData []byte) ([]byte, error) {
 	// then the plaintext was malformed, signifying that the cipher
 	// text was not decrypted properly
 	if encryptedData == nil {
-		err = errors.New("Decryption Failure")
+		err := errors.New("Decryption Failure")
 		logger.Errorf("%v", err)
 		return nil, err
 	}
@@ -244,6 +500,14 @@ func GetSymKeyFromHash(seed []byte) []byte {
 	return seedHash[:32]
 }
 
+// DeriveSymKey returns a sym key derived from the sym key key and label with HMAC-SHA256.
+// Different labels give independent keys, and the derived keys reveal nothing about key.
+func DeriveSymKey(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
 // MarshalPrivateKey marshals a *rsa.PrivateKey into a []byte.
 func MarshalPrivateKey(key *rsa.PrivateKey) []byte {
 	return x509.MarshalPKCS1PrivateKey(key)
@@ -255,7 +519,12 @@ func ParsePrivateKey(key []byte) (*rsa.PrivateKey, error) {
 	if cs1key, err1 := x509.ParsePKCS1PrivateKey(key); err1 == nil {
 		privkey = cs1key
 	} else if cs8key, err2 := x509.ParsePKCS8PrivateKey(key); err2 == nil {
-		privkey = cs8key.(*rsa.PrivateKey)
+		rsaKey, ok := cs8key.(*rsa.PrivateKey)
+		if !ok {
+			logger.Errorf("Unable to cast private key to *rsa.PrivateKey")
+			return nil, errors.New("Unable to cast private key to *rsa.PrivateKey")
+		}
+		privkey = rsaKey
 	} else {
 		logger.Errorf("Unable to parse private key using x509.ParsePKCS1PrivateKey: %v", err1)
 		logger.Errorf("Unable to parse private key using x509.ParsePKCS8PrivateKey: %v", err2)
@@ -270,9 +539,10 @@ func ValidatePrivateKey(key []byte) bool {
 	if err1 == nil {
 		return true
 	}
-	_, err2 := x509.ParsePKCS8PrivateKey(key)
+	cs8key, err2 := x509.ParsePKCS8PrivateKey(key)
 	if err2 == nil {
-		return true
+		_, ok := cs8key.(*rsa.PrivateKey)
+		return ok
 	}
 	return false
 }
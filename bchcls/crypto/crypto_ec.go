@@ -0,0 +1,529 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package crypto
+
+import (
+	"common/bchcls/custom_errors"
+
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io"
+	"math/big"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Asymmetric key types returned by GetKeyType.
+// KEY_TYPE_EC_P256 keys are used for ECDSA signatures and ECDH key agreement on NIST P-256.
+// KEY_TYPE_ED25519 keys are used for Ed25519 signatures, and the equivalent X25519 key is used for key agreement.
+const (
+	KEY_TYPE_RSA     = "rsa"
+	KEY_TYPE_EC_P256 = "ec_p256"
+	KEY_TYPE_ED25519 = "ed25519"
+)
+
+// PUBLIC_KEY_HEADER_ECIES is the version byte prepended to ciphertexts returned by EncryptWithPublicKeyECIES.
+const PUBLIC_KEY_HEADER_ECIES byte = 0x02
+
+// x25519KeySize is the size of X25519 keys and shared secrets.
+const x25519KeySize = 32
+
+// oidEd25519 is the algorithm identifier of Ed25519 keys (RFC 8410).
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// ed25519PrivateKeyInfo is the PKCS#8 encoding of an Ed25519 private key.
+type ed25519PrivateKeyInfo struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	Attributes []asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// ed25519PublicKeyInfo is the PKIX encoding of an Ed25519 public key.
+type ed25519PublicKeyInfo struct {
+	Algo      pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// ParseAnyPrivateKey parses key bytes into an *rsa.PrivateKey, an *ecdsa.PrivateKey (P-256), or an ed25519.PrivateKey.
+// RSA keys can be PKCS#1 or PKCS#8, EC keys can be PKCS#8 or SEC 1, and Ed25519 keys must be PKCS#8.
+func ParseAnyPrivateKey(key []byte) (interface{}, error) {
+	privateKey, err := parseAnyPrivateKey(key)
+	if err != nil {
+		logger.Errorf("Unable to parse private key: %v", err)
+		return nil, errors.Wrap(err, "Unable to parse private key")
+	}
+	return privateKey, nil
+}
+
+// ParseAnyPublicKey parses PKIX key bytes into an *rsa.PublicKey, an *ecdsa.PublicKey (P-256), or an ed25519.PublicKey.
+func ParseAnyPublicKey(key []byte) (interface{}, error) {
+	publicKey, err := parseAnyPublicKey(key)
+	if err != nil {
+		logger.Errorf("Unable to parse public key: %v", err)
+		return nil, errors.Wrap(err, "Unable to parse public key")
+	}
+	return publicKey, nil
+}
+
+// ParseAnyPrivateKeyB64 parses a B64 key string using ParseAnyPrivateKey.
+func ParseAnyPrivateKeyB64(privateKeyB64 string) (interface{}, error) {
+	decodedPrivateKey, err := base64.StdEncoding.DecodeString(privateKeyB64)
+	if err != nil || decodedPrivateKey == nil {
+		logger.Errorf("invalid privateKeyB64: %v", err)
+		return nil, errors.New("invalid privateKeyB64")
+	}
+	return ParseAnyPrivateKey(decodedPrivateKey)
+}
+
+// ParseAnyPublicKeyB64 parses a B64 key string using ParseAnyPublicKey.
+func ParseAnyPublicKeyB64(publicKeyB64 string) (interface{}, error) {
+	decodedPublicKey, err := base64.StdEncoding.DecodeString(publicKeyB64)
+	if err != nil || decodedPublicKey == nil {
+		logger.Errorf("invalid publicKeyB64 - %v: %v", publicKeyB64, err)
+		return nil, errors.New("invalid publicKeyB64")
+	}
+	return ParseAnyPublicKey(decodedPublicKey)
+}
+
+// ValidateAnyPrivateKey returns true if the key is a valid RSA, EC P-256, or Ed25519 private key.
+func ValidateAnyPrivateKey(key []byte) bool {
+	_, err := parseAnyPrivateKey(key)
+	return err == nil
+}
+
+// ValidateAnyPublicKey returns true if the key is a valid RSA, EC P-256, or Ed25519 public key.
+func ValidateAnyPublicKey(key []byte) bool {
+	_, err := parseAnyPublicKey(key)
+	return err == nil
+}
+
+// GetKeyType returns KEY_TYPE_RSA, KEY_TYPE_EC_P256, or KEY_TYPE_ED25519 for the given public or private key bytes.
+// It returns an empty string if the key is not a supported asymmetric key.
+func GetKeyType(key []byte) string {
+	if publicKey, err := parseAnyPublicKey(key); err == nil {
+		return getKeyTypeOf(publicKey)
+	}
+	if privateKey, err := parseAnyPrivateKey(key); err == nil {
+		return getKeyTypeOf(privateKey)
+	}
+	return ""
+}
+
+// getKeyTypeOf returns the key type of a parsed public or private key.
+func getKeyTypeOf(key interface{}) string {
+	switch key.(type) {
+	case *rsa.PublicKey, *rsa.PrivateKey:
+		return KEY_TYPE_RSA
+	case *ecdsa.PublicKey, *ecdsa.PrivateKey:
+		return KEY_TYPE_EC_P256
+	case ed25519.PublicKey, ed25519.PrivateKey:
+		return KEY_TYPE_ED25519
+	}
+	return ""
+}
+
+// GetPublicKeyBytesFromPrivateKey returns the PKIX encoded public key of the given private key bytes.
+func GetPublicKeyBytesFromPrivateKey(key []byte) ([]byte, error) {
+	privateKey, err := ParseAnyPrivateKey(key)
+	if err != nil {
+		custom_err := &custom_errors.ParseKeyError{Type: "private key"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	return MarshalAnyPublicKey(GetPublicKeyOf(privateKey))
+}
+
+// GetPublicKeyOf returns the public key of an *rsa.PrivateKey, *ecdsa.PrivateKey, or ed25519.PrivateKey.
+// It returns nil for any other type.
+func GetPublicKeyOf(privateKey interface{}) interface{} {
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return &privateKey.PublicKey
+	case *ecdsa.PrivateKey:
+		return &privateKey.PublicKey
+	case ed25519.PrivateKey:
+		return privateKey.Public().(ed25519.PublicKey)
+	}
+	return nil
+}
+
+// MarshalAnyPrivateKey marshals an *rsa.PrivateKey (PKCS#1), *ecdsa.PrivateKey (PKCS#8), or ed25519.PrivateKey (PKCS#8) into a []byte.
+func MarshalAnyPrivateKey(privateKey interface{}) ([]byte, error) {
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return x509.MarshalPKCS1PrivateKey(privateKey), nil
+	case *ecdsa.PrivateKey:
+		return x509.MarshalPKCS8PrivateKey(privateKey)
+	case ed25519.PrivateKey:
+		seed, err := asn1.Marshal(privateKey.Seed())
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return asn1.Marshal(ed25519PrivateKeyInfo{
+			Algo:       pkix.AlgorithmIdentifier{Algorithm: oidEd25519},
+			PrivateKey: seed,
+		})
+	default:
+		logger.Errorf("Unsupported private key type %T", privateKey)
+		return nil, errors.Errorf("Unsupported private key type %T", privateKey)
+	}
+}
+
+// MarshalAnyPublicKey marshals an *rsa.PublicKey, *ecdsa.PublicKey, or ed25519.PublicKey into a PKIX []byte.
+func MarshalAnyPublicKey(publicKey interface{}) ([]byte, error) {
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return x509.MarshalPKIXPublicKey(publicKey)
+	case ed25519.PublicKey:
+		return asn1.Marshal(ed25519PublicKeyInfo{
+			Algo:      pkix.AlgorithmIdentifier{Algorithm: oidEd25519},
+			PublicKey: asn1.BitString{Bytes: publicKey, BitLength: 8 * len(publicKey)},
+		})
+	default:
+		logger.Errorf("Unsupported public key type %T", publicKey)
+		return nil, errors.Errorf("Unsupported public key type %T", publicKey)
+	}
+}
+
+// GenerateECPrivateKey generates a random P-256 EC private key.
+func GenerateECPrivateKey() *ecdsa.PrivateKey {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return privateKey
+}
+
+// GenerateEd25519PrivateKey generates a random Ed25519 private key.
+func GenerateEd25519PrivateKey() ed25519.PrivateKey {
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	return privateKey
+}
+
+// EncryptWithAnyPublicKey encrypts data with an RSA public key (PKCS#1 v1.5),
+// or with an EC P-256 or Ed25519 public key (ECIES).
+func EncryptWithAnyPublicKey(publicKey interface{}, data []byte) ([]byte, error) {
+	if rsaPublicKey, ok := publicKey.(*rsa.PublicKey); ok {
+		return EncryptWithPublicKey(rsaPublicKey, data)
+	}
+	return EncryptWithPublicKeyECIES(publicKey, data)
+}
+
+// DecryptWithAnyPrivateKey decrypts data encrypted by EncryptWithAnyPublicKey.
+func DecryptWithAnyPrivateKey(privateKey interface{}, data []byte) ([]byte, error) {
+	if rsaPrivateKey, ok := privateKey.(*rsa.PrivateKey); ok {
+		return DecryptWithPrivateKey(rsaPrivateKey, data)
+	}
+	return DecryptWithPrivateKeyECIES(privateKey, data)
+}
+
+// EncryptWithPublicKeyECIES encrypts data for the owner of an *ecdsa.PublicKey (P-256) or an ed25519.PublicKey.
+// An ephemeral key pair is generated and a sym key is derived with HKDF-SHA256 from the ECDH (or X25519) shared secret.
+// Data is encrypted with the sym key using AES-GCM.
+// The returned ciphertext is PUBLIC_KEY_HEADER_ECIES || ephemeral public key || encrypted data.
+// A random ephemeral key is used, so the ciphertext is different each time.
+func EncryptWithPublicKeyECIES(publicKey interface{}, data []byte) ([]byte, error) {
+	var ephemeralPublicKey, recipientPublicKey, sharedSecret []byte
+	switch publicKey := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if publicKey == nil || publicKey.Curve != elliptic.P256() {
+			logger.Errorf("Public key must be a P-256 public key")
+			return nil, errors.New("Public key must be a P-256 public key")
+		}
+		ephemeralKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			logger.Errorf("Failed to generate ephemeral key: %v", err)
+			return nil, errors.Wrap(err, "Failed to generate ephemeral key")
+		}
+		ephemeralPublicKey = elliptic.Marshal(elliptic.P256(), ephemeralKey.X, ephemeralKey.Y)
+		recipientPublicKey = elliptic.Marshal(elliptic.P256(), publicKey.X, publicKey.Y)
+		sharedSecret = ecdhP256(ephemeralKey.D, publicKey.X, publicKey.Y)
+
+	case ed25519.PublicKey:
+		x25519PublicKey, err := ed25519PublicKeyToX25519(publicKey)
+		if err != nil {
+			logger.Errorf("Failed to convert Ed25519 public key: %v", err)
+			return nil, errors.Wrap(err, "Failed to convert Ed25519 public key")
+		}
+		var scalar, ephemeral [x25519KeySize]byte
+		if _, err := io.ReadFull(rand.Reader, scalar[:]); err != nil {
+			logger.Errorf("Failed to generate ephemeral key: %v", err)
+			return nil, errors.Wrap(err, "Failed to generate ephemeral key")
+		}
+		curve25519.ScalarBaseMult(&ephemeral, &scalar)
+		ephemeralPublicKey = ephemeral[:]
+		recipientPublicKey = x25519PublicKey[:]
+		sharedSecret = x25519(&scalar, x25519PublicKey)
+
+	default:
+		logger.Errorf("Unsupported public key type %T", publicKey)
+		return nil, errors.Errorf("Unsupported public key type %T", publicKey)
+	}
+
+	if sharedSecret == nil {
+		custom_err := &custom_errors.EncryptionError{ToEncrypt: "data", EncryptionKey: "public key"}
+		logger.Errorf("%v: invalid shared secret", custom_err)
+		return nil, errors.WithStack(custom_err)
+	}
+
+	encryptedData, err := EncryptWithSymKeyGCM(deriveECIESKey(sharedSecret, ephemeralPublicKey, recipientPublicKey), data)
+	if err != nil {
+		custom_err := &custom_errors.EncryptionError{ToEncrypt: "data", EncryptionKey: "sym key"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	result := make([]byte, 0, 1+len(ephemeralPublicKey)+len(encryptedData))
+	result = append(result, PUBLIC_KEY_HEADER_ECIES)
+	result = append(result, ephemeralPublicKey...)
+	return append(result, encryptedData...), nil
+}
+
+// DecryptWithPrivateKeyECIES decrypts data encrypted by EncryptWithPublicKeyECIES
+// using the matching *ecdsa.PrivateKey or ed25519.PrivateKey.
+func DecryptWithPrivateKeyECIES(privateKey interface{}, encryptedData []byte) ([]byte, error) {
+	if encryptedData == nil {
+		err := errors.WithStack(&custom_errors.CiphertextEmptyError{})
+		logger.Errorf("%v", err)
+		return nil, err
+	}
+	if len(encryptedData) < 1 || encryptedData[0] != PUBLIC_KEY_HEADER_ECIES {
+		logger.Errorf("Invalid ECIES ciphertext header")
+		return nil, errors.New("Invalid ECIES ciphertext header")
+	}
+
+	var ephemeralPublicKey, recipientPublicKey, sharedSecret []byte
+	switch privateKey := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		if privateKey == nil || privateKey.Curve != elliptic.P256() {
+			logger.Errorf("Private key must be a P-256 private key")
+			return nil, errors.New("Private key must be a P-256 private key")
+		}
+		ephemeralLength := 1 + 2*((elliptic.P256().Params().BitSize+7)/8)
+		if len(encryptedData) < 1+ephemeralLength {
+			err := errors.WithStack(&custom_errors.CiphertextLengthError{})
+			logger.Errorf("%v", err)
+			return nil, err
+		}
+		ephemeralPublicKey = encryptedData[1 : 1+ephemeralLength]
+		x, y := elliptic.Unmarshal(elliptic.P256(), ephemeralPublicKey)
+		if x == nil {
+			logger.Errorf("Invalid ephemeral public key")
+			return nil, errors.New("Invalid ephemeral public key")
+		}
+		recipientPublicKey = elliptic.Marshal(elliptic.P256(), privateKey.X, privateKey.Y)
+		sharedSecret = ecdhP256(privateKey.D, x, y)
+
+	case ed25519.PrivateKey:
+		if len(privateKey) != ed25519.PrivateKeySize {
+			logger.Errorf("Invalid Ed25519 private key")
+			return nil, errors.New("Invalid Ed25519 private key")
+		}
+		if len(encryptedData) < 1+x25519KeySize {
+			err := errors.WithStack(&custom_errors.CiphertextLengthError{})
+			logger.Errorf("%v", err)
+			return nil, err
+		}
+		var ephemeral, recipient [x25519KeySize]byte
+		copy(ephemeral[:], encryptedData[1:1+x25519KeySize])
+		ephemeralPublicKey = ephemeral[:]
+		scalar := ed25519PrivateKeyToX25519(privateKey)
+		curve25519.ScalarBaseMult(&recipient, scalar)
+		recipientPublicKey = recipient[:]
+		sharedSecret = x25519(scalar, &ephemeral)
+
+	default:
+		logger.Errorf("Unsupported private key type %T", privateKey)
+		return nil, errors.Errorf("Unsupported private key type %T", privateKey)
+	}
+
+	if sharedSecret == nil {
+		custom_err := &custom_errors.DecryptionError{ToDecrypt: "data", DecryptionKey: "private key"}
+		logger.Errorf("%v: invalid shared secret", custom_err)
+		return nil, errors.WithStack(custom_err)
+	}
+
+	data, err := DecryptWithSymKey(deriveECIESKey(sharedSecret, ephemeralPublicKey, recipientPublicKey), encryptedData[1+len(ephemeralPublicKey):])
+	if err != nil {
+		custom_err := &custom_errors.DecryptionError{ToDecrypt: "data", DecryptionKey: "sym key"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	return data, nil
+}
+
+// parseAnyPrivateKey parses a supported private key without logging errors.
+func parseAnyPrivateKey(key []byte) (interface{}, error) {
+	if privateKey, ok := parseEd25519PrivateKey(key); ok {
+		return privateKey, nil
+	}
+	if privateKey, err := x509.ParsePKCS1PrivateKey(key); err == nil {
+		return privateKey, nil
+	}
+	if privateKey, err := x509.ParseECPrivateKey(key); err == nil {
+		return checkCurve(privateKey, privateKey.Curve)
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return privateKey, nil
+	case *ecdsa.PrivateKey:
+		return checkCurve(privateKey, privateKey.Curve)
+	default:
+		return nil, errors.Errorf("Unsupported private key type %T", privateKey)
+	}
+}
+
+// parseAnyPublicKey parses a supported public key without logging errors.
+func parseAnyPublicKey(key []byte) (interface{}, error) {
+	if publicKey, ok := parseEd25519PublicKey(key); ok {
+		return publicKey, nil
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return publicKey, nil
+	case *ecdsa.PublicKey:
+		return checkCurve(publicKey, publicKey.Curve)
+	default:
+		return nil, errors.Errorf("Unsupported public key type %T", publicKey)
+	}
+}
+
+// checkCurve returns key if curve is P-256.
+func checkCurve(key interface{}, curve elliptic.Curve) (interface{}, error) {
+	if curve != elliptic.P256() {
+		return nil, errors.Errorf("Unsupported elliptic curve %v", curve.Params().Name)
+	}
+	return key, nil
+}
+
+// parseEd25519PrivateKey parses a PKCS#8 Ed25519 private key.
+func parseEd25519PrivateKey(key []byte) (ed25519.PrivateKey, bool) {
+	info := ed25519PrivateKeyInfo{}
+	if rest, err := asn1.Unmarshal(key, &info); err != nil || len(rest) > 0 || !info.Algo.Algorithm.Equal(oidEd25519) {
+		return nil, false
+	}
+	var seed []byte
+	if rest, err := asn1.Unmarshal(info.PrivateKey, &seed); err != nil || len(rest) > 0 || len(seed) != ed25519.SeedSize {
+		return nil, false
+	}
+	return ed25519.NewKeyFromSeed(seed), true
+}
+
+// parseEd25519PublicKey parses a PKIX Ed25519 public key.
+func parseEd25519PublicKey(key []byte) (ed25519.PublicKey, bool) {
+	info := ed25519PublicKeyInfo{}
+	if rest, err := asn1.Unmarshal(key, &info); err != nil || len(rest) > 0 || !info.Algo.Algorithm.Equal(oidEd25519) {
+		return nil, false
+	}
+	if info.PublicKey.BitLength != 8*ed25519.PublicKeySize {
+		return nil, false
+	}
+	return ed25519.PublicKey(info.PublicKey.RightAlign()), true
+}
+
+// ecdhP256 returns the x coordinate of d * (x, y) on P-256, or nil if (x, y) is not on the curve.
+func ecdhP256(d *big.Int, x *big.Int, y *big.Int) []byte {
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(x, y) {
+		return nil
+	}
+	sx, _ := curve.ScalarMult(x, y, d.Bytes())
+	sxBytes := sx.Bytes()
+	sharedSecret := make([]byte, (curve.Params().BitSize+7)/8)
+	copy(sharedSecret[len(sharedSecret)-len(sxBytes):], sxBytes)
+	return sharedSecret
+}
+
+// x25519 returns scalar * point on Curve25519, or nil if the result is all zeros.
+func x25519(scalar *[x25519KeySize]byte, point *[x25519KeySize]byte) []byte {
+	var sharedSecret, zero [x25519KeySize]byte
+	curve25519.ScalarMult(&sharedSecret, scalar, point)
+	if sharedSecret == zero {
+		return nil
+	}
+	return sharedSecret[:]
+}
+
+// ed25519PrivateKeyToX25519 returns the X25519 scalar of an Ed25519 private key.
+func ed25519PrivateKeyToX25519(privateKey ed25519.PrivateKey) *[x25519KeySize]byte {
+	h := sha512.Sum512(privateKey.Seed())
+	var scalar [x25519KeySize]byte
+	copy(scalar[:], h[:x25519KeySize])
+	scalar[0] &= 248
+	scalar[31] &= 127
+	scalar[31] |= 64
+	return &scalar
+}
+
+// curve25519P is the field prime 2^255 - 19.
+var curve25519P, _ = new(big.Int).SetString("7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffed", 16)
+
+// ed25519PublicKeyToX25519 converts an Ed25519 public key to the equivalent X25519 public key,
+// using the birational map u = (1 + y) / (1 - y).
+func ed25519PublicKeyToX25519(publicKey ed25519.PublicKey) (*[x25519KeySize]byte, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("Invalid Ed25519 public key")
+	}
+	// y is little endian with the sign of x in the top bit
+	yBytes := make([]byte, ed25519.PublicKeySize)
+	for i := range publicKey {
+		yBytes[ed25519.PublicKeySize-1-i] = publicKey[i]
+	}
+	yBytes[0] &= 0x7f
+	y := new(big.Int).SetBytes(yBytes)
+	if y.Cmp(curve25519P) >= 0 {
+		return nil, errors.New("Invalid Ed25519 public key")
+	}
+
+	one := big.NewInt(1)
+	denominator := new(big.Int).Sub(one, y)
+	denominator.Mod(denominator, curve25519P)
+	if denominator.Sign() == 0 {
+		return nil, errors.New("Invalid Ed25519 public key")
+	}
+	u := new(big.Int).Add(one, y)
+	u.Mul(u, denominator.ModInverse(denominator, curve25519P))
+	u.Mod(u, curve25519P)
+
+	var result [x25519KeySize]byte
+	uBytes := u.Bytes()
+	for i := range uBytes {
+		result[i] = uBytes[len(uBytes)-1-i]
+	}
+	return &result, nil
+}
+
+// deriveECIESKey derives a sym key from an ECIES shared secret.
+// Both public keys are bound to the derived key.
+func deriveECIESKey(sharedSecret []byte, ephemeralPublicKey []byte, recipientPublicKey []byte) []byte {
+	info := make([]byte, 0, len(ephemeralPublicKey)+len(recipientPublicKey))
+	info = append(info, ephemeralPublicKey...)
+	info = append(info, recipientPublicKey...)
+	symKey := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, sharedSecret, nil, info), symKey)
+	return symKey
+}
@@ -34,6 +34,40 @@ func ExampleDecryptWithPrivateKey() {
 	DecryptWithPrivateKey(privateKey, encryptedData)
 }
 
+func ExampleEncryptWithPublicKeyOAEP() {
+	data := []byte("data")
+	privateKey := GeneratePrivateKey()
+	publicKey := privateKey.Public().(*rsa.PublicKey)
+
+	EncryptWithPublicKeyOAEP(publicKey, data)
+}
+
+func ExampleDecryptWithPrivateKeyHybrid() {
+	data := []byte("data")
+	privateKey := GeneratePrivateKey()
+	publicKey := privateKey.Public().(*rsa.PublicKey)
+
+	encryptedData, _ := EncryptWithPublicKeyHybrid(publicKey, data)
+
+	DecryptWithPrivateKeyHybrid(privateKey, encryptedData)
+}
+
+func ExampleEncryptWithPublicKeyECIES() {
+	data := []byte("data")
+	privateKey := GenerateECPrivateKey()
+
+	encryptedData, _ := EncryptWithPublicKeyECIES(&privateKey.PublicKey, data)
+
+	DecryptWithPrivateKeyECIES(privateKey, encryptedData)
+}
+
+func ExampleGetKeyType() {
+	privateKeyBytes, _ := MarshalAnyPrivateKey(GenerateEd25519PrivateKey())
+
+	fmt.Println(GetKeyType(privateKeyBytes))
+	// Output: ed25519
+}
+
 func ExampleEncryptWithSymKey() {
 	data := []byte("data")
 	symKey := GenerateSymKey()
@@ -50,6 +84,22 @@ func ExampleDecryptWithSymKey() {
 	DecryptWithSymKey(symKey, encryptedData)
 }
 
+func ExampleEncryptWithSymKeyGCM() {
+	data := []byte("data")
+	symKey := GenerateSymKey()
+
+	EncryptWithSymKeyGCM(symKey, data)
+}
+
+func ExampleSetSymKeyEncryptionMode() {
+	// in the chaincode's main function, before shim.Start:
+	// use authenticated encryption with random nonces
+	err := SetSymKeyEncryptionMode(SYM_KEY_MODE_GCM)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
 func ExampleHash() {
 	data := []byte("data")
 
@@ -0,0 +1,132 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package crypto
+
+import (
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+)
+
+// MAX_SECRET_SHARES is the maximum number of shares SplitSecret can create.
+const MAX_SECRET_SHARES = 255
+
+// gf256Exp and gf256Log are the exponent and logarithm tables of GF(2^8) with
+// the AES reduction polynomial x^8 + x^4 + x^3 + x + 1 and generator 3.
+var gf256Exp [510]byte
+var gf256Log [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gf256Exp[i] = x
+		gf256Exp[i+255] = x
+		gf256Log[x] = byte(i)
+		// multiply by generator 3
+		x2 := x << 1
+		if x&0x80 != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+}
+
+func gf256Mul(a byte, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gf256Exp[int(gf256Log[a])+int(gf256Log[b])]
+}
+
+func gf256Div(a byte, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gf256Exp[int(gf256Log[a])+255-int(gf256Log[b])]
+}
+
+// SplitSecret splits secret into shareCount shares using Shamir's secret sharing over GF(2^8).
+// Any threshold of the shares can be passed to CombineShares to reconstruct the secret,
+// while fewer shares reveal nothing about it.
+// Each share is one byte longer than secret; the last byte is the share's x coordinate.
+// threshold must be at least 2, and shareCount must be between threshold and MAX_SECRET_SHARES.
+func SplitSecret(secret []byte, shareCount int, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("Secret must not be empty")
+	}
+	if threshold < 2 || shareCount < threshold || shareCount > MAX_SECRET_SHARES {
+		return nil, errors.Errorf("Invalid threshold %v for %v shares", threshold, shareCount)
+	}
+
+	shares := make([][]byte, shareCount)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	// one random polynomial of degree threshold-1 per secret byte, with the secret byte as constant term
+	coefficients := make([]byte, threshold-1)
+	for b, secretByte := range secret {
+		_, err := rand.Read(coefficients)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to generate random coefficients")
+		}
+		for _, share := range shares {
+			x := share[len(secret)]
+			y := byte(0)
+			for c := len(coefficients) - 1; c >= 0; c-- {
+				y = gf256Mul(y, x) ^ coefficients[c]
+			}
+			share[b] = gf256Mul(y, x) ^ secretByte
+		}
+	}
+	return shares, nil
+}
+
+// CombineShares reconstructs a secret from shares created by SplitSecret.
+// At least threshold shares must be passed in. If fewer shares are passed in, the result is not the secret,
+// so the caller should verify the reconstructed secret.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("At least 2 shares are required")
+	}
+	shareLen := len(shares[0])
+	if shareLen < 2 {
+		return nil, errors.New("Invalid share length")
+	}
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool)
+	for i, share := range shares {
+		if len(share) != shareLen {
+			return nil, errors.New("All shares must have the same length")
+		}
+		x := share[shareLen-1]
+		if x == 0 || seen[x] {
+			return nil, errors.New("Invalid or duplicate share")
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	// Lagrange interpolation at x = 0
+	secret := make([]byte, shareLen-1)
+	for i, share := range shares {
+		basis := byte(1)
+		for j, xj := range xs {
+			if i != j {
+				basis = gf256Mul(basis, gf256Div(xj, xj^xs[i]))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= gf256Mul(share[b], basis)
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,151 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package crypto
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"math/big"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+)
+
+// ecdsaSignature is the ASN.1 encoding of an ECDSA signature.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// SignWithAnyPrivateKey signs data with an *rsa.PrivateKey (PKCS#1 v1.5 with SHA-256),
+// an *ecdsa.PrivateKey (ASN.1 encoded ECDSA signature of the SHA-256 digest), or an ed25519.PrivateKey.
+// Signatures are deterministic, so that all endorsers of a transaction produce the same signature:
+// ECDSA nonces are derived from the private key and digest as described in RFC 6979.
+// ECDSA signing is not constant-time, so it should not be used where signing times can be measured by an attacker.
+func SignWithAnyPrivateKey(privateKey interface{}, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, gocrypto.SHA256, digest[:])
+		return signature, errors.WithStack(err)
+	case *ecdsa.PrivateKey:
+		r, s, err := signECDSADeterministic(privateKey, digest[:])
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		signature, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+		return signature, errors.WithStack(err)
+	case ed25519.PrivateKey:
+		return ed25519.Sign(privateKey, data), nil
+	default:
+		logger.Errorf("Unsupported private key type %T", privateKey)
+		return nil, errors.Errorf("Unsupported private key type %T", privateKey)
+	}
+}
+
+// VerifyWithAnyPublicKey returns true if signature is a valid signature of data made by SignWithAnyPrivateKey
+// with the private key of publicKey.
+func VerifyWithAnyPublicKey(publicKey interface{}, data []byte, signature []byte) bool {
+	if len(signature) == 0 {
+		return false
+	}
+	digest := sha256.Sum256(data)
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(publicKey, gocrypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		ecdsaSig := ecdsaSignature{}
+		rest, err := asn1.Unmarshal(signature, &ecdsaSig)
+		if err != nil || len(rest) > 0 || ecdsaSig.R == nil || ecdsaSig.S == nil {
+			return false
+		}
+		return ecdsa.Verify(publicKey, digest[:], ecdsaSig.R, ecdsaSig.S)
+	case ed25519.PublicKey:
+		return ed25519.Verify(publicKey, data, signature)
+	default:
+		logger.Errorf("Unsupported public key type %T", publicKey)
+		return false
+	}
+}
+
+// signECDSADeterministic signs digest with privateKey, using the nonce generation of RFC 6979 with HMAC-SHA256.
+// It is checked against the RFC 6979 A.2.5 test vectors for P-256. The nonce and signature are computed with
+// math/big, which is not constant-time, so timing side channels may leak information about the private key
+// to an attacker that can measure signing times precisely, e.g. another process on the same host.
+func signECDSADeterministic(privateKey *ecdsa.PrivateKey, digest []byte) (*big.Int, *big.Int, error) {
+	n := privateKey.Curve.Params().N
+	if n.Sign() == 0 || privateKey.D == nil || privateKey.D.Sign() <= 0 || privateKey.D.Cmp(n) >= 0 {
+		return nil, nil, errors.New("Invalid ECDSA private key")
+	}
+	qlen := n.BitLen()
+	rolen := (qlen + 7) / 8
+
+	bits2int := func(b []byte) *big.Int {
+		v := new(big.Int).SetBytes(b)
+		if len(b)*8 > qlen {
+			v.Rsh(v, uint(len(b)*8-qlen))
+		}
+		return v
+	}
+	int2octets := func(v *big.Int) []byte {
+		out := make([]byte, rolen)
+		vBytes := v.Bytes()
+		copy(out[rolen-len(vBytes):], vBytes)
+		return out
+	}
+	hmacSHA256 := func(key []byte, data ...[]byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		for _, d := range data {
+			mac.Write(d)
+		}
+		return mac.Sum(nil)
+	}
+
+	e := bits2int(digest)
+	x := int2octets(privateKey.D)
+	h := int2octets(new(big.Int).Mod(e, n))
+
+	v := bytes.Repeat([]byte{0x01}, sha256.Size)
+	k := make([]byte, sha256.Size)
+	k = hmacSHA256(k, v, []byte{0x00}, x, h)
+	v = hmacSHA256(k, v)
+	k = hmacSHA256(k, v, []byte{0x01}, x, h)
+	v = hmacSHA256(k, v)
+
+	for {
+		t := []byte{}
+		for len(t)*8 < qlen {
+			v = hmacSHA256(k, v)
+			t = append(t, v...)
+		}
+		nonce := bits2int(t)
+		if nonce.Sign() > 0 && nonce.Cmp(n) < 0 {
+			rx, _ := privateKey.Curve.ScalarBaseMult(int2octets(nonce))
+			r := new(big.Int).Mod(rx, n)
+			if r.Sign() != 0 {
+				// s = nonce^-1 * (e + r * d) mod n
+				s := new(big.Int).Mul(r, privateKey.D)
+				s.Add(s, e)
+				s.Mul(s, new(big.Int).ModInverse(nonce, n))
+				s.Mod(s, n)
+				if s.Sign() != 0 {
+					return r, s, nil
+				}
+			}
+		}
+		k = hmacSHA256(k, v, []byte{0x00})
+		v = hmacSHA256(k, v)
+	}
+}
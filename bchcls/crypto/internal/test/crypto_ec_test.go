@@ -0,0 +1,201 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package test
+
+import (
+	"common/bchcls/crypto"
+	"common/bchcls/custom_errors"
+	"common/bchcls/test_utils"
+
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+)
+
+// RFC 8410 example Ed25519 key pair
+const ed25519PrivateKeyB64 = "MC4CAQAwBQYDK2VwBCIEINTuctv5E1hK1bbY8fdp+K06/nwoy/HU++CXqI9EdVhC"
+const ed25519PublicKeyB64 = "MCowBQYDK2VwAyEAGb9ECWmEzf6FQbrBZ9w7lshQhqowtrbLDFw4rXAxZuE="
+
+func TestParseAnyPrivateKey(t *testing.T) {
+	fmt.Println("TestParseAnyPrivateKey function called")
+	fmt.Println("-- Tests ParseAnyPrivateKey")
+	fmt.Println("-- Tests MarshalAnyPrivateKey")
+
+	// RSA
+	rsaKey := test_utils.GeneratePrivateKey()
+	privateKey, err := crypto.ParseAnyPrivateKey(x509.MarshalPKCS1PrivateKey(rsaKey))
+	test_utils.AssertTrue(t, err == nil, "No error returned from ParseAnyPrivateKey function")
+	_, ok := privateKey.(*rsa.PrivateKey)
+	test_utils.AssertTrue(t, ok, "Expected *rsa.PrivateKey")
+
+	// EC P-256, PKCS#8 and SEC 1
+	ecKey := crypto.GenerateECPrivateKey()
+	ecKeyBytes, err := crypto.MarshalAnyPrivateKey(ecKey)
+	test_utils.AssertTrue(t, err == nil, "No error returned from MarshalAnyPrivateKey function")
+	privateKey, err = crypto.ParseAnyPrivateKey(ecKeyBytes)
+	test_utils.AssertTrue(t, err == nil, "No error returned from ParseAnyPrivateKey function")
+	parsedECKey, ok := privateKey.(*ecdsa.PrivateKey)
+	test_utils.AssertTrue(t, ok && parsedECKey.D.Cmp(ecKey.D) == 0, "Expected matching *ecdsa.PrivateKey")
+	sec1Bytes, _ := x509.MarshalECPrivateKey(ecKey)
+	privateKey, err = crypto.ParseAnyPrivateKey(sec1Bytes)
+	test_utils.AssertTrue(t, err == nil, "No error returned from ParseAnyPrivateKey function for SEC 1 key")
+
+	// Ed25519
+	edKey := crypto.GenerateEd25519PrivateKey()
+	edKeyBytes, err := crypto.MarshalAnyPrivateKey(edKey)
+	test_utils.AssertTrue(t, err == nil, "No error returned from MarshalAnyPrivateKey function")
+	privateKey, err = crypto.ParseAnyPrivateKey(edKeyBytes)
+	test_utils.AssertTrue(t, err == nil, "No error returned from ParseAnyPrivateKey function")
+	parsedEdKey, ok := privateKey.(ed25519.PrivateKey)
+	test_utils.AssertTrue(t, ok && bytes.Equal(parsedEdKey, edKey), "Expected matching ed25519.PrivateKey")
+
+	// RSA-only functions must reject EC keys
+	_, err = crypto.ParsePrivateKey(ecKeyBytes)
+	test_utils.AssertFalse(t, err == nil, "Should be error because ParsePrivateKey only supports RSA keys")
+	test_utils.AssertFalse(t, crypto.ValidatePrivateKey(ecKeyBytes), "ValidatePrivateKey only supports RSA keys")
+
+	// Negative test - unsupported curve
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	p384KeyBytes, _ := x509.MarshalPKCS8PrivateKey(p384Key)
+	_, err = crypto.ParseAnyPrivateKey(p384KeyBytes)
+	test_utils.AssertFalse(t, err == nil, "Should be error because P-384 is not supported")
+
+	// Negative test - invalid key
+	_, err = crypto.ParseAnyPrivateKey([]byte("key"))
+	test_utils.AssertFalse(t, err == nil, "Should be error because ParseAnyPrivateKey was passed an invalid private key")
+}
+
+func TestParseAnyPublicKey(t *testing.T) {
+	fmt.Println("TestParseAnyPublicKey function called")
+	fmt.Println("-- Tests ParseAnyPublicKey")
+	fmt.Println("-- Tests MarshalAnyPublicKey")
+	fmt.Println("-- Tests GetPublicKeyBytesFromPrivateKey")
+
+	ecKey := crypto.GenerateECPrivateKey()
+	ecPublicKeyBytes, err := crypto.MarshalAnyPublicKey(&ecKey.PublicKey)
+	test_utils.AssertTrue(t, err == nil, "No error returned from MarshalAnyPublicKey function")
+	publicKey, err := crypto.ParseAnyPublicKey(ecPublicKeyBytes)
+	test_utils.AssertTrue(t, err == nil, "No error returned from ParseAnyPublicKey function")
+	_, ok := publicKey.(*ecdsa.PublicKey)
+	test_utils.AssertTrue(t, ok, "Expected *ecdsa.PublicKey")
+	ecKeyBytes, _ := crypto.MarshalAnyPrivateKey(ecKey)
+	derivedPublicKeyBytes, err := crypto.GetPublicKeyBytesFromPrivateKey(ecKeyBytes)
+	test_utils.AssertTrue(t, err == nil && bytes.Equal(ecPublicKeyBytes, derivedPublicKeyBytes), "Expected matching EC public key")
+
+	// RFC 8410 example key pair
+	edPrivateKeyBytes, _ := crypto.DecodeStringB64(ed25519PrivateKeyB64)
+	edPublicKeyBytes, _ := crypto.DecodeStringB64(ed25519PublicKeyB64)
+	publicKey, err = crypto.ParseAnyPublicKey(edPublicKeyBytes)
+	test_utils.AssertTrue(t, err == nil, "No error returned from ParseAnyPublicKey function")
+	_, ok = publicKey.(ed25519.PublicKey)
+	test_utils.AssertTrue(t, ok, "Expected ed25519.PublicKey")
+	derivedPublicKeyBytes, err = crypto.GetPublicKeyBytesFromPrivateKey(edPrivateKeyBytes)
+	test_utils.AssertTrue(t, err == nil && bytes.Equal(edPublicKeyBytes, derivedPublicKeyBytes), "Expected matching Ed25519 public key")
+	edPrivateKey, _ := crypto.ParseAnyPrivateKey(edPrivateKeyBytes)
+	marshaledPrivateKey, _ := crypto.MarshalAnyPrivateKey(edPrivateKey)
+	test_utils.AssertTrue(t, bytes.Equal(edPrivateKeyBytes, marshaledPrivateKey), "Expected RFC 8410 private key encoding")
+
+	// RSA-only functions must reject EC keys
+	_, err = crypto.ParsePublicKey(ecPublicKeyBytes)
+	test_utils.AssertFalse(t, err == nil, "Should be error because ParsePublicKey only supports RSA keys")
+
+	// Negative test - invalid key
+	_, err = crypto.ParseAnyPublicKey([]byte("key"))
+	test_utils.AssertFalse(t, err == nil, "Should be error because ParseAnyPublicKey was passed an invalid public key")
+}
+
+func TestGetKeyType(t *testing.T) {
+	fmt.Println("TestGetKeyType function called")
+	fmt.Println("-- Tests GetKeyType")
+	fmt.Println("-- Tests ValidateAnyPrivateKey")
+	fmt.Println("-- Tests ValidateAnyPublicKey")
+
+	rsaKey := test_utils.GeneratePrivateKey()
+	rsaPublicKeyBytes, _ := x509.MarshalPKIXPublicKey(rsaKey.Public())
+	ecKeyBytes, _ := crypto.MarshalAnyPrivateKey(crypto.GenerateECPrivateKey())
+	edKey := crypto.GenerateEd25519PrivateKey()
+	edPublicKeyBytes, _ := crypto.MarshalAnyPublicKey(edKey.Public())
+
+	test_utils.AssertTrue(t, crypto.GetKeyType(x509.MarshalPKCS1PrivateKey(rsaKey)) == crypto.KEY_TYPE_RSA, "Expected RSA key type")
+	test_utils.AssertTrue(t, crypto.GetKeyType(rsaPublicKeyBytes) == crypto.KEY_TYPE_RSA, "Expected RSA key type")
+	test_utils.AssertTrue(t, crypto.GetKeyType(ecKeyBytes) == crypto.KEY_TYPE_EC_P256, "Expected EC P-256 key type")
+	test_utils.AssertTrue(t, crypto.GetKeyType(edPublicKeyBytes) == crypto.KEY_TYPE_ED25519, "Expected Ed25519 key type")
+	test_utils.AssertTrue(t, crypto.GetKeyType(test_utils.GenerateSymKey()) == "", "Expected no key type for sym key")
+
+	test_utils.AssertTrue(t, crypto.ValidateAnyPrivateKey(ecKeyBytes), "Expected valid private key")
+	test_utils.AssertFalse(t, crypto.ValidateAnyPublicKey(ecKeyBytes), "Expected invalid public key")
+	test_utils.AssertTrue(t, crypto.ValidateAnyPublicKey(edPublicKeyBytes), "Expected valid public key")
+	test_utils.AssertFalse(t, crypto.ValidateAnyPrivateKey(edPublicKeyBytes), "Expected invalid private key")
+}
+
+func TestPublicPrivateKeyEncryption_ECIES(t *testing.T) {
+	fmt.Println("TestPublicPrivateKeyEncryption_ECIES function called")
+	fmt.Println("-- Tests EncryptWithPublicKeyECIES")
+	fmt.Println("-- Tests DecryptWithPrivateKeyECIES")
+	fmt.Println("-- Tests EncryptWithAnyPublicKey")
+	fmt.Println("-- Tests DecryptWithAnyPrivateKey")
+
+	originalData := []byte("mydata")
+	ecKey := crypto.GenerateECPrivateKey()
+	edKey := crypto.GenerateEd25519PrivateKey()
+	rsaKey := test_utils.GeneratePrivateKey()
+
+	privateKeys := []interface{}{ecKey, edKey, rsaKey}
+	for _, privateKey := range privateKeys {
+		publicKey := crypto.GetPublicKeyOf(privateKey)
+		encryptedData, err := crypto.EncryptWithAnyPublicKey(publicKey, originalData)
+		test_utils.AssertTrue(t, err == nil, "No error returned from EncryptWithAnyPublicKey function")
+		decryptedData, err := crypto.DecryptWithAnyPrivateKey(privateKey, encryptedData)
+		test_utils.AssertTrue(t, err == nil, "No error returned from DecryptWithAnyPrivateKey function")
+		test_utils.AssertTrue(t, bytes.Equal(originalData, decryptedData), "Expected to get originalData")
+	}
+
+	// ECIES is randomized
+	encryptedData, _ := crypto.EncryptWithPublicKeyECIES(&ecKey.PublicKey, originalData)
+	encryptedData2, _ := crypto.EncryptWithPublicKeyECIES(&ecKey.PublicKey, originalData)
+	test_utils.AssertTrue(t, encryptedData[0] == crypto.PUBLIC_KEY_HEADER_ECIES, "Expected ECIES header")
+	test_utils.AssertFalse(t, bytes.Equal(encryptedData, encryptedData2), "Expected different ciphertexts")
+
+	// Negative test - mismatching private and public keys
+	_, err := crypto.DecryptWithPrivateKeyECIES(crypto.GenerateECPrivateKey(), encryptedData)
+	test_utils.AssertFalse(t, err == nil, "Should be error because mismatching private and public keys")
+	edEncryptedData, _ := crypto.EncryptWithPublicKeyECIES(edKey.Public(), originalData)
+	_, err = crypto.DecryptWithPrivateKeyECIES(crypto.GenerateEd25519PrivateKey(), edEncryptedData)
+	test_utils.AssertFalse(t, err == nil, "Should be error because mismatching private and public keys")
+
+	// Negative test - tampered ciphertext
+	tampered := make([]byte, len(encryptedData))
+	copy(tampered, encryptedData)
+	tampered[len(tampered)-1] ^= 0xff
+	_, err = crypto.DecryptWithPrivateKeyECIES(ecKey, tampered)
+	test_utils.AssertFalse(t, err == nil, "Should be error because ciphertext was tampered")
+
+	// Negative test - invalid ciphertexts
+	_, err = crypto.DecryptWithPrivateKeyECIES(ecKey, nil)
+	_, ok := errors.Cause(err).(*custom_errors.CiphertextEmptyError)
+	test_utils.AssertTrue(t, ok, "Should be CiphertextEmptyError")
+	_, err = crypto.DecryptWithPrivateKeyECIES(edKey, edEncryptedData[:10])
+	_, ok = errors.Cause(err).(*custom_errors.CiphertextLengthError)
+	test_utils.AssertTrue(t, ok, "Should be CiphertextLengthError")
+	_, err = crypto.DecryptWithPrivateKeyECIES(ecKey, append([]byte{0x00}, encryptedData[1:]...))
+	test_utils.AssertFalse(t, err == nil, "Should be error because of invalid header")
+
+	// Negative test - RSA keys are not supported by ECIES
+	_, err = crypto.EncryptWithPublicKeyECIES(rsaKey.Public(), originalData)
+	test_utils.AssertFalse(t, err == nil, "Should be error because RSA keys are not supported")
+}
@@ -0,0 +1,63 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package test
+
+import (
+	"common/bchcls/crypto"
+	"common/bchcls/test_utils"
+
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestSplitSecret(t *testing.T) {
+	fmt.Println("TestSplitSecret function called")
+	fmt.Println("-- Tests SplitSecret")
+	fmt.Println("-- Tests CombineShares")
+
+	secret := crypto.PrivateKeyToBytes(test_utils.GeneratePrivateKey())
+	shares, err := crypto.SplitSecret(secret, 5, 3)
+	test_utils.AssertTrue(t, err == nil, "No error returned from SplitSecret function")
+	test_utils.AssertTrue(t, len(shares) == 5, "Expected 5 shares")
+	test_utils.AssertTrue(t, len(shares[0]) == len(secret)+1, "Expected share length to be secret length + 1")
+
+	// any 3 shares reconstruct the secret
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		subsetShares := [][]byte{}
+		for _, i := range subset {
+			subsetShares = append(subsetShares, shares[i])
+		}
+		result, err := crypto.CombineShares(subsetShares)
+		test_utils.AssertTrue(t, err == nil, "No error returned from CombineShares function")
+		test_utils.AssertTrue(t, bytes.Equal(result, secret), "Expected secret to be reconstructed")
+	}
+
+	// 2 shares don't reconstruct the secret
+	result, err := crypto.CombineShares(shares[:2])
+	test_utils.AssertTrue(t, err == nil, "No error returned from CombineShares function")
+	test_utils.AssertTrue(t, !bytes.Equal(result, secret), "Expected secret not to be reconstructed")
+
+	// invalid input
+	_, err = crypto.SplitSecret(nil, 5, 3)
+	test_utils.AssertTrue(t, err != nil, "Expected SplitSecret of empty secret to fail")
+	_, err = crypto.SplitSecret(secret, 2, 3)
+	test_utils.AssertTrue(t, err != nil, "Expected SplitSecret with threshold larger than share count to fail")
+	_, err = crypto.SplitSecret(secret, 5, 1)
+	test_utils.AssertTrue(t, err != nil, "Expected SplitSecret with threshold 1 to fail")
+	_, err = crypto.SplitSecret(secret, crypto.MAX_SECRET_SHARES+1, 3)
+	test_utils.AssertTrue(t, err != nil, "Expected SplitSecret with too many shares to fail")
+	_, err = crypto.CombineShares(shares[:1])
+	test_utils.AssertTrue(t, err != nil, "Expected CombineShares of 1 share to fail")
+	_, err = crypto.CombineShares([][]byte{shares[0], shares[0], shares[1]})
+	test_utils.AssertTrue(t, err != nil, "Expected CombineShares of duplicate shares to fail")
+	_, err = crypto.CombineShares([][]byte{shares[0], shares[1][1:], shares[2]})
+	test_utils.AssertTrue(t, err != nil, "Expected CombineShares of shares with different lengths to fail")
+}
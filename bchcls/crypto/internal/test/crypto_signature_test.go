@@ -0,0 +1,91 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package test
+
+import (
+	"common/bchcls/crypto"
+	"common/bchcls/test_utils"
+
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestSignWithAnyPrivateKey(t *testing.T) {
+	fmt.Println("TestSignWithAnyPrivateKey function called")
+	fmt.Println("-- Tests SignWithAnyPrivateKey")
+	fmt.Println("-- Tests VerifyWithAnyPublicKey")
+
+	data := []byte("data to sign")
+	privateKeys := []interface{}{test_utils.GeneratePrivateKey(), crypto.GenerateECPrivateKey(), crypto.GenerateEd25519PrivateKey()}
+	for i, privateKey := range privateKeys {
+		publicKey := crypto.GetPublicKeyOf(privateKey)
+		signature, err := crypto.SignWithAnyPrivateKey(privateKey, data)
+		test_utils.AssertTrue(t, err == nil, "No error returned from SignWithAnyPrivateKey function")
+		test_utils.AssertTrue(t, len(signature) > 0, "Expected signature")
+		test_utils.AssertTrue(t, crypto.VerifyWithAnyPublicKey(publicKey, data, signature), "Expected signature to be valid")
+
+		// modified data, modified signature, and another key should fail
+		test_utils.AssertFalse(t, crypto.VerifyWithAnyPublicKey(publicKey, []byte("other data"), signature), "Expected signature of other data to be invalid")
+		badSignature := append([]byte{}, signature...)
+		badSignature[len(badSignature)-1] ^= 1
+		test_utils.AssertFalse(t, crypto.VerifyWithAnyPublicKey(publicKey, data, badSignature), "Expected modified signature to be invalid")
+		test_utils.AssertFalse(t, crypto.VerifyWithAnyPublicKey(publicKey, data, nil), "Expected empty signature to be invalid")
+		otherPublicKey := crypto.GetPublicKeyOf(privateKeys[(i+1)%len(privateKeys)])
+		test_utils.AssertFalse(t, crypto.VerifyWithAnyPublicKey(otherPublicKey, data, signature), "Expected signature to be invalid for another key")
+	}
+
+	// signatures are deterministic
+	for _, privateKey := range privateKeys {
+		signature1, err := crypto.SignWithAnyPrivateKey(privateKey, data)
+		test_utils.AssertTrue(t, err == nil, "No error returned from SignWithAnyPrivateKey function")
+		signature2, err := crypto.SignWithAnyPrivateKey(privateKey, data)
+		test_utils.AssertTrue(t, err == nil, "No error returned from SignWithAnyPrivateKey function")
+		test_utils.AssertTrue(t, bytes.Equal(signature1, signature2), "Expected the same signature for the same key and data")
+	}
+
+	_, err := crypto.SignWithAnyPrivateKey("not a key", data)
+	test_utils.AssertTrue(t, err != nil, "Expected SignWithAnyPrivateKey to fail for an unsupported key")
+}
+
+func TestSignWithAnyPrivateKey_RFC6979(t *testing.T) {
+	fmt.Println("TestSignWithAnyPrivateKey_RFC6979 function called")
+	fmt.Println("-- Tests SignWithAnyPrivateKey with the RFC 6979 A.2.5 test vectors for P-256 with SHA-256")
+
+	d, _ := new(big.Int).SetString("C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721", 16)
+	ecKey := &ecdsa.PrivateKey{D: d}
+	ecKey.Curve = elliptic.P256()
+	ecKey.X, ecKey.Y = ecKey.Curve.ScalarBaseMult(d.Bytes())
+	expectedX, _ := new(big.Int).SetString("60FED4BA255A9D31C961EB74C6356D68C049B8923B61FA6CE669622E60F29FB6", 16)
+	expectedY, _ := new(big.Int).SetString("7903FE1008B8BC99A41AE9E95628BC64F2F1B20C2D7E9F5177A3C294D4462299", 16)
+	test_utils.AssertTrue(t, ecKey.X.Cmp(expectedX) == 0 && ecKey.Y.Cmp(expectedY) == 0, "Expected the RFC 6979 public key")
+
+	vectors := []struct {
+		message string
+		r       string
+		s       string
+	}{
+		{"sample", "EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716", "F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8"},
+		{"test", "F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367", "019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083"},
+	}
+	for _, vector := range vectors {
+		signature, err := crypto.SignWithAnyPrivateKey(ecKey, []byte(vector.message))
+		test_utils.AssertTrue(t, err == nil, "No error returned from SignWithAnyPrivateKey function")
+		expectedR, _ := new(big.Int).SetString(vector.r, 16)
+		expectedS, _ := new(big.Int).SetString(vector.s, 16)
+		expectedSignature, _ := asn1.Marshal(struct{ R, S *big.Int }{expectedR, expectedS})
+		test_utils.AssertTrue(t, bytes.Equal(signature, expectedSignature), "Expected the RFC 6979 signature of "+vector.message)
+		test_utils.AssertTrue(t, crypto.VerifyWithAnyPublicKey(&ecKey.PublicKey, []byte(vector.message), signature), "Expected signature to be valid")
+	}
+}
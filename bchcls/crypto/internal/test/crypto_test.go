@@ -15,6 +15,8 @@ import (
 	"common/bchcls/test_utils"
 
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/asn1"
@@ -51,6 +53,85 @@ func TestPublicPrivateKeyEncryption(t *testing.T) {
 	test_utils.AssertFalse(t, err4 == nil, "Should be error because mismatching private and public keys")
 }
 
+func TestPublicPrivateKeyEncryption_OAEP(t *testing.T) {
+	fmt.Println("TestPublicPrivateKeyEncryption_OAEP function called")
+	fmt.Println("-- Tests EncryptWithPublicKeyOAEP")
+	fmt.Println("-- Tests DecryptWithPrivateKeyOAEP")
+
+	originalData := []byte("mydata")
+	privateKey := test_utils.GeneratePrivateKey()
+
+	encryptedData, err1 := crypto.EncryptWithPublicKeyOAEP(privateKey.Public().(*rsa.PublicKey), originalData)
+	decryptedData, err2 := crypto.DecryptWithPrivateKeyOAEP(privateKey, encryptedData)
+	test_utils.AssertTrue(t, err1 == nil, "No error returned from EncryptWithPublicKeyOAEP function")
+	test_utils.AssertTrue(t, err2 == nil, "No error returned from DecryptWithPrivateKeyOAEP function")
+	test_utils.AssertTrue(t, bytes.Equal(originalData, decryptedData), "Expected to get originalData")
+
+	// OAEP is randomized
+	encryptedData2, _ := crypto.EncryptWithPublicKeyOAEP(privateKey.Public().(*rsa.PublicKey), originalData)
+	test_utils.AssertFalse(t, bytes.Equal(encryptedData, encryptedData2), "Expected different ciphertexts")
+
+	// Negative test - PKCS1v15 ciphertext cannot be decrypted as OAEP
+	encryptedPKCS1, _ := crypto.EncryptWithPublicKey(privateKey.Public().(*rsa.PublicKey), originalData)
+	_, err3 := crypto.DecryptWithPrivateKeyOAEP(privateKey, encryptedPKCS1)
+	test_utils.AssertFalse(t, err3 == nil, "Should be error because of PKCS1v15 ciphertext")
+
+	// Negative test - mismatching private and public keys
+	privateKey2 := test_utils.GeneratePrivateKey()
+	_, err4 := crypto.DecryptWithPrivateKeyOAEP(privateKey2, encryptedData)
+	test_utils.AssertFalse(t, err4 == nil, "Should be error because mismatching private and public keys")
+
+	// Negative test - nil public key
+	_, err5 := crypto.EncryptWithPublicKeyOAEP(nil, originalData)
+	test_utils.AssertFalse(t, err5 == nil, "Should be error because public key is nil")
+}
+
+func TestPublicPrivateKeyEncryption_Hybrid(t *testing.T) {
+	fmt.Println("TestPublicPrivateKeyEncryption_Hybrid function called")
+	fmt.Println("-- Tests EncryptWithPublicKeyHybrid")
+	fmt.Println("-- Tests DecryptWithPrivateKeyHybrid")
+
+	// larger than what RSA can encrypt directly
+	originalData := bytes.Repeat([]byte("mydata"), 2000)
+	privateKey := test_utils.GeneratePrivateKey()
+
+	encryptedData, err1 := crypto.EncryptWithPublicKeyHybrid(privateKey.Public().(*rsa.PublicKey), originalData)
+	decryptedData, err2 := crypto.DecryptWithPrivateKeyHybrid(privateKey, encryptedData)
+	test_utils.AssertTrue(t, err1 == nil, "No error returned from EncryptWithPublicKeyHybrid function")
+	test_utils.AssertTrue(t, err2 == nil, "No error returned from DecryptWithPrivateKeyHybrid function")
+	test_utils.AssertTrue(t, encryptedData[0] == crypto.PUBLIC_KEY_HEADER_HYBRID, "Expected hybrid header")
+	test_utils.AssertTrue(t, bytes.Equal(originalData, decryptedData), "Expected to get originalData")
+
+	// empty data
+	encryptedEmpty, _ := crypto.EncryptWithPublicKeyHybrid(privateKey.Public().(*rsa.PublicKey), []byte{})
+	decryptedEmpty, err3 := crypto.DecryptWithPrivateKeyHybrid(privateKey, encryptedEmpty)
+	test_utils.AssertTrue(t, err3 == nil && len(decryptedEmpty) == 0, "Expected to decrypt empty data")
+
+	// Negative test - tampered ciphertext
+	tampered := make([]byte, len(encryptedData))
+	copy(tampered, encryptedData)
+	tampered[len(tampered)-1] ^= 0xff
+	_, err4 := crypto.DecryptWithPrivateKeyHybrid(privateKey, tampered)
+	test_utils.AssertFalse(t, err4 == nil, "Should be error because ciphertext was tampered")
+
+	// Negative test - mismatching private and public keys
+	privateKey2 := test_utils.GeneratePrivateKey()
+	_, err5 := crypto.DecryptWithPrivateKeyHybrid(privateKey2, encryptedData)
+	test_utils.AssertFalse(t, err5 == nil, "Should be error because mismatching private and public keys")
+
+	// Negative test - invalid ciphertexts
+	_, err6 := crypto.DecryptWithPrivateKeyHybrid(privateKey, nil)
+	_, ok := errors.Cause(err6).(*custom_errors.CiphertextEmptyError)
+	test_utils.AssertTrue(t, ok, "Should be CiphertextEmptyError")
+	_, err7 := crypto.DecryptWithPrivateKeyHybrid(privateKey, encryptedData[:10])
+	_, ok = errors.Cause(err7).(*custom_errors.CiphertextLengthError)
+	test_utils.AssertTrue(t, ok, "Should be CiphertextLengthError")
+	encryptedPKCS1, _ := crypto.EncryptWithPublicKey(privateKey.Public().(*rsa.PublicKey), []byte("mydata"))
+	encryptedPKCS1[0] = 0x00
+	_, err8 := crypto.DecryptWithPrivateKeyHybrid(privateKey, encryptedPKCS1)
+	test_utils.AssertFalse(t, err8 == nil, "Should be error because of invalid header")
+}
+
 func TestParsePrivateKey_PKCS1(t *testing.T) {
 	fmt.Println("TestParsePrivateKey_PKCS1 function called")
 	fmt.Println("-- Tests ParsePrivateKey_PKCS1")
@@ -130,6 +211,17 @@ func TestSymKeyEncryption(t *testing.T) {
 	test_utils.AssertTrue(t, err2 == nil, "No error returned from DecryptWithSymKey function")
 }
 
+func TestDeriveSymKey(t *testing.T) {
+	fmt.Println("TestDeriveSymKey function called")
+
+	key := crypto.GenerateSymKey()
+	derivedKey := crypto.DeriveSymKey(key, "label1")
+	test_utils.AssertTrue(t, crypto.ValidateSymKey(derivedKey), "Expected a valid sym key")
+	test_utils.AssertTrue(t, bytes.Equal(derivedKey, crypto.DeriveSymKey(key, "label1")), "Expected the same key for the same label")
+	test_utils.AssertFalse(t, bytes.Equal(derivedKey, crypto.DeriveSymKey(key, "label2")), "Expected a different key for another label")
+	test_utils.AssertFalse(t, bytes.Equal(derivedKey, crypto.DeriveSymKey(crypto.GenerateSymKey(), "label1")), "Expected a different key for another key")
+}
+
 func TestSymKeyEncryption_invalidKey(t *testing.T) {
 	fmt.Println("TestSymKeyEncryption_invalidKey function called")
 	fmt.Println("-- Tests EncryptWithSymKey with invalid key")
@@ -193,6 +285,132 @@ func TestDecryptWithSymKey_ShortCipherText(t *testing.T) {
 	test_utils.AssertTrue(t, ok, "Should be ciphertext too short error")
 }
 
+func TestSymKeyEncryption_GCM(t *testing.T) {
+	fmt.Println("TestSymKeyEncryption_GCM function called")
+	fmt.Println("-- Tests EncryptWithSymKeyGCM")
+	fmt.Println("-- Tests DecryptWithSymKey with GCM ciphertext")
+
+	originalData := []byte("mydata")
+	symKey := test_utils.GenerateSymKey()
+
+	encryptedData1, err := crypto.EncryptWithSymKeyGCM(symKey, originalData)
+	test_utils.AssertTrue(t, err == nil, "No error returned from EncryptWithSymKeyGCM function")
+	test_utils.AssertTrue(t, bytes.HasPrefix(encryptedData1, []byte(crypto.SYM_KEY_ENVELOPE_PREFIX)), "Expected envelope prefix")
+	test_utils.AssertTrue(t, encryptedData1[len(crypto.SYM_KEY_ENVELOPE_PREFIX)] == crypto.SYM_KEY_VERSION_GCM, "Expected GCM version byte")
+
+	// random nonce, same data should not produce the same ciphertext
+	encryptedData2, err := crypto.EncryptWithSymKeyGCM(symKey, originalData)
+	test_utils.AssertTrue(t, err == nil, "No error returned from EncryptWithSymKeyGCM function")
+	test_utils.AssertFalse(t, bytes.Equal(encryptedData1, encryptedData2), "Expected different ciphertexts")
+
+	decryptedData, err := crypto.DecryptWithSymKey(symKey, encryptedData1)
+	test_utils.AssertTrue(t, err == nil, "No error returned from DecryptWithSymKey function")
+	test_utils.AssertTrue(t, bytes.Equal(originalData, decryptedData), "Expected to get originalData")
+
+	// empty data
+	encryptedData3, err := crypto.EncryptWithSymKeyGCM(symKey, []byte{})
+	test_utils.AssertTrue(t, err == nil, "No error returned from EncryptWithSymKeyGCM function")
+	decryptedData, err = crypto.DecryptWithSymKey(symKey, encryptedData3)
+	test_utils.AssertTrue(t, err == nil, "No error returned from DecryptWithSymKey function")
+	test_utils.AssertTrue(t, decryptedData != nil && len(decryptedData) == 0, "Expected empty data")
+
+	// Negative test - tampered ciphertext
+	tampered := append([]byte{}, encryptedData1...)
+	tampered[len(tampered)-1] ^= 0xff
+	_, err = crypto.DecryptWithSymKey(symKey, tampered)
+	test_utils.AssertTrue(t, err != nil, "Should be error because ciphertext was modified")
+
+	// Negative test - unknown version
+	unknownVersion := append([]byte{}, encryptedData1...)
+	unknownVersion[len(crypto.SYM_KEY_ENVELOPE_PREFIX)] = 0x7f
+	_, err = crypto.DecryptWithSymKey(symKey, unknownVersion)
+	test_utils.AssertTrue(t, err != nil, "Should be error because of unknown ciphertext version")
+
+	// Negative test - wrong key
+	_, err = crypto.DecryptWithSymKey(test_utils.GenerateSymKey(), encryptedData1)
+	test_utils.AssertTrue(t, err != nil, "Should be error because wrong symkey was passed to DecryptWithSymKey")
+}
+
+func TestSymKeyEncryption_LegacyCBC(t *testing.T) {
+	fmt.Println("TestSymKeyEncryption_LegacyCBC function called")
+	fmt.Println("-- Tests EncryptWithSymKeyCBC")
+	fmt.Println("-- Tests DecryptWithSymKey with CBC ciphertext")
+
+	symKey := test_utils.GenerateSymKey()
+
+	// legacy ciphertext is deterministic
+	originalData := []byte("mydata")
+	encryptedData1, err := crypto.EncryptWithSymKeyCBC(symKey, originalData)
+	test_utils.AssertTrue(t, err == nil, "No error returned from EncryptWithSymKeyCBC function")
+	encryptedData2, _ := crypto.EncryptWithSymKeyCBC(symKey, originalData)
+	test_utils.AssertTrue(t, bytes.Equal(encryptedData1, encryptedData2), "Expected same ciphertexts")
+
+	decryptedData, err := crypto.DecryptWithSymKey(symKey, encryptedData1)
+	test_utils.AssertTrue(t, err == nil, "No error returned from DecryptWithSymKey function")
+	test_utils.AssertTrue(t, bytes.Equal(originalData, decryptedData), "Expected to get originalData")
+	test_utils.AssertTrue(t, bytes.Equal(encryptedData1, encryptedData2), "DecryptWithSymKey should not modify the ciphertext")
+
+	// legacy ciphertext whose first byte equals the GCM version byte
+	originalData = []byte{crypto.SYM_KEY_VERSION_GCM, 'm', 'y', 'd', 'a', 't', 'a', 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	encryptedData3, err := crypto.EncryptWithSymKeyCBC(symKey, originalData)
+	test_utils.AssertTrue(t, err == nil, "No error returned from EncryptWithSymKeyCBC function")
+	test_utils.AssertTrue(t, encryptedData3[0] == crypto.SYM_KEY_VERSION_GCM, "Expected CBC ciphertext starting with GCM version byte")
+	decryptedData, err = crypto.DecryptWithSymKey(symKey, encryptedData3)
+	test_utils.AssertTrue(t, err == nil, "No error returned from DecryptWithSymKey function")
+	test_utils.AssertTrue(t, bytes.Equal(originalData, decryptedData), "Expected to get originalData")
+
+	// Negative test - data that would produce a CBC ciphertext starting with the envelope prefix
+	_, err = crypto.EncryptWithSymKeyCBC(symKey, []byte(crypto.SYM_KEY_ENVELOPE_PREFIX+"mydata"))
+	test_utils.AssertTrue(t, err != nil, "Should be error because data starts with the envelope prefix")
+
+	// legacy ciphertexts starting with the envelope prefix, written before it was rejected, can be decrypted
+	for _, data := range []string{crypto.SYM_KEY_ENVELOPE_PREFIX + "mydata", crypto.SYM_KEY_ENVELOPE_PREFIX + "\x01mydata and more data"} {
+		originalData = []byte(data)
+		block, _ := aes.NewCipher(symKey)
+		padding := aes.BlockSize - len(originalData)%aes.BlockSize
+		paddedData := append(append([]byte{}, originalData...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+		encryptedData4 := make([]byte, aes.BlockSize+len(paddedData))
+		copy(encryptedData4, paddedData[:aes.BlockSize])
+		cipher.NewCBCEncrypter(block, encryptedData4[:aes.BlockSize]).CryptBlocks(encryptedData4[aes.BlockSize:], paddedData)
+		test_utils.AssertTrue(t, bytes.HasPrefix(encryptedData4, []byte(crypto.SYM_KEY_ENVELOPE_PREFIX)), "Expected CBC ciphertext starting with the envelope prefix")
+		decryptedData, err = crypto.DecryptWithSymKey(symKey, encryptedData4)
+		test_utils.AssertTrue(t, err == nil, "No error returned from DecryptWithSymKey function")
+		test_utils.AssertTrue(t, bytes.Equal(originalData, decryptedData), "Expected to get originalData")
+	}
+}
+
+func TestSetSymKeyEncryptionMode(t *testing.T) {
+	fmt.Println("TestSetSymKeyEncryptionMode function called")
+	fmt.Println("-- Tests SetSymKeyEncryptionMode")
+	fmt.Println("-- Tests GetSymKeyEncryptionMode")
+
+	originalData := []byte("mydata")
+	symKey := test_utils.GenerateSymKey()
+
+	// the mode is fixed once data has been encrypted
+	mode := crypto.GetSymKeyEncryptionMode()
+	encryptedData, err := crypto.EncryptWithSymKey(symKey, originalData)
+	test_utils.AssertTrue(t, err == nil, "No error returned from EncryptWithSymKey function")
+	decryptedData, err := crypto.DecryptWithSymKey(symKey, encryptedData)
+	test_utils.AssertTrue(t, err == nil && bytes.Equal(originalData, decryptedData), "Expected to decrypt ciphertext")
+
+	err = crypto.SetSymKeyEncryptionMode(mode)
+	test_utils.AssertTrue(t, err == nil, "No error returned from SetSymKeyEncryptionMode with the current mode")
+
+	otherMode := crypto.SYM_KEY_MODE_GCM
+	if mode == crypto.SYM_KEY_MODE_GCM {
+		otherMode = crypto.SYM_KEY_MODE_CBC
+	}
+	err = crypto.SetSymKeyEncryptionMode(otherMode)
+	test_utils.AssertTrue(t, err != nil, "Should be error because data has already been encrypted")
+	test_utils.AssertTrue(t, crypto.GetSymKeyEncryptionMode() == mode, "Mode should not change")
+
+	// Negative test - invalid mode
+	err = crypto.SetSymKeyEncryptionMode("ecb")
+	test_utils.AssertTrue(t, err != nil, "Should be error because of invalid mode")
+	test_utils.AssertTrue(t, crypto.GetSymKeyEncryptionMode() == mode, "Mode should not change")
+}
+
 func TestValidateSymKey(t *testing.T) {
 	fmt.Println("TestValidateSymKey function called")
 	fmt.Println("-- Tests ValidateSymKey")
@@ -179,6 +179,35 @@ func (e *CiphertextBlockSizeError) Error() string {
 	return "ciphertext is not a multiple of the block size"
 }
 
+// InvalidSignatureError provides an error message for a missing or invalid asset signature.
+type InvalidSignatureError struct {
+	AssetId string
+}
+
+func (e *InvalidSignatureError) Error() string {
+	return fmt.Sprintf("Invalid signature of asset %v", e.AssetId)
+}
+
+// AssetDeletedError provides an error message for an operation that is not allowed on a soft deleted asset.
+type AssetDeletedError struct {
+	AssetId string
+}
+
+func (e *AssetDeletedError) Error() string {
+	return fmt.Sprintf("Asset %v is deleted", e.AssetId)
+}
+
+// VersionConflictError provides an error message for an update based on an outdated version of an asset.
+type VersionConflictError struct {
+	AssetId         string
+	ExpectedVersion int64
+	ActualVersion   int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("Version conflict for asset %v: expected version %v, but current version is %v", e.AssetId, e.ExpectedVersion, e.ActualVersion)
+}
+
 // Key Management
 
 // InvalidKeyError provides an error message for an invalid key.
@@ -414,6 +443,17 @@ func (e *RemoveRelationshipError) Error() string {
 	return fmt.Sprintf("Failed to remove relationship between datatypes %v and %v", e.Parent, e.Child)
 }
 
+// SchemaValidationError provides an error message for asset data that does not conform to a datatype schema.
+type SchemaValidationError struct {
+	Datatype      string
+	SchemaVersion int
+	Reason        string
+}
+
+func (e *SchemaValidationError) Error() string {
+	return fmt.Sprintf("Asset data does not conform to version %v of the schema of datatype %v: %v", e.SchemaVersion, e.Datatype, e.Reason)
+}
+
 // RoleAccessPrivilegeError provides an error message for access denied for an Action due to callers Role
 type RoleAccessPrivilegeError struct {
 	Role string
@@ -447,11 +487,16 @@ func (e *ValidateConsentError) Error() string {
 }
 
 // ConsentAccessError provides an error message for deny or mismatched consent access.
+// Reason optionally describes why the consent does not give access, such as a purpose of use that is not allowed.
 type ConsentAccessError struct {
 	ConsentId string
+	Reason    string
 }
 
 func (e *ConsentAccessError) Error() string {
+	if len(e.Reason) > 0 {
+		return fmt.Sprintf("Consent access is denied for consent %v: %v", e.ConsentId, e.Reason)
+	}
 	return fmt.Sprintf("Consent access is deny or mismatch for consent %v", e.ConsentId)
 }
 
@@ -493,6 +538,17 @@ func (e *HasWriteAccessError) Error() string {
 	return fmt.Sprintf("%v does not have write access to %v", e.UserId, e.AssetId)
 }
 
+// AuthorizationError provides an error message for a user whose RBAC roles don't give a permission on a resource.
+type AuthorizationError struct {
+	UserId     string
+	Permission string
+	Resource   string
+}
+
+func (e *AuthorizationError) Error() string {
+	return fmt.Sprintf("%v does not have %v permission on %v", e.UserId, e.Permission, e.Resource)
+}
+
 // Cached Stub
 
 // MethodNotImplementedError provides an error message for an unknown method inside ChainStub.
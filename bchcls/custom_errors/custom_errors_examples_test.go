@@ -195,6 +195,13 @@ func ExampleHasWriteAccessError_Error() {
 	// Output: user1 does not have write access to asset_id1
 }
 
+func ExampleAuthorizationError_Error() {
+	custom_err := &AuthorizationError{UserId: "user1", Permission: "invoke", Resource: "PutRole"}
+
+	fmt.Println(custom_err.Error())
+	// Output: user1 does not have invoke permission on PutRole
+}
+
 func ExampleIndexError_Error() {
 	custom_err := &IndexError{Index: "Asset", Action: "UpdateRow"}
 
@@ -19,12 +19,21 @@ import (
 
 // AccessControl represents a user's read or write access to an asset.
 // UserKey is optional
+// Fields is optional. If set, read access is given to or removed from only these private data fields
+// of an asset with field-level encryption, instead of the whole asset.
+// If Access is ACCESS_DENY, a deny entry is added or removed. A deny entry takes precedence over any access
+// the user has through groups, consents, or the key graph.
+// NotBefore and ExpirationDate are optional, in seconds since the epoch. If set, access given by AddAccessToAsset
+// is only in effect from NotBefore and until ExpirationDate. They can't be set for ACCESS_DENY.
 type AccessControl struct {
-	UserId   string `json:"userid"`
-	UserKey  *Key   `json:"user_key"`
-	AssetId  string `json:"assetid"`
-	AssetKey *Key   `json:"asset_key"`
-	Access   string `json:"access"`
+	UserId         string   `json:"userid"`
+	UserKey        *Key     `json:"user_key"`
+	AssetId        string   `json:"assetid"`
+	AssetKey       *Key     `json:"asset_key"`
+	Access         string   `json:"access"`
+	Fields         []string `json:"fields,omitempty"`
+	NotBefore      int64    `json:"not_before,omitempty"`
+	ExpirationDate int64    `json:"expiration_date,omitempty"`
 }
 
 // IsValid checks if an AccessControl object's fields are valid
@@ -38,7 +47,20 @@ func (a *AccessControl) IsValid() bool {
 	if a.Access != global.ACCESS_READ &&
 		a.Access != global.ACCESS_READ_ONLY &&
 		a.Access != global.ACCESS_WRITE &&
-		a.Access != global.ACCESS_WRITE_ONLY {
+		a.Access != global.ACCESS_WRITE_ONLY &&
+		a.Access != global.ACCESS_DENY {
+		return false
+	}
+	if len(a.Fields) > 0 && a.Access != global.ACCESS_READ {
+		return false
+	}
+	if a.NotBefore < 0 || a.ExpirationDate < 0 {
+		return false
+	}
+	if a.NotBefore != 0 && a.ExpirationDate != 0 && a.NotBefore >= a.ExpirationDate {
+		return false
+	}
+	if (a.NotBefore != 0 || a.ExpirationDate != 0) && a.Access == global.ACCESS_DENY {
 		return false
 	}
 	return true
@@ -0,0 +1,60 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package data_model
+
+import (
+	"common/bchcls/internal/common/global"
+
+	"encoding/json"
+	"strings"
+)
+
+// AccessPolicy is an attribute-based access policy for the assets of a namespace. It's evaluated by the
+// AssetManager on top of the caller's access to the asset key.
+// Namespace is the IndexTableName of the assets the policy applies to.
+// ReadRule and WriteRule are simple_rule expressions in JSON format, evaluated when the asset is read or written.
+// A rule that is not set does not restrict access. A rule is evaluated against the following data:
+//   - caller: "id", "role", "is_group", "groups" (IDs of all groups the caller is a direct or indirect member of),
+//     and "solution_public_data" of the caller
+//   - asset: "asset_id", "datatypes", "owner_ids", "metadata", and "public_data" (if it's JSON) of the asset
+//   - access: ACCESS_READ or ACCESS_WRITE
+// For example, {"and": [{"==": [{"var": "caller.role"}, "user"]}, {"in": ["org1", {"var": "caller.groups"}]}]}
+// only allows users of org1.
+type AccessPolicy struct {
+	Namespace string `json:"namespace"`
+	ReadRule  string `json:"read_rule,omitempty"`
+	WriteRule string `json:"write_rule,omitempty"`
+}
+
+// IsValid checks if an AccessPolicy object's fields are valid.
+func (policy *AccessPolicy) IsValid() bool {
+	if len(strings.TrimSpace(policy.Namespace)) == 0 {
+		return false
+	}
+	if len(policy.ReadRule) > 0 && !json.Valid([]byte(policy.ReadRule)) {
+		return false
+	}
+	if len(policy.WriteRule) > 0 && !json.Valid([]byte(policy.WriteRule)) {
+		return false
+	}
+	return true
+}
+
+// GetRule returns the rule for the given access: WriteRule for ACCESS_WRITE and ACCESS_WRITE_ONLY,
+// ReadRule for ACCESS_READ and ACCESS_READ_ONLY.
+func (policy *AccessPolicy) GetRule(access string) string {
+	switch access {
+	case global.ACCESS_WRITE, global.ACCESS_WRITE_ONLY:
+		return policy.WriteRule
+	case global.ACCESS_READ, global.ACCESS_READ_ONLY:
+		return policy.ReadRule
+	}
+	return ""
+}
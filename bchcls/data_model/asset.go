@@ -14,7 +14,11 @@
 package data_model
 
 import (
+	"common/bchcls/crypto"
 	"common/bchcls/internal/common/global"
+
+	"encoding/json"
+	"strconv"
 )
 
 // Asset represents an item on the ledger.
@@ -25,16 +29,33 @@ import (
 // only have a single owner, so any element after the first one is automatically ignored.
 // Metadata is used to store any data that describes the asset but is not part of the asset itself, e.g. data base name, connect string
 // IndexTableName is the index table for an asset to save custom indices for querying.
+// Version is incremented each time the asset is saved to the ledger, starting at 1 when the asset is added.
+// It is set by asset_mgmt, and it can be passed to AssetManager's UpdateAssetWithVersion to detect conflicting updates.
+// EncryptedFields holds the top-level fields of PrivateData, each encrypted with its own field key,
+// if field-level encryption is enabled with SetFieldEncryption. It is set by asset_mgmt.
 type Asset struct {
-	AssetId        string            `json:"asset_id"`
-	Datatypes      []string          `json:"datatypes"`
-	PublicData     []byte            `json:"public_data"`
-	PrivateData    []byte            `json:"private_data"`
-	OwnerIds       []string          `json:"owner_ids"`
-	Metadata       map[string]string `json:"metadata"`
-	AssetKeyId     string            `json:"asset_key_id"`
-	AssetKeyHash   []byte            `json:"asset_key_hash"`
-	IndexTableName string            `json:"index_table_name"`
+	AssetId         string            `json:"asset_id"`
+	Datatypes       []string          `json:"datatypes"`
+	PublicData      []byte            `json:"public_data"`
+	PrivateData     []byte            `json:"private_data"`
+	OwnerIds        []string          `json:"owner_ids"`
+	Metadata        map[string]string `json:"metadata"`
+	AssetKeyId      string            `json:"asset_key_id"`
+	AssetKeyHash    []byte            `json:"asset_key_hash"`
+	IndexTableName  string            `json:"index_table_name"`
+	Version         int64             `json:"version"`
+	EncryptedFields map[string][]byte `json:"encrypted_fields,omitempty"`
+}
+
+// AssetVersion is a version of an asset in the asset's ledger history.
+// TransactionID is the ID of the transaction that wrote the version, and Timestamp is the
+// transaction's timestamp in seconds since the epoch.
+// IsDelete is true if the transaction deleted the asset, in which case Asset is empty.
+type AssetVersion struct {
+	TransactionID string `json:"transaction_id"`
+	Timestamp     int64  `json:"timestamp"`
+	IsDelete      bool   `json:"is_delete"`
+	Asset         Asset  `json:"asset"`
 }
 
 // IsOwner returns true if the given userId is an owner of the asset.
@@ -80,6 +101,14 @@ func (asset *Asset) Copy() Asset {
 		copy(newAsset.AssetKeyHash, asset.AssetKeyHash)
 	}
 	newAsset.IndexTableName = asset.IndexTableName
+	newAsset.Version = asset.Version
+	if asset.EncryptedFields != nil {
+		newAsset.EncryptedFields = make(map[string][]byte)
+		for field, value := range asset.EncryptedFields {
+			newAsset.EncryptedFields[field] = make([]byte, len(value))
+			copy(newAsset.EncryptedFields[field], value)
+		}
+	}
 	return newAsset
 }
 
@@ -105,3 +134,124 @@ func (asset *Asset) GetDatastoreConnectionID() string {
 		return ""
 	}
 }
+
+// SetSignerID requests that the asset be signed by the given user when it is added or updated.
+// signerId must be the caller's ID; the asset is signed with the caller's private key.
+// Pass an empty signerId to add or update the asset without a signature.
+func (asset *Asset) SetSignerID(signerId string) {
+	if asset.Metadata == nil {
+		asset.Metadata = make(map[string]string)
+	}
+	delete(asset.Metadata, global.SIGNATURE_METADATA_KEY)
+	if len(signerId) == 0 {
+		delete(asset.Metadata, global.SIGNER_ID_METADATA_KEY)
+	} else {
+		asset.Metadata[global.SIGNER_ID_METADATA_KEY] = signerId
+	}
+}
+
+// GetSignerID returns the ID of the user who signed the asset if the asset is signed.
+func (asset *Asset) GetSignerID() string {
+	return asset.Metadata[global.SIGNER_ID_METADATA_KEY]
+}
+
+// GetSignature returns the signature of the asset if the asset is signed.
+func (asset *Asset) GetSignature() []byte {
+	signature, err := crypto.DecodeStringB64(asset.Metadata[global.SIGNATURE_METADATA_KEY])
+	if err != nil {
+		return nil
+	}
+	return signature
+}
+
+// SetFieldEncryption enables or disables field-level encryption of the asset's private data.
+// If enabled, PrivateData must be a JSON object. In addition to encrypting PrivateData with the asset key,
+// each top-level field of PrivateData is encrypted with its own key derived from the asset key, so that
+// access to individual fields can be given with AccessControl.Fields.
+// Field-level encryption is not supported for private data stored in an off-chain datastore.
+func (asset *Asset) SetFieldEncryption(enabled bool) {
+	if asset.Metadata == nil {
+		asset.Metadata = make(map[string]string)
+	}
+	if enabled {
+		asset.Metadata[global.FIELD_ENCRYPTION_METADATA_KEY] = "true"
+	} else {
+		delete(asset.Metadata, global.FIELD_ENCRYPTION_METADATA_KEY)
+	}
+}
+
+// IsFieldEncrypted returns true if field-level encryption is enabled for the asset.
+func (asset *Asset) IsFieldEncrypted() bool {
+	return asset.Metadata[global.FIELD_ENCRYPTION_METADATA_KEY] == "true"
+}
+
+// IsDeleted returns true if the asset has been soft deleted.
+func (asset *Asset) IsDeleted() bool {
+	_, ok := asset.Metadata[global.DELETED_AT_METADATA_KEY]
+	return ok
+}
+
+// GetDeletedBy returns the ID of the user who soft deleted the asset if the asset is soft deleted.
+func (asset *Asset) GetDeletedBy() string {
+	return asset.Metadata[global.DELETED_BY_METADATA_KEY]
+}
+
+// GetDatatypeVersion returns the version of the datatype that the asset data conforms to.
+// Returns 1 if the version was not set.
+func (asset *Asset) GetDatatypeVersion(datatypeID string) int {
+	version, err := strconv.Atoi(asset.Metadata[global.DATATYPE_VERSION_METADATA_PREFIX+datatypeID])
+	if err != nil || version < 1 {
+		return 1
+	}
+	return version
+}
+
+// SetDatatypeVersion sets the version of the datatype that the asset data conforms to.
+func (asset *Asset) SetDatatypeVersion(datatypeID string, version int) {
+	if asset.Metadata == nil {
+		asset.Metadata = make(map[string]string)
+	}
+	asset.Metadata[global.DATATYPE_VERSION_METADATA_PREFIX+datatypeID] = strconv.Itoa(version)
+}
+
+// GetSignedBytes returns the canonical bytes of the asset that are signed.
+// The asset must contain decrypted PrivateData. It covers every field except the asset key ID,
+// asset key hash, version, signature, and soft delete metadata, so an asset's signature stays valid after
+// its key is rotated or after it is soft deleted and restored.
+func (asset *Asset) GetSignedBytes() []byte {
+	metadata := make(map[string]string)
+	for key, value := range asset.Metadata {
+		if key != global.SIGNATURE_METADATA_KEY && key != global.DELETED_AT_METADATA_KEY && key != global.DELETED_BY_METADATA_KEY {
+			metadata[key] = value
+		}
+	}
+	signedAsset := struct {
+		AssetId         string            `json:"asset_id"`
+		Datatypes       []string          `json:"datatypes"`
+		PublicData      []byte            `json:"public_data"`
+		PrivateDataHash []byte            `json:"private_data_hash"`
+		OwnerIds        []string          `json:"owner_ids"`
+		Metadata        map[string]string `json:"metadata"`
+		IndexTableName  string            `json:"index_table_name"`
+	}{
+		AssetId:         asset.AssetId,
+		Datatypes:       asset.Datatypes,
+		PublicData:      asset.PublicData,
+		PrivateDataHash: crypto.Hash(asset.PrivateData),
+		OwnerIds:        asset.OwnerIds,
+		Metadata:        metadata,
+		IndexTableName:  asset.IndexTableName,
+	}
+	// empty and nil values are signed the same way
+	if len(signedAsset.Datatypes) == 0 {
+		signedAsset.Datatypes = nil
+	}
+	if len(signedAsset.PublicData) == 0 {
+		signedAsset.PublicData = nil
+	}
+	if len(signedAsset.OwnerIds) == 0 {
+		signedAsset.OwnerIds = nil
+	}
+	signedBytes, _ := json.Marshal(&signedAsset)
+	return signedBytes
+}
@@ -13,6 +13,11 @@
 // They can't import each other, so the shared structs live here.
 package data_model
 
+import (
+	"common/bchcls/internal/common/global"
+	"encoding/json"
+)
+
 // Consent represents access given to all assets of a particular datatype,
 // from one user/group to another, for a specified period of time.
 //
@@ -31,21 +36,168 @@ package data_model
 // Optional fields:
 //   - Data: arbitrary data specified by the solution developer
 //   - ConnectionID: the connection ID for an off-chain datastore. If this is provided, the Consent's encrypted private data will be saved to that datastore.
+//   - Purposes: purposes of use the consent is given for, such as treatment, research, or billing. If empty, the consent is given for any purpose.
+//   - Condition: a simple_rule expression in JSON format, evaluated against the request context when the consent is validated.
+//     The consent only gives access if the condition evaluates to true.
+//   - NotBefore: time from which the consent gives access. If 0, the consent gives access from when it's given.
+//   - ValidityWindows: recurring windows during which the consent gives access, such as weekdays 9-17 UTC.
+//     If empty, the consent gives access at any time.
+//   - MaxDelegationDepth: how many times the consent can be delegated in a chain, for example from a hospital to
+//     a contracted lab. If 0, the consent can't be delegated. Consents delegated from it keep the same value.
+//
+// ParentConsentID and DelegationDepth are set by DelegateConsent. ParentConsentID is the ID of the consent
+// this consent was delegated from, and DelegationDepth is the consent's position in the delegation chain,
+// 0 for a consent given by its owner.
 // De-identified fields:
 //   - CreatorID
 //   - OwnerID
 //   - TargetID
 type Consent struct {
-	ConsentID      string      `json:"consent_id"`
-	ConsentAssetID string      `json:"consent_asset_id"`
-	AssetKeyID     string      `json:"asset_key_id"`
-	CreatorID      string      `json:"creator_id"`
-	OwnerID        string      `json:"owner_id"`
-	TargetID       string      `json:"target_id"`
-	DatatypeID     string      `json:"datatype_id"`
-	Access         string      `json:"access"`
-	ExpirationDate int64       `json:"expiration_date"`
-	ConsentDate    int64       `json:"consent_date"`
-	Data           interface{} `json:"data"`
-	ConnectionID   string      `json:"connection_id"`
+	ConsentID          string          `json:"consent_id"`
+	ConsentAssetID     string          `json:"consent_asset_id"`
+	AssetKeyID         string          `json:"asset_key_id"`
+	CreatorID          string          `json:"creator_id"`
+	OwnerID            string          `json:"owner_id"`
+	TargetID           string          `json:"target_id"`
+	DatatypeID         string          `json:"datatype_id"`
+	Access             string          `json:"access"`
+	ExpirationDate     int64           `json:"expiration_date"`
+	ConsentDate        int64           `json:"consent_date"`
+	Data               interface{}     `json:"data"`
+	ConnectionID       string          `json:"connection_id"`
+	Purposes           []string        `json:"purposes,omitempty"`
+	Condition          string          `json:"condition,omitempty"`
+	NotBefore          int64           `json:"not_before,omitempty"`
+	ValidityWindows    []ConsentWindow `json:"validity_windows,omitempty"`
+	MaxDelegationDepth int             `json:"max_delegation_depth,omitempty"`
+	ParentConsentID    string          `json:"parent_consent_id,omitempty"`
+	DelegationDepth    int             `json:"delegation_depth,omitempty"`
+}
+
+// ConsentWindow is a recurring window of time during which a consent gives access.
+// Weekdays are the days of the week of the window, 0 for Sunday to 6 for Saturday. If empty, the window recurs every day.
+// StartHour and EndHour are the UTC hours at which the window starts and ends. The window includes
+// StartHour and excludes EndHour, so a window from 9 to 17 ends at 17:00.
+type ConsentWindow struct {
+	Weekdays  []int `json:"weekdays,omitempty"`
+	StartHour int   `json:"start_hour"`
+	EndHour   int   `json:"end_hour"`
+}
+
+// IsValid checks if a ConsentWindow object's fields are valid.
+func (w *ConsentWindow) IsValid() bool {
+	for _, weekday := range w.Weekdays {
+		if weekday < 0 || weekday > 6 {
+			return false
+		}
+	}
+	return w.StartHour >= 0 && w.StartHour < w.EndHour && w.EndHour <= 24
+}
+
+// Contains returns true if currTime, in seconds since the epoch, is within the window.
+func (w *ConsentWindow) Contains(currTime int64) bool {
+	return global.TimeWindow(*w).Contains(currTime)
+}
+
+// IsInEffect returns true if the consent's NotBefore, ExpirationDate, and ValidityWindows allow access at currTime,
+// in seconds since the epoch. It does not check the consent's Access.
+func (consent *Consent) IsInEffect(currTime int64) bool {
+	windows := make([]global.TimeWindow, 0, len(consent.ValidityWindows))
+	for _, window := range consent.ValidityWindows {
+		windows = append(windows, global.TimeWindow(window))
+	}
+	return global.IsInEffect(currTime, consent.NotBefore, consent.ExpirationDate, windows)
+}
+
+// ConsentVersion is a version of a consent in the consent's history.
+// TransactionID is the ID of the transaction that changed the consent, Timestamp is the transaction's timestamp
+// in seconds since the epoch, and CallerID is the ID of the user who changed the consent.
+// Operation is the function that changed the consent: PutConsent, PutConsents, AmendConsent, RevokeConsent, or DelegateConsent.
+type ConsentVersion struct {
+	TransactionID string  `json:"transaction_id"`
+	Timestamp     int64   `json:"timestamp"`
+	CallerID      string  `json:"caller_id"`
+	Operation     string  `json:"operation"`
+	Consent       Consent `json:"consent"`
+}
+
+// ConsentResult is the result of putting one consent of a PutConsents batch.
+// ConsentID is empty if the consent's fields are invalid. Error is the reason the consent was not put.
+type ConsentResult struct {
+	ConsentID string `json:"consent_id"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ConsentReceipt is a record of a consent, following the Kantara Initiative Consent Receipt Specification v1.1.
+// The JSON field names are the ones in the specification.
+//
+// Jurisdiction, CollectionMethod, Language, PIIControllers, and PolicyURL can be supplied in a receipt template.
+// The other fields are set from the consent:
+//   - ConsentTimestamp: the consent's ConsentDate
+//   - ConsentReceiptID: the ID of the transaction that exported the receipt
+//   - PublicKey: the consent owner's public key, which verifies the receipt's signature
+//   - PIIPrincipalID: the consent's OwnerID
+//   - Services: one service for the consent's DatatypeID, with one purpose per purpose of use of the consent
+//   - SPICat: the consent's DatatypeID
+//
+// ConsentID and Access are not in the specification, they identify the consent and its level of access.
+type ConsentReceipt struct {
+	Version          string                  `json:"version"`
+	Jurisdiction     string                  `json:"jurisdiction"`
+	ConsentTimestamp int64                   `json:"consentTimestamp"`
+	CollectionMethod string                  `json:"collectionMethod"`
+	ConsentReceiptID string                  `json:"consentReceiptID"`
+	PublicKey        string                  `json:"publicKey"`
+	Language         string                  `json:"language,omitempty"`
+	PIIPrincipalID   string                  `json:"piiPrincipalId"`
+	PIIControllers   []ConsentReceiptParty   `json:"piiControllers"`
+	PolicyURL        string                  `json:"policyUrl"`
+	Services         []ConsentReceiptService `json:"services"`
+	Sensitive        bool                    `json:"sensitive"`
+	SPICat           []string                `json:"spiCat"`
+	ConsentID        string                  `json:"consentID"`
+	Access           string                  `json:"access"`
+}
+
+// ConsentReceiptParty is a PII controller of a ConsentReceipt. The consent's TargetID is added if no controller
+// is supplied in the receipt template.
+type ConsentReceiptParty struct {
+	PIIController string `json:"piiController"`
+	Contact       string `json:"contact,omitempty"`
+	Address       string `json:"address,omitempty"`
+	Email         string `json:"email,omitempty"`
+	Phone         string `json:"phone,omitempty"`
+}
+
+// ConsentReceiptService is a service of a ConsentReceipt and the purposes of use consent is given for.
+type ConsentReceiptService struct {
+	Service  string                  `json:"service"`
+	Purposes []ConsentReceiptPurpose `json:"purposes"`
+}
+
+// ConsentReceiptPurpose is a purpose of use of a ConsentReceiptService.
+// Termination is the consent's expiration date in RFC 3339 format, or empty if the consent doesn't expire.
+type ConsentReceiptPurpose struct {
+	Purpose              string   `json:"purpose"`
+	PurposeCategory      []string `json:"purposeCategory"`
+	ConsentType          string   `json:"consentType"`
+	PIICategory          []string `json:"piiCategory"`
+	PrimaryPurpose       bool     `json:"primaryPurpose"`
+	Termination          string   `json:"termination"`
+	ThirdPartyDisclosure bool     `json:"thirdPartyDisclosure"`
+}
+
+// SignedConsentReceipt is a ConsentReceipt signed with the consent owner's private key.
+// Signature is the base64 encoded signature of the receipt's GetSignedBytes, which can be verified
+// with the receipt's PublicKey.
+type SignedConsentReceipt struct {
+	Receipt   ConsentReceipt `json:"receipt"`
+	Signature string         `json:"signature"`
+}
+
+// GetSignedBytes returns the bytes of the receipt that are signed, its JSON encoding.
+func (receipt *ConsentReceipt) GetSignedBytes() []byte {
+	receiptBytes, _ := json.Marshal(receipt)
+	return receiptBytes
 }
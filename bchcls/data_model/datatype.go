@@ -13,11 +13,26 @@
 // They can't import each other, so the shared structs live here.
 package data_model
 
+import (
+	"encoding/json"
+)
+
 // Datatype represents a type that can be used to classify assets.
 // Datatypes are stored in a tree structure. Datatypes can have sub-datatypes.
 // All datatype information is public
+//
+// Schema is an optional JSON Schema. Assets of the datatype must conform to it when they are added or updated.
+// The schema is applied to a JSON object with the asset's public data and decrypted private data as its
+// "public_data" and "private_data" properties.
+// SchemaVersion is incremented every time the schema is changed; previous versions are kept on the ledger.
+//
+// Version is the version of the datatype's payload shape. It starts at 1 and is incremented every time a
+// migration rule is added, which transforms asset data from the previous version to the new version.
 type Datatype struct {
-	DatatypeID  string `json:"datatype_id"`
-	Description string `json:"description"`
-	IsActive    bool   `json:"is_acive"`
+	DatatypeID    string          `json:"datatype_id"`
+	Description   string          `json:"description"`
+	IsActive      bool            `json:"is_acive"`
+	Schema        json.RawMessage `json:"schema,omitempty"`
+	SchemaVersion int             `json:"schema_version,omitempty"`
+	Version       int             `json:"version,omitempty"`
 }
@@ -18,6 +18,7 @@ package data_model
 // Fields 1-8 should be used as index fields. To index logs by a particular data field, store it in one of these fields.
 // Additionally, the data field can be used to store arbitrary data. Multi-level indexing can be achieved by storing a concatenation
 // of two pieces of data in the data field.
+// If SignerID is set to the caller's ID, the log is signed with the caller's private key when it is saved.
 type TransactionLog struct {
 	TransactionID string      `json:"transaction_id"`
 	Namespace     string      `json:"namespace"`
@@ -34,6 +35,7 @@ type TransactionLog struct {
 	Field7        interface{} `json:"field_7"`
 	Field8        interface{} `json:"field_8"`
 	ConnectionID  string      `json:"connection_id"`
+	SignerID      string      `json:"signer_id,omitempty"`
 }
 
 // ExportableTransactionLog is designed to securely pass a transaction log for a query to outside of the chaincode and be sent
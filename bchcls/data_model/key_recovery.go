@@ -0,0 +1,28 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package data_model
+
+// KeyRecoveryPolicy describes how a user's private key is split among guardians.
+// Any Threshold of the guardians' shares can be combined to recover the private key.
+// PublicKeyHash is the hash of the user's public key when the shares were created.
+type KeyRecoveryPolicy struct {
+	UserID        string   `json:"user_id"`
+	GuardianIDs   []string `json:"guardian_ids"`
+	Threshold     int      `json:"threshold"`
+	PublicKeyHash []byte   `json:"public_key_hash"`
+}
+
+// KeyRecoveryShare is a guardian's share of a user's private key.
+// Shares are stored as assets that only the guardian can decrypt; the user's sym key has no access to them.
+type KeyRecoveryShare struct {
+	UserID     string `json:"user_id"`
+	GuardianID string `json:"guardian_id"`
+	Share      []byte `json:"share,omitempty"`
+}
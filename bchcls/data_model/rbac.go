@@ -0,0 +1,67 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package data_model
+
+import (
+	"common/bchcls/internal/common/global"
+
+	"strings"
+)
+
+// Role is an RBAC role, a named set of permissions that can be bound to users and groups.
+// A role bound to a group applies to all members of the group and of its subgroups.
+type Role struct {
+	RoleID      string           `json:"role_id"`
+	Description string           `json:"description,omitempty"`
+	Permissions []RolePermission `json:"permissions"`
+}
+
+// RolePermission gives a permission on a list of resources.
+// Permission is PERMISSION_INVOKE for function names, ACCESS_READ or ACCESS_WRITE for asset namespaces,
+// or any permission defined by the solution. ACCESS_WRITE also gives ACCESS_READ.
+// Resources are function names, asset namespaces, or other resource names. A resource ending with "*" matches
+// every resource starting with it, so "*" matches every resource.
+type RolePermission struct {
+	Permission string   `json:"permission"`
+	Resources  []string `json:"resources"`
+}
+
+// IsValid checks if a Role object's fields are valid.
+func (role *Role) IsValid() bool {
+	if len(strings.TrimSpace(role.RoleID)) == 0 {
+		return false
+	}
+	for _, rolePermission := range role.Permissions {
+		if len(strings.TrimSpace(rolePermission.Permission)) == 0 || len(rolePermission.Resources) == 0 {
+			return false
+		}
+		for _, resource := range rolePermission.Resources {
+			if len(strings.TrimSpace(resource)) == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// HasPermission returns true if the role gives permission on resource.
+func (role *Role) HasPermission(permission string, resource string) bool {
+	for _, rolePermission := range role.Permissions {
+		if rolePermission.Permission != permission && !(rolePermission.Permission == global.ACCESS_WRITE && permission == global.ACCESS_READ) {
+			continue
+		}
+		for _, pattern := range rolePermission.Resources {
+			if pattern == resource || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(resource, strings.TrimSuffix(pattern, "*"))) {
+				return true
+			}
+		}
+	}
+	return false
+}
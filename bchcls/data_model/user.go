@@ -33,6 +33,8 @@ type Org struct {
 
 // User represents either a person or a group.
 // A group is an organization and can have admins, members, and subgroups.
+// A user's key pair can be an RSA, EC P-256, or Ed25519 key pair (see GetKeyType).
+// PublicKey and PrivateKey are only set for RSA keys; PublicKeyB64 and PrivateKeyB64 hold keys of any type.
 // De-identified fields:
 //   - ID
 //   - Name
@@ -178,7 +180,8 @@ func (u *User) LoadFromAsset(asset *Asset) *User {
 		u.SolutionPrivateData = privateData.SolutionPrivateData
 	}
 
-	u.PublicKey, _ = crypto.ParsePublicKeyB64(u.PublicKeyB64)
+	publicKey, _ := crypto.ParseAnyPublicKeyB64(u.PublicKeyB64)
+	u.PublicKey, _ = publicKey.(*rsa.PublicKey)
 	u.PrivateKey = nil
 	u.SymKey = nil
 
@@ -205,13 +208,23 @@ func (u *User) GetPrivateKey() Key {
 
 // GetPublicKey returns the public key of the user.
 func (u *User) GetPublicKey() Key {
+	keyBytes, err := crypto.DecodeStringB64(u.PublicKeyB64)
+	if err != nil || len(keyBytes) == 0 {
+		keyBytes = crypto.PublicKeyToBytes(u.PublicKey)
+	}
 	return Key{
 		ID:       u.GetPubPrivKeyId(),
-		KeyBytes: crypto.PublicKeyToBytes(u.PublicKey),
+		KeyBytes: keyBytes,
 		Type:     global.KEY_TYPE_PUBLIC,
 	}
 }
 
+// GetKeyType returns the type of the user's public/private key pair:
+// global.KEY_TYPE_RSA, global.KEY_TYPE_EC_P256, or global.KEY_TYPE_ED25519.
+func (u *User) GetKeyType() string {
+	return crypto.GetKeyType(u.GetPublicKey().KeyBytes)
+}
+
 // GetSymKeyId returns the ID of the sym key of the user.
 func (u *User) GetSymKeyId() string {
 	return key_mgmt_g.GetSymKeyId(u.ID)
@@ -48,6 +48,8 @@ func Init(stub cached_stub.CachedStubInterface, logLevel ...shim.LoggingLevel) (
 // Creates datatypeSymKey and maintains key relationship with parent datatypes.
 // If parentDatatypeID is not provided or does not exist, the datatype will be automatically added as a child of ROOT.
 //
+// The datatype can have a JSON Schema in its Schema field, which assets of the datatype must conform to.
+//
 // args = [ datatype, parentDatatypeID ]
 func RegisterDatatype(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
@@ -76,7 +78,8 @@ func GetDatatypeKeyID(datatypeID string, ownerID string) string {
 	return datatype_i.GetDatatypeKeyID(datatypeID, ownerID)
 }
 
-// UpdateDatatype updates an existing datatype's description.
+// UpdateDatatype updates an existing datatype's description and schema.
+// The schema is only updated if the datatype passed in has a schema. Previous schema versions are kept on the ledger.
 // Caller must be a system admin.
 //
 // args = [ datatype ]
@@ -88,6 +91,73 @@ func UpdateDatatype(stub cached_stub.CachedStubInterface, caller data_model.User
 	return datatype_i.UpdateDatatype(stub, caller, args)
 }
 
+// AddDatatypeVersion increments the version of an existing datatype and saves the migration rule that transforms
+// asset data from the previous version to the new version. The rule is a simple_rule expression in JSON;
+// see DatatypeInterface.MigrateAssetData for how it is applied. Use AssetManager.MigrateAssets to migrate existing assets.
+// Caller must be a system admin.
+//
+// args = [ datatypeID, migrationRule ]
+func AddDatatypeVersion(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return datatype_i.AddDatatypeVersion(stub, caller, args)
+}
+
+// MoveDatatype moves a datatype, along with its children, under a new parent datatype.
+// If newParentDatatypeID is empty, the datatype is moved under ROOT.
+// Returns a custom_errors.CycleError if the new parent is the datatype itself or one of its children.
+// The datatype sym keys of all owners are re-linked to the sym keys of the new parent. A consent gives access to its
+// datatype and the datatype's current children, so consents on the new parent's ancestry now cover the moved datatype.
+// Returns an error if consents exist on an ancestor of the datatype that is not an ancestor of the new parent.
+// Owners of sym keys added before the datatype key owner index existed are only found after
+// RebuildDatatypeKeyOwnerIndex is called.
+// Caller must have access to the sym keys of all owners of the datatype's sym keys.
+// Caller must be a system admin.
+//
+// args = [ datatypeID, newParentDatatypeID ]
+func MoveDatatype(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return datatype_i.MoveDatatype(stub, caller, args)
+}
+
+// DeleteDatatype removes a datatype from the ledger. The children of the datatype become children of its parent,
+// and their sym keys are re-linked to the sym keys of the parent.
+// Returns an error if the datatype is still used by assets or consents.
+// Owners of sym keys added before the datatype key owner index existed are only found after
+// RebuildDatatypeKeyOwnerIndex is called.
+// Caller must have access to the sym keys of all owners of the datatype's sym keys.
+// Caller must be a system admin.
+//
+// args = [ datatypeID ]
+func DeleteDatatype(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return datatype_i.DeleteDatatype(stub, caller, args)
+}
+
+// RebuildDatatypeKeyOwnerIndex adds the owners of existing datatype sym keys to the index of datatype sym key owners
+// used by MoveDatatype and DeleteDatatype. Call it once for sym keys added before the index existed.
+// Caller must be a system admin.
+// previousKey           - the last key returned by the previous call; pass empty string "" to start from the beginning
+// limit                 - the max number of users and orgs to check in this call; if limit = -1, all are checked
+//
+// Returns the IDs of the owners that were indexed and the key to pass as previousKey to continue, which is empty
+// if all users and orgs have been checked.
+func RebuildDatatypeKeyOwnerIndex(stub cached_stub.CachedStubInterface, caller data_model.User, previousKey string, limit int) ([]string, string, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return datatype_i.RebuildDatatypeKeyOwnerIndex(stub, caller, previousKey, limit)
+}
+
 // GetDatatype returns a datatype with the given datatypeID.
 // Returns an empty datatype if the passed in datatypeID does not match an existing datatype's ID.
 //
@@ -13,6 +13,7 @@ package datatype_interface
 import (
 	"common/bchcls/cached_stub"
 	"common/bchcls/data_model"
+	"common/bchcls/simple_rule"
 )
 
 // DatatypeInterface is an interface for Datatype functions.
@@ -64,4 +65,53 @@ type DatatypeInterface interface {
 
 	// GetDatatypeKeyID returns the datatype symkey ID for a given owner
 	GetDatatypeKeyID(ownerID string) string
+
+	// GetSchema returns the current JSON Schema of the datatype, or nil if the datatype has no schema.
+	GetSchema() []byte
+
+	// GetSchemaVersion returns the version of the current schema. It is 0 if a schema was never set.
+	GetSchemaVersion() int
+
+	// SetSchema sets the JSON Schema of the datatype and increments the schema version.
+	// Returns an error if schema is not a valid JSON Schema. Setting the current schema again has no effect.
+	// Pass nil to remove the schema. Call PutDatatype to save the change.
+	SetSchema(schema []byte) error
+
+	// GetSchemaByVersion returns the schema of the given version, or nil if the version does not exist
+	// or had no schema.
+	GetSchemaByVersion(stub cached_stub.CachedStubInterface, version int) ([]byte, error)
+
+	// ValidateAssetData validates an asset's public data and decrypted private data against the current schema.
+	// Returns a custom_errors.SchemaValidationError if the data does not conform to the schema.
+	// Pass nil privateData if the asset has no private data.
+	ValidateAssetData(publicData []byte, privateData []byte) error
+
+	// GetSchemaVersionOf returns the version of the schema that asset data of the given version of the datatype
+	// conforms to. Each version of the datatype keeps the schema it had when the next version was added, and
+	// the current version uses the current schema.
+	GetSchemaVersionOf(version int) int
+
+	// ValidateAssetDataOfVersion validates an asset's public data and decrypted private data against the schema of
+	// the given version of the datatype, as returned by GetSchemaVersionOf.
+	// Returns a custom_errors.SchemaValidationError if the data does not conform to the schema.
+	ValidateAssetDataOfVersion(stub cached_stub.CachedStubInterface, version int, publicData []byte, privateData []byte) error
+
+	// GetVersion returns the version of the datatype's payload shape. Versions start at 1.
+	GetVersion() int
+
+	// AddVersion increments the version of the datatype. The previous version keeps the current schema, so set the
+	// schema of the new version after calling AddVersion. migrationRule transforms the data of assets from the
+	// previous version to the new version, as described in MigrateAssetData. Call PutDatatype to save the change.
+	AddVersion(migrationRule simple_rule.Rule) error
+
+	// GetMigrationRule returns the rule that transforms asset data from fromVersion to fromVersion+1.
+	// Returns nil if there is no such rule.
+	GetMigrationRule(stub cached_stub.CachedStubInterface, fromVersion int) (*simple_rule.Rule, error)
+
+	// MigrateAssetData transforms asset data from fromVersion to toVersion by applying each migration rule in between.
+	// Each rule is applied to a JSON object with the asset's public data and private data as its "public_data" and
+	// "private_data" properties, and must evaluate to an object. Its "public_data" and "private_data" properties,
+	// if present, replace the asset's public data and private data. Data that is not JSON is passed to and returned
+	// from the rules as a string.
+	MigrateAssetData(stub cached_stub.CachedStubInterface, fromVersion int, toVersion int, publicData []byte, privateData []byte) ([]byte, []byte, error)
 }
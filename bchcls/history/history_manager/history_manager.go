@@ -24,11 +24,17 @@ type HistoryManager interface {
 
 	// PutInvokeTransactionLog stores a log for an invoke transaction, encrypted with the provided encryptionKey.
 	// If you are going to log a transaction for a query, reference the GoDoc for PutQueryTransactionLog.
+	// To sign the log with the caller's private key, set transactionLog.SignerID to the caller's ID.
 	PutInvokeTransactionLog(transactionLog data_model.TransactionLog, encryptionKey data_model.Key) error
 
 	// GetTransactionLog returns a log from the ledger decrypted by the given log sym key.
 	GetTransactionLog(transactionID string, logKey data_model.Key) (*data_model.TransactionLog, error)
 
+	// VerifyTransactionLogSignature checks that a log was signed by the user in its SignerID field.
+	// The signer's public key is obtained from the signer's user data.
+	// Returns a custom_errors.InvalidSignatureError if the log is not signed or the signature is invalid.
+	VerifyTransactionLogSignature(transactionID string, logKey data_model.Key) error
+
 	// GetTransactionLogs returns a set of logs from the ledger.
 	// function name         - Name of the function being logged.
 	// indexField            - Indexed transaction log fields (must be one of field_1-field_8).
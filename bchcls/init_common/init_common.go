@@ -27,8 +27,6 @@ import (
 	"common/bchcls/user_mgmt"
 	"common/bchcls/utils"
 
-	"crypto/rand"
-	"crypto/rsa"
 	"encoding/hex"
 	"encoding/json"
 	"strconv"
@@ -246,7 +244,7 @@ func InvokeSetup(stub cached_stub.CachedStubInterface) (data_model.User, string,
 		logger.Errorf("login error: %v", err)
 		return caller, function, args, false, errors.New("login error")
 	}
-	privkey := caller.PrivateKey
+	privkey, _ := crypto.ParseAnyPrivateKey(caller.GetPrivateKey().KeyBytes)
 
 	// parse args
 	if len(args) > 0 {
@@ -259,7 +257,7 @@ func InvokeSetup(stub cached_stub.CachedStubInterface) (data_model.User, string,
 			encryptedBytes, _ := hex.DecodeString(args[1])
 			logger.Debugf("encryptedHex: %v", args[1])
 			logger.Debugf("encryptedBytes: %x", encryptedBytes)
-			decryptedBytes, err := rsa.DecryptPKCS1v15(rand.Reader, privkey, encryptedBytes)
+			decryptedBytes, err := crypto.DecryptWithAnyPrivateKey(privkey, encryptedBytes)
 			logger.Errorf("decrypted: %v %v", string(decryptedBytes[:]), err)
 			var args2 []string
 			json.Unmarshal(decryptedBytes, &args2)
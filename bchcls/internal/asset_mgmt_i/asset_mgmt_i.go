@@ -23,10 +23,13 @@ import (
 	"common/bchcls/internal/asset_mgmt_i/asset_mgmt_c"
 	"common/bchcls/internal/asset_mgmt_i/asset_mgmt_c/asset_mgmt_g"
 	"common/bchcls/internal/common/global"
+	"common/bchcls/internal/common/graph"
 	"common/bchcls/internal/consent_mgmt_i/consent_mgmt_c"
 	"common/bchcls/internal/datastore_i/datastore_c"
 	"common/bchcls/internal/datatype_i"
+	"common/bchcls/internal/history_i/history_c"
 	"common/bchcls/internal/key_mgmt_i"
+	"common/bchcls/internal/user_access_ctrl_i/abac_i"
 	"common/bchcls/internal/user_mgmt_i/user_mgmt_c"
 	"common/bchcls/simple_rule"
 	"common/bchcls/test_utils"
@@ -35,10 +38,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"reflect"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
 	"github.com/pkg/errors"
 )
 
@@ -62,9 +69,21 @@ type assetIter struct {
 	PreviousLedgerKey       string
 	Limit                   int
 	FilterRule              *simple_rule.Rule
+	IncludeDeleted          bool
 	count                   int
 	nextAsset               *data_model.Asset
 	closed                  bool
+	// assetIdFunc returns the assetId for an index row's primary key value.
+	// If it's not set, the assetId is GetAssetId(AssetNamespace, primary key value).
+	assetIdFunc func(primaryKey string) string
+}
+
+// rangesIter iterates over the rows of several ranges of an index table, one range after another.
+// ranges is a list of [startKey, endKey] pairs.
+type rangesIter struct {
+	table  table_interface.Table
+	ranges [][]string
+	iter   shim.StateQueryIteratorInterface
 }
 
 // if defaultDatastoreConnectionID is set, it will be used when DatastoreConnectionID is not set in asset's metadata.
@@ -81,7 +100,11 @@ func Init(stub cached_stub.CachedStubInterface, logLevel ...shim.LoggingLevel) (
 		logger.SetLevel(logLevel[0])
 	}
 
-	return nil, nil
+	// index of assets by datatype and owner
+	datatypeAssetTable := getDatatypeAssetTable(stub)
+	datatypeAssetTable.AddIndex([]string{"datatype_id", "owner_id", "row_id"}, false)
+	err := datatypeAssetTable.SaveToLedger()
+	return nil, err
 }
 
 // ------------------------------------------------------
@@ -126,6 +149,16 @@ func GetAssetKey(stub cached_stub.CachedStubInterface, assetId string, keyPath [
 		return nil, errors.New("key path is not valid")
 	}
 
+	// time-bound access must be in effect
+	inEffect, err := isKeyPathInEffect(stub, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if !inEffect {
+		logger.Debugf("key path is not in effect: %v", keyPath)
+		return nil, errors.New("key path is expired or not yet in effect")
+	}
+
 	// verify that the target key is correct asset key for the assetId
 	assetKeyId, err := GetAssetKeyId(stub, assetId)
 	if assetKeyId != keyPath[len(keyPath)-1] {
@@ -233,6 +266,103 @@ func GetAssetPrivateData(stub cached_stub.CachedStubInterface, assetData data_mo
 	return getPrivateData(stub, assetData, assetKey)
 }
 
+// ReplaceAssetKey encrypts an existing asset's private data with newKey and saves the asset, updating its
+// AssetKeyId and AssetKeyHash. asset must be a decrypted asset, for example one returned by GetAsset.
+// If the private data is stored in an off-chain datastore, the re-encrypted data is saved to the same datastore.
+// It does not check the caller's access to the asset, and it does not change the key graph.
+// Caller is responsible for both.
+func ReplaceAssetKey(stub cached_stub.CachedStubInterface, asset data_model.Asset, newKey data_model.Key) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("assetId: \"%v\", newKeyId: \"%v\"", asset.AssetId, newKey.ID)
+
+	existingAsset, err := GetEncryptedAssetData(stub, asset.AssetId)
+	if err != nil {
+		custom_err := &custom_errors.GetAssetDataError{AssetId: asset.AssetId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	if len(existingAsset.AssetId) == 0 {
+		custom_err := &custom_errors.GetAssetDataError{AssetId: asset.AssetId}
+		logger.Errorf("%v", custom_err)
+		return errors.WithStack(custom_err)
+	}
+	if data_model.IsEncryptedData(asset.PrivateData) {
+		logger.Error("Failed to replace asset key: Private data must be decrypted")
+		return errors.New("Failed to replace asset key: Private data must be decrypted")
+	}
+	if len(newKey.ID) == 0 || !crypto.ValidateSymKey(newKey.KeyBytes) {
+		custom_err := &custom_errors.ValidateKeyError{KeyId: newKey.ID}
+		logger.Errorf("%v", custom_err)
+		return errors.WithStack(custom_err)
+	}
+
+	// update custom indices before encrypting private data
+	err = updateCustomAssetIndices(stub, asset, false, false)
+	if err != nil {
+		logger.Errorf("Failed to update custom asset indices for assetId: %v", asset.AssetId)
+		return errors.Wrapf(err, "Failed to update custom asset indices for assetId: %v", asset.AssetId)
+	}
+
+	// encrypt private data fields with the new field keys
+	if asset.IsFieldEncrypted() {
+		err = encryptAssetFields(stub, &asset, asset.PrivateData, newKey)
+		if err != nil {
+			logger.Errorf("Failed to encrypt private data fields: %v", err)
+			return errors.Wrap(err, "Failed to encrypt private data fields")
+		}
+	}
+
+	// encrypt private data with the new key
+	privateData := asset.PrivateData
+	if len(asset.PrivateData) > 0 {
+		asset.PrivateData, err = crypto.EncryptWithSymKey(newKey.KeyBytes, privateData)
+		if err != nil || asset.PrivateData == nil {
+			custom_err := &custom_errors.EncryptionError{ToEncrypt: "PrivateData", EncryptionKey: newKey.ID}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.WithStack(custom_err)
+		}
+
+		connectionID := asset.GetDatastoreConnectionID()
+		if utils.IsStringEmpty(connectionID) && !utils.IsStringEmpty(defaultDatastoreConnectionID) {
+			connectionID = defaultDatastoreConnectionID
+		}
+		if !utils.IsStringEmpty(connectionID) {
+			myDatastore, err := datastore_c.GetDatastoreImpl(stub, connectionID)
+			if err != nil {
+				logger.Infof("Failed to instantiate datastore: %v", err)
+				return errors.Wrap(err, "Failed to instantitate datastore")
+			}
+			dataKey, err := myDatastore.Put(stub, asset.PrivateData)
+			if err != nil {
+				logger.Errorf("Failed to save data to datastore: %v", err)
+				return errors.Wrap(err, "Failed to save data to datastore")
+			}
+			asset.PrivateData = []byte(dataKey)
+		}
+	}
+	asset.AssetKeyId = newKey.ID
+	asset.AssetKeyHash = crypto.Hash(newKey.KeyBytes)
+	asset.Version = existingAsset.Version + 1
+
+	assetBytesE, err := json.Marshal(&asset)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "encrypted asset data"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	err = stub.PutState(asset.AssetId, assetBytesE)
+	if err != nil {
+		custom_err := &custom_errors.PutLedgerError{LedgerKey: asset.AssetId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	putEncryptedAssetToCache(stub, asset)
+	putPrivateDataToCache(stub, asset.AssetId, privateData)
+
+	logger.Infof("Successfully replaced key of asset \"%v\" with key \"%v\"", asset.AssetId, asset.AssetKeyId)
+	return nil
+}
+
 // ------------------------------------------------------
 // ------------- assetManagerImpl FUNCTIONS -------------
 // ------------------------------------------------------
@@ -344,6 +474,26 @@ func (assetManager assetManagerImpl) UpdateAsset(asset data_model.Asset, assetKe
 		return errors.New("Caller does not have write access to the asset")
 	}
 
+	// the namespace and attributes of the asset are given by the caller, so the access policy
+	// is also checked against the stored asset
+	existingAsset, err := GetEncryptedAssetData(assetManager.stub, asset.AssetId)
+	if err != nil {
+		custom_err := &custom_errors.GetAssetDataError{AssetId: asset.AssetId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	if len(existingAsset.AssetId) > 0 {
+		allowed, err := checkAccessPolicy(assetManager.stub, assetManager.caller, existingAsset, global.ACCESS_WRITE)
+		if err != nil {
+			logger.Errorf("Failed to check access policy of asset %v: %v", asset.AssetId, err)
+			return errors.Wrapf(err, "Failed to check access policy of asset %v", asset.AssetId)
+		}
+		if !allowed {
+			logger.Errorf("Caller %v does not have write access to asset %v", assetManager.caller.ID, asset.AssetId)
+			return errors.New("Caller does not have write access to the asset")
+		}
+	}
+
 	// validation done in putAssetByKey:
 	// asset key id and keybyte are validated
 	// asset should not already exist
@@ -380,14 +530,193 @@ func (assetManager assetManagerImpl) UpdateAsset(asset data_model.Asset, assetKe
 		true)
 }
 
+// UpdateAssetWithVersion documentation can be found in asset_mgmt_interfaces.go
+func (assetManager assetManagerImpl) UpdateAssetWithVersion(asset data_model.Asset, assetKey data_model.Key, expectedVersion int64) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("assetId: \"%v\", assetKeyId: \"%v\", expectedVersion: %v", asset.AssetId, assetKey.ID, expectedVersion)
+
+	if !IsValidAssetId(asset.AssetId) {
+		errMsg := "Invalid AssetID: Use asset_mgmt.GetAssetId to generate AssetID"
+		logger.Errorf(errMsg)
+		return errors.New(errMsg)
+	}
+
+	existingAsset, err := GetEncryptedAssetData(assetManager.stub, asset.AssetId)
+	if err != nil {
+		custom_err := &custom_errors.GetAssetDataError{AssetId: asset.AssetId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	// a missing asset has no version, so it only matches an expectedVersion of 0,
+	// and the strict update below then fails because the asset does not exist
+	if existingAsset.Version != expectedVersion {
+		custom_err := &custom_errors.VersionConflictError{AssetId: asset.AssetId, ExpectedVersion: expectedVersion, ActualVersion: existingAsset.Version}
+		logger.Errorf("%v", custom_err)
+		return errors.WithStack(custom_err)
+	}
+
+	return assetManager.UpdateAsset(asset, assetKey, true)
+}
+
 // DeleteAsset documentation can be found in asset_mgmt_interfaces.go
 func (assetManager assetManagerImpl) DeleteAsset(assetId string, assetKey data_model.Key) error {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 	logger.Debugf("assetId: \"%v\", assetKeyId: \"%v\"", assetId, assetKey.ID)
+
+	assetData, err := assetManager.getAssetForWrite(assetId, assetKey)
+	if err != nil {
+		return err
+	}
+	return deleteAsset(assetManager.stub, assetData, assetKey.KeyBytes)
+}
+
+// SoftDeleteAsset documentation can be found in asset_mgmt_interfaces.go
+func (assetManager assetManagerImpl) SoftDeleteAsset(assetId string, assetKey data_model.Key) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("assetId: \"%v\", assetKeyId: \"%v\"", assetId, assetKey.ID)
+
+	assetData, err := assetManager.getAssetForWrite(assetId, assetKey)
+	if err != nil {
+		return err
+	}
+	if assetData.IsDeleted() {
+		custom_err := &custom_errors.AssetDeletedError{AssetId: assetId}
+		logger.Errorf("%v", custom_err)
+		return errors.WithStack(custom_err)
+	}
+
+	txTimestamp, err := assetManager.stub.GetTxTimestamp()
+	if err != nil {
+		logger.Errorf("Failed to get transaction timestamp: %v", err)
+		return errors.Wrap(err, "Failed to get transaction timestamp")
+	}
+	if assetData.Metadata == nil {
+		assetData.Metadata = make(map[string]string)
+	}
+	assetData.Metadata[global.DELETED_AT_METADATA_KEY] = strconv.FormatInt(txTimestamp.GetSeconds(), 10)
+	assetData.Metadata[global.DELETED_BY_METADATA_KEY] = assetManager.caller.ID
+	err = putEncryptedAsset(assetManager.stub, assetData)
+	if err != nil {
+		return err
+	}
+	err = updateDeletedAssetIndex(assetManager.stub, assetData, assetKey)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Asset \"%v\" was soft deleted by \"%v\" in transaction \"%v\"", assetId, assetManager.caller.ID, assetManager.stub.GetTxID())
+	return assetManager.putAssetChangeLog(assetData, assetKey, "SoftDeleteAsset")
+}
+
+// RestoreAsset documentation can be found in asset_mgmt_interfaces.go
+func (assetManager assetManagerImpl) RestoreAsset(assetId string, assetKey data_model.Key) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("assetId: \"%v\", assetKeyId: \"%v\"", assetId, assetKey.ID)
+
+	assetData, err := assetManager.getAssetForWrite(assetId, assetKey)
+	if err != nil {
+		return err
+	}
+	if !assetData.IsDeleted() {
+		logger.Errorf("Asset %v is not deleted", assetId)
+		return errors.Errorf("Asset %v is not deleted", assetId)
+	}
+
+	delete(assetData.Metadata, global.DELETED_AT_METADATA_KEY)
+	delete(assetData.Metadata, global.DELETED_BY_METADATA_KEY)
+	err = putEncryptedAsset(assetManager.stub, assetData)
+	if err != nil {
+		return err
+	}
+	err = updateDeletedAssetIndex(assetManager.stub, assetData, assetKey)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Asset \"%v\" was restored by \"%v\" in transaction \"%v\"", assetId, assetManager.caller.ID, assetManager.stub.GetTxID())
+	return assetManager.putAssetChangeLog(assetData, assetKey, "RestoreAsset")
+}
+
+// PurgeAsset documentation can be found in asset_mgmt_interfaces.go
+func (assetManager assetManagerImpl) PurgeAsset(assetId string, assetKey data_model.Key) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("assetId: \"%v\", assetKeyId: \"%v\"", assetId, assetKey.ID)
+
+	assetData, err := assetManager.getAssetForWrite(assetId, assetKey)
+	if err != nil {
+		return err
+	}
+	if !assetData.IsDeleted() {
+		logger.Errorf("Asset %v must be soft deleted before it is purged", assetId)
+		return errors.Errorf("Asset %v must be soft deleted before it is purged", assetId)
+	}
+
+	err = deleteAsset(assetManager.stub, assetData, assetKey.KeyBytes)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Asset \"%v\" was purged by \"%v\" in transaction \"%v\"", assetId, assetManager.caller.ID, assetManager.stub.GetTxID())
+	return assetManager.putAssetChangeLog(assetData, assetKey, "PurgeAsset")
+}
+
+// updateDeletedAssetIndex updates the tombstone in the index row of an asset that was soft deleted or restored.
+func updateDeletedAssetIndex(stub cached_stub.CachedStubInterface, assetData data_model.Asset, assetKey data_model.Key) error {
+	if len(assetData.IndexTableName) == 0 {
+		return nil
+	}
+	asset := assetData.Copy()
+	privateData, err := getPrivateData(stub, assetData, assetKey.KeyBytes)
+	if err != nil {
+		logger.Errorf("Failed to decrypt private data of asset %v: %v", assetData.AssetId, err)
+		return errors.Wrapf(err, "Failed to decrypt private data of asset %v", assetData.AssetId)
+	}
+	asset.PrivateData = privateData
+	err = updateCustomAssetIndices(stub, asset, false, data_model.IsEncryptedData(privateData))
+	if err != nil {
+		logger.Errorf("Failed to update custom asset indices for assetId: %v", assetData.AssetId)
+		return errors.Wrapf(err, "Failed to update custom asset indices for assetId: %v", assetData.AssetId)
+	}
+	return nil
+}
+
+// putAssetChangeLog saves a transaction log of a soft delete, restore, or purge of an asset, encrypted with the asset key.
+// The log's TransactionID is the ID of the current transaction followed by "-", the assetId, "-", and the operation,
+// so that several operations on the asset in one transaction have separate logs. Its Field1 is the assetId.
+func (assetManager assetManagerImpl) putAssetChangeLog(assetData data_model.Asset, assetKey data_model.Key, operation string) error {
+	txTimestamp, err := assetManager.stub.GetTxTimestamp()
+	if err != nil {
+		logger.Errorf("Failed to get transaction timestamp: %v", err)
+		return errors.Wrap(err, "Failed to get transaction timestamp")
+	}
+	transactionLog := data_model.TransactionLog{
+		TransactionID: assetManager.stub.GetTxID() + "-" + assetData.AssetId + "-" + operation,
+		Namespace:     global.ASSET_LOG_NAMESPACE,
+		FunctionName:  operation,
+		CallerID:      assetManager.caller.ID,
+		Timestamp:     txTimestamp.GetSeconds(),
+		Field1:        assetData.AssetId,
+	}
+	logAsset, err := history_c.ConvertToAsset(transactionLog, assetKey.ID)
+	if err != nil {
+		logger.Errorf("Failed to convert transaction log to asset: %v", err)
+		return errors.Wrap(err, "Failed to convert transaction log to asset")
+	}
+	err = assetManager.UpdateAsset(*logAsset, assetKey, false)
+	if err != nil {
+		logger.Errorf("Failed to save %v log of asset %v: %v", operation, assetData.AssetId, err)
+		return errors.Wrapf(err, "Failed to save %v log of asset %v", operation, assetData.AssetId)
+	}
+	return nil
+}
+
+// getAssetForWrite returns the encrypted asset for the given assetId after checking that
+// assetKey is the asset's key and that the caller has write access to the asset.
+func (assetManager assetManagerImpl) getAssetForWrite(assetId string, assetKey data_model.Key) (data_model.Asset, error) {
 	if !IsValidAssetId(assetId) {
 		errMsg := "Invalid AssetID: Use asset_mgmt.GetAssetId to generate AssetID"
 		logger.Errorf(errMsg)
-		return errors.New(errMsg)
+		return data_model.Asset{}, errors.New(errMsg)
 	}
 
 	// find existing asset from ledger
@@ -395,47 +724,250 @@ func (assetManager assetManagerImpl) DeleteAsset(assetId string, assetKey data_m
 	if err != nil {
 		custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
 		logger.Errorf("%v: %v", custom_err, err)
-		return errors.Wrap(err, custom_err.Error())
+		return data_model.Asset{}, errors.Wrap(err, custom_err.Error())
 	}
 	if len(assetData.AssetKeyId) == 0 || assetData.AssetKeyId != assetKey.ID {
 		custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
 		logger.Errorf("%v", custom_err)
-		return errors.WithStack(custom_err)
+		return data_model.Asset{}, errors.WithStack(custom_err)
 	}
 
 	// verify asset key by hash
 	assetKeyHash := crypto.Hash(assetKey.KeyBytes)
 	if !bytes.Equal(assetData.AssetKeyHash, assetKeyHash) {
 		logger.Error("Invalid Asset Key: Hash does not match")
-		return errors.New("Invalid Asset Key: Hash does not match")
+		return data_model.Asset{}, errors.New("Invalid Asset Key: Hash does not match")
 	}
 
 	// check for write access
 	hasWriteAccess, err := hasUserWriteAccessToAsset(assetManager.stub, assetManager.caller, assetData, true, true)
+	if !hasWriteAccess {
+		logger.Errorf("Caller %v does not have write access to asset %v", assetManager.caller.ID, assetId)
+		return data_model.Asset{}, errors.New("Caller does not have write access to the asset")
+	}
+	return assetData, nil
+}
+
+// RotateAssetKey documentation can be found in asset_mgmt_interfaces.go
+func (assetManager assetManagerImpl) RotateAssetKey(assetId string, oldKey data_model.Key, newKey data_model.Key) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("assetId: \"%v\", oldKeyId: \"%v\", newKeyId: \"%v\"", assetId, oldKey.ID, newKey.ID)
+	if !IsValidAssetId(assetId) {
+		errMsg := "Invalid AssetID: Use asset_mgmt.GetAssetId to generate AssetID"
+		logger.Errorf(errMsg)
+		return errors.New(errMsg)
+	}
+
+	// find existing asset from ledger
+	assetData, err := GetEncryptedAssetData(assetManager.stub, assetId)
+	if err != nil {
+		custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	if len(assetData.AssetKeyId) == 0 || assetData.AssetKeyId != oldKey.ID {
+		custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
+		logger.Errorf("%v", custom_err)
+		return errors.WithStack(custom_err)
+	}
+
+	// verify asset keys by hash
+	if !bytes.Equal(assetData.AssetKeyHash, crypto.Hash(oldKey.KeyBytes)) {
+		logger.Error("Invalid Asset Key: Hash does not match")
+		return errors.New("Invalid Asset Key: Hash does not match")
+	}
+	if len(newKey.ID) == 0 || !crypto.ValidateSymKey(newKey.KeyBytes) {
+		custom_err := &custom_errors.ValidateKeyError{KeyId: newKey.ID}
+		logger.Errorf("%v", custom_err)
+		return errors.WithStack(custom_err)
+	}
+	if bytes.Equal(assetData.AssetKeyHash, crypto.Hash(newKey.KeyBytes)) {
+		logger.Error("Invalid Asset Key: New asset key must be different from the old asset key")
+		return errors.New("Invalid Asset Key: New asset key must be different from the old asset key")
+	}
+
+	// check for write access
+	hasWriteAccess, _ := hasUserWriteAccessToAsset(assetManager.stub, assetManager.caller, assetData, true, true)
 	if !hasWriteAccess {
 		logger.Errorf("Caller %v does not have write access to asset %v", assetManager.caller.ID, assetId)
 		return errors.New("Caller does not have write access to the asset")
 	}
 
-	// delete asset
-	err = assetManager.stub.DelState(assetId)
+	// decrypt asset with the old key
+	asset, err := getAssetByKey(assetManager.stub, assetId, oldKey.KeyBytes)
 	if err != nil {
-		custom_err := &custom_errors.DeleteLedgerError{LedgerKey: assetId}
+		custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
 		logger.Errorf("%v: %v", custom_err, err)
 		return errors.Wrap(err, custom_err.Error())
 	}
 
-	// delete asset's index values
-	if len(assetData.IndexTableName) > 0 {
-		table := index.GetTable(assetManager.stub, assetData.IndexTableName)
-		table.DeleteRow(assetId)
+	// datatype sym keys are needed to re-encrypt datatype edges, which also give access to consent targets
+	ownerID := ""
+	if len(asset.OwnerIds) > 0 {
+		ownerID = asset.OwnerIds[0]
+	}
+	datatypeKeys := []data_model.Key{}
+	for _, datatypeID := range asset.Datatypes {
+		datatypeKey, err := datatype_i.GetDatatypeSymKey(assetManager.stub, assetManager.caller, datatypeID, ownerID)
+		if err != nil || datatypeKey.IsEmpty() {
+			logger.Errorf("Failed to GetDatatypeSymKey: %v", err)
+			return errors.Errorf("Failed to GetDatatypeSymKey for datatype %v", datatypeID)
+		}
+		datatypeKeys = append(datatypeKeys, datatypeKey)
 	}
 
-	return nil
+	// move field access given to users and groups to the new field keys, which are derived from the new asset key
+	// range queries don't return writes of the same transaction, so the asset key replacement below still sees the
+	// old asset key -> old field key edges; the asset key edges to the field keys are fixed up around it
+	oldKey.Type = global.KEY_TYPE_SYM
+	newKey.Type = global.KEY_TYPE_SYM
+	oldFieldKeys := []data_model.Key{}
+	for fieldName := range asset.EncryptedFields {
+		oldFieldKey := getFieldKey(assetId, oldKey, fieldName)
+		if !key_mgmt_i.KeyExists(assetManager.stub, oldFieldKey.ID) {
+			continue
+		}
+		newFieldKey := getFieldKey(assetId, newKey, fieldName)
+		err = key_mgmt_i.ReplaceKey(assetManager.stub, oldFieldKey, newFieldKey, oldKey)
+		if err == nil {
+			err = key_mgmt_i.RevokeAccess(assetManager.stub, oldKey.ID, newFieldKey.ID)
+		}
+		if err != nil {
+			logger.Errorf("Failed to replace key of field %v: %v", fieldName, err)
+			return errors.Wrapf(err, "Failed to replace key of field %v", fieldName)
+		}
+		oldFieldKeys = append(oldFieldKeys, oldFieldKey)
+	}
+
+	// re-wrap the asset key for every user, group, and consent that has access
+	err = key_mgmt_i.ReplaceKey(assetManager.stub, oldKey, newKey, datatypeKeys...)
+	if err != nil {
+		logger.Errorf("Failed to replace asset key: %v", err)
+		return errors.Wrap(err, "Failed to replace asset key")
+	}
+
+	// delete the old field keys; the new asset key is given access to the new field keys by ReplaceAssetKey
+	for _, oldFieldKey := range oldFieldKeys {
+		err = key_mgmt_i.RevokeAccess(assetManager.stub, newKey.ID, oldFieldKey.ID)
+		if err == nil {
+			err = key_mgmt_i.DeleteKey(assetManager.stub, oldFieldKey.ID)
+		}
+		if err != nil {
+			logger.Errorf("Failed to delete field key \"%v\": %v", oldFieldKey.ID, err)
+			return errors.Wrapf(err, "Failed to delete field key \"%v\"", oldFieldKey.ID)
+		}
+	}
+
+	// re-wrap write only access given by every grantor
+	grantorIDs, err := getWriteOnlyAccessGrantorIDs(assetManager.stub, *asset)
+	if err != nil {
+		return err
+	}
+	for _, grantorID := range grantorIDs {
+		writeOnlyKey := data_model.Key{ID: key_mgmt_i.GetKeyIdForWriteOnlyAccess(assetId, oldKey.ID, grantorID), KeyBytes: oldKey.KeyBytes, Type: global.KEY_TYPE_SYM}
+		if key_mgmt_i.KeyExists(assetManager.stub, writeOnlyKey.ID) {
+			newWriteOnlyKey := data_model.Key{ID: key_mgmt_i.GetKeyIdForWriteOnlyAccess(assetId, newKey.ID, grantorID), KeyBytes: newKey.KeyBytes, Type: global.KEY_TYPE_SYM}
+			err = key_mgmt_i.ReplaceKey(assetManager.stub, writeOnlyKey, newWriteOnlyKey)
+			if err != nil {
+				logger.Errorf("Failed to replace write only access key: %v", err)
+				return errors.Wrap(err, "Failed to replace write only access key")
+			}
+		}
+	}
+
+	// move write only access grantors to the new key
+	grantorIDs, err = graph.GetDirectChildren(assetManager.stub, global.WRITE_ONLY_ACCESS_GRAPH, oldKey.ID)
+	if err != nil {
+		logger.Errorf("Failed to get write only access grantors of asset %v: %v", assetId, err)
+		return errors.Wrapf(err, "Failed to get write only access grantors of asset %v", assetId)
+	}
+	for _, grantorID := range grantorIDs {
+		err = graph.PutEdge(assetManager.stub, global.WRITE_ONLY_ACCESS_GRAPH, newKey.ID, grantorID)
+		if err == nil {
+			err = graph.DeleteEdge(assetManager.stub, global.WRITE_ONLY_ACCESS_GRAPH, oldKey.ID, grantorID)
+		}
+		if err != nil {
+			logger.Errorf("Failed to move write only access grantor of asset %v for \"%v\": %v", assetId, grantorID, err)
+			return errors.Wrapf(err, "Failed to move write only access grantor of asset %v for \"%v\"", assetId, grantorID)
+		}
+	}
+
+	// move deny entries to the new key
+	deniedIDs, err := graph.GetDirectChildren(assetManager.stub, global.ACCESS_DENY_GRAPH, oldKey.ID)
+	if err != nil {
+		logger.Errorf("Failed to get deny entries of asset %v: %v", assetId, err)
+		return errors.Wrapf(err, "Failed to get deny entries of asset %v", assetId)
+	}
+	for _, deniedID := range deniedIDs {
+		err = graph.PutEdge(assetManager.stub, global.ACCESS_DENY_GRAPH, newKey.ID, deniedID)
+		if err == nil {
+			err = graph.DeleteEdge(assetManager.stub, global.ACCESS_DENY_GRAPH, oldKey.ID, deniedID)
+		}
+		if err != nil {
+			logger.Errorf("Failed to move deny entry of asset %v for \"%v\": %v", assetId, deniedID, err)
+			return errors.Wrapf(err, "Failed to move deny entry of asset %v for \"%v\"", assetId, deniedID)
+		}
+	}
+
+	// re-encrypt private data and update asset key id and hash
+	return ReplaceAssetKey(assetManager.stub, *asset, newKey)
 }
 
 // GetAsset documentation can be found in asset_mgmt_interfaces.go
-func (assetManager assetManagerImpl) GetAsset(assetId string, assetKey data_model.Key) (*data_model.Asset, error) {
+func (assetManager assetManagerImpl) GetAsset(assetId string, assetKey data_model.Key, includeDeleted ...bool) (*data_model.Asset, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("assetId: \"%v\", assetKeyId: \"%v\", includeDeleted: %v", assetId, assetKey.ID, includeDeleted)
+	if !IsValidAssetId(assetId) {
+		errMsg := "Invalid AssetID: Use asset_mgmt.GetAssetId to generate AssetID"
+		logger.Errorf(errMsg)
+		return nil, errors.New(errMsg)
+	}
+	asset, err := getAssetByKey(assetManager.stub, assetId, assetKey.KeyBytes)
+	if asset != nil && asset.IsDeleted() && !(len(includeDeleted) > 0 && includeDeleted[0]) {
+		logger.Debugf("Asset %v is deleted", assetId)
+		return &data_model.Asset{}, nil
+	}
+
+	// check the read access policy if private data is to be decrypted
+	if err == nil && asset != nil && len(asset.AssetId) > 0 && (len(assetKey.KeyBytes) > 0 || len(asset.EncryptedFields) > 0) {
+		allowed, err := checkAccessPolicy(assetManager.stub, assetManager.caller, *asset, global.ACCESS_READ)
+		if err != nil || !allowed {
+			logger.Errorf("Caller %v does not have read access to asset %v", assetManager.caller.ID, assetId)
+			return nil, errors.New("Caller does not have read access to the asset")
+		}
+	}
+
+	// return the fields the caller has access to if the asset key was not given
+	if asset != nil && len(asset.EncryptedFields) > 0 && data_model.IsEncryptedData(asset.PrivateData) {
+		fields := decryptAssetFields(assetManager.stub, assetManager.caller, *asset)
+		if fields != nil {
+			asset.PrivateData = fields
+			return asset, nil
+		}
+	}
+	return asset, err
+}
+
+// VerifyAssetSignature documentation can be found in asset_mgmt_interfaces.go
+func (assetManager assetManagerImpl) VerifyAssetSignature(assetId string, assetKey data_model.Key) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("assetId: \"%v\", assetKeyId: \"%v\"", assetId, assetKey.ID)
+	asset, err := assetManager.GetAsset(assetId, assetKey)
+	if err != nil {
+		custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	if len(asset.AssetId) == 0 {
+		custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
+		logger.Errorf("%v", custom_err)
+		return errors.WithStack(custom_err)
+	}
+	return VerifyAssetSignature(assetManager.stub, *asset)
+}
+
+// GetAssetHistory documentation can be found in asset_mgmt_interfaces.go
+func (assetManager assetManagerImpl) GetAssetHistory(assetId string, assetKey data_model.Key) ([]data_model.AssetVersion, error) {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 	logger.Debugf("assetId: \"%v\", assetKeyId: \"%v\"", assetId, assetKey.ID)
 	if !IsValidAssetId(assetId) {
@@ -443,7 +975,204 @@ func (assetManager assetManagerImpl) GetAsset(assetId string, assetKey data_mode
 		logger.Errorf(errMsg)
 		return nil, errors.New(errMsg)
 	}
-	return getAssetByKey(assetManager.stub, assetId, assetKey.KeyBytes)
+	return getAssetHistory(assetManager.stub, assetId, assetKey.KeyBytes)
+}
+
+// MigrateAssets documentation can be found in asset_mgmt_interfaces.go
+func (assetManager assetManagerImpl) MigrateAssets(datatypeID string, fromVersion int, toVersion int, previousKey string, limit int) ([]string, string, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("datatypeID: %v, fromVersion: %v, toVersion: %v, previousKey: \"%v\", limit: %v", datatypeID, fromVersion, toVersion, previousKey, limit)
+
+	datatype, err := datatype_i.GetDatatypeWithParams(assetManager.stub, datatypeID)
+	if err != nil {
+		custom_err := &custom_errors.GetDatatypeError{Datatype: datatypeID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, "", errors.Wrap(err, custom_err.Error())
+	}
+	if utils.IsStringEmpty(datatype.GetDatatypeID()) {
+		custom_err := &custom_errors.GetDatatypeError{Datatype: datatypeID}
+		logger.Errorf("%v", custom_err)
+		return nil, "", errors.WithStack(custom_err)
+	}
+	if fromVersion < 1 || toVersion <= fromVersion || toVersion > datatype.GetVersion() {
+		logger.Errorf("Invalid migration from version %v to version %v of datatype %v", fromVersion, toVersion, datatypeID)
+		return nil, "", errors.Errorf("Invalid migration from version %v to version %v of datatype %v", fromVersion, toVersion, datatypeID)
+	}
+
+	// page through the datatype asset index rows of the datatype, for all owners
+	indexTable := getDatatypeAssetTable(assetManager.stub)
+	startKey, err := indexTable.CreateRangeKey([]string{"datatype_id", "owner_id", "row_id"}, []string{datatypeID})
+	if err != nil {
+		logger.Errorf("Failed to create startKey: %v", err)
+		return nil, "", errors.Wrap(err, "Failed to create startKey")
+	}
+	endKey := startKey + string(rune(global.MAX_UNICODE_RUNE_VALUE))
+	if len(previousKey) > 0 {
+		if previousKey < startKey || previousKey >= endKey {
+			logger.Errorf("Invalid previousKey for datatype %v: %v", datatypeID, previousKey)
+			return nil, "", errors.Errorf("Invalid previousKey for datatype %v", datatypeID)
+		}
+		startKey = previousKey + string(rune(global.MIN_UNICODE_RUNE_VALUE))
+	}
+	iter, err := indexTable.GetRowsByRange(startKey, endKey)
+	if err != nil {
+		custom_err := &custom_errors.GetLedgerError{LedgerKey: startKey, LedgerItem: global.INDEX_DATATYPE_ASSET}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, "", errors.Wrap(err, custom_err.Error())
+	}
+	defer iter.Close()
+
+	callerKey := assetManager.caller.GetPrivateKey()
+	migratedAssetIds := []string{}
+	lastKey := ""
+	for count := 0; iter.HasNext() && (limit < 0 || count < limit); count++ {
+		kv, err := iter.Next()
+		if err != nil {
+			custom_err := &custom_errors.IterError{}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, "", errors.Wrap(err, custom_err.Error())
+		}
+		lastKey = kv.GetKey()
+
+		row := make(map[string]string)
+		err = json.Unmarshal(kv.GetValue(), &row)
+		if err != nil {
+			custom_err := &custom_errors.UnmarshalError{Type: "Index Row"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, "", errors.Wrap(err, custom_err.Error())
+		}
+		assetId := getAssetIdFromDatatypeAssetRowId(row["row_id"])
+		asset, err := GetEncryptedAssetData(assetManager.stub, assetId)
+		if err != nil {
+			custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, "", errors.Wrap(err, custom_err.Error())
+		}
+		if !utils.InList(asset.Datatypes, datatypeID) || asset.IsDeleted() || asset.GetDatatypeVersion(datatypeID) != fromVersion {
+			continue
+		}
+
+		// skip assets the caller can't decrypt or update
+		assetKeyBytes, err := key_mgmt_i.SlowVerifyAccessAndGetKey(assetManager.stub, callerKey.ID, callerKey.KeyBytes, asset.AssetKeyId)
+		if err != nil || assetKeyBytes == nil {
+			logger.Debugf("Caller %v does not have access to asset %v", assetManager.caller.ID, asset.AssetId)
+			continue
+		}
+		hasWriteAccess, err := hasUserWriteAccessToAsset(assetManager.stub, assetManager.caller, asset, true, true)
+		if err != nil || !hasWriteAccess {
+			logger.Debugf("Caller %v does not have write access to asset %v", assetManager.caller.ID, asset.AssetId)
+			continue
+		}
+
+		privateData, err := getPrivateData(assetManager.stub, asset, assetKeyBytes)
+		if err != nil {
+			custom_err := &custom_errors.DecryptionError{ToDecrypt: "PrivateData", DecryptionKey: asset.AssetKeyId}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, "", errors.Wrap(err, custom_err.Error())
+		}
+		asset.PublicData, asset.PrivateData, err = datatype.MigrateAssetData(assetManager.stub, fromVersion, toVersion, asset.PublicData, privateData)
+		if err != nil {
+			logger.Errorf("Failed to migrate asset %v: %v", asset.AssetId, err)
+			return nil, "", errors.Wrapf(err, "Failed to migrate asset %v", asset.AssetId)
+		}
+		asset.SetDatatypeVersion(datatypeID, toVersion)
+
+		assetKey := data_model.Key{ID: asset.AssetKeyId, KeyBytes: assetKeyBytes, Type: global.KEY_TYPE_SYM}
+		err = assetManager.UpdateAsset(asset, assetKey)
+		if err != nil {
+			logger.Errorf("Failed to update migrated asset %v: %v", asset.AssetId, err)
+			return nil, "", errors.Wrapf(err, "Failed to update migrated asset %v", asset.AssetId)
+		}
+		migratedAssetIds = append(migratedAssetIds, asset.AssetId)
+	}
+
+	if !iter.HasNext() {
+		lastKey = ""
+	}
+	return migratedAssetIds, lastKey, nil
+}
+
+// RebuildDatatypeAssetIndex documentation can be found in asset_mgmt_interfaces.go
+func (assetManager assetManagerImpl) RebuildDatatypeAssetIndex(previousKey string, limit int) ([]string, string, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("previousKey: \"%v\", limit: %v", previousKey, limit)
+
+	if assetManager.caller.Role != global.ROLE_SYSTEM_ADMIN {
+		custom_err := &custom_errors.RoleAccessPrivilegeError{Role: assetManager.caller.Role}
+		logger.Errorf("RebuildDatatypeAssetIndex: %v", custom_err)
+		return nil, "", errors.WithStack(custom_err)
+	}
+
+	// page through all assets on the ledger; asset IDs are the only non-composite keys with the asset ID prefix
+	startKey := global.ASSET_ID_PREFIX
+	if len(previousKey) > 0 {
+		startKey = previousKey + string(rune(global.MIN_UNICODE_RUNE_VALUE))
+	}
+	endKey := global.ASSET_ID_PREFIX + string(rune(global.MAX_UNICODE_RUNE_VALUE))
+	iter, err := assetManager.stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		custom_err := &custom_errors.GetLedgerError{LedgerKey: startKey, LedgerItem: "assets"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, "", errors.Wrap(err, custom_err.Error())
+	}
+	defer iter.Close()
+
+	indexedAssetIds := []string{}
+	lastKey := ""
+	for count := 0; iter.HasNext() && (limit < 0 || count < limit); count++ {
+		kv, err := iter.Next()
+		if err != nil {
+			custom_err := &custom_errors.IterError{}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, "", errors.Wrap(err, custom_err.Error())
+		}
+		lastKey = kv.GetKey()
+
+		asset := data_model.Asset{}
+		err = json.Unmarshal(kv.GetValue(), &asset)
+		if err != nil {
+			custom_err := &custom_errors.UnmarshalError{Type: "Asset"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, "", errors.Wrap(err, custom_err.Error())
+		}
+		if len(asset.Datatypes) == 0 || len(asset.OwnerIds) == 0 {
+			continue
+		}
+
+		err = updateDatatypeAssetIndex(assetManager.stub, asset.AssetId, nil, nil, asset.Datatypes, asset.OwnerIds)
+		if err != nil {
+			logger.Errorf("Failed to index asset %v: %v", asset.AssetId, err)
+			return nil, "", errors.Wrapf(err, "Failed to index asset %v", asset.AssetId)
+		}
+		indexedAssetIds = append(indexedAssetIds, asset.AssetId)
+	}
+
+	if !iter.HasNext() {
+		lastKey = ""
+	}
+	return indexedAssetIds, lastKey, nil
+}
+
+// GetAssetAtTime documentation can be found in asset_mgmt_interfaces.go
+func (assetManager assetManagerImpl) GetAssetAtTime(assetId string, assetKey data_model.Key, timestamp int64) (*data_model.Asset, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("assetId: \"%v\", assetKeyId: \"%v\", timestamp: %v", assetId, assetKey.ID, timestamp)
+	versions, err := assetManager.GetAssetHistory(assetId, assetKey)
+	if err != nil {
+		custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	// versions are sorted by timestamp, so the last version at or before timestamp is the one in effect
+	asset := data_model.Asset{}
+	for _, version := range versions {
+		if version.Timestamp > timestamp {
+			break
+		}
+		asset = version.Asset
+	}
+	return &asset, nil
 }
 
 // GetAssetSymKey documentation can be found in asset_mgmt_interfaces.go
@@ -478,6 +1207,16 @@ func (assetManager assetManagerImpl) GetAssetKey(assetId string, keyPath []strin
 		return data_model.Key{}, errors.New("First key is not caller's key")
 	}
 
+	// deny entries take precedence over the key path
+	denied, err := IsUserDeniedAccessToKey(assetManager.stub, assetManager.caller.ID, assetKeyId)
+	if err != nil {
+		return data_model.Key{}, err
+	}
+	if denied {
+		logger.Errorf("Caller %v is denied access to asset key %v", assetManager.caller.ID, assetKeyId)
+		return data_model.Key{}, errors.New("Caller is denied access to the asset key")
+	}
+
 	assetKeyBytes := []byte{}
 	if len(keyPath) == 1 {
 		assetKeyBytes = startKey
@@ -538,12 +1277,41 @@ func (assetManager assetManagerImpl) AddAccessToAsset(accessControl data_model.A
 		return errors.New("Caller does not have write access to the asset")
 	}
 
+	// deny entries can only be added to existing assets
+	if accessControl.Access == global.ACCESS_DENY {
+		if !assetExist {
+			err := errors.WithStack(&custom_errors.GetAssetDataError{AssetId: accessControl.AssetId})
+			logger.Error(err)
+			return err
+		}
+		if asset.IsOwner(accessControl.UserId) {
+			logger.Errorf("Owner of asset %v can't be denied access", asset.AssetId)
+			return errors.New("Owner of the asset can't be denied access")
+		}
+		_, err = getUserPublicKey(assetManager.stub, accessControl.UserId)
+		if err != nil {
+			return err
+		}
+		err = graph.PutEdge(assetManager.stub, global.ACCESS_DENY_GRAPH, asset.AssetKeyId, accessControl.UserId)
+		if err != nil {
+			logger.Errorf("Failed to deny access to asset %v for \"%v\": %v", asset.AssetId, accessControl.UserId, err)
+			return errors.Wrapf(err, "Failed to deny access to asset %v for \"%v\"", asset.AssetId, accessControl.UserId)
+		}
+		return nil
+	}
+
 	// edge data: set AccessType
 	edgeData := make(map[string]string)
 	edgeData[global.EDGEDATA_ACCESS_TYPE] = accessControl.Access
 	if accessControl.Access == global.ACCESS_READ_ONLY {
 		edgeData[global.EDGEDATA_ACCESS_TYPE] = global.ACCESS_READ
 	}
+	if accessControl.NotBefore != 0 {
+		edgeData[global.EDGEDATA_NOT_BEFORE] = strconv.FormatInt(accessControl.NotBefore, 10)
+	}
+	if accessControl.ExpirationDate != 0 {
+		edgeData[global.EDGEDATA_EXPIRATION_DATE] = strconv.FormatInt(accessControl.ExpirationDate, 10)
+	}
 
 	// get start key
 	if accessControl.UserKey == nil || accessControl.UserKey.IsEmpty() {
@@ -571,6 +1339,32 @@ func (assetManager assetManagerImpl) AddAccessToAsset(accessControl data_model.A
 		accessControl.AssetKey = &assetKey
 	}
 
+	// field access
+	if len(accessControl.Fields) > 0 {
+		if !asset.IsFieldEncrypted() {
+			logger.Errorf("Field-level encryption is not enabled for asset %v", accessControl.AssetId)
+			return errors.Errorf("Field-level encryption is not enabled for asset %v", accessControl.AssetId)
+		}
+		if !bytes.Equal(asset.AssetKeyHash, crypto.Hash(accessControl.AssetKey.KeyBytes)) {
+			logger.Error("Invalid Asset Key: Hash does not match")
+			return errors.New("Invalid Asset Key: Hash does not match")
+		}
+		for _, fieldName := range accessControl.Fields {
+			if _, ok := asset.EncryptedFields[fieldName]; !ok {
+				logger.Errorf("Asset %v does not have private data field %v", accessControl.AssetId, fieldName)
+				return errors.Errorf("Asset %v does not have private data field %v", accessControl.AssetId, fieldName)
+			}
+			fieldKey := getFieldKey(accessControl.AssetId, *accessControl.AssetKey, fieldName)
+			err = key_mgmt_i.AddAccess(assetManager.stub, *accessControl.UserKey, fieldKey, edgeData)
+			if err != nil {
+				custom_err := &custom_errors.AddAccessError{Key: fieldKey.ID}
+				logger.Errorf("%v: %v", custom_err, err)
+				return errors.Wrap(err, custom_err.Error())
+			}
+		}
+		return nil
+	}
+
 	// write only access
 	if accessControl.Access == global.ACCESS_WRITE_ONLY {
 		// revoke read access first
@@ -584,6 +1378,12 @@ func (assetManager assetManagerImpl) AddAccessToAsset(accessControl data_model.A
 		newKey.ID = key_mgmt_i.GetKeyIdForWriteOnlyAccess(accessControl.AssetId, accessControl.AssetKey.ID, assetManager.caller.ID)
 		newKey.KeyBytes = accessControl.AssetKey.KeyBytes
 		newKey.Type = accessControl.AssetKey.Type
+		// remember the grantor, so that its write only key can be found when the asset key is rotated
+		err = graph.PutEdge(assetManager.stub, global.WRITE_ONLY_ACCESS_GRAPH, accessControl.AssetKey.ID, assetManager.caller.ID)
+		if err != nil {
+			logger.Errorf("Failed to save write only access grantor of asset %v: %v", accessControl.AssetId, err)
+			return errors.Wrapf(err, "Failed to save write only access grantor of asset %v", accessControl.AssetId)
+		}
 		accessControl.Access = global.ACCESS_WRITE_ONLY
 		accessControl.AssetKey = &newKey
 	} else {
@@ -624,6 +1424,16 @@ func (assetManager assetManagerImpl) RemoveAccessFromAsset(accessControl data_mo
 		return errors.New("Caller is not owner of asset")
 	}
 
+	// remove deny entry
+	if accessControl.Access == global.ACCESS_DENY {
+		err = graph.DeleteEdge(assetManager.stub, global.ACCESS_DENY_GRAPH, asset.AssetKeyId, accessControl.UserId)
+		if err != nil {
+			logger.Errorf("Failed to remove deny entry of asset %v for \"%v\": %v", asset.AssetId, accessControl.UserId, err)
+			return errors.Wrapf(err, "Failed to remove deny entry of asset %v for \"%v\"", asset.AssetId, accessControl.UserId)
+		}
+		return nil
+	}
+
 	// get start key ID
 	startKeyID := ""
 	if accessControl.UserKey != nil && len(accessControl.UserKey.ID) > 0 {
@@ -646,6 +1456,19 @@ func (assetManager assetManagerImpl) RemoveAccessFromAsset(accessControl data_mo
 		}
 	}
 
+	// remove field access
+	if len(accessControl.Fields) > 0 {
+		for _, fieldName := range accessControl.Fields {
+			fieldKeyId := key_mgmt_i.GetKeyIdForFieldAccess(accessControl.AssetId, targetKeyID, fieldName)
+			err = key_mgmt_i.RevokeAccess(assetManager.stub, startKeyID, fieldKeyId)
+			if err != nil {
+				logger.Errorf("Failed to revoke access to field %v: %v", fieldName, err)
+				return errors.Wrapf(err, "Failed to revoke access to field %v", fieldName)
+			}
+		}
+		return nil
+	}
+
 	// remove write only access edge if removing write only access
 	if accessControl.Access == global.ACCESS_WRITE_ONLY {
 		targetKeyID2 := key_mgmt_i.GetKeyIdForWriteOnlyAccess(accessControl.AssetId, targetKeyID, assetManager.caller.ID)
@@ -668,6 +1491,86 @@ func (assetManager assetManagerImpl) RemoveAccessFromAsset(accessControl data_mo
 	return key_mgmt_i.UpdateAccessEdge(assetManager.stub, startKeyID, targetKeyID, edgeValue, edgeData)
 }
 
+// RemoveExpiredAccessFromAsset documentation can be found in asset_mgmt_interfaces.go.
+func (assetManager assetManagerImpl) RemoveExpiredAccessFromAsset(assetId string) ([]string, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("assetId: %v", assetId)
+
+	// get asset
+	asset, err := getAssetByKey(assetManager.stub, assetId, nil)
+	if err != nil {
+		logger.Errorf("Failed to get asset: %v", err)
+		return nil, errors.Wrap(err, "Failed to get asset")
+	}
+	if utils.IsStringEmpty(asset.AssetId) {
+		err := errors.WithStack(&custom_errors.GetAssetDataError{AssetId: assetId})
+		logger.Error(err)
+		return nil, err
+	}
+
+	// only owner can remove access, including expired access given by other callers
+	if !asset.IsOwner(assetManager.caller.ID) {
+		logger.Errorf("Caller %v is not owner of asset %v", assetManager.caller.ID, asset.AssetId)
+		return nil, errors.New("Caller is not owner of asset")
+	}
+
+	txTimestamp, err := assetManager.stub.GetTxTimestamp()
+	if err != nil {
+		logger.Errorf("Failed to get transaction timestamp: %v", err)
+		return nil, errors.Wrap(err, "Failed to get transaction timestamp")
+	}
+	now := txTimestamp.GetSeconds()
+
+	// access can be given to the asset key, the write only keys, and the field keys
+	targetKeyIDs := []string{asset.AssetKeyId}
+	grantorIDs, err := getWriteOnlyAccessGrantorIDs(assetManager.stub, *asset)
+	if err != nil {
+		return nil, err
+	}
+	for _, grantorID := range grantorIDs {
+		targetKeyIDs = append(targetKeyIDs, key_mgmt_i.GetKeyIdForWriteOnlyAccess(asset.AssetId, asset.AssetKeyId, grantorID))
+	}
+	fieldNames := []string{}
+	for fieldName := range asset.EncryptedFields {
+		fieldNames = append(fieldNames, fieldName)
+	}
+	sort.Strings(fieldNames)
+	for _, fieldName := range fieldNames {
+		targetKeyIDs = append(targetKeyIDs, key_mgmt_i.GetKeyIdForFieldAccess(asset.AssetId, asset.AssetKeyId, fieldName))
+	}
+
+	removedKeyIDs := []string{}
+	for _, targetKeyID := range targetKeyIDs {
+		startKeyIDs, err := graph.GetDirectParents(assetManager.stub, global.KEY_GRAPH_PREFIX, targetKeyID)
+		if err != nil {
+			logger.Errorf("Failed to get parents of key \"%v\": %v", targetKeyID, err)
+			return nil, errors.Wrapf(err, "Failed to get parents of key \"%v\"", targetKeyID)
+		}
+		for _, startKeyID := range startKeyIDs {
+			_, edgeData, err := key_mgmt_i.GetAccessEdge(assetManager.stub, startKeyID, targetKeyID)
+			if err != nil {
+				custom_err := &custom_errors.GetEdgeError{ParentNode: startKeyID, ChildNode: targetKeyID}
+				logger.Errorf("%v: %v", custom_err, err)
+				return nil, errors.Wrap(err, custom_err.Error())
+			}
+			expirationDate, ok := edgeData[global.EDGEDATA_EXPIRATION_DATE]
+			if !ok {
+				continue
+			}
+			if expiration, _ := strconv.ParseInt(expirationDate, 10, 64); expiration == 0 || expiration > now {
+				continue
+			}
+			err = key_mgmt_i.RevokeAccess(assetManager.stub, startKeyID, targetKeyID)
+			if err != nil {
+				logger.Errorf("Failed to revoke expired access from %v to %v: %v", startKeyID, targetKeyID, err)
+				return nil, errors.Wrapf(err, "Failed to revoke expired access from %v to %v", startKeyID, targetKeyID)
+			}
+			removedKeyIDs = append(removedKeyIDs, startKeyID)
+		}
+	}
+	return removedKeyIDs, nil
+}
+
 // CheckAccessToAsset documentation can be found in asset_mgmt_interfaces.go
 func (assetManager assetManagerImpl) CheckAccessToAsset(accessControl data_model.AccessControl) (bool, error) {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
@@ -726,6 +1629,7 @@ func (assetManager assetManagerImpl) GetAssetIter(
 	previousKey string,
 	limit int,
 	filterRule *simple_rule.Rule,
+	includeDeleted ...bool,
 ) (asset_manager.AssetIteratorInterface, error) {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 
@@ -767,36 +1671,107 @@ func (assetManager assetManagerImpl) GetAssetIter(
 		endKey = endKey + string(global.MAX_UNICODE_RUNE_VALUE)
 	}
 
-	logger.Debugf("GetAssetIter previousKey: %v", index.GetPrettyLedgerKey(previousKey))
-	logger.Debugf("GetAssetIter startKey: %v", index.GetPrettyLedgerKey(startKey))
-	logger.Debugf("GetAssetIter endKey: %v", index.GetPrettyLedgerKey(endKey))
+	logger.Debugf("GetAssetIter previousKey: %v", index.GetPrettyLedgerKey(previousKey))
+	logger.Debugf("GetAssetIter startKey: %v", index.GetPrettyLedgerKey(startKey))
+	logger.Debugf("GetAssetIter endKey: %v", index.GetPrettyLedgerKey(endKey))
+
+	// --------------------------------------------
+	// Query the index by range
+	// --------------------------------------------
+	// The iterator can be used to iterate over all keys between the startKey (inclusive) and endKey (exclusive).
+	iter, err := indexTable.GetRowsByRange(startKey, endKey)
+	if err != nil {
+		err = errors.Wrapf(err, "Failed to GetRowsByRange")
+		logger.Error(err)
+		return &assetIter{}, err
+	}
+
+	// --------------------------------------------
+	// Return an asset iterator
+	// --------------------------------------------
+	returnIter := assetIter{
+		LedgerIter:              iter,
+		IndexTable:              indexTable,
+		AssetManager:            assetManager,
+		AssetNamespace:          assetNamespace,
+		DecryptPrivateData:      decryptPrivateData,
+		ReturnPrivateAssetsOnly: returnPrivateAssetsOnly,
+		AssetKeyPath:            assetKeyPath,
+		PreviousLedgerKey:       previousKey,
+		Limit:                   limit,
+		FilterRule:              filterRule,
+		IncludeDeleted:          len(includeDeleted) > 0 && includeDeleted[0],
+		count:                   0}
+
+	if limit != -1 && limit <= 0 {
+		returnIter.Close()
+	}
+	return &returnIter, nil
+}
+
+// GetAssetsByDatatype documentation can be found in asset_mgmt_interfaces.go
+func (assetManager assetManagerImpl) GetAssetsByDatatype(
+	datatypeID string,
+	ownerID string,
+	decryptPrivateData bool,
+	returnPrivateAssetsOnly bool,
+	assetKeyPath interface{},
+	previousKey string,
+	limit int,
+	filterRule *simple_rule.Rule,
+	includeDeleted ...bool,
+) (asset_manager.AssetIteratorInterface, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("datatypeID: \"%v\", ownerID: \"%v\"", datatypeID, ownerID)
+
+	if utils.IsStringEmpty(datatypeID) || utils.IsStringEmpty(ownerID) {
+		logger.Error("datatypeID and ownerID are required")
+		return &assetIter{}, errors.New("datatypeID and ownerID are required")
+	}
 
-	// --------------------------------------------
-	// Query the index by range
-	// --------------------------------------------
-	// The iterator can be used to iterate over all keys between the startKey (inclusive) and endKey (exclusive).
-	iter, err := indexTable.GetRowsByRange(startKey, endKey)
+	// get the datatype and its descendants
+	datatypeIDs, err := getDatatypeAndDescendants(assetManager.stub, datatypeID)
 	if err != nil {
-		err = errors.Wrapf(err, "Failed to GetRowsByRange")
-		logger.Error(err)
 		return &assetIter{}, err
 	}
 
-	// --------------------------------------------
-	// Return an asset iterator
-	// --------------------------------------------
+	// create a range for each datatype, and sort the ranges so that paging by previousKey works
+	indexTable := getDatatypeAssetTable(assetManager.stub)
+	fieldNames := []string{"datatype_id", "owner_id", "row_id"}
+	ranges := [][]string{}
+	for _, id := range datatypeIDs {
+		startKey, err := indexTable.CreateRangeKey(fieldNames, []string{id, ownerID})
+		if err != nil {
+			err = errors.Wrapf(err, "Failed to create startKey")
+			logger.Error(err)
+			return &assetIter{}, err
+		}
+		endKey := startKey + string(rune(global.MAX_UNICODE_RUNE_VALUE))
+		if !utils.IsStringEmpty(previousKey) {
+			if previousKey >= endKey {
+				continue
+			} else if previousKey >= startKey {
+				// Append the first unicode character to previousKey so that we don't return that asset again
+				startKey = previousKey + string(rune(global.MIN_UNICODE_RUNE_VALUE))
+			}
+		}
+		ranges = append(ranges, []string{startKey, endKey})
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
 	returnIter := assetIter{
-		LedgerIter:              iter,
+		LedgerIter:              &rangesIter{table: indexTable, ranges: ranges},
 		IndexTable:              indexTable,
 		AssetManager:            assetManager,
-		AssetNamespace:          assetNamespace,
 		DecryptPrivateData:      decryptPrivateData,
 		ReturnPrivateAssetsOnly: returnPrivateAssetsOnly,
 		AssetKeyPath:            assetKeyPath,
 		PreviousLedgerKey:       previousKey,
 		Limit:                   limit,
 		FilterRule:              filterRule,
-		count:                   0}
+		IncludeDeleted:          len(includeDeleted) > 0 && includeDeleted[0],
+		count:                   0,
+		assetIdFunc:             getAssetIdFromDatatypeAssetRowId}
 
 	if limit != -1 && limit <= 0 {
 		returnIter.Close()
@@ -804,6 +1779,82 @@ func (assetManager assetManagerImpl) GetAssetIter(
 	return &returnIter, nil
 }
 
+// getDatatypeAndDescendants returns datatypeID followed by the IDs of all of its descendant datatypes.
+func getDatatypeAndDescendants(stub cached_stub.CachedStubInterface, datatypeID string) ([]string, error) {
+	datatypeIDs := []string{}
+	toVisit := []string{datatypeID}
+	for len(toVisit) > 0 {
+		id := toVisit[0]
+		toVisit = toVisit[1:]
+		if utils.InList(datatypeIDs, id) {
+			continue
+		}
+		datatype, err := datatype_i.GetDatatypeWithParams(stub, id)
+		if err != nil || utils.IsStringEmpty(datatype.GetDatatypeID()) {
+			custom_err := &custom_errors.GetDatatypeError{Datatype: id}
+			logger.Errorf("%v: %v", custom_err, err)
+			if err == nil {
+				return nil, errors.WithStack(custom_err)
+			}
+			return nil, errors.Wrap(err, custom_err.Error())
+		}
+		childIDs, err := datatype.GetChildDatatypes(stub)
+		if err != nil {
+			logger.Errorf("Failed to GetChildDatatypes: %v", err)
+			return nil, errors.Wrap(err, "Failed to GetChildDatatypes")
+		}
+		datatypeIDs = append(datatypeIDs, id)
+		toVisit = append(toVisit, childIDs...)
+	}
+	return datatypeIDs, nil
+}
+
+// ------------------------------------------------------
+// ----------------- rangesIter FUNCTIONS ---------------
+// ------------------------------------------------------
+
+// HasNext returns true if any of the remaining ranges has another row.
+func (rangesIter *rangesIter) HasNext() bool {
+	for {
+		if rangesIter.iter != nil {
+			if rangesIter.iter.HasNext() {
+				return true
+			}
+			rangesIter.iter.Close()
+			rangesIter.iter = nil
+		}
+		if len(rangesIter.ranges) == 0 {
+			return false
+		}
+		iter, err := rangesIter.table.GetRowsByRange(rangesIter.ranges[0][0], rangesIter.ranges[0][1])
+		rangesIter.ranges = rangesIter.ranges[1:]
+		if err != nil {
+			logger.Errorf("Failed to GetRowsByRange: %v", err)
+			return false
+		}
+		rangesIter.iter = iter
+	}
+}
+
+// Next returns the next row.
+func (rangesIter *rangesIter) Next() (*queryresult.KV, error) {
+	if !rangesIter.HasNext() {
+		return nil, errors.New("No more rows")
+	}
+	return rangesIter.iter.Next()
+}
+
+// Close closes the rangesIter.
+func (rangesIter *rangesIter) Close() error {
+	rangesIter.ranges = nil
+	if rangesIter.iter != nil {
+		err := rangesIter.iter.Close()
+		rangesIter.iter = nil
+		return err
+	}
+	return nil
+}
+
 // ------------------------------------------------------
 // ----------------- assetIter FUNCTIONS ----------------
 // ------------------------------------------------------
@@ -857,6 +1908,9 @@ func (assetIter *assetIter) getNext() (*data_model.Asset, error) {
 
 		// AssetId is the value of the primary key
 		assetId := GetAssetId(assetIter.AssetNamespace, row[assetIter.IndexTable.GetPrimaryKeyId()])
+		if assetIter.assetIdFunc != nil {
+			assetId = assetIter.assetIdFunc(row[assetIter.IndexTable.GetPrimaryKeyId()])
+		}
 
 		// Save the previous ledger key (used for paging)
 		assetIter.PreviousLedgerKey = KV.GetKey()
@@ -871,6 +1925,12 @@ func (assetIter *assetIter) getNext() (*data_model.Asset, error) {
 
 		logger.Debugf("got asset data encrypted; %v", assetData)
 
+		// skip soft deleted assets
+		if assetData.IsDeleted() && !assetIter.IncludeDeleted {
+			logger.Debugf("Skipping deleted asset %v", assetId)
+			continue
+		}
+
 		var assetKey data_model.Key
 		assetKey.ID = assetId
 		assetKey.Type = global.KEY_TYPE_SYM
@@ -898,6 +1958,14 @@ func (assetIter *assetIter) getNext() (*data_model.Asset, error) {
 			}
 		}
 
+		// private data is not decrypted if the read access policy does not allow it
+		if len(assetKey.KeyBytes) > 0 {
+			allowed, _ := checkAccessPolicy(assetIter.AssetManager.GetStub(), assetIter.AssetManager.GetCaller(), assetData, global.ACCESS_READ)
+			if !allowed {
+				assetKey = data_model.Key{}
+			}
+		}
+
 		// check if it's private asset or not
 		if assetIter.ReturnPrivateAssetsOnly {
 			if assetKey.ID != assetData.AssetKeyId || assetKey.IsEmpty() {
@@ -1106,10 +2174,17 @@ func updateCustomAssetIndices(stub cached_stub.CachedStubInterface, asset data_m
 	}
 
 	// Extract the indexed values from the asset
+	// Soft deleted assets keep their index rows, with the time of deletion as a tombstone
 	updatedIndexValues := make(map[string]string)
+	deletedAt := asset.Metadata[global.DELETED_AT_METADATA_KEY]
+	if len(deletedAt) > 0 || utils.InList(indexedFieldsList, global.INDEX_DELETED_AT_FIELD) {
+		updatedIndexValues[global.INDEX_DELETED_AT_FIELD] = deletedAt
+	}
 	for _, indexedField := range indexedFieldsList {
 		var err error = nil
-		if val, ok := publicDataMap[indexedField]; ok {
+		if indexedField == global.INDEX_DELETED_AT_FIELD {
+			continue
+		} else if val, ok := publicDataMap[indexedField]; ok {
 			updatedIndexValues[indexedField], err = utils.ConvertToString(val)
 		} else if val, ok := privateDataMap[indexedField]; ok {
 			updatedIndexValues[indexedField], err = utils.ConvertToString(val)
@@ -1258,8 +2333,17 @@ func putAssetByKey(stub cached_stub.CachedStubInterface, caller data_model.User,
 			logger.Errorf("Failed to put asset: %v", custom_err.Error())
 			return errors.New("Failed to put asset: " + custom_err.Error())
 		}
+
+		asset.Version = 1
 	} else {
 		// existing asset
+		// soft deleted asset must be restored before it can be updated
+		if existingAsset.IsDeleted() {
+			custom_err := &custom_errors.AssetDeletedError{AssetId: asset.AssetId}
+			logger.Errorf("Failed to put asset: %v", custom_err)
+			return errors.Wrap(custom_err, "Failed to put asset")
+		}
+
 		// you can't change owner unless you are the original owner
 		if !utils.EqualStringArrays(asset.OwnerIds, existingAsset.OwnerIds) && (asset.OwnerIds[0] != existingAsset.OwnerIds[0] || callerId != asset.OwnerIds[0]) {
 			logger.Error("Failed to put asset: Caller cannot change onwer of the asset")
@@ -1280,6 +2364,8 @@ func putAssetByKey(stub cached_stub.CachedStubInterface, caller data_model.User,
 			return errors.New("Failed to put asset: " + custom_err.Error())
 		}
 
+		asset.Version = existingAsset.Version + 1
+
 		// check if privatedate is encypted or not
 		existing_wrapped := data_model.GetEncryptedDataBytes(existingAsset.PrivateData)
 		if bytes.Equal(existing_wrapped, asset.PrivateData) {
@@ -1288,107 +2374,563 @@ func putAssetByKey(stub cached_stub.CachedStubInterface, caller data_model.User,
 		}
 	}
 
-	logger.Debugf("IsNewAsset=%v, IsStrictMode=%v, IsAdd=%v, encryptionRequired=%v", isNewAsset, isStrictMode, isAdd, encryptionRequired)
+	logger.Debugf("IsNewAsset=%v, IsStrictMode=%v, IsAdd=%v, encryptionRequired=%v", isNewAsset, isStrictMode, isAdd, encryptionRequired)
+
+	// assetKeyBytesRequired if encryption is reqyired
+	if encryptionRequired && len(assetKeyBytes) == 0 {
+		logger.Error("Failed to put asset: Asset key required for encryption")
+		return errors.New("Failed to put asset: Asset key required for encryption")
+	}
+
+	// Update custom indices
+	// this step need to be done before encrypting private data
+	err = updateCustomAssetIndices(stub, asset, isNewAsset, isPrivateDataEncrypted)
+	if err != nil {
+		logger.Errorf("Failed to put asset: Failed to update custom asset indices for assetId: %v", asset.AssetId)
+		return errors.Wrapf(err, "Failed to put asset: Failed to update custom asset indices for assetId: %v", asset.AssetId)
+	}
+
+	// keep decrypted private data for signing
+	var privateData []byte = nil
+	if encryptionRequired {
+		privateData = asset.PrivateData
+	} else if asset.GetSignerID() == callerId {
+		privateData, err = getPrivateData(stub, existingAsset, assetKeyBytes)
+		if err != nil || len(assetKeyBytes) == 0 {
+			logger.Errorf("Failed to put asset: Asset key required to sign the asset: %v", err)
+			return errors.New("Failed to put asset: Asset key required to sign the asset")
+		}
+	}
+
+	// normalize datatype
+	datatypes, err := datatype_i.NormalizeDatatypes(stub, asset.Datatypes)
+	if err != nil {
+		logger.Errorf("Failed to put asset: Failed to NormalizeDatatypes: %v", err)
+		return errors.Wrap(err, "Failed to put asset: Failed to NormalizeDatatypes")
+	}
+	asset.Datatypes = datatypes
+
+	// set the version of each datatype that the asset data conforms to
+	err = setDatatypeVersions(stub, &asset, existingAsset, isNewAsset)
+	if err != nil {
+		logger.Errorf("Failed to put asset: Failed to set datatype versions: %v", err)
+		return errors.Wrap(err, "Failed to put asset: Failed to set datatype versions")
+	}
+
+	// validate asset data against datatype schemas
+	err = validateAssetData(stub, asset, privateData, existingAsset, assetKeyBytes)
+	if err != nil {
+		logger.Errorf("Failed to put asset: %v", err)
+		return errors.Wrap(err, "Failed to put asset")
+	}
+
+	// encrypt private data fields with field keys
+	if !asset.IsFieldEncrypted() {
+		asset.EncryptedFields = nil
+	} else if encryptionRequired {
+		connectionID := asset.GetDatastoreConnectionID()
+		if utils.IsStringEmpty(connectionID) && !utils.IsStringEmpty(defaultDatastoreConnectionID) {
+			connectionID = defaultDatastoreConnectionID
+		}
+		if !utils.IsStringEmpty(connectionID) {
+			logger.Error("Failed to put asset: Field-level encryption is not supported for off-chain private data")
+			return errors.New("Failed to put asset: Field-level encryption is not supported for off-chain private data")
+		}
+		err = encryptAssetFields(stub, &asset, privateData, assetKey)
+		if err != nil {
+			logger.Errorf("Failed to put asset: Failed to encrypt private data fields: %v", err)
+			return errors.Wrap(err, "Failed to put asset: Failed to encrypt private data fields")
+		}
+	} else {
+		asset.EncryptedFields = existingAsset.EncryptedFields
+	}
+
+	// encrypt private data
+	if encryptionRequired && len(asset.PrivateData) > 0 {
+		// Encrypt PrivateData with asset sym key
+		privateData, err := crypto.EncryptWithSymKey(assetKeyBytes, asset.PrivateData)
+		if err != nil {
+			custom_err := &custom_errors.EncryptionError{ToEncrypt: "PrivateData", EncryptionKey: assetKeyId}
+			logger.Errorf("Failed to put asset: %v: %v", custom_err, err)
+			return errors.Wrap(err, "Failed to put asset: "+custom_err.Error())
+		}
+		if privateData == nil {
+			custom_err := &custom_errors.EncryptionError{ToEncrypt: "PrivateData", EncryptionKey: assetKeyId}
+			logger.Errorf("Failed to put asset: %v", custom_err)
+			return errors.New("Failed to put asset: " + custom_err.Error())
+		}
+		asset.PrivateData = privateData
+	}
+
+	// sign the asset if requested
+	err = signAsset(caller, &asset, privateData)
+	if err != nil {
+		logger.Errorf("Failed to put asset: Failed to sign asset: %v", err)
+		return errors.Wrap(err, "Failed to put asset: Failed to sign asset")
+	}
+
+	// update datatypes
+	if isNewAsset || !utils.EqualStringArrays(asset.Datatypes, existingAsset.Datatypes) {
+		// upate datatypeasset.Datatypes)
+		err = updateAssetToDatatype(stub, caller, asset.AssetId, assetKey, asset.OwnerIds[0], existingAsset.Datatypes, asset.Datatypes)
+		if err != nil {
+			logger.Errorf("Failed to put asset: Failed to updateAssetToDatatype: %v", err)
+			return errors.Wrap(err, "Failed to put asset: Failed to UpdateAssetToDatatype")
+		}
+	}
+
+	// update the index of assets by datatype and owner
+	err = updateDatatypeAssetIndex(stub, asset.AssetId, existingAsset.Datatypes, existingAsset.OwnerIds, asset.Datatypes, asset.OwnerIds)
+	if err != nil {
+		logger.Errorf("Failed to put asset: Failed to update datatype asset index: %v", err)
+		return errors.Wrap(err, "Failed to put asset: Failed to update datatype asset index")
+	}
+
+	// If yourKey was provided, give access from yourKey -> assetKey
+	if len(yourKeyId) > 0 && len(yourKey) > 0 && len(yourEncKey) > 0 {
+		var edgeData = make(map[string]string)
+		edgeData["asset_type"] = "yes"
+		edgeData[global.EDGEDATA_ACCESS_TYPE] = global.ACCESS_WRITE
+		err := key_mgmt_i.AddAccessWithKeys(stub, yourKey, yourKeyId, assetKeyBytes, assetKeyId, yourEncKey, edgeData)
+		if err != nil {
+			custom_err := &custom_errors.AddAccessError{Key: "assetKey"}
+			logger.Errorf("Failed to put asset: %v: %v", custom_err, err)
+			return errors.Wrap(err, "Failed to put asset: "+custom_err.Error())
+		}
+	}
+
+	// Check if we need to store private data to datastore
+	connectionID := asset.GetDatastoreConnectionID()
+	if utils.IsStringEmpty(connectionID) && !utils.IsStringEmpty(defaultDatastoreConnectionID) {
+		connectionID = defaultDatastoreConnectionID
+	}
+	if !utils.IsStringEmpty(connectionID) && encryptionRequired && len(asset.PrivateData) > 0 {
+		myDatastore, err := datastore_c.GetDatastoreImpl(stub, connectionID)
+		if err != nil {
+			logger.Infof("Failed to instantiate datastore: %v", err)
+			return errors.Wrap(err, "Failed to instantitate datastore")
+		}
+		// save to the datastore
+		dataKey, err := myDatastore.Put(stub, asset.PrivateData)
+		if err != nil {
+			logger.Errorf("Failed to save data to datastore: %v", err)
+			return errors.Wrap(err, "Failed to save data to datastore")
+		}
+		// set privatedata to the hash of the encrypted data
+		asset.PrivateData = []byte(dataKey)
+	}
+	// Now save to the ledger
+	assetBytesE, err := json.Marshal(&asset)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "encrypted asset data"}
+		logger.Errorf("Failed to put asset: %v: %v", custom_err, err)
+		return errors.Wrap(err, "Failed to put asset: "+custom_err.Error())
+	}
+	assetLedgerKey := asset.AssetId
+	err = stub.PutState(assetLedgerKey, assetBytesE)
+	if err != nil {
+		custom_err := &custom_errors.PutLedgerError{LedgerKey: assetLedgerKey}
+		logger.Errorf("Failed to put asset: %v: %v", custom_err, err)
+		return errors.Wrap(err, "Failed to put asset: "+custom_err.Error())
+	}
+
+	logger.Infof("Successfully put asset \"%v\" with key \"%v\"", asset.AssetId, asset.AssetKeyId)
+	return nil
+}
+
+// setDatatypeVersions sets the version of each of the asset's datatypes in the asset's metadata, if it is not set.
+// Versions of the existing asset are kept. New datatypes are set to their current version. Datatypes of an existing asset
+// that don't have a version were added before datatype versions, so they are left unset, which means version 1.
+func setDatatypeVersions(stub cached_stub.CachedStubInterface, asset *data_model.Asset, existingAsset data_model.Asset, isNewAsset bool) error {
+	if asset.Metadata == nil {
+		asset.Metadata = make(map[string]string)
+	}
+	for key := range asset.Metadata {
+		if strings.HasPrefix(key, global.DATATYPE_VERSION_METADATA_PREFIX) && !utils.InList(asset.Datatypes, strings.TrimPrefix(key, global.DATATYPE_VERSION_METADATA_PREFIX)) {
+			delete(asset.Metadata, key)
+		}
+	}
+	for _, datatypeID := range asset.Datatypes {
+		versionKey := global.DATATYPE_VERSION_METADATA_PREFIX + datatypeID
+		if _, ok := asset.Metadata[versionKey]; ok {
+			continue
+		}
+		if version, ok := existingAsset.Metadata[versionKey]; ok {
+			asset.Metadata[versionKey] = version
+			continue
+		}
+		if !isNewAsset && utils.InList(existingAsset.Datatypes, datatypeID) {
+			continue
+		}
+		datatype, err := datatype_i.GetDatatypeWithParams(stub, datatypeID)
+		if err != nil {
+			custom_err := &custom_errors.GetDatatypeError{Datatype: datatypeID}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+		asset.SetDatatypeVersion(datatypeID, datatype.GetVersion())
+	}
+	return nil
+}
+
+// validateAssetData validates the asset's public data and decrypted private data against the schema
+// of each of the asset's datatypes, at the datatype version recorded in the asset's metadata. privateData is the decrypted private data if it is being changed; otherwise
+// the existing private data is decrypted with assetKeyBytes if any datatype has a schema.
+func validateAssetData(stub cached_stub.CachedStubInterface, asset data_model.Asset, privateData []byte, existingAsset data_model.Asset, assetKeyBytes []byte) error {
+	existingPrivateDataDecrypted := false
+	for _, datatypeID := range asset.Datatypes {
+		datatype, err := datatype_i.GetDatatypeWithParams(stub, datatypeID)
+		if err != nil {
+			custom_err := &custom_errors.GetDatatypeError{Datatype: datatypeID}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+		datatypeVersion := asset.GetDatatypeVersion(datatypeID)
+		if datatype.GetSchemaVersionOf(datatypeVersion) == 0 {
+			continue
+		}
+
+		if privateData == nil && len(existingAsset.PrivateData) > 0 && !existingPrivateDataDecrypted {
+			privateData, err = getPrivateData(stub, existingAsset, assetKeyBytes)
+			if err != nil || len(assetKeyBytes) == 0 {
+				logger.Errorf("Asset key required to validate private data against the schema of datatype %v: %v", datatypeID, err)
+				return errors.Errorf("Asset key required to validate private data against the schema of datatype %v", datatypeID)
+			}
+			existingPrivateDataDecrypted = true
+		}
+
+		err = datatype.ValidateAssetDataOfVersion(stub, datatypeVersion, asset.PublicData, privateData)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getFieldKey returns the key of a private data field of a field encrypted asset, derived from the asset key.
+func getFieldKey(assetId string, assetKey data_model.Key, fieldName string) data_model.Key {
+	fieldKeyId := key_mgmt_i.GetKeyIdForFieldAccess(assetId, assetKey.ID, fieldName)
+	return data_model.Key{ID: fieldKeyId, KeyBytes: crypto.DeriveSymKey(assetKey.KeyBytes, fieldKeyId), Type: global.KEY_TYPE_SYM}
+}
+
+// encryptAssetFields sets asset.EncryptedFields by encrypting each top-level field of privateData with its
+// field key, and gives the asset key access to the field keys.
+// privateData is the decrypted private data of the asset, and it must be a JSON object.
+func encryptAssetFields(stub cached_stub.CachedStubInterface, asset *data_model.Asset, privateData []byte, assetKey data_model.Key) error {
+	fields := make(map[string]json.RawMessage)
+	if len(privateData) > 0 {
+		err := json.Unmarshal(privateData, &fields)
+		if err != nil {
+			custom_err := &custom_errors.UnmarshalError{Type: "asset.PrivateData"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+	}
+
+	asset.EncryptedFields = make(map[string][]byte)
+	for fieldName, value := range fields {
+		fieldKey := getFieldKey(asset.AssetId, assetKey, fieldName)
+		encryptedValue, err := crypto.EncryptWithSymKey(fieldKey.KeyBytes, value)
+		if err != nil || encryptedValue == nil {
+			custom_err := &custom_errors.EncryptionError{ToEncrypt: fieldName, EncryptionKey: fieldKey.ID}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.WithStack(custom_err)
+		}
+		asset.EncryptedFields[fieldName] = encryptedValue
+
+		err = key_mgmt_i.AddAccess(stub, assetKey, fieldKey)
+		if err != nil {
+			custom_err := &custom_errors.AddAccessError{Key: fieldKey.ID}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+	}
+	return nil
+}
+
+// decryptAssetFields returns the private data fields of a field encrypted asset that the caller has
+// access to as a JSON object. Returns nil if the caller does not have access to any field.
+func decryptAssetFields(stub cached_stub.CachedStubInterface, caller data_model.User, asset data_model.Asset) []byte {
+	callerKey := caller.GetPrivateKey()
+	if callerKey.IsEmpty() {
+		return nil
+	}
+
+	// a deny entry for the asset key also denies access to its fields
+	denied, err := IsUserDeniedAccessToKey(stub, caller.ID, asset.AssetKeyId)
+	if err != nil || denied {
+		logger.Debugf("Caller %v is denied access to the fields of asset %v: %v", caller.ID, asset.AssetId, err)
+		return nil
+	}
+
+	fields := make(map[string]json.RawMessage)
+	for fieldName, encryptedValue := range asset.EncryptedFields {
+		fieldKeyId := key_mgmt_i.GetKeyIdForFieldAccess(asset.AssetId, asset.AssetKeyId, fieldName)
+		keyPath, err := key_mgmt_i.SlowVerifyAccess(stub, callerKey.ID, fieldKeyId)
+		if err != nil || len(keyPath) == 0 {
+			logger.Debugf("Caller %v does not have access to field %v of asset %v", caller.ID, fieldName, asset.AssetId)
+			continue
+		}
+		if inEffect, _ := isKeyPathInEffect(stub, keyPath); !inEffect {
+			logger.Debugf("Caller %v's access to field %v of asset %v is not in effect", caller.ID, fieldName, asset.AssetId)
+			continue
+		}
+		fieldKeyBytes, err := key_mgmt_i.GetKey(stub, keyPath, callerKey.KeyBytes)
+		if err != nil || fieldKeyBytes == nil {
+			logger.Debugf("Failed to get key of field %v of asset %v: %v", fieldName, asset.AssetId, err)
+			continue
+		}
+		value, err := crypto.DecryptWithSymKey(fieldKeyBytes, encryptedValue)
+		if err != nil {
+			logger.Debugf("Failed to decrypt field %v of asset %v: %v", fieldName, asset.AssetId, err)
+			continue
+		}
+		fields[fieldName] = value
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	fieldsBytes, _ := json.Marshal(&fields)
+	return fieldsBytes
+}
+
+// signAsset signs the asset with the caller's private key if the caller is the asset's signer.
+// Signatures of other signers are removed, since they are no longer valid for the updated asset.
+// privateData is the decrypted private data of the asset.
+func signAsset(caller data_model.User, asset *data_model.Asset, privateData []byte) error {
+	delete(asset.Metadata, global.SIGNATURE_METADATA_KEY)
+	signerId := asset.GetSignerID()
+	if len(signerId) == 0 {
+		return nil
+	}
+	if signerId != caller.ID {
+		logger.Debugf("Removing signature of %v from asset %v", signerId, asset.AssetId)
+		delete(asset.Metadata, global.SIGNER_ID_METADATA_KEY)
+		return nil
+	}
 
-	// assetKeyBytesRequired if encryption is reqyired
-	if encryptionRequired && len(assetKeyBytes) == 0 {
-		logger.Error("Failed to put asset: Asset key required for encryption")
-		return errors.New("Failed to put asset: Asset key required for encryption")
+	privateKey, err := crypto.ParseAnyPrivateKeyB64(caller.PrivateKeyB64)
+	if err != nil || privateKey == nil {
+		custom_err := &custom_errors.InvalidPrivateKeyError{}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.WithStack(custom_err)
+	}
+	signedAsset := asset.Copy()
+	signedAsset.PrivateData = privateData
+	signature, err := crypto.SignWithAnyPrivateKey(privateKey, signedAsset.GetSignedBytes())
+	if err != nil {
+		logger.Errorf("Failed to sign asset %v: %v", asset.AssetId, err)
+		return errors.Wrapf(err, "Failed to sign asset %v", asset.AssetId)
 	}
+	asset.Metadata[global.SIGNATURE_METADATA_KEY] = crypto.EncodeToB64String(signature)
+	return nil
+}
 
-	// Update custom indices
-	// this step need to be done before encrypting private data
-	err = updateCustomAssetIndices(stub, asset, isNewAsset, isPrivateDataEncrypted)
+// VerifyAssetSignature checks that the asset was signed by its signer.
+// The asset must contain decrypted PrivateData.
+// The signer's current public key is used, so signatures made before the signer's keys were rotated are invalid.
+func VerifyAssetSignature(stub cached_stub.CachedStubInterface, asset data_model.Asset) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	signerId := asset.GetSignerID()
+	signature := asset.GetSignature()
+	if len(signerId) == 0 || len(signature) == 0 {
+		custom_err := &custom_errors.InvalidSignatureError{AssetId: asset.AssetId}
+		logger.Errorf("%v: Asset is not signed", custom_err)
+		return errors.WithStack(custom_err)
+	}
+	if data_model.IsEncryptedData(asset.PrivateData) {
+		logger.Errorf("Private data of asset %v must be decrypted to verify its signature", asset.AssetId)
+		return errors.Errorf("Private data of asset %v must be decrypted to verify its signature", asset.AssetId)
+	}
+	signerPublicKey, err := getUserPublicKey(stub, signerId)
 	if err != nil {
-		logger.Errorf("Failed to put asset: Failed to update custom asset indices for assetId: %v", asset.AssetId)
-		return errors.Wrapf(err, "Failed to put asset: Failed to update custom asset indices for assetId: %v", asset.AssetId)
+		logger.Errorf("Failed to get public key of signer %v: %v", signerId, err)
+		return errors.Wrapf(err, "Failed to get public key of signer %v", signerId)
+	}
+	publicKey, err := crypto.ParseAnyPublicKey(signerPublicKey.KeyBytes)
+	if err != nil {
+		custom_err := &custom_errors.InvalidPublicKeyError{}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.WithStack(custom_err)
+	}
+	if !crypto.VerifyWithAnyPublicKey(publicKey, asset.GetSignedBytes(), signature) {
+		custom_err := &custom_errors.InvalidSignatureError{AssetId: asset.AssetId}
+		logger.Errorf("%v", custom_err)
+		return errors.WithStack(custom_err)
 	}
+	return nil
+}
 
-	// encrypt private data
-	if encryptionRequired && len(asset.PrivateData) > 0 {
-		// Encrypt PrivateData with asset sym key
-		privateData, err := crypto.EncryptWithSymKey(assetKeyBytes, asset.PrivateData)
+// IsEdgeInEffect returns true if the NotBefore, ExpirationDate, and ValidityWindows saved in the edge data of a
+// key graph edge, by AddAccessToAsset or for a consent, allow access at the transaction time.
+// An edge without them is always in effect.
+func IsEdgeInEffect(stub cached_stub.CachedStubInterface, edgeData map[string]string) bool {
+	notBefore := int64(0)
+	expirationDate := int64(0)
+	windows := []global.TimeWindow{}
+	if value, ok := edgeData[global.EDGEDATA_NOT_BEFORE]; ok {
+		notBefore, _ = strconv.ParseInt(value, 10, 64)
+	}
+	if value, ok := edgeData[global.EDGEDATA_EXPIRATION_DATE]; ok {
+		expirationDate, _ = strconv.ParseInt(value, 10, 64)
+	}
+	if value, ok := edgeData[global.EDGEDATA_VALIDITY_WINDOWS]; ok {
+		err := json.Unmarshal([]byte(value), &windows)
 		if err != nil {
-			custom_err := &custom_errors.EncryptionError{ToEncrypt: "PrivateData", EncryptionKey: assetKeyId}
-			logger.Errorf("Failed to put asset: %v: %v", custom_err, err)
-			return errors.Wrap(err, "Failed to put asset: "+custom_err.Error())
-		}
-		if privateData == nil {
-			custom_err := &custom_errors.EncryptionError{ToEncrypt: "PrivateData", EncryptionKey: assetKeyId}
-			logger.Errorf("Failed to put asset: %v", custom_err)
-			return errors.New("Failed to put asset: " + custom_err.Error())
+			logger.Errorf("Invalid validity windows: %v", err)
+			return false
 		}
-		asset.PrivateData = privateData
+	}
+	if notBefore == 0 && expirationDate == 0 && len(windows) == 0 {
+		return true
 	}
 
-	// normalize datatype
-	datatypes, err := datatype_i.NormalizeDatatypes(stub, asset.Datatypes)
+	txTimestamp, err := stub.GetTxTimestamp()
 	if err != nil {
-		logger.Errorf("Failed to put asset: Failed to NormalizeDatatypes: %v", err)
-		return errors.Wrap(err, "Failed to put asset: Failed to NormalizeDatatypes")
+		logger.Errorf("Failed to get tx timestamp: %v", err)
+		return false
 	}
-	asset.Datatypes = datatypes
+	return global.IsInEffect(txTimestamp.GetSeconds(), notBefore, expirationDate, windows)
+}
 
-	// update datatypes
-	if isNewAsset || !utils.EqualStringArrays(asset.Datatypes, existingAsset.Datatypes) {
-		// upate datatypeasset.Datatypes)
-		err = updateAssetToDatatype(stub, caller, asset.AssetId, assetKey, asset.OwnerIds[0], existingAsset.Datatypes, asset.Datatypes)
+// isKeyPathInEffect returns true if every edge of keyPath is in effect at the transaction time.
+func isKeyPathInEffect(stub cached_stub.CachedStubInterface, keyPath []string) (bool, error) {
+	for i := 0; i < len(keyPath)-1; i++ {
+		if keyPath[i] == keyPath[i+1] {
+			continue
+		}
+		_, edgeData, err := key_mgmt_i.GetAccessEdge(stub, keyPath[i], keyPath[i+1])
 		if err != nil {
-			logger.Errorf("Failed to put asset: Failed to updateAssetToDatatype: %v", err)
-			return errors.Wrap(err, "Failed to put asset: Failed to UpdateAssetToDatatype")
+			custom_err := &custom_errors.GetEdgeError{ParentNode: keyPath[i], ChildNode: keyPath[i+1]}
+			logger.Errorf("%v: %v", custom_err, err)
+			return false, errors.Wrap(err, custom_err.Error())
+		}
+		if !IsEdgeInEffect(stub, edgeData) {
+			logger.Debugf("Edge from %v to %v is not in effect", keyPath[i], keyPath[i+1])
+			return false, nil
 		}
 	}
+	return true, nil
+}
 
-	// If yourKey was provided, give access from yourKey -> assetKey
-	if len(yourKeyId) > 0 && len(yourKey) > 0 && len(yourEncKey) > 0 {
-		var edgeData = make(map[string]string)
-		edgeData["asset_type"] = "yes"
-		edgeData[global.EDGEDATA_ACCESS_TYPE] = global.ACCESS_WRITE
-		err := key_mgmt_i.AddAccessWithKeys(stub, yourKey, yourKeyId, assetKeyBytes, assetKeyId, yourEncKey, edgeData)
-		if err != nil {
-			custom_err := &custom_errors.AddAccessError{Key: "assetKey"}
-			logger.Errorf("Failed to put asset: %v: %v", custom_err, err)
-			return errors.Wrap(err, "Failed to put asset: "+custom_err.Error())
-		}
+// getWriteOnlyAccessGrantorIDs returns the IDs of the users who may have added write only access to the asset:
+// the grantors recorded in the write only access graph, and the asset's owners.
+func getWriteOnlyAccessGrantorIDs(stub cached_stub.CachedStubInterface, asset data_model.Asset) ([]string, error) {
+	grantorIDs, err := graph.GetDirectChildren(stub, global.WRITE_ONLY_ACCESS_GRAPH, asset.AssetKeyId)
+	if err != nil {
+		logger.Errorf("Failed to get write only access grantors of asset %v: %v", asset.AssetId, err)
+		return nil, errors.Wrapf(err, "Failed to get write only access grantors of asset %v", asset.AssetId)
 	}
+	return utils.GetSetFromList(append(append([]string{}, asset.OwnerIds...), grantorIDs...)), nil
+}
 
-	// Check if we need to store private data to datastore
-	connectionID := asset.GetDatastoreConnectionID()
-	if utils.IsStringEmpty(connectionID) && !utils.IsStringEmpty(defaultDatastoreConnectionID) {
-		connectionID = defaultDatastoreConnectionID
+// IsUserDeniedAccessToKey returns true if the user or group with the given userID, or any group it's a direct or
+// indirect member of, has a deny entry for the key with the given keyID.
+func IsUserDeniedAccessToKey(stub cached_stub.CachedStubInterface, userID string, keyID string) (bool, error) {
+	if len(userID) == 0 || len(keyID) == 0 {
+		return false, nil
 	}
-	if !utils.IsStringEmpty(connectionID) && encryptionRequired && len(asset.PrivateData) > 0 {
-		myDatastore, err := datastore_c.GetDatastoreImpl(stub, connectionID)
-		if err != nil {
-			logger.Infof("Failed to instantiate datastore: %v", err)
-			return errors.Wrap(err, "Failed to instantitate datastore")
+	deniedIDs, err := graph.GetDirectChildren(stub, global.ACCESS_DENY_GRAPH, keyID)
+	if err != nil {
+		logger.Errorf("Failed to get deny entries of key %v: %v", keyID, err)
+		return false, errors.Wrapf(err, "Failed to get deny entries of key %v", keyID)
+	}
+	if len(deniedIDs) == 0 {
+		return false, nil
+	}
+	if utils.InList(deniedIDs, userID) {
+		logger.Debugf("User \"%v\" is denied access to key %v", userID, keyID)
+		return true, nil
+	}
+	groupIDs, err := graph.SlowGetParents(stub, global.USER_GRAPH, userID)
+	if err != nil {
+		logger.Errorf("Failed to get groups of \"%v\": %v", userID, err)
+		return false, errors.Wrapf(err, "Failed to get groups of \"%v\"", userID)
+	}
+	for _, groupID := range groupIDs {
+		if utils.InList(deniedIDs, groupID) {
+			logger.Debugf("Group \"%v\" of \"%v\" is denied access to key %v", groupID, userID, keyID)
+			return true, nil
 		}
-		// save to the datastore
-		dataKey, err := myDatastore.Put(stub, asset.PrivateData)
-		if err != nil {
-			logger.Errorf("Failed to save data to datastore: %v", err)
-			return errors.Wrap(err, "Failed to save data to datastore")
+	}
+	return false, nil
+}
+
+// checkAccessPolicy returns true if the access policy of the asset's namespace, if any, allows user the given access.
+// System admins are not restricted by access policies.
+func checkAccessPolicy(stub cached_stub.CachedStubInterface, user data_model.User, asset data_model.Asset, access string) (bool, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("user: %v, asset: %v, access: %v", user.ID, asset.AssetId, access)
+
+	if len(asset.IndexTableName) == 0 {
+		return true, nil
+	}
+	policy, err := abac_i.GetAccessPolicyWithParams(stub, asset.IndexTableName)
+	if err != nil {
+		logger.Errorf("Failed to get access policy of namespace %v: %v", asset.IndexTableName, err)
+		return false, errors.Wrapf(err, "Failed to get access policy of namespace %v", asset.IndexTableName)
+	}
+	ruleExpr := policy.GetRule(access)
+	if len(ruleExpr) == 0 {
+		return true, nil
+	}
+
+	// load public data of a user given by ID only
+	if len(user.Role) == 0 {
+		userAsset, err := getAssetByKey(stub, user_mgmt_c.GetUserAssetID(user.ID), nil)
+		if err == nil && userAsset != nil && len(userAsset.AssetId) > 0 {
+			user.LoadFromAsset(userAsset)
 		}
-		// set privatedata to the hash of the encrypted data
-		asset.PrivateData = []byte(dataKey)
 	}
-	// Now save to the ledger
-	assetBytesE, err := json.Marshal(&asset)
+	if user.IsSystemAdmin() {
+		return true, nil
+	}
+
+	groupIDs, err := graph.SlowGetParents(stub, global.USER_GRAPH, user.ID)
 	if err != nil {
-		custom_err := &custom_errors.MarshalError{Type: "encrypted asset data"}
-		logger.Errorf("Failed to put asset: %v: %v", custom_err, err)
-		return errors.Wrap(err, "Failed to put asset: "+custom_err.Error())
+		logger.Errorf("Failed to get groups of \"%v\": %v", user.ID, err)
+		return false, errors.Wrapf(err, "Failed to get groups of \"%v\"", user.ID)
+	}
+	assetContext := map[string]interface{}{
+		"asset_id":  asset.AssetId,
+		"datatypes": asset.Datatypes,
+		"owner_ids": asset.OwnerIds,
+		"metadata":  asset.Metadata,
+	}
+	if len(asset.PublicData) > 0 && json.Valid(asset.PublicData) {
+		assetContext["public_data"] = json.RawMessage(asset.PublicData)
+	}
+	policyContext := map[string]interface{}{
+		"caller": map[string]interface{}{
+			"id":                   user.ID,
+			"role":                 user.Role,
+			"is_group":             user.IsGroup,
+			"groups":               groupIDs,
+			"solution_public_data": user.SolutionPublicData,
+		},
+		"asset":  assetContext,
+		"access": access,
+	}
+
+	// convert the context to JSON so that numbers are evaluated as float64 values
+	policyContextBytes, err := json.Marshal(policyContext)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "access policy context"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return false, errors.Wrap(err, custom_err.Error())
 	}
-	assetLedgerKey := asset.AssetId
-	err = stub.PutState(assetLedgerKey, assetBytesE)
+	rule := simple_rule.NewRule(ruleExpr)
+	result, err := rule.Apply(string(policyContextBytes))
 	if err != nil {
-		custom_err := &custom_errors.PutLedgerError{LedgerKey: assetLedgerKey}
-		logger.Errorf("Failed to put asset: %v: %v", custom_err, err)
-		return errors.Wrap(err, "Failed to put asset: "+custom_err.Error())
+		logger.Errorf("Failed to evaluate access policy of namespace %v: %v", asset.IndexTableName, err)
+		return false, errors.Wrapf(err, "Failed to evaluate access policy of namespace %v", asset.IndexTableName)
 	}
-
-	logger.Infof("Successfully put asset \"%v\" with key \"%v\"", asset.AssetId, asset.AssetKeyId)
-	return nil
+	if result["$result"] != simple_rule.D(true) {
+		logger.Debugf("Access policy of namespace %v does not allow %v access to %v", asset.IndexTableName, access, user.ID)
+		return false, nil
+	}
+	return true, nil
 }
 
 // hasUserWriteAccessToAsset returns user with write access or write only access.
@@ -1397,6 +2939,18 @@ func hasUserWriteAccessToAsset(stub cached_stub.CachedStubInterface, user data_m
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 	logger.Debugf("user: %v, asset:%v,  %v, %v", user.ID, asset.AssetKeyId, hasUserPrivKey, checkMyGroups)
 
+	// deny entries and the access policy are checked only at the top level
+	if checkMyGroups {
+		denied, err := IsUserDeniedAccessToKey(stub, user.ID, asset.AssetKeyId)
+		if err != nil || denied {
+			return false, err
+		}
+		allowed, err := checkAccessPolicy(stub, user, asset, global.ACCESS_WRITE)
+		if err != nil || !allowed {
+			return false, err
+		}
+	}
+
 	// check cache
 	cachekey := fmt.Sprintf("writeaccess-%v-%v-%v", user.ID, asset.AssetId, hasUserPrivKey)
 	cache, err := stub.GetCache(cachekey)
@@ -1440,7 +2994,7 @@ func hasUserWriteAccessToAsset(stub cached_stub.CachedStubInterface, user data_m
 	// check this by edge data with write access
 	if hasUserPrivKey {
 		_, edgeData, _ := key_mgmt_i.GetAccessEdge(stub, user.GetPubPrivKeyId(), asset.AssetKeyId)
-		if val, ok := edgeData["AccessType"]; ok {
+		if val, ok := edgeData["AccessType"]; ok && IsEdgeInEffect(stub, edgeData) {
 			if val == global.ACCESS_WRITE {
 				//add to cache
 				stub.PutCache(cachekey, true)
@@ -1449,7 +3003,7 @@ func hasUserWriteAccessToAsset(stub cached_stub.CachedStubInterface, user data_m
 		}
 	}
 	_, edgeData, _ := key_mgmt_i.GetAccessEdge(stub, user.GetSymKeyId(), asset.AssetKeyId)
-	if val, ok := edgeData["AccessType"]; ok {
+	if val, ok := edgeData["AccessType"]; ok && IsEdgeInEffect(stub, edgeData) {
 		if val == global.ACCESS_WRITE {
 			//add to cache
 			stub.PutCache(cachekey, true)
@@ -1471,7 +3025,7 @@ func hasUserWriteAccessToAsset(stub cached_stub.CachedStubInterface, user data_m
 
 			consentID := consent_mgmt_c.GetConsentID(datatypeID, user.ID, asset.OwnerIds[0])
 			_, edgeData, err = key_mgmt_i.GetAccessEdge(stub, consentID, datatype_i.GetDatatypeKeyID(datatypeID, asset.OwnerIds[0]))
-			if val, ok := edgeData["AccessType"]; ok {
+			if val, ok := edgeData["AccessType"]; ok && IsEdgeInEffect(stub, edgeData) {
 				if val == global.ACCESS_WRITE {
 					//add to cache
 					stub.PutCache(cachekey, true)
@@ -1484,7 +3038,7 @@ func hasUserWriteAccessToAsset(stub cached_stub.CachedStubInterface, user data_m
 				currID := parent
 				consentID := consent_mgmt_c.GetConsentID(currID, user.ID, asset.OwnerIds[0])
 				_, edgeData, err = key_mgmt_i.GetAccessEdge(stub, consentID, datatype_i.GetDatatypeKeyID(datatypeID, asset.OwnerIds[0]))
-				if val, ok := edgeData["AccessType"]; ok {
+				if val, ok := edgeData["AccessType"]; ok && IsEdgeInEffect(stub, edgeData) {
 					if val == global.ACCESS_WRITE {
 						//add to cache
 						stub.PutCache(cachekey, true)
@@ -1523,6 +3077,17 @@ func hasUserWriteAccessToAsset(stub cached_stub.CachedStubInterface, user data_m
 
 // hasUserWriteOnlyAccessToAsset returns user with write only access.
 func hasUserWriteOnlyAccessToAsset(stub cached_stub.CachedStubInterface, user data_model.User, asset data_model.Asset, hasUserPrivKey, checkMyGroups bool) (bool, error) {
+	// deny entries and the access policy are checked only at the top level
+	if checkMyGroups {
+		denied, err := IsUserDeniedAccessToKey(stub, user.ID, asset.AssetKeyId)
+		if err != nil || denied {
+			return false, err
+		}
+		allowed, err := checkAccessPolicy(stub, user, asset, global.ACCESS_WRITE)
+		if err != nil || !allowed {
+			return false, err
+		}
+	}
 
 	if hasUserPrivKey {
 		// 1. user has write only permission
@@ -1530,7 +3095,7 @@ func hasUserWriteOnlyAccessToAsset(stub cached_stub.CachedStubInterface, user da
 		if hasUserPrivKey && len(asset.OwnerIds) > 0 {
 			keyId := key_mgmt_i.GetKeyIdForWriteOnlyAccess(asset.AssetId, asset.AssetKeyId, asset.OwnerIds[0])
 			_, edgeData, _ := key_mgmt_i.GetAccessEdge(stub, user.GetPubPrivKeyId(), keyId)
-			if val, ok := edgeData["AccessType"]; ok {
+			if val, ok := edgeData["AccessType"]; ok && IsEdgeInEffect(stub, edgeData) {
 				if val == global.ACCESS_WRITE_ONLY {
 					return true, nil
 				}
@@ -1561,6 +3126,18 @@ func hasUserReadAccessToAsset(stub cached_stub.CachedStubInterface, user data_mo
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 	logger.Debugf("user: %v, asset:%v,  %v, %v", user.ID, asset.AssetKeyId, hasUserPrivKey, checkMyGroups)
 
+	// deny entries and the access policy are checked only at the top level
+	if checkMyGroups {
+		denied, err := IsUserDeniedAccessToKey(stub, user.ID, asset.AssetKeyId)
+		if err != nil || denied {
+			return false, err
+		}
+		allowed, err := checkAccessPolicy(stub, user, asset, global.ACCESS_READ)
+		if err != nil || !allowed {
+			return false, err
+		}
+	}
+
 	// check cache
 	cachekey := fmt.Sprintf("readaccess-%v-%v-%v", user.ID, asset.AssetId, hasUserPrivKey)
 	cache, err := stub.GetCache(cachekey)
@@ -1623,7 +3200,7 @@ func hasUserReadAccessToAsset(stub cached_stub.CachedStubInterface, user data_mo
 	// check this by edge data with read / write access
 	if hasUserPrivKey {
 		_, edgeData, _ := key_mgmt_i.GetAccessEdge(stub, user.GetPubPrivKeyId(), asset.AssetKeyId)
-		if val, ok := edgeData["AccessType"]; ok {
+		if val, ok := edgeData["AccessType"]; ok && IsEdgeInEffect(stub, edgeData) {
 			if val == global.ACCESS_WRITE || val == global.ACCESS_READ {
 				stub.PutCache(cachekey, true)
 				return true, nil
@@ -1631,7 +3208,7 @@ func hasUserReadAccessToAsset(stub cached_stub.CachedStubInterface, user data_mo
 		}
 	}
 	_, edgeData, _ := key_mgmt_i.GetAccessEdge(stub, user.GetSymKeyId(), asset.AssetKeyId)
-	if val, ok := edgeData["AccessType"]; ok {
+	if val, ok := edgeData["AccessType"]; ok && IsEdgeInEffect(stub, edgeData) {
 		if val == global.ACCESS_WRITE || val == global.ACCESS_READ {
 			stub.PutCache(cachekey, true)
 			return true, nil
@@ -1643,7 +3220,7 @@ func hasUserReadAccessToAsset(stub cached_stub.CachedStubInterface, user data_mo
 		for _, datatypeID := range asset.Datatypes {
 			consentID := consent_mgmt_c.GetConsentID(datatypeID, user.ID, asset.OwnerIds[0])
 			_, edgeData, _ := key_mgmt_i.GetAccessEdge(stub, consentID, datatype_i.GetDatatypeKeyID(datatypeID, asset.OwnerIds[0]))
-			if val, ok := edgeData["AccessType"]; ok {
+			if val, ok := edgeData["AccessType"]; ok && IsEdgeInEffect(stub, edgeData) {
 				if val == global.ACCESS_WRITE || val == global.ACCESS_READ {
 					stub.PutCache(cachekey, true)
 					return true, nil
@@ -1655,7 +3232,7 @@ func hasUserReadAccessToAsset(stub cached_stub.CachedStubInterface, user data_mo
 				currID := parent
 				consentID := consent_mgmt_c.GetConsentID(currID, user.ID, asset.OwnerIds[0])
 				_, edgeData, _ := key_mgmt_i.GetAccessEdge(stub, consentID, datatype_i.GetDatatypeKeyID(datatypeID, asset.OwnerIds[0]))
-				if val, ok := edgeData["AccessType"]; ok {
+				if val, ok := edgeData["AccessType"]; ok && IsEdgeInEffect(stub, edgeData) {
 					if val == global.ACCESS_WRITE || val == global.ACCESS_READ {
 						stub.PutCache(cachekey, true)
 						return true, nil
@@ -1705,6 +3282,18 @@ func hasUserReadAccessToAsset(stub cached_stub.CachedStubInterface, user data_mo
 
 // hasUserReadOnlyAccessToAsset returns user with read access (excluding users with write access).
 func hasUserReadOnlyAccessToAsset(stub cached_stub.CachedStubInterface, user data_model.User, asset data_model.Asset, hasUserPrivKey, checkMyGroups bool) (bool, error) {
+	// deny entries and the access policy are checked only at the top level
+	if checkMyGroups {
+		denied, err := IsUserDeniedAccessToKey(stub, user.ID, asset.AssetKeyId)
+		if err != nil || denied {
+			return false, err
+		}
+		allowed, err := checkAccessPolicy(stub, user, asset, global.ACCESS_READ)
+		if err != nil || !allowed {
+			return false, err
+		}
+	}
+
 	// save cache only for the true case (for readaccess)
 	cachekey := fmt.Sprintf("readaccess-%v-%v-%v", user.ID, asset.AssetId, hasUserPrivKey)
 
@@ -1735,7 +3324,7 @@ func hasUserReadOnlyAccessToAsset(stub cached_stub.CachedStubInterface, user dat
 	// check this by edge data with read access
 	if hasUserPrivKey {
 		_, edgeData, _ := key_mgmt_i.GetAccessEdge(stub, user.GetPubPrivKeyId(), asset.AssetKeyId)
-		if val, ok := edgeData["AccessType"]; ok {
+		if val, ok := edgeData["AccessType"]; ok && IsEdgeInEffect(stub, edgeData) {
 			if val == global.ACCESS_READ {
 				stub.PutCache(cachekey, true)
 				return true, nil
@@ -1748,7 +3337,7 @@ func hasUserReadOnlyAccessToAsset(stub cached_stub.CachedStubInterface, user dat
 		for _, datatypeID := range asset.Datatypes {
 			consentID := consent_mgmt_c.GetConsentID(datatypeID, user.ID, asset.OwnerIds[0])
 			_, edgeData, _ := key_mgmt_i.GetAccessEdge(stub, consentID, datatype_i.GetDatatypeKeyID(datatypeID, asset.OwnerIds[0]))
-			if val, ok := edgeData["AccessType"]; ok {
+			if val, ok := edgeData["AccessType"]; ok && IsEdgeInEffect(stub, edgeData) {
 				if val == global.ACCESS_READ {
 					stub.PutCache(cachekey, true)
 					return true, nil
@@ -1760,7 +3349,7 @@ func hasUserReadOnlyAccessToAsset(stub cached_stub.CachedStubInterface, user dat
 				currID := parent
 				consentID := consent_mgmt_c.GetConsentID(currID, user.ID, asset.OwnerIds[0])
 				_, edgeData, _ := key_mgmt_i.GetAccessEdge(stub, consentID, datatype_i.GetDatatypeKeyID(datatypeID, asset.OwnerIds[0]))
-				if val, ok := edgeData["AccessType"]; ok {
+				if val, ok := edgeData["AccessType"]; ok && IsEdgeInEffect(stub, edgeData) {
 					if val == global.ACCESS_READ {
 						stub.PutCache(cachekey, true)
 						return true, nil
@@ -1833,6 +3422,129 @@ func getAssetByKey(stub cached_stub.CachedStubInterface, assetId string, assetKe
 	return &assetData, err
 }
 
+// deleteAsset removes the asset and its index values from the ledger.
+// assetKey is used to find the index primary key if it is a private data field.
+func deleteAsset(stub cached_stub.CachedStubInterface, assetData data_model.Asset, assetKey []byte) error {
+	err := stub.DelState(assetData.AssetId)
+	if err != nil {
+		custom_err := &custom_errors.DeleteLedgerError{LedgerKey: assetData.AssetId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+
+	// delete asset's index values
+	if len(assetData.IndexTableName) > 0 {
+		table := index.GetTable(stub, assetData.IndexTableName)
+		table.DeleteRow(getIndexPrimaryKey(stub, table, assetData, assetKey))
+	}
+	return updateDatatypeAssetIndex(stub, assetData.AssetId, assetData.Datatypes, assetData.OwnerIds, nil, nil)
+}
+
+// getIndexPrimaryKey returns the value of the index table's primary key for the asset, the same way
+// updateCustomAssetIndices finds it: from public data, then from private data, defaulting to the assetId.
+func getIndexPrimaryKey(stub cached_stub.CachedStubInterface, indexTable table_interface.Table, assetData data_model.Asset, assetKey []byte) string {
+	primaryKeyField := indexTable.GetPrimaryKeyId()
+	publicDataMap := make(map[string]interface{})
+	json.Unmarshal(assetData.PublicData, &publicDataMap)
+	if val, ok := publicDataMap[primaryKeyField]; ok {
+		primaryKeyId, _ := utils.ConvertToString(val)
+		return primaryKeyId
+	}
+	privateData, err := getPrivateData(stub, assetData, assetKey)
+	if err == nil && !data_model.IsEncryptedData(privateData) {
+		privateDataMap := make(map[string]interface{})
+		json.Unmarshal(privateData, &privateDataMap)
+		if val, ok := privateDataMap[primaryKeyField]; ok {
+			primaryKeyId, _ := utils.ConvertToString(val)
+			return primaryKeyId
+		}
+	}
+	return assetData.AssetId
+}
+
+// putEncryptedAsset saves an asset with encrypted private data to the ledger without changing its
+// private data, indices, or signature. The asset's version is incremented.
+func putEncryptedAsset(stub cached_stub.CachedStubInterface, assetData data_model.Asset) error {
+	assetData.Version++
+	assetBytes, err := json.Marshal(&assetData)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "encrypted asset data"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	err = stub.PutState(assetData.AssetId, assetBytes)
+	if err != nil {
+		custom_err := &custom_errors.PutLedgerError{LedgerKey: assetData.AssetId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	return putEncryptedAssetToCache(stub, assetData)
+}
+
+// getAssetHistory returns every version of the asset in the ledger history, oldest first.
+// Private data of a version is decrypted if assetKey is the asset key of that version.
+// Otherwise, the version's encrypted private data is returned, so versions saved before an asset key
+// rotation keep their encrypted private data. No error is returned in that case.
+// Deleted versions have IsDelete set to true and an empty asset.
+func getAssetHistory(stub cached_stub.CachedStubInterface, assetId string, assetKey []byte) ([]data_model.AssetVersion, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	historyIter, err := stub.GetHistoryForKey(assetId)
+	if err != nil {
+		logger.Errorf("Failed to get history for asset %v: %v", assetId, err)
+		return nil, errors.Wrapf(err, "Failed to get history for asset %v", assetId)
+	}
+	defer historyIter.Close()
+
+	versions := []data_model.AssetVersion{}
+	// nanos of the transaction timestamps, to order versions written in the same second
+	nanos := map[string]int32{}
+	for historyIter.HasNext() {
+		modification, err := historyIter.Next()
+		if err != nil {
+			logger.Errorf("Failed to get next history entry for asset %v: %v", assetId, err)
+			return nil, errors.Wrapf(err, "Failed to get next history entry for asset %v", assetId)
+		}
+
+		version := data_model.AssetVersion{TransactionID: modification.GetTxId(), IsDelete: modification.GetIsDelete()}
+		if modification.GetTimestamp() != nil {
+			version.Timestamp = modification.GetTimestamp().GetSeconds()
+			nanos[version.TransactionID] = modification.GetTimestamp().GetNanos()
+		}
+		if !version.IsDelete {
+			err = json.Unmarshal(modification.GetValue(), &version.Asset)
+			if err != nil {
+				custom_err := &custom_errors.UnmarshalError{Type: "data_model.Asset"}
+				logger.Errorf("%v: %v", custom_err, err)
+				return nil, errors.Wrap(err, custom_err.Error())
+			}
+
+			// attempt to decrypt private data of this version
+			if assetKey != nil && bytes.Equal(version.Asset.AssetKeyHash, crypto.Hash(assetKey)) {
+				privateData, err := decryptPrivateData(stub, version.Asset, assetKey)
+				if err == nil {
+					version.Asset.PrivateData = privateData
+				} else {
+					logger.Debugf("Failed to decrypt version %v of asset %v: %v", version.TransactionID, assetId, err)
+					version.Asset.PrivateData = data_model.GetEncryptedDataBytes(version.Asset.PrivateData)
+				}
+			} else {
+				version.Asset.PrivateData = data_model.GetEncryptedDataBytes(version.Asset.PrivateData)
+			}
+		}
+		versions = append(versions, version)
+	}
+
+	// the history iterator may return versions newest first
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].Timestamp != versions[j].Timestamp {
+			return versions[i].Timestamp < versions[j].Timestamp
+		}
+		return nanos[versions[i].TransactionID] < nanos[versions[j].TransactionID]
+	})
+	return versions, nil
+}
+
 // getPrivateDataFromCache returns a copy of the object to avoid the "by reference" side effect.
 func getPrivateDataFromCache(stub cached_stub.CachedStubInterface, assetId string) ([]byte, error) {
 	assetPrivateCacheKey := getAssetPrivateCacheKey(assetId)
@@ -1886,6 +3598,22 @@ func getPrivateData(stub cached_stub.CachedStubInterface, assetData data_model.A
 		return decryptedAsset, nil
 	}
 
+	decryptedAsset, err = decryptPrivateData(stub, assetData, assetKey)
+	if err != nil {
+		return data_model.GetEncryptedDataBytes(assetData.PrivateData), err
+	}
+
+	// if asset bytes successfully decrypted, save to cache
+	putPrivateDataToCache(stub, assetData.AssetId, decryptedAsset)
+	return decryptedAsset, nil
+}
+
+// decryptPrivateData decrypts an asset's private data with assetKey, getting the encrypted
+// data from the asset's datastore if the asset is stored off-chain.
+// Unlike getPrivateData, it does not use the cache, so it can be used for previous versions of an asset.
+func decryptPrivateData(stub cached_stub.CachedStubInterface, assetData data_model.Asset, assetKey []byte) ([]byte, error) {
+	var decryptedAsset []byte
+	var err error
 	datastoreConnectionID := assetData.GetDatastoreConnectionID()
 	if utils.IsStringEmpty(datastoreConnectionID) && !utils.IsStringEmpty(defaultDatastoreConnectionID) {
 		datastoreConnectionID = defaultDatastoreConnectionID
@@ -1896,31 +3624,28 @@ func getPrivateData(stub cached_stub.CachedStubInterface, assetData data_model.A
 		if err != nil {
 			custom_err := &custom_errors.DecryptionError{ToDecrypt: "asset", DecryptionKey: "sym key"}
 			logger.Infof("%v: %v", custom_err, err)
-			return data_model.GetEncryptedDataBytes(assetData.PrivateData), errors.WithStack(custom_err)
+			return nil, errors.WithStack(custom_err)
 		}
 	} else {
 		// get encrypted data from datastore
 		myDatastore, err := datastore_c.GetDatastoreImpl(stub, datastoreConnectionID)
 		if err != nil {
 			logger.Infof("error instantiating datastore: %v", err)
-			return data_model.GetEncryptedDataBytes(assetData.PrivateData), errors.WithStack(err)
+			return nil, errors.WithStack(err)
 		}
 		encryptedData, err := myDatastore.Get(stub, string(assetData.PrivateData))
 		if err != nil {
 			logger.Infof("error getting data from : %v", err)
-			return data_model.GetEncryptedDataBytes(assetData.PrivateData), errors.WithStack(err)
+			return nil, errors.WithStack(err)
 		}
 		// attempt to decrypt data bytes
 		decryptedAsset, err = crypto.DecryptWithSymKey(assetKey, encryptedData)
 		if err != nil {
 			custom_err := &custom_errors.DecryptionError{ToDecrypt: "asset", DecryptionKey: "sym key"}
 			logger.Infof("%v: %v", custom_err, err)
-			return data_model.GetEncryptedDataBytes(assetData.PrivateData), errors.WithStack(custom_err)
+			return nil, errors.WithStack(custom_err)
 		}
 	}
-
-	// if asset bytes successfully decrypted, save to cache
-	putPrivateDataToCache(stub, assetData.AssetId, decryptedAsset)
 	return decryptedAsset, nil
 }
 
@@ -2016,6 +3741,77 @@ func updateAssetToDatatype(stub cached_stub.CachedStubInterface, caller data_mod
 	return nil
 }
 
+// getDatatypeAssetTable returns the index table of assets by datatype and owner.
+func getDatatypeAssetTable(stub cached_stub.CachedStubInterface) table_interface.Table {
+	return index.GetTable(stub, global.INDEX_DATATYPE_ASSET, "row_id")
+}
+
+// datatypeAssetRowIdPrefixLength is the length of the hash at the start of a datatype asset index row id.
+var datatypeAssetRowIdPrefixLength = len(crypto.HashB64([]byte{}))
+
+// getDatatypeAssetRowId returns the primary key of the datatype asset index row for the given datatype, owner, and asset.
+// The row id is a hash of datatypeID and ownerID followed by the assetId, so the assetId can be found from the row id.
+func getDatatypeAssetRowId(datatypeID string, ownerID string, assetId string) string {
+	return crypto.HashB64([]byte(datatypeID+"-"+ownerID)) + assetId
+}
+
+// getAssetIdFromDatatypeAssetRowId returns the assetId of a datatype asset index row id.
+func getAssetIdFromDatatypeAssetRowId(rowId string) string {
+	if len(rowId) < datatypeAssetRowIdPrefixLength {
+		return ""
+	}
+	return rowId[datatypeAssetRowIdPrefixLength:]
+}
+
+// updateDatatypeAssetIndex updates the index of assets by datatype and owner.
+// It removes the rows for each (datatype, owner) pair of prevDatatypes and prevOwnerIDs that is no longer
+// in newDatatypes and newOwnerIDs, and adds a row for each new pair.
+func updateDatatypeAssetIndex(stub cached_stub.CachedStubInterface, assetId string, prevDatatypes []string, prevOwnerIDs []string, newDatatypes []string, newOwnerIDs []string) error {
+	table := getDatatypeAssetTable(stub)
+
+	newRows := make(map[string]bool)
+	for _, datatypeID := range newDatatypes {
+		for _, ownerID := range newOwnerIDs {
+			newRows[getDatatypeAssetRowId(datatypeID, ownerID, assetId)] = true
+		}
+	}
+
+	prevRows := make(map[string]bool)
+	for _, datatypeID := range prevDatatypes {
+		for _, ownerID := range prevOwnerIDs {
+			rowId := getDatatypeAssetRowId(datatypeID, ownerID, assetId)
+			prevRows[rowId] = true
+			if newRows[rowId] {
+				continue
+			}
+			err := table.DeleteRow(rowId)
+			if err != nil {
+				logger.Errorf("Failed to delete row from %v index: %v", global.INDEX_DATATYPE_ASSET, err)
+				return errors.Wrapf(err, "Failed to delete row from %v index", global.INDEX_DATATYPE_ASSET)
+			}
+		}
+	}
+
+	for _, datatypeID := range newDatatypes {
+		for _, ownerID := range newOwnerIDs {
+			rowId := getDatatypeAssetRowId(datatypeID, ownerID, assetId)
+			if prevRows[rowId] {
+				continue
+			}
+			row := make(map[string]string)
+			row["datatype_id"] = datatypeID
+			row["owner_id"] = ownerID
+			row["row_id"] = rowId
+			err := table.UpdateRow(row)
+			if err != nil {
+				logger.Errorf("Failed to add row to %v index: %v", global.INDEX_DATATYPE_ASSET, err)
+				return errors.Wrapf(err, "Failed to add row to %v index", global.INDEX_DATATYPE_ASSET)
+			}
+		}
+	}
+	return nil
+}
+
 func getAssetCacheKey(assetId string) string {
 	return global.ASSET_CACHE_PREFIX + assetId
 }
@@ -2040,12 +3836,7 @@ func getUserPublicKey(stub cached_stub.CachedStubInterface, userId string) (data
 	}
 	user := data_model.User{ID: userId}
 	user.LoadFromAsset(userData)
-	pubKey := data_model.Key{
-		ID:       user.GetPubPrivKeyId(),
-		KeyBytes: crypto.PublicKeyToBytes(user.PublicKey),
-		Type:     global.KEY_TYPE_PUBLIC,
-	}
-	return pubKey, nil
+	return user.GetPublicKey(), nil
 }
 
 // PutAssetByKey is to be used only by test
@@ -14,12 +14,14 @@ import (
 	"common/bchcls/asset_mgmt/asset_manager"
 	"common/bchcls/cached_stub"
 	"common/bchcls/crypto"
+	"common/bchcls/custom_errors"
 	"common/bchcls/data_model"
 	"common/bchcls/datastore"
 	"common/bchcls/index"
 	"common/bchcls/internal/common/global"
 	"common/bchcls/internal/datastore_i/datastore_c"
 	"common/bchcls/internal/datatype_i"
+	"common/bchcls/internal/history_i/history_c"
 	"common/bchcls/internal/key_mgmt_i"
 	"common/bchcls/simple_rule"
 	"common/bchcls/test_utils"
@@ -30,11 +32,14 @@ import (
 	"encoding/json"
 	"net/url"
 	"os"
+	"os/exec"
+	"reflect"
 	"runtime/debug"
 	"testing"
 	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
 )
 
 func setup(t *testing.T) *test_utils.NewMockStub {
@@ -653,6 +658,97 @@ func TestUpdateAsset_Index(t *testing.T) {
 	mstub.MockTransactionEnd("t123")
 }
 
+func TestPutAssetByKey_GCM(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestPutAssetByKey_GCM function called")
+
+	// the sym key encryption mode can't be changed once data has been encrypted, so run this test in its own process
+	if os.Getenv("BCHCLS_TEST_SYM_KEY_MODE") != crypto.SYM_KEY_MODE_GCM {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestPutAssetByKey_GCM$")
+		cmd.Env = append(os.Environ(), "BCHCLS_TEST_SYM_KEY_MODE="+crypto.SYM_KEY_MODE_GCM)
+		output, err := cmd.CombinedOutput()
+		test_utils.AssertTrue(t, err == nil, "Expected TestPutAssetByKey_GCM to succeed in GCM mode: "+string(output))
+		return
+	}
+	err := crypto.SetSymKeyEncryptionMode(crypto.SYM_KEY_MODE_GCM)
+	test_utils.AssertTrue(t, err == nil, "Expected SetSymKeyEncryptionMode to succeed")
+
+	// create a MockStub
+	mstub := setup(t)
+
+	owner := test_utils.CreateTestUser("owner1")
+	myKey := owner.SymKey
+	key1 := test_utils.GenerateSymKey()
+
+	testAsset := test_utils.CreateTestAsset(GetAssetId("data_model.Asset", "asset1"))
+	testAsset.OwnerIds = []string{"owner1"}
+	testAsset.IndexTableName = "GCMAssetIndex"
+	testPublicDataMap := make(map[string]interface{})
+	testPublicDataMap["assetId"] = testAsset.AssetId
+	testAsset.PublicData, _ = json.Marshal(testPublicDataMap)
+	testPrivateDataMap := make(map[string]interface{})
+	testPrivateDataMap["age"] = "20"
+	testAsset.PrivateData, _ = json.Marshal(testPrivateDataMap)
+
+	// create encrypted index table
+	mstub.MockTransactionStart("t123")
+	stub := cached_stub.NewCachedStub(mstub)
+	table := index.GetTable(stub, "GCMAssetIndex", "assetId", false, true)
+	table.AddIndex([]string{"age", "assetId"}, false)
+	err = table.SaveToLedger()
+	test_utils.AssertTrue(t, err == nil, "Expected SaveToLedger to succeed")
+	mstub.MockTransactionEnd("t123")
+
+	// add asset and give access from myKey to asset key
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = putAssetByKey(stub, owner, testAsset, "key1", key1, "myKeyId", myKey, myKey)
+	test_utils.AssertTrue(t, err == nil, "Expected PutAsset to succeed")
+	mstub.MockTransactionEnd("t123")
+
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	checkAsset(t, stub, testAsset.AssetId, testAsset.PublicData, testAsset.PrivateData, "key1", key1, testAsset.OwnerIds)
+
+	// private data is stored in GCM format
+	assetBytes, _ := stub.GetState(testAsset.AssetId)
+	assetData := data_model.Asset{}
+	json.Unmarshal(assetBytes, &assetData)
+	test_utils.AssertTrue(t, bytes.HasPrefix(assetData.PrivateData, []byte(crypto.SYM_KEY_ENVELOPE_PREFIX)), "Expected GCM encrypted PrivateData")
+
+	// key graph edge is stored in GCM format
+	edgeBytes, _, err := key_mgmt_i.GetAccessEdge(stub, "myKeyId", "key1")
+	test_utils.AssertTrue(t, err == nil, "Expected GetAccessEdge to succeed")
+	edge := make(map[string]interface{})
+	json.Unmarshal(edgeBytes, &edge)
+	encryptedTargetKey, _ := crypto.DecodeStringB64(edge["encrypted_target_key"].(string))
+	test_utils.AssertTrue(t, bytes.HasPrefix(encryptedTargetKey, []byte(crypto.SYM_KEY_ENVELOPE_PREFIX)), "Expected GCM encrypted edge")
+	assetKeyBytes, err := key_mgmt_i.GetKey(stub, []string{"myKeyId", "key1"}, myKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetKey to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(assetKeyBytes, key1), "Expected to get asset key")
+
+	// index row can be read back
+	rows := testGetRow(stub, "GCMAssetIndex", testAsset.AssetId, "20")
+	test_utils.AssertInLists(t, testAsset.AssetId, rows, "Expected assetId index to be saved successfully")
+	mstub.MockTransactionEnd("t123")
+
+	// update asset
+	testPrivateDataMap["age"] = "22"
+	testAsset.PrivateData, _ = json.Marshal(testPrivateDataMap)
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = putAssetByKey(stub, owner, testAsset, "key1", key1, "", nil, nil)
+	test_utils.AssertTrue(t, err == nil, "Expected PutAsset to succeed")
+	mstub.MockTransactionEnd("t123")
+
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	checkAsset(t, stub, testAsset.AssetId, testAsset.PublicData, testAsset.PrivateData, "key1", key1, testAsset.OwnerIds)
+	rows = testGetRow(stub, "GCMAssetIndex", testAsset.AssetId, "22")
+	test_utils.AssertInLists(t, testAsset.AssetId, rows, "Expected assetId index to be updated successfully")
+	mstub.MockTransactionEnd("t123")
+}
+
 func TestUpdateAsset_Index_DefaultPrimaryKey(t *testing.T) {
 	logger.SetLevel(shim.LogDebug)
 	logger.Info("TestUpdateAsset_Index_DefaultPrimaryKey function called")
@@ -983,6 +1079,470 @@ func TestDeleteAsset(t *testing.T) {
 	mstub.MockTransactionEnd("t123")
 }
 
+func TestDeleteAsset_IndexPrimaryKey(t *testing.T) {
+	logger.Info("TestDeleteAsset_IndexPrimaryKey function called")
+
+	// the vehicle table's primary key is the "id" field of the private data, not the asset ID
+	mstub := setup(t)
+	caller := setupVehicleAssets(mstub)
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	am := GetAssetManager(stub, caller)
+	assetKey, err := am.GetAssetKey(truckAsset.AssetId, []string{caller.GetPubPrivKeyId(), truckAsset.AssetKeyId})
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetKey to succeed")
+	row, err := index.GetTable(stub, vehicleTableName).GetRow(truck.ID)
+	test_utils.AssertTrue(t, err == nil && len(row) > 0, "Expected index row of truck")
+	err = am.DeleteAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected DeleteAsset to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	row, err = index.GetTable(stub, vehicleTableName).GetRow(truck.ID)
+	test_utils.AssertTrue(t, err == nil && len(row) == 0, "Expected index row of truck to be deleted")
+	assetIter, err := GetAssetManager(stub, caller).GetAssetIter(vehicleNamespace, vehicleTableName,
+		[]string{"color"},
+		[]string{"blue"},
+		[]string{"blue"},
+		true,
+		false,
+		[]string{caller.GetPubPrivKeyId()},
+		"",
+		20,
+		nil)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetIter to succeed")
+	assertAssetIterListsEqual(t, []data_model.Asset{compactAsset}, assetIter)
+	mstub.MockTransactionEnd("t2")
+}
+
+func TestSoftDeleteAsset(t *testing.T) {
+	logger.Info("TestSoftDeleteAsset function called")
+
+	mstub := setup(t)
+	caller := setupVehicleAssets(mstub)
+	other := test_utils.CreateTestUser("other")
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	assetKey, err := GetAssetManager(stub, caller).GetAssetKey(truckAsset.AssetId, []string{caller.GetPubPrivKeyId(), truckAsset.AssetKeyId})
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetKey to succeed")
+	vehicleTable := index.GetTable(stub, vehicleTableName)
+	err = vehicleTable.AddIndex([]string{global.INDEX_DELETED_AT_FIELD, "id"}, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddIndex to succeed")
+	err = vehicleTable.SaveToLedger()
+	test_utils.AssertTrue(t, err == nil, "Expected SaveToLedger to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	getBlueVehicles := func(am asset_manager.AssetManager, includeDeleted bool) asset_manager.AssetIteratorInterface {
+		assetIter, err := am.GetAssetIter(vehicleNamespace, vehicleTableName,
+			[]string{"color"},
+			[]string{"blue"},
+			[]string{"blue"},
+			true,
+			false,
+			[]string{caller.GetPubPrivKeyId()},
+			"",
+			20,
+			nil,
+			includeDeleted)
+		test_utils.AssertTrue(t, err == nil, "Expected GetAssetIter to succeed")
+		return assetIter
+	}
+
+	getDeletedVehicleIds := func(stub cached_stub.CachedStubInterface, deletedAt string) []string {
+		iter, err := index.GetTable(stub, vehicleTableName).GetRowsByPartialKey([]string{global.INDEX_DELETED_AT_FIELD}, []string{deletedAt})
+		test_utils.AssertTrue(t, err == nil, "Expected GetRowsByPartialKey to succeed")
+		defer iter.Close()
+		ids := []string{}
+		for iter.HasNext() {
+			kv, err := iter.Next()
+			test_utils.AssertTrue(t, err == nil, "Expected Next to succeed")
+			row := make(map[string]string)
+			json.Unmarshal(kv.GetValue(), &row)
+			ids = append(ids, row["id"])
+		}
+		return ids
+	}
+
+	getAssetChangeLog := func(stub cached_stub.CachedStubInterface, txId string, operation string) data_model.TransactionLog {
+		logAsset, err := getAssetByKey(stub, history_c.GetTransactionLogAssetID(txId+"-"+truckAsset.AssetId+"-"+operation), assetKey.KeyBytes)
+		test_utils.AssertTrue(t, err == nil && len(logAsset.AssetId) > 0, "Expected transaction log")
+		transactionLog := data_model.TransactionLog{}
+		json.Unmarshal(logAsset.PrivateData, &transactionLog)
+		test_utils.AssertTrue(t, transactionLog.Namespace == global.ASSET_LOG_NAMESPACE, "Expected asset log namespace")
+		test_utils.AssertTrue(t, transactionLog.CallerID == caller.ID, "Expected caller ID in log")
+		test_utils.AssertTrue(t, transactionLog.Field1 == truckAsset.AssetId, "Expected assetId in log")
+		return transactionLog
+	}
+
+	// soft delete without write access
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetAssetManager(stub, other).SoftDeleteAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err != nil, "Expected SoftDeleteAsset without write access to fail")
+	mstub.MockTransactionEnd("t2")
+
+	// soft delete
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetAssetManager(stub, caller).SoftDeleteAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected SoftDeleteAsset to succeed")
+	mstub.MockTransactionEnd("t3")
+
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	am := GetAssetManager(stub, caller)
+	asset, err := am.GetAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, len(asset.AssetId) == 0, "Expected empty asset for soft deleted asset")
+	asset, err = am.GetAsset(truckAsset.AssetId, assetKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, asset.AssetId == truckAsset.AssetId, "Expected soft deleted asset")
+	test_utils.AssertTrue(t, asset.IsDeleted(), "Expected asset to be marked as deleted")
+	test_utils.AssertTrue(t, asset.GetDeletedBy() == caller.ID, "Expected caller to be the deleter")
+	test_utils.AssertTrue(t, bytes.Equal(asset.PrivateData, truckAsset.PrivateData), "Expected decrypted private data")
+	assertAssetIterListsEqual(t, []data_model.Asset{compactAsset}, getBlueVehicles(am, false))
+	assertAssetIterListsEqual(t, []data_model.Asset{compactAsset, truckAsset}, getBlueVehicles(am, true))
+	deletedAt := asset.Metadata[global.DELETED_AT_METADATA_KEY]
+	test_utils.AssertTrue(t, reflect.DeepEqual(getDeletedVehicleIds(stub, deletedAt), []string{truck.ID}), "Expected tombstone in index row")
+	test_utils.AssertTrue(t, getAssetChangeLog(stub, "t3", "SoftDeleteAsset").FunctionName == "SoftDeleteAsset", "Expected soft delete log")
+
+	// soft deleted asset can't be updated or soft deleted again, and a live asset can't be purged
+	err = am.UpdateAsset(truckAsset, assetKey)
+	test_utils.AssertTrue(t, err != nil, "Expected UpdateAsset of soft deleted asset to fail")
+	err = am.SoftDeleteAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err != nil, "Expected SoftDeleteAsset of soft deleted asset to fail")
+	err = am.PurgeAsset(compactAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err != nil, "Expected PurgeAsset of asset that is not soft deleted to fail")
+	err = GetAssetManager(stub, other).RestoreAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err != nil, "Expected RestoreAsset without write access to fail")
+	mstub.MockTransactionEnd("t4")
+
+	// restore
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetAssetManager(stub, caller).RestoreAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected RestoreAsset to succeed")
+	mstub.MockTransactionEnd("t5")
+
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = GetAssetManager(stub, caller)
+	asset, err = am.GetAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, asset.AssetId == truckAsset.AssetId && !asset.IsDeleted(), "Expected restored asset")
+	assertAssetIterListsEqual(t, []data_model.Asset{compactAsset, truckAsset}, getBlueVehicles(am, false))
+	test_utils.AssertTrue(t, len(getDeletedVehicleIds(stub, deletedAt)) == 0, "Expected tombstone to be cleared")
+	test_utils.AssertTrue(t, getAssetChangeLog(stub, "t5", "RestoreAsset").FunctionName == "RestoreAsset", "Expected restore log")
+	err = am.RestoreAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err != nil, "Expected RestoreAsset of asset that is not soft deleted to fail")
+	mstub.MockTransactionEnd("t6")
+
+	// soft delete and restore in the same transaction each save a log
+	mstub.MockTransactionStart("t6a")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = GetAssetManager(stub, caller)
+	err = am.SoftDeleteAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected SoftDeleteAsset to succeed")
+	err = am.RestoreAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected RestoreAsset to succeed")
+	mstub.MockTransactionEnd("t6a")
+
+	mstub.MockTransactionStart("t6b")
+	stub = cached_stub.NewCachedStub(mstub)
+	test_utils.AssertTrue(t, getAssetChangeLog(stub, "t6a", "SoftDeleteAsset").FunctionName == "SoftDeleteAsset", "Expected soft delete log")
+	test_utils.AssertTrue(t, getAssetChangeLog(stub, "t6a", "RestoreAsset").FunctionName == "RestoreAsset", "Expected restore log")
+	mstub.MockTransactionEnd("t6b")
+
+	// soft delete and purge
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetAssetManager(stub, caller).SoftDeleteAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected SoftDeleteAsset to succeed")
+	mstub.MockTransactionEnd("t7")
+
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetAssetManager(stub, caller).PurgeAsset(truckAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected PurgeAsset to succeed")
+	mstub.MockTransactionEnd("t8")
+
+	mstub.MockTransactionStart("t9")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = GetAssetManager(stub, caller)
+	asset, err = am.GetAsset(truckAsset.AssetId, assetKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, len(asset.AssetId) == 0, "Expected purged asset to be gone")
+	assertAssetIterListsEqual(t, []data_model.Asset{compactAsset}, getBlueVehicles(am, true))
+	test_utils.AssertTrue(t, getAssetChangeLog(stub, "t8", "PurgeAsset").FunctionName == "PurgeAsset", "Expected purge log")
+	mstub.MockTransactionEnd("t9")
+}
+
+func TestUpdateAssetWithVersion(t *testing.T) {
+	logger.Info("TestUpdateAssetWithVersion function called")
+
+	mstub := setup(t)
+	caller := setupVehicleAssets(mstub)
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	am := GetAssetManager(stub, caller)
+	assetKey, err := am.GetAssetKey(compactAsset.AssetId, []string{caller.GetPubPrivKeyId(), compactAsset.AssetKeyId})
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetKey to succeed")
+	asset, err := am.GetAsset(compactAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, asset.Version == 1, "Expected version 1 for a new asset")
+
+	// GetAssetIter results include the version
+	assetIter, err := am.GetAssetIter(vehicleNamespace, vehicleTableName,
+		[]string{"color"},
+		[]string{"blue"},
+		[]string{"blue"},
+		true,
+		false,
+		[]string{caller.GetPubPrivKeyId()},
+		"",
+		20,
+		nil)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetIter to succeed")
+	for assetIter.HasNext() {
+		iterAsset, err := assetIter.Next()
+		test_utils.AssertTrue(t, err == nil, "Expected Next to succeed")
+		test_utils.AssertTrue(t, iterAsset.Version == 1, "Expected version 1 from GetAssetIter")
+	}
+	mstub.MockTransactionEnd("t1")
+
+	// two clients read version 1; the first update succeeds
+	compact.NumMiles = 20000
+	asset.PrivateData, _ = json.Marshal(compact)
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetAssetManager(stub, caller).UpdateAssetWithVersion(*asset, assetKey, 1)
+	test_utils.AssertTrue(t, err == nil, "Expected UpdateAssetWithVersion to succeed")
+	mstub.MockTransactionEnd("t2")
+
+	// the second update is based on version 1 and fails
+	compact.NumMiles = 30000
+	asset.PrivateData, _ = json.Marshal(compact)
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetAssetManager(stub, caller).UpdateAssetWithVersion(*asset, assetKey, 1)
+	test_utils.AssertTrue(t, err != nil, "Expected UpdateAssetWithVersion with outdated version to fail")
+	conflictErr, ok := errors.Cause(err).(*custom_errors.VersionConflictError)
+	test_utils.AssertTrue(t, ok, "Expected VersionConflictError")
+	test_utils.AssertTrue(t, conflictErr.ExpectedVersion == 1 && conflictErr.ActualVersion == 2, "Expected versions in VersionConflictError")
+	mstub.MockTransactionEnd("t3")
+
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	asset, err = GetAssetManager(stub, caller).GetAsset(compactAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, asset.Version == 2, "Expected version 2 after update")
+	storedCompact := vehicle{}
+	json.Unmarshal(asset.PrivateData, &storedCompact)
+	test_utils.AssertTrue(t, storedCompact.NumMiles == 20000, "Expected first update to be kept")
+
+	// the version is set by asset_mgmt and is incremented by every write
+	asset.Version = 10
+	err = GetAssetManager(stub, caller).UpdateAsset(*asset, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected UpdateAsset to succeed")
+	mstub.MockTransactionEnd("t4")
+
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetAssetManager(stub, caller).SoftDeleteAsset(compactAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected SoftDeleteAsset to succeed")
+	mstub.MockTransactionEnd("t5")
+
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	asset, err = GetAssetManager(stub, caller).GetAsset(compactAsset.AssetId, assetKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, asset.Version == 4, "Expected version 4 after update and soft delete")
+	mstub.MockTransactionEnd("t6")
+
+	// an asset that doesn't exist is not created
+	missingAsset := *asset
+	missingAsset.AssetId = GetAssetId(vehicleNamespace, "missing")
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetAssetManager(stub, caller).UpdateAssetWithVersion(missingAsset, assetKey, 1)
+	test_utils.AssertTrue(t, err != nil, "Expected UpdateAssetWithVersion of missing asset to fail")
+	conflictErr, ok = errors.Cause(err).(*custom_errors.VersionConflictError)
+	test_utils.AssertTrue(t, ok, "Expected VersionConflictError")
+	test_utils.AssertTrue(t, conflictErr.ExpectedVersion == 1 && conflictErr.ActualVersion == 0, "Expected versions in VersionConflictError")
+	err = GetAssetManager(stub, caller).UpdateAssetWithVersion(missingAsset, assetKey, 0)
+	test_utils.AssertTrue(t, err != nil, "Expected UpdateAssetWithVersion of missing asset to fail")
+	mstub.MockTransactionEnd("t7")
+
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	asset, err = GetAssetManager(stub, caller).GetAsset(missingAsset.AssetId, assetKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, len(asset.AssetId) == 0, "Expected missing asset not to be created")
+	mstub.MockTransactionEnd("t8")
+}
+
+func TestFieldEncryption(t *testing.T) {
+	logger.Info("TestFieldEncryption function called")
+
+	mstub := setup(t)
+	owner := test_utils.CreateTestUser("ownerId")
+	clinician := test_utils.CreateTestUser("clinicianId")
+	clinicianKey := clinician.GetPrivateKey()
+
+	assetKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	testAsset := test_utils.CreateTestAsset(GetAssetId("data_model.Asset", "asset1"))
+	testAsset.OwnerIds = []string{owner.ID}
+	testAsset.AssetKeyId = assetKey.ID
+	testAsset.AssetKeyHash = crypto.Hash(assetKey.KeyBytes)
+	testAsset.PrivateData = []byte(`{"diagnosis":"flu","ssn":"123-45-6789"}`)
+	testAsset.SetFieldEncryption(true)
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	err := GetAssetManager(stub, owner).AddAsset(testAsset, assetKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	// give clinician access to the diagnosis field only
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	accessControl := data_model.AccessControl{
+		UserId:   clinician.ID,
+		AssetId:  testAsset.AssetId,
+		Access:   global.ACCESS_READ,
+		AssetKey: &assetKey,
+		UserKey:  &clinicianKey,
+		Fields:   []string{"diagnosis"},
+	}
+	err = GetAssetManager(stub, owner).AddAccessToAsset(accessControl)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccessToAsset to succeed")
+	badAccessControl := accessControl
+	badAccessControl.Fields = []string{"address"}
+	err = GetAssetManager(stub, owner).AddAccessToAsset(badAccessControl)
+	test_utils.AssertTrue(t, err != nil, "Expected AddAccessToAsset to fail for an unknown field")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	asset, err := GetAssetManager(stub, clinician).GetAsset(testAsset.AssetId, data_model.Key{})
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, string(asset.PrivateData) == `{"diagnosis":"flu"}`, "Expected only the diagnosis field")
+	asset, err = GetAssetManager(stub, owner).GetAsset(testAsset.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(asset.PrivateData, testAsset.PrivateData), "Expected all private data")
+	test_utils.AssertTrue(t, len(asset.EncryptedFields) == 2, "Expected 2 encrypted fields")
+	mstub.MockTransactionEnd("t3")
+
+	// remove field access
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetAssetManager(stub, owner).RemoveAccessFromAsset(accessControl)
+	test_utils.AssertTrue(t, err == nil, "Expected RemoveAccessFromAsset to succeed")
+	mstub.MockTransactionEnd("t4")
+
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	asset, _ = GetAssetManager(stub, clinician).GetAsset(testAsset.AssetId, data_model.Key{})
+	test_utils.AssertTrue(t, !bytes.Contains(asset.PrivateData, []byte("flu")), "Expected no decrypted fields after access is removed")
+	mstub.MockTransactionEnd("t5")
+
+	// field encryption is not supported for off-chain private data
+	datastoreAsset := test_utils.CreateTestAsset(GetAssetId("data_model.Asset", "asset2"))
+	datastoreAsset.OwnerIds = []string{owner.ID}
+	datastoreAsset.AssetKeyId = assetKey.ID
+	datastoreAsset.AssetKeyHash = crypto.Hash(assetKey.KeyBytes)
+	datastoreAsset.PrivateData = []byte(`{"diagnosis":"flu"}`)
+	datastoreAsset.SetFieldEncryption(true)
+	datastoreAsset.SetDatastoreConnectionID("cloudant1")
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetAssetManager(stub, owner).AddAsset(datastoreAsset, assetKey, true)
+	test_utils.AssertTrue(t, err != nil, "Expected AddAsset with a datastore to fail")
+	mstub.MockTransactionEnd("t6")
+}
+
+func TestRotateAssetKey_FieldAccess(t *testing.T) {
+	logger.Info("TestRotateAssetKey_FieldAccess function called")
+
+	mstub := setup(t)
+	owner := test_utils.CreateTestUser("ownerId")
+	clinician := test_utils.CreateTestUser("clinicianId")
+	clinicianKey := clinician.GetPrivateKey()
+
+	oldKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	testAsset := test_utils.CreateTestAsset(GetAssetId("data_model.Asset", "asset1"))
+	testAsset.OwnerIds = []string{owner.ID}
+	testAsset.AssetKeyId = oldKey.ID
+	testAsset.AssetKeyHash = crypto.Hash(oldKey.KeyBytes)
+	testAsset.PrivateData = []byte(`{"diagnosis":"flu","ssn":"123-45-6789"}`)
+	testAsset.SetFieldEncryption(true)
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	err := GetAssetManager(stub, owner).AddAsset(testAsset, oldKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	// give clinician access to the diagnosis field only
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	accessControl := data_model.AccessControl{
+		UserId:   clinician.ID,
+		AssetId:  testAsset.AssetId,
+		Access:   global.ACCESS_READ,
+		AssetKey: &oldKey,
+		UserKey:  &clinicianKey,
+		Fields:   []string{"diagnosis"},
+	}
+	err = GetAssetManager(stub, owner).AddAccessToAsset(accessControl)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccessToAsset to succeed")
+	mstub.MockTransactionEnd("t2")
+
+	// rotate asset key
+	newKey := data_model.Key{ID: "key2", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetAssetManager(stub, owner).RotateAssetKey(testAsset.AssetId, oldKey, newKey)
+	test_utils.AssertTrue(t, err == nil, "Expected RotateAssetKey to succeed")
+	mstub.MockTransactionEnd("t3")
+
+	// clinician can still read the diagnosis field
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	asset, err := GetAssetManager(stub, clinician).GetAsset(testAsset.AssetId, data_model.Key{})
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, string(asset.PrivateData) == `{"diagnosis":"flu"}`, "Expected only the diagnosis field")
+	asset, err = GetAssetManager(stub, owner).GetAsset(testAsset.AssetId, newKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(asset.PrivateData, testAsset.PrivateData), "Expected all private data")
+
+	// old field keys are deleted
+	for _, fieldName := range []string{"diagnosis", "ssn"} {
+		oldFieldKeyId := key_mgmt_i.GetKeyIdForFieldAccess(testAsset.AssetId, oldKey.ID, fieldName)
+		test_utils.AssertTrue(t, !key_mgmt_i.KeyExists(stub, oldFieldKeyId), "Expected old field key to be deleted")
+		edgeValue, _, _ := key_mgmt_i.GetAccessEdge(stub, newKey.ID, oldFieldKeyId)
+		test_utils.AssertTrue(t, len(edgeValue) == 0, "Expected no edge from the new asset key to the old field key")
+	}
+	mstub.MockTransactionEnd("t4")
+
+	// field access can still be removed
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	accessControl.AssetKey = &newKey
+	err = GetAssetManager(stub, owner).RemoveAccessFromAsset(accessControl)
+	test_utils.AssertTrue(t, err == nil, "Expected RemoveAccessFromAsset to succeed")
+	mstub.MockTransactionEnd("t5")
+
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	asset, _ = GetAssetManager(stub, clinician).GetAsset(testAsset.AssetId, data_model.Key{})
+	test_utils.AssertTrue(t, !bytes.Contains(asset.PrivateData, []byte("flu")), "Expected no decrypted fields after access is removed")
+	mstub.MockTransactionEnd("t6")
+}
+
 func checkAsset(t *testing.T, stub cached_stub.CachedStubInterface, assetId string, publicData []byte, privateData []byte, assetKeyId string, assetKey []byte, ownerIds []string) {
 	// check ledger for asset
 
@@ -12,19 +12,29 @@ package test
 import (
 	"common/bchcls/cached_stub"
 	"common/bchcls/crypto"
+	"common/bchcls/custom_errors"
 	"common/bchcls/data_model"
+	"common/bchcls/datastore"
+	"common/bchcls/index"
 	"common/bchcls/internal/asset_mgmt_i"
 	"common/bchcls/internal/common/global"
 	"common/bchcls/internal/datastore_i/datastore_c"
 	"common/bchcls/internal/datatype_i"
 	"common/bchcls/internal/key_mgmt_i"
+	"common/bchcls/internal/user_access_ctrl_i/abac_i"
 	"common/bchcls/internal/user_mgmt_i"
 	"common/bchcls/test_utils"
 
+	"bytes"
 	"crypto/rsa"
+	"encoding/json"
+	"strconv"
 	"testing"
 
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/pkg/errors"
 )
 
 var logger = shim.NewLogger("asset_mgmt_i_test")
@@ -329,6 +339,484 @@ func TestAddAssetToDatatype(t *testing.T) {
 	test_utils.AssertTrue(t, len(keyPath) > 0, "Access from datatype key to asset key should exist")
 }
 
+func TestRotateAssetKey(t *testing.T) {
+	logger.Info("TestRotateAssetKey function called")
+
+	mstub := setup(t)
+
+	owner := test_utils.CreateTestUser("owner1")
+	reader := test_utils.CreateTestUser("reader1")
+	revokedReader := test_utils.CreateTestUser("reader2")
+	writeOnlyUser := test_utils.CreateTestUser("writer1")
+	grantor := test_utils.CreateTestUser("grantor1")
+	writeOnlyUser2 := test_utils.CreateTestUser("writer2")
+
+	// register users and off-chain datastore connection
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	for _, user := range []data_model.User{owner, reader, revokedReader, writeOnlyUser, grantor, writeOnlyUser2} {
+		err := user_mgmt_i.RegisterUserWithParams(stub, user, user, false)
+		test_utils.AssertTrue(t, err == nil, "Register user should not have returned an error")
+	}
+	connection := datastore.DatastoreConnection{ID: "ledger2", Type: datastore.DATASTORE_TYPE_DEFAULT_LEDGER}
+	err := datastore_c.PutDatastoreConnection(stub, connection)
+	test_utils.AssertTrue(t, err == nil, "Expected PutDatastoreConnection to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	// register datatype and add datatype sym key
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "datatype1", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	mstub.MockTransactionEnd("t123")
+
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "datatype1", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t123")
+
+	// add asset
+	oldKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	assetData := test_utils.CreateTestAsset(asset_mgmt_i.GetAssetId("data_model.Asset", "asset1"))
+	assetData.AssetKeyId = oldKey.ID
+	assetData.AssetKeyHash = crypto.Hash(oldKey.KeyBytes)
+	assetData.Datatypes = []string{"datatype1"}
+	assetData.PrivateData = test_utils.CreateTestAssetData("private1")
+	assetData.OwnerIds = []string{owner.ID}
+	assetData.SetDatastoreConnectionID("ledger2")
+
+	// write only access given before the asset is created uses a write only key of the grantor
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	accessControl := data_model.AccessControl{UserId: writeOnlyUser2.ID, AssetId: assetData.AssetId, Access: global.ACCESS_WRITE_ONLY, AssetKey: &oldKey}
+	err = asset_mgmt_i.GetAssetManager(stub, grantor).AddAccessToAsset(accessControl, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccessToAsset to succeed")
+	mstub.MockTransactionEnd("t123")
+
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = asset_mgmt_i.GetAssetManager(stub, owner).AddAsset(assetData, oldKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	mstub.MockTransactionEnd("t123")
+
+	// give access to readers and write only user
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	am := asset_mgmt_i.GetAssetManager(stub, owner)
+	for _, userId := range []string{reader.ID, revokedReader.ID} {
+		accessControl := data_model.AccessControl{UserId: userId, AssetId: assetData.AssetId, Access: global.ACCESS_READ}
+		err = am.AddAccessToAsset(accessControl)
+		test_utils.AssertTrue(t, err == nil, "Expected AddAccessToAsset to succeed")
+	}
+	accessControl = data_model.AccessControl{UserId: writeOnlyUser.ID, AssetId: assetData.AssetId, Access: global.ACCESS_WRITE_ONLY}
+	err = am.AddAccessToAsset(accessControl)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccessToAsset to succeed")
+	mstub.MockTransactionEnd("t123")
+
+	// revoke reader2's access; reader2 still knows the old asset key
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	accessControl = data_model.AccessControl{UserId: revokedReader.ID, AssetId: assetData.AssetId, Access: global.ACCESS_READ}
+	err = asset_mgmt_i.GetAssetManager(stub, owner).RemoveAccessFromAsset(accessControl)
+	test_utils.AssertTrue(t, err == nil, "Expected RemoveAccessFromAsset to succeed")
+	mstub.MockTransactionEnd("t123")
+
+	newKey := data_model.Key{ID: "key2", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+
+	// invalid rotations
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = asset_mgmt_i.GetAssetManager(stub, owner)
+	wrongKey := data_model.Key{ID: oldKey.ID, KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	err = am.RotateAssetKey(assetData.AssetId, wrongKey, newKey)
+	test_utils.AssertTrue(t, err != nil, "Expected RotateAssetKey with wrong old key to fail")
+	sameBytesKey := data_model.Key{ID: newKey.ID, KeyBytes: oldKey.KeyBytes, Type: global.KEY_TYPE_SYM}
+	err = am.RotateAssetKey(assetData.AssetId, oldKey, sameBytesKey)
+	test_utils.AssertTrue(t, err != nil, "Expected RotateAssetKey with unchanged key bytes to fail")
+	err = am.RotateAssetKey(assetData.AssetId, oldKey, data_model.Key{ID: newKey.ID, KeyBytes: []byte("invalid"), Type: global.KEY_TYPE_SYM})
+	test_utils.AssertTrue(t, err != nil, "Expected RotateAssetKey with invalid new key to fail")
+	err = asset_mgmt_i.GetAssetManager(stub, reader).RotateAssetKey(assetData.AssetId, oldKey, newKey)
+	test_utils.AssertTrue(t, err != nil, "Expected RotateAssetKey without write access to fail")
+	mstub.MockTransactionEnd("t123")
+
+	// rotate asset key
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = asset_mgmt_i.GetAssetManager(stub, owner).RotateAssetKey(assetData.AssetId, oldKey, newKey)
+	test_utils.AssertTrue(t, err == nil, "Expected RotateAssetKey to succeed")
+	mstub.MockTransactionEnd("t123")
+
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+
+	// asset key id and hash are updated, private data stays off-chain
+	encryptedAsset, err := asset_mgmt_i.GetEncryptedAssetData(stub, assetData.AssetId)
+	test_utils.AssertTrue(t, err == nil, "Expected GetEncryptedAssetData to succeed")
+	test_utils.AssertTrue(t, encryptedAsset.AssetKeyId == newKey.ID, "Expected new asset key id")
+	test_utils.AssertTrue(t, bytes.Equal(encryptedAsset.AssetKeyHash, crypto.Hash(newKey.KeyBytes)), "Expected new asset key hash")
+	test_utils.AssertTrue(t, encryptedAsset.GetDatastoreConnectionID() == "ledger2", "Expected datastore connection to be kept")
+	test_utils.AssertTrue(t, !data_model.IsEncryptedData(encryptedAsset.PrivateData), "Expected private data to be stored off-chain")
+
+	// old key can't be used to read the asset
+	_, err = asset_mgmt_i.GetAssetManager(stub, revokedReader).GetAsset(assetData.AssetId, oldKey)
+	test_utils.AssertTrue(t, err != nil, "Expected GetAsset with old key to fail")
+	_, err = asset_mgmt_i.GetAssetPrivateData(stub, encryptedAsset, oldKey.KeyBytes)
+	test_utils.AssertTrue(t, err != nil, "Expected GetAssetPrivateData with old key to fail")
+
+	// owner and reader get the new key
+	ownerAssetKey, err := asset_mgmt_i.GetAssetManager(stub, owner).GetAssetKey(assetData.AssetId, []string{owner.GetPubPrivKeyId(), newKey.ID})
+	test_utils.AssertTrue(t, err == nil, "Expected owner's GetAssetKey to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(ownerAssetKey.KeyBytes, newKey.KeyBytes), "Expected new asset key")
+	readerAssetKey, err := asset_mgmt_i.GetAssetManager(stub, reader).GetAssetKey(assetData.AssetId, []string{reader.GetPubPrivKeyId(), newKey.ID})
+	test_utils.AssertTrue(t, err == nil, "Expected reader's GetAssetKey to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(readerAssetKey.KeyBytes, newKey.KeyBytes), "Expected new asset key")
+	asset, err := asset_mgmt_i.GetAssetManager(stub, reader).GetAsset(assetData.AssetId, readerAssetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(asset.PrivateData, assetData.PrivateData), "Expected private data to be unchanged")
+
+	// revoked reader doesn't get the new key
+	_, err = asset_mgmt_i.GetAssetManager(stub, revokedReader).GetAssetKey(assetData.AssetId, []string{revokedReader.GetPubPrivKeyId(), newKey.ID})
+	test_utils.AssertTrue(t, err != nil, "Expected revoked reader's GetAssetKey to fail")
+
+	// datatype key gives access to the new key only
+	datatypeKey, err := datatype_i.GetDatatypeSymKey(stub, owner, "datatype1", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "Expected GetDatatypeSymKey to succeed")
+	keyBytes, err := key_mgmt_i.GetKey(stub, []string{datatypeKey.ID, newKey.ID}, datatypeKey.KeyBytes)
+	test_utils.AssertTrue(t, err == nil, "Expected GetKey from datatype key to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(keyBytes, newKey.KeyBytes), "Expected new asset key")
+	hasPath, _ := key_mgmt_i.VerifyAccessPath(stub, []string{datatypeKey.ID, oldKey.ID})
+	test_utils.AssertTrue(t, !hasPath, "Expected access from datatype key to old key to be removed")
+
+	// write only access is kept
+	accessControl = data_model.AccessControl{UserId: writeOnlyUser.ID, AssetId: assetData.AssetId, Access: global.ACCESS_WRITE_ONLY}
+	hasAccess, err := asset_mgmt_i.GetAssetManager(stub, owner).CheckAccessToAsset(accessControl)
+	test_utils.AssertTrue(t, err == nil, "Expected CheckAccessToAsset to succeed")
+	test_utils.AssertTrue(t, hasAccess, "Expected write only access to be kept")
+
+	// write only access given by the grantor is moved to the new key
+	newWriteOnlyKeyID := key_mgmt_i.GetKeyIdForWriteOnlyAccess(assetData.AssetId, newKey.ID, grantor.ID)
+	keyBytes, err = key_mgmt_i.GetKey(stub, []string{writeOnlyUser2.GetPubPrivKeyId(), newWriteOnlyKeyID}, writeOnlyUser2.GetPrivateKey().KeyBytes)
+	test_utils.AssertTrue(t, err == nil, "Expected GetKey of grantor's write only key to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(keyBytes, newKey.KeyBytes), "Expected new asset key")
+	oldWriteOnlyKeyID := key_mgmt_i.GetKeyIdForWriteOnlyAccess(assetData.AssetId, oldKey.ID, grantor.ID)
+	hasPath, _ = key_mgmt_i.VerifyAccessPath(stub, []string{writeOnlyUser2.GetPubPrivKeyId(), oldWriteOnlyKeyID})
+	test_utils.AssertTrue(t, !hasPath, "Expected access to old write only key to be removed")
+	mstub.MockTransactionEnd("t123")
+}
+
+func TestSignAsset(t *testing.T) {
+	logger.Info("TestSignAsset function called")
+
+	mstub := setup(t)
+
+	owner := test_utils.CreateTestUser("owner1")
+	writer := test_utils.CreateTestUserWithKeyType("writer1", global.KEY_TYPE_EC_P256)
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	for _, user := range []data_model.User{owner, writer} {
+		err := user_mgmt_i.RegisterUserWithParams(stub, user, user, false)
+		test_utils.AssertTrue(t, err == nil, "Register user should not have returned an error")
+	}
+	mstub.MockTransactionEnd("t1")
+
+	// add signed asset
+	assetKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	assetData := test_utils.CreateTestAsset(asset_mgmt_i.GetAssetId("data_model.Asset", "asset1"))
+	assetData.AssetKeyId = assetKey.ID
+	assetData.AssetKeyHash = crypto.Hash(assetKey.KeyBytes)
+	assetData.PrivateData = test_utils.CreateTestAssetData("private1")
+	assetData.OwnerIds = []string{owner.ID}
+	assetData.SetSignerID(owner.ID)
+
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	err := asset_mgmt_i.GetAssetManager(stub, owner).AddAsset(assetData, assetKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	mstub.MockTransactionEnd("t123")
+
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	am := asset_mgmt_i.GetAssetManager(stub, owner)
+	err = am.VerifyAssetSignature(assetData.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected VerifyAssetSignature to succeed")
+	asset, err := am.GetAsset(assetData.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, asset.GetSignerID() == owner.ID, "Expected signer to be owner")
+	test_utils.AssertTrue(t, len(asset.GetSignature()) > 0, "Expected signature")
+	// signature can be verified off-chain with the signer's public key
+	publicKey, _ := crypto.ParseAnyPublicKeyB64(owner.PublicKeyB64)
+	test_utils.AssertTrue(t, crypto.VerifyWithAnyPublicKey(publicKey, asset.GetSignedBytes(), asset.GetSignature()), "Expected signature to be valid")
+	// private data is required
+	asset, _ = am.GetAsset(assetData.AssetId, data_model.Key{})
+	err = asset_mgmt_i.VerifyAssetSignature(stub, *asset)
+	test_utils.AssertTrue(t, err != nil, "Expected VerifyAssetSignature to fail without private data")
+	// give write access to writer
+	accessControl := data_model.AccessControl{UserId: writer.ID, AssetId: assetData.AssetId, Access: global.ACCESS_WRITE}
+	err = am.AddAccessToAsset(accessControl)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccessToAsset to succeed")
+	mstub.MockTransactionEnd("t123")
+
+	// signature remains valid after the asset key is rotated
+	newKey := data_model.Key{ID: "key2", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = asset_mgmt_i.GetAssetManager(stub, owner).RotateAssetKey(assetData.AssetId, assetKey, newKey)
+	test_utils.AssertTrue(t, err == nil, "Expected RotateAssetKey to succeed")
+	mstub.MockTransactionEnd("t123")
+	assetKey = newKey
+
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = asset_mgmt_i.GetAssetManager(stub, owner).VerifyAssetSignature(assetData.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected VerifyAssetSignature to succeed after key rotation")
+	mstub.MockTransactionEnd("t123")
+
+	// tampered asset fails verification
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	encryptedAsset, _ := asset_mgmt_i.GetEncryptedAssetData(stub, assetData.AssetId)
+	originalAsset := encryptedAsset.Copy()
+	encryptedAsset.PublicData = test_utils.CreateTestAssetData("tampered")
+	assetBytes, _ := json.Marshal(&encryptedAsset)
+	stub.PutState(assetData.AssetId, assetBytes)
+	mstub.MockTransactionEnd("t123")
+
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = asset_mgmt_i.GetAssetManager(stub, owner).VerifyAssetSignature(assetData.AssetId, assetKey)
+	_, ok := errors.Cause(err).(*custom_errors.InvalidSignatureError)
+	test_utils.AssertTrue(t, ok, "Expected InvalidSignatureError for tampered asset")
+	assetBytes, _ = json.Marshal(&originalAsset)
+	stub.PutState(assetData.AssetId, assetBytes)
+	mstub.MockTransactionEnd("t123")
+
+	// updating an asset signed by another user removes the signature
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = asset_mgmt_i.GetAssetManager(stub, writer)
+	asset, _ = am.GetAsset(assetData.AssetId, assetKey)
+	asset.PrivateData = test_utils.CreateTestAssetData("private2")
+	err = am.UpdateAsset(*asset, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected UpdateAsset to succeed")
+	mstub.MockTransactionEnd("t123")
+
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = asset_mgmt_i.GetAssetManager(stub, writer)
+	asset, _ = am.GetAsset(assetData.AssetId, assetKey)
+	test_utils.AssertTrue(t, len(asset.GetSignerID()) == 0, "Expected no signer")
+	err = am.VerifyAssetSignature(assetData.AssetId, assetKey)
+	_, ok = errors.Cause(err).(*custom_errors.InvalidSignatureError)
+	test_utils.AssertTrue(t, ok, "Expected InvalidSignatureError for unsigned asset")
+
+	// update signed by writer's EC key
+	asset.SetSignerID(writer.ID)
+	err = am.UpdateAsset(*asset, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected UpdateAsset to succeed")
+	mstub.MockTransactionEnd("t123")
+
+	mstub.MockTransactionStart("t123")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = asset_mgmt_i.GetAssetManager(stub, owner)
+	err = am.VerifyAssetSignature(assetData.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected VerifyAssetSignature to succeed")
+	asset, _ = am.GetAsset(assetData.AssetId, assetKey)
+	test_utils.AssertTrue(t, asset.GetSignerID() == writer.ID, "Expected signer to be writer")
+	mstub.MockTransactionEnd("t123")
+}
+
+func TestGetAssetHistory(t *testing.T) {
+	logger.Info("TestGetAssetHistory function called")
+
+	mstub := setup(t)
+
+	owner := test_utils.CreateTestUser("owner1")
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	err := user_mgmt_i.RegisterUserWithParams(stub, owner, owner, false)
+	test_utils.AssertTrue(t, err == nil, "Register user should not have returned an error")
+	mstub.MockTransactionEnd("t1")
+
+	// add asset at time 100
+	oldKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	assetData := test_utils.CreateTestAsset(asset_mgmt_i.GetAssetId("data_model.Asset", "asset1"))
+	assetData.AssetKeyId = oldKey.ID
+	assetData.AssetKeyHash = crypto.Hash(oldKey.KeyBytes)
+	assetData.PrivateData = test_utils.CreateTestAssetData("private1")
+	assetData.OwnerIds = []string{owner.ID}
+
+	mstub.MockTransactionStart("t2")
+	mstub.TxTimestamp = &timestamp.Timestamp{Seconds: 100}
+	stub = cached_stub.NewCachedStub(mstub)
+	err = asset_mgmt_i.GetAssetManager(stub, owner).AddAsset(assetData, oldKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	mstub.MockTransactionEnd("t2")
+
+	// update asset at time 200
+	mstub.MockTransactionStart("t3")
+	mstub.TxTimestamp = &timestamp.Timestamp{Seconds: 200}
+	stub = cached_stub.NewCachedStub(mstub)
+	assetData.PrivateData = test_utils.CreateTestAssetData("private2")
+	err = asset_mgmt_i.GetAssetManager(stub, owner).UpdateAsset(assetData, oldKey)
+	test_utils.AssertTrue(t, err == nil, "Expected UpdateAsset to succeed")
+	mstub.MockTransactionEnd("t3")
+
+	// rotate asset key at time 300
+	newKey := data_model.Key{ID: "key2", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	mstub.MockTransactionStart("t4")
+	mstub.TxTimestamp = &timestamp.Timestamp{Seconds: 300}
+	stub = cached_stub.NewCachedStub(mstub)
+	err = asset_mgmt_i.GetAssetManager(stub, owner).RotateAssetKey(assetData.AssetId, oldKey, newKey)
+	test_utils.AssertTrue(t, err == nil, "Expected RotateAssetKey to succeed")
+	mstub.MockTransactionEnd("t4")
+
+	// delete asset at time 400
+	mstub.MockTransactionStart("t5")
+	mstub.TxTimestamp = &timestamp.Timestamp{Seconds: 400}
+	stub = cached_stub.NewCachedStub(mstub)
+	err = asset_mgmt_i.GetAssetManager(stub, owner).DeleteAsset(assetData.AssetId, newKey)
+	test_utils.AssertTrue(t, err == nil, "Expected DeleteAsset to succeed")
+	mstub.MockTransactionEnd("t5")
+
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	am := asset_mgmt_i.GetAssetManager(stub, owner)
+
+	// history with old key
+	versions, err := am.GetAssetHistory(assetData.AssetId, oldKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetHistory to succeed")
+	test_utils.AssertTrue(t, len(versions) == 4, "Expected 4 versions")
+	for i, txID := range []string{"t2", "t3", "t4", "t5"} {
+		test_utils.AssertTrue(t, versions[i].TransactionID == txID, "Expected transaction ID "+txID)
+		test_utils.AssertTrue(t, versions[i].Timestamp == int64(100*(i+1)), "Expected version timestamp")
+	}
+	test_utils.AssertTrue(t, bytes.Equal(versions[0].Asset.PrivateData, test_utils.CreateTestAssetData("private1")), "Expected decrypted private data of version 1")
+	test_utils.AssertTrue(t, bytes.Equal(versions[1].Asset.PrivateData, test_utils.CreateTestAssetData("private2")), "Expected decrypted private data of version 2")
+	test_utils.AssertFalse(t, bytes.Equal(versions[2].Asset.PrivateData, test_utils.CreateTestAssetData("private2")), "Expected encrypted private data after key rotation")
+	test_utils.AssertTrue(t, versions[3].IsDelete, "Expected last version to be a delete")
+	test_utils.AssertTrue(t, len(versions[3].Asset.AssetId) == 0, "Expected empty asset for delete")
+
+	// history with new key
+	versions, err = am.GetAssetHistory(assetData.AssetId, newKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetHistory to succeed")
+	test_utils.AssertFalse(t, bytes.Equal(versions[0].Asset.PrivateData, test_utils.CreateTestAssetData("private1")), "Expected encrypted private data before key rotation")
+	test_utils.AssertTrue(t, bytes.Equal(versions[2].Asset.PrivateData, test_utils.CreateTestAssetData("private2")), "Expected decrypted private data after key rotation")
+
+	// history without key
+	versions, err = am.GetAssetHistory(assetData.AssetId, data_model.Key{})
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetHistory to succeed")
+	test_utils.AssertFalse(t, bytes.Equal(versions[0].Asset.PrivateData, test_utils.CreateTestAssetData("private1")), "Expected encrypted private data without key")
+
+	// asset at time
+	asset, err := am.GetAssetAtTime(assetData.AssetId, oldKey, 50)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetAtTime to succeed")
+	test_utils.AssertTrue(t, len(asset.AssetId) == 0, "Expected empty asset before it was added")
+	asset, err = am.GetAssetAtTime(assetData.AssetId, oldKey, 150)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetAtTime to succeed")
+	test_utils.AssertTrue(t, asset.AssetId == assetData.AssetId, "Expected asset")
+	test_utils.AssertTrue(t, bytes.Equal(asset.PrivateData, test_utils.CreateTestAssetData("private1")), "Expected private data of version 1")
+	asset, err = am.GetAssetAtTime(assetData.AssetId, oldKey, 200)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetAtTime to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(asset.PrivateData, test_utils.CreateTestAssetData("private2")), "Expected private data of version 2")
+	asset, err = am.GetAssetAtTime(assetData.AssetId, oldKey, 400)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetAtTime to succeed")
+	test_utils.AssertTrue(t, len(asset.AssetId) == 0, "Expected empty asset after it was deleted")
+
+	_, err = am.GetAssetHistory("invalid", oldKey)
+	test_utils.AssertTrue(t, err != nil, "Expected GetAssetHistory with invalid asset ID to fail")
+	mstub.MockTransactionEnd("t6")
+}
+
+// reverseHistoryMockStub returns the history of a key newest first, like Fabric 2.x.
+type reverseHistoryMockStub struct {
+	*test_utils.NewMockStub
+}
+
+func (stub *reverseHistoryMockStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	iter, err := stub.NewMockStub.GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	modifications := []*queryresult.KeyModification{}
+	for iter.HasNext() {
+		modification, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		modifications = append([]*queryresult.KeyModification{modification}, modifications...)
+	}
+	return &sliceHistoryQueryIterator{modifications: modifications}, nil
+}
+
+type sliceHistoryQueryIterator struct {
+	modifications []*queryresult.KeyModification
+}
+
+func (iter *sliceHistoryQueryIterator) HasNext() bool {
+	return len(iter.modifications) > 0
+}
+
+func (iter *sliceHistoryQueryIterator) Next() (*queryresult.KeyModification, error) {
+	modification := iter.modifications[0]
+	iter.modifications = iter.modifications[1:]
+	return modification, nil
+}
+
+func (iter *sliceHistoryQueryIterator) Close() error {
+	return nil
+}
+
+func TestGetAssetHistory_SameSecond(t *testing.T) {
+	logger.Info("TestGetAssetHistory_SameSecond function called")
+
+	mstub := setup(t)
+
+	owner := test_utils.CreateTestUser("owner1")
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	err := user_mgmt_i.RegisterUserWithParams(stub, owner, owner, false)
+	test_utils.AssertTrue(t, err == nil, "Register user should not have returned an error")
+	mstub.MockTransactionEnd("t1")
+
+	// add and update the asset three times in the same second
+	assetKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	assetData := test_utils.CreateTestAsset(asset_mgmt_i.GetAssetId("data_model.Asset", "asset1"))
+	assetData.AssetKeyId = assetKey.ID
+	assetData.AssetKeyHash = crypto.Hash(assetKey.KeyBytes)
+	assetData.OwnerIds = []string{owner.ID}
+	for i, txID := range []string{"t2", "t3", "t4"} {
+		mstub.MockTransactionStart(txID)
+		mstub.TxTimestamp = &timestamp.Timestamp{Seconds: 100, Nanos: int32(100 * (i + 1))}
+		stub = cached_stub.NewCachedStub(mstub)
+		assetData.PrivateData = test_utils.CreateTestAssetData("private" + txID)
+		if i == 0 {
+			err = asset_mgmt_i.GetAssetManager(stub, owner).AddAsset(assetData, assetKey, true)
+		} else {
+			err = asset_mgmt_i.GetAssetManager(stub, owner).UpdateAsset(assetData, assetKey)
+		}
+		test_utils.AssertTrue(t, err == nil, "Expected AddAsset or UpdateAsset to succeed")
+		mstub.MockTransactionEnd(txID)
+	}
+
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(&reverseHistoryMockStub{NewMockStub: mstub})
+	am := asset_mgmt_i.GetAssetManager(stub, owner)
+	versions, err := am.GetAssetHistory(assetData.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetHistory to succeed")
+	test_utils.AssertTrue(t, len(versions) == 3, "Expected 3 versions")
+	for i, txID := range []string{"t2", "t3", "t4"} {
+		test_utils.AssertTrue(t, versions[i].TransactionID == txID, "Expected transaction ID "+txID)
+	}
+	asset, err := am.GetAssetAtTime(assetData.AssetId, assetKey, 100)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetAtTime to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(asset.PrivateData, test_utils.CreateTestAssetData("privatet4")), "Expected private data of the last version")
+	mstub.MockTransactionEnd("t5")
+}
+
 func TestNormalizeAssetDatatypes(t *testing.T) {
 	mstub := setup(t)
 
@@ -403,3 +891,776 @@ func TestNormalizeAssetDatatypes(t *testing.T) {
 	test_utils.AssertSetsEqual(t, expectedDatatypes1, asset1.Datatypes)
 	mstub.MockTransactionEnd("t123")
 }
+
+func TestPutAsset_DatatypeSchema(t *testing.T) {
+	logger.Info("TestPutAsset_DatatypeSchema function called")
+
+	mstub := setup(t)
+	owner := test_utils.CreateTestUser("ownerId")
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	err := user_mgmt_i.RegisterUserWithParams(stub, owner, owner, false)
+	test_utils.AssertTrue(t, err == nil, "Register caller user should not have returned an error")
+	mstub.MockTransactionEnd("t1")
+
+	// register a datatype with a schema
+	schema := `{"type": "object", "required": ["private_data"], "properties": {
+		"public_data": {"type": "string"},
+		"private_data": {"type": "object", "required": ["age"], "properties": {"age": {"type": "integer", "minimum": 0}}}}}`
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.RegisterDatatype(stub, owner, []string{`{"datatype_id": "patient", "description": "patient", "is_acive": true, "schema": ` + schema + `}`})
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "patient", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	assetKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	assetData := data_model.Asset{
+		AssetId:      asset_mgmt_i.GetAssetId("data_model.Asset", "asset1"),
+		AssetKeyId:   assetKey.ID,
+		AssetKeyHash: crypto.Hash(assetKey.KeyBytes),
+		Datatypes:    []string{"patient"},
+		PublicData:   []byte("public1"),
+		PrivateData:  []byte(`{"age": -1}`),
+		OwnerIds:     []string{owner.ID},
+		Metadata:     make(map[string]string)}
+
+	// non-conforming private data is rejected
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = asset_mgmt_i.GetAssetManager(stub, owner).AddAsset(assetData, assetKey, true)
+	test_utils.AssertTrue(t, err != nil, "Expected AddAsset to fail")
+	_, ok := errors.Cause(err).(*custom_errors.SchemaValidationError)
+	test_utils.AssertTrue(t, ok, "Expected SchemaValidationError")
+	mstub.MockTransactionEnd("t3")
+
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	assetData.PrivateData = []byte(`{"age": 30}`)
+	err = asset_mgmt_i.GetAssetManager(stub, owner).AddAsset(assetData, assetKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	mstub.MockTransactionEnd("t4")
+
+	// unchanged private data is validated along with updated public data
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	am := asset_mgmt_i.GetAssetManager(stub, owner)
+	asset, err := am.GetAsset(assetData.AssetId, data_model.Key{ID: assetKey.ID})
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	asset.PublicData = []byte(`{"name": "Ann"}`)
+	err = am.UpdateAsset(*asset, assetKey)
+	test_utils.AssertTrue(t, err != nil, "Expected UpdateAsset with non-conforming public data to fail")
+	asset.PublicData = []byte("public2")
+	err = am.UpdateAsset(*asset, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected UpdateAsset to succeed")
+	mstub.MockTransactionEnd("t5")
+
+	// version 2 of the datatype renames age to years
+	systemAdmin := test_utils.CreateTestUser("systemAdmin")
+	systemAdmin.Role = global.ROLE_SYSTEM_ADMIN
+	schema2 := `{"type": "object", "required": ["private_data"], "properties": {
+		"private_data": {"type": "object", "required": ["years"], "properties": {"years": {"type": "integer", "minimum": 0}}}}}`
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeVersion(stub, systemAdmin, []string{"patient", `{"dict": [{"merge": ["private_data", {"dict": [{"merge": ["years", {"var": "private_data.age"}]}]}]}]}`})
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeVersion should be successful")
+	mstub.MockTransactionEnd("t6")
+
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.UpdateDatatype(stub, systemAdmin, []string{`{"datatype_id": "patient", "description": "patient", "schema": ` + schema2 + `}`})
+	test_utils.AssertTrue(t, err == nil, "UpdateDatatype should be successful")
+	mstub.MockTransactionEnd("t7")
+
+	// an asset at version 1 is still validated against the schema of version 1
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = asset_mgmt_i.GetAssetManager(stub, owner)
+	asset, err = am.GetAsset(assetData.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, asset.GetDatatypeVersion("patient") == 1, "Expected datatype version 1")
+	asset.PublicData = []byte("public3")
+	err = am.UpdateAsset(*asset, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected UpdateAsset of version 1 asset to succeed")
+	asset.PrivateData = []byte(`{"years": 30}`)
+	err = am.UpdateAsset(*asset, assetKey)
+	test_utils.AssertTrue(t, err != nil, "Expected UpdateAsset with version 2 data to fail")
+	validationErr, ok := errors.Cause(err).(*custom_errors.SchemaValidationError)
+	test_utils.AssertTrue(t, ok && validationErr.SchemaVersion == 1, "Expected SchemaValidationError for schema version 1")
+
+	// a new asset is validated against the schema of version 2
+	assetData.AssetId = asset_mgmt_i.GetAssetId("data_model.Asset", "asset2")
+	assetData.Metadata = make(map[string]string)
+	assetData.PrivateData = []byte(`{"age": 30}`)
+	err = am.AddAsset(assetData, assetKey, true)
+	test_utils.AssertTrue(t, err != nil, "Expected AddAsset with version 1 data to fail")
+	assetData.PrivateData = []byte(`{"years": 30}`)
+	err = am.AddAsset(assetData, assetKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	mstub.MockTransactionEnd("t8")
+}
+
+func TestMigrateAssets(t *testing.T) {
+	logger.Info("TestMigrateAssets function called")
+
+	mstub := setup(t)
+	owner := test_utils.CreateTestUser("ownerId")
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	err := user_mgmt_i.RegisterUserWithParams(stub, owner, owner, false)
+	test_utils.AssertTrue(t, err == nil, "Register caller user should not have returned an error")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.RegisterDatatype(stub, owner, []string{`{"datatype_id": "patient", "description": "patient", "is_acive": true}`})
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "patient", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t3")
+
+	// add assets at version 1 of the datatype
+	assetKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	assetIds := []string{}
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	am := asset_mgmt_i.GetAssetManager(stub, owner)
+	for i := 0; i < 3; i++ {
+		assetData := data_model.Asset{
+			AssetId:      asset_mgmt_i.GetAssetId("data_model.Asset", "asset"+strconv.Itoa(i)),
+			AssetKeyId:   assetKey.ID,
+			AssetKeyHash: crypto.Hash(assetKey.KeyBytes),
+			Datatypes:    []string{"patient"},
+			PublicData:   []byte("public"),
+			PrivateData:  []byte(`{"years": ` + strconv.Itoa(30+i) + `}`),
+			OwnerIds:     []string{owner.ID},
+			Metadata:     make(map[string]string)}
+		err = am.AddAsset(assetData, assetKey, true)
+		test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+		assetIds = append(assetIds, assetData.AssetId)
+	}
+
+	// assets without the datatype are not checked
+	for i := 0; i < 2; i++ {
+		assetData := data_model.Asset{
+			AssetId:      asset_mgmt_i.GetAssetId("data_model.Asset", "other"+strconv.Itoa(i)),
+			AssetKeyId:   assetKey.ID,
+			AssetKeyHash: crypto.Hash(assetKey.KeyBytes),
+			PublicData:   []byte("public"),
+			PrivateData:  []byte(`{"years": 40}`),
+			OwnerIds:     []string{owner.ID},
+			Metadata:     make(map[string]string)}
+		err = am.AddAsset(assetData, assetKey, true)
+		test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	}
+	mstub.MockTransactionEnd("t4")
+
+	// version 2 renames years to age
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = asset_mgmt_i.GetAssetManager(stub, owner)
+	asset, err := am.GetAsset(assetIds[0], assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	test_utils.AssertTrue(t, asset.GetDatatypeVersion("patient") == 1, "Expected datatype version 1")
+	systemAdmin := test_utils.CreateTestUser("systemAdmin")
+	systemAdmin.Role = global.ROLE_SYSTEM_ADMIN
+	_, err = datatype_i.AddDatatypeVersion(stub, systemAdmin, []string{"patient", `{"dict": [{"merge": ["private_data", {"dict": [{"merge": ["age", {"var": "private_data.years"}]}]}]}]}`})
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeVersion should be successful")
+	mstub.MockTransactionEnd("t5")
+
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = asset_mgmt_i.GetAssetManager(stub, owner)
+	_, _, err = am.MigrateAssets("patient", 1, 3, "", -1)
+	test_utils.AssertTrue(t, err != nil, "Expected MigrateAssets past the current version to fail")
+	_, _, err = am.MigrateAssets("patient", 1, 2, assetIds[0], -1)
+	test_utils.AssertTrue(t, err != nil, "Expected MigrateAssets with a previousKey outside the datatype's index rows to fail")
+
+	// page through the assets
+	migrated := []string{}
+	previousKey := ""
+	for page := 0; page == 0 || len(previousKey) > 0; page++ {
+		var migratedPage []string
+		migratedPage, previousKey, err = am.MigrateAssets("patient", 1, 2, previousKey, 2)
+		test_utils.AssertTrue(t, err == nil, "Expected MigrateAssets to succeed")
+		migrated = append(migrated, migratedPage...)
+		test_utils.AssertTrue(t, page < 2, "Expected MigrateAssets to finish in 2 pages")
+	}
+	test_utils.AssertTrue(t, len(migrated) == 3, "Expected 3 migrated assets")
+	mstub.MockTransactionEnd("t6")
+
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = asset_mgmt_i.GetAssetManager(stub, owner)
+	for i, assetId := range assetIds {
+		asset, err = am.GetAsset(assetId, assetKey)
+		test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+		test_utils.AssertTrue(t, string(asset.PrivateData) == `{"age":`+strconv.Itoa(30+i)+`}`, "Unexpected private data: "+string(asset.PrivateData))
+		test_utils.AssertTrue(t, asset.GetDatatypeVersion("patient") == 2, "Expected datatype version 2")
+	}
+
+	// migrated assets are not migrated again
+	migrated, previousKey, err = am.MigrateAssets("patient", 1, 2, "", -1)
+	test_utils.AssertTrue(t, err == nil, "Expected MigrateAssets to succeed")
+	test_utils.AssertTrue(t, len(migrated) == 0 && len(previousKey) == 0, "Expected no migrated assets")
+	mstub.MockTransactionEnd("t7")
+}
+
+func TestGetAssetsByDatatype(t *testing.T) {
+	logger.Info("TestGetAssetsByDatatype function called")
+
+	mstub := setup(t)
+	owner := test_utils.CreateTestUser("ownerId")
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	err := user_mgmt_i.RegisterUserWithParams(stub, owner, owner, false)
+	test_utils.AssertTrue(t, err == nil, "Register caller user should not have returned an error")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub, true, true)
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "patient", "patient", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "lab", "lab", true, "patient")
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub, true, true)
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "patient", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "lab", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t3")
+
+	// add 2 patient assets and 1 lab asset
+	assetKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	assetIds := []string{}
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	am := asset_mgmt_i.GetAssetManager(stub, owner)
+	for i, datatypeID := range []string{"patient", "patient", "lab"} {
+		assetData := data_model.Asset{
+			AssetId:      asset_mgmt_i.GetAssetId("data_model.Asset", "asset"+strconv.Itoa(i)),
+			AssetKeyId:   assetKey.ID,
+			AssetKeyHash: crypto.Hash(assetKey.KeyBytes),
+			Datatypes:    []string{datatypeID},
+			PublicData:   []byte("public"),
+			PrivateData:  []byte("private"),
+			OwnerIds:     []string{owner.ID},
+			Metadata:     make(map[string]string)}
+		err = am.AddAsset(assetData, assetKey, true)
+		test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+		assetIds = append(assetIds, assetData.AssetId)
+	}
+	mstub.MockTransactionEnd("t4")
+
+	getAssetIds := func(datatypeID string, ownerID string) []string {
+		iter, err := am.GetAssetsByDatatype(datatypeID, ownerID, false, false, []string{owner.GetPubPrivKeyId()}, "", -1, nil)
+		test_utils.AssertTrue(t, err == nil, "Expected GetAssetsByDatatype to succeed")
+		ids := []string{}
+		for iter.HasNext() {
+			asset, err := iter.Next()
+			test_utils.AssertTrue(t, err == nil, "Expected Next to succeed")
+			ids = append(ids, asset.AssetId)
+		}
+		iter.Close()
+		return ids
+	}
+
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = asset_mgmt_i.GetAssetManager(stub, owner)
+	ids := getAssetIds("patient", owner.ID)
+	test_utils.AssertTrue(t, len(ids) == 3, "Expected 3 assets of patient and its descendants")
+	test_utils.AssertSetsEqual(t, assetIds, ids)
+	ids = getAssetIds("lab", owner.ID)
+	test_utils.AssertTrue(t, len(ids) == 1 && ids[0] == assetIds[2], "Expected 1 lab asset")
+	ids = getAssetIds("patient", "otherUser")
+	test_utils.AssertTrue(t, len(ids) == 0, "Expected no assets of another owner")
+	_, err = am.GetAssetsByDatatype("unknown", owner.ID, false, false, nil, "", -1, nil)
+	test_utils.AssertTrue(t, err != nil, "Expected GetAssetsByDatatype of unknown datatype to fail")
+
+	// page through the assets
+	pagedIds := []string{}
+	previousKey := ""
+	for page := 0; page == 0 || len(previousKey) > 0; page++ {
+		iter, err := am.GetAssetsByDatatype("patient", owner.ID, true, false, []string{owner.GetPubPrivKeyId()}, previousKey, 2, nil)
+		test_utils.AssertTrue(t, err == nil, "Expected GetAssetsByDatatype to succeed")
+		assets, lastKey, err := iter.GetAssetPage()
+		test_utils.AssertTrue(t, err == nil, "Expected GetAssetPage to succeed")
+		for _, asset := range assets {
+			pagedIds = append(pagedIds, asset.AssetId)
+		}
+		if len(assets) < 2 {
+			lastKey = ""
+		}
+		previousKey = lastKey
+		test_utils.AssertTrue(t, page < 2, "Expected paging to finish in 2 pages")
+	}
+	test_utils.AssertSetsEqual(t, assetIds, pagedIds)
+	mstub.MockTransactionEnd("t5")
+
+	// change the datatype of an asset and delete another
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = asset_mgmt_i.GetAssetManager(stub, owner)
+	asset, err := am.GetAsset(assetIds[0], assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset to succeed")
+	asset.Datatypes = []string{"lab"}
+	err = am.UpdateAsset(*asset, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected UpdateAsset to succeed")
+	err = am.DeleteAsset(assetIds[2], assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected DeleteAsset to succeed")
+	mstub.MockTransactionEnd("t6")
+
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	am = asset_mgmt_i.GetAssetManager(stub, owner)
+	ids = getAssetIds("lab", owner.ID)
+	test_utils.AssertTrue(t, len(ids) == 1 && ids[0] == assetIds[0], "Expected updated asset to be a lab asset")
+	ids = getAssetIds("patient", owner.ID)
+	test_utils.AssertSetsEqual(t, assetIds[:2], ids)
+	mstub.MockTransactionEnd("t7")
+}
+
+func TestRebuildDatatypeAssetIndex(t *testing.T) {
+	logger.Info("TestRebuildDatatypeAssetIndex function called")
+
+	mstub := setup(t)
+	owner := test_utils.CreateTestUser("ownerId")
+	systemAdmin := test_utils.CreateTestUser("systemAdmin")
+	systemAdmin.Role = global.ROLE_SYSTEM_ADMIN
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	err := user_mgmt_i.RegisterUserWithParams(stub, owner, owner, false)
+	test_utils.AssertTrue(t, err == nil, "Register caller user should not have returned an error")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub, true, true)
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "patient", "patient", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub, true, true)
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "patient", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t3")
+
+	// add 2 patient assets
+	assetKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	assetIds := []string{}
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	for i := 0; i < 2; i++ {
+		assetData := data_model.Asset{
+			AssetId:      asset_mgmt_i.GetAssetId("data_model.Asset", "asset"+strconv.Itoa(i)),
+			AssetKeyId:   assetKey.ID,
+			AssetKeyHash: crypto.Hash(assetKey.KeyBytes),
+			Datatypes:    []string{"patient"},
+			PublicData:   []byte("public"),
+			PrivateData:  []byte("private"),
+			OwnerIds:     []string{owner.ID},
+			Metadata:     make(map[string]string)}
+		err = asset_mgmt_i.GetAssetManager(stub, owner).AddAsset(assetData, assetKey, true)
+		test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+		assetIds = append(assetIds, assetData.AssetId)
+	}
+	mstub.MockTransactionEnd("t4")
+
+	// remove the index rows, as for assets added before the index existed
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	table := index.GetTable(stub, global.INDEX_DATATYPE_ASSET)
+	iter, err := table.GetRowsByPartialKey([]string{"datatype_id", "owner_id"}, []string{"patient", owner.ID})
+	test_utils.AssertTrue(t, err == nil, "Expected GetRowsByPartialKey to succeed")
+	rowIds := []string{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		test_utils.AssertTrue(t, err == nil, "Expected Next to succeed")
+		row := make(map[string]string)
+		json.Unmarshal(kv.GetValue(), &row)
+		rowIds = append(rowIds, row["row_id"])
+	}
+	iter.Close()
+	test_utils.AssertTrue(t, len(rowIds) == 2, "Expected 2 index rows")
+	for _, rowId := range rowIds {
+		err = table.DeleteRow(rowId)
+		test_utils.AssertTrue(t, err == nil, "Expected DeleteRow to succeed")
+	}
+	mstub.MockTransactionEnd("t5")
+
+	getAssetIds := func(txID string) []string {
+		mstub.MockTransactionStart(txID)
+		defer mstub.MockTransactionEnd(txID)
+		stub := cached_stub.NewCachedStub(mstub)
+		iter, err := asset_mgmt_i.GetAssetManager(stub, owner).GetAssetsByDatatype("patient", owner.ID, false, false, []string{owner.GetPubPrivKeyId()}, "", -1, nil)
+		test_utils.AssertTrue(t, err == nil, "Expected GetAssetsByDatatype to succeed")
+		defer iter.Close()
+		ids := []string{}
+		for iter.HasNext() {
+			asset, err := iter.Next()
+			test_utils.AssertTrue(t, err == nil, "Expected Next to succeed")
+			ids = append(ids, asset.AssetId)
+		}
+		return ids
+	}
+	test_utils.AssertTrue(t, len(getAssetIds("t6")) == 0, "Expected no indexed assets")
+
+	// only a system admin can rebuild the index
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, _, err = asset_mgmt_i.GetAssetManager(stub, owner).RebuildDatatypeAssetIndex("", -1)
+	test_utils.AssertTrue(t, err != nil, "Expected RebuildDatatypeAssetIndex by non admin to fail")
+	mstub.MockTransactionEnd("t7")
+
+	// rebuild the index one asset at a time
+	indexedIds := []string{}
+	previousKey := ""
+	for page := 0; page == 0 || len(previousKey) > 0; page++ {
+		txID := "t8" + strconv.Itoa(page)
+		mstub.MockTransactionStart(txID)
+		stub = cached_stub.NewCachedStub(mstub)
+		ids, lastKey, err := asset_mgmt_i.GetAssetManager(stub, systemAdmin).RebuildDatatypeAssetIndex(previousKey, 1)
+		test_utils.AssertTrue(t, err == nil, "Expected RebuildDatatypeAssetIndex to succeed")
+		mstub.MockTransactionEnd(txID)
+		indexedIds = append(indexedIds, ids...)
+		previousKey = lastKey
+		test_utils.AssertTrue(t, page < 10, "Expected rebuilding to finish")
+	}
+	for _, assetId := range assetIds {
+		test_utils.AssertInLists(t, assetId, indexedIds, "Expected asset to be indexed")
+	}
+	test_utils.AssertSetsEqual(t, assetIds, getAssetIds("t9"))
+}
+
+func TestAccessPolicy(t *testing.T) {
+	logger.Info("TestAccessPolicy function called")
+
+	mstub := setup(t)
+
+	systemAdmin := test_utils.CreateTestUser("admin")
+	systemAdmin.Role = global.ROLE_SYSTEM_ADMIN
+	org1 := test_utils.CreateTestGroup("org1")
+	clinician := test_utils.CreateTestUser("clinician1")
+	clinician.SolutionPublicData = map[string]interface{}{"job": "clinician"}
+	receptionist := test_utils.CreateTestUser("receptionist1")
+	receptionist.SolutionPublicData = map[string]interface{}{"job": "receptionist"}
+	outsider := test_utils.CreateTestUser("outsider1")
+	outsider.SolutionPublicData = map[string]interface{}{"job": "clinician"}
+
+	// clinician and receptionist are members of org1
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	for _, user := range []data_model.User{clinician, receptionist, outsider} {
+		err := user_mgmt_i.RegisterUserWithParams(stub, user, user, false)
+		test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	}
+	err := user_mgmt_i.RegisterOrgWithParams(stub, org1, org1, false)
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterOrg to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	for _, userID := range []string{clinician.ID, receptionist.ID} {
+		err = user_mgmt_i.PutUserInGroup(stub, org1, userID, org1.ID, false)
+		test_utils.AssertTrue(t, err == nil, "Expected PutUserInGroup to succeed")
+	}
+	mstub.MockTransactionEnd("t2")
+
+	// only clinicians of org1 may write, and only members of org1 may read sensitive assets
+	policy := data_model.AccessPolicy{
+		Namespace: "Patient",
+		WriteRule: `{"and": [{"in": ["org1", {"var": "caller.groups"}]}, {"==": [{"var": "caller.solution_public_data.job"}, "clinician"]}]}`,
+		ReadRule:  `{"or": [{"in": ["org1", {"var": "caller.groups"}]}, {"!=": [{"var": "asset.metadata.sensitivity"}, "high"]}]}`,
+	}
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = abac_i.PutAccessPolicyWithParams(stub, clinician, policy)
+	test_utils.AssertTrue(t, err != nil, "Expected PutAccessPolicy by non system admin to fail")
+	err = abac_i.PutAccessPolicyWithParams(stub, systemAdmin, data_model.AccessPolicy{Namespace: "Patient", ReadRule: `{"in": [`})
+	test_utils.AssertTrue(t, err != nil, "Expected PutAccessPolicy with invalid rule to fail")
+	err = abac_i.PutAccessPolicyWithParams(stub, systemAdmin, policy)
+	test_utils.AssertTrue(t, err == nil, "Expected PutAccessPolicy to succeed")
+	mstub.MockTransactionEnd("t3")
+
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	savedPolicy, err := abac_i.GetAccessPolicyWithParams(stub, "Patient")
+	test_utils.AssertTrue(t, err == nil, "Expected GetAccessPolicy to succeed")
+	test_utils.AssertTrue(t, savedPolicy == policy, "Expected saved access policy")
+
+	// clinician can add an asset, receptionist can't
+	assetKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	assetData := test_utils.CreateTestAsset(asset_mgmt_i.GetAssetId("Patient", "patient1"))
+	assetData.IndexTableName = "Patient"
+	assetData.PublicData = []byte(`{"name": "patient1"}`)
+	assetData.Metadata["sensitivity"] = "high"
+	assetData.OwnerIds = []string{clinician.ID}
+	otherAssetKey := data_model.Key{ID: "key2", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	otherAssetData := test_utils.CreateTestAsset(asset_mgmt_i.GetAssetId("Patient", "patient2"))
+	otherAssetData.IndexTableName = "Patient"
+	otherAssetData.PublicData = []byte(`{"name": "patient2"}`)
+	err = asset_mgmt_i.GetAssetManager(stub, receptionist).AddAsset(otherAssetData, otherAssetKey, true)
+	test_utils.AssertTrue(t, err != nil, "Expected AddAsset by receptionist to fail")
+	err = asset_mgmt_i.GetAssetManager(stub, clinician).AddAsset(assetData, assetKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset by clinician to succeed")
+	mstub.MockTransactionEnd("t4")
+
+	// give write access to receptionist and read access to outsider
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	am := asset_mgmt_i.GetAssetManager(stub, clinician)
+	err = am.AddAccessToAsset(data_model.AccessControl{UserId: receptionist.ID, AssetId: assetData.AssetId, Access: global.ACCESS_WRITE})
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccessToAsset to succeed")
+	err = am.AddAccessToAsset(data_model.AccessControl{UserId: outsider.ID, AssetId: assetData.AssetId, Access: global.ACCESS_READ})
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccessToAsset to succeed")
+	mstub.MockTransactionEnd("t5")
+
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+
+	// receptionist has the asset key, but may only read
+	am = asset_mgmt_i.GetAssetManager(stub, receptionist)
+	hasAccess, err := am.CheckAccessToAsset(data_model.AccessControl{UserId: receptionist.ID, AssetId: assetData.AssetId, Access: global.ACCESS_WRITE})
+	test_utils.AssertTrue(t, err == nil && !hasAccess, "Expected receptionist not to have write access")
+	hasAccess, err = am.CheckAccessToAsset(data_model.AccessControl{UserId: receptionist.ID, AssetId: assetData.AssetId, Access: global.ACCESS_READ})
+	test_utils.AssertTrue(t, err == nil && hasAccess, "Expected receptionist to have read access")
+	err = am.UpdateAsset(assetData, assetKey)
+	test_utils.AssertTrue(t, err != nil, "Expected UpdateAsset by receptionist to fail")
+	forgedAssetData := assetData.Copy()
+	forgedAssetData.IndexTableName = ""
+	err = am.UpdateAsset(forgedAssetData, assetKey)
+	test_utils.AssertTrue(t, err != nil, "Expected UpdateAsset by receptionist without IndexTableName to fail")
+	asset, err := am.GetAsset(assetData.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset by receptionist to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(asset.PrivateData, assetData.PrivateData), "Expected decrypted private data")
+
+	// outsider has the asset key, but may not read a sensitive asset
+	am = asset_mgmt_i.GetAssetManager(stub, outsider)
+	outsiderAssetKey, err := am.GetAssetKey(assetData.AssetId, []string{outsider.GetPubPrivKeyId(), assetKey.ID})
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetKey by outsider to succeed")
+	_, err = am.GetAsset(assetData.AssetId, outsiderAssetKey)
+	test_utils.AssertTrue(t, err != nil, "Expected GetAsset by outsider to fail")
+	asset, err = am.GetAsset(assetData.AssetId, data_model.Key{})
+	test_utils.AssertTrue(t, err == nil && asset.AssetId == assetData.AssetId, "Expected GetAsset without asset key to succeed")
+	hasAccess, err = asset_mgmt_i.GetAssetManager(stub, clinician).CheckAccessToAsset(data_model.AccessControl{UserId: outsider.ID, AssetId: assetData.AssetId, Access: global.ACCESS_READ})
+	test_utils.AssertTrue(t, err == nil && !hasAccess, "Expected outsider not to have read access")
+	mstub.MockTransactionEnd("t6")
+
+	// clinician lowers the sensitivity of the asset
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	assetData.Metadata["sensitivity"] = "low"
+	err = asset_mgmt_i.GetAssetManager(stub, clinician).UpdateAsset(assetData, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected UpdateAsset by clinician to succeed")
+	mstub.MockTransactionEnd("t7")
+
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	asset, err = asset_mgmt_i.GetAssetManager(stub, outsider).GetAsset(assetData.AssetId, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAsset by outsider to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(asset.PrivateData, assetData.PrivateData), "Expected decrypted private data")
+	mstub.MockTransactionEnd("t8")
+
+	// without the policy, receptionist can write
+	mstub.MockTransactionStart("t9")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = abac_i.DeleteAccessPolicyWithParams(stub, clinician, "Patient")
+	test_utils.AssertTrue(t, err != nil, "Expected DeleteAccessPolicy by non system admin to fail")
+	err = abac_i.DeleteAccessPolicyWithParams(stub, systemAdmin, "Patient")
+	test_utils.AssertTrue(t, err == nil, "Expected DeleteAccessPolicy to succeed")
+	mstub.MockTransactionEnd("t9")
+
+	mstub.MockTransactionStart("t10")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = abac_i.DeleteAccessPolicyWithParams(stub, systemAdmin, "Patient")
+	test_utils.AssertTrue(t, err != nil, "Expected DeleteAccessPolicy of deleted policy to fail")
+	err = asset_mgmt_i.GetAssetManager(stub, receptionist).UpdateAsset(assetData, assetKey)
+	test_utils.AssertTrue(t, err == nil, "Expected UpdateAsset by receptionist to succeed")
+	mstub.MockTransactionEnd("t10")
+}
+
+func TestTimeBoundAccess(t *testing.T) {
+	logger.Info("TestTimeBoundAccess function called")
+
+	mstub := setup(t)
+
+	owner := test_utils.CreateTestUser("owner1")
+	reader := test_utils.CreateTestUser("reader1")
+	mstub.MockTransactionStart("t1")
+	mstub.TxTimestamp = &timestamp.Timestamp{Seconds: 100}
+	stub := cached_stub.NewCachedStub(mstub)
+	for _, user := range []data_model.User{owner, reader} {
+		err := user_mgmt_i.RegisterUserWithParams(stub, user, user, false)
+		test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	}
+	mstub.MockTransactionEnd("t1")
+
+	assetKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	assetData := test_utils.CreateTestAsset(asset_mgmt_i.GetAssetId("data_model.Asset", "asset1"))
+	assetData.AssetKeyId = assetKey.ID
+	assetData.AssetKeyHash = crypto.Hash(assetKey.KeyBytes)
+	assetData.OwnerIds = []string{owner.ID}
+	mstub.MockTransactionStart("t2")
+	mstub.TxTimestamp = &timestamp.Timestamp{Seconds: 100}
+	stub = cached_stub.NewCachedStub(mstub)
+	err := asset_mgmt_i.GetAssetManager(stub, owner).AddAsset(assetData, assetKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	mstub.MockTransactionEnd("t2")
+
+	// invalid time bounds
+	mstub.MockTransactionStart("t3")
+	mstub.TxTimestamp = &timestamp.Timestamp{Seconds: 100}
+	stub = cached_stub.NewCachedStub(mstub)
+	am := asset_mgmt_i.GetAssetManager(stub, owner)
+	accessControl := data_model.AccessControl{UserId: reader.ID, AssetId: assetData.AssetId, Access: global.ACCESS_READ, NotBefore: 300, ExpirationDate: 200}
+	err = am.AddAccessToAsset(accessControl)
+	test_utils.AssertTrue(t, err != nil, "Expected AddAccessToAsset with NotBefore after ExpirationDate to fail")
+	accessControl = data_model.AccessControl{UserId: reader.ID, AssetId: assetData.AssetId, Access: global.ACCESS_DENY, ExpirationDate: 300}
+	err = am.AddAccessToAsset(accessControl)
+	test_utils.AssertTrue(t, err != nil, "Expected AddAccessToAsset of deny entry with ExpirationDate to fail")
+
+	// read access from 200 until 300
+	accessControl = data_model.AccessControl{UserId: reader.ID, AssetId: assetData.AssetId, Access: global.ACCESS_READ, NotBefore: 200, ExpirationDate: 300}
+	err = am.AddAccessToAsset(accessControl)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccessToAsset to succeed")
+	mstub.MockTransactionEnd("t3")
+
+	checkAccess := func(txID string, txTime int64, expectedAccess bool) {
+		mstub.MockTransactionStart(txID)
+		mstub.TxTimestamp = &timestamp.Timestamp{Seconds: txTime}
+		stub := cached_stub.NewCachedStub(mstub)
+		am := asset_mgmt_i.GetAssetManager(stub, reader)
+		hasAccess, err := am.CheckAccessToAsset(data_model.AccessControl{UserId: reader.ID, AssetId: assetData.AssetId, Access: global.ACCESS_READ})
+		test_utils.AssertTrue(t, err == nil, "Expected CheckAccessToAsset to succeed")
+		test_utils.AssertTrue(t, hasAccess == expectedAccess, "Unexpected access at "+strconv.FormatInt(txTime, 10))
+		readerAssetKey, err := am.GetAssetKey(assetData.AssetId, []string{reader.GetPubPrivKeyId(), assetKey.ID})
+		if expectedAccess {
+			test_utils.AssertTrue(t, err == nil, "Expected GetAssetKey to succeed")
+			test_utils.AssertTrue(t, bytes.Equal(readerAssetKey.KeyBytes, assetKey.KeyBytes), "Expected asset key")
+		} else {
+			test_utils.AssertTrue(t, err != nil, "Expected GetAssetKey to fail")
+		}
+		mstub.MockTransactionEnd(txID)
+	}
+	checkAccess("t4", 150, false)
+	checkAccess("t5", 250, true)
+	checkAccess("t6", 300, false)
+
+	// remove expired access
+	mstub.MockTransactionStart("t7")
+	mstub.TxTimestamp = &timestamp.Timestamp{Seconds: 250}
+	stub = cached_stub.NewCachedStub(mstub)
+	removedKeyIDs, err := asset_mgmt_i.GetAssetManager(stub, owner).RemoveExpiredAccessFromAsset(assetData.AssetId)
+	test_utils.AssertTrue(t, err == nil, "Expected RemoveExpiredAccessFromAsset to succeed")
+	test_utils.AssertTrue(t, len(removedKeyIDs) == 0, "Expected access not to be expired yet")
+	mstub.MockTransactionEnd("t7")
+
+	mstub.MockTransactionStart("t8")
+	mstub.TxTimestamp = &timestamp.Timestamp{Seconds: 300}
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = asset_mgmt_i.GetAssetManager(stub, reader).RemoveExpiredAccessFromAsset(assetData.AssetId)
+	test_utils.AssertTrue(t, err != nil, "Expected RemoveExpiredAccessFromAsset by non owner to fail")
+	removedKeyIDs, err = asset_mgmt_i.GetAssetManager(stub, owner).RemoveExpiredAccessFromAsset(assetData.AssetId)
+	test_utils.AssertTrue(t, err == nil, "Expected RemoveExpiredAccessFromAsset to succeed")
+	test_utils.AssertTrue(t, len(removedKeyIDs) == 1 && removedKeyIDs[0] == reader.GetPubPrivKeyId(), "Expected reader's access to be removed")
+	mstub.MockTransactionEnd("t8")
+
+	mstub.MockTransactionStart("t9")
+	mstub.TxTimestamp = &timestamp.Timestamp{Seconds: 300}
+	stub = cached_stub.NewCachedStub(mstub)
+	edgeValue, _, err := key_mgmt_i.GetAccessEdge(stub, reader.GetPubPrivKeyId(), assetKey.ID)
+	test_utils.AssertTrue(t, err == nil && len(edgeValue) == 0, "Expected access edge to be removed")
+	ownerAssetKey, err := asset_mgmt_i.GetAssetManager(stub, owner).GetAssetKey(assetData.AssetId, []string{owner.GetPubPrivKeyId(), assetKey.ID})
+	test_utils.AssertTrue(t, err == nil && bytes.Equal(ownerAssetKey.KeyBytes, assetKey.KeyBytes), "Expected owner's access to be kept")
+	mstub.MockTransactionEnd("t9")
+}
+
+func TestAccessDeny_FieldAccess(t *testing.T) {
+	logger.Info("TestAccessDeny_FieldAccess function called")
+
+	mstub := setup(t)
+	owner := test_utils.CreateTestUser("owner1")
+	clinician := test_utils.CreateTestUser("clinician1")
+	clinicianKey := clinician.GetPrivateKey()
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	for _, user := range []data_model.User{owner, clinician} {
+		err := user_mgmt_i.RegisterUserWithParams(stub, user, user, false)
+		test_utils.AssertTrue(t, err == nil, "Register user should not have returned an error")
+	}
+	mstub.MockTransactionEnd("t1")
+
+	// add field encrypted asset and give clinician access to the diagnosis field
+	assetKey := data_model.Key{ID: "key1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	assetData := test_utils.CreateTestAsset(asset_mgmt_i.GetAssetId("data_model.Asset", "asset1"))
+	assetData.OwnerIds = []string{owner.ID}
+	assetData.AssetKeyId = assetKey.ID
+	assetData.AssetKeyHash = crypto.Hash(assetKey.KeyBytes)
+	assetData.PrivateData = []byte(`{"diagnosis":"flu","ssn":"123-45-6789"}`)
+	assetData.SetFieldEncryption(true)
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	am := asset_mgmt_i.GetAssetManager(stub, owner)
+	err := am.AddAsset(assetData, assetKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	accessControl := data_model.AccessControl{UserId: clinician.ID, AssetId: assetData.AssetId, Access: global.ACCESS_READ, AssetKey: &assetKey, UserKey: &clinicianKey, Fields: []string{"diagnosis"}}
+	err = asset_mgmt_i.GetAssetManager(stub, owner).AddAccessToAsset(accessControl)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccessToAsset to succeed")
+	mstub.MockTransactionEnd("t3")
+
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	asset, err := asset_mgmt_i.GetAssetManager(stub, clinician).GetAsset(assetData.AssetId, data_model.Key{})
+	test_utils.AssertTrue(t, err == nil && string(asset.PrivateData) == `{"diagnosis":"flu"}`, "Expected the diagnosis field")
+	mstub.MockTransactionEnd("t4")
+
+	// deny entry takes precedence over the field grant
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	denyAccessControl := data_model.AccessControl{UserId: clinician.ID, AssetId: assetData.AssetId, Access: global.ACCESS_DENY}
+	err = asset_mgmt_i.GetAssetManager(stub, owner).AddAccessToAsset(denyAccessControl)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccessToAsset with deny to succeed")
+	mstub.MockTransactionEnd("t5")
+
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	asset, _ = asset_mgmt_i.GetAssetManager(stub, clinician).GetAsset(assetData.AssetId, data_model.Key{})
+	test_utils.AssertTrue(t, asset == nil || !bytes.Contains(asset.PrivateData, []byte("flu")), "Expected no decrypted fields for a denied user")
+	mstub.MockTransactionEnd("t6")
+
+	// field access is restored when the deny entry is removed
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = asset_mgmt_i.GetAssetManager(stub, owner).RemoveAccessFromAsset(denyAccessControl)
+	test_utils.AssertTrue(t, err == nil, "Expected RemoveAccessFromAsset with deny to succeed")
+	mstub.MockTransactionEnd("t7")
+
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	asset, err = asset_mgmt_i.GetAssetManager(stub, clinician).GetAsset(assetData.AssetId, data_model.Key{})
+	test_utils.AssertTrue(t, err == nil && string(asset.PrivateData) == `{"diagnosis":"flu"}`, "Expected the diagnosis field")
+	mstub.MockTransactionEnd("t8")
+}
@@ -91,12 +91,32 @@ const ACCESS_WRITE = "write"
 // ACCESS_WRITE_ONLY is an AccessControl.Access option that specifies write access without read access.
 const ACCESS_WRITE_ONLY = "write_only"
 
-// ACCESS_DENY is a Consent.Access option that specifies deny access.
+// ACCESS_DENY is a Consent.Access or AccessControl.Access option that specifies deny access.
 const ACCESS_DENY = "deny"
 
+// ACCESS_DENY_GRAPH is the graph of AccessControl deny entries, with an edge from each key to each user or group
+// denied access to it.
+const ACCESS_DENY_GRAPH = "AccessDenyGraph"
+
+// WRITE_ONLY_ACCESS_GRAPH is the graph of write only access grantors, with an edge from each asset key to each
+// user who added write only access to it. Write only access keys are keyed by the grantor.
+const WRITE_ONLY_ACCESS_GRAPH = "WriteOnlyAccessGraph"
+
 // EDGEDATA_ACCESS_TYPE is a key to be used for edgedata map[string]string.
 const EDGEDATA_ACCESS_TYPE = "AccessType"
 
+// EDGEDATA_NOT_BEFORE is a key to be used for edgedata map[string]string.
+// Its value is the time, in seconds since the epoch, before which the edge does not give access.
+const EDGEDATA_NOT_BEFORE = "NotBefore"
+
+// EDGEDATA_EXPIRATION_DATE is a key to be used for edgedata map[string]string.
+// Its value is the time, in seconds since the epoch, from which the edge no longer gives access.
+const EDGEDATA_EXPIRATION_DATE = "ExpirationDate"
+
+// EDGEDATA_VALIDITY_WINDOWS is a key to be used for edgedata map[string]string.
+// Its value is a JSON list of recurring windows during which the edge gives access.
+const EDGEDATA_VALIDITY_WINDOWS = "ValidityWindows"
+
 ////////////////////////////////////////////////////////////
 // Consent
 
@@ -104,18 +124,58 @@ const EDGEDATA_ACCESS_TYPE = "AccessType"
 const CONSENT_PREFIX = "Consent"
 const CONSENT_EDGE = "ConsentEdge"
 
+// CONSENT_DELEGATION_EDGE is the edge type of key graph edges from a consent key to the keys of consents delegated from it.
+const CONSENT_DELEGATION_EDGE = "ConsentDelegationEdge"
+
+// CONSENT_MAX_DELEGATION_DEPTH is the maximum length of a consent delegation chain.
+const CONSENT_MAX_DELEGATION_DEPTH = 5
+
 // INDEX_CONSENT stores the name of the consent index table.
 const INDEX_CONSENT = "Consent"
 
+// INDEX_DATATYPE_ASSET stores the name of the index table of assets by datatype and owner.
+const INDEX_DATATYPE_ASSET = "DatatypeAsset"
+
 // CONSENT_ASSET_NAMESPACE is the asset namespace for consents.
 const CONSENT_ASSET_NAMESPACE = "data_model.Consent"
 
+// CONSENT_LOG_NAMESPACE is the transaction log namespace for consent changes.
+const CONSENT_LOG_NAMESPACE = "consent_mgmt.ConsentChange"
+
+// PURPOSE_TREATMENT is a Consent.Purposes option for the purpose of treatment.
+const PURPOSE_TREATMENT = "treatment"
+
+// PURPOSE_RESEARCH is a Consent.Purposes option for the purpose of research.
+const PURPOSE_RESEARCH = "research"
+
+// PURPOSE_BILLING is a Consent.Purposes option for the purpose of billing.
+const PURPOSE_BILLING = "billing"
+
+// CONSENT_CONTEXT_PURPOSE is the request context key of the purpose of use when validating a consent.
+const CONSENT_CONTEXT_PURPOSE = "purpose"
+
+// CONSENT_RECEIPT_VERSION is the version of the Kantara Initiative Consent Receipt Specification of consent receipts.
+const CONSENT_RECEIPT_VERSION = "KI-CR-v1.1.0"
+
+// CONSENT_MAX_BATCH_SIZE is the maximum number of consents that can be put in one PutConsents call.
+const CONSENT_MAX_BATCH_SIZE = 100
+
 /////////////////////////////////////////////////////////////
 // Datatype
 
 const DATATYPE_GRAPH = "DatatypeGraph"
+
+// DATATYPE_KEY_OWNER_GRAPH is the graph of datatype sym key owners, with an edge from each datatype to each owner
+// that has a sym key for it.
+const DATATYPE_KEY_OWNER_GRAPH = "DatatypeKeyOwnerGraph"
 const DATATYPE_PREFIX = "Datatype"
 
+// DATATYPE_SCHEMA_PREFIX is the prefix of ledger keys of datatype schema versions.
+const DATATYPE_SCHEMA_PREFIX = "DatatypeSchema"
+
+// DATATYPE_MIGRATION_PREFIX is the prefix of ledger keys of datatype migration rules.
+const DATATYPE_MIGRATION_PREFIX = "DatatypeMigration"
+
 // ROOT_DATATYPE_ID is id of ROOT datatype_i. All other datatypes are children of ROOT.
 const ROOT_DATATYPE_ID = "ROOT"
 
@@ -131,10 +191,44 @@ const DATASTORE_TYPE_DEFAULT_LEDGER = "ds.Ledger"
 //DATASTORE_ASSET_METADATA_KEY is the key to define datastore metadata in asset metadata
 const DATASTORE_CONNECTION_ID_METADATA_KEY = "ds.ConnectionID"
 
+// SIGNER_ID_METADATA_KEY is the key to define the ID of the user who signed the asset in asset metadata
+const SIGNER_ID_METADATA_KEY = "sig.SignerID"
+
+// SIGNATURE_METADATA_KEY is the key to define the base64 encoded asset signature in asset metadata
+const SIGNATURE_METADATA_KEY = "sig.Signature"
+
+// FIELD_ENCRYPTION_METADATA_KEY is the key to enable field-level encryption of private data in asset metadata
+const FIELD_ENCRYPTION_METADATA_KEY = "fe.Enabled"
+
+// FIELD_KEY_PREFIX is the prefix of the IDs of field keys derived from asset keys
+const FIELD_KEY_PREFIX = "field"
+
+// DELETED_AT_METADATA_KEY is the key to define the timestamp at which the asset was soft deleted in asset metadata
+const DELETED_AT_METADATA_KEY = "del.DeletedAt"
+
+// DELETED_BY_METADATA_KEY is the key to define the ID of the user who soft deleted the asset in asset metadata
+const DELETED_BY_METADATA_KEY = "del.DeletedBy"
+
+// INDEX_DELETED_AT_FIELD is the field of an asset's index row that holds the time at which the asset was
+// soft deleted. It is only set for soft deleted assets, or for all assets if the table has an index on it.
+const INDEX_DELETED_AT_FIELD = "del_deleted_at"
+
+// ASSET_LOG_NAMESPACE is the transaction log namespace for soft deletes, restores, and purges of assets.
+const ASSET_LOG_NAMESPACE = "asset_mgmt.AssetChange"
+
+// DATATYPE_VERSION_METADATA_PREFIX is the prefix of the keys to define the version of each datatype the asset data conforms to in asset metadata
+const DATATYPE_VERSION_METADATA_PREFIX = "dtv."
+
 // default data store IDs
 const DEFAULT_LEDGER_DATASTORE_ID = "ledger_"
 const DEFAULT_CLOUDANT_DATASTORE_ID = "cloudant_"
 
+/////////////////////////////////////////////////////////////
+// Key provider
+
+// KMS_KEY_ID_SEPARATOR separates the key provider type from the provider's key ID in a KMS key ID.
+const KMS_KEY_ID_SEPARATOR = ":"
+
 /////////////////////////////////////////////////////////////
 // Key management
 
@@ -154,10 +248,62 @@ const KEY_TYPE_PUBLIC = "public"
 // KEY_TYPE_SYM is a Key.Type option that specifies a sym key.
 const KEY_TYPE_SYM = "sym"
 
+// KEY_TYPE_RSA is the asymmetric key type of RSA public and private keys, as returned by crypto.GetKeyType.
+const KEY_TYPE_RSA = "rsa"
+
+// KEY_TYPE_EC_P256 is the asymmetric key type of EC P-256 public and private keys, used for ECDSA and ECDH.
+const KEY_TYPE_EC_P256 = "ec_p256"
+
+// KEY_TYPE_ED25519 is the asymmetric key type of Ed25519 public and private keys, used for Ed25519 and X25519.
+const KEY_TYPE_ED25519 = "ed25519"
+
+// EDGEDATA_ENCRYPTION_SCHEME is a key to be used for key graph edgedata map[string]string.
+// It specifies how the target key is encrypted when the start key is an RSA public or private key.
+// If not specified, ENCRYPTION_SCHEME_PKCS1V15 is used. EC start keys always use ECIES.
+const EDGEDATA_ENCRYPTION_SCHEME = "EncryptionScheme"
+
+// ENCRYPTION_SCHEME_PKCS1V15 is an EDGEDATA_ENCRYPTION_SCHEME option that specifies RSA PKCS#1 v1.5 encryption.
+const ENCRYPTION_SCHEME_PKCS1V15 = "pkcs1v15"
+
+// ENCRYPTION_SCHEME_OAEP is an EDGEDATA_ENCRYPTION_SCHEME option that specifies RSA-OAEP encryption.
+const ENCRYPTION_SCHEME_OAEP = "oaep"
+
+// ENCRYPTION_SCHEME_HYBRID is an EDGEDATA_ENCRYPTION_SCHEME option that specifies RSA-OAEP wrapped sym key
+// encryption, which can be used for target keys of any size.
+const ENCRYPTION_SCHEME_HYBRID = "hybrid"
+
 const KEY_PREFIX_PUB_PRIV = "pub-priv"
 const KEY_PREFIX_SYM_KEY = "sym"
 const KEY_PREFIX_LOG_SYM_KEY = "log-sym"
 const KEY_PREFIX_PRIV_HASH = "private-hash"
+const KEY_PREFIX_RECOVERY_SHARE = "recovery-share"
+
+/////////////////////////////////////////////////////////////
+// Key recovery
+
+// KEY_RECOVERY_PREFIX is the prefix for all key recovery policy ledger keys.
+const KEY_RECOVERY_PREFIX = "KeyRecovery"
+
+// KEY_RECOVERY_SHARE_ASSET_NAMESPACE is the asset namespace for key recovery shares.
+const KEY_RECOVERY_SHARE_ASSET_NAMESPACE = "data_model.KeyRecoveryShare"
+
+/////////////////////////////////////////////////////////////
+// Role-based access control
+
+// RBAC_ROLE_PREFIX is the prefix for all RBAC role ledger keys.
+const RBAC_ROLE_PREFIX = "RBACRole"
+
+// RBAC_GRAPH is the graph of RBAC role bindings, with an edge from each role to each user or group it's bound to.
+const RBAC_GRAPH = "RBACGraph"
+
+// PERMISSION_INVOKE is an RBAC permission option that specifies permission to invoke a function.
+const PERMISSION_INVOKE = "invoke"
+
+/////////////////////////////////////////////////////////////
+// Attribute-based access control
+
+// ABAC_POLICY_PREFIX is the prefix for all ABAC access policy ledger keys.
+const ABAC_POLICY_PREFIX = "ABACPolicy"
 
 /////////////////////////////////////////////////////////////
 // History
@@ -22,4 +22,55 @@
 
 package global
 
-import ()
+import (
+	"time"
+)
+
+// TimeWindow is a recurring window of time.
+// Weekdays are the days of the week of the window, 0 for Sunday to 6 for Saturday. If empty, the window recurs every day.
+// StartHour and EndHour are the UTC hours at which the window starts and ends. The window includes
+// StartHour and excludes EndHour.
+type TimeWindow struct {
+	Weekdays  []int `json:"weekdays,omitempty"`
+	StartHour int   `json:"start_hour"`
+	EndHour   int   `json:"end_hour"`
+}
+
+// Contains returns true if currTime, in seconds since the epoch, is within the window.
+func (w TimeWindow) Contains(currTime int64) bool {
+	t := time.Unix(currTime, 0).UTC()
+	if len(w.Weekdays) > 0 {
+		isWeekday := false
+		for _, weekday := range w.Weekdays {
+			if time.Weekday(weekday) == t.Weekday() {
+				isWeekday = true
+				break
+			}
+		}
+		if !isWeekday {
+			return false
+		}
+	}
+	return t.Hour() >= w.StartHour && t.Hour() < w.EndHour
+}
+
+// IsInEffect returns true if currTime is not before notBefore, is before expirationDate, and is within one of
+// windows. All times are in seconds since the epoch. notBefore and expirationDate are ignored if 0, and windows
+// if empty.
+func IsInEffect(currTime int64, notBefore int64, expirationDate int64, windows []TimeWindow) bool {
+	if notBefore != 0 && currTime < notBefore {
+		return false
+	}
+	if expirationDate != 0 && expirationDate-currTime <= 0 {
+		return false
+	}
+	if len(windows) == 0 {
+		return true
+	}
+	for _, window := range windows {
+		if window.Contains(currTime) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,496 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+// Package json_schema validates JSON data against a JSON Schema.
+//
+// It supports the following JSON Schema (draft-07) validation keywords: type, enum, const, properties, required,
+// additionalProperties, minProperties, maxProperties, items, minItems, maxItems, uniqueItems, minLength, maxLength,
+// pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, allOf, anyOf, oneOf, and not.
+// Annotation keywords such as $schema, $id, title, description, and default are ignored.
+// Any other keyword, including $ref, is rejected by ValidateSchema.
+package json_schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"common/bchcls/utils"
+
+	"github.com/pkg/errors"
+)
+
+// annotationKeywords are keywords that don't affect validation.
+var annotationKeywords = []string{"$schema", "$id", "$comment", "title", "description", "default", "examples"}
+
+// validTypes are the JSON Schema primitive types.
+var validTypes = []string{"null", "boolean", "object", "array", "number", "integer", "string"}
+
+// ValidationError is returned by Validate if data does not conform to the schema.
+// Path is a JSON pointer to the invalid value, e.g. "/private_data/age"; it is empty for the whole document.
+type ValidationError struct {
+	Path   string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	path := e.Path
+	if len(path) == 0 {
+		path = "/"
+	}
+	return fmt.Sprintf("%v: %v", path, e.Reason)
+}
+
+// ValidateSchema returns an error if schema is not a valid JSON Schema document,
+// or if it uses keywords that are not supported by this package.
+func ValidateSchema(schema []byte) error {
+	var schemaObj interface{}
+	err := unmarshal(schema, &schemaObj)
+	if err != nil {
+		return errors.Wrap(err, "Schema is not valid JSON")
+	}
+	return checkSchema(schemaObj, "")
+}
+
+// Validate validates data against schema.
+// Returns a *ValidationError for the first violation found, or another error if schema or data is not valid JSON.
+func Validate(schema []byte, data []byte) error {
+	var schemaObj interface{}
+	err := unmarshal(schema, &schemaObj)
+	if err != nil {
+		return errors.Wrap(err, "Schema is not valid JSON")
+	}
+	err = checkSchema(schemaObj, "")
+	if err != nil {
+		return err
+	}
+	var dataObj interface{}
+	err = unmarshal(data, &dataObj)
+	if err != nil {
+		return errors.Wrap(err, "Data is not valid JSON")
+	}
+	return validate(schemaObj, dataObj, "")
+}
+
+func unmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(v)
+	if err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("Unexpected data after JSON value")
+	}
+	return nil
+}
+
+// checkSchema checks keywords of a schema and its subschemas.
+func checkSchema(schema interface{}, path string) error {
+	if _, ok := schema.(bool); ok {
+		return nil
+	}
+	schemaMap, ok := schema.(map[string]interface{})
+	if !ok {
+		return errors.Errorf("Invalid schema at %v: schema must be an object or a boolean", schemaPath(path))
+	}
+	for keyword, value := range schemaMap {
+		keywordPath := path + "/" + keyword
+		var err error
+		switch keyword {
+		case "type":
+			types, ok := getTypes(value)
+			if !ok || len(types) == 0 {
+				err = errors.New("type must be a type name or an array of type names")
+			}
+			for _, t := range types {
+				if !utils.InList(validTypes, t) {
+					err = errors.Errorf("unknown type %v", t)
+				}
+			}
+		case "enum":
+			if _, ok := value.([]interface{}); !ok {
+				err = errors.New("enum must be an array")
+			}
+		case "const":
+		case "properties":
+			properties, ok := value.(map[string]interface{})
+			if !ok {
+				err = errors.New("properties must be an object")
+				break
+			}
+			for name, propertySchema := range properties {
+				err = checkSchema(propertySchema, keywordPath+"/"+name)
+				if err != nil {
+					return err
+				}
+			}
+		case "required":
+			names, ok := value.([]interface{})
+			if !ok {
+				err = errors.New("required must be an array of strings")
+			}
+			for _, name := range names {
+				if _, ok := name.(string); !ok {
+					err = errors.New("required must be an array of strings")
+				}
+			}
+		case "additionalProperties", "items", "not":
+			if err = checkSchema(value, keywordPath); err != nil {
+				return err
+			}
+		case "allOf", "anyOf", "oneOf":
+			subschemas, ok := value.([]interface{})
+			if !ok || len(subschemas) == 0 {
+				err = errors.Errorf("%v must be a non-empty array of schemas", keyword)
+			}
+			for i, subschema := range subschemas {
+				if err = checkSchema(subschema, fmt.Sprintf("%v/%v", keywordPath, i)); err != nil {
+					return err
+				}
+			}
+		case "minProperties", "maxProperties", "minItems", "maxItems", "minLength", "maxLength":
+			n, ok := getNumber(value)
+			if !ok || n < 0 || n != math.Trunc(n) {
+				err = errors.Errorf("%v must be a non-negative integer", keyword)
+			}
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			if _, ok := getNumber(value); !ok {
+				err = errors.Errorf("%v must be a number", keyword)
+			}
+		case "multipleOf":
+			n, ok := getNumber(value)
+			if !ok || n <= 0 {
+				err = errors.New("multipleOf must be a number greater than 0")
+			}
+		case "uniqueItems":
+			if _, ok := value.(bool); !ok {
+				err = errors.New("uniqueItems must be a boolean")
+			}
+		case "pattern":
+			pattern, ok := value.(string)
+			if !ok {
+				err = errors.New("pattern must be a string")
+				break
+			}
+			if _, regexErr := regexp.Compile(pattern); regexErr != nil {
+				err = errors.Wrap(regexErr, "pattern must be a valid regular expression")
+			}
+		default:
+			if !utils.InList(annotationKeywords, keyword) {
+				err = errors.Errorf("unsupported keyword %v", keyword)
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Invalid schema at %v", schemaPath(path))
+		}
+	}
+	return nil
+}
+
+// validate validates a value against a schema that was checked by checkSchema.
+func validate(schema interface{}, value interface{}, path string) error {
+	if schemaBool, ok := schema.(bool); ok {
+		if !schemaBool {
+			return &ValidationError{Path: path, Reason: "no value is allowed"}
+		}
+		return nil
+	}
+	schemaMap := schema.(map[string]interface{})
+
+	// check keywords in a fixed order so that the same violation is always reported first
+	keywords := make([]string, 0, len(schemaMap))
+	for keyword := range schemaMap {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	if utils.InList(keywords, "type") {
+		keywords = append([]string{"type"}, utils.RemoveItemFromList(keywords, "type")...)
+	}
+
+	for _, keyword := range keywords {
+		keywordValue := schemaMap[keyword]
+		var reason string
+		switch keyword {
+		case "type":
+			types, _ := getTypes(keywordValue)
+			valueType := getType(value)
+			if !utils.InList(types, valueType) && !(valueType == "integer" && utils.InList(types, "number")) {
+				reason = fmt.Sprintf("expected %v but got %v", strings.Join(types, " or "), valueType)
+			}
+		case "enum":
+			found := false
+			for _, allowed := range keywordValue.([]interface{}) {
+				if equal(allowed, value) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				reason = "value is not one of the allowed values"
+			}
+		case "const":
+			if !equal(keywordValue, value) {
+				reason = "value does not equal the constant value"
+			}
+		case "allOf":
+			for _, subschema := range keywordValue.([]interface{}) {
+				if err := validate(subschema, value, path); err != nil {
+					return err
+				}
+			}
+		case "anyOf":
+			valid := false
+			for _, subschema := range keywordValue.([]interface{}) {
+				if validate(subschema, value, path) == nil {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				reason = "value does not match any schema in anyOf"
+			}
+		case "oneOf":
+			matches := 0
+			for _, subschema := range keywordValue.([]interface{}) {
+				if validate(subschema, value, path) == nil {
+					matches++
+				}
+			}
+			if matches != 1 {
+				reason = fmt.Sprintf("value matches %v schemas in oneOf instead of exactly one", matches)
+			}
+		case "not":
+			if validate(keywordValue, value, path) == nil {
+				reason = "value must not match the schema in not"
+			}
+		}
+		if len(reason) > 0 {
+			return &ValidationError{Path: path, Reason: reason}
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return validateObject(schemaMap, value, path)
+	case []interface{}:
+		return validateArray(schemaMap, value, path)
+	case string:
+		return validateString(schemaMap, value, path)
+	case json.Number:
+		return validateNumber(schemaMap, value, path)
+	}
+	return nil
+}
+
+func validateObject(schema map[string]interface{}, value map[string]interface{}, path string) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if _, ok := value[name.(string)]; !ok {
+				return &ValidationError{Path: path, Reason: fmt.Sprintf("missing required property %v", name)}
+			}
+		}
+	}
+	if n, ok := getNumber(schema["minProperties"]); ok && float64(len(value)) < n {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("expected at least %v properties", n)}
+	}
+	if n, ok := getNumber(schema["maxProperties"]); ok && float64(len(value)) > n {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("expected at most %v properties", n)}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	additionalProperties, hasAdditionalProperties := schema["additionalProperties"]
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propertyPath := path + "/" + escapePointer(name)
+		if propertySchema, ok := properties[name]; ok {
+			if err := validate(propertySchema, value[name], propertyPath); err != nil {
+				return err
+			}
+		} else if hasAdditionalProperties {
+			if additionalProperties == false {
+				return &ValidationError{Path: propertyPath, Reason: "additional property is not allowed"}
+			}
+			if err := validate(additionalProperties, value[name], propertyPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateArray(schema map[string]interface{}, value []interface{}, path string) error {
+	if n, ok := getNumber(schema["minItems"]); ok && float64(len(value)) < n {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("expected at least %v items", n)}
+	}
+	if n, ok := getNumber(schema["maxItems"]); ok && float64(len(value)) > n {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("expected at most %v items", n)}
+	}
+	if unique, ok := schema["uniqueItems"].(bool); ok && unique {
+		for i := range value {
+			for j := i + 1; j < len(value); j++ {
+				if equal(value[i], value[j]) {
+					return &ValidationError{Path: path, Reason: fmt.Sprintf("items %v and %v are equal", i, j)}
+				}
+			}
+		}
+	}
+	if items, ok := schema["items"]; ok {
+		for i, item := range value {
+			if err := validate(items, item, fmt.Sprintf("%v/%v", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateString(schema map[string]interface{}, value string, path string) error {
+	length := float64(utf8.RuneCountInString(value))
+	if n, ok := getNumber(schema["minLength"]); ok && length < n {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("expected at least %v characters", n)}
+	}
+	if n, ok := getNumber(schema["maxLength"]); ok && length > n {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("expected at most %v characters", n)}
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if !regexp.MustCompile(pattern).MatchString(value) {
+			return &ValidationError{Path: path, Reason: fmt.Sprintf("value does not match pattern %v", pattern)}
+		}
+	}
+	return nil
+}
+
+func validateNumber(schema map[string]interface{}, value json.Number, path string) error {
+	n, _ := value.Float64()
+	if limit, ok := getNumber(schema["minimum"]); ok && n < limit {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("expected a value >= %v", limit)}
+	}
+	if limit, ok := getNumber(schema["maximum"]); ok && n > limit {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("expected a value <= %v", limit)}
+	}
+	if limit, ok := getNumber(schema["exclusiveMinimum"]); ok && n <= limit {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("expected a value > %v", limit)}
+	}
+	if limit, ok := getNumber(schema["exclusiveMaximum"]); ok && n >= limit {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("expected a value < %v", limit)}
+	}
+	if divisor, ok := getNumber(schema["multipleOf"]); ok {
+		quotient := n / divisor
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			return &ValidationError{Path: path, Reason: fmt.Sprintf("expected a multiple of %v", divisor)}
+		}
+	}
+	return nil
+}
+
+// getType returns the JSON Schema type of a value unmarshaled with UseNumber.
+// Whole numbers are of type "integer".
+func getType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		n, err := value.Float64()
+		if err == nil && n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func getTypes(value interface{}) ([]string, bool) {
+	switch value := value.(type) {
+	case string:
+		return []string{value}, true
+	case []interface{}:
+		types := []string{}
+		for _, t := range value {
+			typeName, ok := t.(string)
+			if !ok {
+				return nil, false
+			}
+			types = append(types, typeName)
+		}
+		return types, true
+	}
+	return nil, false
+}
+
+func getNumber(value interface{}) (float64, bool) {
+	if number, ok := value.(json.Number); ok {
+		n, err := number.Float64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// equal compares two JSON values; numbers are compared by value.
+func equal(a interface{}, b interface{}) bool {
+	aNumber, aIsNumber := getNumber(a)
+	bNumber, bIsNumber := getNumber(b)
+	if aIsNumber || bIsNumber {
+		return aIsNumber && bIsNumber && aNumber == bNumber
+	}
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if bv, ok := b[k]; !ok || !equal(v, bv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func escapePointer(name string) string {
+	return strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+}
+
+func schemaPath(path string) string {
+	if len(path) == 0 {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,89 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package json_schema
+
+import (
+	"common/bchcls/test_utils"
+
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+const patientSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"title": "patient",
+	"type": "object",
+	"required": ["name", "age"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "maxLength": 20},
+		"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+		"gender": {"enum": ["female", "male", "other"]},
+		"mrn": {"type": "string", "pattern": "^[0-9]{6}$"},
+		"weight": {"type": "number", "multipleOf": 0.5},
+		"allergies": {"type": "array", "items": {"type": "string"}, "uniqueItems": true, "maxItems": 3},
+		"contact": {"anyOf": [{"type": "null"}, {"type": "object", "required": ["phone"]}]}
+	}
+}`
+
+func TestValidateSchema(t *testing.T) {
+	test_utils.AssertTrue(t, ValidateSchema([]byte(patientSchema)) == nil, "Expected valid schema")
+	test_utils.AssertTrue(t, ValidateSchema([]byte(`true`)) == nil, "Expected boolean schema to be valid")
+	test_utils.AssertTrue(t, ValidateSchema([]byte(`{"type": "string"`)) != nil, "Expected invalid JSON to fail")
+	test_utils.AssertTrue(t, ValidateSchema([]byte(`{"type": "text"}`)) != nil, "Expected unknown type to fail")
+	test_utils.AssertTrue(t, ValidateSchema([]byte(`{"properties": {"a": {"minLength": -1}}}`)) != nil, "Expected negative minLength to fail")
+	test_utils.AssertTrue(t, ValidateSchema([]byte(`{"pattern": "["}`)) != nil, "Expected invalid pattern to fail")
+	test_utils.AssertTrue(t, ValidateSchema([]byte(`{"$ref": "#/definitions/a"}`)) != nil, "Expected unsupported keyword to fail")
+	test_utils.AssertTrue(t, ValidateSchema([]byte(`[]`)) != nil, "Expected array schema to fail")
+}
+
+func TestValidate(t *testing.T) {
+	schema := []byte(patientSchema)
+
+	valid := []string{
+		`{"name": "Ann", "age": 30}`,
+		`{"name": "Ann", "age": 30.0, "gender": "female", "mrn": "123456", "weight": 60.5}`,
+		`{"name": "Ann", "age": 30, "allergies": ["nuts", "dust"], "contact": null}`,
+		`{"name": "Ann", "age": 30, "contact": {"phone": "555-1234"}}`,
+	}
+	for _, data := range valid {
+		err := Validate(schema, []byte(data))
+		test_utils.AssertTrue(t, err == nil, "Expected valid data: "+data)
+	}
+
+	invalid := map[string]string{
+		`{"name": "Ann"}`:                                           "/",
+		`{"name": "Ann", "age": "30"}`:                              "/age",
+		`{"name": "Ann", "age": 30.5}`:                              "/age",
+		`{"name": "Ann", "age": 150}`:                               "/age",
+		`{"name": "", "age": 30}`:                                   "/name",
+		`{"name": "Ann", "age": 30, "gender": "unknown"}`:           "/gender",
+		`{"name": "Ann", "age": 30, "mrn": "12345"}`:                "/mrn",
+		`{"name": "Ann", "age": 30, "weight": 60.2}`:                "/weight",
+		`{"name": "Ann", "age": 30, "allergies": ["a", "a"]}`:       "/allergies",
+		`{"name": "Ann", "age": 30, "allergies": ["a", 1]}`:         "/allergies/1",
+		`{"name": "Ann", "age": 30, "contact": {"email": "a@b.c"}}`: "/contact",
+		`{"name": "Ann", "age": 30, "ssn": "123-45-6789"}`:          "/ssn",
+		`["Ann", 30]`: "/",
+	}
+	for data, path := range invalid {
+		err := Validate(schema, []byte(data))
+		validationErr, ok := errors.Cause(err).(*ValidationError)
+		test_utils.AssertTrue(t, ok, "Expected ValidationError: "+data)
+		if ok {
+			test_utils.AssertTrue(t, validationErr.Error()[:len(path)] == path, "Expected error at "+path+": "+validationErr.Error())
+		}
+	}
+
+	err := Validate(schema, []byte(`{"name": `))
+	_, ok := errors.Cause(err).(*ValidationError)
+	test_utils.AssertTrue(t, err != nil && !ok, "Expected invalid JSON data to fail without a ValidationError")
+}
@@ -22,14 +22,17 @@ import (
 	"common/bchcls/internal/common/global"
 	"common/bchcls/internal/consent_mgmt_i/consent_mgmt_c"
 	"common/bchcls/internal/datatype_i"
+	"common/bchcls/internal/history_i"
 	"common/bchcls/internal/key_mgmt_i"
 	"common/bchcls/internal/user_mgmt_i"
 	"common/bchcls/internal/user_mgmt_i/user_mgmt_c"
 	"common/bchcls/simple_rule"
 	"common/bchcls/utils"
 
+	"bytes"
 	"encoding/json"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
@@ -97,6 +100,13 @@ var ConsentKeyFunc asset_key_func.AssetKeyPathFunc = func(stub cached_stub.Cache
 		return keyPath, nil
 	}
 
+	// check if caller is the consent's owner, for consents put by someone else, such as delegated consents
+	if caller.ID == publicData.OwnerID {
+		logger.Debug("Caller is owner of consent data")
+		keyPath = append(keyPath, consentAsset.AssetKeyId)
+		return keyPath, nil
+	}
+
 	// check if caller is admin of target
 	isAdmin, adminPath, _ := user_mgmt_c.IsUserAdminOfGroup(stub, caller.ID, publicData.TargetID)
 	if isAdmin {
@@ -122,6 +132,7 @@ var ConsentKeyFunc asset_key_func.AssetKeyPathFunc = func(stub cached_stub.Cache
 // PutConsent updates an existing consent or adds a new consent.
 // Consent can be given to a datatype (all assets of a particular datatype).
 // Caller must either be the owner of the consent or have access to the owner's private key.
+// Each change is saved in the consent's history, see GetConsentHistory.
 //
 // args = [consent, consentKeyB64]
 //
@@ -137,43 +148,1061 @@ func PutConsent(stub cached_stub.CachedStubInterface, caller data_model.User, ar
 		return nil, errors.WithStack(custom_err)
 	}
 
-	consent := data_model.Consent{}
-	consentBytes := []byte(args[0])
-	err := json.Unmarshal(consentBytes, &consent)
+	consent := data_model.Consent{}
+	consentBytes := []byte(args[0])
+	err := json.Unmarshal(consentBytes, &consent)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "Consent"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	consentKeyBytes := []byte{}
+	if len(args) == 2 {
+		consentKeyB64 := args[1]
+		consentKeyBytes, err = crypto.ParseSymKeyB64(consentKeyB64)
+		if err != nil {
+			logger.Errorf("Invalid consent key: %v", err)
+			return nil, errors.Wrap(err, "Invalid consent key")
+		}
+	}
+
+	return nil, PutConsentWithParams(stub, caller, consent, consentKeyBytes)
+}
+
+// PutConsentWithParams updates an existing consent or adds new consent.
+// It takes consent object data_model.Consent, and consentKeyBytes []byte
+// as arguments instead of args in JSON format.
+//
+// consent is the consent object.
+// consentKeyBytes is only passed when creating a new consent.
+// A unique consent key must be used for each new consent.
+func PutConsentWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consent data_model.Consent, consentKeyBytes []byte) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consent: %v, consentKey len: %v", caller.ID, consent, len(consentKeyBytes))
+
+	return putConsent(stub, caller, consent, consentKeyBytes, "PutConsent")
+}
+
+// PutConsents updates existing consents or adds new consents in one transaction, such as a batch of consents
+// collected off-chain. Caller must either be the owner of each consent or have access to the owner's private key.
+// Returns a list of data_model.ConsentResult, one for each consent, in the same order.
+// Consents that fail validation are skipped and their results have an Error, while the other consents are put.
+// If putting a valid consent fails, an error is returned and none of the consents are put.
+// Since consents can be collected before they are put, ConsentDate can be any time up to the transaction timestamp.
+//
+// args = [consents, consentKeysB64]
+//
+// consents is a JSON list of consent objects, with at most CONSENT_MAX_BATCH_SIZE consents.
+// consentKeysB64 is a JSON list of base64 encoded consent keys, one for each consent. A consent key is only required
+// for a new consent, pass "" for an existing consent. consentKeysB64 can be omitted if all consents exist.
+func PutConsents(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 && len(args) != 2 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "PutConsents args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	consents := []data_model.Consent{}
+	err := json.Unmarshal([]byte(args[0]), &consents)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "Consents"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	consentKeys := [][]byte{}
+	if len(args) == 2 {
+		consentKeysB64 := []string{}
+		err = json.Unmarshal([]byte(args[1]), &consentKeysB64)
+		if err != nil {
+			custom_err := &custom_errors.UnmarshalError{Type: "consentKeysB64"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, errors.Wrap(err, custom_err.Error())
+		}
+		for _, consentKeyB64 := range consentKeysB64 {
+			consentKeyBytes := []byte{}
+			if len(consentKeyB64) > 0 {
+				consentKeyBytes, err = crypto.ParseSymKeyB64(consentKeyB64)
+				if err != nil {
+					logger.Errorf("Invalid consent key: %v", err)
+					return nil, errors.Wrap(err, "Invalid consent key")
+				}
+			}
+			consentKeys = append(consentKeys, consentKeyBytes)
+		}
+	}
+
+	results, err := PutConsentsWithParams(stub, caller, consents, consentKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsBytes, err := json.Marshal(results)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "ConsentResult"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	return resultsBytes, nil
+}
+
+// PutConsentsWithParams updates existing consents or adds new consents in one transaction.
+// It takes a list of consent objects, and a list of consentKeys with one consent key for each consent,
+// as arguments instead of args in JSON format. A consent key is only passed for a new consent.
+// Returns a data_model.ConsentResult for each consent.
+func PutConsentsWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consents []data_model.Consent, consentKeys [][]byte) ([]data_model.ConsentResult, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consents: %v, consentKeys len: %v", caller.ID, len(consents), len(consentKeys))
+
+	if len(consents) == 0 || len(consents) > global.CONSENT_MAX_BATCH_SIZE {
+		custom_err := &custom_errors.LengthCheckingError{Type: "consents"}
+		logger.Errorf("%v: %v consents, max is %v", custom_err, len(consents), global.CONSENT_MAX_BATCH_SIZE)
+		return nil, errors.WithStack(custom_err)
+	}
+
+	if len(consentKeys) > 0 && len(consentKeys) != len(consents) {
+		custom_err := &custom_errors.LengthCheckingError{Type: "consentKeys"}
+		logger.Errorf("%v: there must be one consent key for each consent", custom_err)
+		return nil, errors.WithStack(custom_err)
+	}
+
+	results := []data_model.ConsentResult{}
+	putConsentIDs := make(map[string]bool)
+	for i, consent := range consents {
+		consentKeyBytes := []byte{}
+		if len(consentKeys) > 0 {
+			consentKeyBytes = consentKeys[i]
+		}
+
+		result := data_model.ConsentResult{}
+		err := validateConsentToPut(stub, caller, consent, false, true)
+		if err == nil {
+			result.ConsentID = GetConsentID(consent.DatatypeID, consent.TargetID, consent.OwnerID)
+			err = validateBatchConsentKey(stub, result.ConsentID, consentKeyBytes, putConsentIDs)
+		}
+		if err != nil {
+			logger.Debugf("Skipping consent %v of batch: %v", i, err)
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		// the transaction is not committed if putting any valid consent fails
+		err = putConsent(stub, caller, consent, consentKeyBytes, "PutConsents")
+		if err != nil {
+			logger.Errorf("Failed to put consent %v: %v", result.ConsentID, err)
+			return nil, errors.Wrapf(err, "Failed to put consent %v", result.ConsentID)
+		}
+		putConsentIDs[result.ConsentID] = true
+		result.Success = true
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// validateBatchConsentKey checks that a consent of a PutConsents batch is not already in the batch, and that it
+// has a valid consent key if it's a new consent. putConsentIDs are the IDs of the consents put earlier in the batch.
+func validateBatchConsentKey(stub cached_stub.CachedStubInterface, consentID string, consentKeyBytes []byte, putConsentIDs map[string]bool) error {
+	if putConsentIDs[consentID] {
+		logger.Errorf("Consent %v is already in the batch", consentID)
+		return errors.Errorf("Consent %v is already in the batch", consentID)
+	}
+
+	if len(consentKeyBytes) > 0 {
+		if !crypto.ValidateSymKey(consentKeyBytes) {
+			logger.Errorf("Invalid consent key")
+			return errors.New("Invalid consent key")
+		}
+		return nil
+	}
+
+	consentAssetID, err := GetConsentAssetID(stub, consentID)
+	if err != nil || len(consentAssetID) == 0 {
+		logger.Errorf("Consent key is required for new consent %v", consentID)
+		return errors.Errorf("Consent key is required for new consent %v", consentID)
+	}
+	return nil
+}
+
+// putConsent updates an existing consent or adds a new consent, and logs the change in the consent's history.
+// operation is the name of the consent function making the change.
+// parentConsentKey is only passed for consents delegated from another consent. The caller is then authorized by
+// having the parent consent key, which is also used to get the consent key and the datatype sym key.
+// If an existing consent is revoked or amended, the consents delegated from it are also revoked or amended.
+func putConsent(stub cached_stub.CachedStubInterface, caller data_model.User, consent data_model.Consent, consentKeyBytes []byte, operation string, parentConsentKey ...data_model.Key) error {
+	isDelegation := len(parentConsentKey) > 0
+	if !isDelegation {
+		// delegation fields are only set by DelegateConsent, or kept from an existing delegated consent below
+		consent.ParentConsentID = ""
+		consent.DelegationDepth = 0
+	}
+
+	// ==============================================================
+	// Validation of incoming consent
+	// ==============================================================
+
+	err := validateConsentToPut(stub, caller, consent, isDelegation, operation == "PutConsents")
+	if err != nil {
+		return err
+	}
+
+	assetManager := asset_mgmt_i.GetAssetManager(stub, caller)
+
+	// Set ConsentID
+	consent.ConsentID = GetConsentID(consent.DatatypeID, consent.TargetID, consent.OwnerID)
+
+	// ==============================================================
+	// Convert consent to assetData
+	// ==============================================================
+
+	// Set CreatorID, CreatorID is always the caller
+	consent.CreatorID = caller.ID
+
+	// Init variables to be used
+	isNewConsent := true
+	consentOld := data_model.Consent{}
+	consentKey := data_model.Key{ID: consent.ConsentID, Type: global.KEY_TYPE_SYM}
+	consentAssetOld := data_model.Asset{}
+
+	// try to get existing consent asset
+	consentAssetId, err := GetConsentAssetID(stub, consent.ConsentID)
+	logger.Debugf("existing consentAssetId: %v, err: %v", consentAssetId, err)
+	if err == nil && len(consentAssetId) > 0 {
+		isNewConsent = false
+		//you should have access to consent asset key
+		if isDelegation {
+			consentKey.KeyBytes, err = key_mgmt_i.GetKey(stub, []string{parentConsentKey[0].ID, consent.ConsentID}, parentConsentKey[0].KeyBytes)
+		} else {
+			consentKey.KeyBytes, err = getConsentAssetKeyByConsentAssetID(stub, caller, consentAssetId)
+		}
+		if err != nil {
+			logger.Errorf("Failed to getConsentAssetKey with error: %v", err)
+			return errors.Wrap(err, "Failed to getConsentAssetKey with error")
+		}
+		if len(consentKey.KeyBytes) == 0 {
+			logger.Errorf("Failed to getConsentAssetKey")
+			return errors.Wrap(err, "Failed to getConsentAssetKey:")
+		}
+
+		// get existing consent asset
+		consentAssetOld, err := asset_mgmt_i.GetAssetManager(stub, caller).GetAsset(consentAssetId, consentKey)
+		if err != nil {
+			logger.Errorf("Get old consent asset failed: %v", err)
+			return errors.Wrap(err, "Get old consent asset failed")
+		}
+		if data_model.IsEncryptedData(consentAssetOld.PrivateData) {
+			logger.Error("Failed to read consent private data")
+			return errors.New("Failed to read consent private data")
+		}
+
+		consentOld = convertFromAsset(consentAssetOld)
+
+		// consent date only changes if Access level has been changed
+		if consent.Access == consentOld.Access {
+			consent.ConsentDate = consentOld.ConsentDate
+		}
+
+		if consent.ExpirationDate == 0 {
+			consent.ExpirationDate = consentOld.ExpirationDate
+		}
+
+		if isDelegation && consentOld.ParentConsentID != consent.ParentConsentID {
+			logger.Errorf("Consent %v already exists and is not delegated from consent %v", consent.ConsentID, consent.ParentConsentID)
+			return errors.Errorf("Consent %v already exists and is not delegated from consent %v", consent.ConsentID, consent.ParentConsentID)
+		}
+
+		// a delegated consent can only be updated with DelegateConsent, but it can be revoked by its owner
+		if !isDelegation && len(consentOld.ParentConsentID) > 0 {
+			if consent.Access != global.ACCESS_DENY {
+				logger.Errorf("Consent %v is delegated, use DelegateConsent to update it", consent.ConsentID)
+				return errors.Errorf("Consent %v is delegated, use DelegateConsent to update it", consent.ConsentID)
+			}
+			consent.ParentConsentID = consentOld.ParentConsentID
+			consent.DelegationDepth = consentOld.DelegationDepth
+			consent.MaxDelegationDepth = consentOld.MaxDelegationDepth
+		}
+
+		// delete old consent asset's index values if caller changed
+		if consentOld.CreatorID != consent.CreatorID {
+			table := index.GetTable(stub, consentAssetOld.IndexTableName)
+			table.DeleteRow(consentOld.ConsentAssetID)
+		}
+	} else {
+		isNewConsent = true
+		// Get or create consent key object (CK)
+		if len(consentKeyBytes) == 0 {
+			logger.Errorf("Invalid consent key bytes")
+			return errors.Wrap(err, "Invalid consent keybytes")
+		}
+
+		consentKey.KeyBytes = consentKeyBytes
+		if !crypto.ValidateSymKey(consentKey.KeyBytes) {
+			logger.Errorf("Invalid consent key")
+			return errors.New("Invalid consent key")
+		}
+	}
+
+	logger.Debugf("isNewConsent: %v", isNewConsent)
+
+	// Make consent edge rule, will be same as edge data for consent edge
+	edgeData := make(map[string]string)
+	edgeData["edge"] = global.CONSENT_EDGE
+	edgeData["target"] = consent.TargetID
+	edgeData["owner"] = consent.OwnerID
+	edgeData["datatypeID"] = consent.DatatypeID
+
+	consent.ConsentAssetID = consent.ConsentID + consent.CreatorID
+
+	// convert consent to assetData
+	consentConverted := convertToAsset(consent)
+
+	// ==============================================================
+	// Add / update consent
+	// ==============================================================
+
+	// SymKey is DatatypeKey
+	// Add edges from CK to SymKey, and SymKey to CK if not deny
+	symKey := data_model.Key{}
+
+	// If datatypeID is not empty, get datatypeSymKey
+	if !isDelegation {
+		symKey, err = datatype_i.GetDatatypeSymKey(stub, caller, consent.DatatypeID, consent.OwnerID)
+		if err != nil {
+			logger.Errorf("Failed to GetDatatypeSymKey: %v", err)
+			return errors.Wrap(err, "Failed to GetDatatypeSymKey")
+		}
+	} else {
+		// a delegated consent gets the datatype sym key through the parent consent key, which is only needed to give access
+		symKey = data_model.Key{ID: datatype_i.GetDatatypeKeyID(consent.DatatypeID, consent.OwnerID), Type: global.KEY_TYPE_SYM}
+		if consent.Access != global.ACCESS_DENY {
+			symKey.KeyBytes, err = key_mgmt_i.GetKey(stub, []string{parentConsentKey[0].ID, symKey.ID}, parentConsentKey[0].KeyBytes)
+			if err != nil {
+				logger.Errorf("Failed to get datatype sym key through parent consent: %v", err)
+				return errors.Wrap(err, "Failed to get datatype sym key through parent consent")
+			}
+		}
+	}
+
+	// Check consent access level
+	if consent.Access == global.ACCESS_READ || consent.Access == global.ACCESS_WRITE {
+		edgeData := make(map[string]string)
+		if consent.Access == global.ACCESS_WRITE {
+			edgeData[global.EDGEDATA_ACCESS_TYPE] = global.ACCESS_WRITE
+		} else {
+			edgeData[global.EDGEDATA_ACCESS_TYPE] = global.ACCESS_READ
+		}
+		// time constraints are also saved in edge data so that CheckAccess can enforce them
+		err = setConsentEdgeTerms(edgeData, consent)
+		if err != nil {
+			return err
+		}
+		// If Access level is read or write, add edge from CK to SymKey
+		err = key_mgmt_i.AddAccess(stub, consentKey, symKey, edgeData)
+		if err != nil {
+			custom_err := &custom_errors.AddAccessError{Key: "assetKey"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+
+		// add edge from owner key to CK
+		ownerKey, err := user_mgmt_i.GetUserPublicKey(stub, caller, consent.OwnerID)
+		if err != nil {
+			errMsg := "Failed to get public key of " + consent.OwnerID
+			logger.Errorf("%v: %v", errMsg, err)
+			return errors.Wrap(err, errMsg)
+		}
+
+		err = key_mgmt_i.AddAccess(stub, ownerKey, consentKey)
+		if err != nil {
+			custom_err := &custom_errors.AddAccessError{Key: "consentKey"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+
+	} else { // If Access level is deny
+		// remove access from CK to SymKey but keep edge from SymKey to CK
+		err = key_mgmt_i.RevokeAccess(stub, consentKey.ID, symKey.ID)
+		if err != nil {
+			logger.Errorf("Failed to revoke access from CK to SymKey: %v", err)
+			return errors.Wrap(err, "Failed to revoke access from SymKey to SymKey")
+		}
+	}
+
+	// Encrypt CK with target's key, create consent edge
+	targetKey, err := user_mgmt_i.GetUserPublicKey(stub, caller, consent.TargetID)
+	if err != nil {
+		errMsg := "Failed to get public key of " + consent.TargetID
+		logger.Errorf("%v: %v", errMsg, err)
+		return errors.Wrap(err, errMsg)
+	}
+
+	err = key_mgmt_i.AddAccess(stub, targetKey, consentKey, edgeData)
+	if err != nil {
+		custom_err := &custom_errors.AddAccessError{Key: "consentKey"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+
+	// add edge from parent CK to CK, which is kept after revoking so that the delegation can be cascaded and audited
+	if isDelegation {
+		delegationEdgeData := map[string]string{"edge": global.CONSENT_DELEGATION_EDGE}
+		err = key_mgmt_i.AddAccess(stub, parentConsentKey[0], consentKey, delegationEdgeData)
+		if err != nil {
+			custom_err := &custom_errors.AddAccessError{Key: "consentKey"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+	}
+
+	// If this is an update and creator changed, delete old consent asset in ledger
+	if !isNewConsent && consentOld.CreatorID != consent.CreatorID {
+		assetLedgerKey := consentAssetOld.AssetId
+		err = stub.DelState(assetLedgerKey)
+		if err != nil {
+			custom_err := &custom_errors.DeleteLedgerError{LedgerKey: assetLedgerKey}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+	}
+
+	// Add/Update new consent asset
+	if !isNewConsent && consentOld.CreatorID == consent.CreatorID {
+		err = assetManager.UpdateAsset(consentConverted, consentKey, true)
+	} else {
+		err = assetManager.AddAsset(consentConverted, consentKey, true)
+	}
+	if err != nil {
+		logger.Errorf("Failed to add Consent: %v", err)
+		return errors.Wrap(err, "Failed to add Consent")
+	}
+
+	// log the change
+	err = putConsentLog(stub, caller, consent, consentKey, operation)
+	if err != nil {
+		logger.Errorf("Failed to log consent change: %v", err)
+		return errors.Wrap(err, "Failed to log consent change")
+	}
+
+	// cascade revocation and amendments through the delegation chain
+	if !isNewConsent {
+		err = updateDelegatedConsents(stub, caller, consent, consentKey)
+		if err != nil {
+			logger.Errorf("Failed to update delegated consents: %v", err)
+			return errors.Wrap(err, "Failed to update delegated consents")
+		}
+	}
+
+	// all set
+	return nil
+}
+
+// AmendConsent updates an existing consent.
+// Unlike PutConsent, it returns an error if the consent does not exist, and it can't be used to revoke the consent.
+// Use RevokeConsent instead. If consent.ConsentDate is not set, the transaction timestamp is used.
+// Consents delegated from the consent are amended so that they don't give more access than the amended consent.
+// Caller must either be the owner of the consent or have access to the owner's private key.
+//
+// args = [consent]
+func AmendConsent(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "AmendConsent args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	consent := data_model.Consent{}
+	err := json.Unmarshal([]byte(args[0]), &consent)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "Consent"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	return nil, AmendConsentWithParams(stub, caller, consent)
+}
+
+// AmendConsentWithParams updates an existing consent.
+// It takes consent object data_model.Consent as argument instead of args in JSON format.
+func AmendConsentWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consent data_model.Consent) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consent: %v", caller.ID, consent)
+
+	if consent.Access == global.ACCESS_DENY {
+		logger.Error("Use RevokeConsent to revoke a consent")
+		return errors.New("Use RevokeConsent to revoke a consent")
+	}
+
+	consentID := GetConsentID(consent.DatatypeID, consent.TargetID, consent.OwnerID)
+	consentAssetID, err := GetConsentAssetID(stub, consentID)
+	if err != nil || len(consentAssetID) == 0 {
+		custom_err := &custom_errors.GetConsentError{ConsentID: consentID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.WithStack(custom_err)
+	}
+
+	if consent.ConsentDate == 0 {
+		consent.ConsentDate, err = getTxTimestamp(stub)
+		if err != nil {
+			return err
+		}
+	}
+
+	return putConsent(stub, caller, consent, nil, "AmendConsent")
+}
+
+// RevokeConsent revokes an existing consent by setting its access to deny.
+// The time of revocation is saved as the consent's ConsentDate and in the consent's history.
+// Caller must either be the owner of the consent or have access to the owner's private key.
+// A delegated consent can also be revoked by the target of the consent it was delegated from.
+// Revoking a consent also revokes all consents delegated from it, through the whole delegation chain.
+//
+// args: [datatypeID, targetID, ownerID]
+func RevokeConsent(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 3 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "RevokeConsent args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	return nil, RevokeConsentWithParams(stub, caller, GetConsentID(args[0], args[1], args[2]))
+}
+
+// RevokeConsentWithParams revokes the consent with the given consentID.
+// Returns an error if the consent does not exist or is already revoked.
+func RevokeConsentWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consentID string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consentID: %v", caller.ID, consentID)
+
+	consent, err := GetConsentWithParams(stub, caller, consentID)
+	if err != nil || utils.IsStringEmpty(consent.ConsentID) {
+		custom_err := &custom_errors.GetConsentError{ConsentID: consentID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.WithStack(custom_err)
+	}
+
+	if consent.Access == global.ACCESS_DENY {
+		logger.Errorf("Consent %v is already revoked", consentID)
+		return errors.Errorf("Consent %v is already revoked", consentID)
+	}
+
+	consent.Access = global.ACCESS_DENY
+	consent.ConsentDate, err = getTxTimestamp(stub)
+	if err != nil {
+		return err
+	}
+
+	// the delegator of a delegated consent revokes it with the parent consent key
+	if caller.ID != consent.OwnerID && len(consent.ParentConsentID) > 0 {
+		parentKeyBytes, err := getConsentAssetKeyByConsentID(stub, caller, consent.ParentConsentID)
+		if err == nil && len(parentKeyBytes) > 0 {
+			parentKey := data_model.Key{ID: consent.ParentConsentID, Type: global.KEY_TYPE_SYM, KeyBytes: parentKeyBytes}
+			return putConsent(stub, caller, consent, nil, "RevokeConsent", parentKey)
+		}
+	}
+
+	return putConsent(stub, caller, consent, nil, "RevokeConsent")
+}
+
+// DelegateConsent delegates a consent to another target, for example from a hospital to a contracted lab.
+// consent.ParentConsentID is the ID of the consent being delegated, and caller must be its target.
+// If the consent was already delegated to the same target, it's updated.
+//
+// The delegated consent must have the owner and datatype of the parent consent, and can't give more access than it:
+// a read consent can only be delegated as read. Its ExpirationDate can't be later than the parent's, and is the
+// parent's if not set. NotBefore, ValidityWindows, Purposes, Condition, and MaxDelegationDepth are copied from
+// the parent consent. A consent can be delegated if the chain of consents delegated from the root consent is shorter
+// than MaxDelegationDepth. Revoking a consent revokes all consents delegated from it, and amending a consent
+// applies these rules to the consents delegated from it again, through the whole delegation chain.
+//
+// args = [consent, consentKeyB64]
+//
+// consentKeyB64 is only required when delegating a new consent. A unique consent key must be used for each new consent.
+func DelegateConsent(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 && len(args) != 2 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "DelegateConsent args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	consent := data_model.Consent{}
+	err := json.Unmarshal([]byte(args[0]), &consent)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "Consent"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	consentKeyBytes := []byte{}
+	if len(args) == 2 {
+		consentKeyBytes, err = crypto.ParseSymKeyB64(args[1])
+		if err != nil {
+			logger.Errorf("Invalid consent key: %v", err)
+			return nil, errors.Wrap(err, "Invalid consent key")
+		}
+	}
+
+	return nil, DelegateConsentWithParams(stub, caller, consent, consentKeyBytes)
+}
+
+// DelegateConsentWithParams delegates a consent to another target.
+// It takes consent object data_model.Consent, and consentKeyBytes []byte as arguments instead of args in JSON format.
+func DelegateConsentWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consent data_model.Consent, consentKeyBytes []byte) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consent: %v, consentKey len: %v", caller.ID, consent, len(consentKeyBytes))
+
+	if utils.IsStringEmpty(consent.ParentConsentID) {
+		custom_err := &custom_errors.LengthCheckingError{Type: "consent.ParentConsentID"}
+		logger.Errorf(custom_err.Error())
+		return errors.WithStack(custom_err)
+	}
+
+	if consent.Access != global.ACCESS_READ && consent.Access != global.ACCESS_WRITE {
+		logger.Errorf("Access must be write or read")
+		return errors.New("Access must be write or read, use RevokeConsent to revoke a consent")
+	}
+
+	parent, err := GetConsentWithParams(stub, caller, consent.ParentConsentID)
+	if err != nil || utils.IsStringEmpty(parent.ConsentID) {
+		custom_err := &custom_errors.GetConsentError{ConsentID: consent.ParentConsentID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.WithStack(custom_err)
+	}
+
+	if caller.ID != parent.TargetID {
+		logger.Errorf("Only the target of consent %v can delegate it", parent.ConsentID)
+		return errors.Errorf("Only the target of consent %v can delegate it", parent.ConsentID)
+	}
+
+	if parent.Access == global.ACCESS_DENY {
+		logger.Errorf("Consent %v is revoked", parent.ConsentID)
+		return errors.Errorf("Consent %v is revoked", parent.ConsentID)
+	}
+
+	if parent.Access == global.ACCESS_READ && consent.Access == global.ACCESS_WRITE {
+		logger.Errorf("Consent %v gives read access, it can't be delegated as write", parent.ConsentID)
+		return errors.Errorf("Consent %v gives read access, it can't be delegated as write", parent.ConsentID)
+	}
+
+	if parent.DelegationDepth >= parent.MaxDelegationDepth {
+		logger.Errorf("Consent %v can't be delegated, max delegation depth is %v", parent.ConsentID, parent.MaxDelegationDepth)
+		return errors.Errorf("Consent %v can't be delegated, max delegation depth is %v", parent.ConsentID, parent.MaxDelegationDepth)
+	}
+
+	if consent.OwnerID != parent.OwnerID || consent.DatatypeID != parent.DatatypeID {
+		logger.Errorf("Delegated consent must have the owner and datatype of consent %v", parent.ConsentID)
+		return errors.Errorf("Delegated consent must have the owner and datatype of consent %v", parent.ConsentID)
+	}
+
+	if consent.TargetID == parent.TargetID || consent.TargetID == parent.OwnerID {
+		logger.Errorf("Consent %v can't be delegated to its target or owner", parent.ConsentID)
+		return errors.Errorf("Consent %v can't be delegated to its target or owner", parent.ConsentID)
+	}
+
+	currTime, err := getTxTimestamp(stub)
+	if err != nil {
+		return err
+	}
+
+	if parent.ExpirationDate != 0 {
+		if parent.ExpirationDate <= currTime {
+			logger.Errorf("Consent %v has expired", parent.ConsentID)
+			return errors.Errorf("Consent %v has expired", parent.ConsentID)
+		}
+		if consent.ExpirationDate == 0 {
+			consent.ExpirationDate = parent.ExpirationDate
+		} else if consent.ExpirationDate > parent.ExpirationDate {
+			logger.Errorf("ExpirationDate can't be later than the ExpirationDate of consent %v", parent.ConsentID)
+			return errors.Errorf("ExpirationDate can't be later than the ExpirationDate of consent %v", parent.ConsentID)
+		}
+	}
+
+	consent.NotBefore = parent.NotBefore
+	consent.ValidityWindows = parent.ValidityWindows
+	consent.Purposes = parent.Purposes
+	consent.Condition = parent.Condition
+	consent.MaxDelegationDepth = parent.MaxDelegationDepth
+	consent.DelegationDepth = parent.DelegationDepth + 1
+	if consent.ConsentDate == 0 {
+		consent.ConsentDate = currTime
+	}
+
+	parentKeyBytes, err := getConsentAssetKeyByConsentID(stub, caller, parent.ConsentID)
+	if err != nil || len(parentKeyBytes) == 0 {
+		logger.Errorf("Failed to get key of consent %v: %v", parent.ConsentID, err)
+		return errors.Errorf("Failed to get key of consent %v", parent.ConsentID)
+	}
+	parentKey := data_model.Key{ID: parent.ConsentID, Type: global.KEY_TYPE_SYM, KeyBytes: parentKeyBytes}
+
+	return putConsent(stub, caller, consent, consentKeyBytes, "DelegateConsent", parentKey)
+}
+
+// GetConsentHistory returns every version of a consent, oldest first, as a list of data_model.ConsentVersion.
+// Each version records who changed the consent, when, and with which function.
+// Caller can be anyone with access to the consent key.
+//
+// args: [consentID]
+func GetConsentHistory(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("args: %v", args)
+
+	if len(args) != 1 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "GetConsentHistory args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	versions, err := GetConsentHistoryWithParams(stub, caller, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	versionsBytes, err := json.Marshal(versions)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "ConsentVersion"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	return versionsBytes, nil
+}
+
+// GetConsentHistoryWithParams returns every version of the consent with the given consentID, oldest first.
+func GetConsentHistoryWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consentID string) ([]data_model.ConsentVersion, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("caller: %v, consentID: %v", caller.ID, consentID)
+
+	if utils.IsStringEmpty(consentID) {
+		custom_err := &custom_errors.LengthCheckingError{Type: "consentID"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	// the logs are encrypted with the consent key, so use the key path to the consent key
+	consentAssetID, err := GetConsentAssetID(stub, consentID)
+	if err != nil {
+		custom_err := &custom_errors.GetConsentError{ConsentID: consentID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.WithStack(custom_err)
+	}
+	consentAsset, err := asset_mgmt_i.GetEncryptedAssetData(stub, consentAssetID)
+	if err != nil {
+		custom_err := &custom_errors.GetConsentError{ConsentID: consentID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	keyPath, err := ConsentKeyFunc(stub, caller, consentAsset)
+	if err != nil || len(keyPath) == 0 {
+		logger.Errorf("Failed to get consent key path: %v", err)
+		return nil, errors.New("Failed to get consent key path")
+	}
+
+	historyManager := history_i.GetHistoryManager(asset_mgmt_i.GetAssetManager(stub, caller))
+	logs, _, err := historyManager.GetTransactionLogs(global.CONSENT_LOG_NAMESPACE, "field_1", consentID, -1, -1, "", -1, nil, keyPath)
+	if err != nil {
+		logger.Errorf("Failed to get consent logs: %v", err)
+		return nil, errors.Wrap(err, "Failed to get consent logs")
+	}
+
+	versions := []data_model.ConsentVersion{}
+	for _, log := range logs {
+		version := data_model.ConsentVersion{
+			TransactionID: strings.TrimSuffix(log.TransactionID, "-"+consentID),
+			Timestamp:     log.Timestamp,
+			CallerID:      log.CallerID,
+			Operation:     log.FunctionName,
+		}
+		consentBytes, _ := json.Marshal(log.Data)
+		err = json.Unmarshal(consentBytes, &version.Consent)
+		if err != nil {
+			custom_err := &custom_errors.UnmarshalError{Type: "Consent"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, errors.Wrap(err, custom_err.Error())
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// ExportConsentReceipt returns a consent receipt for a consent, signed with the consent owner's private key,
+// so the owner has a verifiable record of the consent. The receipt follows the Kantara Initiative
+// Consent Receipt Specification v1.1, see data_model.ConsentReceipt.
+// Caller must have access to the consent key, and either be the owner of the consent or have access to
+// the owner's private key.
+// Returns a data_model.SignedConsentReceipt.
+//
+// args = [consentID, receiptTemplate]
+//
+// receiptTemplate is optional. It's a data_model.ConsentReceipt in JSON format with the fields that are not set
+// from the consent, such as Jurisdiction, CollectionMethod, Language, PIIControllers, and PolicyURL.
+func ExportConsentReceipt(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 && len(args) != 2 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "ExportConsentReceipt args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	receiptTemplate := data_model.ConsentReceipt{}
+	if len(args) == 2 && len(args[1]) > 0 {
+		err := json.Unmarshal([]byte(args[1]), &receiptTemplate)
+		if err != nil {
+			custom_err := &custom_errors.UnmarshalError{Type: "receiptTemplate"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, errors.Wrap(err, custom_err.Error())
+		}
+	}
+
+	signedReceipt, err := ExportConsentReceiptWithParams(stub, caller, args[0], receiptTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	signedReceiptBytes, err := json.Marshal(signedReceipt)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "SignedConsentReceipt"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	return signedReceiptBytes, nil
+}
+
+// ExportConsentReceiptWithParams returns a consent receipt for the consent with the given consentID,
+// signed with the consent owner's private key.
+// The fields of receiptTemplate that are set from the consent are ignored.
+func ExportConsentReceiptWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consentID string, receiptTemplate data_model.ConsentReceipt) (data_model.SignedConsentReceipt, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consentID: %v", caller.ID, consentID)
+
+	consent, err := GetConsentWithParams(stub, caller, consentID)
+	if err != nil || utils.IsStringEmpty(consent.ConsentID) {
+		custom_err := &custom_errors.GetConsentError{ConsentID: consentID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return data_model.SignedConsentReceipt{}, errors.WithStack(custom_err)
+	}
+
+	ownerPrivateKey, err := user_mgmt_i.GetUserPrivateKey(stub, caller, consent.OwnerID)
+	if err != nil || len(ownerPrivateKey.KeyBytes) == 0 {
+		logger.Errorf("Failed to get private key. Caller does not have access to act on behalf of owner")
+		return data_model.SignedConsentReceipt{}, errors.New("Failed to get private key. Caller does not have access to act on behalf of owner")
+	}
+	privateKey, err := crypto.ParseAnyPrivateKey(ownerPrivateKey.KeyBytes)
+	if err != nil {
+		custom_err := &custom_errors.InvalidPrivateKeyError{}
+		logger.Errorf("%v: %v", custom_err, err)
+		return data_model.SignedConsentReceipt{}, errors.WithStack(custom_err)
+	}
+	publicKeyBytes, err := crypto.MarshalAnyPublicKey(crypto.GetPublicKeyOf(privateKey))
+	if err != nil {
+		custom_err := &custom_errors.InvalidPublicKeyError{}
+		logger.Errorf("%v: %v", custom_err, err)
+		return data_model.SignedConsentReceipt{}, errors.WithStack(custom_err)
+	}
+
+	receipt := receiptTemplate
+	receipt.Version = global.CONSENT_RECEIPT_VERSION
+	receipt.ConsentTimestamp = consent.ConsentDate
+	receipt.ConsentReceiptID = stub.GetTxID()
+	receipt.PublicKey = crypto.EncodeToB64String(publicKeyBytes)
+	receipt.PIIPrincipalID = consent.OwnerID
+	if len(receipt.PIIControllers) == 0 {
+		receipt.PIIControllers = []data_model.ConsentReceiptParty{{PIIController: consent.TargetID}}
+	}
+	receipt.Services = []data_model.ConsentReceiptService{getConsentReceiptService(consent)}
+	receipt.Sensitive = true
+	receipt.SPICat = []string{consent.DatatypeID}
+	receipt.ConsentID = consent.ConsentID
+	receipt.Access = consent.Access
+
+	signature, err := crypto.SignWithAnyPrivateKey(privateKey, receipt.GetSignedBytes())
+	if err != nil {
+		logger.Errorf("Failed to sign receipt of consent %v: %v", consentID, err)
+		return data_model.SignedConsentReceipt{}, errors.Wrapf(err, "Failed to sign receipt of consent %v", consentID)
+	}
+	return data_model.SignedConsentReceipt{Receipt: receipt, Signature: crypto.EncodeToB64String(signature)}, nil
+}
+
+// getConsentReceiptService returns the consent receipt service of a consent, with one purpose for each
+// purpose of use of the consent, or a single "any" purpose if the consent is given for any purpose.
+func getConsentReceiptService(consent data_model.Consent) data_model.ConsentReceiptService {
+	purposes := consent.Purposes
+	if len(purposes) == 0 {
+		purposes = []string{"any"}
+	}
+
+	termination := ""
+	if consent.ExpirationDate != 0 {
+		termination = time.Unix(consent.ExpirationDate, 0).UTC().Format(time.RFC3339)
+	}
+
+	service := data_model.ConsentReceiptService{Service: consent.DatatypeID}
+	for i, purpose := range purposes {
+		service.Purposes = append(service.Purposes, data_model.ConsentReceiptPurpose{
+			Purpose:              purpose,
+			PurposeCategory:      []string{purpose},
+			ConsentType:          "EXPLICIT",
+			PIICategory:          []string{consent.DatatypeID},
+			PrimaryPurpose:       i == 0,
+			Termination:          termination,
+			ThirdPartyDisclosure: consent.OwnerID != consent.TargetID,
+		})
+	}
+	return service
+}
+
+// VerifyConsentReceipt checks that a consent receipt was signed by the consent owner.
+// The owner's current public key is used, so receipts signed before the owner's keys were rotated are invalid.
+// Returns an error if the receipt is invalid.
+//
+// args = [signedReceipt]
+//
+// signedReceipt is a data_model.SignedConsentReceipt in JSON format, returned by ExportConsentReceipt.
+func VerifyConsentReceipt(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "VerifyConsentReceipt args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	signedReceipt := data_model.SignedConsentReceipt{}
+	err := json.Unmarshal([]byte(args[0]), &signedReceipt)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "SignedConsentReceipt"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	return nil, VerifyConsentReceiptWithParams(stub, caller, signedReceipt)
+}
+
+// VerifyConsentReceiptWithParams checks that a consent receipt was signed by the consent owner.
+// It takes a data_model.SignedConsentReceipt as argument instead of args in JSON format.
+func VerifyConsentReceiptWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, signedReceipt data_model.SignedConsentReceipt) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consentID: %v", caller.ID, signedReceipt.Receipt.ConsentID)
+
+	receipt := signedReceipt.Receipt
+	ownerPublicKey, err := user_mgmt_i.GetUserPublicKey(stub, caller, receipt.PIIPrincipalID)
+	if err != nil {
+		logger.Errorf("Failed to get public key of consent owner %v: %v", receipt.PIIPrincipalID, err)
+		return errors.Wrapf(err, "Failed to get public key of consent owner %v", receipt.PIIPrincipalID)
+	}
+
+	publicKey, err := crypto.ParseAnyPublicKey(ownerPublicKey.KeyBytes)
+	if err != nil {
+		custom_err := &custom_errors.InvalidPublicKeyError{}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.WithStack(custom_err)
+	}
+	signature, err := crypto.DecodeStringB64(signedReceipt.Signature)
+	if err != nil || !crypto.VerifyWithAnyPublicKey(publicKey, receipt.GetSignedBytes(), signature) {
+		logger.Errorf("Invalid signature of receipt of consent %v", receipt.ConsentID)
+		return errors.Errorf("Invalid signature of receipt of consent %v", receipt.ConsentID)
+	}
+	return nil
+}
+
+// UpdateConsentEdgeData saves the time constraints of an existing consent in the edge data of its access edge.
+// Consents put before NotBefore, ExpirationDate, and ValidityWindows were saved in edge data give access
+// at any time in CheckAccess until they are updated, either by this function or by PutConsent or AmendConsent.
+// Caller can be anyone with access to the consent key.
+//
+// args: [consentID]
+func UpdateConsentEdgeData(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "UpdateConsentEdgeData args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	return nil, UpdateConsentEdgeDataWithParams(stub, caller, args[0])
+}
+
+// UpdateConsentEdgeDataWithParams saves the time constraints of the consent with the given consentID in the
+// edge data of its access edge. A consent that doesn't give access has no access edge, and is skipped.
+func UpdateConsentEdgeDataWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consentID string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, consentID: %v", caller.ID, consentID)
+
+	consent, err := GetConsentWithParams(stub, caller, consentID)
+	if err != nil {
+		custom_err := &custom_errors.GetConsentError{ConsentID: consentID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+
+	if consent.Access != global.ACCESS_READ && consent.Access != global.ACCESS_WRITE {
+		logger.Debugf("Consent %v does not give access", consentID)
+		return nil
+	}
+
+	symKeyID := datatype_i.GetDatatypeKeyID(consent.DatatypeID, consent.OwnerID)
+	edgeValue, edgeData, err := key_mgmt_i.GetAccessEdge(stub, consentID, symKeyID)
+	if err != nil || len(edgeValue) == 0 {
+		logger.Errorf("Failed to get access edge of consent %v: %v", consentID, err)
+		return errors.Wrapf(err, "Failed to get access edge of consent %v", consentID)
+	}
+	if edgeData == nil {
+		edgeData = make(map[string]string)
+	}
+
+	err = setConsentEdgeTerms(edgeData, consent)
 	if err != nil {
-		custom_err := &custom_errors.UnmarshalError{Type: "Consent"}
-		logger.Errorf("%v: %v", custom_err, err)
-		return nil, errors.Wrap(err, custom_err.Error())
+		return err
 	}
 
-	consentKeyBytes := []byte{}
-	if len(args) == 2 {
-		consentKeyB64 := args[1]
-		consentKeyBytes, err = crypto.ParseSymKeyB64(consentKeyB64)
+	return key_mgmt_i.UpdateAccessEdge(stub, consentID, symKeyID, edgeValue, edgeData)
+}
+
+// setConsentEdgeTerms sets the NotBefore, ExpirationDate, and ValidityWindows of a consent in the edge data of its
+// access edge, and removes the ones the consent doesn't have.
+func setConsentEdgeTerms(edgeData map[string]string, consent data_model.Consent) error {
+	delete(edgeData, global.EDGEDATA_NOT_BEFORE)
+	delete(edgeData, global.EDGEDATA_EXPIRATION_DATE)
+	delete(edgeData, global.EDGEDATA_VALIDITY_WINDOWS)
+
+	if consent.NotBefore != 0 {
+		edgeData[global.EDGEDATA_NOT_BEFORE] = strconv.FormatInt(consent.NotBefore, 10)
+	}
+	if consent.ExpirationDate != 0 {
+		edgeData[global.EDGEDATA_EXPIRATION_DATE] = strconv.FormatInt(consent.ExpirationDate, 10)
+	}
+	if len(consent.ValidityWindows) > 0 {
+		windowsBytes, err := json.Marshal(consent.ValidityWindows)
 		if err != nil {
-			logger.Errorf("Invalid consent key: %v", err)
-			return nil, errors.Wrap(err, "Invalid consent key")
+			custom_err := &custom_errors.MarshalError{Type: "consent.ValidityWindows"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
 		}
+		edgeData[global.EDGEDATA_VALIDITY_WINDOWS] = string(windowsBytes)
 	}
-
-	return nil, PutConsentWithParams(stub, caller, consent, consentKeyBytes)
+	return nil
 }
 
-// PutConsentWithParams updates an existing consent or adds new consent.
-// It takes consent object data_model.Consent, and consentKeyBytes []byte
-// as arguments instead of args in JSON format.
-//
-// consent is the consent object.
-// consentKeyBytes is only passed when creating a new consent.
-// A unique consent key must be used for each new consent.
-func PutConsentWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, consent data_model.Consent, consentKeyBytes []byte) error {
-	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
-	logger.Debugf("callerID: %v, consent: %v, consentKey len: %v", caller.ID, consent, len(consentKeyBytes))
-
-	// ==============================================================
-	// Validation of incoming consent
-	// ==============================================================
-
+// validateConsentToPut checks that a consent can be put by the caller, before anything is saved.
+// It validates the consent's fields, checks that its datatype exists, and that the caller is the owner
+// or has access to the owner's private key, unless the consent is delegated.
+// ConsentDate must be within 10 mins of the current time, unless the consent is part of a PutConsents batch.
+func validateConsentToPut(stub cached_stub.CachedStubInterface, caller data_model.User, consent data_model.Consent, isDelegation bool, isBatch bool) error {
 	if utils.IsStringEmpty(consent.TargetID) {
 		custom_err := &custom_errors.LengthCheckingError{Type: "consent.TargetID"}
 		logger.Errorf(custom_err.Error())
@@ -192,14 +1221,55 @@ func PutConsentWithParams(stub cached_stub.CachedStubInterface, caller data_mode
 		return errors.New("Access must be write, read, or deny")
 	}
 
-	// check that consentDate is within 10 mins of current time
-	currTime := time.Now().Unix()
-	if currTime-consent.ConsentDate > 10*60 || currTime-consent.ConsentDate < -10*60 {
-		logger.Errorf("Invalid consentDate (current time: %v)  %v", currTime, consent.ConsentDate)
-		return errors.New("Invalid ConsentDate, not within possible time range")
+	for _, purpose := range consent.Purposes {
+		if utils.IsStringEmpty(purpose) {
+			custom_err := &custom_errors.LengthCheckingError{Type: "consent.Purposes"}
+			logger.Errorf(custom_err.Error())
+			return errors.WithStack(custom_err)
+		}
+	}
+
+	if consent.MaxDelegationDepth < 0 || consent.MaxDelegationDepth > global.CONSENT_MAX_DELEGATION_DEPTH {
+		logger.Errorf("Invalid MaxDelegationDepth: %v", consent.MaxDelegationDepth)
+		return errors.Errorf("Invalid MaxDelegationDepth, it must be 0 to %v", global.CONSENT_MAX_DELEGATION_DEPTH)
 	}
 
-	assetManager := asset_mgmt_i.GetAssetManager(stub, caller)
+	if len(consent.Condition) > 0 && !json.Valid([]byte(consent.Condition)) {
+		logger.Errorf("Invalid consent condition: %v", consent.Condition)
+		return errors.New("Invalid consent condition, it must be a simple_rule expression in JSON format")
+	}
+
+	if consent.NotBefore != 0 && consent.ExpirationDate != 0 && consent.NotBefore >= consent.ExpirationDate {
+		logger.Errorf("NotBefore %v must be before ExpirationDate %v", consent.NotBefore, consent.ExpirationDate)
+		return errors.New("Invalid NotBefore, it must be before ExpirationDate")
+	}
+
+	for _, window := range consent.ValidityWindows {
+		if !window.IsValid() {
+			logger.Errorf("Invalid consent validity window: %v", window)
+			return errors.New("Invalid consent validity window, weekdays must be 0 to 6, and hours must be 0 to 24 with start hour before end hour")
+		}
+	}
+
+	if isBatch {
+		// consents of a batch may have been collected off-chain earlier, so only consent dates after the
+		// transaction timestamp are rejected
+		txTimestamp, err := getTxTimestamp(stub)
+		if err != nil {
+			return err
+		}
+		if consent.ConsentDate <= 0 || consent.ConsentDate > txTimestamp {
+			logger.Errorf("Invalid consentDate (transaction time: %v)  %v", txTimestamp, consent.ConsentDate)
+			return errors.New("Invalid ConsentDate, it can't be later than the transaction time")
+		}
+	} else {
+		// check that consentDate is within 10 mins of current time
+		currTime := time.Now().Unix()
+		if currTime-consent.ConsentDate > 10*60 || currTime-consent.ConsentDate < -10*60 {
+			logger.Errorf("Invalid consentDate (current time: %v)  %v", currTime, consent.ConsentDate)
+			return errors.New("Invalid ConsentDate, not within possible time range")
+		}
+	}
 
 	existingDatatype, err := datatype_i.GetDatatypeWithParams(stub, consent.DatatypeID)
 	if err != nil {
@@ -221,7 +1291,7 @@ func PutConsentWithParams(stub cached_stub.CachedStubInterface, caller data_mode
 		return errors.WithStack(custom_err)
 	}
 
-	if caller.ID != consent.OwnerID {
+	if caller.ID != consent.OwnerID && !isDelegation {
 		// Verify caller has access to private key of owner
 		privKey, err := user_mgmt_i.GetUserPrivateKey(stub, caller, consent.OwnerID)
 		if err != nil || len(privKey.KeyBytes) == 0 {
@@ -236,188 +1306,147 @@ func PutConsentWithParams(stub cached_stub.CachedStubInterface, caller data_mode
 		return errors.New("You can only add DENY to inactive datatype")
 	}
 
-	// Set ConsentID
-	consent.ConsentID = GetConsentID(consent.DatatypeID, consent.TargetID, consent.OwnerID)
-
-	// ==============================================================
-	// Convert consent to assetData
-	// ==============================================================
-
-	// Set CreatorID, CreatorID is always the caller
-	consent.CreatorID = caller.ID
-
-	// Init variables to be used
-	isNewConsent := true
-	consentOld := data_model.Consent{}
-	consentKey := data_model.Key{ID: consent.ConsentID, Type: global.KEY_TYPE_SYM}
-	consentAssetOld := data_model.Asset{}
-
-	// try to get existing consent asset
-	consentAssetId, err := GetConsentAssetID(stub, consent.ConsentID)
-	logger.Debugf("existing consentAssetId: %v, err: %v", consentAssetId, err)
-	if err == nil && len(consentAssetId) > 0 {
-		isNewConsent = false
-		//you should have access to consent asset key
-		consentKey.KeyBytes, err = getConsentAssetKeyByConsentAssetID(stub, caller, consentAssetId)
-		if err != nil {
-			logger.Errorf("Failed to getConsentAssetKey with error: %v", err)
-			return errors.Wrap(err, "Failed to getConsentAssetKey with error")
-		}
-		if len(consentKey.KeyBytes) == 0 {
-			logger.Errorf("Failed to getConsentAssetKey")
-			return errors.Wrap(err, "Failed to getConsentAssetKey:")
-		}
-
-		// get existing consent asset
-		consentAssetOld, err := asset_mgmt_i.GetAssetManager(stub, caller).GetAsset(consentAssetId, consentKey)
-		if err != nil {
-			logger.Errorf("Get old consent asset failed: %v", err)
-			return errors.Wrap(err, "Get old consent asset failed")
-		}
-		if data_model.IsEncryptedData(consentAssetOld.PrivateData) {
-			logger.Error("Failed to read consent private data")
-			return errors.New("Failed to read consent private data")
-		}
-
-		consentOld = convertFromAsset(consentAssetOld)
-
-		// consent date only changes if Access level has been changed
-		if consent.Access == consentOld.Access {
-			consent.ConsentDate = consentOld.ConsentDate
-		}
-
-		if consent.ExpirationDate == 0 {
-			consent.ExpirationDate = consentOld.ExpirationDate
-		}
-
-		// delete old consent asset's index values if caller changed
-		if consentOld.CreatorID != consent.CreatorID {
-			table := index.GetTable(stub, consentAssetOld.IndexTableName)
-			table.DeleteRow(consentOld.ConsentAssetID)
-		}
-	} else {
-		isNewConsent = true
-		// Get or create consent key object (CK)
-		if len(consentKeyBytes) == 0 {
-			logger.Errorf("Invalid consent key bytes")
-			return errors.Wrap(err, "Invalid consent keybytes")
-		}
+	return nil
+}
 
-		consentKey.KeyBytes = consentKeyBytes
-		if !crypto.ValidateSymKey(consentKey.KeyBytes) {
-			logger.Errorf("Invalid consent key")
-			return errors.New("Invalid consent key")
-		}
+// putConsentLog saves a transaction log of a change to a consent, encrypted with the consent key.
+// The log's Data is the consent, and Field1 to Field4 are the consent's ID, owner, target, and datatype.
+func putConsentLog(stub cached_stub.CachedStubInterface, caller data_model.User, consent data_model.Consent, consentKey data_model.Key, operation string) error {
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return err
 	}
 
-	logger.Debugf("isNewConsent: %v", isNewConsent)
-
-	// Make consent edge rule, will be same as edge data for consent edge
-	edgeData := make(map[string]string)
-	edgeData["edge"] = global.CONSENT_EDGE
-	edgeData["target"] = consent.TargetID
-	edgeData["owner"] = consent.OwnerID
-	edgeData["datatypeID"] = consent.DatatypeID
-
-	consent.ConsentAssetID = consent.ConsentID + consent.CreatorID
-
-	// convert consent to assetData
-	consentConverted := convertToAsset(consent)
-
-	// ==============================================================
-	// Add / update consent
-	// ==============================================================
-
-	// SymKey is DatatypeKey
-	// Add edges from CK to SymKey, and SymKey to CK if not deny
-	symKey := data_model.Key{}
+	transactionLog := data_model.TransactionLog{
+		Namespace:    global.CONSENT_LOG_NAMESPACE,
+		FunctionName: operation,
+		CallerID:     caller.ID,
+		Timestamp:    timestamp,
+		Data:         consent,
+		Field1:       consent.ConsentID,
+		Field2:       consent.OwnerID,
+		Field3:       consent.TargetID,
+		Field4:       consent.DatatypeID,
+	}
+	assetManager := asset_mgmt_i.GetAssetManager(stub, caller)
+	return history_i.PutInvokeTransactionLogWithSubID(assetManager, transactionLog, consent.ConsentID, consentKey)
+}
 
-	// If datatypeID is not empty, get datatypeSymKey
-	symKey, err = datatype_i.GetDatatypeSymKey(stub, caller, consent.DatatypeID, consent.OwnerID)
+// updateDelegatedConsents applies the terms of consent to the consents delegated from it, which are accessed
+// with consentKey. Delegated consents are revoked if consent is revoked, and are otherwise amended so that they
+// don't give more access than consent. Each update is also applied to the consents delegated from the updated consent.
+func updateDelegatedConsents(stub cached_stub.CachedStubInterface, caller data_model.User, consent data_model.Consent, consentKey data_model.Key) error {
+	delegatedConsentIDs, err := getDelegatedConsentIDs(stub, consentKey.ID)
 	if err != nil {
-		logger.Errorf("Failed to GetDatatypeSymKey: %v", err)
-		return errors.Wrap(err, "Failed to GetDatatypeSymKey")
+		return err
 	}
 
-	// Check consent access level
-	if consent.Access == global.ACCESS_READ || consent.Access == global.ACCESS_WRITE {
-		edgeData := make(map[string]string)
-		if consent.Access == global.ACCESS_WRITE {
-			edgeData[global.EDGEDATA_ACCESS_TYPE] = global.ACCESS_WRITE
-		} else {
-			edgeData[global.EDGEDATA_ACCESS_TYPE] = global.ACCESS_READ
+	for _, delegatedConsentID := range delegatedConsentIDs {
+		delegatedKeyBytes, err := key_mgmt_i.GetKey(stub, []string{consentKey.ID, delegatedConsentID}, consentKey.KeyBytes)
+		if err != nil {
+			logger.Errorf("Failed to get key of delegated consent %v: %v", delegatedConsentID, err)
+			return errors.Wrapf(err, "Failed to get key of delegated consent %v", delegatedConsentID)
 		}
-		// If Access level is read or write, add edge from CK to SymKey
-		err = key_mgmt_i.AddAccess(stub, consentKey, symKey, edgeData)
+		delegatedAsset, err := getConsentAssetByConsentID(stub, caller, delegatedConsentID, delegatedKeyBytes)
 		if err != nil {
-			custom_err := &custom_errors.AddAccessError{Key: "assetKey"}
+			custom_err := &custom_errors.GetConsentError{ConsentID: delegatedConsentID}
 			logger.Errorf("%v: %v", custom_err, err)
 			return errors.Wrap(err, custom_err.Error())
 		}
-
-		// add edge from owner key to CK
-		ownerKey, err := user_mgmt_i.GetUserPublicKey(stub, caller, consent.OwnerID)
-		if err != nil {
-			errMsg := "Failed to get public key of " + consent.OwnerID
-			logger.Errorf("%v: %v", errMsg, err)
-			return errors.Wrap(err, errMsg)
+		if delegatedAsset == nil {
+			continue
 		}
 
-		err = key_mgmt_i.AddAccess(stub, ownerKey, consentKey)
-		if err != nil {
-			custom_err := &custom_errors.AddAccessError{Key: "consentKey"}
-			logger.Errorf("%v: %v", custom_err, err)
-			return errors.Wrap(err, custom_err.Error())
+		delegatedConsent := convertFromAsset(delegatedAsset)
+		if delegatedConsent.Access == global.ACCESS_DENY {
+			continue
+		}
+		updatedConsent := getDelegatedConsentTerms(consent, delegatedConsent)
+		updatedBytes, _ := json.Marshal(&updatedConsent)
+		delegatedBytes, _ := json.Marshal(&delegatedConsent)
+		if bytes.Equal(updatedBytes, delegatedBytes) {
+			continue
 		}
 
-	} else { // If Access level is deny
-		// remove access from CK to SymKey but keep edge from SymKey to CK
-		err = key_mgmt_i.RevokeAccess(stub, consentKey.ID, symKey.ID)
+		if updatedConsent.Access != delegatedConsent.Access {
+			updatedConsent.ConsentDate, err = getTxTimestamp(stub)
+			if err != nil {
+				return err
+			}
+		}
+		operation := "AmendConsent"
+		if updatedConsent.Access == global.ACCESS_DENY {
+			operation = "RevokeConsent"
+		}
+		err = putConsent(stub, caller, updatedConsent, nil, operation, consentKey)
 		if err != nil {
-			logger.Errorf("Failed to revoke access from CK to SymKey: %v", err)
-			return errors.Wrap(err, "Failed to revoke access from SymKey to SymKey")
+			return err
 		}
 	}
+	return nil
+}
 
-	// Encrypt CK with target's key, create consent edge
-	targetKey, err := user_mgmt_i.GetUserPublicKey(stub, caller, consent.TargetID)
-	if err != nil {
-		errMsg := "Failed to get public key of " + consent.TargetID
-		logger.Errorf("%v: %v", errMsg, err)
-		return errors.Wrap(err, errMsg)
-	}
+// getDelegatedConsentTerms returns delegatedConsent with the terms of the parent consent it was delegated from,
+// the same way DelegateConsent sets them. It's revoked if parent is revoked or can't be delegated as deep anymore,
+// it only gives read access if parent gives read access, and its ExpirationDate isn't later than the parent's.
+func getDelegatedConsentTerms(parent data_model.Consent, delegatedConsent data_model.Consent) data_model.Consent {
+	if parent.Access == global.ACCESS_DENY || delegatedConsent.DelegationDepth > parent.MaxDelegationDepth {
+		delegatedConsent.Access = global.ACCESS_DENY
+		return delegatedConsent
+	}
+	if parent.Access == global.ACCESS_READ {
+		delegatedConsent.Access = global.ACCESS_READ
+	}
+	if parent.ExpirationDate != 0 && (delegatedConsent.ExpirationDate == 0 || delegatedConsent.ExpirationDate > parent.ExpirationDate) {
+		delegatedConsent.ExpirationDate = parent.ExpirationDate
+	}
+	delegatedConsent.NotBefore = parent.NotBefore
+	delegatedConsent.ValidityWindows = parent.ValidityWindows
+	delegatedConsent.Purposes = parent.Purposes
+	delegatedConsent.Condition = parent.Condition
+	delegatedConsent.MaxDelegationDepth = parent.MaxDelegationDepth
+	return delegatedConsent
+}
 
-	err = key_mgmt_i.AddAccess(stub, targetKey, consentKey, edgeData)
+// getDelegatedConsentIDs returns the IDs of the consents delegated from the consent with consentID,
+// which are the targets of the consent key's delegation edges.
+func getDelegatedConsentIDs(stub cached_stub.CachedStubInterface, consentID string) ([]string, error) {
+	iter, err := key_mgmt_i.GetStateByPartialCompositeKey(stub, []string{consentID})
 	if err != nil {
-		custom_err := &custom_errors.AddAccessError{Key: "consentKey"}
+		custom_err := &custom_errors.GetLedgerError{LedgerKey: consentID, LedgerItem: "child edges"}
 		logger.Errorf("%v: %v", custom_err, err)
-		return errors.Wrap(err, custom_err.Error())
+		return nil, errors.Wrap(err, custom_err.Error())
 	}
+	defer iter.Close()
 
-	// If this is an update and creator changed, delete old consent asset in ledger
-	if !isNewConsent && consentOld.CreatorID != consent.CreatorID {
-		assetLedgerKey := consentAssetOld.AssetId
-		err = stub.DelState(assetLedgerKey)
+	delegatedConsentIDs := []string{}
+	for iter.HasNext() {
+		KV, err := iter.Next()
 		if err != nil {
-			custom_err := &custom_errors.DeleteLedgerError{LedgerKey: assetLedgerKey}
+			custom_err := &custom_errors.IterError{}
 			logger.Errorf("%v: %v", custom_err, err)
-			return errors.Wrap(err, custom_err.Error())
+			return nil, errors.Wrap(err, custom_err.Error())
+		}
+		_, attributes, err := stub.SplitCompositeKey(KV.GetKey())
+		if err != nil || len(attributes) < 2 {
+			continue
+		}
+		_, edgeData, err := key_mgmt_i.GetAccessEdge(stub, consentID, attributes[1])
+		if err == nil && edgeData["edge"] == global.CONSENT_DELEGATION_EDGE {
+			delegatedConsentIDs = append(delegatedConsentIDs, attributes[1])
 		}
 	}
+	return delegatedConsentIDs, nil
+}
 
-	// Add/Update new consent asset
-	if !isNewConsent && consentOld.CreatorID == consent.CreatorID {
-		err = assetManager.UpdateAsset(consentConverted, consentKey, true)
-	} else {
-		err = assetManager.AddAsset(consentConverted, consentKey, true)
-	}
+// getTxTimestamp returns the transaction timestamp in seconds since the epoch.
+func getTxTimestamp(stub cached_stub.CachedStubInterface) (int64, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
 	if err != nil {
-		logger.Errorf("Failed to add Consent: %v", err)
-		return errors.Wrap(err, "Failed to add Consent")
+		logger.Errorf("Failed to get transaction timestamp: %v", err)
+		return 0, errors.Wrap(err, "Failed to get transaction timestamp")
 	}
-
-	// all set
-	return nil
+	return txTimestamp.GetSeconds(), nil
 }
 
 // GetConsent returns the specified consent asset.
@@ -531,15 +1560,20 @@ func GetConsentWithParams(stub cached_stub.CachedStubInterface, caller data_mode
 	return convertFromAsset(consentAsset), nil
 }
 
-// ValidateConsent gets the specified consent asset. If consent is found and if it passes the expiration date and access level checks, it returns filter rules and the consent key.
+// ValidateConsent gets the specified consent asset. If consent is found and if it passes the access level, NotBefore, expiration date, and validity window checks, it returns filter rules and the consent key.
 // Filter rule is a simple rule that contains consent owner ID which can be applied against an asset's owner ID, and either consent asset ID or consent
 // datatype ID which can be applied against asset's datatypeID to filter out assets.
 //
-// args: [datatypeID, ownerID, targetID, access, currTime]
+// args: [datatypeID, ownerID, targetID, access, currTime, requestContext]
 //
 // targetID is the ID of the consent recipient.
 // access is the desired access level that will be validated against the access recorded in the consent object.
 // currTime is the current timestamp generated.
+// requestContext is optional. It's a JSON map describing the request, such as {"purpose": "treatment", "org": "org1"}.
+// If the consent has Purposes, requestContext must have one of them as "purpose".
+// If the consent has a Condition, it is evaluated against requestContext, to which the following keys are added:
+// "caller_id" and "caller_role" of the caller, "current_time" (currTime), and "hour" (the UTC hour of currTime).
+// If the consent does not give access, a custom_errors.ConsentAccessError with the reason is returned.
 func ValidateConsent(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) (simple_rule.Rule, data_model.Key, error) {
 	// Step 1. Get consent asset for given datatypeID. If datatypeID not found, traverse up datatype tree and check consent given to parent datatype, then to grandparent, etc, until reaching ROOT. Return error if ROOT has been reached and no consent has been found.
 	// Step 2. Check expiration date and access.
@@ -547,7 +1581,7 @@ func ValidateConsent(stub cached_stub.CachedStubInterface, caller data_model.Use
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 	logger.Debugf("args: %v", args)
 
-	if len(args) != 5 {
+	if len(args) != 5 && len(args) != 6 {
 		custom_err := &custom_errors.LengthCheckingError{Type: "ValidateConsent args"}
 		logger.Errorf(custom_err.Error())
 		return simple_rule.NewRule(), data_model.Key{}, errors.WithStack(custom_err)
@@ -598,6 +1632,16 @@ func ValidateConsent(stub cached_stub.CachedStubInterface, caller data_model.Use
 		return simple_rule.NewRule(), data_model.Key{}, errors.New("Invalid current time, not within possible time range")
 	}
 
+	requestContext := make(map[string]interface{})
+	if len(args) == 6 && len(args[5]) > 0 {
+		err = json.Unmarshal([]byte(args[5]), &requestContext)
+		if err != nil {
+			custom_err := &custom_errors.UnmarshalError{Type: "requestContext"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return simple_rule.NewRule(), data_model.Key{}, errors.Wrap(err, custom_err.Error())
+		}
+	}
+
 	var consentID string
 	var dtype datatype_interface.DatatypeInterface
 	dtype, err = datatype_i.GetDatatypeWithParams(stub, datatypeID)
@@ -644,13 +1688,13 @@ func ValidateConsent(stub cached_stub.CachedStubInterface, caller data_model.Use
 
 	// Check consent access level
 	if consent.Access == global.ACCESS_DENY {
-		custom_err := &custom_errors.ConsentAccessError{ConsentId: consentID}
+		custom_err := &custom_errors.ConsentAccessError{ConsentId: consentID, Reason: "access is deny"}
 		logger.Errorf(custom_err.Error())
 		return simple_rule.NewRule(), data_model.Key{}, custom_err
 	}
 
 	if consent.Access != access && consent.Access != global.ACCESS_WRITE {
-		custom_err := &custom_errors.ConsentAccessError{ConsentId: consentID}
+		custom_err := &custom_errors.ConsentAccessError{ConsentId: consentID, Reason: "access is " + consent.Access}
 		logger.Errorf(custom_err.Error())
 		return simple_rule.NewRule(), data_model.Key{}, custom_err
 	}
@@ -661,6 +1705,30 @@ func ValidateConsent(stub cached_stub.CachedStubInterface, caller data_model.Use
 		return simple_rule.NewRule(), data_model.Key{}, errors.New("Expiration date has passed")
 	}
 
+	// Check start date and validity windows
+	if consent.NotBefore != 0 && currTime < consent.NotBefore {
+		custom_err := &custom_errors.ConsentAccessError{ConsentId: consentID, Reason: "consent is not in effect until " + strconv.FormatInt(consent.NotBefore, 10)}
+		logger.Errorf(custom_err.Error())
+		return simple_rule.NewRule(), data_model.Key{}, custom_err
+	}
+	if !consent.IsInEffect(currTime) {
+		custom_err := &custom_errors.ConsentAccessError{ConsentId: consentID, Reason: "current time is outside of the consent's validity windows"}
+		logger.Errorf(custom_err.Error())
+		return simple_rule.NewRule(), data_model.Key{}, custom_err
+	}
+
+	// Check purpose of use and condition
+	requestContext["caller_id"] = caller.ID
+	requestContext["caller_role"] = caller.Role
+	requestContext["current_time"] = currTime
+	requestContext["hour"] = time.Unix(currTime, 0).UTC().Hour()
+	reason := checkConsentRequestContext(consent, requestContext)
+	if len(reason) > 0 {
+		custom_err := &custom_errors.ConsentAccessError{ConsentId: consentID, Reason: reason}
+		logger.Errorf(custom_err.Error())
+		return simple_rule.NewRule(), data_model.Key{}, custom_err
+	}
+
 	// ==============================================================
 	// Return filters and consent key
 	// ==============================================================
@@ -699,6 +1767,37 @@ func ValidateConsent(stub cached_stub.CachedStubInterface, caller data_model.Use
 	return filter, consentKey, nil
 }
 
+// checkConsentRequestContext checks the consent's purposes of use and condition against requestContext.
+// It returns the reason the consent does not give access, or "" if it does.
+func checkConsentRequestContext(consent data_model.Consent, requestContext map[string]interface{}) string {
+	if len(consent.Purposes) > 0 {
+		purpose, _ := requestContext[global.CONSENT_CONTEXT_PURPOSE].(string)
+		if utils.IsStringEmpty(purpose) {
+			return "purpose of use is required"
+		}
+		if !utils.InList(consent.Purposes, purpose) {
+			return "purpose of use " + purpose + " is not allowed"
+		}
+	}
+
+	if len(consent.Condition) > 0 {
+		// convert the context to JSON so that numbers are evaluated as float64 values
+		requestContextBytes, err := json.Marshal(requestContext)
+		if err != nil {
+			return "failed to marshal request context: " + err.Error()
+		}
+		rule := simple_rule.NewRule(consent.Condition)
+		result, err := rule.Apply(string(requestContextBytes))
+		if err != nil {
+			return "failed to evaluate condition: " + err.Error()
+		}
+		if result["$result"] != simple_rule.D(true) {
+			return "condition is not met"
+		}
+	}
+	return ""
+}
+
 // GetConsentsWithOwnerID returns a list of consents, sorted by ownerID.
 //
 // args: [ownerID]
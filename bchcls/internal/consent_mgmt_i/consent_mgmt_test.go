@@ -12,12 +12,14 @@ package consent_mgmt_i
 import (
 	"common/bchcls/cached_stub"
 	"common/bchcls/crypto"
+	"common/bchcls/custom_errors"
 	"common/bchcls/data_model"
 	"common/bchcls/internal/asset_mgmt_i"
 	"common/bchcls/internal/common/global"
 	"common/bchcls/internal/datastore_i/datastore_c"
 	"common/bchcls/internal/datastore_i/datastore_c/cloudant/cloudant_datastore_test_utils"
 	"common/bchcls/internal/datatype_i"
+	"common/bchcls/internal/history_i"
 	"common/bchcls/internal/key_mgmt_i"
 	"common/bchcls/simple_rule"
 	"common/bchcls/test_utils"
@@ -31,6 +33,7 @@ import (
 	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
 )
 
 func generateConsent(ownerID, targetID, access, datatypeID, connectionID string) data_model.Consent {
@@ -56,6 +59,7 @@ func setup(t *testing.T) *test_utils.NewMockStub {
 	datatype_i.Init(stub, shim.LogDebug)
 	datastore_c.Init(stub, shim.LogDebug)
 	key_mgmt_i.Init(stub, shim.LogDebug)
+	history_i.Init(stub, shim.LogDebug)
 	Init(stub)
 	mstub.MockTransactionEnd("t1")
 	return mstub
@@ -1648,3 +1652,706 @@ func TestGetConsentsWithTargetIDAndOwnerID(t *testing.T) {
 	}
 	mstub.MockTransactionEnd("t1")
 }
+
+func TestConsentLifecycle(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestConsentLifecycle function called")
+
+	// create a MockStub
+	mstub := setup(t)
+
+	// Create owner and target
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	owner := test_utils.CreateTestUser("owner")
+	ownerBytes, _ := json.Marshal(&owner)
+	_, err := user_mgmt.RegisterUser(stub, owner, []string{string(ownerBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	target := test_utils.CreateTestUser("target")
+	targetBytes, _ := json.Marshal(&target)
+	_, err = user_mgmt.RegisterUser(stub, target, []string{string(targetBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	other := test_utils.CreateTestUser("other")
+	otherBytes, _ := json.Marshal(&other)
+	_, err = user_mgmt.RegisterUser(stub, other, []string{string(otherBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "datatype1", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "datatype1", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t3")
+
+	// amending or revoking a consent that does not exist fails
+	consent := generateConsent(owner.ID, target.ID, global.ACCESS_WRITE, "datatype1", "")
+	consentBytes, _ := json.Marshal(&consent)
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = AmendConsent(stub, owner, []string{string(consentBytes)})
+	test_utils.AssertTrue(t, err != nil, "Expected AmendConsent of a new consent to fail")
+	_, err = RevokeConsent(stub, owner, []string{"datatype1", target.ID, owner.ID})
+	test_utils.AssertTrue(t, err != nil, "Expected RevokeConsent of a new consent to fail")
+	mstub.MockTransactionEnd("t4")
+
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = PutConsent(stub, owner, []string{string(consentBytes), crypto.EncodeToB64String(test_utils.GenerateSymKey())})
+	test_utils.AssertTrue(t, err == nil, "PutConsent should be successful")
+	mstub.MockTransactionEnd("t5")
+
+	// amend access to read
+	consent.Access = global.ACCESS_READ
+	consent.ConsentDate = 0
+	consentBytes, _ = json.Marshal(&consent)
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = AmendConsent(stub, owner, []string{string(consentBytes)})
+	test_utils.AssertTrue(t, err == nil, "AmendConsent should be successful")
+	mstub.MockTransactionEnd("t6")
+
+	consent.Access = global.ACCESS_DENY
+	consentBytes, _ = json.Marshal(&consent)
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = AmendConsent(stub, owner, []string{string(consentBytes)})
+	test_utils.AssertTrue(t, err != nil, "Expected AmendConsent to deny to fail")
+	_, err = RevokeConsent(stub, target, []string{"datatype1", target.ID, owner.ID})
+	test_utils.AssertTrue(t, err != nil, "Expected RevokeConsent by target to fail")
+	mstub.MockTransactionEnd("t7")
+
+	// revoke
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = RevokeConsent(stub, owner, []string{"datatype1", target.ID, owner.ID})
+	test_utils.AssertTrue(t, err == nil, "RevokeConsent should be successful")
+	mstub.MockTransactionEnd("t8")
+
+	mstub.MockTransactionStart("t9")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = RevokeConsent(stub, owner, []string{"datatype1", target.ID, owner.ID})
+	test_utils.AssertTrue(t, err != nil, "Expected RevokeConsent of a revoked consent to fail")
+	consentID := GetConsentID("datatype1", target.ID, owner.ID)
+	revokedConsent, err := GetConsentWithParams(stub, target, consentID)
+	test_utils.AssertTrue(t, err == nil, "GetConsent should be successful")
+	test_utils.AssertTrue(t, revokedConsent.Access == global.ACCESS_DENY, "Expected revoked consent")
+	txTimestamp, _ := stub.GetTxTimestamp()
+	test_utils.AssertTrue(t, txTimestamp.GetSeconds()-revokedConsent.ConsentDate < 60, "Expected ConsentDate to be the time of revocation")
+
+	// both owner and target can get the history
+	for _, user := range []data_model.User{owner, target} {
+		historyBytes, err := GetConsentHistory(stub, user, []string{consentID})
+		test_utils.AssertTrue(t, err == nil, "GetConsentHistory should be successful")
+		versions := []data_model.ConsentVersion{}
+		json.Unmarshal(historyBytes, &versions)
+		test_utils.AssertTrue(t, len(versions) == 3, "Expected 3 consent versions")
+		if len(versions) == 3 {
+			test_utils.AssertListsEqual(t, []string{"PutConsent", "AmendConsent", "RevokeConsent"}, []string{versions[0].Operation, versions[1].Operation, versions[2].Operation})
+			test_utils.AssertListsEqual(t, []string{"t5", "t6", "t8"}, []string{versions[0].TransactionID, versions[1].TransactionID, versions[2].TransactionID})
+			test_utils.AssertListsEqual(t, []string{global.ACCESS_WRITE, global.ACCESS_READ, global.ACCESS_DENY}, []string{versions[0].Consent.Access, versions[1].Consent.Access, versions[2].Consent.Access})
+			test_utils.AssertTrue(t, versions[2].CallerID == owner.ID, "Expected owner to revoke the consent")
+			test_utils.AssertTrue(t, versions[2].Timestamp == revokedConsent.ConsentDate, "Expected revocation time in history")
+		}
+	}
+
+	_, err = GetConsentHistory(stub, other, []string{consentID})
+	test_utils.AssertTrue(t, err != nil, "Expected GetConsentHistory by other user to fail")
+	mstub.MockTransactionEnd("t9")
+}
+
+func TestValidateConsent_PurposeAndCondition(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestValidateConsent_PurposeAndCondition function called")
+
+	// create a MockStub
+	mstub := setup(t)
+
+	// Create owner and target
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	owner := test_utils.CreateTestUser("owner")
+	ownerBytes, _ := json.Marshal(&owner)
+	_, err := user_mgmt.RegisterUser(stub, owner, []string{string(ownerBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	target := test_utils.CreateTestUser("target")
+	targetBytes, _ := json.Marshal(&target)
+	_, err = user_mgmt.RegisterUser(stub, target, []string{string(targetBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "datatype1", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "datatype1", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t3")
+
+	// invalid purposes and conditions are rejected
+	consent := generateConsent(owner.ID, target.ID, global.ACCESS_READ, "datatype1", "")
+	consent.Purposes = []string{global.PURPOSE_TREATMENT, ""}
+	consentBytes, _ := json.Marshal(&consent)
+	consentKeyB64 := crypto.EncodeToB64String(test_utils.GenerateSymKey())
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = PutConsent(stub, owner, []string{string(consentBytes), consentKeyB64})
+	test_utils.AssertTrue(t, err != nil, "Expected PutConsent with empty purpose to fail")
+	consent.Purposes = []string{global.PURPOSE_TREATMENT}
+	consent.Condition = `{"==": [{"var": "caller_role"}`
+	consentBytes, _ = json.Marshal(&consent)
+	_, err = PutConsent(stub, owner, []string{string(consentBytes), consentKeyB64})
+	test_utils.AssertTrue(t, err != nil, "Expected PutConsent with invalid condition to fail")
+	mstub.MockTransactionEnd("t4")
+
+	// consent for treatment by a user of org1, only during the hours given in the request context
+	consent.Condition = `{"and": [{"==": [{"var": "caller_role"}, "user"]}, {"==": [{"var": "org"}, "org1"]}, {"<=": [{"var": "min_hour"}, {"var": "hour"}, {"var": "max_hour"}]}]}`
+	consentBytes, _ = json.Marshal(&consent)
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = PutConsent(stub, owner, []string{string(consentBytes), consentKeyB64})
+	test_utils.AssertTrue(t, err == nil, "PutConsent should be successful")
+	mstub.MockTransactionEnd("t5")
+
+	currTime := time.Now().Unix()
+	hour := time.Unix(currTime, 0).UTC().Hour()
+	validate := func(requestContext ...string) error {
+		args := []string{"datatype1", owner.ID, target.ID, global.ACCESS_READ, strconv.FormatInt(currTime, 10)}
+		args = append(args, requestContext...)
+		mstub.MockTransactionStart("t6")
+		defer mstub.MockTransactionEnd("t6")
+		stub := cached_stub.NewCachedStub(mstub)
+		_, _, err := ValidateConsent(stub, target, args)
+		return err
+	}
+	assertAccessError := func(err error, reason string) {
+		accessErr, ok := errors.Cause(err).(*custom_errors.ConsentAccessError)
+		test_utils.AssertTrue(t, ok, "Expected ConsentAccessError")
+		if ok {
+			test_utils.AssertTrue(t, accessErr.Reason == reason, "Expected reason: "+reason+", got: "+accessErr.Reason)
+		}
+	}
+
+	err = validate(fmt.Sprintf(`{"purpose": "treatment", "org": "org1", "min_hour": %v, "max_hour": %v}`, hour, hour))
+	test_utils.AssertTrue(t, err == nil, "ValidateConsent should be successful")
+
+	assertAccessError(validate(), "purpose of use is required")
+	assertAccessError(validate(`{"purpose": "research", "org": "org1"}`), "purpose of use research is not allowed")
+	assertAccessError(validate(fmt.Sprintf(`{"purpose": "treatment", "org": "org2", "min_hour": %v, "max_hour": %v}`, hour, hour)), "condition is not met")
+	assertAccessError(validate(fmt.Sprintf(`{"purpose": "treatment", "org": "org1", "min_hour": %v, "max_hour": %v}`, hour+1, hour+1)), "condition is not met")
+	// caller_role can not be overridden by the request context
+	target.Role = "system"
+	assertAccessError(validate(fmt.Sprintf(`{"purpose": "treatment", "org": "org1", "caller_role": "user", "min_hour": %v, "max_hour": %v}`, hour, hour)), "condition is not met")
+
+	err = validate(`{"purpose": `)
+	test_utils.AssertTrue(t, err != nil, "Expected ValidateConsent with invalid request context to fail")
+}
+
+func TestValidateConsent_NotBeforeAndValidityWindows(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestValidateConsent_NotBeforeAndValidityWindows function called")
+
+	// create a MockStub
+	mstub := setup(t)
+
+	// Create owner and target
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	owner := test_utils.CreateTestUser("owner")
+	ownerBytes, _ := json.Marshal(&owner)
+	_, err := user_mgmt.RegisterUser(stub, owner, []string{string(ownerBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	target := test_utils.CreateTestUser("target")
+	targetBytes, _ := json.Marshal(&target)
+	_, err = user_mgmt.RegisterUser(stub, target, []string{string(targetBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "datatype1", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "datatype1", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t3")
+
+	currTime := time.Now().Unix()
+	weekday := int(time.Unix(currTime, 0).UTC().Weekday())
+	hour := time.Unix(currTime, 0).UTC().Hour()
+	consentKeyB64 := crypto.EncodeToB64String(test_utils.GenerateSymKey())
+	putConsent := func(txID string, consent data_model.Consent) error {
+		consentBytes, _ := json.Marshal(&consent)
+		mstub.MockTransactionStart(txID)
+		defer mstub.MockTransactionEnd(txID)
+		stub := cached_stub.NewCachedStub(mstub)
+		_, err := PutConsent(stub, owner, []string{string(consentBytes), consentKeyB64})
+		return err
+	}
+	validate := func(txID string) error {
+		args := []string{"datatype1", owner.ID, target.ID, global.ACCESS_READ, strconv.FormatInt(currTime, 10)}
+		mstub.MockTransactionStart(txID)
+		defer mstub.MockTransactionEnd(txID)
+		stub := cached_stub.NewCachedStub(mstub)
+		_, _, err := ValidateConsent(stub, target, args)
+		return err
+	}
+
+	// invalid NotBefore and validity windows are rejected
+	consent := generateConsent(owner.ID, target.ID, global.ACCESS_READ, "datatype1", "")
+	consent.NotBefore = consent.ExpirationDate
+	test_utils.AssertTrue(t, putConsent("t4", consent) != nil, "Expected PutConsent with NotBefore after ExpirationDate to fail")
+	consent.NotBefore = 0
+	for _, window := range []data_model.ConsentWindow{{StartHour: 9, EndHour: 9}, {StartHour: 0, EndHour: 25}, {Weekdays: []int{7}, StartHour: 9, EndHour: 17}} {
+		consent.ValidityWindows = []data_model.ConsentWindow{window}
+		test_utils.AssertTrue(t, putConsent("t4", consent) != nil, "Expected PutConsent with invalid validity window to fail")
+	}
+
+	// consent that activates in the future
+	consent.ValidityWindows = nil
+	consent.NotBefore = currTime + 60*60
+	test_utils.AssertTrue(t, putConsent("t5", consent) == nil, "PutConsent should be successful")
+	err = validate("t6")
+	accessErr, ok := errors.Cause(err).(*custom_errors.ConsentAccessError)
+	test_utils.AssertTrue(t, ok && strings.Contains(accessErr.Reason, "not in effect"), "Expected consent not to be in effect yet")
+
+	// consent that is active during the current hour on the current day of the week
+	consent.NotBefore = currTime - 60
+	consent.ValidityWindows = []data_model.ConsentWindow{{Weekdays: []int{(weekday + 1) % 7}, StartHour: 0, EndHour: 24}, {Weekdays: []int{weekday}, StartHour: hour, EndHour: hour + 1}}
+	test_utils.AssertTrue(t, putConsent("t7", consent) == nil, "PutConsent should be successful")
+	test_utils.AssertTrue(t, validate("t8") == nil, "ValidateConsent should be successful")
+
+	// consent that is active on other days of the week only
+	consent.ValidityWindows = consent.ValidityWindows[:1]
+	test_utils.AssertTrue(t, putConsent("t9", consent) == nil, "PutConsent should be successful")
+	err = validate("t10")
+	accessErr, ok = errors.Cause(err).(*custom_errors.ConsentAccessError)
+	test_utils.AssertTrue(t, ok && strings.Contains(accessErr.Reason, "validity windows"), "Expected current time to be outside of the validity windows")
+}
+
+func TestDelegateConsent(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestDelegateConsent function called")
+
+	// create a MockStub
+	mstub := setup(t)
+
+	// Create owner, hospital, two labs, and another user
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	users := make(map[string]data_model.User)
+	for _, userID := range []string{"owner", "hospital", "lab1", "lab2", "other"} {
+		user := test_utils.CreateTestUser(userID)
+		userBytes, _ := json.Marshal(&user)
+		_, err := user_mgmt.RegisterUser(stub, user, []string{string(userBytes), "false"})
+		test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+		users[userID] = user
+	}
+	mstub.MockTransactionEnd("t1")
+	owner := users["owner"]
+	hospital := users["hospital"]
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err := datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "datatype1", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "datatype1", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t3")
+
+	// owner gives write consent to hospital, which can be delegated twice
+	rootConsent := generateConsent(owner.ID, hospital.ID, global.ACCESS_WRITE, "datatype1", "")
+	rootConsent.MaxDelegationDepth = 2
+	rootConsentBytes, _ := json.Marshal(&rootConsent)
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = PutConsent(stub, owner, []string{string(rootConsentBytes), crypto.EncodeToB64String(test_utils.GenerateSymKey())})
+	test_utils.AssertTrue(t, err == nil, "PutConsent should be successful")
+	mstub.MockTransactionEnd("t4")
+	rootConsentID := GetConsentID("datatype1", hospital.ID, owner.ID)
+
+	delegate := func(txID string, caller data_model.User, parentConsentID string, targetID string, access string) error {
+		consent := generateConsent(owner.ID, targetID, access, "datatype1", "")
+		consent.ParentConsentID = parentConsentID
+		// ExpirationDate of the parent consent is used
+		consent.ExpirationDate = 0
+		consentBytes, _ := json.Marshal(&consent)
+		mstub.MockTransactionStart(txID)
+		defer mstub.MockTransactionEnd(txID)
+		stub := cached_stub.NewCachedStub(mstub)
+		_, err := DelegateConsent(stub, caller, []string{string(consentBytes), crypto.EncodeToB64String(test_utils.GenerateSymKey())})
+		return err
+	}
+	getAccess := func(txID string, consentID string) string {
+		mstub.MockTransactionStart(txID)
+		defer mstub.MockTransactionEnd(txID)
+		stub := cached_stub.NewCachedStub(mstub)
+		consent, err := GetConsentWithParams(stub, owner, consentID)
+		test_utils.AssertTrue(t, err == nil, "GetConsent should be successful")
+		return consent.Access
+	}
+	validate := func(txID string, target data_model.User) error {
+		args := []string{"datatype1", owner.ID, target.ID, global.ACCESS_READ, strconv.FormatInt(time.Now().Unix(), 10)}
+		mstub.MockTransactionStart(txID)
+		defer mstub.MockTransactionEnd(txID)
+		stub := cached_stub.NewCachedStub(mstub)
+		_, _, err := ValidateConsent(stub, target, args)
+		return err
+	}
+
+	// hospital delegates read access to lab1, and lab1 to lab2
+	test_utils.AssertTrue(t, delegate("t5", users["other"], rootConsentID, users["lab1"].ID, global.ACCESS_READ) != nil, "Expected DelegateConsent by other user to fail")
+	test_utils.AssertTrue(t, delegate("t6", hospital, rootConsentID, users["lab1"].ID, global.ACCESS_READ) == nil, "DelegateConsent should be successful")
+	lab1ConsentID := GetConsentID("datatype1", users["lab1"].ID, owner.ID)
+	test_utils.AssertTrue(t, validate("t7", users["lab1"]) == nil, "ValidateConsent of delegated consent should be successful")
+	test_utils.AssertTrue(t, delegate("t8", users["lab1"], lab1ConsentID, users["lab2"].ID, global.ACCESS_WRITE) != nil, "Expected DelegateConsent of read consent as write to fail")
+	test_utils.AssertTrue(t, delegate("t9", users["lab1"], lab1ConsentID, users["lab2"].ID, global.ACCESS_READ) == nil, "DelegateConsent should be successful")
+	lab2ConsentID := GetConsentID("datatype1", users["lab2"].ID, owner.ID)
+	test_utils.AssertTrue(t, validate("t10", users["lab2"]) == nil, "ValidateConsent of delegated consent should be successful")
+	test_utils.AssertTrue(t, delegate("t11", users["lab2"], lab2ConsentID, users["other"].ID, global.ACCESS_READ) != nil, "Expected DelegateConsent beyond max depth to fail")
+
+	// owner can't update a delegated consent with PutConsent
+	lab1Consent := generateConsent(owner.ID, users["lab1"].ID, global.ACCESS_WRITE, "datatype1", "")
+	lab1ConsentBytes, _ := json.Marshal(&lab1Consent)
+	mstub.MockTransactionStart("t12")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = PutConsent(stub, owner, []string{string(lab1ConsentBytes)})
+	test_utils.AssertTrue(t, err != nil, "Expected PutConsent of delegated consent to fail")
+	mstub.MockTransactionEnd("t12")
+
+	// hospital revokes lab1's consent, which cascades to lab2
+	mstub.MockTransactionStart("t13")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = RevokeConsentWithParams(stub, hospital, lab1ConsentID)
+	test_utils.AssertTrue(t, err == nil, "RevokeConsent by delegator should be successful")
+	mstub.MockTransactionEnd("t13")
+	test_utils.AssertTrue(t, getAccess("t14", lab1ConsentID) == global.ACCESS_DENY, "Expected lab1's consent to be revoked")
+	test_utils.AssertTrue(t, getAccess("t15", lab2ConsentID) == global.ACCESS_DENY, "Expected lab2's consent to be revoked")
+	test_utils.AssertTrue(t, validate("t16", users["lab2"]) != nil, "Expected ValidateConsent of revoked consent to fail")
+
+	// hospital delegates to lab1 again, then owner revokes the root consent
+	test_utils.AssertTrue(t, delegate("t17", hospital, rootConsentID, users["lab1"].ID, global.ACCESS_READ) == nil, "DelegateConsent should be successful")
+	test_utils.AssertTrue(t, getAccess("t18", lab1ConsentID) == global.ACCESS_READ, "Expected lab1's consent to be given again")
+	mstub.MockTransactionStart("t19")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = RevokeConsentWithParams(stub, owner, rootConsentID)
+	test_utils.AssertTrue(t, err == nil, "RevokeConsent should be successful")
+	mstub.MockTransactionEnd("t19")
+	test_utils.AssertTrue(t, getAccess("t20", lab1ConsentID) == global.ACCESS_DENY, "Expected lab1's consent to be revoked")
+	test_utils.AssertTrue(t, validate("t21", users["lab1"]) != nil, "Expected ValidateConsent of revoked consent to fail")
+	test_utils.AssertTrue(t, delegate("t22", hospital, rootConsentID, users["lab1"].ID, global.ACCESS_READ) != nil, "Expected DelegateConsent of revoked consent to fail")
+}
+
+func TestDelegateConsent_AmendParent(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestDelegateConsent_AmendParent function called")
+
+	// create a MockStub
+	mstub := setup(t)
+
+	// Create owner, hospital, and two labs
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	users := make(map[string]data_model.User)
+	for _, userID := range []string{"owner", "hospital", "lab1", "lab2"} {
+		user := test_utils.CreateTestUser(userID)
+		userBytes, _ := json.Marshal(&user)
+		_, err := user_mgmt.RegisterUser(stub, user, []string{string(userBytes), "false"})
+		test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+		users[userID] = user
+	}
+	mstub.MockTransactionEnd("t1")
+	owner := users["owner"]
+	hospital := users["hospital"]
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err := datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "datatype1", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "datatype1", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t3")
+
+	// owner gives write consent to hospital, which can be delegated twice
+	rootConsent := generateConsent(owner.ID, hospital.ID, global.ACCESS_WRITE, "datatype1", "")
+	rootConsent.MaxDelegationDepth = 2
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = PutConsentWithParams(stub, owner, rootConsent, test_utils.GenerateSymKey())
+	test_utils.AssertTrue(t, err == nil, "PutConsent should be successful")
+	mstub.MockTransactionEnd("t4")
+	rootConsentID := GetConsentID("datatype1", hospital.ID, owner.ID)
+	lab1ConsentID := GetConsentID("datatype1", users["lab1"].ID, owner.ID)
+	lab2ConsentID := GetConsentID("datatype1", users["lab2"].ID, owner.ID)
+
+	// hospital delegates write access to lab1, and lab1 to lab2
+	for i, delegation := range [][]string{{"hospital", rootConsentID, "lab1"}, {"lab1", lab1ConsentID, "lab2"}} {
+		consent := generateConsent(owner.ID, users[delegation[2]].ID, global.ACCESS_WRITE, "datatype1", "")
+		consent.ParentConsentID = delegation[1]
+		consent.ExpirationDate = 0
+		txID := "t5" + strconv.Itoa(i)
+		mstub.MockTransactionStart(txID)
+		stub = cached_stub.NewCachedStub(mstub)
+		err = DelegateConsentWithParams(stub, users[delegation[0]], consent, test_utils.GenerateSymKey())
+		test_utils.AssertTrue(t, err == nil, "DelegateConsent should be successful")
+		mstub.MockTransactionEnd(txID)
+	}
+
+	getConsent := func(txID string, consentID string) data_model.Consent {
+		mstub.MockTransactionStart(txID)
+		defer mstub.MockTransactionEnd(txID)
+		stub := cached_stub.NewCachedStub(mstub)
+		consent, err := GetConsentWithParams(stub, owner, consentID)
+		test_utils.AssertTrue(t, err == nil, "GetConsent should be successful")
+		return consent
+	}
+
+	// owner narrows the root consent to read access for treatment, expiring sooner
+	rootConsent.Access = global.ACCESS_READ
+	rootConsent.ExpirationDate = rootConsent.ExpirationDate - 60*60
+	rootConsent.Purposes = []string{"treatment"}
+	rootConsent.ConsentDate = 0
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = AmendConsentWithParams(stub, owner, rootConsent)
+	test_utils.AssertTrue(t, err == nil, "AmendConsent should be successful")
+	mstub.MockTransactionEnd("t6")
+
+	for i, consentID := range []string{lab1ConsentID, lab2ConsentID} {
+		consent := getConsent("t7"+strconv.Itoa(i), consentID)
+		test_utils.AssertTrue(t, consent.Access == global.ACCESS_READ, "Expected delegated consent to give read access")
+		test_utils.AssertTrue(t, consent.ExpirationDate == rootConsent.ExpirationDate, "Expected ExpirationDate of the root consent")
+		test_utils.AssertTrue(t, len(consent.Purposes) == 1 && consent.Purposes[0] == "treatment", "Expected Purposes of the root consent")
+	}
+
+	// owner lowers the max delegation depth, which revokes lab2's consent
+	rootConsent.MaxDelegationDepth = 1
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = AmendConsentWithParams(stub, owner, rootConsent)
+	test_utils.AssertTrue(t, err == nil, "AmendConsent should be successful")
+	mstub.MockTransactionEnd("t8")
+
+	lab1Consent := getConsent("t9", lab1ConsentID)
+	test_utils.AssertTrue(t, lab1Consent.Access == global.ACCESS_READ && lab1Consent.MaxDelegationDepth == 1, "Expected lab1's consent to be kept")
+	test_utils.AssertTrue(t, getConsent("t10", lab2ConsentID).Access == global.ACCESS_DENY, "Expected lab2's consent to be revoked")
+}
+
+func TestPutConsents(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestPutConsents function called")
+
+	// create a MockStub
+	mstub := setup(t)
+
+	// Create owner, two targets, and another user
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	users := make(map[string]data_model.User)
+	for _, userID := range []string{"owner", "target1", "target2", "other"} {
+		user := test_utils.CreateTestUser(userID)
+		userBytes, _ := json.Marshal(&user)
+		_, err := user_mgmt.RegisterUser(stub, user, []string{string(userBytes), "false"})
+		test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+		users[userID] = user
+	}
+	mstub.MockTransactionEnd("t1")
+	owner := users["owner"]
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err := datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "datatype1", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "datatype1", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t3")
+
+	// batch with two valid consents, and consents with invalid access, another owner, a duplicate, and no key
+	invalidConsent := generateConsent(owner.ID, users["target1"].ID, "invalid", "datatype1", "")
+	consents := []data_model.Consent{
+		generateConsent(owner.ID, users["target1"].ID, global.ACCESS_READ, "datatype1", ""),
+		generateConsent(owner.ID, users["target2"].ID, global.ACCESS_WRITE, "datatype1", ""),
+		invalidConsent,
+		generateConsent(users["other"].ID, users["target1"].ID, global.ACCESS_READ, "datatype1", ""),
+		generateConsent(owner.ID, users["target1"].ID, global.ACCESS_WRITE, "datatype1", ""),
+		generateConsent(owner.ID, users["other"].ID, global.ACCESS_READ, "datatype1", ""),
+	}
+	consentKeysB64 := []string{}
+	for i := range consents {
+		consentKeyB64 := crypto.EncodeToB64String(test_utils.GenerateSymKey())
+		if i == len(consents)-1 {
+			consentKeyB64 = ""
+		}
+		consentKeysB64 = append(consentKeysB64, consentKeyB64)
+	}
+	consentsBytes, _ := json.Marshal(&consents)
+	consentKeysBytes, _ := json.Marshal(&consentKeysB64)
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	resultsBytes, err := PutConsents(stub, owner, []string{string(consentsBytes), string(consentKeysBytes)})
+	test_utils.AssertTrue(t, err == nil, "PutConsents should be successful")
+	mstub.MockTransactionEnd("t4")
+
+	results := []data_model.ConsentResult{}
+	json.Unmarshal(resultsBytes, &results)
+	test_utils.AssertTrue(t, len(results) == len(consents), "Expected a result for each consent")
+	test_utils.AssertTrue(t, results[0].Success && results[1].Success, "Expected valid consents to be put")
+	test_utils.AssertTrue(t, results[0].ConsentID == GetConsentID("datatype1", users["target1"].ID, owner.ID), "Expected consent ID in result")
+	test_utils.AssertTrue(t, !results[2].Success && len(results[2].ConsentID) == 0 && len(results[2].Error) > 0, "Expected consent with invalid access to fail")
+	test_utils.AssertTrue(t, !results[3].Success && len(results[3].Error) > 0, "Expected consent of another owner to fail")
+	test_utils.AssertTrue(t, !results[4].Success && strings.Contains(results[4].Error, "already in the batch"), "Expected duplicate consent to fail")
+	test_utils.AssertTrue(t, !results[5].Success && strings.Contains(results[5].Error, "Consent key is required"), "Expected new consent without key to fail")
+
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	consent, err := GetConsentWithParams(stub, owner, results[1].ConsentID)
+	test_utils.AssertTrue(t, err == nil && consent.Access == global.ACCESS_WRITE, "Expected consent of batch to be put")
+	mstub.MockTransactionEnd("t5")
+
+	// existing consents can be updated without keys
+	consents[0].Access = global.ACCESS_DENY
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	results, err = PutConsentsWithParams(stub, owner, consents[:2], nil)
+	test_utils.AssertTrue(t, err == nil && results[0].Success && results[1].Success, "PutConsents of existing consents should be successful")
+	mstub.MockTransactionEnd("t6")
+
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	versions, err := GetConsentHistoryWithParams(stub, owner, results[0].ConsentID)
+	test_utils.AssertTrue(t, err == nil && len(versions) == 2, "Expected 2 versions of consent")
+	test_utils.AssertTrue(t, versions[1].Operation == "PutConsents" && versions[1].Consent.Access == global.ACCESS_DENY, "Expected consent to be revoked by PutConsents")
+	mstub.MockTransactionEnd("t7")
+
+	// empty batch and batch with a key missing fail
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = PutConsentsWithParams(stub, owner, []data_model.Consent{}, nil)
+	test_utils.AssertTrue(t, err != nil, "Expected PutConsents of empty batch to fail")
+	_, err = PutConsentsWithParams(stub, owner, consents[:2], [][]byte{test_utils.GenerateSymKey()})
+	test_utils.AssertTrue(t, err != nil, "Expected PutConsents with a consent key missing to fail")
+	mstub.MockTransactionEnd("t8")
+
+	// consents collected earlier can be put, but consent dates after the transaction time are rejected
+	pastConsent := generateConsent(owner.ID, users["other"].ID, global.ACCESS_READ, "datatype1", "")
+	pastConsent.ConsentDate = pastConsent.ConsentDate - 2*60*60*24
+	futureConsent := generateConsent(owner.ID, users["target1"].ID, global.ACCESS_READ, "datatype1", "")
+	futureConsent.ConsentDate = futureConsent.ConsentDate + 60*60
+	mstub.MockTransactionStart("t9")
+	stub = cached_stub.NewCachedStub(mstub)
+	results, err = PutConsentsWithParams(stub, owner, []data_model.Consent{pastConsent, futureConsent}, [][]byte{test_utils.GenerateSymKey(), {}})
+	test_utils.AssertTrue(t, err == nil, "PutConsents should be successful")
+	test_utils.AssertTrue(t, results[0].Success, "Expected consent collected earlier to be put")
+	test_utils.AssertTrue(t, !results[1].Success && strings.Contains(results[1].Error, "ConsentDate"), "Expected consent with a future ConsentDate to fail")
+	mstub.MockTransactionEnd("t9")
+
+	mstub.MockTransactionStart("t10")
+	stub = cached_stub.NewCachedStub(mstub)
+	consent, err = GetConsentWithParams(stub, owner, results[0].ConsentID)
+	test_utils.AssertTrue(t, err == nil && consent.ConsentDate == pastConsent.ConsentDate, "Expected ConsentDate of the batch")
+	mstub.MockTransactionEnd("t10")
+}
+
+func TestExportConsentReceipt(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestExportConsentReceipt function called")
+
+	// create a MockStub
+	mstub := setup(t)
+
+	// Create owner and target
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	owner := test_utils.CreateTestUser("owner")
+	ownerBytes, _ := json.Marshal(&owner)
+	_, err := user_mgmt.RegisterUser(stub, owner, []string{string(ownerBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	target := test_utils.CreateTestUser("target")
+	targetBytes, _ := json.Marshal(&target)
+	_, err = user_mgmt.RegisterUser(stub, target, []string{string(targetBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "datatype1", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "datatype1", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t3")
+
+	consent := generateConsent(owner.ID, target.ID, global.ACCESS_READ, "datatype1", "")
+	consent.Purposes = []string{global.PURPOSE_TREATMENT, global.PURPOSE_RESEARCH}
+	consentBytes, _ := json.Marshal(&consent)
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = PutConsent(stub, owner, []string{string(consentBytes), crypto.EncodeToB64String(test_utils.GenerateSymKey())})
+	test_utils.AssertTrue(t, err == nil, "PutConsent should be successful")
+	mstub.MockTransactionEnd("t4")
+	consentID := GetConsentID("datatype1", target.ID, owner.ID)
+
+	// owner exports a receipt
+	receiptTemplate := `{"jurisdiction": "US", "collectionMethod": "web form", "policyUrl": "https://example.com/policy"}`
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	signedReceiptBytes, err := ExportConsentReceipt(stub, owner, []string{consentID, receiptTemplate})
+	test_utils.AssertTrue(t, err == nil, "ExportConsentReceipt should be successful")
+	mstub.MockTransactionEnd("t5")
+
+	signedReceipt := data_model.SignedConsentReceipt{}
+	json.Unmarshal(signedReceiptBytes, &signedReceipt)
+	receipt := signedReceipt.Receipt
+	test_utils.AssertTrue(t, receipt.Version == global.CONSENT_RECEIPT_VERSION, "Expected receipt version")
+	test_utils.AssertTrue(t, receipt.Jurisdiction == "US" && receipt.PolicyURL == "https://example.com/policy", "Expected fields of receipt template")
+	test_utils.AssertTrue(t, receipt.ConsentReceiptID == "t5" && receipt.ConsentTimestamp == consent.ConsentDate, "Expected receipt ID and timestamp")
+	test_utils.AssertTrue(t, receipt.PIIPrincipalID == owner.ID && receipt.PIIControllers[0].PIIController == target.ID, "Expected receipt principal and controller")
+	test_utils.AssertTrue(t, len(receipt.Services) == 1 && len(receipt.Services[0].Purposes) == 2, "Expected a receipt purpose for each purpose of use")
+	test_utils.AssertTrue(t, receipt.Services[0].Purposes[1].Purpose == global.PURPOSE_RESEARCH, "Expected receipt purpose")
+	test_utils.AssertTrue(t, receipt.ConsentID == consentID && receipt.Access == global.ACCESS_READ, "Expected receipt consent")
+
+	// anyone can verify the receipt, but not a modified receipt
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = VerifyConsentReceipt(stub, target, []string{string(signedReceiptBytes)})
+	test_utils.AssertTrue(t, err == nil, "VerifyConsentReceipt should be successful")
+	modifiedReceipt := signedReceipt
+	modifiedReceipt.Receipt.Access = global.ACCESS_WRITE
+	err = VerifyConsentReceiptWithParams(stub, target, modifiedReceipt)
+	test_utils.AssertTrue(t, err != nil, "Expected VerifyConsentReceipt of modified receipt to fail")
+	mstub.MockTransactionEnd("t6")
+
+	// target can read the consent, but doesn't have the owner's private key to sign a receipt
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = ExportConsentReceiptWithParams(stub, target, consentID, data_model.ConsentReceipt{})
+	test_utils.AssertTrue(t, err != nil, "Expected ExportConsentReceipt by target to fail")
+	mstub.MockTransactionEnd("t7")
+}
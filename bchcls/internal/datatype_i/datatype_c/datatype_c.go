@@ -13,15 +13,19 @@
 package datatype_c
 
 import (
+	"bytes"
 	"common/bchcls/cached_stub"
 	"common/bchcls/custom_errors"
 	"common/bchcls/data_model"
 	"common/bchcls/datatype/datatype_interface"
 	"common/bchcls/internal/common/global"
 	"common/bchcls/internal/common/graph"
+	"common/bchcls/internal/common/json_schema"
 	"common/bchcls/internal/metering_i"
+	"common/bchcls/simple_rule"
 	"common/bchcls/utils"
 	"encoding/json"
+	"strconv"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/pkg/errors"
@@ -37,11 +41,18 @@ const DATATYPE_CACHE_PREFIX = "datatypeCache_"
 
 // Datatype represents a type that can be used to classify assets.
 // Datatypes are stored in a tree structure. Datatypes can have sub-datatypes.
+// VersionSchemas maps each previous version of the datatype to the schema version of its asset data.
 type datatypeImpl struct {
-	DatatypeID  string `json:"datatype_id"`
-	Description string `json:"description"`
-	Active      bool   `json:"acive"`
-	deactivated bool
+	DatatypeID     string          `json:"datatype_id"`
+	Description    string          `json:"description"`
+	Active         bool            `json:"acive"`
+	Schema         json.RawMessage `json:"schema,omitempty"`
+	SchemaVersion  int             `json:"schema_version,omitempty"`
+	Version        int             `json:"version,omitempty"`
+	VersionSchemas map[int]int     `json:"version_schemas,omitempty"`
+	deactivated    bool
+	schemaChanged  bool
+	migrationRule  *simple_rule.Rule
 }
 
 // ------------------------------------------------------
@@ -72,6 +83,9 @@ func (datatype *datatypeImpl) GetDatatypeStruct() data_model.Datatype {
 	json.DatatypeID = datatype.DatatypeID
 	json.Description = datatype.Description
 	json.IsActive = datatype.Active
+	json.Schema = datatype.Schema
+	json.SchemaVersion = datatype.SchemaVersion
+	json.Version = datatype.GetVersion()
 	return json
 }
 
@@ -115,9 +129,256 @@ func (datatype *datatypeImpl) Deactivate() error {
 	return nil
 }
 
+// GetSchema returns the current schema
+func (datatype *datatypeImpl) GetSchema() []byte {
+	if len(datatype.Schema) == 0 {
+		return nil
+	}
+	return datatype.Schema
+}
+
+// GetSchemaVersion returns the version of the current schema
+func (datatype *datatypeImpl) GetSchemaVersion() int {
+	return datatype.SchemaVersion
+}
+
+// SetSchema sets the schema and increments the schema version if the schema is changed
+// The new schema version is saved during PutDatatype
+func (datatype *datatypeImpl) SetSchema(schema []byte) error {
+	if len(schema) > 0 {
+		err := json_schema.ValidateSchema(schema)
+		if err != nil {
+			logger.Errorf("Invalid schema for datatype %v: %v", datatype.DatatypeID, err)
+			return errors.Wrapf(err, "Invalid schema for datatype %v", datatype.DatatypeID)
+		}
+		compactSchema := bytes.Buffer{}
+		err = json.Compact(&compactSchema, schema)
+		if err != nil {
+			logger.Errorf("Invalid schema for datatype %v: %v", datatype.DatatypeID, err)
+			return errors.Wrapf(err, "Invalid schema for datatype %v", datatype.DatatypeID)
+		}
+		schema = compactSchema.Bytes()
+	}
+	if bytes.Equal(schema, datatype.GetSchema()) {
+		return nil
+	}
+	datatype.Schema = schema
+	datatype.SchemaVersion++
+	datatype.schemaChanged = true
+	return nil
+}
+
+// GetSchemaByVersion returns the schema of the given version
+func (datatype *datatypeImpl) GetSchemaByVersion(stub cached_stub.CachedStubInterface, version int) ([]byte, error) {
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	schemaLedgerKey, err := stub.CreateCompositeKey(global.DATATYPE_SCHEMA_PREFIX, []string{datatype.DatatypeID, strconv.Itoa(version)})
+	if err != nil {
+		custom_err := &custom_errors.CreateCompositeKeyError{Type: global.DATATYPE_SCHEMA_PREFIX}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	schema, err := stub.GetState(schemaLedgerKey)
+	if err != nil {
+		custom_err := &custom_errors.GetLedgerError{LedgerKey: schemaLedgerKey, LedgerItem: "Datatype schema"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	if len(schema) == 0 || string(schema) == "null" {
+		return nil, nil
+	}
+	return schema, nil
+}
+
+// ValidateAssetData validates asset data against the current schema
+func (datatype *datatypeImpl) ValidateAssetData(publicData []byte, privateData []byte) error {
+	return datatype.validateAssetData(datatype.Schema, datatype.SchemaVersion, publicData, privateData)
+}
+
+// GetSchemaVersionOf returns the version of the schema of the given datatype version
+// Versions added before the schema version was recorded use the current schema
+func (datatype *datatypeImpl) GetSchemaVersionOf(version int) int {
+	if schemaVersion, ok := datatype.VersionSchemas[version]; ok && version < datatype.GetVersion() {
+		return schemaVersion
+	}
+	return datatype.SchemaVersion
+}
+
+// ValidateAssetDataOfVersion validates asset data against the schema of the given datatype version
+func (datatype *datatypeImpl) ValidateAssetDataOfVersion(stub cached_stub.CachedStubInterface, version int, publicData []byte, privateData []byte) error {
+	schemaVersion := datatype.GetSchemaVersionOf(version)
+	if schemaVersion == datatype.SchemaVersion {
+		return datatype.ValidateAssetData(publicData, privateData)
+	}
+	schema, err := datatype.GetSchemaByVersion(stub, schemaVersion)
+	if err != nil {
+		logger.Errorf("Failed to get version %v of the schema of datatype %v: %v", schemaVersion, datatype.DatatypeID, err)
+		return errors.Wrapf(err, "Failed to get version %v of the schema of datatype %v", schemaVersion, datatype.DatatypeID)
+	}
+	return datatype.validateAssetData(schema, schemaVersion, publicData, privateData)
+}
+
+// validateAssetData validates asset data against the given schema
+func (datatype *datatypeImpl) validateAssetData(schema []byte, schemaVersion int, publicData []byte, privateData []byte) error {
+	if len(schema) == 0 {
+		return nil
+	}
+
+	// public and private data that is not JSON is validated as a string
+	assetData := make(map[string]interface{})
+	for name, data := range map[string][]byte{"public_data": publicData, "private_data": privateData} {
+		if len(data) == 0 {
+			continue
+		}
+		if json.Valid(data) {
+			assetData[name] = json.RawMessage(data)
+		} else {
+			assetData[name] = string(data)
+		}
+	}
+	assetDataBytes, err := json.Marshal(&assetData)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "asset data"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+
+	err = json_schema.Validate(schema, assetDataBytes)
+	if err != nil {
+		custom_err := &custom_errors.SchemaValidationError{Datatype: datatype.DatatypeID, SchemaVersion: schemaVersion, Reason: err.Error()}
+		logger.Errorf("%v", custom_err)
+		return errors.WithStack(custom_err)
+	}
+	return nil
+}
+
+// GetVersion returns the version of the datatype
+// Datatypes registered before versions were added are version 1
+func (datatype *datatypeImpl) GetVersion() int {
+	if datatype.Version < 1 {
+		return 1
+	}
+	return datatype.Version
+}
+
+// AddVersion increments the version of the datatype and keeps the current schema for the previous version
+// The migration rule is saved during PutDatatype
+func (datatype *datatypeImpl) AddVersion(migrationRule simple_rule.Rule) error {
+	if migrationRule.GetExpr() == nil {
+		logger.Errorf("Migration rule is required to add a version to datatype %v", datatype.DatatypeID)
+		return errors.Errorf("Migration rule is required to add a version to datatype %v", datatype.DatatypeID)
+	}
+	if datatype.migrationRule != nil {
+		logger.Errorf("Datatype %v must be saved before adding another version", datatype.DatatypeID)
+		return errors.Errorf("Datatype %v must be saved before adding another version", datatype.DatatypeID)
+	}
+	if datatype.VersionSchemas == nil {
+		datatype.VersionSchemas = make(map[int]int)
+	}
+	datatype.VersionSchemas[datatype.GetVersion()] = datatype.SchemaVersion
+	datatype.Version = datatype.GetVersion() + 1
+	datatype.migrationRule = &migrationRule
+	return nil
+}
+
+// GetMigrationRule returns the rule that transforms asset data from fromVersion to fromVersion+1
+func (datatype *datatypeImpl) GetMigrationRule(stub cached_stub.CachedStubInterface, fromVersion int) (*simple_rule.Rule, error) {
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	ruleLedgerKey, err := stub.CreateCompositeKey(global.DATATYPE_MIGRATION_PREFIX, []string{datatype.DatatypeID, strconv.Itoa(fromVersion)})
+	if err != nil {
+		custom_err := &custom_errors.CreateCompositeKeyError{Type: global.DATATYPE_MIGRATION_PREFIX}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	ruleBytes, err := stub.GetState(ruleLedgerKey)
+	if err != nil {
+		custom_err := &custom_errors.GetLedgerError{LedgerKey: ruleLedgerKey, LedgerItem: "Datatype migration rule"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	if ruleBytes == nil {
+		return nil, nil
+	}
+	savedRule := migrationRule{}
+	err = json.Unmarshal(ruleBytes, &savedRule)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "Datatype migration rule"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	rule := simple_rule.NewRule(savedRule.Expr, savedRule.Init)
+	return &rule, nil
+}
+
+// MigrateAssetData transforms asset data from fromVersion to toVersion
+func (datatype *datatypeImpl) MigrateAssetData(stub cached_stub.CachedStubInterface, fromVersion int, toVersion int, publicData []byte, privateData []byte) ([]byte, []byte, error) {
+	if fromVersion < 1 || toVersion <= fromVersion || toVersion > datatype.GetVersion() {
+		logger.Errorf("Invalid migration from version %v to version %v of datatype %v", fromVersion, toVersion, datatype.DatatypeID)
+		return nil, nil, errors.Errorf("Invalid migration from version %v to version %v of datatype %v", fromVersion, toVersion, datatype.DatatypeID)
+	}
+
+	// public and private data that is not JSON is passed to the rules as a string
+	assetData := make(map[string]interface{})
+	for name, data := range map[string][]byte{"public_data": publicData, "private_data": privateData} {
+		var value interface{} = nil
+		if len(data) > 0 && json.Unmarshal(data, &value) != nil {
+			value = string(data)
+		}
+		assetData[name] = value
+	}
+
+	for version := fromVersion; version < toVersion; version++ {
+		rule, err := datatype.GetMigrationRule(stub, version)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rule == nil {
+			logger.Errorf("Migration rule from version %v of datatype %v not found", version, datatype.DatatypeID)
+			return nil, nil, errors.Errorf("Migration rule from version %v of datatype %v not found", version, datatype.DatatypeID)
+		}
+		result, err := rule.Apply(assetData)
+		if err != nil {
+			logger.Errorf("Failed to apply migration rule from version %v of datatype %v: %v", version, datatype.DatatypeID, err)
+			return nil, nil, errors.Wrapf(err, "Failed to apply migration rule from version %v of datatype %v", version, datatype.DatatypeID)
+		}
+		newData, ok := result["$result"].(map[string]interface{})
+		if !ok {
+			logger.Errorf("Migration rule from version %v of datatype %v must evaluate to an object", version, datatype.DatatypeID)
+			return nil, nil, errors.Errorf("Migration rule from version %v of datatype %v must evaluate to an object", version, datatype.DatatypeID)
+		}
+		for _, name := range []string{"public_data", "private_data"} {
+			if value, ok := newData[name]; ok {
+				assetData[name] = value
+			}
+		}
+	}
+
+	migratedData := [][]byte{}
+	for _, name := range []string{"public_data", "private_data"} {
+		switch value := assetData[name].(type) {
+		case nil:
+			migratedData = append(migratedData, nil)
+		case string:
+			migratedData = append(migratedData, []byte(value))
+		default:
+			data, err := json.Marshal(value)
+			if err != nil {
+				custom_err := &custom_errors.MarshalError{Type: name}
+				logger.Errorf("%v: %v", custom_err, err)
+				return nil, nil, errors.Wrap(err, custom_err.Error())
+			}
+			migratedData = append(migratedData, data)
+		}
+	}
+	return migratedData[0], migratedData[1], nil
+}
+
 // [Deprecated and removed from DatatypeInterface] keeping here as a private function
 // removeDatatype removes datatype from the ledger, removes its relationships to other datatypes in the graph, and adds relationships between its children and its parents.
-// It will also update datatype symkey encryptions
+// Datatype symkeys are updated by datatype_i.DeleteDatatype, which calls this function through DeleteDatatype
 // Caller must have access to all datatype symkeys
 // This is a very slow operation, and it should only be used with caution
 // Also it's callers responsibility to remove any reference to this datatype
@@ -211,6 +472,114 @@ func (datatype *datatypeImpl) removeDatatype(stub cached_stub.CachedStubInterfac
 	return nil
 }
 
+// DeleteDatatype removes a datatype from the ledger and the datatype graph.
+// The children of the datatype become children of its parent.
+func DeleteDatatype(stub cached_stub.CachedStubInterface, caller data_model.User, datatypeID string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("DeleteDatatype ID:%v", datatypeID)
+
+	if datatypeID == ROOT_DATATYPE_ID {
+		logger.Errorf("ROOT datatype cannot be deleted")
+		return errors.New("ROOT datatype cannot be deleted")
+	}
+	datatype, err := GetDatatypeWithParams(stub, datatypeID)
+	if err != nil {
+		custom_err := &custom_errors.GetDatatypeError{Datatype: datatypeID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	if utils.IsStringEmpty(datatype.GetDatatypeID()) {
+		custom_err := &custom_errors.GetDatatypeError{Datatype: datatypeID}
+		logger.Errorf(custom_err.Error())
+		return errors.WithStack(custom_err)
+	}
+	return datatype.(*datatypeImpl).removeDatatype(stub, caller)
+}
+
+// MoveDatatype changes the parent of a datatype in the datatype graph and returns the ID of its previous parent.
+// The children of the datatype are moved with it.
+// If newParentDatatypeID is empty, the datatype is moved under ROOT.
+// Returns a CycleError if the new parent is the datatype itself or one of its children.
+func MoveDatatype(stub cached_stub.CachedStubInterface, datatypeID string, newParentDatatypeID string) (string, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("MoveDatatype ID:%v NewParentID:%v", datatypeID, newParentDatatypeID)
+
+	if datatypeID == ROOT_DATATYPE_ID {
+		logger.Errorf("ROOT datatype cannot be moved")
+		return "", errors.New("ROOT datatype cannot be moved")
+	}
+	if utils.IsStringEmpty(newParentDatatypeID) {
+		newParentDatatypeID = ROOT_DATATYPE_ID
+	}
+
+	datatype, err := GetDatatypeWithParams(stub, datatypeID)
+	if err != nil {
+		custom_err := &custom_errors.GetDatatypeError{Datatype: datatypeID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return "", errors.Wrap(err, custom_err.Error())
+	}
+	if utils.IsStringEmpty(datatype.GetDatatypeID()) {
+		custom_err := &custom_errors.GetDatatypeError{Datatype: datatypeID}
+		logger.Errorf(custom_err.Error())
+		return "", errors.WithStack(custom_err)
+	}
+	newParent, err := GetDatatypeWithParams(stub, newParentDatatypeID)
+	if err != nil {
+		custom_err := &custom_errors.GetDatatypeError{Datatype: newParentDatatypeID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return "", errors.Wrap(err, custom_err.Error())
+	}
+	if utils.IsStringEmpty(newParent.GetDatatypeID()) {
+		custom_err := &custom_errors.GetDatatypeError{Datatype: newParentDatatypeID}
+		logger.Errorf(custom_err.Error())
+		return "", errors.WithStack(custom_err)
+	}
+
+	// the new parent can't be the datatype or one of its children
+	isParent, err := datatype.IsParentOf(stub, newParentDatatypeID)
+	if err != nil {
+		logger.Errorf("Failed to check relationship between datatypes %v and %v: %v", datatypeID, newParentDatatypeID, err)
+		return "", errors.Wrapf(err, "Failed to check relationship between datatypes %v and %v", datatypeID, newParentDatatypeID)
+	}
+	if datatypeID == newParentDatatypeID || isParent {
+		custom_err := &custom_errors.CycleError{Parent: newParentDatatypeID, Child: datatypeID}
+		logger.Errorf(custom_err.Error())
+		return "", errors.WithStack(custom_err)
+	}
+
+	//if parent datatype is inactive, you can't move an active datatype under it
+	if !newParent.IsActive() && datatype.IsActive() {
+		logger.Error("You cannot move active datatype under an inactive parent datatype")
+		return "", errors.New("You cannot move active datatype under an inactive parent datatype")
+	}
+
+	oldParentDatatypeID, err := GetParentDatatype(stub, datatypeID)
+	if err != nil {
+		custom_err := &custom_errors.GetDirectParentsError{Child: datatypeID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return "", errors.Wrap(err, custom_err.Error())
+	}
+	if oldParentDatatypeID == newParentDatatypeID {
+		return oldParentDatatypeID, nil
+	}
+
+	if len(oldParentDatatypeID) > 0 {
+		err = graph.DeleteEdge(stub, global.DATATYPE_GRAPH, oldParentDatatypeID, datatypeID)
+		if err != nil {
+			custom_err := &custom_errors.RemoveRelationshipError{Parent: oldParentDatatypeID, Child: datatypeID}
+			logger.Errorf("%v: %v", custom_err, err)
+			return "", errors.Wrap(err, custom_err.Error())
+		}
+	}
+	err = graph.PutEdge(stub, global.DATATYPE_GRAPH, newParentDatatypeID, datatypeID)
+	if err != nil {
+		custom_err := &custom_errors.AddRelationshipError{Parent: newParentDatatypeID, Child: datatypeID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return "", errors.Wrap(err, custom_err.Error())
+	}
+	return oldParentDatatypeID, nil
+}
+
 // PutDatatype saves updated datatype to the ledger
 func (datatype *datatypeImpl) PutDatatype(stub cached_stub.CachedStubInterface) error {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
@@ -239,6 +608,24 @@ func (datatype *datatypeImpl) PutDatatype(stub cached_stub.CachedStubInterface)
 		return errors.Wrap(err, custom_err.Error())
 	}
 
+	// save migration rule to the new version
+	if datatype.migrationRule != nil {
+		err = putMigrationRule(stub, datatype.DatatypeID, datatype.Version-1, *datatype.migrationRule)
+		if err != nil {
+			return err
+		}
+		datatype.migrationRule = nil
+	}
+
+	// save new schema version
+	if datatype.schemaChanged {
+		err = putSchemaVersion(stub, datatype.DatatypeID, datatype.SchemaVersion, datatype.Schema)
+		if err != nil {
+			return err
+		}
+		datatype.schemaChanged = false
+	}
+
 	// deactivate child datatypes
 	if !datatype.IsActive() && datatype.deactivated {
 		childDatatypes, err := datatype.GetChildDatatypes(stub)
@@ -402,12 +789,27 @@ func RegisterDatatype(stub cached_stub.CachedStubInterface, caller data_model.Us
 		return nil, errors.New("Failed to RegisterDatatype because this id already exists")
 	}
 
-	_, err = RegisterDatatypeWithParams(stub, datatype.DatatypeID, datatype.Description, datatype.IsActive, parentDatatypeID)
+	newDatatype, err := RegisterDatatypeWithParams(stub, datatype.DatatypeID, datatype.Description, datatype.IsActive, parentDatatypeID)
 	if err != nil {
 		logger.Errorf("Failed to RegisterDatatypeWithParams: %v", err)
 		return nil, errors.Wrap(err, "Failed to RegisterDatatypeWithParams")
 	}
 
+	// set schema
+	if len(datatype.Schema) > 0 {
+		err = newDatatype.SetSchema(datatype.Schema)
+		if err != nil {
+			logger.Errorf("Failed to set schema: %v", err)
+			return nil, errors.Wrap(err, "Failed to set schema")
+		}
+		err = newDatatype.PutDatatype(stub)
+		if err != nil {
+			custom_err := &custom_errors.PutDatatypeError{Datatype: datatype.DatatypeID}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, errors.Wrap(err, custom_err.Error())
+		}
+	}
+
 	return nil, nil
 }
 
@@ -469,6 +871,7 @@ func RegisterDatatypeWithParams(stub cached_stub.CachedStubInterface, datatypeID
 	datatypeInternal.DatatypeID = datatypeID
 	datatypeInternal.Active = isActive
 	datatypeInternal.Description = description
+	datatypeInternal.Version = 1
 	datatypeInternal.deactivated = false
 
 	datatypeBytes, err := json.Marshal(&datatypeInternal)
@@ -502,7 +905,8 @@ func GetDatatypeKeyID(datatypeID string, ownerID string) string {
 	return global.KEY_TYPE_SYM + "-" + ownerID + "-" + datatypeID
 }
 
-// UpdateDatatype updates existing datatype's description.
+// UpdateDatatype updates existing datatype's description and schema.
+// The schema is only updated if the datatype passed in has a schema.
 // Caller's role must be "system".
 //
 // args = [ datatype ]
@@ -550,17 +954,144 @@ func UpdateDatatype(stub cached_stub.CachedStubInterface, caller data_model.User
 		return nil, errors.WithStack(custom_err)
 	}
 
+	// update schema if changed
+	schemaVersion := existingDatatype.GetSchemaVersion()
+	if len(datatype.Schema) > 0 {
+		err = existingDatatype.SetSchema(datatype.Schema)
+		if err != nil {
+			logger.Errorf("Failed to set schema: %v", err)
+			return nil, errors.Wrap(err, "Failed to set schema")
+		}
+	}
+
 	// update description if changed
-	if existingDatatype.GetDescription() != datatype.Description {
+	if existingDatatype.GetDescription() != datatype.Description || existingDatatype.GetSchemaVersion() != schemaVersion {
 		existingDatatype.SetDescription(datatype.Description)
 
 		// save updated datatype to ledger
-		existingDatatype.PutDatatype(stub)
+		err = existingDatatype.PutDatatype(stub)
+		if err != nil {
+			custom_err := &custom_errors.PutDatatypeError{Datatype: datatype.DatatypeID}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, errors.Wrap(err, custom_err.Error())
+		}
 	}
 
 	return nil, nil
 }
 
+// migrationRule is how a migration rule is saved on the ledger.
+type migrationRule struct {
+	Expr interface{}            `json:"expr"`
+	Init map[string]interface{} `json:"init,omitempty"`
+}
+
+// putMigrationRule saves the rule that transforms asset data from fromVersion to fromVersion+1 to the ledger.
+func putMigrationRule(stub cached_stub.CachedStubInterface, datatypeID string, fromVersion int, rule simple_rule.Rule) error {
+	ruleLedgerKey, err := stub.CreateCompositeKey(global.DATATYPE_MIGRATION_PREFIX, []string{datatypeID, strconv.Itoa(fromVersion)})
+	if err != nil {
+		custom_err := &custom_errors.CreateCompositeKeyError{Type: global.DATATYPE_MIGRATION_PREFIX}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	ruleBytes, err := json.Marshal(&migrationRule{Expr: rule.GetExpr(), Init: rule.GetInit()})
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "Datatype migration rule"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	err = stub.PutState(ruleLedgerKey, ruleBytes)
+	if err != nil {
+		custom_err := &custom_errors.PutLedgerError{LedgerKey: ruleLedgerKey}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	return nil
+}
+
+// putSchemaVersion saves a version of a datatype schema to the ledger.
+func putSchemaVersion(stub cached_stub.CachedStubInterface, datatypeID string, version int, schema []byte) error {
+	schemaLedgerKey, err := stub.CreateCompositeKey(global.DATATYPE_SCHEMA_PREFIX, []string{datatypeID, strconv.Itoa(version)})
+	if err != nil {
+		custom_err := &custom_errors.CreateCompositeKeyError{Type: global.DATATYPE_SCHEMA_PREFIX}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	// a removed schema is saved as an empty JSON value
+	if len(schema) == 0 {
+		schema = []byte("null")
+	}
+	err = stub.PutState(schemaLedgerKey, schema)
+	if err != nil {
+		custom_err := &custom_errors.PutLedgerError{LedgerKey: schemaLedgerKey}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	return nil
+}
+
+// AddDatatypeVersion increments the version of an existing datatype and saves the migration rule that transforms
+// asset data from the previous version to the new version. The rule is a simple_rule expression in JSON.
+// Caller's role must be "system".
+//
+// args = [ datatypeID, migrationRule ]
+func AddDatatypeVersion(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("AddDatatypeVersion args: %v", args)
+
+	// parse args
+	if len(args) != 2 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "AddDatatypeVersion args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	// check caller
+	if caller.Role != global.ROLE_SYSTEM_ADMIN {
+		logger.Errorf("Caller does not have permission to AddDatatypeVersion")
+		return nil, errors.New("Caller does not have permission to AddDatatypeVersion")
+	}
+
+	datatypeID := args[0]
+	if utils.IsStringEmpty(datatypeID) {
+		custom_err := &custom_errors.LengthCheckingError{Type: "datatypeID"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+	var ruleExpr interface{}
+	err := json.Unmarshal([]byte(args[1]), &ruleExpr)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "migrationRule"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	datatype, err := GetDatatypeWithParams(stub, datatypeID)
+	if err != nil {
+		custom_err := &custom_errors.GetDatatypeError{Datatype: datatypeID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	if utils.IsStringEmpty(datatype.GetDatatypeID()) {
+		custom_err := &custom_errors.GetDatatypeError{Datatype: datatypeID}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	err = datatype.AddVersion(simple_rule.NewRule(ruleExpr))
+	if err != nil {
+		logger.Errorf("Failed to add version: %v", err)
+		return nil, errors.Wrap(err, "Failed to add version")
+	}
+	err = datatype.PutDatatype(stub)
+	if err != nil {
+		custom_err := &custom_errors.PutDatatypeError{Datatype: datatypeID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	return nil, nil
+}
+
 // GetDatatype returns a datatype with the given datatypeID.
 // Returns an empty datatype if the datatypeID passed in does not exist.
 //
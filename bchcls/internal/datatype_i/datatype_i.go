@@ -15,14 +15,20 @@ package datatype_i
 import (
 	"common/bchcls/cached_stub"
 	"common/bchcls/crypto"
+	"common/bchcls/custom_errors"
 	"common/bchcls/data_model"
 	"common/bchcls/datatype/datatype_interface"
+	"common/bchcls/index"
 	"common/bchcls/internal/common/global"
+	"common/bchcls/internal/common/graph"
 	"common/bchcls/internal/datatype_i/datatype_c"
 	"common/bchcls/internal/key_mgmt_i/key_mgmt_c"
 	"common/bchcls/internal/user_mgmt_i/user_mgmt_c"
 	"common/bchcls/utils"
 
+	"encoding/json"
+	"strings"
+
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/pkg/errors"
 )
@@ -50,6 +56,8 @@ func Init(stub cached_stub.CachedStubInterface, logLevel ...shim.LoggingLevel) (
 // Creates datatypeSymKey and maintains key relationship with parent datatypes.
 // If parentDatatypeID is not provided or does not exist, the datatype will be added as a child of ROOT.
 //
+// The datatype can have a JSON Schema in its Schema field, which assets of the datatype must conform to.
+//
 // args = [ datatype, parentDatatypeID ]
 func RegisterDatatype(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
@@ -79,7 +87,8 @@ func GetDatatypeKeyID_OLD(datatypeID string) string {
 }
 */
 
-// UpdateDatatype updates existing datatype's description.
+// UpdateDatatype updates existing datatype's description and schema.
+// The schema is only updated if the datatype passed in has a schema.
 // Caller's role must be "system".
 //
 // args = [ datatype ]
@@ -88,6 +97,355 @@ func UpdateDatatype(stub cached_stub.CachedStubInterface, caller data_model.User
 	return datatype_c.UpdateDatatype(stub, caller, args)
 }
 
+// AddDatatypeVersion increments the version of an existing datatype and saves the migration rule that transforms
+// asset data from the previous version to the new version. The rule is a simple_rule expression in JSON.
+// Caller's role must be "system".
+//
+// args = [ datatypeID, migrationRule ]
+func AddDatatypeVersion(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	return datatype_c.AddDatatypeVersion(stub, caller, args)
+}
+
+// MoveDatatype moves a datatype, along with its children, under a new parent datatype.
+// If newParentDatatypeID is empty, the datatype is moved under ROOT.
+// Returns a CycleError if the new parent is the datatype itself or one of its children.
+// The datatype sym keys of all owners are re-linked, so that they can be accessed from the sym keys of the new parent
+// and no longer from the sym keys of the old parent. Consents on the new parent's ancestry now cover the moved datatype.
+// The datatype can't be moved while consents of any owner exist on an ancestor that is not an ancestor of the new
+// parent, since those consents would no longer cover it. Consents on the moved datatype and its children are not changed.
+// Owners of sym keys added before the datatype key owner index existed are only found after
+// RebuildDatatypeKeyOwnerIndex is called.
+// Caller must have access to the sym keys of all owners of the datatype's sym keys.
+// Caller's role must be "system".
+//
+// args = [ datatypeID, newParentDatatypeID ]
+func MoveDatatype(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("MoveDatatype args: %v", args)
+
+	// parse args
+	if len(args) != 2 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "MoveDatatype args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	// check caller
+	if caller.Role != global.ROLE_SYSTEM_ADMIN {
+		logger.Errorf("Caller does not have permission to MoveDatatype")
+		return nil, errors.New("Caller does not have permission to MoveDatatype")
+	}
+
+	datatypeID := args[0]
+	newParentDatatypeID := args[1]
+	if utils.IsStringEmpty(newParentDatatypeID) {
+		newParentDatatypeID = ROOT_DATATYPE_ID
+	}
+
+	ownerIDs, err := getDatatypeKeyOwnerIDs(stub, datatypeID)
+	if err != nil {
+		logger.Errorf("Failed to get owners of datatype sym keys: %v", err)
+		return nil, errors.Wrap(err, "Failed to get owners of datatype sym keys")
+	}
+
+	// consents on ancestors that the datatype leaves must not exist
+	oldAncestorIDs, err := GetParentDatatypes(stub, datatypeID)
+	if err != nil {
+		custom_err := &custom_errors.GetDirectParentsError{Child: datatypeID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	newAncestorIDs := []string{}
+	if newParentDatatypeID != ROOT_DATATYPE_ID {
+		newParentAncestorIDs, err := GetParentDatatypes(stub, newParentDatatypeID)
+		if err != nil {
+			custom_err := &custom_errors.GetDirectParentsError{Child: newParentDatatypeID}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, errors.Wrap(err, custom_err.Error())
+		}
+		// the list returned by GetParentDatatypes may be cached, so it is not appended to
+		newAncestorIDs = append([]string{newParentDatatypeID}, newParentAncestorIDs...)
+	}
+	for _, ancestorID := range oldAncestorIDs {
+		if utils.InList(newAncestorIDs, ancestorID) {
+			continue
+		}
+		for _, ownerID := range ownerIDs {
+			hasConsents, err := hasDatatypeKeyConsents(stub, GetDatatypeKeyID(ancestorID, ownerID))
+			if err != nil {
+				logger.Errorf("Failed to check consents of datatype %v: %v", ancestorID, err)
+				return nil, errors.Wrapf(err, "Failed to check consents of datatype %v", ancestorID)
+			}
+			if hasConsents {
+				logger.Errorf("Datatype %v is covered by consents of owner %v on datatype %v", datatypeID, ownerID, ancestorID)
+				return nil, errors.Errorf("Datatype %v is covered by consents of owner %v on datatype %v", datatypeID, ownerID, ancestorID)
+			}
+		}
+	}
+
+	oldParentDatatypeID, err := datatype_c.MoveDatatype(stub, datatypeID, newParentDatatypeID)
+	if err != nil {
+		logger.Errorf("Failed to move datatype: %v", err)
+		return nil, errors.Wrap(err, "Failed to move datatype")
+	}
+	if oldParentDatatypeID == newParentDatatypeID {
+		return nil, nil
+	}
+
+	// re-link datatype sym keys
+	for _, ownerID := range ownerIDs {
+		datatypeKey, err := GetDatatypeSymKey(stub, caller, datatypeID, ownerID)
+		if err != nil || len(datatypeKey.KeyBytes) == 0 {
+			logger.Errorf("Failed to get datatype sym key of owner %v: %v", ownerID, err)
+			return nil, errors.Errorf("Failed to get datatype sym key of owner %v", ownerID)
+		}
+
+		// parent datatype sym keys are not added for ROOT
+		if len(oldParentDatatypeID) > 0 && oldParentDatatypeID != ROOT_DATATYPE_ID {
+			err = key_mgmt_c.RevokeAccess(stub, GetDatatypeKeyID(oldParentDatatypeID, ownerID), datatypeKey.ID)
+			if err != nil {
+				logger.Errorf("Failed to revoke access from old parent key to the datatype key: %v", err)
+				return nil, errors.Wrap(err, "Failed to revoke access from old parent key to the datatype key")
+			}
+		}
+		if newParentDatatypeID != ROOT_DATATYPE_ID {
+			parentDatatypeKey, err := AddDatatypeSymKey(stub, caller, newParentDatatypeID, ownerID)
+			if err != nil {
+				logger.Errorf("Failed to add datatype key for parent: %v", err)
+				return nil, errors.Wrap(err, "Failed to add datatype key for parent")
+			}
+			err = key_mgmt_c.AddAccessWithKeys(stub, parentDatatypeKey.KeyBytes, parentDatatypeKey.ID, datatypeKey.KeyBytes, datatypeKey.ID, nil)
+			if err != nil {
+				logger.Errorf("Failed to add access from parent key to the datatype key: %v", err)
+				return nil, errors.Wrap(err, "Failed to add access from parent key to the datatype key")
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// DeleteDatatype removes a datatype from the ledger. The children of the datatype become children of its parent.
+// The datatype can't be deleted while its sym key of any owner gives access to assets or consents.
+// The sym keys of the datatype's children are re-linked to the sym keys of its parent, and the datatype's sym keys
+// can no longer be accessed from the sym keys of its parent.
+// Owners of sym keys added before the datatype key owner index existed are only found after
+// RebuildDatatypeKeyOwnerIndex is called.
+// Caller must have access to the sym keys of all owners of the datatype's sym keys.
+// Caller's role must be "system".
+//
+// args = [ datatypeID ]
+func DeleteDatatype(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("DeleteDatatype args: %v", args)
+
+	// parse args
+	if len(args) != 1 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "DeleteDatatype args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	// check caller
+	if caller.Role != global.ROLE_SYSTEM_ADMIN {
+		logger.Errorf("Caller does not have permission to DeleteDatatype")
+		return nil, errors.New("Caller does not have permission to DeleteDatatype")
+	}
+
+	datatypeID := args[0]
+	parentDatatypeID, err := GetParentDatatype(stub, datatypeID)
+	if err != nil {
+		custom_err := &custom_errors.GetDirectParentsError{Child: datatypeID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	ownerIDs, err := getDatatypeKeyOwnerIDs(stub, datatypeID)
+	if err != nil {
+		logger.Errorf("Failed to get owners of datatype sym keys: %v", err)
+		return nil, errors.Wrap(err, "Failed to get owners of datatype sym keys")
+	}
+
+	// the datatype sym keys must not be used by assets or consents
+	for _, ownerID := range ownerIDs {
+		datatypeKeyID := GetDatatypeKeyID(datatypeID, ownerID)
+		childKeyIDs, err := graph.GetDirectChildren(stub, global.KEY_GRAPH_PREFIX, datatypeKeyID)
+		if err != nil {
+			logger.Errorf("Failed to get keys accessible from the datatype key: %v", err)
+			return nil, errors.Wrap(err, "Failed to get keys accessible from the datatype key")
+		}
+		for _, childKeyID := range childKeyIDs {
+			_, edgeData, err := key_mgmt_c.GetAccessEdge(stub, datatypeKeyID, childKeyID)
+			if err != nil {
+				logger.Errorf("Failed to get access edge: %v", err)
+				return nil, errors.Wrap(err, "Failed to get access edge")
+			}
+			if edgeData["edge"] == "DatatypeEdge" {
+				logger.Errorf("Datatype %v is used by assets of owner %v", datatypeID, ownerID)
+				return nil, errors.Errorf("Datatype %v is used by assets of owner %v", datatypeID, ownerID)
+			}
+		}
+		hasConsents, err := hasDatatypeKeyConsents(stub, datatypeKeyID)
+		if err != nil {
+			logger.Errorf("Failed to check consents of datatype %v: %v", datatypeID, err)
+			return nil, errors.Wrapf(err, "Failed to check consents of datatype %v", datatypeID)
+		}
+		if hasConsents {
+			logger.Errorf("Datatype %v is used by consents of owner %v", datatypeID, ownerID)
+			return nil, errors.Errorf("Datatype %v is used by consents of owner %v", datatypeID, ownerID)
+		}
+	}
+
+	// re-link the sym keys of the children to the sym keys of the parent
+	for _, ownerID := range ownerIDs {
+		datatypeKey, err := GetDatatypeSymKey(stub, caller, datatypeID, ownerID)
+		if err != nil || len(datatypeKey.KeyBytes) == 0 {
+			logger.Errorf("Failed to get datatype sym key of owner %v: %v", ownerID, err)
+			return nil, errors.Errorf("Failed to get datatype sym key of owner %v", ownerID)
+		}
+		parentDatatypeKey := data_model.Key{}
+		if len(parentDatatypeID) > 0 && parentDatatypeID != ROOT_DATATYPE_ID {
+			parentDatatypeKey, err = AddDatatypeSymKey(stub, caller, parentDatatypeID, ownerID)
+			if err != nil {
+				logger.Errorf("Failed to add datatype key for parent: %v", err)
+				return nil, errors.Wrap(err, "Failed to add datatype key for parent")
+			}
+			err = key_mgmt_c.RevokeAccess(stub, parentDatatypeKey.ID, datatypeKey.ID)
+			if err != nil {
+				logger.Errorf("Failed to revoke access from parent key to the datatype key: %v", err)
+				return nil, errors.Wrap(err, "Failed to revoke access from parent key to the datatype key")
+			}
+		}
+
+		childKeyIDs, err := graph.GetDirectChildren(stub, global.KEY_GRAPH_PREFIX, datatypeKey.ID)
+		if err != nil {
+			logger.Errorf("Failed to get keys accessible from the datatype key: %v", err)
+			return nil, errors.Wrap(err, "Failed to get keys accessible from the datatype key")
+		}
+		for _, childKeyID := range childKeyIDs {
+			if !parentDatatypeKey.IsEmpty() {
+				childKeyBytes, err := key_mgmt_c.GetKey(stub, []string{datatypeKey.ID, childKeyID}, datatypeKey.KeyBytes)
+				if err != nil {
+					logger.Errorf("Failed to get child datatype key: %v", err)
+					return nil, errors.Wrap(err, "Failed to get child datatype key")
+				}
+				err = key_mgmt_c.AddAccessWithKeys(stub, parentDatatypeKey.KeyBytes, parentDatatypeKey.ID, childKeyBytes, childKeyID, nil)
+				if err != nil {
+					logger.Errorf("Failed to add access from parent key to the child datatype key: %v", err)
+					return nil, errors.Wrap(err, "Failed to add access from parent key to the child datatype key")
+				}
+			}
+			err = key_mgmt_c.RevokeAccess(stub, datatypeKey.ID, childKeyID)
+			if err != nil {
+				logger.Errorf("Failed to revoke access from the datatype key to the child datatype key: %v", err)
+				return nil, errors.Wrap(err, "Failed to revoke access from the datatype key to the child datatype key")
+			}
+		}
+
+		err = graph.DeleteEdge(stub, global.DATATYPE_KEY_OWNER_GRAPH, datatypeID, ownerID)
+		if err != nil {
+			logger.Errorf("Failed to delete datatype key owner edge: %v", err)
+			return nil, errors.Wrap(err, "Failed to delete datatype key owner edge")
+		}
+	}
+
+	err = datatype_c.DeleteDatatype(stub, caller, datatypeID)
+	if err != nil {
+		logger.Errorf("Failed to delete datatype: %v", err)
+		return nil, errors.Wrap(err, "Failed to delete datatype")
+	}
+	return nil, nil
+}
+
+// RebuildDatatypeKeyOwnerIndex adds the owners of existing datatype sym keys to the datatype key owner index.
+// It pages through the users and orgs in the user index, and indexes each datatype sym key that can be accessed
+// from the user's sym key in the key graph. No keys are decrypted.
+// Caller's role must be "system".
+// Returns the IDs of the owners that were indexed and the key to pass as previousKey to continue, which is empty
+// if all users have been checked. If limit is -1, all users are checked.
+func RebuildDatatypeKeyOwnerIndex(stub cached_stub.CachedStubInterface, caller data_model.User, previousKey string, limit int) ([]string, string, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("previousKey: \"%v\", limit: %v", previousKey, limit)
+
+	if caller.Role != global.ROLE_SYSTEM_ADMIN {
+		custom_err := &custom_errors.RoleAccessPrivilegeError{Role: caller.Role}
+		logger.Errorf("RebuildDatatypeKeyOwnerIndex: %v", custom_err)
+		return nil, "", errors.WithStack(custom_err)
+	}
+
+	// page through the user index
+	userTable := index.GetTable(stub, global.INDEX_USER)
+	startKey, err := userTable.CreateRangeKey([]string{"is_group", "role", "id"}, []string{})
+	if err != nil {
+		logger.Errorf("Failed to create startKey: %v", err)
+		return nil, "", errors.Wrap(err, "Failed to create startKey")
+	}
+	endKey := startKey + string(rune(global.MAX_UNICODE_RUNE_VALUE))
+	if len(previousKey) > 0 {
+		startKey = previousKey + string(rune(global.MIN_UNICODE_RUNE_VALUE))
+	}
+	iter, err := userTable.GetRowsByRange(startKey, endKey)
+	if err != nil {
+		custom_err := &custom_errors.GetLedgerError{LedgerKey: startKey, LedgerItem: global.INDEX_USER}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, "", errors.Wrap(err, custom_err.Error())
+	}
+	defer iter.Close()
+
+	indexedOwnerIDs := []string{}
+	lastKey := ""
+	for count := 0; iter.HasNext() && (limit < 0 || count < limit); count++ {
+		kv, err := iter.Next()
+		if err != nil {
+			custom_err := &custom_errors.IterError{}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, "", errors.Wrap(err, custom_err.Error())
+		}
+		lastKey = kv.GetKey()
+
+		row := make(map[string]string)
+		err = json.Unmarshal(kv.GetValue(), &row)
+		if err != nil {
+			custom_err := &custom_errors.UnmarshalError{Type: "Index Row"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return nil, "", errors.Wrap(err, custom_err.Error())
+		}
+		ownerID := row["id"]
+
+		// datatype sym keys are accessed from the owner's sym key, and their IDs start with the owner's ID
+		childKeyIDs, err := graph.GetDirectChildren(stub, global.KEY_GRAPH_PREFIX, key_mgmt_c.GetSymKeyId(ownerID))
+		if err != nil {
+			logger.Errorf("Failed to get keys accessible from the sym key of %v: %v", ownerID, err)
+			return nil, "", errors.Wrapf(err, "Failed to get keys accessible from the sym key of %v", ownerID)
+		}
+		datatypeKeyIDPrefix := GetDatatypeKeyID("", ownerID)
+		indexed := false
+		for _, childKeyID := range childKeyIDs {
+			if !strings.HasPrefix(childKeyID, datatypeKeyIDPrefix) {
+				continue
+			}
+			datatypeID := strings.TrimPrefix(childKeyID, datatypeKeyIDPrefix)
+			datatype, err := GetDatatypeWithParams(stub, datatypeID)
+			if err != nil || utils.IsStringEmpty(datatype.GetDatatypeID()) {
+				continue
+			}
+			err = putDatatypeKeyOwner(stub, datatypeID, ownerID)
+			if err != nil {
+				return nil, "", err
+			}
+			indexed = true
+		}
+		if indexed {
+			indexedOwnerIDs = append(indexedOwnerIDs, ownerID)
+		}
+	}
+
+	if !iter.HasNext() {
+		lastKey = ""
+	}
+	return indexedOwnerIDs, lastKey, nil
+}
+
 // GetDatatype returns a datatype with the given datatypeID.
 // Returns an empty datatype if the passed in datatypeID does not match an existing datatype's ID.
 //
@@ -111,6 +469,7 @@ func GetAllDatatypes(stub cached_stub.CachedStubInterface, caller data_model.Use
 // AddDatatypeSymKey adds a sym key for the given datatypeID and ownerID and returns the DatatypeSymKey.
 // It will also make sure that all its parent datatypes will get new sym key for the given owner (if it does not exist already).
 // If the datatype sym key already exists, it will return success.
+// The owner is recorded in the datatype key owner index, which is used by MoveDatatype and DeleteDatatype.
 func AddDatatypeSymKey(stub cached_stub.CachedStubInterface, caller data_model.User, datatypeID, ownerID string, keyPathForOwnerSymkey ...[]string) (data_model.Key, error) {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 	logger.Debugf("AddDatatypeSymKey DatatypeID: %v Owner: %v", datatypeID, ownerID)
@@ -128,6 +487,11 @@ func AddDatatypeSymKey(stub cached_stub.CachedStubInterface, caller data_model.U
 	// check if datatype sym key already exists, just return existing key
 	if key_mgmt_c.KeyExists(stub, datatypeSymkeyID) {
 		logger.Debugf("Datatype symkey already exist: %v", datatypeSymkeyID)
+		// sym keys added before the owner index existed are indexed here
+		err = putDatatypeKeyOwner(stub, datatypeID, ownerID)
+		if err != nil {
+			return data_model.Key{}, err
+		}
 		var keyPath []string = nil
 		if len(keyPathForOwnerSymkey) > 0 && keyPathForOwnerSymkey[0] != nil {
 			keyPath = append(keyPathForOwnerSymkey[0], datatypeSymkeyID)
@@ -155,6 +519,10 @@ func AddDatatypeSymKey(stub cached_stub.CachedStubInterface, caller data_model.U
 		logger.Errorf("Failed to add datatype key: %v", err)
 		return data_model.Key{}, err
 	}
+	err = putDatatypeKeyOwner(stub, datatypeID, ownerID)
+	if err != nil {
+		return data_model.Key{}, err
+	}
 
 	// if parent exists, call AddDatatypeSymKey() function for the parent datatype
 	parents, err := datatype.GetParentDatatypes(stub)
@@ -293,6 +661,52 @@ func NormalizeDatatypes(stub cached_stub.CachedStubInterface, datatypeIDs []stri
 	return datatype_c.NormalizeDatatypes(stub, datatypeIDs)
 }
 
+// getDatatypeKeyOwnerIDs returns the IDs of the owners that have a sym key for the datatype.
+// The owners are read from the datatype key owner index, which is filled in for existing sym keys by
+// RebuildDatatypeKeyOwnerIndex.
+func getDatatypeKeyOwnerIDs(stub cached_stub.CachedStubInterface, datatypeID string) ([]string, error) {
+	ownerIDs, err := graph.GetDirectChildren(stub, global.DATATYPE_KEY_OWNER_GRAPH, datatypeID)
+	if err != nil {
+		custom_err := &custom_errors.GetLedgerError{LedgerKey: global.DATATYPE_KEY_OWNER_GRAPH, LedgerItem: "datatype key owners"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	return ownerIDs, nil
+}
+
+// putDatatypeKeyOwner adds the owner of a datatype sym key to the datatype key owner index.
+func putDatatypeKeyOwner(stub cached_stub.CachedStubInterface, datatypeID string, ownerID string) error {
+	exists, err := graph.HasEdge(stub, global.DATATYPE_KEY_OWNER_GRAPH, datatypeID, ownerID)
+	if err != nil {
+		logger.Errorf("Failed to get datatype key owner edge: %v", err)
+		return errors.Wrap(err, "Failed to get datatype key owner edge")
+	}
+	if exists {
+		return nil
+	}
+	err = graph.PutEdge(stub, global.DATATYPE_KEY_OWNER_GRAPH, datatypeID, ownerID)
+	if err != nil {
+		logger.Errorf("Failed to put datatype key owner edge: %v", err)
+		return errors.Wrap(err, "Failed to put datatype key owner edge")
+	}
+	return nil
+}
+
+// hasDatatypeKeyConsents returns true if consents give access to the datatype sym key.
+func hasDatatypeKeyConsents(stub cached_stub.CachedStubInterface, datatypeKeyID string) (bool, error) {
+	parentKeyIDs, err := graph.GetDirectParents(stub, global.KEY_GRAPH_PREFIX, datatypeKeyID)
+	if err != nil {
+		logger.Errorf("Failed to get keys with access to the datatype key: %v", err)
+		return false, errors.Wrap(err, "Failed to get keys with access to the datatype key")
+	}
+	for _, parentKeyID := range parentKeyIDs {
+		if strings.HasPrefix(parentKeyID, global.CONSENT_PREFIX+"-") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // getDatatypeCacheKey returns a datatype cache key with given parameters
 func getDatatypeCacheKey(callerID string, datatypeID string, ownerID string) string {
 	return datatype_c.DATATYPE_CACHE_PREFIX + callerID + datatypeID + ownerID
@@ -11,13 +11,19 @@ package test
 
 import (
 	"common/bchcls/cached_stub"
+	"common/bchcls/custom_errors"
+	"common/bchcls/data_model"
+	"common/bchcls/internal/common/global"
+	"common/bchcls/internal/common/graph"
 	"common/bchcls/internal/datastore_i"
 	"common/bchcls/internal/datatype_i"
 	"common/bchcls/internal/key_mgmt_i"
 	"common/bchcls/internal/user_mgmt_i"
 	"common/bchcls/test_utils"
+	"common/bchcls/utils"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
 
 	"testing"
 )
@@ -281,3 +287,473 @@ func TestDatatypeInterface(t *testing.T) {
 	test_utils.AssertTrue(t, datatype2.GetDescription() == "New description", "should have changed the description")
 
 }
+
+// Tests datatype schema funcs
+func TestDatatypeSchema(t *testing.T) {
+	logger.Info("TestDatatypeSchema function called")
+	mstub := setup(t)
+
+	caller := test_utils.CreateTestUser("callerID")
+	schemaV1 := `{"type": "object", "properties": {"private_data": {"type": "object", "required": ["age"]}}}`
+	schemaV2 := `{"type": "object", "properties": {"private_data": {"type": "object", "required": ["age", "name"]}}}`
+
+	// register a datatype with a schema
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	_, err := datatype_i.RegisterDatatype(stub, caller, []string{`{"datatype_id": "patient", "description": "patient", "is_acive": true, "schema": ` + schemaV1 + `}`})
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should not have returned an error")
+	_, err = datatype_i.RegisterDatatype(stub, caller, []string{`{"datatype_id": "bad", "description": "bad", "is_acive": true, "schema": {"type": "text"}}`})
+	test_utils.AssertTrue(t, err != nil, "RegisterDatatype with an invalid schema should have returned an error")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	datatype1, err := datatype_i.GetDatatypeWithParams(stub, "patient")
+	test_utils.AssertTrue(t, err == nil, "GetDatatypeWithParams should have succeeded")
+	test_utils.AssertTrue(t, datatype1.GetSchemaVersion() == 1, "schema version should be 1")
+	test_utils.AssertTrue(t, len(datatype1.GetSchema()) > 0, "datatype should have a schema")
+	err = datatype1.ValidateAssetData([]byte("public"), []byte(`{"age": 30}`))
+	test_utils.AssertTrue(t, err == nil, "ValidateAssetData should have succeeded")
+	err = datatype1.ValidateAssetData(nil, []byte(`{"name": "Ann"}`))
+	test_utils.AssertTrue(t, err != nil, "ValidateAssetData should have failed")
+
+	// update the schema; the previous version is kept
+	_, err = datatype_i.UpdateDatatype(stub, caller, []string{`{"datatype_id": "patient", "description": "patient", "schema": ` + schemaV2 + `}`})
+	test_utils.AssertTrue(t, err == nil, "UpdateDatatype should have succeeded")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	datatype1, err = datatype_i.GetDatatypeWithParams(stub, "patient")
+	test_utils.AssertTrue(t, err == nil, "GetDatatypeWithParams should have succeeded")
+	test_utils.AssertTrue(t, datatype1.GetSchemaVersion() == 2, "schema version should be 2")
+	err = datatype1.ValidateAssetData(nil, []byte(`{"age": 30}`))
+	test_utils.AssertTrue(t, err != nil, "ValidateAssetData should have failed with the new schema")
+	schema, err := datatype1.GetSchemaByVersion(stub, 1)
+	test_utils.AssertTrue(t, err == nil, "GetSchemaByVersion should have succeeded")
+	test_utils.AssertTrue(t, string(schema) == `{"type":"object","properties":{"private_data":{"type":"object","required":["age"]}}}`, "should have returned schema version 1")
+
+	// setting the same schema does not change the version
+	err = datatype1.SetSchema([]byte(schemaV2))
+	test_utils.AssertTrue(t, err == nil, "SetSchema should have succeeded")
+	test_utils.AssertTrue(t, datatype1.GetSchemaVersion() == 2, "schema version should still be 2")
+	mstub.MockTransactionEnd("t3")
+
+	// version 1 of the datatype keeps schema version 2 after version 2 is added with schema version 3
+	systemAdmin := test_utils.CreateTestUser("systemAdmin")
+	systemAdmin.Role = global.ROLE_SYSTEM_ADMIN
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeVersion(stub, systemAdmin, []string{"patient", `{"var": ""}`})
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeVersion should have succeeded")
+	mstub.MockTransactionEnd("t4")
+
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.UpdateDatatype(stub, caller, []string{`{"datatype_id": "patient", "description": "patient", "schema": ` + schemaV1 + `}`})
+	test_utils.AssertTrue(t, err == nil, "UpdateDatatype should have succeeded")
+	mstub.MockTransactionEnd("t5")
+
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	datatype1, err = datatype_i.GetDatatypeWithParams(stub, "patient")
+	test_utils.AssertTrue(t, err == nil, "GetDatatypeWithParams should have succeeded")
+	test_utils.AssertTrue(t, datatype1.GetSchemaVersionOf(1) == 2, "version 1 should have schema version 2")
+	test_utils.AssertTrue(t, datatype1.GetSchemaVersionOf(2) == 3, "version 2 should have schema version 3")
+	err = datatype1.ValidateAssetDataOfVersion(stub, 1, nil, []byte(`{"age": 30}`))
+	test_utils.AssertTrue(t, err != nil, "ValidateAssetDataOfVersion should have failed with schema version 2")
+	validationErr, ok := errors.Cause(err).(*custom_errors.SchemaValidationError)
+	test_utils.AssertTrue(t, ok && validationErr.SchemaVersion == 2, "should have returned a SchemaValidationError for schema version 2")
+	err = datatype1.ValidateAssetDataOfVersion(stub, 2, nil, []byte(`{"age": 30}`))
+	test_utils.AssertTrue(t, err == nil, "ValidateAssetDataOfVersion should have succeeded with schema version 3")
+	mstub.MockTransactionEnd("t6")
+}
+
+func TestDatatypeVersion(t *testing.T) {
+	logger.Info("TestDatatypeVersion function called")
+	mstub := setup(t)
+
+	caller := test_utils.CreateTestUser("callerID")
+	systemAdmin := test_utils.CreateTestUser("systemAdmin")
+	systemAdmin.Role = global.ROLE_SYSTEM_ADMIN
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	_, err := datatype_i.RegisterDatatype(stub, caller, []string{`{"datatype_id": "patient", "description": "patient", "is_acive": true}`})
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatype should not have returned an error")
+	mstub.MockTransactionEnd("t1")
+
+	// version 2 splits name into first and last name
+	ruleV2 := `{"dict": [{"merge": ["private_data", {"dict": [
+		{"merge": ["first", {"var": "private_data.name.0"}]},
+		{"merge": ["last", {"var": "private_data.name.1"}]},
+		{"merge": ["age", {"var": "private_data.age"}]}]}]}]}`
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	datatype1, err := datatype_i.GetDatatypeWithParams(stub, "patient")
+	test_utils.AssertTrue(t, err == nil, "GetDatatypeWithParams should have succeeded")
+	test_utils.AssertTrue(t, datatype1.GetVersion() == 1, "datatype version should be 1")
+	_, err = datatype_i.AddDatatypeVersion(stub, caller, []string{"patient", ruleV2})
+	test_utils.AssertTrue(t, err != nil, "AddDatatypeVersion by a caller that is not a system admin should have returned an error")
+	_, err = datatype_i.AddDatatypeVersion(stub, systemAdmin, []string{"patient", `{"var": `})
+	test_utils.AssertTrue(t, err != nil, "AddDatatypeVersion with an invalid rule should have returned an error")
+	_, err = datatype_i.AddDatatypeVersion(stub, systemAdmin, []string{"patient", ruleV2})
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeVersion should have succeeded")
+	mstub.MockTransactionEnd("t2")
+
+	// version 3 adds a public label
+	ruleV3 := `{"dict": [{"merge": ["public_data", {"cat": ["patient ", {"var": "private_data.last"}]}]}]}`
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeVersion(stub, systemAdmin, []string{"patient", ruleV3})
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeVersion should have succeeded")
+	mstub.MockTransactionEnd("t3")
+
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	datatype1, err = datatype_i.GetDatatypeWithParams(stub, "patient")
+	test_utils.AssertTrue(t, err == nil, "GetDatatypeWithParams should have succeeded")
+	test_utils.AssertTrue(t, datatype1.GetVersion() == 3, "datatype version should be 3")
+	rule, err := datatype1.GetMigrationRule(stub, 1)
+	test_utils.AssertTrue(t, err == nil && rule != nil, "GetMigrationRule should have returned the rule from version 1")
+	rule, err = datatype1.GetMigrationRule(stub, 3)
+	test_utils.AssertTrue(t, err == nil && rule == nil, "GetMigrationRule should not have returned a rule from version 3")
+
+	publicData, privateData, err := datatype1.MigrateAssetData(stub, 1, 2, []byte("public"), []byte(`{"name": ["Ann", "Lee"], "age": 30}`))
+	test_utils.AssertTrue(t, err == nil, "MigrateAssetData should have succeeded")
+	test_utils.AssertTrue(t, string(publicData) == "public", "public data should not have changed")
+	test_utils.AssertTrue(t, string(privateData) == `{"age":30,"first":"Ann","last":"Lee"}`, "unexpected private data: "+string(privateData))
+
+	publicData, privateData, err = datatype1.MigrateAssetData(stub, 1, 3, []byte("public"), []byte(`{"name": ["Ann", "Lee"], "age": 30}`))
+	test_utils.AssertTrue(t, err == nil, "MigrateAssetData should have succeeded")
+	test_utils.AssertTrue(t, string(publicData) == "patient Lee", "unexpected public data: "+string(publicData))
+	test_utils.AssertTrue(t, string(privateData) == `{"age":30,"first":"Ann","last":"Lee"}`, "unexpected private data: "+string(privateData))
+
+	_, _, err = datatype1.MigrateAssetData(stub, 2, 4, nil, nil)
+	test_utils.AssertTrue(t, err != nil, "MigrateAssetData past the current version should have failed")
+	mstub.MockTransactionEnd("t4")
+}
+
+func TestMoveDatatype(t *testing.T) {
+	logger.Info("TestMoveDatatype function called")
+	mstub := setup(t)
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub, true, true)
+	_, err := datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype2", "", true, "datatype1")
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype3", "", true, "datatype2")
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype4", "", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	mstub.MockTransactionEnd("t1")
+
+	owner := test_utils.CreateTestUser("ownerID")
+	systemAdmin := test_utils.CreateTestUser("systemAdmin")
+	systemAdmin.Role = global.ROLE_SYSTEM_ADMIN
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = user_mgmt_i.RegisterUserWithParams(stub, owner, owner, false)
+	test_utils.AssertTrue(t, err == nil, "Register owner user should not have returned an error")
+	err = user_mgmt_i.RegisterUserWithParams(stub, systemAdmin, systemAdmin, false)
+	test_utils.AssertTrue(t, err == nil, "Register system admin should not have returned an error")
+	mstub.MockTransactionEnd("t2")
+
+	// adds keys for datatype3 and its parents
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = key_mgmt_i.AddAccess(stub, systemAdmin.GetPrivateKey(), owner.GetSymKey())
+	test_utils.AssertTrue(t, err == nil, "AddAccess should not have returned an error")
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "datatype3", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should not have returned an error")
+	mstub.MockTransactionEnd("t3")
+
+	// cycles are not allowed
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.MoveDatatype(stub, owner, []string{"datatype2", "datatype4"})
+	test_utils.AssertTrue(t, err != nil, "MoveDatatype by a caller that is not a system admin should have returned an error")
+	_, err = datatype_i.MoveDatatype(stub, systemAdmin, []string{"datatype1", "datatype3"})
+	_, ok := errors.Cause(err).(*custom_errors.CycleError)
+	test_utils.AssertTrue(t, ok, "MoveDatatype under a child should have returned a CycleError")
+	_, err = datatype_i.MoveDatatype(stub, systemAdmin, []string{"datatype2", "datatype2"})
+	_, ok = errors.Cause(err).(*custom_errors.CycleError)
+	test_utils.AssertTrue(t, ok, "MoveDatatype under itself should have returned a CycleError")
+	_, err = datatype_i.MoveDatatype(stub, systemAdmin, []string{datatype_i.ROOT_DATATYPE_ID, "datatype4"})
+	test_utils.AssertTrue(t, err != nil, "MoveDatatype of ROOT should have returned an error")
+	mstub.MockTransactionEnd("t4")
+
+	// move datatype2 and datatype3 under datatype4
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.MoveDatatype(stub, systemAdmin, []string{"datatype2", "datatype4"})
+	test_utils.AssertTrue(t, err == nil, "MoveDatatype should not have returned an error")
+	mstub.MockTransactionEnd("t5")
+
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	parentID, err := datatype_i.GetParentDatatype(stub, "datatype2")
+	test_utils.AssertTrue(t, err == nil && parentID == "datatype4", "parent of datatype2 should be datatype4")
+	parentIDs, err := datatype_i.GetParentDatatypes(stub, "datatype3")
+	test_utils.AssertTrue(t, err == nil && utils.EqualStringArrays(parentIDs, []string{"datatype2", "datatype4"}), "parents of datatype3 should be datatype2 and datatype4")
+	ok, err = key_mgmt_i.VerifyAccessPath(stub, []string{datatype_i.GetDatatypeKeyID("datatype4", owner.ID), datatype_i.GetDatatypeKeyID("datatype2", owner.ID), datatype_i.GetDatatypeKeyID("datatype3", owner.ID)})
+	test_utils.AssertTrue(t, err == nil && ok, "datatype4 key should give access to datatype2 and datatype3 keys")
+	ok, err = key_mgmt_i.VerifyAccessPath(stub, []string{datatype_i.GetDatatypeKeyID("datatype1", owner.ID), datatype_i.GetDatatypeKeyID("datatype2", owner.ID)})
+	test_utils.AssertTrue(t, err == nil && !ok, "datatype1 key should not give access to datatype2 key")
+	mstub.MockTransactionEnd("t6")
+
+	// move datatype2 under ROOT
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.MoveDatatype(stub, systemAdmin, []string{"datatype2", ""})
+	test_utils.AssertTrue(t, err == nil, "MoveDatatype should not have returned an error")
+	mstub.MockTransactionEnd("t7")
+
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	parentID, err = datatype_i.GetParentDatatype(stub, "datatype2")
+	test_utils.AssertTrue(t, err == nil && parentID == datatype_i.ROOT_DATATYPE_ID, "parent of datatype2 should be ROOT")
+	ok, err = key_mgmt_i.VerifyAccessPath(stub, []string{datatype_i.GetDatatypeKeyID("datatype4", owner.ID), datatype_i.GetDatatypeKeyID("datatype2", owner.ID)})
+	test_utils.AssertTrue(t, err == nil && !ok, "datatype4 key should not give access to datatype2 key")
+	ok, err = key_mgmt_i.VerifyAccessPath(stub, []string{owner.GetSymKeyId(), datatype_i.GetDatatypeKeyID("datatype2", owner.ID)})
+	test_utils.AssertTrue(t, err == nil && ok, "owner should have access to datatype2 key")
+	mstub.MockTransactionEnd("t8")
+}
+
+func TestDeleteDatatype(t *testing.T) {
+	logger.Info("TestDeleteDatatype function called")
+	mstub := setup(t)
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub, true, true)
+	_, err := datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype2", "", true, "datatype1")
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype3", "", true, "datatype2")
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	mstub.MockTransactionEnd("t1")
+
+	owner := test_utils.CreateTestUser("ownerID")
+	systemAdmin := test_utils.CreateTestUser("systemAdmin")
+	systemAdmin.Role = global.ROLE_SYSTEM_ADMIN
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = user_mgmt_i.RegisterUserWithParams(stub, owner, owner, false)
+	test_utils.AssertTrue(t, err == nil, "Register owner user should not have returned an error")
+	err = user_mgmt_i.RegisterUserWithParams(stub, systemAdmin, systemAdmin, false)
+	test_utils.AssertTrue(t, err == nil, "Register system admin should not have returned an error")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = key_mgmt_i.AddAccess(stub, systemAdmin.GetPrivateKey(), owner.GetSymKey())
+	test_utils.AssertTrue(t, err == nil, "AddAccess should not have returned an error")
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "datatype3", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should not have returned an error")
+	mstub.MockTransactionEnd("t3")
+
+	// a datatype whose key gives access to an asset key can't be deleted
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	datatypeKey, err := datatype_i.GetDatatypeSymKey(stub, owner, "datatype1", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "GetDatatypeSymKey should not have returned an error")
+	assetKey := data_model.Key{ID: "assetKey1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	err = key_mgmt_i.AddAccess(stub, datatypeKey, assetKey, map[string]string{"edge": "DatatypeEdge", "datatype": "datatype1"})
+	test_utils.AssertTrue(t, err == nil, "AddAccess should not have returned an error")
+	mstub.MockTransactionEnd("t4")
+
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.DeleteDatatype(stub, owner, []string{"datatype2"})
+	test_utils.AssertTrue(t, err != nil, "DeleteDatatype by a caller that is not a system admin should have returned an error")
+	_, err = datatype_i.DeleteDatatype(stub, systemAdmin, []string{"datatype1"})
+	test_utils.AssertTrue(t, err != nil, "DeleteDatatype of a datatype used by an asset should have returned an error")
+	_, err = datatype_i.DeleteDatatype(stub, systemAdmin, []string{datatype_i.ROOT_DATATYPE_ID})
+	test_utils.AssertTrue(t, err != nil, "DeleteDatatype of ROOT should have returned an error")
+	mstub.MockTransactionEnd("t5")
+
+	// delete datatype2; datatype3 becomes a child of datatype1
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.DeleteDatatype(stub, systemAdmin, []string{"datatype2"})
+	test_utils.AssertTrue(t, err == nil, "DeleteDatatype should not have returned an error")
+	mstub.MockTransactionEnd("t6")
+
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	datatype2, err := datatype_i.GetDatatypeWithParams(stub, "datatype2")
+	test_utils.AssertTrue(t, err == nil && len(datatype2.GetDatatypeID()) == 0, "datatype2 should have been deleted")
+	parentID, err := datatype_i.GetParentDatatype(stub, "datatype3")
+	test_utils.AssertTrue(t, err == nil && parentID == "datatype1", "parent of datatype3 should be datatype1")
+	ok, err := key_mgmt_i.VerifyAccessPath(stub, []string{datatype_i.GetDatatypeKeyID("datatype1", owner.ID), datatype_i.GetDatatypeKeyID("datatype3", owner.ID)})
+	test_utils.AssertTrue(t, err == nil && ok, "datatype1 key should give access to datatype3 key")
+	ok, err = key_mgmt_i.VerifyAccessPath(stub, []string{datatype_i.GetDatatypeKeyID("datatype1", owner.ID), datatype_i.GetDatatypeKeyID("datatype2", owner.ID)})
+	test_utils.AssertTrue(t, err == nil && !ok, "datatype1 key should not give access to datatype2 key")
+	mstub.MockTransactionEnd("t7")
+}
+
+func TestMoveDatatype_Consents(t *testing.T) {
+	logger.Info("TestMoveDatatype_Consents function called")
+	mstub := setup(t)
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub, true, true)
+	_, err := datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype2", "", true, "datatype1")
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype3", "", true, "datatype2")
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype4", "", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	mstub.MockTransactionEnd("t1")
+
+	owner1 := test_utils.CreateTestUser("owner1")
+	owner2 := test_utils.CreateTestUser("owner2")
+	systemAdmin := test_utils.CreateTestUser("systemAdmin")
+	systemAdmin.Role = global.ROLE_SYSTEM_ADMIN
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = user_mgmt_i.RegisterUserWithParams(stub, owner1, owner1, false)
+	test_utils.AssertTrue(t, err == nil, "Register owner1 user should not have returned an error")
+	err = user_mgmt_i.RegisterUserWithParams(stub, owner2, owner2, false)
+	test_utils.AssertTrue(t, err == nil, "Register owner2 user should not have returned an error")
+	err = user_mgmt_i.RegisterUserWithParams(stub, systemAdmin, systemAdmin, false)
+	test_utils.AssertTrue(t, err == nil, "Register system admin should not have returned an error")
+	mstub.MockTransactionEnd("t2")
+
+	// the system admin has access to the sym keys of both owners
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = key_mgmt_i.AddAccess(stub, systemAdmin.GetPrivateKey(), owner1.GetSymKey())
+	test_utils.AssertTrue(t, err == nil, "AddAccess should not have returned an error")
+	err = key_mgmt_i.AddAccess(stub, systemAdmin.GetPrivateKey(), owner2.GetSymKey())
+	test_utils.AssertTrue(t, err == nil, "AddAccess should not have returned an error")
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner1, "datatype3", owner1.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should not have returned an error")
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner2, "datatype3", owner2.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should not have returned an error")
+	mstub.MockTransactionEnd("t3")
+
+	// owner2 consents to datatype1
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	datatypeKey, err := datatype_i.GetDatatypeSymKey(stub, owner2, "datatype1", owner2.ID)
+	test_utils.AssertTrue(t, err == nil, "GetDatatypeSymKey should not have returned an error")
+	consentKey := data_model.Key{ID: global.CONSENT_PREFIX + "-consent1", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	err = key_mgmt_i.AddAccess(stub, consentKey, datatypeKey, map[string]string{global.EDGEDATA_ACCESS_TYPE: global.ACCESS_READ})
+	test_utils.AssertTrue(t, err == nil, "AddAccess should not have returned an error")
+	mstub.MockTransactionEnd("t4")
+
+	// datatype2 can't leave datatype1 while the consent exists
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.MoveDatatype(stub, systemAdmin, []string{"datatype2", "datatype4"})
+	test_utils.AssertTrue(t, err != nil, "MoveDatatype out of a consented datatype should have returned an error")
+	_, err = datatype_i.MoveDatatype(stub, systemAdmin, []string{"datatype3", ""})
+	test_utils.AssertTrue(t, err != nil, "MoveDatatype out of a consented datatype should have returned an error")
+	mstub.MockTransactionEnd("t5")
+
+	// datatype3 stays under datatype1
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.MoveDatatype(stub, systemAdmin, []string{"datatype3", "datatype1"})
+	test_utils.AssertTrue(t, err == nil, "MoveDatatype should not have returned an error")
+	mstub.MockTransactionEnd("t6")
+
+	// the keys of both owners are re-linked
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	for _, ownerID := range []string{owner1.ID, owner2.ID} {
+		ok, err := key_mgmt_i.VerifyAccessPath(stub, []string{datatype_i.GetDatatypeKeyID("datatype1", ownerID), datatype_i.GetDatatypeKeyID("datatype3", ownerID)})
+		test_utils.AssertTrue(t, err == nil && ok, "datatype1 key should give access to datatype3 key")
+		ok, err = key_mgmt_i.VerifyAccessPath(stub, []string{datatype_i.GetDatatypeKeyID("datatype2", ownerID), datatype_i.GetDatatypeKeyID("datatype3", ownerID)})
+		test_utils.AssertTrue(t, err == nil && !ok, "datatype2 key should not give access to datatype3 key")
+	}
+	mstub.MockTransactionEnd("t7")
+}
+
+func TestRebuildDatatypeKeyOwnerIndex(t *testing.T) {
+	logger.Info("TestRebuildDatatypeKeyOwnerIndex function called")
+	mstub := setup(t)
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub, true, true)
+	_, err := datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype2", "", true, "datatype1")
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype3", "", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	mstub.MockTransactionEnd("t1")
+
+	owner := test_utils.CreateTestUser("ownerID")
+	systemAdmin := test_utils.CreateTestUser("systemAdmin")
+	systemAdmin.Role = global.ROLE_SYSTEM_ADMIN
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = user_mgmt_i.RegisterUserWithParams(stub, owner, owner, false)
+	test_utils.AssertTrue(t, err == nil, "Register owner user should not have returned an error")
+	err = user_mgmt_i.RegisterUserWithParams(stub, systemAdmin, systemAdmin, false)
+	test_utils.AssertTrue(t, err == nil, "Register system admin should not have returned an error")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = key_mgmt_i.AddAccess(stub, systemAdmin.GetPrivateKey(), owner.GetSymKey())
+	test_utils.AssertTrue(t, err == nil, "AddAccess should not have returned an error")
+	_, err = datatype_i.AddDatatypeSymKey(stub, owner, "datatype2", owner.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should not have returned an error")
+	mstub.MockTransactionEnd("t3")
+
+	// remove the owner index edges, as for sym keys added before the index existed
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	for _, datatypeID := range []string{"datatype1", "datatype2"} {
+		err = graph.DeleteEdge(stub, global.DATATYPE_KEY_OWNER_GRAPH, datatypeID, owner.ID)
+		test_utils.AssertTrue(t, err == nil, "DeleteEdge should not have returned an error")
+	}
+	mstub.MockTransactionEnd("t4")
+
+	// rebuild the index one user at a time
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, _, err = datatype_i.RebuildDatatypeKeyOwnerIndex(stub, owner, "", -1)
+	test_utils.AssertTrue(t, err != nil, "RebuildDatatypeKeyOwnerIndex by a caller that is not a system admin should have returned an error")
+	indexedOwnerIDs := []string{}
+	previousKey := ""
+	for page := 0; page == 0 || len(previousKey) > 0; page++ {
+		var ownerIDs []string
+		ownerIDs, previousKey, err = datatype_i.RebuildDatatypeKeyOwnerIndex(stub, systemAdmin, previousKey, 1)
+		test_utils.AssertTrue(t, err == nil, "RebuildDatatypeKeyOwnerIndex should not have returned an error")
+		indexedOwnerIDs = append(indexedOwnerIDs, ownerIDs...)
+		test_utils.AssertTrue(t, page < 3, "RebuildDatatypeKeyOwnerIndex should have finished in 3 pages")
+	}
+	test_utils.AssertTrue(t, utils.EqualStringArrays(indexedOwnerIDs, []string{owner.ID}), "owner should have been indexed")
+	mstub.MockTransactionEnd("t5")
+
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	for _, datatypeID := range []string{"datatype1", "datatype2"} {
+		ok, err := graph.HasEdge(stub, global.DATATYPE_KEY_OWNER_GRAPH, datatypeID, owner.ID)
+		test_utils.AssertTrue(t, err == nil && ok, "owner of "+datatypeID+" key should have been indexed")
+	}
+	ok, err := graph.HasEdge(stub, global.DATATYPE_KEY_OWNER_GRAPH, "datatype3", owner.ID)
+	test_utils.AssertTrue(t, err == nil && !ok, "owner should not have been indexed for datatype3")
+
+	// the sym keys of the indexed owner are re-linked when datatype2 is moved
+	_, err = datatype_i.MoveDatatype(stub, systemAdmin, []string{"datatype2", "datatype3"})
+	test_utils.AssertTrue(t, err == nil, "MoveDatatype should not have returned an error")
+	mstub.MockTransactionEnd("t6")
+
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	ok, err = key_mgmt_i.VerifyAccessPath(stub, []string{datatype_i.GetDatatypeKeyID("datatype3", owner.ID), datatype_i.GetDatatypeKeyID("datatype2", owner.ID)})
+	test_utils.AssertTrue(t, err == nil && ok, "datatype3 key should give access to datatype2 key")
+	ok, err = key_mgmt_i.VerifyAccessPath(stub, []string{datatype_i.GetDatatypeKeyID("datatype1", owner.ID), datatype_i.GetDatatypeKeyID("datatype2", owner.ID)})
+	test_utils.AssertTrue(t, err == nil && !ok, "datatype1 key should not give access to datatype2 key")
+	mstub.MockTransactionEnd("t7")
+}
@@ -0,0 +1,111 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+// common package contain structs and functions to be used across all
+// bchcls packages.
+//
+// In common package, only the following bchcls packages are allowed to be imported:
+// 	"common/bchcls/cached_stub"
+//	"common/bchcls/crypto"
+//	"common/bchcls/custom_errors"
+//	"common/bchcls/data_model"
+//	"common/bchcls/index"
+//	"common/bchcls/internal/common/global"
+//	"common/bchcls/internal/common/graph"
+//	"common/bchcls/internal/key_mgmt_i"
+//	"common/bchcls/internal/common/rb_tree"
+//
+package history_c
+
+import (
+	"common/bchcls/data_model"
+	"common/bchcls/internal/asset_mgmt_i/asset_mgmt_c"
+	"common/bchcls/internal/common/global"
+	"common/bchcls/utils"
+
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
+)
+
+var logger = shim.NewLogger("history_c")
+
+// GetTransactionLogAssetID generates an assetID for a transaction log.
+func GetTransactionLogAssetID(transactionID string) string {
+	return asset_mgmt_c.GetAssetId(global.TRANSACTION_LOG_ASSET_NAMESPACE, transactionID)
+}
+
+// ConvertToAsset converts a transactionLog to an assetData.
+func ConvertToAsset(transactionLog data_model.TransactionLog, logSymKeyId string) (*data_model.Asset, error) {
+	var err error
+	// convert all fields to strings using the proper method (if this method is not used, indexing will not work properly)
+	transactionLog.Field1, err = utils.ConvertToString(transactionLog.Field1)
+	if err != nil {
+		logger.Errorf("Failed to convert field 1 of transaction log to string: %v", err)
+		return nil, errors.Wrap(err, "Failed to convert field 1 of transaction log to string")
+	}
+	transactionLog.Field2, err = utils.ConvertToString(transactionLog.Field2)
+	if err != nil {
+		logger.Errorf("Failed to convert field 2 of transaction log to string: %v", err)
+		return nil, errors.Wrap(err, "Failed to convert field 2 of transaction log to string")
+	}
+	transactionLog.Field3, err = utils.ConvertToString(transactionLog.Field3)
+	if err != nil {
+		logger.Errorf("Failed to convert field 3 of transaction log to string: %v", err)
+		return nil, errors.Wrap(err, "Failed to convert field 3 of transaction log to string")
+	}
+	transactionLog.Field4, err = utils.ConvertToString(transactionLog.Field4)
+	if err != nil {
+		logger.Errorf("Failed to convert field 4 of transaction log to string: %v", err)
+		return nil, errors.Wrap(err, "Failed to convert field 4 of transaction log to string")
+	}
+	transactionLog.Field5, err = utils.ConvertToString(transactionLog.Field5)
+	if err != nil {
+		logger.Errorf("Failed to convert field 5 of transaction log to string: %v", err)
+		return nil, errors.Wrap(err, "Failed to convert field 5 of transaction log to string")
+	}
+	transactionLog.Field6, err = utils.ConvertToString(transactionLog.Field6)
+	if err != nil {
+		logger.Errorf("Failed to convert field 6 of transaction log to string: %v", err)
+		return nil, errors.Wrap(err, "Failed to convert field 6 of transaction log to string")
+	}
+	transactionLog.Field7, err = utils.ConvertToString(transactionLog.Field7)
+	if err != nil {
+		logger.Errorf("Failed to convert field 7 of transaction log to string: %v", err)
+		return nil, errors.Wrap(err, "Failed to convert field 7 of transaction log to string")
+	}
+	transactionLog.Field8, err = utils.ConvertToString(transactionLog.Field8)
+	if err != nil {
+		logger.Errorf("Failed to convert field 8 of transaction log to string: %v", err)
+		return nil, errors.Wrap(err, "Failed to convert field 8 of transaction log to string")
+	}
+
+	asset := data_model.Asset{}
+	asset.AssetId = GetTransactionLogAssetID(transactionLog.TransactionID)
+	asset.AssetKeyId = logSymKeyId
+	asset.Datatypes = []string{}
+	metaData := make(map[string]string)
+	metaData["namespace"] = global.TRANSACTION_LOG_ASSET_NAMESPACE
+	asset.Metadata = metaData
+	var publicData interface{}
+	asset.PublicData, _ = json.Marshal(&publicData)
+	asset.PrivateData, _ = json.Marshal(&transactionLog)
+	asset.IndexTableName = global.INDEX_HISTORY
+	// if an off-chain datastore is specified, save the id so that the log can be saved there
+	if len(transactionLog.ConnectionID) != 0 {
+		asset.SetDatastoreConnectionID(transactionLog.ConnectionID)
+	}
+	// if a signer is specified, the log asset is signed
+	if len(transactionLog.SignerID) != 0 {
+		asset.SetSignerID(transactionLog.SignerID)
+	}
+
+	return &asset, nil
+}
@@ -20,6 +20,7 @@ import (
 	"common/bchcls/index"
 	"common/bchcls/internal/asset_mgmt_i"
 	"common/bchcls/internal/common/global"
+	"common/bchcls/internal/history_i/history_c"
 	"common/bchcls/simple_rule"
 	"common/bchcls/utils"
 
@@ -80,17 +81,34 @@ func (historyManager historyManagerImpl) PutInvokeTransactionLog(transactionLog
 	return putTransactionLog(historyManager.GetAssetManager(), transactionLog, encryptionKey)
 }
 
+// PutInvokeTransactionLogWithSubID stores a log for one of several changes made by the current invoke transaction,
+// encrypted with the provided encryptionKey.
+// The log's TransactionID is set to the ID of the current transaction followed by "-" and subID, so that
+// a transaction can store a log for each change. Use that ID to get the log with GetTransactionLog.
+// If a log was already stored for subID in the current transaction, it is replaced.
+func PutInvokeTransactionLogWithSubID(assetManager asset_manager.AssetManager, transactionLog data_model.TransactionLog, subID string, encryptionKey data_model.Key) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	if utils.IsStringEmpty(subID) {
+		custom_err := &custom_errors.LengthCheckingError{Type: "subID"}
+		logger.Errorf(custom_err.Error())
+		return errors.WithStack(custom_err)
+	}
+
+	transactionLog.TransactionID = assetManager.GetStub().GetTxID() + "-" + subID
+	return putTransactionLog(assetManager, transactionLog, encryptionKey, true)
+}
+
 // GetTransactionLog documentation can be found in the interface definition of HistoryManager.
 func (historyManager historyManagerImpl) GetTransactionLog(transactionID string, logKey data_model.Key) (*data_model.TransactionLog, error) {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
-	asset, err := historyManager.GetAssetManager().GetAsset(getTransactionLogAssetID(transactionID), logKey)
+	asset, err := historyManager.GetAssetManager().GetAsset(history_c.GetTransactionLogAssetID(transactionID), logKey)
 	if err != nil {
-		custom_err := &custom_errors.GetAssetDataError{AssetId: getTransactionLogAssetID(transactionID)}
+		custom_err := &custom_errors.GetAssetDataError{AssetId: history_c.GetTransactionLogAssetID(transactionID)}
 		logger.Errorf("%v: %v", custom_err, err)
 		return nil, errors.Wrap(err, custom_err.Error())
 	}
 	if utils.IsStringEmpty(asset.AssetId) {
-		custom_err := &custom_errors.GetAssetDataError{AssetId: getTransactionLogAssetID(transactionID)}
+		custom_err := &custom_errors.GetAssetDataError{AssetId: history_c.GetTransactionLogAssetID(transactionID)}
 		logger.Errorf(custom_err.Error())
 		return nil, errors.WithStack(custom_err)
 	}
@@ -100,6 +118,12 @@ func (historyManager historyManagerImpl) GetTransactionLog(transactionID string,
 	return &transactionLog, nil
 }
 
+// VerifyTransactionLogSignature documentation can be found in the interface definition of HistoryManager.
+func (historyManager historyManagerImpl) VerifyTransactionLogSignature(transactionID string, logKey data_model.Key) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	return historyManager.GetAssetManager().VerifyAssetSignature(history_c.GetTransactionLogAssetID(transactionID), logKey)
+}
+
 // GetTransactionLogs documentation can be found in the interface definition of HistoryManager.
 func (historyManager historyManagerImpl) GetTransactionLogs(namespace, indexField, indexFieldValue string, startTimestamp, endTimestamp int64, previousKey string, limit int, filterRule *simple_rule.Rule, logSymKeyPath interface{}) ([]data_model.TransactionLog, string, error) {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
@@ -209,7 +233,13 @@ func PutQueryTransactionLog(stub cached_stub.CachedStubInterface, caller data_mo
 		logger.Errorf("%v: %v", errMsg, err)
 		return errors.Wrap(err, errMsg)
 	}
-	symKeyBytes, err := crypto.DecryptWithPrivateKey(caller.PrivateKey, []byte(encSymKeyString))
+	callerPrivateKey, err := crypto.ParseAnyPrivateKey(caller.GetPrivateKey().KeyBytes)
+	if err != nil {
+		custom_err := &custom_errors.ParseKeyError{Type: "caller's private key"}
+		logger.Errorf("%v: %v", custom_err.Error(), err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	symKeyBytes, err := crypto.DecryptWithAnyPrivateKey(callerPrivateKey, []byte(encSymKeyString))
 	if err != nil {
 		custom_err := &custom_errors.DecryptionError{ToDecrypt: "randomized sym key", DecryptionKey: "caller's private key"}
 		logger.Errorf("%v: %v", custom_err.Error(), err)
@@ -315,7 +345,13 @@ func GenerateExportableTransactionLog(stub cached_stub.CachedStubInterface, call
 	exportableTransactionLog.EncryptedLogEncryptionKey = encEncryptionKeyString
 
 	// encrypt sym key
-	encSymKeyBytes, err := crypto.EncryptWithPublicKey(caller.PublicKey, symKeyBytes)
+	callerPublicKey, err := crypto.ParseAnyPublicKey(caller.GetPublicKey().KeyBytes)
+	if err != nil {
+		custom_err := &custom_errors.ParseKeyError{Type: "caller's public key"}
+		logger.Errorf("%v: %v", custom_err.Error(), err)
+		return exportableTransactionLog, errors.Wrap(err, custom_err.Error())
+	}
+	encSymKeyBytes, err := crypto.EncryptWithAnyPublicKey(callerPublicKey, symKeyBytes)
 	if err != nil {
 		custom_err := &custom_errors.EncryptionError{ToEncrypt: "randomized sym kye", EncryptionKey: "caller's public key"}
 		logger.Errorf("%v: %v", custom_err.Error(), err)
@@ -328,7 +364,9 @@ func GenerateExportableTransactionLog(stub cached_stub.CachedStubInterface, call
 }
 
 // putTransactionLog stores a log to the ledger encrypted with the provided encryptionKey.
-func putTransactionLog(assetManager asset_manager.AssetManager, transactionLog data_model.TransactionLog, encryptionKey data_model.Key) error {
+// replaceExisting is an optional bool flag (default = false). If it's set to true, an existing log with the
+// same TransactionID is replaced. Otherwise an error is returned if the log already exists.
+func putTransactionLog(assetManager asset_manager.AssetManager, transactionLog data_model.TransactionLog, encryptionKey data_model.Key, replaceExisting ...bool) error {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 	//check transaction log for required fields
 	if utils.IsStringEmpty(transactionLog.TransactionID) {
@@ -358,13 +396,17 @@ func putTransactionLog(assetManager asset_manager.AssetManager, transactionLog d
 	}
 
 	//add asset
-	transactionLogAsset, err := convertToAsset(transactionLog, encryptionKey.ID)
+	transactionLogAsset, err := history_c.ConvertToAsset(transactionLog, encryptionKey.ID)
 	if err != nil {
 		errMsg := "Failed to convert transaction log to asset"
 		logger.Errorf("%v: %v", errMsg, err)
 		return errors.Wrap(err, errMsg)
 	}
-	err = assetManager.AddAsset(*transactionLogAsset, encryptionKey, false)
+	if len(replaceExisting) > 0 && replaceExisting[0] {
+		err = assetManager.UpdateAsset(*transactionLogAsset, encryptionKey, false)
+	} else {
+		err = assetManager.AddAsset(*transactionLogAsset, encryptionKey, false)
+	}
 	if err != nil {
 		errMsg := "Failed to add transaction log"
 		logger.Errorf("%v: %v", errMsg, err)
@@ -373,75 +415,6 @@ func putTransactionLog(assetManager asset_manager.AssetManager, transactionLog d
 	return nil
 }
 
-// getTransactionLogAssetID generates an assetID for a transaction log.
-func getTransactionLogAssetID(transactionID string) string {
-	return asset_mgmt_i.GetAssetId(global.TRANSACTION_LOG_ASSET_NAMESPACE, transactionID)
-}
-
-// convertToAsset converts a transactionLog to an assetData.
-func convertToAsset(transactionLog data_model.TransactionLog, logSymKeyId string) (*data_model.Asset, error) {
-	var err error
-	// convert all fields to strings using the proper method (if this method is not used, indexing will not work properly)
-	transactionLog.Field1, err = utils.ConvertToString(transactionLog.Field1)
-	if err != nil {
-		logger.Errorf("Failed to convert field 1 of transaction log to string: %v", err)
-		return nil, errors.Wrap(err, "Failed to convert field 1 of transaction log to string")
-	}
-	transactionLog.Field2, err = utils.ConvertToString(transactionLog.Field2)
-	if err != nil {
-		logger.Errorf("Failed to convert field 2 of transaction log to string: %v", err)
-		return nil, errors.Wrap(err, "Failed to convert field 2 of transaction log to string")
-	}
-	transactionLog.Field3, err = utils.ConvertToString(transactionLog.Field3)
-	if err != nil {
-		logger.Errorf("Failed to convert field 3 of transaction log to string: %v", err)
-		return nil, errors.Wrap(err, "Failed to convert field 3 of transaction log to string")
-	}
-	transactionLog.Field4, err = utils.ConvertToString(transactionLog.Field4)
-	if err != nil {
-		logger.Errorf("Failed to convert field 4 of transaction log to string: %v", err)
-		return nil, errors.Wrap(err, "Failed to convert field 4 of transaction log to string")
-	}
-	transactionLog.Field5, err = utils.ConvertToString(transactionLog.Field5)
-	if err != nil {
-		logger.Errorf("Failed to convert field 5 of transaction log to string: %v", err)
-		return nil, errors.Wrap(err, "Failed to convert field 5 of transaction log to string")
-	}
-	transactionLog.Field6, err = utils.ConvertToString(transactionLog.Field6)
-	if err != nil {
-		logger.Errorf("Failed to convert field 6 of transaction log to string: %v", err)
-		return nil, errors.Wrap(err, "Failed to convert field 6 of transaction log to string")
-	}
-	transactionLog.Field7, err = utils.ConvertToString(transactionLog.Field7)
-	if err != nil {
-		logger.Errorf("Failed to convert field 7 of transaction log to string: %v", err)
-		return nil, errors.Wrap(err, "Failed to convert field 7 of transaction log to string")
-	}
-	transactionLog.Field8, err = utils.ConvertToString(transactionLog.Field8)
-	if err != nil {
-		logger.Errorf("Failed to convert field 8 of transaction log to string: %v", err)
-		return nil, errors.Wrap(err, "Failed to convert field 8 of transaction log to string")
-	}
-
-	asset := data_model.Asset{}
-	asset.AssetId = getTransactionLogAssetID(transactionLog.TransactionID)
-	asset.AssetKeyId = logSymKeyId
-	asset.Datatypes = []string{}
-	metaData := make(map[string]string)
-	metaData["namespace"] = global.TRANSACTION_LOG_ASSET_NAMESPACE
-	asset.Metadata = metaData
-	var publicData interface{}
-	asset.PublicData, _ = json.Marshal(&publicData)
-	asset.PrivateData, _ = json.Marshal(&transactionLog)
-	asset.IndexTableName = global.INDEX_HISTORY
-	// if an off-chain datastore is specified, save the id so that the log can be saved there
-	if len(transactionLog.ConnectionID) != 0 {
-		asset.SetDatastoreConnectionID(transactionLog.ConnectionID)
-	}
-
-	return &asset, nil
-}
-
 // convertFromAsset converts an assetData to a transactionLog.
 func convertFromAsset(asset *data_model.Asset) data_model.TransactionLog {
 	transactionLog := data_model.TransactionLog{}
@@ -145,6 +145,49 @@ func TestPutInvokeTransactionLog(t *testing.T) {
 	test_utils.AssertFalse(t, err == nil, "Expected putTransactionLog to fail")
 }
 
+// test signed invoke transaction log
+func TestPutInvokeTransactionLog_Signed(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestPutInvokeTransactionLog_Signed function called")
+
+	mstub := setup(t)
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	caller := test_utils.CreateTestUser("caller")
+	callerBytes, _ := json.Marshal(&caller)
+	_, err := user_mgmt.RegisterUser(stub, caller, []string{string(callerBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	// signed and unsigned logs
+	logSymKey := caller.GetLogSymKey()
+	signedLog := data_model.TransactionLog{TransactionID: "txid1", Namespace: "namespace", FunctionName: "function_name", CallerID: "caller", Timestamp: 1234567890, Field1: "abc", SignerID: caller.ID}
+	unsignedLog := data_model.TransactionLog{TransactionID: "txid2", Namespace: "namespace", FunctionName: "function_name", CallerID: "caller", Timestamp: 1234567890, Field1: "abc"}
+	for _, transactionLog := range []data_model.TransactionLog{signedLog, unsignedLog} {
+		mstub.MockTransactionStart(transactionLog.TransactionID)
+		stub = cached_stub.NewCachedStub(mstub)
+		historyManager := GetHistoryManager(asset_mgmt_i.GetAssetManager(stub, caller))
+		err = historyManager.PutInvokeTransactionLog(transactionLog, logSymKey)
+		test_utils.AssertTrue(t, err == nil, "Expected PutInvokeTransactionLog to succeed")
+		mstub.MockTransactionEnd(transactionLog.TransactionID)
+	}
+
+	mstub.MockTransactionStart("t1")
+	stub = cached_stub.NewCachedStub(mstub)
+	historyManager := GetHistoryManager(asset_mgmt_i.GetAssetManager(stub, caller))
+	err = historyManager.VerifyTransactionLogSignature(signedLog.TransactionID, logSymKey)
+	test_utils.AssertTrue(t, err == nil, "Expected VerifyTransactionLogSignature to succeed")
+	transactionLog, err := historyManager.GetTransactionLog(signedLog.TransactionID, logSymKey)
+	test_utils.AssertTrue(t, err == nil, "Expected GetTransactionLog to succeed")
+	test_utils.AssertTrue(t, transactionLog.SignerID == caller.ID, "Expected signer ID")
+	err = historyManager.VerifyTransactionLogSignature(unsignedLog.TransactionID, logSymKey)
+	test_utils.AssertTrue(t, err != nil, "Expected VerifyTransactionLogSignature to fail for unsigned log")
+	err = historyManager.VerifyTransactionLogSignature("unknown", logSymKey)
+	test_utils.AssertTrue(t, err != nil, "Expected VerifyTransactionLogSignature to fail for unknown log")
+	mstub.MockTransactionEnd("t1")
+}
+
 // test basic put and get a query transaction log from ledger
 func TestPutAndGetQueryTransactionLog(t *testing.T) {
 	logger.SetLevel(shim.LogDebug)
@@ -21,7 +21,6 @@ import (
 
 	"bytes"
 	"crypto/rsa"
-	"crypto/x509"
 	"encoding/json"
 	"reflect"
 	"strings"
@@ -112,14 +111,22 @@ func AddAccessWithKeys(stub cached_stub.CachedStubInterface, startKey []byte, st
 }
 
 // AddAccess gives startKey access to targetKey.
+// Public and private keys can be RSA, EC P-256, or Ed25519 keys; EC keys encrypt the target key with ECIES.
+// If startKey is an RSA key, edgeData[global.EDGEDATA_ENCRYPTION_SCHEME] can be set to
+// global.ENCRYPTION_SCHEME_OAEP or global.ENCRYPTION_SCHEME_HYBRID to opt in to RSA-OAEP or
+// hybrid (RSA-OAEP + AES-GCM) encryption of the target key. These and ECIES are randomized, so the
+// resulting edge value differs across endorsers.
 func AddAccess(stub cached_stub.CachedStubInterface, startKey data_model.Key, targetKey data_model.Key, edgeData ...map[string]string) error {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 	logger.Debugf("startKeyId: %v, targetKeyId: %v, edgeData:%v", startKey.ID, targetKey.ID, edgeData)
 
 	var edgeValueBytes []byte
+	// copy edgeData so that the caller's map is not modified
 	var edgeDataMap map[string]string = make(map[string]string)
 	if len(edgeData) > 0 {
-		edgeDataMap = edgeData[0]
+		for k, v := range edgeData[0] {
+			edgeDataMap[k] = v
+		}
 	}
 
 	// Public key is not allowed as target
@@ -128,6 +135,16 @@ func AddAccess(stub cached_stub.CachedStubInterface, startKey data_model.Key, ta
 		return errors.New("Public key cannot be added as a targetKey in the key graph")
 	}
 
+	// PKCS#1 v1.5 is the default encryption scheme, so it's not stored in edge data
+	scheme := edgeDataMap[global.EDGEDATA_ENCRYPTION_SCHEME]
+	if scheme == global.ENCRYPTION_SCHEME_PKCS1V15 {
+		delete(edgeDataMap, global.EDGEDATA_ENCRYPTION_SCHEME)
+		scheme = ""
+	} else if len(scheme) > 0 && scheme != global.ENCRYPTION_SCHEME_OAEP && scheme != global.ENCRYPTION_SCHEME_HYBRID {
+		logger.Errorf("Unsupported encryption scheme \"%v\"", scheme)
+		return errors.Errorf("Unsupported encryption scheme \"%v\"", scheme)
+	}
+
 	needToCheckExistingEdge := true
 	if KeyExists(stub, startKey.ID) {
 		// Checks for an existing startKey node and makes sure they match
@@ -188,8 +205,11 @@ func AddAccess(stub cached_stub.CachedStubInterface, startKey data_model.Key, ta
 				logger.Infof("Existing edge from \"%v\" to \"%v\"", startKey.ID, targetKey.ID)
 				return nil
 			}
-			needToEncrypt = false
-			edgeValueBytes = edgeValueBytes2
+			// reuse existing encrypted target key unless encryption scheme has changed
+			if edgeDataMap2[global.EDGEDATA_ENCRYPTION_SCHEME] == scheme {
+				needToEncrypt = false
+				edgeValueBytes = edgeValueBytes2
+			}
 		}
 	}
 
@@ -208,8 +228,8 @@ func AddAccess(stub cached_stub.CachedStubInterface, startKey data_model.Key, ta
 			}
 
 		case global.KEY_TYPE_PRIVATE:
-			// Parse startKey into an RSA PrivateKey
-			privateKey, err := crypto.ParsePrivateKey(startKey.KeyBytes)
+			// Parse startKey into an RSA or EC PrivateKey
+			privateKey, err := crypto.ParseAnyPrivateKey(startKey.KeyBytes)
 			if err != nil {
 				custom_err := &custom_errors.ParseKeyError{Type: "private key"}
 				logger.Errorf("%v: %v", custom_err, err)
@@ -221,9 +241,9 @@ func AddAccess(stub cached_stub.CachedStubInterface, startKey data_model.Key, ta
 				return errors.WithStack(custom_err)
 			}
 			// Extract publicKey from privateKey
-			publicKey := privateKey.Public().(*rsa.PublicKey)
+			publicKey := crypto.GetPublicKeyOf(privateKey)
 			// Encrypt targetKey with publicKey
-			encryptedTargetKey, err = crypto.EncryptWithPublicKey(publicKey, targetKey.KeyBytes)
+			encryptedTargetKey, err = encryptWithPublicKey(publicKey, targetKey.KeyBytes, scheme)
 			if err != nil {
 				custom_err := &custom_errors.EncryptionError{ToEncrypt: targetKey.ID, EncryptionKey: startKey.ID}
 				logger.Errorf("%v: %v", custom_err, err)
@@ -231,8 +251,8 @@ func AddAccess(stub cached_stub.CachedStubInterface, startKey data_model.Key, ta
 			}
 
 		case global.KEY_TYPE_PUBLIC:
-			// Parse startKey into an RSA PublicKey
-			publicKey, err := crypto.ParsePublicKey(startKey.KeyBytes)
+			// Parse startKey into an RSA or EC PublicKey
+			publicKey, err := crypto.ParseAnyPublicKey(startKey.KeyBytes)
 			if err != nil {
 				custom_err := &custom_errors.ParseKeyError{Type: "public key"}
 				logger.Errorf("%v: %v", custom_err, err)
@@ -244,7 +264,7 @@ func AddAccess(stub cached_stub.CachedStubInterface, startKey data_model.Key, ta
 				return errors.WithStack(custom_err)
 			}
 			// Encrypt targetKey with publicKey
-			encryptedTargetKey, err = crypto.EncryptWithPublicKey(publicKey, targetKey.KeyBytes)
+			encryptedTargetKey, err = encryptWithPublicKey(publicKey, targetKey.KeyBytes, scheme)
 			if err != nil {
 				custom_err := &custom_errors.EncryptionError{ToEncrypt: targetKey.ID, EncryptionKey: startKey.ID}
 				logger.Errorf("%v: %v", custom_err, err)
@@ -292,6 +312,46 @@ func AddAccess(stub cached_stub.CachedStubInterface, startKey data_model.Key, ta
 	return graph.PutEdge(stub, global.KEY_GRAPH_PREFIX, startKey.ID, targetKey.ID, edgeValueBytes, edgeDataMap)
 }
 
+// encryptWithPublicKey encrypts a target key with publicKey using the given encryption scheme.
+// Empty scheme means PKCS#1 v1.5 for RSA keys. EC keys always use ECIES.
+func encryptWithPublicKey(publicKey interface{}, data []byte, scheme string) ([]byte, error) {
+	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		if len(scheme) > 0 {
+			return nil, errors.Errorf("Encryption scheme \"%v\" is only supported for RSA keys", scheme)
+		}
+		return crypto.EncryptWithPublicKeyECIES(publicKey, data)
+	}
+	switch scheme {
+	case "", global.ENCRYPTION_SCHEME_PKCS1V15:
+		return crypto.EncryptWithPublicKey(rsaPublicKey, data)
+	case global.ENCRYPTION_SCHEME_OAEP:
+		return crypto.EncryptWithPublicKeyOAEP(rsaPublicKey, data)
+	case global.ENCRYPTION_SCHEME_HYBRID:
+		return crypto.EncryptWithPublicKeyHybrid(rsaPublicKey, data)
+	default:
+		return nil, errors.Errorf("Unsupported encryption scheme \"%v\"", scheme)
+	}
+}
+
+// decryptWithPrivateKey decrypts a target key encrypted by encryptWithPublicKey.
+func decryptWithPrivateKey(privateKey interface{}, data []byte, scheme string) ([]byte, error) {
+	rsaPrivateKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return crypto.DecryptWithPrivateKeyECIES(privateKey, data)
+	}
+	switch scheme {
+	case "", global.ENCRYPTION_SCHEME_PKCS1V15:
+		return crypto.DecryptWithPrivateKey(rsaPrivateKey, data)
+	case global.ENCRYPTION_SCHEME_OAEP:
+		return crypto.DecryptWithPrivateKeyOAEP(rsaPrivateKey, data)
+	case global.ENCRYPTION_SCHEME_HYBRID:
+		return crypto.DecryptWithPrivateKeyHybrid(rsaPrivateKey, data)
+	default:
+		return nil, errors.Errorf("Unsupported encryption scheme \"%v\"", scheme)
+	}
+}
+
 // RevokeAccess revokes access from startKey to targetKey.
 // It does this by deleting the edge from startKey -> targetKey (and the reverse edge from targetKeyId -> startKeyId).
 func RevokeAccess(stub cached_stub.CachedStubInterface, startKeyId string, targetKeyId string) error {
@@ -320,6 +380,423 @@ func UpdateAccessEdge(stub cached_stub.CachedStubInterface, startKeyId string, t
 	}
 }
 
+// keyGraphEdgeUpdate is an edge to be re-encrypted by RotateKeys.
+type keyGraphEdgeUpdate struct {
+	StartKeyId  string
+	TargetKeyId string
+	EdgeData    map[string]string
+}
+
+// RotateKeys replaces the key bytes of existing key graph nodes while keeping their key IDs.
+// oldKeys and newKeys are matched by index and must have the same ID and type. Only sym and private
+// keys can be rotated, and each old key must match the existing node in the graph.
+// Every outgoing edge of a rotated node is decrypted with the old key and re-encrypted with the new key,
+// and every incoming edge is re-encrypted so that it wraps the new key. An incoming edge from a sym key
+// can only be re-encrypted if that sym key is itself reachable from one of the rotated keys through a direct edge.
+// Edge data, including the encryption scheme, is preserved. The encryption scheme is dropped if the start key
+// is no longer an RSA key. All edges are verified before anything is written to the ledger.
+func RotateKeys(stub cached_stub.CachedStubInterface, oldKeys []data_model.Key, newKeys []data_model.Key) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	if len(oldKeys) == 0 || len(oldKeys) != len(newKeys) {
+		custom_err := &custom_errors.LengthCheckingError{Type: "keys"}
+		logger.Errorf("%v", custom_err)
+		return errors.WithStack(custom_err)
+	}
+
+	// validate keys
+	rotatedKeys := make(map[string]data_model.Key)
+	knownKeys := make(map[string][]byte)
+	for i, oldKey := range oldKeys {
+		newKey := newKeys[i]
+		if oldKey.ID != newKey.ID || oldKey.Type != newKey.Type || len(newKey.KeyBytes) == 0 {
+			invalidKeyError := &custom_errors.InvalidKeyError{KeyId: newKey.ID}
+			logger.Errorf("%v: key id and type must match the old key", invalidKeyError)
+			return errors.WithStack(invalidKeyError)
+		}
+		if oldKey.Type != global.KEY_TYPE_SYM && oldKey.Type != global.KEY_TYPE_PRIVATE {
+			logger.Errorf("Unsupported key type \"%v\"", oldKey.Type)
+			return errors.Errorf("Unsupported key type \"%v\"", oldKey.Type)
+		}
+		if oldKey.Type == global.KEY_TYPE_SYM && !crypto.ValidateSymKey(newKey.KeyBytes) {
+			invalidKeyError := &custom_errors.InvalidKeyError{KeyId: newKey.ID}
+			logger.Errorf("%v", invalidKeyError)
+			return errors.WithStack(invalidKeyError)
+		}
+		if _, ok := rotatedKeys[oldKey.ID]; ok {
+			logger.Errorf("Duplicate key id \"%v\"", oldKey.ID)
+			return errors.Errorf("Duplicate key id \"%v\"", oldKey.ID)
+		}
+		isValid, err := ValidateKey(stub, oldKey, true)
+		if !isValid || err != nil {
+			invalidKeyError := &custom_errors.InvalidKeyError{KeyId: oldKey.ID}
+			logger.Errorf("%v: %v", invalidKeyError, err)
+			return errors.WithStack(invalidKeyError)
+		}
+		rotatedKeys[oldKey.ID] = newKey
+		knownKeys[oldKey.ID] = oldKey.KeyBytes
+	}
+
+	// decrypt all outgoing edges with the old keys and collect incoming edges
+	edgeUpdates := []keyGraphEdgeUpdate{}
+	for _, oldKey := range oldKeys {
+		children, err := graph.GetDirectChildren(stub, global.KEY_GRAPH_PREFIX, oldKey.ID)
+		if err != nil {
+			logger.Errorf("Failed to get children of key \"%v\": %v", oldKey.ID, err)
+			return errors.Wrapf(err, "Failed to get children of key \"%v\"", oldKey.ID)
+		}
+		for _, childId := range children {
+			edgeValueBytes, edgeData, err := graph.GetEdge(stub, global.KEY_GRAPH_PREFIX, oldKey.ID, childId)
+			if err != nil || len(edgeValueBytes) == 0 {
+				custom_err := &custom_errors.GetEdgeError{ParentNode: oldKey.ID, ChildNode: childId}
+				logger.Errorf("%v: %v", custom_err, err)
+				return errors.WithStack(custom_err)
+			}
+			edge := keyGraphEdge{}
+			err = json.Unmarshal(edgeValueBytes, &edge)
+			if err != nil {
+				custom_err := &custom_errors.UnmarshalError{Type: "keyGraphEdgeBytes"}
+				logger.Errorf("%v: %v", custom_err, err)
+				return errors.Wrap(err, custom_err.Error())
+			}
+			childKeyBytes, err := decryptEdge(oldKey, edge.EncryptedTargetKey, edgeData[global.EDGEDATA_ENCRYPTION_SCHEME])
+			if err != nil {
+				custom_err := &custom_errors.DecryptionError{ToDecrypt: childId, DecryptionKey: oldKey.ID}
+				logger.Errorf("%v: %v", custom_err, err)
+				return errors.Wrap(err, custom_err.Error())
+			}
+			if _, ok := rotatedKeys[childId]; !ok {
+				knownKeys[childId] = childKeyBytes
+			}
+			edgeUpdates = append(edgeUpdates, keyGraphEdgeUpdate{StartKeyId: oldKey.ID, TargetKeyId: childId, EdgeData: edgeData})
+		}
+
+		parents, err := graph.GetDirectParents(stub, global.KEY_GRAPH_PREFIX, oldKey.ID)
+		if err != nil {
+			logger.Errorf("Failed to get parents of key \"%v\": %v", oldKey.ID, err)
+			return errors.Wrapf(err, "Failed to get parents of key \"%v\"", oldKey.ID)
+		}
+		for _, parentId := range parents {
+			// edges between rotated keys are handled as outgoing edges
+			if _, ok := rotatedKeys[parentId]; ok {
+				continue
+			}
+			_, edgeData, err := graph.GetEdge(stub, global.KEY_GRAPH_PREFIX, parentId, oldKey.ID)
+			if err != nil {
+				custom_err := &custom_errors.GetEdgeError{ParentNode: parentId, ChildNode: oldKey.ID}
+				logger.Errorf("%v: %v", custom_err, err)
+				return errors.Wrap(err, custom_err.Error())
+			}
+			edgeUpdates = append(edgeUpdates, keyGraphEdgeUpdate{StartKeyId: parentId, TargetKeyId: oldKey.ID, EdgeData: edgeData})
+		}
+	}
+
+	// re-encrypt edges
+	edgeValues := make([][]byte, len(edgeUpdates))
+	for i, edgeUpdate := range edgeUpdates {
+		startKey, ok := rotatedKeys[edgeUpdate.StartKeyId]
+		if !ok {
+			var err error
+			startKey, err = getEdgeStartKey(stub, edgeUpdate, knownKeys)
+			if err != nil {
+				return err
+			}
+		}
+
+		targetKeyBytes := knownKeys[edgeUpdate.TargetKeyId]
+		if newKey, ok := rotatedKeys[edgeUpdate.TargetKeyId]; ok {
+			targetKeyBytes = newKey.KeyBytes
+		}
+
+		encryptedTargetKey, newEdgeData, err := encryptEdge(startKey, targetKeyBytes, edgeUpdate.EdgeData)
+		if err != nil || len(encryptedTargetKey) == 0 {
+			custom_err := &custom_errors.EncryptionError{ToEncrypt: edgeUpdate.TargetKeyId, EncryptionKey: edgeUpdate.StartKeyId}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.WithStack(custom_err)
+		}
+		edgeUpdates[i].EdgeData = newEdgeData
+
+		edgeValues[i], err = json.Marshal(keyGraphEdge{
+			StartKeyId:         edgeUpdate.StartKeyId,
+			TargetKeyId:        edgeUpdate.TargetKeyId,
+			EncryptedTargetKey: encryptedTargetKey})
+		if err != nil {
+			custom_err := &custom_errors.MarshalError{Type: "edge data"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+	}
+
+	// save nodes and edges
+	for _, newKey := range newKeys {
+		newKeyNode, err := convertKeyToKeyGraphNode(newKey)
+		if err != nil {
+			logger.Errorf("Failed to convertKeyToKeyGraphNode for key \"%v\"", newKey.ID)
+			return errors.Wrapf(err, "Failed to convertKeyToKeyGraphNode for key \"%v\"", newKey.ID)
+		}
+		err = putKeyGraphNode(stub, *newKeyNode)
+		if err != nil {
+			logger.Errorf("Failed to putKeyGraphNode for key \"%v\"", newKey.ID)
+			return errors.Wrapf(err, "Failed to putKeyGraphNode for key \"%v\"", newKey.ID)
+		}
+		stub.DelCache(getCacheKey(newKey.ID))
+	}
+	for i, edgeUpdate := range edgeUpdates {
+		logger.Infof("Re-encrypting access edge from \"%v\" to \"%v\"", edgeUpdate.StartKeyId, edgeUpdate.TargetKeyId)
+		err := graph.PutEdge(stub, global.KEY_GRAPH_PREFIX, edgeUpdate.StartKeyId, edgeUpdate.TargetKeyId, edgeValues[i], edgeUpdate.EdgeData)
+		if err != nil {
+			logger.Errorf("Failed to update edge from \"%v\" to \"%v\": %v", edgeUpdate.StartKeyId, edgeUpdate.TargetKeyId, err)
+			return errors.Wrapf(err, "Failed to update edge from \"%v\" to \"%v\"", edgeUpdate.StartKeyId, edgeUpdate.TargetKeyId)
+		}
+	}
+	return nil
+}
+
+// ReplaceKey replaces oldKey with newKey in the key graph. Both keys must be sym keys.
+// newKey can have the same ID as oldKey or a new ID. If the ID is new, the edges of oldKey are moved to newKey.
+// Every outgoing edge of oldKey is decrypted with oldKey and re-encrypted with newKey, and every incoming edge
+// is re-encrypted so that it wraps newKey. startKeys are sym keys used to re-encrypt incoming edges from sym keys;
+// incoming edges from private keys are re-encrypted with the matching public key stored in the graph.
+// Edge data is preserved. All edges are verified before anything is written to the ledger.
+func ReplaceKey(stub cached_stub.CachedStubInterface, oldKey data_model.Key, newKey data_model.Key, startKeys ...data_model.Key) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("oldKeyId: \"%v\", newKeyId: \"%v\"", oldKey.ID, newKey.ID)
+
+	// validate keys
+	if oldKey.Type != global.KEY_TYPE_SYM || newKey.Type != global.KEY_TYPE_SYM {
+		logger.Errorf("Unsupported key type: only sym keys can be replaced")
+		return errors.New("Unsupported key type: only sym keys can be replaced")
+	}
+	if len(newKey.ID) == 0 || !crypto.ValidateSymKey(newKey.KeyBytes) {
+		invalidKeyError := &custom_errors.InvalidKeyError{KeyId: newKey.ID}
+		logger.Errorf("%v", invalidKeyError)
+		return errors.WithStack(invalidKeyError)
+	}
+	isValid, err := ValidateKey(stub, oldKey, true)
+	if !isValid || err != nil {
+		invalidKeyError := &custom_errors.InvalidKeyError{KeyId: oldKey.ID}
+		logger.Errorf("%v: %v", invalidKeyError, err)
+		return errors.WithStack(invalidKeyError)
+	}
+	if newKey.ID != oldKey.ID {
+		isValid, err = ValidateKey(stub, newKey, false)
+		if !isValid || err != nil {
+			invalidKeyError := &custom_errors.InvalidKeyError{KeyId: newKey.ID}
+			logger.Errorf("%v: %v", invalidKeyError, err)
+			return errors.WithStack(invalidKeyError)
+		}
+	}
+
+	knownKeys := make(map[string][]byte)
+	for _, startKey := range startKeys {
+		knownKeys[startKey.ID] = startKey.KeyBytes
+	}
+
+	// decrypt all outgoing edges with the old key and collect incoming edges
+	edgeUpdates := []keyGraphEdgeUpdate{}
+	children, err := graph.GetDirectChildren(stub, global.KEY_GRAPH_PREFIX, oldKey.ID)
+	if err != nil {
+		logger.Errorf("Failed to get children of key \"%v\": %v", oldKey.ID, err)
+		return errors.Wrapf(err, "Failed to get children of key \"%v\"", oldKey.ID)
+	}
+	for _, childId := range children {
+		edgeValueBytes, edgeData, err := graph.GetEdge(stub, global.KEY_GRAPH_PREFIX, oldKey.ID, childId)
+		if err != nil || len(edgeValueBytes) == 0 {
+			custom_err := &custom_errors.GetEdgeError{ParentNode: oldKey.ID, ChildNode: childId}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.WithStack(custom_err)
+		}
+		edge := keyGraphEdge{}
+		err = json.Unmarshal(edgeValueBytes, &edge)
+		if err != nil {
+			custom_err := &custom_errors.UnmarshalError{Type: "keyGraphEdgeBytes"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+		childKeyBytes, err := crypto.DecryptWithSymKey(oldKey.KeyBytes, edge.EncryptedTargetKey)
+		if err != nil {
+			custom_err := &custom_errors.DecryptionError{ToDecrypt: childId, DecryptionKey: oldKey.ID}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+		knownKeys[childId] = childKeyBytes
+		edgeUpdates = append(edgeUpdates, keyGraphEdgeUpdate{StartKeyId: oldKey.ID, TargetKeyId: childId, EdgeData: edgeData})
+	}
+	parents, err := graph.GetDirectParents(stub, global.KEY_GRAPH_PREFIX, oldKey.ID)
+	if err != nil {
+		logger.Errorf("Failed to get parents of key \"%v\": %v", oldKey.ID, err)
+		return errors.Wrapf(err, "Failed to get parents of key \"%v\"", oldKey.ID)
+	}
+	for _, parentId := range parents {
+		_, edgeData, err := graph.GetEdge(stub, global.KEY_GRAPH_PREFIX, parentId, oldKey.ID)
+		if err != nil {
+			custom_err := &custom_errors.GetEdgeError{ParentNode: parentId, ChildNode: oldKey.ID}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+		edgeUpdates = append(edgeUpdates, keyGraphEdgeUpdate{StartKeyId: parentId, TargetKeyId: oldKey.ID, EdgeData: edgeData})
+	}
+
+	// re-encrypt edges
+	edgeValues := make([][]byte, len(edgeUpdates))
+	for i, edgeUpdate := range edgeUpdates {
+		startKey := newKey
+		targetKeyBytes := newKey.KeyBytes
+		if edgeUpdate.StartKeyId == oldKey.ID {
+			targetKeyBytes = knownKeys[edgeUpdate.TargetKeyId]
+		} else {
+			startKey, err = getEdgeStartKey(stub, edgeUpdate, knownKeys)
+			if err != nil {
+				return err
+			}
+		}
+
+		encryptedTargetKey, newEdgeData, err := encryptEdge(startKey, targetKeyBytes, edgeUpdate.EdgeData)
+		if err != nil || len(encryptedTargetKey) == 0 {
+			custom_err := &custom_errors.EncryptionError{ToEncrypt: edgeUpdate.TargetKeyId, EncryptionKey: edgeUpdate.StartKeyId}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.WithStack(custom_err)
+		}
+		edgeUpdates[i].EdgeData = newEdgeData
+
+		// point the edge to the new key
+		startKeyId, targetKeyId := getReplacedEdge(edgeUpdate, oldKey.ID, newKey.ID)
+		edgeValues[i], err = json.Marshal(keyGraphEdge{
+			StartKeyId:         startKeyId,
+			TargetKeyId:        targetKeyId,
+			EncryptedTargetKey: encryptedTargetKey})
+		if err != nil {
+			custom_err := &custom_errors.MarshalError{Type: "edge data"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+	}
+
+	// save node and edges
+	newKeyNode, err := convertKeyToKeyGraphNode(newKey)
+	if err != nil {
+		logger.Errorf("Failed to convertKeyToKeyGraphNode for key \"%v\"", newKey.ID)
+		return errors.Wrapf(err, "Failed to convertKeyToKeyGraphNode for key \"%v\"", newKey.ID)
+	}
+	err = putKeyGraphNode(stub, *newKeyNode)
+	if err != nil {
+		logger.Errorf("Failed to putKeyGraphNode for key \"%v\"", newKey.ID)
+		return errors.Wrapf(err, "Failed to putKeyGraphNode for key \"%v\"", newKey.ID)
+	}
+	stub.DelCache(getCacheKey(oldKey.ID))
+	stub.DelCache(getCacheKey(newKey.ID))
+	for i, edgeUpdate := range edgeUpdates {
+		startKeyId, targetKeyId := getReplacedEdge(edgeUpdate, oldKey.ID, newKey.ID)
+		if newKey.ID != oldKey.ID {
+			err = RevokeAccess(stub, edgeUpdate.StartKeyId, edgeUpdate.TargetKeyId)
+			if err != nil {
+				logger.Errorf("Failed to delete edge from \"%v\" to \"%v\": %v", edgeUpdate.StartKeyId, edgeUpdate.TargetKeyId, err)
+				return errors.Wrapf(err, "Failed to delete edge from \"%v\" to \"%v\"", edgeUpdate.StartKeyId, edgeUpdate.TargetKeyId)
+			}
+		}
+		logger.Infof("Re-encrypting access edge from \"%v\" to \"%v\"", startKeyId, targetKeyId)
+		err = graph.PutEdge(stub, global.KEY_GRAPH_PREFIX, startKeyId, targetKeyId, edgeValues[i], edgeUpdate.EdgeData)
+		if err != nil {
+			logger.Errorf("Failed to update edge from \"%v\" to \"%v\": %v", startKeyId, targetKeyId, err)
+			return errors.Wrapf(err, "Failed to update edge from \"%v\" to \"%v\"", startKeyId, targetKeyId)
+		}
+	}
+	return nil
+}
+
+// DeleteKey removes the key graph node of keyId. Edges of the key are not deleted, so it must only be used
+// for keys whose edges were moved to a replacement key by ReplaceKey.
+func DeleteKey(stub cached_stub.CachedStubInterface, keyId string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("keyId: \"%v\"", keyId)
+
+	keyLedgerKey, _ := stub.CreateCompositeKey(global.KEY_NODE_PREFIX, []string{keyId})
+	err := stub.DelState(keyLedgerKey)
+	if err != nil {
+		custom_err := &custom_errors.DeleteLedgerError{LedgerKey: keyLedgerKey}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	stub.DelCache(getKeyGraphNodeCacheKey(keyId))
+	stub.DelCache(getCacheKey(keyId))
+	return nil
+}
+
+// getReplacedEdge returns the start and target key IDs of an edge after oldKeyId is replaced by newKeyId.
+func getReplacedEdge(edgeUpdate keyGraphEdgeUpdate, oldKeyId string, newKeyId string) (string, string) {
+	if edgeUpdate.StartKeyId == oldKeyId {
+		return newKeyId, edgeUpdate.TargetKeyId
+	}
+	return edgeUpdate.StartKeyId, newKeyId
+}
+
+// getEdgeStartKey returns the key used to re-encrypt an edge from a key that is not being rotated.
+// For a private key, the public key stored in the graph is returned. A sym key is returned from knownKeys
+// if it matches the node in the graph.
+func getEdgeStartKey(stub cached_stub.CachedStubInterface, edgeUpdate keyGraphEdgeUpdate, knownKeys map[string][]byte) (data_model.Key, error) {
+	startKeyNode, err := getKeyGraphNode(stub, edgeUpdate.StartKeyId)
+	if err != nil {
+		logger.Errorf("Failed to getKeyGraphNode for key \"%v\"", edgeUpdate.StartKeyId)
+		return data_model.Key{}, errors.Wrapf(err, "Failed to getKeyGraphNode for key \"%v\"", edgeUpdate.StartKeyId)
+	}
+	if !startKeyNode.IsSymKey {
+		return data_model.Key{ID: edgeUpdate.StartKeyId, KeyBytes: startKeyNode.PublicKey, Type: global.KEY_TYPE_PUBLIC}, nil
+	}
+	if keyBytes, ok := knownKeys[edgeUpdate.StartKeyId]; ok && bytes.Equal(startKeyNode.SymKeyHash, crypto.Hash(keyBytes)) {
+		return data_model.Key{ID: edgeUpdate.StartKeyId, KeyBytes: keyBytes, Type: global.KEY_TYPE_SYM}, nil
+	}
+	logger.Errorf("Unable to re-encrypt edge from \"%v\" to \"%v\": start key is not available", edgeUpdate.StartKeyId, edgeUpdate.TargetKeyId)
+	return data_model.Key{}, errors.Errorf("Unable to re-encrypt edge from \"%v\" to \"%v\": start key is not available", edgeUpdate.StartKeyId, edgeUpdate.TargetKeyId)
+}
+
+// encryptEdge encrypts targetKeyBytes with a sym, private, or public startKey.
+// Returns the encrypted target key and a copy of edgeData to store with the edge.
+// The encryption scheme is removed from the returned edge data if startKey is not an RSA key.
+func encryptEdge(startKey data_model.Key, targetKeyBytes []byte, edgeData map[string]string) ([]byte, map[string]string, error) {
+	newEdgeData := make(map[string]string)
+	for k, v := range edgeData {
+		newEdgeData[k] = v
+	}
+
+	if startKey.Type == global.KEY_TYPE_SYM {
+		encryptedTargetKey, err := crypto.EncryptWithSymKey(startKey.KeyBytes, targetKeyBytes)
+		return encryptedTargetKey, newEdgeData, err
+	}
+
+	var publicKey interface{}
+	if startKey.Type == global.KEY_TYPE_PRIVATE {
+		privateKey, err := crypto.ParseAnyPrivateKey(startKey.KeyBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		publicKey = crypto.GetPublicKeyOf(privateKey)
+	} else {
+		var err error
+		publicKey, err = crypto.ParseAnyPublicKey(startKey.KeyBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if _, ok := publicKey.(*rsa.PublicKey); !ok {
+		delete(newEdgeData, global.EDGEDATA_ENCRYPTION_SCHEME)
+	}
+	encryptedTargetKey, err := encryptWithPublicKey(publicKey, targetKeyBytes, newEdgeData[global.EDGEDATA_ENCRYPTION_SCHEME])
+	return encryptedTargetKey, newEdgeData, err
+}
+
+// decryptEdge decrypts an encrypted target key with a sym or private startKey.
+func decryptEdge(startKey data_model.Key, encryptedTargetKey []byte, scheme string) ([]byte, error) {
+	if startKey.Type == global.KEY_TYPE_SYM {
+		return crypto.DecryptWithSymKey(startKey.KeyBytes, encryptedTargetKey)
+	}
+	privateKey, err := crypto.ParseAnyPrivateKey(startKey.KeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return decryptWithPrivateKey(privateKey, encryptedTargetKey, scheme)
+}
+
 // SlowVerifyAccess checks for a path in the graph from startKeyId to targetKeyId.
 // Uses recursive DFS.
 // Returns the list of keyIds in the path.
@@ -452,7 +929,7 @@ func GetKey(stub cached_stub.CachedStubInterface, keyIdList []string, startKey [
 
 		//edgeKey, _ := stub.CreateCompositeKey(KEY_GRAPH_PREFIX, []string{keyIdList[i], keyIdList[i+1]})
 		//keyGraphEdgeBytes, err := stub.GetState(edgeKey)
-		keyGraphEdgeBytes, _, err := graph.GetEdge(stub, global.KEY_GRAPH_PREFIX, keyIdList[i], keyIdList[i+1])
+		keyGraphEdgeBytes, edgeData, err := graph.GetEdge(stub, global.KEY_GRAPH_PREFIX, keyIdList[i], keyIdList[i+1])
 
 		if err != nil {
 			custom_err := &custom_errors.GetEdgeError{ParentNode: keyIdList[i], ChildNode: keyIdList[i+1]}
@@ -488,7 +965,7 @@ func GetKey(stub cached_stub.CachedStubInterface, keyIdList []string, startKey [
 				}
 			} else {
 				// pub key decryption
-				priv, err := crypto.ParsePrivateKey(decryptionKey)
+				priv, err := crypto.ParseAnyPrivateKey(decryptionKey)
 				if err != nil {
 					custom_err := &custom_errors.ParseKeyError{Type: "private key"}
 					logger.Errorf("%v: %v", custom_err, err)
@@ -500,7 +977,7 @@ func GetKey(stub cached_stub.CachedStubInterface, keyIdList []string, startKey [
 					return nil, custom_err
 				}
 
-				decryptedTargetKey, err = crypto.DecryptWithPrivateKey(priv, edge.EncryptedTargetKey)
+				decryptedTargetKey, err = decryptWithPrivateKey(priv, edge.EncryptedTargetKey, edgeData[global.EDGEDATA_ENCRYPTION_SCHEME])
 				if err != nil {
 					custom_err := &custom_errors.DecryptionError{ToDecrypt: "targetKey", DecryptionKey: "private key"}
 					logger.Errorf("%v: %v", custom_err, err)
@@ -689,18 +1166,12 @@ func convertKeyToKeyGraphNode(key data_model.Key) (*keyGraphNode, error) {
 		node.PublicKey = key.KeyBytes
 	case global.KEY_TYPE_PRIVATE:
 		// get publicKey from privateKey
-		privateKey, err := crypto.ParsePrivateKey(key.KeyBytes)
+		publicKeyBytes, err := crypto.GetPublicKeyBytesFromPrivateKey(key.KeyBytes)
 		if err != nil {
 			custom_err := &custom_errors.ParseKeyError{Type: "private key"}
 			logger.Errorf("%v: %v", custom_err, err)
 			return nil, errors.Wrap(err, custom_err.Error())
 		}
-		if privateKey == nil {
-			custom_err := &custom_errors.ParseKeyError{Type: "private key"}
-			logger.Errorf("%v", custom_err)
-			return nil, errors.WithStack(custom_err)
-		}
-		publicKeyBytes, _ := x509.MarshalPKIXPublicKey(privateKey.Public())
 		node.PublicKey = publicKeyBytes
 	default:
 		logger.Errorf("Unsupported key type \"%v\"", key.Type)
@@ -718,9 +1189,9 @@ func ConvertKeyBytesToKey(keyId string, keyBytes []byte) (*data_model.Key, error
 	// Set Key.Type
 	if crypto.ValidateSymKey(keyBytes) {
 		key.Type = global.KEY_TYPE_SYM
-	} else if crypto.ValidatePublicKey(keyBytes) {
+	} else if crypto.ValidateAnyPublicKey(keyBytes) {
 		key.Type = global.KEY_TYPE_PUBLIC
-	} else if crypto.ValidatePrivateKey(keyBytes) {
+	} else if crypto.ValidateAnyPrivateKey(keyBytes) {
 		key.Type = global.KEY_TYPE_PRIVATE
 	} else {
 		logger.Errorf("Unknown key type with keyId \"%v\"", keyId)
@@ -729,8 +1200,20 @@ func ConvertKeyBytesToKey(keyId string, keyBytes []byte) (*data_model.Key, error
 	return &key, nil
 }
 
+func getKeyGraphNodeCacheKey(keyId string) string {
+	return global.KEY_NODE_PREFIX + "-" + keyId
+}
+
 // getKeyGraphNode retrieves a keyGraphNode from the ledger.
+// Nodes updated in the current transaction are returned from the cache.
 func getKeyGraphNode(stub cached_stub.CachedStubInterface, keyId string) (*keyGraphNode, error) {
+	nodeCache, err := stub.GetCache(getKeyGraphNodeCacheKey(keyId))
+	if err == nil {
+		if cachedNode, ok := nodeCache.(keyGraphNode); ok {
+			return &cachedNode, nil
+		}
+	}
+
 	node := keyGraphNode{}
 	keyLedgerKey, _ := stub.CreateCompositeKey(global.KEY_NODE_PREFIX, []string{keyId})
 	nodeBytes, err := stub.GetState(keyLedgerKey)
@@ -744,10 +1227,15 @@ func getKeyGraphNode(stub cached_stub.CachedStubInterface, keyId string) (*keyGr
 }
 
 // putKeyGraphNode stores a keyGraphNode on the ledger.
+// The node is also saved to the cache, so that it can be validated against in the same transaction.
 func putKeyGraphNode(stub cached_stub.CachedStubInterface, keyGraphNode keyGraphNode) error {
 	keyLedgerKey, _ := stub.CreateCompositeKey(global.KEY_NODE_PREFIX, []string{keyGraphNode.KeyId})
 	keyNodeBytes, _ := json.Marshal(&keyGraphNode)
-	return stub.PutState(keyLedgerKey, keyNodeBytes)
+	err := stub.PutState(keyLedgerKey, keyNodeBytes)
+	if err != nil {
+		return err
+	}
+	return stub.PutCache(getKeyGraphNodeCacheKey(keyGraphNode.KeyId), keyGraphNode)
 }
 
 func GetStateByPartialCompositeKey(stub cached_stub.CachedStubInterface, keys []string) (shim.StateQueryIteratorInterface, error) {
@@ -758,6 +1246,11 @@ func GetKeyIdForWriteOnlyAccess(assetId string, assetKeyId string, ownerId strin
 	return global.ACCESS_WRITE_ONLY + "::" + assetKeyId + "::" + assetId + "::" + ownerId
 }
 
+// GetKeyIdForFieldAccess returns the ID of the key of a private data field of a field encrypted asset.
+func GetKeyIdForFieldAccess(assetId string, assetKeyId string, fieldName string) string {
+	return global.FIELD_KEY_PREFIX + "::" + assetKeyId + "::" + assetId + "::" + fieldName
+}
+
 // GetPubPrivKeyId returns the ID that should be assigned to a public or private key.
 func GetPubPrivKeyId(id string) string {
 	return key_mgmt_g.GetPubPrivKeyId(id)
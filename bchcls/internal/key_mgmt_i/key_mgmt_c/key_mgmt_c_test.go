@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"crypto/x509"
 	"encoding/json"
+	"strconv"
 	"testing"
 	"time"
 
@@ -173,6 +174,294 @@ func TestAddAccess_pubKey(t *testing.T) {
 	mstub.MockTransactionEnd("t1")
 }
 
+func TestAddAccess_encryptionScheme(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestAddAccess_encryptionScheme function called")
+
+	// Create the mock stub
+	mstub := test_utils.CreateNewMockStub(t)
+
+	privateStartKey := test_utils.GeneratePrivateKey()
+	privateStartKeyBytes := x509.MarshalPKCS1PrivateKey(privateStartKey)
+	publicEncKeyBytes, _ := x509.MarshalPKIXPublicKey(privateStartKey.Public())
+
+	symTargetKey := test_utils.GenerateSymKey()
+	privateTargetKeyBytes := x509.MarshalPKCS1PrivateKey(test_utils.GeneratePrivateKey())
+
+	startKeyId := "myStartKeyId"
+
+	// OAEP edge to a sym key, hybrid edge to a private key
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	err := AddAccessWithKeys(stub, privateStartKeyBytes, startKeyId, symTargetKey, "symTargetKeyId", publicEncKeyBytes, map[string]string{global.EDGEDATA_ENCRYPTION_SCHEME: global.ENCRYPTION_SCHEME_OAEP})
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess with OAEP to succeed")
+	err = AddAccessWithKeys(stub, privateStartKeyBytes, startKeyId, privateTargetKeyBytes, "privTargetKeyId", publicEncKeyBytes, map[string]string{global.EDGEDATA_ENCRYPTION_SCHEME: global.ENCRYPTION_SCHEME_HYBRID})
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess with hybrid to succeed")
+	err = AddAccessWithKeys(stub, privateStartKeyBytes, startKeyId, test_utils.GenerateSymKey(), "badTargetKeyId", publicEncKeyBytes, map[string]string{global.EDGEDATA_ENCRYPTION_SCHEME: "rot13"})
+	test_utils.AssertTrue(t, err != nil, "Expected AddAccess with unsupported scheme to fail")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	keyGraphEdgeBytes, edgeData, _ := graph.GetEdge(stub, global.KEY_GRAPH_PREFIX, startKeyId, "symTargetKeyId")
+	test_utils.AssertTrue(t, edgeData[global.EDGEDATA_ENCRYPTION_SCHEME] == global.ENCRYPTION_SCHEME_OAEP, "Expected OAEP scheme in edge data")
+	edge := keyGraphEdge{}
+	json.Unmarshal([]byte(keyGraphEdgeBytes), &edge)
+	decryptedTargetKey, _ := crypto.DecryptWithPrivateKeyOAEP(privateStartKey, edge.EncryptedTargetKey)
+	test_utils.AssertTrue(t, bytes.Equal(symTargetKey, decryptedTargetKey), "EncryptedTargetKey could not be decrypted with OAEP")
+
+	result, err := GetKey(stub, []string{startKeyId, "symTargetKeyId"}, privateStartKeyBytes)
+	test_utils.AssertTrue(t, err == nil, "Expected GetKey to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(symTargetKey, result), "Expected to get sym target key")
+
+	keyGraphEdgeBytes, edgeData, _ = graph.GetEdge(stub, global.KEY_GRAPH_PREFIX, startKeyId, "privTargetKeyId")
+	test_utils.AssertTrue(t, edgeData[global.EDGEDATA_ENCRYPTION_SCHEME] == global.ENCRYPTION_SCHEME_HYBRID, "Expected hybrid scheme in edge data")
+	edge = keyGraphEdge{}
+	json.Unmarshal([]byte(keyGraphEdgeBytes), &edge)
+	test_utils.AssertTrue(t, edge.EncryptedTargetKey[0] == crypto.PUBLIC_KEY_HEADER_HYBRID, "Expected hybrid header")
+
+	result, err = GetKey(stub, []string{startKeyId, "privTargetKeyId"}, privateStartKeyBytes)
+	test_utils.AssertTrue(t, err == nil, "Expected GetKey to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(privateTargetKeyBytes, result), "Expected to get private target key")
+	mstub.MockTransactionEnd("t2")
+
+	// Re-adding the edge with the default scheme re-encrypts the target key
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	callerEdgeData := map[string]string{global.EDGEDATA_ENCRYPTION_SCHEME: global.ENCRYPTION_SCHEME_PKCS1V15}
+	err = AddAccessWithKeys(stub, privateStartKeyBytes, startKeyId, symTargetKey, "symTargetKeyId", publicEncKeyBytes, callerEdgeData)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess with PKCS1v15 to succeed")
+	test_utils.AssertTrue(t, len(callerEdgeData) == 1 && callerEdgeData[global.EDGEDATA_ENCRYPTION_SCHEME] == global.ENCRYPTION_SCHEME_PKCS1V15, "Expected caller's edge data not to be modified")
+	mstub.MockTransactionEnd("t3")
+
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	keyGraphEdgeBytes, edgeData, _ = graph.GetEdge(stub, global.KEY_GRAPH_PREFIX, startKeyId, "symTargetKeyId")
+	_, ok := edgeData[global.EDGEDATA_ENCRYPTION_SCHEME]
+	test_utils.AssertFalse(t, ok, "Expected default scheme not to be stored in edge data")
+	edge = keyGraphEdge{}
+	json.Unmarshal([]byte(keyGraphEdgeBytes), &edge)
+	decryptedTargetKey, _ = crypto.DecryptWithPrivateKey(privateStartKey, edge.EncryptedTargetKey)
+	test_utils.AssertTrue(t, bytes.Equal(symTargetKey, decryptedTargetKey), "EncryptedTargetKey could not be decrypted with PKCS1v15")
+
+	result, err = GetKey(stub, []string{startKeyId, "symTargetKeyId"}, privateStartKeyBytes)
+	test_utils.AssertTrue(t, err == nil, "Expected GetKey to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(symTargetKey, result), "Expected to get sym target key")
+	mstub.MockTransactionEnd("t4")
+}
+
+func TestAddAccess_ecKey(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestAddAccess_ecKey function called")
+
+	// Create the mock stub
+	mstub := test_utils.CreateNewMockStub(t)
+
+	privateKeys := []interface{}{crypto.GenerateECPrivateKey(), crypto.GenerateEd25519PrivateKey()}
+	for i, privateKey := range privateKeys {
+		privateStartKeyBytes, _ := crypto.MarshalAnyPrivateKey(privateKey)
+		publicEncKeyBytes, _ := crypto.MarshalAnyPublicKey(crypto.GetPublicKeyOf(privateKey))
+		targetKey := test_utils.GenerateSymKey()
+		startKeyId := "myStartKeyId" + strconv.Itoa(i)
+		targetKeyId := "myTargetKeyId" + strconv.Itoa(i)
+
+		startKeyObject, err := ConvertKeyBytesToKey(startKeyId, privateStartKeyBytes)
+		test_utils.AssertTrue(t, err == nil && startKeyObject.Type == global.KEY_TYPE_PRIVATE, "Expected private key")
+		startKeyObject, err = ConvertKeyBytesToKey(startKeyId, publicEncKeyBytes)
+		test_utils.AssertTrue(t, err == nil && startKeyObject.Type == global.KEY_TYPE_PUBLIC, "Expected public key")
+
+		mstub.MockTransactionStart("t1")
+		stub := cached_stub.NewCachedStub(mstub)
+		err = AddAccessWithKeys(stub, privateStartKeyBytes, startKeyId, targetKey, targetKeyId, publicEncKeyBytes)
+		test_utils.AssertTrue(t, err == nil, "Expected AddAccess to succeed")
+		err = AddAccessWithKeys(stub, privateStartKeyBytes, startKeyId, test_utils.GenerateSymKey(), "badTargetKeyId", publicEncKeyBytes, map[string]string{global.EDGEDATA_ENCRYPTION_SCHEME: global.ENCRYPTION_SCHEME_OAEP})
+		test_utils.AssertTrue(t, err != nil, "Expected AddAccess with RSA encryption scheme to fail")
+		// AddAccess from the private key Key object
+		startKey := data_model.Key{ID: startKeyId, KeyBytes: privateStartKeyBytes, Type: global.KEY_TYPE_PRIVATE}
+		targetKey2 := data_model.Key{ID: targetKeyId + "_2", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+		err = AddAccess(stub, startKey, targetKey2)
+		test_utils.AssertTrue(t, err == nil, "Expected AddAccess to succeed")
+		mstub.MockTransactionEnd("t1")
+
+		mstub.MockTransactionStart("t2")
+		stub = cached_stub.NewCachedStub(mstub)
+		keyGraphEdgeBytes, _, _ := graph.GetEdge(stub, global.KEY_GRAPH_PREFIX, startKeyId, targetKeyId)
+		edge := keyGraphEdge{}
+		json.Unmarshal([]byte(keyGraphEdgeBytes), &edge)
+		test_utils.AssertTrue(t, edge.EncryptedTargetKey[0] == crypto.PUBLIC_KEY_HEADER_ECIES, "Expected ECIES header")
+		startKeyNode, _ := getKeyGraphNode(stub, startKeyId)
+		test_utils.AssertTrue(t, bytes.Equal(startKeyNode.PublicKey, publicEncKeyBytes), "incorrect startKey public key")
+
+		result, err := GetKey(stub, []string{startKeyId, targetKeyId}, privateStartKeyBytes)
+		test_utils.AssertTrue(t, err == nil, "Expected GetKey to succeed")
+		test_utils.AssertTrue(t, bytes.Equal(targetKey, result), "Expected to get target key")
+		result, err = GetKey(stub, []string{startKeyId, targetKey2.ID}, privateStartKeyBytes)
+		test_utils.AssertTrue(t, err == nil && bytes.Equal(targetKey2.KeyBytes, result), "Expected to get target key")
+		mstub.MockTransactionEnd("t2")
+	}
+}
+
+func TestRotateKeys(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestRotateKeys function called")
+
+	mstub := test_utils.CreateNewMockStub(t)
+
+	// parent (RSA, OAEP) -> key; parentSym -> key; key -> child; key -> childSym -> key
+	parentPrivateKeyBytes := crypto.PrivateKeyToBytes(test_utils.GeneratePrivateKey())
+	parent := data_model.Key{ID: "parent", KeyBytes: parentPrivateKeyBytes, Type: global.KEY_TYPE_PRIVATE}
+	parentSym := data_model.Key{ID: "parentSym", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	oldKey := data_model.Key{ID: "key", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	child := data_model.Key{ID: "child", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	childSym := data_model.Key{ID: "childSym", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	newKey := data_model.Key{ID: "key", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	err := AddAccess(stub, parent, oldKey, map[string]string{global.EDGEDATA_ENCRYPTION_SCHEME: global.ENCRYPTION_SCHEME_OAEP})
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess to succeed")
+	err = AddAccess(stub, parentSym, oldKey)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess to succeed")
+	err = AddAccess(stub, oldKey, child, map[string]string{"type": "test"})
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess to succeed")
+	err = AddAccess(stub, oldKey, childSym)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess to succeed")
+	err = AddAccess(stub, childSym, oldKey)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	// parentSym is not reachable from key, so the incoming edge cannot be re-encrypted
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = RotateKeys(stub, []data_model.Key{oldKey}, []data_model.Key{newKey})
+	test_utils.AssertTrue(t, err != nil, "Expected RotateKeys to fail")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = RevokeAccess(stub, parentSym.ID, oldKey.ID)
+	test_utils.AssertTrue(t, err == nil, "Expected RevokeAccess to succeed")
+	mstub.MockTransactionEnd("t3")
+
+	// invalid input
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = RotateKeys(stub, []data_model.Key{newKey}, []data_model.Key{oldKey})
+	test_utils.AssertTrue(t, err != nil, "Expected RotateKeys with wrong old key to fail")
+	err = RotateKeys(stub, []data_model.Key{oldKey}, []data_model.Key{{ID: "other", KeyBytes: newKey.KeyBytes, Type: global.KEY_TYPE_SYM}})
+	test_utils.AssertTrue(t, err != nil, "Expected RotateKeys with different key id to fail")
+	err = RotateKeys(stub, []data_model.Key{oldKey}, []data_model.Key{})
+	test_utils.AssertTrue(t, err != nil, "Expected RotateKeys with missing new key to fail")
+	mstub.MockTransactionEnd("t4")
+
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = RotateKeys(stub, []data_model.Key{oldKey}, []data_model.Key{newKey})
+	test_utils.AssertTrue(t, err == nil, "Expected RotateKeys to succeed")
+	mstub.MockTransactionEnd("t5")
+
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	valid, err := ValidateKey(stub, newKey, true)
+	test_utils.AssertTrue(t, err == nil && valid, "Expected new key to be valid")
+	result, err := GetKey(stub, []string{parent.ID, newKey.ID}, parent.KeyBytes)
+	test_utils.AssertTrue(t, err == nil && bytes.Equal(result, newKey.KeyBytes), "Expected to get new key from parent")
+	_, edgeData, _ := GetAccessEdge(stub, parent.ID, newKey.ID)
+	test_utils.AssertTrue(t, edgeData[global.EDGEDATA_ENCRYPTION_SCHEME] == global.ENCRYPTION_SCHEME_OAEP, "Expected encryption scheme to be preserved")
+	result, err = GetKey(stub, []string{newKey.ID, child.ID}, newKey.KeyBytes)
+	test_utils.AssertTrue(t, err == nil && bytes.Equal(result, child.KeyBytes), "Expected to get child key with new key")
+	_, edgeData, _ = GetAccessEdge(stub, newKey.ID, child.ID)
+	test_utils.AssertTrue(t, edgeData["type"] == "test", "Expected edge data to be preserved")
+	result, err = GetKey(stub, []string{childSym.ID, newKey.ID}, childSym.KeyBytes)
+	test_utils.AssertTrue(t, err == nil && bytes.Equal(result, newKey.KeyBytes), "Expected to get new key from childSym")
+	_, err = GetKey(stub, []string{oldKey.ID, child.ID}, oldKey.KeyBytes)
+	test_utils.AssertTrue(t, err != nil, "Expected GetKey with old key to fail")
+	mstub.MockTransactionEnd("t6")
+}
+
+func TestReplaceKey(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	logger.Info("TestReplaceKey function called")
+
+	mstub := test_utils.CreateNewMockStub(t)
+
+	// parent (RSA, OAEP) -> key; parentSym -> key; key -> child
+	parentPrivateKeyBytes := crypto.PrivateKeyToBytes(test_utils.GeneratePrivateKey())
+	parent := data_model.Key{ID: "parent", KeyBytes: parentPrivateKeyBytes, Type: global.KEY_TYPE_PRIVATE}
+	parentSym := data_model.Key{ID: "parentSym", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	oldKey := data_model.Key{ID: "key", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	child := data_model.Key{ID: "child", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	newKey := data_model.Key{ID: "newKey", KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	err := AddAccess(stub, parent, oldKey, map[string]string{global.EDGEDATA_ENCRYPTION_SCHEME: global.ENCRYPTION_SCHEME_OAEP})
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess to succeed")
+	err = AddAccess(stub, parentSym, oldKey, map[string]string{"type": "sym"})
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess to succeed")
+	err = AddAccess(stub, oldKey, child, map[string]string{"type": "test"})
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	// invalid input
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = ReplaceKey(stub, oldKey, newKey)
+	test_utils.AssertTrue(t, err != nil, "Expected ReplaceKey without parentSym key to fail")
+	err = ReplaceKey(stub, newKey, oldKey, parentSym)
+	test_utils.AssertTrue(t, err != nil, "Expected ReplaceKey with wrong old key to fail")
+	err = ReplaceKey(stub, oldKey, data_model.Key{ID: newKey.ID, KeyBytes: []byte("invalid"), Type: global.KEY_TYPE_SYM}, parentSym)
+	test_utils.AssertTrue(t, err != nil, "Expected ReplaceKey with invalid new key to fail")
+	err = ReplaceKey(stub, oldKey, data_model.Key{ID: child.ID, KeyBytes: newKey.KeyBytes, Type: global.KEY_TYPE_SYM}, parentSym)
+	test_utils.AssertTrue(t, err != nil, "Expected ReplaceKey with existing new key id to fail")
+	err = ReplaceKey(stub, parent, newKey, parentSym)
+	test_utils.AssertTrue(t, err != nil, "Expected ReplaceKey of private key to fail")
+	mstub.MockTransactionEnd("t2")
+
+	// replace key with a new key id
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = ReplaceKey(stub, oldKey, newKey, parentSym)
+	test_utils.AssertTrue(t, err == nil, "Expected ReplaceKey to succeed")
+	mstub.MockTransactionEnd("t3")
+
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	result, err := GetKey(stub, []string{parent.ID, newKey.ID}, parent.KeyBytes)
+	test_utils.AssertTrue(t, err == nil && bytes.Equal(result, newKey.KeyBytes), "Expected to get new key from parent")
+	_, edgeData, _ := GetAccessEdge(stub, parent.ID, newKey.ID)
+	test_utils.AssertTrue(t, edgeData[global.EDGEDATA_ENCRYPTION_SCHEME] == global.ENCRYPTION_SCHEME_OAEP, "Expected encryption scheme to be preserved")
+	result, err = GetKey(stub, []string{parentSym.ID, newKey.ID}, parentSym.KeyBytes)
+	test_utils.AssertTrue(t, err == nil && bytes.Equal(result, newKey.KeyBytes), "Expected to get new key from parentSym")
+	result, err = GetKey(stub, []string{newKey.ID, child.ID}, newKey.KeyBytes)
+	test_utils.AssertTrue(t, err == nil && bytes.Equal(result, child.KeyBytes), "Expected to get child key with new key")
+	_, edgeData, _ = GetAccessEdge(stub, newKey.ID, child.ID)
+	test_utils.AssertTrue(t, edgeData["type"] == "test", "Expected edge data to be preserved")
+	hasPath, _ := VerifyAccessPath(stub, []string{parent.ID, oldKey.ID})
+	test_utils.AssertTrue(t, !hasPath, "Expected edge from parent to old key to be removed")
+	hasPath, _ = VerifyAccessPath(stub, []string{oldKey.ID, child.ID})
+	test_utils.AssertTrue(t, !hasPath, "Expected edge from old key to child to be removed")
+	mstub.MockTransactionEnd("t4")
+
+	// replace key bytes and keep the key id
+	rotatedKey := data_model.Key{ID: newKey.ID, KeyBytes: test_utils.GenerateSymKey(), Type: global.KEY_TYPE_SYM}
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = ReplaceKey(stub, newKey, rotatedKey, parentSym)
+	test_utils.AssertTrue(t, err == nil, "Expected ReplaceKey to succeed")
+	mstub.MockTransactionEnd("t5")
+
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	valid, err := ValidateKey(stub, rotatedKey, true)
+	test_utils.AssertTrue(t, err == nil && valid, "Expected rotated key to be valid")
+	result, err = GetKey(stub, []string{parent.ID, rotatedKey.ID}, parent.KeyBytes)
+	test_utils.AssertTrue(t, err == nil && bytes.Equal(result, rotatedKey.KeyBytes), "Expected to get rotated key from parent")
+	result, err = GetKey(stub, []string{rotatedKey.ID, child.ID}, rotatedKey.KeyBytes)
+	test_utils.AssertTrue(t, err == nil && bytes.Equal(result, child.KeyBytes), "Expected to get child key with rotated key")
+	mstub.MockTransactionEnd("t6")
+}
+
 // Tests the errors in AddAccess
 func TestAddAccess_error(t *testing.T) {
 	logger.SetLevel(shim.LogDebug)
@@ -14,6 +14,8 @@ import (
 	"common/bchcls/data_model"
 	"common/bchcls/internal/key_mgmt_i/key_mgmt_c"
 	"common/bchcls/internal/key_mgmt_i/key_mgmt_c/key_mgmt_g"
+	"common/bchcls/internal/key_mgmt_i/key_provider_c"
+	"common/bchcls/key_mgmt/key_provider"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 )
@@ -73,6 +75,23 @@ func UpdateAccessEdge(stub cached_stub.CachedStubInterface, startKeyId string, t
 	}
 }
 
+// RotateKeys replaces the key bytes of existing key graph nodes while keeping their key IDs.
+// All incoming and outgoing edges of the rotated keys are re-encrypted.
+func RotateKeys(stub cached_stub.CachedStubInterface, oldKeys []data_model.Key, newKeys []data_model.Key) error {
+	return key_mgmt_c.RotateKeys(stub, oldKeys, newKeys)
+}
+
+// ReplaceKey replaces the sym key oldKey with newKey in the key graph. newKey can have a new ID.
+// All incoming and outgoing edges of oldKey are re-encrypted; startKeys are the sym keys of incoming edges.
+func ReplaceKey(stub cached_stub.CachedStubInterface, oldKey data_model.Key, newKey data_model.Key, startKeys ...data_model.Key) error {
+	return key_mgmt_c.ReplaceKey(stub, oldKey, newKey, startKeys...)
+}
+
+// DeleteKey removes the key graph node of keyId. It must only be used for keys whose edges were moved by ReplaceKey.
+func DeleteKey(stub cached_stub.CachedStubInterface, keyId string) error {
+	return key_mgmt_c.DeleteKey(stub, keyId)
+}
+
 // SlowVerifyAccess checks for a path in the graph from startKeyId to targetKeyId.
 // Uses recursive DFS.
 // Returns the list of keyIds in the path.
@@ -164,6 +183,11 @@ func GetKeyIdForWriteOnlyAccess(assetId string, assetKeyId string, ownerId strin
 	return key_mgmt_c.GetKeyIdForWriteOnlyAccess(assetId, assetKeyId, ownerId)
 }
 
+// GetKeyIdForFieldAccess returns the ID of the key of a private data field of a field encrypted asset.
+func GetKeyIdForFieldAccess(assetId string, assetKeyId string, fieldName string) string {
+	return key_mgmt_c.GetKeyIdForFieldAccess(assetId, assetKeyId, fieldName)
+}
+
 // GetPubPrivKeyId returns the ID that should be assigned to a public or private key.
 func GetPubPrivKeyId(id string) string {
 	return key_mgmt_g.GetPubPrivKeyId(id)
@@ -183,3 +207,14 @@ func GetLogSymKeyId(id string) string {
 func GetPrivateKeyHashSymKeyId(id string) string {
 	return key_mgmt_g.GetPrivateKeyHashSymKeyId(id)
 }
+
+// RegisterKeyProviderImpl registers a KeyProviderInterface implementation as providerType.
+// It must only be called by the solution's own code at startup, never on behalf of a transaction's caller.
+func RegisterKeyProviderImpl(providerType string, implementation key_provider.KeyProviderInterface) error {
+	return key_provider_c.RegisterKeyProviderImpl(providerType, implementation)
+}
+
+// GetKeyByKmsId returns the key bytes of the key identified by kmsKeyId from the registered key provider.
+func GetKeyByKmsId(stub cached_stub.CachedStubInterface, kmsKeyId string) ([]byte, error) {
+	return key_provider_c.GetKeyByKmsId(stub, kmsKeyId)
+}
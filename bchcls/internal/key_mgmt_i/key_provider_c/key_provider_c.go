@@ -0,0 +1,67 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package key_provider_c
+
+import (
+	"common/bchcls/cached_stub"
+	"common/bchcls/key_mgmt/key_provider"
+	"common/bchcls/utils"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
+)
+
+var logger = shim.NewLogger("key_provider_c")
+
+// keyProviderImplementationMap Maps providerType -> KeyProviderInterface Impl
+var keyProviderImplementationMap = make(map[string]key_provider.KeyProviderInterface)
+
+// RegisterKeyProviderImpl registers a KeyProviderInterface implementation as providerType.
+func RegisterKeyProviderImpl(providerType string, implementation key_provider.KeyProviderInterface) error {
+	if len(providerType) == 0 || implementation == nil {
+		return errors.New("Key provider type and implementation are required")
+	}
+	if _, ok := keyProviderImplementationMap[providerType]; ok {
+		return errors.New(providerType + " key provider type is already added")
+	}
+
+	keyProviderImplementationMap[providerType] = implementation
+	return nil
+}
+
+// GetKeyByKmsId returns the key bytes of the key identified by kmsKeyId from the registered key provider.
+func GetKeyByKmsId(stub cached_stub.CachedStubInterface, kmsKeyId string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	providerType, keyId, err := key_provider.ParseKmsKeyId(kmsKeyId)
+	if err != nil {
+		logger.Errorf("%v", err)
+		return nil, err
+	}
+	implementation, ok := keyProviderImplementationMap[providerType]
+	if !ok {
+		logger.Errorf("Key provider type %v is not registered", providerType)
+		return nil, errors.Errorf("Key provider type %v is not registered", providerType)
+	}
+	if !implementation.IsReady() {
+		logger.Errorf("Key provider %v is not ready", providerType)
+		return nil, errors.Errorf("Key provider %v is not ready", providerType)
+	}
+	keyBytes, err := implementation.GetKey(stub, keyId)
+	if err != nil {
+		logger.Errorf("Failed to get key %v: %v", kmsKeyId, err)
+		return nil, errors.Wrapf(err, "Failed to get key %v", kmsKeyId)
+	}
+	if len(keyBytes) == 0 {
+		logger.Errorf("Key %v is empty", kmsKeyId)
+		return nil, errors.Errorf("Key %v is empty", kmsKeyId)
+	}
+	return keyBytes, nil
+}
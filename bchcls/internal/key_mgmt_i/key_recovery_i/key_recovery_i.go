@@ -0,0 +1,409 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+// Package key_recovery_i splits a user's private key among guardians and recovers it from their shares.
+//
+// Key graph for user "u" and guardian "g"
+//      g.pri -> s.sym
+//      s.sym -> shareAsset
+package key_recovery_i
+
+import (
+	"common/bchcls/cached_stub"
+	"common/bchcls/crypto"
+	"common/bchcls/custom_errors"
+	"common/bchcls/data_model"
+	"common/bchcls/internal/asset_mgmt_i"
+	"common/bchcls/internal/common/global"
+	"common/bchcls/internal/key_mgmt_i"
+	"common/bchcls/internal/user_mgmt_i"
+	"common/bchcls/utils"
+
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
+)
+
+var logger = shim.NewLogger("key_recovery_i")
+
+// SetupKeyRecovery stores one share of the private key of user userId for each guardian.
+// shares[i] is the share of guardianIds[i]. The shares must be created by the client with crypto.SplitSecret,
+// since shares created in the chaincode would differ between endorsers. They are checked against the user's
+// private key before they are saved.
+// Each share is stored as an asset owned by the user, and only the guardian is given access to the share's asset key.
+// The share's asset key is derived from the share, and its ID is unique to the transaction, so the keys of
+// earlier shares are not reused. If key recovery was set up before, the shares are replaced, and the shares of
+// guardians who are no longer in guardianIds are deleted.
+// Caller must be the user or must have access to the user's private key.
+func SetupKeyRecovery(stub cached_stub.CachedStubInterface, caller data_model.User, userId string, guardianIds []string, threshold int, shares [][]byte) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerId: %v, userId: %v, guardianIds: %v, threshold: %v, shares: %v", caller.ID, userId, guardianIds, threshold, len(shares))
+
+	if threshold < 2 || len(guardianIds) < threshold || len(guardianIds) > crypto.MAX_SECRET_SHARES {
+		logger.Errorf("Invalid threshold %v for %v guardians", threshold, len(guardianIds))
+		return errors.Errorf("Invalid threshold %v for %v guardians", threshold, len(guardianIds))
+	}
+	if len(shares) != len(guardianIds) {
+		logger.Errorf("Expected %v shares, got %v", len(guardianIds), len(shares))
+		return errors.Errorf("Expected %v shares, got %v", len(guardianIds), len(shares))
+	}
+
+	// get user with keys
+	user, err := user_mgmt_i.GetUserData(stub, caller, userId, true, false)
+	if err != nil {
+		custom_err := &custom_errors.GetUserError{ID: userId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	if len(user.ID) == 0 {
+		custom_err := &custom_errors.GetUserError{ID: userId}
+		logger.Errorf("%v", custom_err)
+		return errors.WithStack(custom_err)
+	}
+	if len(user.PrivateKeyB64) == 0 {
+		logger.Errorf("Caller %v does not have access to the private key of user %v", caller.ID, userId)
+		return errors.New("Caller does not have access to the user's private key")
+	}
+
+	err = validateShares(user.GetPrivateKey().KeyBytes, shares, threshold)
+	if err != nil {
+		logger.Errorf("Invalid key recovery shares: %v", err)
+		return errors.Wrap(err, "Invalid key recovery shares")
+	}
+
+	// get guardians' public keys
+	guardianKeys := []data_model.Key{}
+	guardianMap := make(map[string]bool)
+	for _, guardianId := range guardianIds {
+		if guardianId == userId || guardianMap[guardianId] {
+			logger.Errorf("Invalid guardian \"%v\"", guardianId)
+			return errors.Errorf("Invalid guardian \"%v\"", guardianId)
+		}
+		guardianMap[guardianId] = true
+		guardianKey, err := user_mgmt_i.GetUserPublicKey(stub, caller, guardianId)
+		if err != nil {
+			logger.Errorf("Failed to get public key of guardian \"%v\": %v", guardianId, err)
+			return errors.Wrapf(err, "Failed to get public key of guardian \"%v\"", guardianId)
+		}
+		guardianKeys = append(guardianKeys, guardianKey)
+	}
+
+	// revoke guardians' access to previous shares, and delete shares of previous guardians
+	am := asset_mgmt_i.GetAssetManager(stub, caller)
+	prevPolicy, err := GetKeyRecoveryPolicy(stub, userId)
+	if err != nil {
+		return err
+	}
+	for _, guardianId := range prevPolicy.GuardianIDs {
+		assetId := GetKeyRecoveryShareAssetId(userId, guardianId)
+		prevAsset, err := asset_mgmt_i.GetEncryptedAssetData(stub, assetId)
+		if err != nil {
+			custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+		if len(prevAsset.AssetId) == 0 {
+			continue
+		}
+		err = key_mgmt_i.RevokeAccess(stub, key_mgmt_i.GetPubPrivKeyId(guardianId), prevAsset.AssetKeyId)
+		if err != nil {
+			logger.Errorf("Failed to revoke access of guardian \"%v\": %v", guardianId, err)
+			return errors.Wrapf(err, "Failed to revoke access of guardian \"%v\"", guardianId)
+		}
+		if guardianMap[guardianId] {
+			continue
+		}
+
+		// the previous share key can't be read, so the share is overwritten with an empty share first
+		deleteKey := data_model.Key{ID: getShareKeyId(stub, userId, guardianId), Type: global.KEY_TYPE_SYM}
+		deleteKey.KeyBytes = crypto.GetSymKeyFromHash([]byte(deleteKey.ID))
+		emptyAsset, err := getShareAsset(prevAsset, userId, guardianId, nil)
+		if err != nil {
+			return err
+		}
+		err = asset_mgmt_i.ReplaceAssetKey(stub, emptyAsset, deleteKey)
+		if err == nil {
+			err = am.DeleteAsset(assetId, deleteKey)
+		}
+		if err != nil {
+			logger.Errorf("Failed to delete key recovery share of guardian \"%v\": %v", guardianId, err)
+			return errors.Wrapf(err, "Failed to delete key recovery share of guardian \"%v\"", guardianId)
+		}
+	}
+
+	// save shares
+	edgeData := make(map[string]string)
+	edgeData[global.EDGEDATA_ACCESS_TYPE] = global.ACCESS_READ
+	for i, guardianId := range guardianIds {
+		shareKey := data_model.Key{ID: getShareKeyId(stub, userId, guardianId), Type: global.KEY_TYPE_SYM}
+		shareKey.KeyBytes = crypto.GetSymKeyFromHash(shares[i])
+		err = key_mgmt_i.AddAccess(stub, guardianKeys[i], shareKey, edgeData)
+		if err != nil {
+			custom_err := &custom_errors.AddAccessError{Key: shareKey.ID}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+
+		assetId := GetKeyRecoveryShareAssetId(userId, guardianId)
+		prevAsset, err := asset_mgmt_i.GetEncryptedAssetData(stub, assetId)
+		if err != nil {
+			custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
+			logger.Errorf("%v: %v", custom_err, err)
+			return errors.Wrap(err, custom_err.Error())
+		}
+		asset := data_model.Asset{}
+		asset.AssetId = assetId
+		asset.AssetKeyId = shareKey.ID
+		asset.AssetKeyHash = crypto.Hash(shareKey.KeyBytes)
+		asset.OwnerIds = []string{userId}
+		asset.Metadata = make(map[string]string)
+		asset, err = getShareAsset(asset, userId, guardianId, shares[i])
+		if err != nil {
+			return err
+		}
+		if len(prevAsset.AssetId) > 0 {
+			err = asset_mgmt_i.ReplaceAssetKey(stub, asset, shareKey)
+		} else {
+			err = am.UpdateAsset(asset, shareKey, false)
+		}
+		if err != nil {
+			logger.Errorf("Failed to save key recovery share of guardian \"%v\": %v", guardianId, err)
+			return errors.Wrapf(err, "Failed to save key recovery share of guardian \"%v\"", guardianId)
+		}
+	}
+
+	// save policy
+	policy := data_model.KeyRecoveryPolicy{
+		UserID:        userId,
+		GuardianIDs:   guardianIds,
+		Threshold:     threshold,
+		PublicKeyHash: crypto.Hash(user.GetPublicKey().KeyBytes),
+	}
+	return putKeyRecoveryPolicy(stub, policy)
+}
+
+// GetKeyRecoveryPolicy returns the key recovery policy of a user.
+// Returns an empty policy if key recovery was not set up for the user.
+func GetKeyRecoveryPolicy(stub cached_stub.CachedStubInterface, userId string) (data_model.KeyRecoveryPolicy, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	policy := data_model.KeyRecoveryPolicy{}
+	ledgerKey, err := getKeyRecoveryPolicyLedgerKey(stub, userId)
+	if err != nil {
+		return policy, err
+	}
+	policyBytes, err := stub.GetState(ledgerKey)
+	if err != nil {
+		custom_err := &custom_errors.GetLedgerError{LedgerKey: ledgerKey, LedgerItem: "KeyRecoveryPolicy"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return policy, errors.Wrap(err, custom_err.Error())
+	}
+	if len(policyBytes) == 0 {
+		return policy, nil
+	}
+	err = json.Unmarshal(policyBytes, &policy)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "KeyRecoveryPolicy"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return policy, errors.Wrap(err, custom_err.Error())
+	}
+	return policy, nil
+}
+
+// GetKeyRecoveryShare returns the caller's share of the private key of user userId.
+// Caller must be a guardian of the user.
+func GetKeyRecoveryShare(stub cached_stub.CachedStubInterface, caller data_model.User, userId string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerId: %v, userId: %v", caller.ID, userId)
+
+	assetId := GetKeyRecoveryShareAssetId(userId, caller.ID)
+	am := asset_mgmt_i.GetAssetManager(stub, caller)
+	encryptedAsset, err := asset_mgmt_i.GetEncryptedAssetData(stub, assetId)
+	if err != nil {
+		custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	if len(encryptedAsset.AssetId) == 0 {
+		custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
+		logger.Errorf("%v", custom_err)
+		return nil, errors.WithStack(custom_err)
+	}
+	shareKey, err := am.GetAssetKey(assetId, []string{caller.GetPubPrivKeyId(), encryptedAsset.AssetKeyId})
+	if err != nil {
+		logger.Errorf("Failed to get key recovery share key: %v", err)
+		return nil, errors.Wrap(err, "Failed to get key recovery share key")
+	}
+	asset, err := am.GetAsset(assetId, shareKey)
+	if err != nil || len(asset.AssetId) == 0 {
+		custom_err := &custom_errors.GetAssetDataError{AssetId: assetId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	share := data_model.KeyRecoveryShare{}
+	err = json.Unmarshal(asset.PrivateData, &share)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "KeyRecoveryShare"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	return share.Share, nil
+}
+
+// RecoverUserPrivateKey combines guardians' shares to recover the private key of user userId.
+// The recovered private key must match the user's current public key.
+// Returns the user with the recovered private, public, and sym keys, which can be used as the caller
+// to rotate the user's keys.
+func RecoverUserPrivateKey(stub cached_stub.CachedStubInterface, caller data_model.User, userId string, shares [][]byte) (data_model.User, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerId: %v, userId: %v, shares: %v", caller.ID, userId, len(shares))
+
+	policy, err := GetKeyRecoveryPolicy(stub, userId)
+	if err != nil {
+		return data_model.User{}, err
+	}
+	if len(policy.UserID) == 0 {
+		logger.Errorf("Key recovery is not set up for user %v", userId)
+		return data_model.User{}, errors.Errorf("Key recovery is not set up for user %v", userId)
+	}
+	if len(shares) < policy.Threshold {
+		logger.Errorf("At least %v shares are required", policy.Threshold)
+		return data_model.User{}, errors.Errorf("At least %v shares are required", policy.Threshold)
+	}
+
+	publicKey, err := user_mgmt_i.GetUserPublicKey(stub, caller, userId)
+	if err != nil {
+		custom_err := &custom_errors.GetUserError{ID: userId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return data_model.User{}, errors.Wrap(err, custom_err.Error())
+	}
+	if !bytes.Equal(policy.PublicKeyHash, crypto.Hash(publicKey.KeyBytes)) {
+		logger.Errorf("Key recovery shares of user %v are out of date", userId)
+		return data_model.User{}, errors.New("Key recovery shares are out of date: the user's keys were rotated after key recovery was set up")
+	}
+
+	privateKeyBytes, err := crypto.CombineShares(shares)
+	if err != nil {
+		logger.Errorf("Failed to combine shares: %v", err)
+		return data_model.User{}, errors.Wrap(err, "Failed to combine shares")
+	}
+	derivedPublicKeyBytes, err := crypto.GetPublicKeyBytesFromPrivateKey(privateKeyBytes)
+	if err != nil || !bytes.Equal(derivedPublicKeyBytes, publicKey.KeyBytes) {
+		logger.Errorf("Recovered private key does not match the public key of user %v", userId)
+		return data_model.User{}, errors.New("Recovered private key does not match the user's public key")
+	}
+
+	user := data_model.User{ID: userId}
+	user.PrivateKeyB64 = crypto.EncodeToB64String(privateKeyBytes)
+	user.PublicKeyB64 = crypto.EncodeToB64String(publicKey.KeyBytes)
+	if privateKey, err := crypto.ParseAnyPrivateKey(privateKeyBytes); err == nil {
+		if rsaPrivateKey, ok := privateKey.(*rsa.PrivateKey); ok {
+			user.PrivateKey = rsaPrivateKey
+			user.PublicKey = &rsaPrivateKey.PublicKey
+		}
+	}
+
+	// get sym key with the recovered private key
+	symKeyBytes, err := key_mgmt_i.GetKey(stub, []string{user.GetPubPrivKeyId(), user.GetSymKeyId()}, privateKeyBytes)
+	if err != nil {
+		logger.Errorf("Failed to get sym key of user %v: %v", userId, err)
+		return data_model.User{}, errors.Wrapf(err, "Failed to get sym key of user %v", userId)
+	}
+	user.SymKey = symKeyBytes
+	user.SymKeyB64 = crypto.EncodeToB64String(symKeyBytes)
+	logger.Infof("Successfully recovered private key of user %v", userId)
+	return user, nil
+}
+
+// GetKeyRecoveryShareAssetId returns the asset ID of a guardian's key recovery share.
+func GetKeyRecoveryShareAssetId(userId string, guardianId string) string {
+	return asset_mgmt_i.GetAssetId(global.KEY_RECOVERY_SHARE_ASSET_NAMESPACE, userId+"-"+guardianId)
+}
+
+// getShareKeyId returns the ID of the asset key of a guardian's key recovery share.
+// The ID includes the transaction ID, since the key is derived from the share, and the share changes
+// each time key recovery is set up.
+func getShareKeyId(stub cached_stub.CachedStubInterface, userId string, guardianId string) string {
+	return global.KEY_PREFIX_RECOVERY_SHARE + "-" + userId + "-" + guardianId + "-" + stub.GetTxID()
+}
+
+// getShareAsset sets the public and private data of a guardian's key recovery share asset.
+func getShareAsset(asset data_model.Asset, userId string, guardianId string, shareBytes []byte) (data_model.Asset, error) {
+	share := data_model.KeyRecoveryShare{UserID: userId, GuardianID: guardianId}
+	publicBytes, err := json.Marshal(&share)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "KeyRecoveryShare"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return asset, errors.Wrap(err, custom_err.Error())
+	}
+	share.Share = shareBytes
+	privateBytes, err := json.Marshal(&share)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "KeyRecoveryShare"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return asset, errors.Wrap(err, custom_err.Error())
+	}
+	asset.PublicData = publicBytes
+	asset.PrivateData = privateBytes
+	return asset, nil
+}
+
+// validateShares checks that shares were split from privateKey with the given threshold.
+// Each run of threshold consecutive shares (wrapping around) must combine to privateKey. Two neighbouring
+// runs share threshold-1 points and the secret, so they define the same polynomial, which means every
+// share lies on it.
+func validateShares(privateKey []byte, shares [][]byte, threshold int) error {
+	for i := range shares {
+		run := [][]byte{}
+		for j := 0; j < threshold; j++ {
+			run = append(run, shares[(i+j)%len(shares)])
+		}
+		secret, err := crypto.CombineShares(run)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(secret, privateKey) {
+			return errors.New("Shares do not combine to the user's private key")
+		}
+	}
+	return nil
+}
+
+func putKeyRecoveryPolicy(stub cached_stub.CachedStubInterface, policy data_model.KeyRecoveryPolicy) error {
+	ledgerKey, err := getKeyRecoveryPolicyLedgerKey(stub, policy.UserID)
+	if err != nil {
+		return err
+	}
+	policyBytes, err := json.Marshal(&policy)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "KeyRecoveryPolicy"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	err = stub.PutState(ledgerKey, policyBytes)
+	if err != nil {
+		custom_err := &custom_errors.PutLedgerError{LedgerKey: ledgerKey}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	return nil
+}
+
+func getKeyRecoveryPolicyLedgerKey(stub cached_stub.CachedStubInterface, userId string) (string, error) {
+	ledgerKey, err := stub.CreateCompositeKey(global.KEY_RECOVERY_PREFIX, []string{userId})
+	if err != nil {
+		custom_err := &custom_errors.CreateCompositeKeyError{Type: global.KEY_RECOVERY_PREFIX}
+		logger.Errorf("%v: %v", custom_err, err)
+		return "", errors.Wrap(err, custom_err.Error())
+	}
+	return ledgerKey, nil
+}
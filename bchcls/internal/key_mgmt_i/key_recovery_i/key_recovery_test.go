@@ -0,0 +1,180 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package key_recovery_i
+
+import (
+	"common/bchcls/cached_stub"
+	"common/bchcls/crypto"
+	"common/bchcls/data_model"
+	"common/bchcls/internal/asset_mgmt_i"
+	"common/bchcls/internal/common/global"
+	"common/bchcls/internal/datastore_i"
+	"common/bchcls/internal/datatype_i"
+	"common/bchcls/internal/key_mgmt_i"
+	"common/bchcls/internal/user_mgmt_i"
+	"common/bchcls/test_utils"
+
+	"bytes"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func setup(t *testing.T) *test_utils.NewMockStub {
+	mstub := test_utils.CreateNewMockStub(t)
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	user_mgmt_i.Init(stub)
+	asset_mgmt_i.Init(stub)
+	datatype_i.Init(stub)
+	datastore_i.Init(stub)
+	mstub.MockTransactionEnd("t1")
+	logger.SetLevel(shim.LogDebug)
+	return mstub
+}
+
+func TestKeyRecovery(t *testing.T) {
+	logger.Info("TestKeyRecovery function called")
+
+	mstub := setup(t)
+
+	user := test_utils.CreateTestUser("user1")
+	guardian1 := test_utils.CreateTestUser("guardian1")
+	guardian2 := test_utils.CreateTestUser("guardian2")
+	guardian3 := test_utils.CreateTestUserWithKeyType("guardian3", global.KEY_TYPE_EC_P256)
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	for _, u := range []data_model.User{user, guardian1, guardian2, guardian3} {
+		err := user_mgmt_i.RegisterUserWithParams(stub, u, u, false)
+		test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	}
+	mstub.MockTransactionEnd("t1")
+
+	guardianIds := []string{guardian1.ID, guardian2.ID, guardian3.ID}
+
+	// shares are created by the client
+	userPrivateKey := user.GetPrivateKey().KeyBytes
+	userShares, err := crypto.SplitSecret(userPrivateKey, 3, 2)
+	test_utils.AssertTrue(t, err == nil, "Expected SplitSecret to succeed")
+	userShares2, err := crypto.SplitSecret(userPrivateKey, 2, 2)
+	test_utils.AssertTrue(t, err == nil, "Expected SplitSecret to succeed")
+	otherShares, err := crypto.SplitSecret(guardian1.GetPrivateKey().KeyBytes, 3, 2)
+	test_utils.AssertTrue(t, err == nil, "Expected SplitSecret to succeed")
+
+	// invalid setup
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = SetupKeyRecovery(stub, user, user.ID, guardianIds, 1, userShares)
+	test_utils.AssertTrue(t, err != nil, "Expected SetupKeyRecovery with threshold 1 to fail")
+	err = SetupKeyRecovery(stub, user, user.ID, guardianIds, 4, userShares)
+	test_utils.AssertTrue(t, err != nil, "Expected SetupKeyRecovery with threshold larger than guardians to fail")
+	err = SetupKeyRecovery(stub, user, user.ID, []string{guardian1.ID, user.ID}, 2, userShares2)
+	test_utils.AssertTrue(t, err != nil, "Expected SetupKeyRecovery with user as guardian to fail")
+	err = SetupKeyRecovery(stub, user, user.ID, []string{guardian1.ID, guardian1.ID}, 2, userShares2)
+	test_utils.AssertTrue(t, err != nil, "Expected SetupKeyRecovery with duplicate guardians to fail")
+	err = SetupKeyRecovery(stub, user, user.ID, []string{guardian1.ID, "unknown"}, 2, userShares2)
+	test_utils.AssertTrue(t, err != nil, "Expected SetupKeyRecovery with unknown guardian to fail")
+	err = SetupKeyRecovery(stub, guardian1, user.ID, guardianIds, 2, userShares)
+	test_utils.AssertTrue(t, err != nil, "Expected SetupKeyRecovery without access to user's keys to fail")
+	err = SetupKeyRecovery(stub, user, user.ID, guardianIds, 2, userShares2)
+	test_utils.AssertTrue(t, err != nil, "Expected SetupKeyRecovery with too few shares to fail")
+	err = SetupKeyRecovery(stub, user, user.ID, guardianIds, 2, otherShares)
+	test_utils.AssertTrue(t, err != nil, "Expected SetupKeyRecovery with shares of another key to fail")
+	err = SetupKeyRecovery(stub, user, user.ID, guardianIds, 2, [][]byte{userShares[0], userShares[1], otherShares[2]})
+	test_utils.AssertTrue(t, err != nil, "Expected SetupKeyRecovery with one invalid share to fail")
+	mstub.MockTransactionEnd("t2")
+
+	// setup
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = SetupKeyRecovery(stub, user, user.ID, guardianIds, 2, userShares)
+	test_utils.AssertTrue(t, err == nil, "Expected SetupKeyRecovery to succeed")
+	mstub.MockTransactionEnd("t3")
+
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	policy, err := GetKeyRecoveryPolicy(stub, user.ID)
+	test_utils.AssertTrue(t, err == nil, "Expected GetKeyRecoveryPolicy to succeed")
+	test_utils.AssertTrue(t, policy.Threshold == 2 && len(policy.GuardianIDs) == 3, "Expected policy to be saved")
+
+	// guardians get their shares
+	shares := [][]byte{}
+	for _, guardian := range []data_model.User{guardian1, guardian2, guardian3} {
+		share, err := GetKeyRecoveryShare(stub, guardian, user.ID)
+		test_utils.AssertTrue(t, err == nil, "Expected GetKeyRecoveryShare to succeed")
+		test_utils.AssertTrue(t, len(share) > 0, "Expected share")
+		shares = append(shares, share)
+	}
+	test_utils.AssertTrue(t, bytes.Equal(shares[1], userShares[1]), "Expected guardian's share")
+	_, err = GetKeyRecoveryShare(stub, user, user.ID)
+	test_utils.AssertTrue(t, err != nil, "Expected GetKeyRecoveryShare by non-guardian to fail")
+
+	// user's sym key does not give access to the shares
+	shareAsset, err := asset_mgmt_i.GetEncryptedAssetData(stub, GetKeyRecoveryShareAssetId(user.ID, guardian1.ID))
+	test_utils.AssertTrue(t, err == nil, "Expected GetEncryptedAssetData to succeed")
+	_, err = key_mgmt_i.GetKey(stub, []string{user.GetSymKeyId(), shareAsset.AssetKeyId}, user.SymKey)
+	test_utils.AssertTrue(t, err != nil, "Expected user's sym key to have no access to the share key")
+
+	// recover
+	_, err = RecoverUserPrivateKey(stub, guardian1, user.ID, shares[:1])
+	test_utils.AssertTrue(t, err != nil, "Expected RecoverUserPrivateKey with 1 share to fail")
+	_, err = RecoverUserPrivateKey(stub, guardian1, user.ID, [][]byte{shares[0], crypto.GenerateSymKey()})
+	test_utils.AssertTrue(t, err != nil, "Expected RecoverUserPrivateKey with invalid share to fail")
+	_, err = RecoverUserPrivateKey(stub, guardian1, guardian2.ID, shares[:2])
+	test_utils.AssertTrue(t, err != nil, "Expected RecoverUserPrivateKey for user without key recovery to fail")
+	recoveredUser, err := RecoverUserPrivateKey(stub, guardian1, user.ID, [][]byte{shares[2], shares[0]})
+	test_utils.AssertTrue(t, err == nil, "Expected RecoverUserPrivateKey to succeed")
+	test_utils.AssertTrue(t, recoveredUser.PrivateKeyB64 == user.PrivateKeyB64, "Expected recovered private key")
+	mstub.MockTransactionEnd("t4")
+
+	// rotate user keys with the recovered user as caller
+	newUser := test_utils.CreateTestUser("user1")
+	newKeys := data_model.Keys{PrivateKey: newUser.PrivateKeyB64, PublicKey: newUser.PublicKeyB64}
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, _, err = user_mgmt_i.RotateUserKeys(stub, recoveredUser, user.ID, newKeys)
+	test_utils.AssertTrue(t, err == nil, "Expected RotateUserKeys to succeed")
+	mstub.MockTransactionEnd("t5")
+
+	// old shares are out of date
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = RecoverUserPrivateKey(stub, guardian1, user.ID, shares[:2])
+	test_utils.AssertTrue(t, err != nil, "Expected RecoverUserPrivateKey with out of date shares to fail")
+	mstub.MockTransactionEnd("t6")
+
+	// setup again without guardian1
+	newUser.SymKey = user.SymKey
+	newUser.SymKeyB64 = user.SymKeyB64
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	newShares, err := crypto.SplitSecret(newUser.GetPrivateKey().KeyBytes, 2, 2)
+	test_utils.AssertTrue(t, err == nil, "Expected SplitSecret to succeed")
+	err = SetupKeyRecovery(stub, newUser, user.ID, []string{guardian2.ID, guardian3.ID}, 2, newShares)
+	test_utils.AssertTrue(t, err == nil, "Expected SetupKeyRecovery to succeed")
+	mstub.MockTransactionEnd("t7")
+
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = GetKeyRecoveryShare(stub, guardian1, user.ID)
+	test_utils.AssertTrue(t, err != nil, "Expected GetKeyRecoveryShare by removed guardian to fail")
+	_, err = key_mgmt_i.GetKey(stub, []string{guardian1.GetPubPrivKeyId(), shareAsset.AssetKeyId}, guardian1.GetPrivateKey().KeyBytes)
+	test_utils.AssertTrue(t, err != nil, "Expected removed guardian to have no access to the old share key")
+	share2, err := GetKeyRecoveryShare(stub, guardian2, user.ID)
+	test_utils.AssertTrue(t, err == nil, "Expected GetKeyRecoveryShare to succeed")
+	test_utils.AssertTrue(t, !bytes.Equal(share2, shares[1]), "Expected share to be replaced")
+	share3, err := GetKeyRecoveryShare(stub, guardian3, user.ID)
+	test_utils.AssertTrue(t, err == nil, "Expected GetKeyRecoveryShare to succeed")
+	recoveredUser, err = RecoverUserPrivateKey(stub, guardian2, user.ID, [][]byte{share2, share3})
+	test_utils.AssertTrue(t, err == nil, "Expected RecoverUserPrivateKey to succeed")
+	test_utils.AssertTrue(t, recoveredUser.PrivateKeyB64 == newUser.PrivateKeyB64, "Expected recovered new private key")
+	mstub.MockTransactionEnd("t8")
+}
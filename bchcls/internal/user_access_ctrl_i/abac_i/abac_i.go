@@ -0,0 +1,215 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+// Package abac_i handles attribute-based access policies.
+//
+// Access policies are saved on the ledger with the ABAC_POLICY_PREFIX, one per asset namespace.
+// They are evaluated by asset_mgmt_i when assets of the namespace are read or written.
+package abac_i
+
+import (
+	"common/bchcls/cached_stub"
+	"common/bchcls/custom_errors"
+	"common/bchcls/data_model"
+	"common/bchcls/internal/common/global"
+	"common/bchcls/utils"
+
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
+)
+
+var logger = shim.NewLogger("abac_i")
+
+// PutAccessPolicy adds an access policy or updates the existing access policy of a namespace.
+// Caller must be a system admin.
+//
+// args = [policy]
+//
+// policy is a data_model.AccessPolicy in JSON format.
+func PutAccessPolicy(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "PutAccessPolicy args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	policy := data_model.AccessPolicy{}
+	err := json.Unmarshal([]byte(args[0]), &policy)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "AccessPolicy"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	return nil, PutAccessPolicyWithParams(stub, caller, policy)
+}
+
+// PutAccessPolicyWithParams adds an access policy or updates the existing access policy of a namespace.
+// It takes a data_model.AccessPolicy as argument instead of args in JSON format.
+func PutAccessPolicyWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, policy data_model.AccessPolicy) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, policy: %v", caller.ID, policy)
+
+	if !caller.IsSystemAdmin() {
+		custom_err := &custom_errors.RoleAccessPrivilegeError{Role: caller.Role}
+		logger.Errorf("PutAccessPolicy: %v", custom_err)
+		return errors.WithStack(custom_err)
+	}
+
+	if !policy.IsValid() {
+		logger.Errorf("Invalid access policy: %v", policy)
+		return errors.New("Invalid access policy, Namespace must not be empty and rules must be simple_rule expressions in JSON format")
+	}
+
+	policyLedgerKey, err := getAccessPolicyLedgerKey(stub, policy.Namespace)
+	if err != nil {
+		return err
+	}
+	policyBytes, err := json.Marshal(&policy)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "AccessPolicy"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	err = stub.PutState(policyLedgerKey, policyBytes)
+	if err != nil {
+		custom_err := &custom_errors.PutLedgerError{LedgerKey: policyLedgerKey}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	return nil
+}
+
+// GetAccessPolicy returns the access policy of a namespace.
+// Returns an empty access policy if the namespace does not have one.
+//
+// args = [namespace]
+func GetAccessPolicy(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "GetAccessPolicy args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	policy, err := GetAccessPolicyWithParams(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	policyBytes, err := json.Marshal(&policy)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "AccessPolicy"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	return policyBytes, nil
+}
+
+// GetAccessPolicyWithParams returns the access policy of the given namespace.
+// Returns an empty access policy if the namespace does not have one.
+func GetAccessPolicyWithParams(stub cached_stub.CachedStubInterface, namespace string) (data_model.AccessPolicy, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("namespace: %v", namespace)
+
+	policy := data_model.AccessPolicy{}
+	if utils.IsStringEmpty(namespace) {
+		custom_err := &custom_errors.LengthCheckingError{Type: "namespace"}
+		logger.Errorf(custom_err.Error())
+		return policy, errors.WithStack(custom_err)
+	}
+
+	policyLedgerKey, err := getAccessPolicyLedgerKey(stub, namespace)
+	if err != nil {
+		return policy, err
+	}
+	policyBytes, err := stub.GetState(policyLedgerKey)
+	if err != nil {
+		custom_err := &custom_errors.GetLedgerError{LedgerKey: policyLedgerKey, LedgerItem: "AccessPolicy"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return policy, errors.Wrap(err, custom_err.Error())
+	}
+	if len(policyBytes) == 0 {
+		return policy, nil
+	}
+	err = json.Unmarshal(policyBytes, &policy)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "AccessPolicy"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return policy, errors.Wrap(err, custom_err.Error())
+	}
+	return policy, nil
+}
+
+// DeleteAccessPolicy deletes the access policy of a namespace.
+// Caller must be a system admin.
+//
+// args = [namespace]
+func DeleteAccessPolicy(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "DeleteAccessPolicy args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	return nil, DeleteAccessPolicyWithParams(stub, caller, args[0])
+}
+
+// DeleteAccessPolicyWithParams deletes the access policy of the given namespace.
+func DeleteAccessPolicyWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, namespace string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, namespace: %v", caller.ID, namespace)
+
+	if !caller.IsSystemAdmin() {
+		custom_err := &custom_errors.RoleAccessPrivilegeError{Role: caller.Role}
+		logger.Errorf("DeleteAccessPolicy: %v", custom_err)
+		return errors.WithStack(custom_err)
+	}
+
+	policy, err := GetAccessPolicyWithParams(stub, namespace)
+	if err != nil {
+		return err
+	}
+	if len(policy.Namespace) == 0 {
+		logger.Errorf("Access policy of namespace \"%v\" does not exist", namespace)
+		return errors.Errorf("Access policy of namespace \"%v\" does not exist", namespace)
+	}
+
+	policyLedgerKey, err := getAccessPolicyLedgerKey(stub, namespace)
+	if err != nil {
+		return err
+	}
+	err = stub.DelState(policyLedgerKey)
+	if err != nil {
+		custom_err := &custom_errors.DeleteLedgerError{LedgerKey: policyLedgerKey}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	return nil
+}
+
+func getAccessPolicyLedgerKey(stub cached_stub.CachedStubInterface, namespace string) (string, error) {
+	ledgerKey, err := stub.CreateCompositeKey(global.ABAC_POLICY_PREFIX, []string{namespace})
+	if err != nil {
+		custom_err := &custom_errors.CreateCompositeKeyError{Type: global.ABAC_POLICY_PREFIX}
+		logger.Errorf("%v: %v", custom_err, err)
+		return "", errors.Wrap(err, custom_err.Error())
+	}
+	return ledgerKey, nil
+}
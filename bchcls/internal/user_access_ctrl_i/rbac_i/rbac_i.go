@@ -0,0 +1,445 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+// Package rbac_i handles role-based access control: roles, role bindings, and authorization checks.
+//
+// Roles are saved on the ledger with the RBAC_ROLE_PREFIX. Role bindings are edges of RBAC_GRAPH
+//      role -> user
+//      role -> group
+// A role bound to a group applies to the group's members and to the members of its subgroups, found with USER_GRAPH.
+package rbac_i
+
+import (
+	"common/bchcls/cached_stub"
+	"common/bchcls/custom_errors"
+	"common/bchcls/data_model"
+	"common/bchcls/internal/common/global"
+	"common/bchcls/internal/common/graph"
+	"common/bchcls/internal/user_mgmt_i"
+	"common/bchcls/utils"
+
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
+)
+
+var logger = shim.NewLogger("rbac_i")
+
+// PutRole adds a role or updates an existing role.
+// Caller must be a system admin or have PERMISSION_INVOKE on "PutRole".
+//
+// args = [role]
+//
+// role is a data_model.Role in JSON format.
+func PutRole(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "PutRole args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	role := data_model.Role{}
+	err := json.Unmarshal([]byte(args[0]), &role)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "Role"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+
+	return nil, PutRoleWithParams(stub, caller, role)
+}
+
+// PutRoleWithParams adds a role or updates an existing role.
+// It takes a data_model.Role as argument instead of args in JSON format.
+func PutRoleWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, role data_model.Role) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, role: %v", caller.ID, role)
+
+	err := authorizeRoleManagement(stub, caller, "PutRole")
+	if err != nil {
+		return err
+	}
+
+	if !role.IsValid() {
+		logger.Errorf("Invalid role: %v", role)
+		return errors.New("Invalid role, RoleID, permissions, and resources must not be empty")
+	}
+
+	roleLedgerKey, err := getRoleLedgerKey(stub, role.RoleID)
+	if err != nil {
+		return err
+	}
+	roleBytes, err := json.Marshal(&role)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "Role"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	err = stub.PutState(roleLedgerKey, roleBytes)
+	if err != nil {
+		custom_err := &custom_errors.PutLedgerError{LedgerKey: roleLedgerKey}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	return nil
+}
+
+// GetRole returns a role.
+// Returns an empty role if the role does not exist.
+//
+// args = [roleID]
+func GetRole(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "GetRole args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	role, err := GetRoleWithParams(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	roleBytes, err := json.Marshal(&role)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "Role"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	return roleBytes, nil
+}
+
+// GetRoleWithParams returns the role with the given roleID.
+// Returns an empty role if the role does not exist.
+func GetRoleWithParams(stub cached_stub.CachedStubInterface, roleID string) (data_model.Role, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("roleID: %v", roleID)
+
+	role := data_model.Role{}
+	if utils.IsStringEmpty(roleID) {
+		custom_err := &custom_errors.LengthCheckingError{Type: "roleID"}
+		logger.Errorf(custom_err.Error())
+		return role, errors.WithStack(custom_err)
+	}
+
+	roleLedgerKey, err := getRoleLedgerKey(stub, roleID)
+	if err != nil {
+		return role, err
+	}
+	roleBytes, err := stub.GetState(roleLedgerKey)
+	if err != nil {
+		custom_err := &custom_errors.GetLedgerError{LedgerKey: roleLedgerKey, LedgerItem: "Role"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return role, errors.Wrap(err, custom_err.Error())
+	}
+	if len(roleBytes) == 0 {
+		return role, nil
+	}
+	err = json.Unmarshal(roleBytes, &role)
+	if err != nil {
+		custom_err := &custom_errors.UnmarshalError{Type: "Role"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return role, errors.Wrap(err, custom_err.Error())
+	}
+	return role, nil
+}
+
+// DeleteRole deletes a role and all of its role bindings.
+// Caller must be a system admin or have PERMISSION_INVOKE on "DeleteRole".
+//
+// args = [roleID]
+func DeleteRole(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "DeleteRole args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	return nil, DeleteRoleWithParams(stub, caller, args[0])
+}
+
+// DeleteRoleWithParams deletes the role with the given roleID and all of its role bindings.
+func DeleteRoleWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, roleID string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, roleID: %v", caller.ID, roleID)
+
+	err := authorizeRoleManagement(stub, caller, "DeleteRole")
+	if err != nil {
+		return err
+	}
+
+	role, err := GetRoleWithParams(stub, roleID)
+	if err != nil {
+		return err
+	}
+	if len(role.RoleID) == 0 {
+		logger.Errorf("Role \"%v\" does not exist", roleID)
+		return errors.Errorf("Role \"%v\" does not exist", roleID)
+	}
+
+	principalIDs, err := graph.GetDirectChildren(stub, global.RBAC_GRAPH, roleID)
+	if err != nil {
+		logger.Errorf("Failed to get role bindings of role \"%v\": %v", roleID, err)
+		return errors.Wrapf(err, "Failed to get role bindings of role \"%v\"", roleID)
+	}
+	for _, principalID := range principalIDs {
+		err = graph.DeleteEdge(stub, global.RBAC_GRAPH, roleID, principalID)
+		if err != nil {
+			logger.Errorf("Failed to remove role \"%v\" from \"%v\": %v", roleID, principalID, err)
+			return errors.Wrapf(err, "Failed to remove role \"%v\" from \"%v\"", roleID, principalID)
+		}
+	}
+
+	roleLedgerKey, err := getRoleLedgerKey(stub, roleID)
+	if err != nil {
+		return err
+	}
+	err = stub.DelState(roleLedgerKey)
+	if err != nil {
+		custom_err := &custom_errors.DeleteLedgerError{LedgerKey: roleLedgerKey}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.Wrap(err, custom_err.Error())
+	}
+	return nil
+}
+
+// BindRole binds a role to a user or group.
+// A role bound to a group applies to all members of the group and of its subgroups.
+// Caller must be a system admin or have PERMISSION_INVOKE on "BindRole".
+//
+// args = [roleID, principalID]
+//
+// principalID is the ID of the user or group.
+func BindRole(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 2 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "BindRole args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	return nil, BindRoleWithParams(stub, caller, args[0], args[1])
+}
+
+// BindRoleWithParams binds the role with the given roleID to the user or group with the given principalID.
+func BindRoleWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, roleID string, principalID string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, roleID: %v, principalID: %v", caller.ID, roleID, principalID)
+
+	err := authorizeRoleManagement(stub, caller, "BindRole")
+	if err != nil {
+		return err
+	}
+
+	role, err := GetRoleWithParams(stub, roleID)
+	if err != nil {
+		return err
+	}
+	if len(role.RoleID) == 0 {
+		logger.Errorf("Role \"%v\" does not exist", roleID)
+		return errors.Errorf("Role \"%v\" does not exist", roleID)
+	}
+
+	if utils.IsStringEmpty(principalID) {
+		custom_err := &custom_errors.LengthCheckingError{Type: "principalID"}
+		logger.Errorf(custom_err.Error())
+		return errors.WithStack(custom_err)
+	}
+	principal, err := user_mgmt_i.GetUserData(stub, caller, principalID, false, false)
+	if err != nil || len(principal.ID) == 0 {
+		custom_err := &custom_errors.GetUserError{ID: principalID}
+		logger.Errorf("%v: %v", custom_err, err)
+		return errors.WithStack(custom_err)
+	}
+
+	err = graph.PutEdge(stub, global.RBAC_GRAPH, roleID, principalID)
+	if err != nil {
+		logger.Errorf("Failed to bind role \"%v\" to \"%v\": %v", roleID, principalID, err)
+		return errors.Wrapf(err, "Failed to bind role \"%v\" to \"%v\"", roleID, principalID)
+	}
+	return nil
+}
+
+// UnbindRole removes a role binding from a user or group.
+// Caller must be a system admin or have PERMISSION_INVOKE on "UnbindRole".
+//
+// args = [roleID, principalID]
+func UnbindRole(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 2 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "UnbindRole args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	return nil, UnbindRoleWithParams(stub, caller, args[0], args[1])
+}
+
+// UnbindRoleWithParams removes the binding of the role with the given roleID from the user or group
+// with the given principalID.
+func UnbindRoleWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, roleID string, principalID string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, roleID: %v, principalID: %v", caller.ID, roleID, principalID)
+
+	err := authorizeRoleManagement(stub, caller, "UnbindRole")
+	if err != nil {
+		return err
+	}
+
+	isBound, err := graph.HasEdge(stub, global.RBAC_GRAPH, roleID, principalID)
+	if err != nil {
+		logger.Errorf("Failed to get role binding of role \"%v\" to \"%v\": %v", roleID, principalID, err)
+		return errors.Wrapf(err, "Failed to get role binding of role \"%v\" to \"%v\"", roleID, principalID)
+	}
+	if !isBound {
+		logger.Errorf("Role \"%v\" is not bound to \"%v\"", roleID, principalID)
+		return errors.Errorf("Role \"%v\" is not bound to \"%v\"", roleID, principalID)
+	}
+
+	err = graph.DeleteEdge(stub, global.RBAC_GRAPH, roleID, principalID)
+	if err != nil {
+		logger.Errorf("Failed to remove role \"%v\" from \"%v\": %v", roleID, principalID, err)
+		return errors.Wrapf(err, "Failed to remove role \"%v\" from \"%v\"", roleID, principalID)
+	}
+	return nil
+}
+
+// GetRoleIDs returns the IDs of the roles bound directly to a user or group.
+// Roles the user gets from the groups it's a member of are not included.
+//
+// args = [principalID]
+func GetRoleIDs(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	if len(args) != 1 {
+		custom_err := &custom_errors.LengthCheckingError{Type: "GetRoleIDs args"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	roleIDs, err := GetRoleIDsWithParams(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	roleIDsBytes, err := json.Marshal(&roleIDs)
+	if err != nil {
+		custom_err := &custom_errors.MarshalError{Type: "roleIDs"}
+		logger.Errorf("%v: %v", custom_err, err)
+		return nil, errors.Wrap(err, custom_err.Error())
+	}
+	return roleIDsBytes, nil
+}
+
+// GetRoleIDsWithParams returns the IDs of the roles bound directly to the user or group with the given principalID.
+func GetRoleIDsWithParams(stub cached_stub.CachedStubInterface, principalID string) ([]string, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("principalID: %v", principalID)
+
+	if utils.IsStringEmpty(principalID) {
+		custom_err := &custom_errors.LengthCheckingError{Type: "principalID"}
+		logger.Errorf(custom_err.Error())
+		return nil, errors.WithStack(custom_err)
+	}
+
+	roleIDs, err := graph.GetDirectParents(stub, global.RBAC_GRAPH, principalID)
+	if err != nil {
+		logger.Errorf("Failed to get roles of \"%v\": %v", principalID, err)
+		return nil, errors.Wrapf(err, "Failed to get roles of \"%v\"", principalID)
+	}
+	return roleIDs, nil
+}
+
+// Authorize returns nil if the caller has permission on resource, and an AuthorizationError otherwise.
+// System admins have every permission. Other callers have the permissions of the roles bound to them,
+// and of the roles bound to the groups they're a direct or indirect member of.
+//
+// permission is PERMISSION_INVOKE for a function name, ACCESS_READ or ACCESS_WRITE for an asset namespace,
+// or any permission defined by the solution.
+func Authorize(stub cached_stub.CachedStubInterface, caller data_model.User, permission string, resource string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, permission: %v, resource: %v", caller.ID, permission, resource)
+
+	if utils.IsStringEmpty(caller.ID) || utils.IsStringEmpty(permission) || utils.IsStringEmpty(resource) {
+		custom_err := &custom_errors.LengthCheckingError{Type: "Authorize args"}
+		logger.Errorf(custom_err.Error())
+		return errors.WithStack(custom_err)
+	}
+
+	if caller.IsSystemAdmin() {
+		return nil
+	}
+
+	groupIDs, err := graph.SlowGetParents(stub, global.USER_GRAPH, caller.ID)
+	if err != nil {
+		logger.Errorf("Failed to get groups of \"%v\": %v", caller.ID, err)
+		return errors.Wrapf(err, "Failed to get groups of \"%v\"", caller.ID)
+	}
+
+	checkedRoleIDs := make(map[string]bool)
+	for _, principalID := range append([]string{caller.ID}, groupIDs...) {
+		roleIDs, err := GetRoleIDsWithParams(stub, principalID)
+		if err != nil {
+			return err
+		}
+		for _, roleID := range roleIDs {
+			if checkedRoleIDs[roleID] {
+				continue
+			}
+			checkedRoleIDs[roleID] = true
+			role, err := GetRoleWithParams(stub, roleID)
+			if err != nil {
+				return err
+			}
+			if role.HasPermission(permission, resource) {
+				logger.Debugf("Role \"%v\" of \"%v\" gives %v permission on %v", roleID, principalID, permission, resource)
+				return nil
+			}
+		}
+	}
+
+	custom_err := &custom_errors.AuthorizationError{UserId: caller.ID, Permission: permission, Resource: resource}
+	logger.Errorf(custom_err.Error())
+	return errors.WithStack(custom_err)
+}
+
+// authorizeRoleManagement checks that the caller can manage roles with the function functionName.
+func authorizeRoleManagement(stub cached_stub.CachedStubInterface, caller data_model.User, functionName string) error {
+	err := Authorize(stub, caller, global.PERMISSION_INVOKE, functionName)
+	if err != nil {
+		logger.Errorf("Caller \"%v\" is not authorized to call %v: %v", caller.ID, functionName, err)
+		return errors.Wrapf(err, "Caller \"%v\" is not authorized to call %v", caller.ID, functionName)
+	}
+	return nil
+}
+
+func getRoleLedgerKey(stub cached_stub.CachedStubInterface, roleID string) (string, error) {
+	ledgerKey, err := stub.CreateCompositeKey(global.RBAC_ROLE_PREFIX, []string{roleID})
+	if err != nil {
+		custom_err := &custom_errors.CreateCompositeKeyError{Type: global.RBAC_ROLE_PREFIX}
+		logger.Errorf("%v: %v", custom_err, err)
+		return "", errors.Wrap(err, custom_err.Error())
+	}
+	return ledgerKey, nil
+}
@@ -0,0 +1,172 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+package rbac_i
+
+import (
+	"common/bchcls/cached_stub"
+	"common/bchcls/custom_errors"
+	"common/bchcls/data_model"
+	"common/bchcls/internal/asset_mgmt_i"
+	"common/bchcls/internal/common/global"
+	"common/bchcls/internal/datastore_i"
+	"common/bchcls/internal/datatype_i"
+	"common/bchcls/internal/user_mgmt_i"
+	"common/bchcls/test_utils"
+
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
+)
+
+func setup(t *testing.T) *test_utils.NewMockStub {
+	mstub := test_utils.CreateNewMockStub(t)
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	user_mgmt_i.Init(stub)
+	asset_mgmt_i.Init(stub)
+	datatype_i.Init(stub)
+	datastore_i.Init(stub)
+	mstub.MockTransactionEnd("t1")
+	logger.SetLevel(shim.LogDebug)
+	return mstub
+}
+
+func TestRBAC(t *testing.T) {
+	logger.Info("TestRBAC function called")
+
+	mstub := setup(t)
+
+	systemAdmin := test_utils.CreateTestUser("admin")
+	systemAdmin.Role = global.ROLE_SYSTEM_ADMIN
+	group1 := test_utils.CreateTestGroup("group1")
+	group2 := test_utils.CreateTestGroup("group2")
+	user1 := test_utils.CreateTestUser("user1")
+	user2 := test_utils.CreateTestUser("user2")
+
+	// user1 is a member of group2, which is a subgroup of group1
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	for _, u := range []data_model.User{user1, user2} {
+		err := user_mgmt_i.RegisterUserWithParams(stub, u, u, false)
+		test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	}
+	err := user_mgmt_i.RegisterOrgWithParams(stub, group1, group1, false)
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterOrg to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = user_mgmt_i.RegisterSubgroupWithParams(stub, group1, group2, group1.ID)
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterSubgroup to succeed")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = user_mgmt_i.PutUserInGroup(stub, group2, user1.ID, group2.ID, false)
+	test_utils.AssertTrue(t, err == nil, "Expected PutUserInGroup to succeed")
+	mstub.MockTransactionEnd("t3")
+
+	// system admin adds roles
+	nurse := data_model.Role{
+		RoleID: "nurse",
+		Permissions: []data_model.RolePermission{
+			{Permission: global.PERMISSION_INVOKE, Resources: []string{"GetPatient*"}},
+			{Permission: global.ACCESS_WRITE, Resources: []string{"data_model.Patient"}},
+		},
+	}
+	roleAdmin := data_model.Role{
+		RoleID:      "role-admin",
+		Permissions: []data_model.RolePermission{{Permission: global.PERMISSION_INVOKE, Resources: []string{"BindRole", "UnbindRole"}}},
+	}
+	roleAdminBytes, _ := json.Marshal(&roleAdmin)
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = PutRoleWithParams(stub, user1, nurse)
+	test_utils.AssertTrue(t, err != nil, "Expected PutRole by user to fail")
+	err = PutRoleWithParams(stub, systemAdmin, data_model.Role{RoleID: "invalid", Permissions: []data_model.RolePermission{{Permission: global.PERMISSION_INVOKE}}})
+	test_utils.AssertTrue(t, err != nil, "Expected PutRole of role without resources to fail")
+	err = PutRoleWithParams(stub, systemAdmin, nurse)
+	test_utils.AssertTrue(t, err == nil, "PutRole should be successful")
+	_, err = PutRole(stub, systemAdmin, []string{string(roleAdminBytes)})
+	test_utils.AssertTrue(t, err == nil, "PutRole should be successful")
+	mstub.MockTransactionEnd("t4")
+
+	authorize := func(txID string, caller data_model.User, permission string, resource string) error {
+		mstub.MockTransactionStart(txID)
+		defer mstub.MockTransactionEnd(txID)
+		stub := cached_stub.NewCachedStub(mstub)
+		return Authorize(stub, caller, permission, resource)
+	}
+	bindRole := func(txID string, caller data_model.User, roleID string, principalID string) error {
+		mstub.MockTransactionStart(txID)
+		defer mstub.MockTransactionEnd(txID)
+		stub := cached_stub.NewCachedStub(mstub)
+		_, err := BindRole(stub, caller, []string{roleID, principalID})
+		return err
+	}
+
+	err = authorize("t5", user1, global.PERMISSION_INVOKE, "GetPatientRecord")
+	_, ok := errors.Cause(err).(*custom_errors.AuthorizationError)
+	test_utils.AssertTrue(t, ok, "Expected AuthorizationError before role is bound")
+	test_utils.AssertTrue(t, authorize("t6", systemAdmin, global.PERMISSION_INVOKE, "GetPatientRecord") == nil, "Expected system admin to be authorized")
+
+	// nurse role bound to group1 applies to user1 through subgroup group2
+	test_utils.AssertTrue(t, bindRole("t7", systemAdmin, "unknown", group1.ID) != nil, "Expected BindRole of unknown role to fail")
+	test_utils.AssertTrue(t, bindRole("t8", systemAdmin, "nurse", "unknown") != nil, "Expected BindRole to unknown user to fail")
+	test_utils.AssertTrue(t, bindRole("t9", systemAdmin, "nurse", group1.ID) == nil, "BindRole should be successful")
+	test_utils.AssertTrue(t, authorize("t10", user1, global.PERMISSION_INVOKE, "GetPatientRecord") == nil, "Expected user in subgroup to be authorized")
+	test_utils.AssertTrue(t, authorize("t11", user1, global.ACCESS_READ, "data_model.Patient") == nil, "Expected write permission to give read permission")
+	test_utils.AssertTrue(t, authorize("t12", user1, global.PERMISSION_INVOKE, "DeletePatient") != nil, "Expected user not to be authorized for other functions")
+	test_utils.AssertTrue(t, authorize("t13", user2, global.PERMISSION_INVOKE, "GetPatientRecord") != nil, "Expected user not in group not to be authorized")
+
+	// role-admin role allows user2 to bind roles, but not to add roles
+	test_utils.AssertTrue(t, bindRole("t14", user2, "nurse", user2.ID) != nil, "Expected BindRole by user to fail")
+	test_utils.AssertTrue(t, bindRole("t15", systemAdmin, "role-admin", user2.ID) == nil, "BindRole should be successful")
+	test_utils.AssertTrue(t, bindRole("t16", user2, "nurse", user2.ID) == nil, "BindRole by role admin should be successful")
+	test_utils.AssertTrue(t, authorize("t17", user2, global.PERMISSION_INVOKE, "GetPatientRecord") == nil, "Expected user to be authorized")
+	mstub.MockTransactionStart("t18")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = PutRoleWithParams(stub, user2, nurse)
+	test_utils.AssertTrue(t, err != nil, "Expected PutRole by role admin to fail")
+	roleIDsBytes, err := GetRoleIDs(stub, user2, []string{user2.ID})
+	test_utils.AssertTrue(t, err == nil, "GetRoleIDs should be successful")
+	roleIDs := []string{}
+	json.Unmarshal(roleIDsBytes, &roleIDs)
+	test_utils.AssertListsEqual(t, []string{"nurse", "role-admin"}, roleIDs)
+	mstub.MockTransactionEnd("t18")
+
+	// unbinding from group1 removes user1's permission
+	mstub.MockTransactionStart("t19")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = UnbindRoleWithParams(stub, user2, "nurse", group1.ID)
+	test_utils.AssertTrue(t, err == nil, "UnbindRole should be successful")
+	err = UnbindRoleWithParams(stub, user2, "nurse", user1.ID)
+	test_utils.AssertTrue(t, err != nil, "Expected UnbindRole of role that is not bound to fail")
+	mstub.MockTransactionEnd("t19")
+	test_utils.AssertTrue(t, authorize("t20", user1, global.PERMISSION_INVOKE, "GetPatientRecord") != nil, "Expected user not to be authorized after UnbindRole")
+
+	// deleting role-admin removes its bindings
+	mstub.MockTransactionStart("t21")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = DeleteRoleWithParams(stub, systemAdmin, "role-admin")
+	test_utils.AssertTrue(t, err == nil, "DeleteRole should be successful")
+	mstub.MockTransactionEnd("t21")
+	test_utils.AssertTrue(t, bindRole("t22", user2, "nurse", user1.ID) != nil, "Expected BindRole after role is deleted to fail")
+	mstub.MockTransactionStart("t23")
+	stub = cached_stub.NewCachedStub(mstub)
+	role, err := GetRoleWithParams(stub, "role-admin")
+	test_utils.AssertTrue(t, err == nil && len(role.RoleID) == 0, "Expected role to be deleted")
+	roleIDs, err = GetRoleIDsWithParams(stub, user2.ID)
+	test_utils.AssertTrue(t, err == nil, "GetRoleIDs should be successful")
+	test_utils.AssertListsEqual(t, []string{"nurse"}, roleIDs)
+	mstub.MockTransactionEnd("t23")
+}
@@ -17,7 +17,6 @@ import (
 	"encoding/json"
 
 	"common/bchcls/cached_stub"
-	"common/bchcls/crypto"
 	"common/bchcls/custom_errors"
 	"common/bchcls/data_model"
 	"common/bchcls/internal/asset_mgmt_i"
@@ -192,8 +191,17 @@ func (userAccessManager userAccessManagerImpl) SlowCheckAccessToKey(targetKeyID
 		logger.Errorf("%v", custom_err)
 		return nil, filters, custom_err
 	}
-	visited := make(map[string]bool)
 
+	// deny entries take precedence over any path
+	denied, err := asset_mgmt_i.IsUserDeniedAccessToKey(userAccessManager.stub, userAccessManager.caller.ID, targetKeyID)
+	if err != nil {
+		return nil, filters, err
+	}
+	if denied {
+		return nil, filters, nil
+	}
+
+	visited := make(map[string]bool)
 	path, filters, err := dfsKeyGraph(userAccessManager.stub, userAccessManager.caller, callerKeyID, targetKeyID, visited, filters)
 	if err != nil {
 		logger.Errorf("Error finding path to target key: %v", err)
@@ -203,6 +211,7 @@ func (userAccessManager userAccessManagerImpl) SlowCheckAccessToKey(targetKeyID
 }
 
 // dfsKeyGraph is a helper function for CheckAccessToKey.
+// Time-bound access edges that are not in effect are not traversed.
 func dfsKeyGraph(stub cached_stub.CachedStubInterface, caller data_model.User, currNodeID string, targetNodeID string, visited map[string]bool, filters data_model.AccessControlFilters) ([]string, data_model.AccessControlFilters, error) {
 
 	visited[currNodeID] = true
@@ -237,6 +246,12 @@ func dfsKeyGraph(stub cached_stub.CachedStubInterface, caller data_model.User, c
 			continue
 		}
 
+		// skip time-bound access that is not in effect
+		_, edgeData, err := key_mgmt_i.GetAccessEdge(stub, currNodeID, nextNodeID)
+		if err != nil || !asset_mgmt_i.IsEdgeInEffect(stub, edgeData) {
+			continue
+		}
+
 		// call dfs recursively on child, pass along filter rules
 		path, nextFilters, err := dfsKeyGraph(stub, caller, nextNodeID, targetNodeID, visited, filters)
 		if err != nil {
@@ -299,7 +314,7 @@ func appendFilters(filters *data_model.AccessControlFilters, filter map[string]s
 // GetKey documentation can be found in user_access_ctrl_interfaces.go.
 func (userAccessManager userAccessManagerImpl) GetKey(keyID string, keyPath []string) (data_model.Key, error) {
 	callerKeyID := userAccessManager.caller.GetPubPrivKeyId()
-	callerKeyBytes := crypto.PrivateKeyToBytes(userAccessManager.caller.PrivateKey)
+	callerKeyBytes := userAccessManager.caller.GetPrivateKey().KeyBytes
 	keyBytes, err := key_mgmt_i.SlowVerifyAccessAndGetKey(userAccessManager.stub, callerKeyID, callerKeyBytes, keyID)
 	if err != nil {
 		custom_err := &custom_errors.VerifyAccessAndGetKeyError{}
@@ -651,6 +651,128 @@ func TestCheckAccess_DatatypeConsent(t *testing.T) {
 
 }
 
+func TestCheckAccess_DatatypeConsentTimeConstraints(t *testing.T) {
+	mstub := setup(t)
+
+	// register caller, user, and datatype1
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	caller := test_utils.CreateTestUser(callerId)
+	callerBytes, _ := json.Marshal(&caller)
+	_, err := user_mgmt_i.RegisterUser(stub, caller, []string{string(callerBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	user := test_utils.CreateTestUser(userId)
+	userBytes, _ := json.Marshal(&user)
+	_, err = user_mgmt_i.RegisterUser(stub, caller, []string{string(userBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.RegisterDatatypeWithParams(stub, "datatype1", "", true, datatype_i.ROOT_DATATYPE_ID)
+	test_utils.AssertTrue(t, err == nil, "RegisterDatatypeWithParams should not have returned an error")
+	mstub.MockTransactionEnd("t2")
+
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = datatype_i.AddDatatypeSymKey(stub, caller, "datatype1", caller.ID)
+	test_utils.AssertTrue(t, err == nil, "AddDatatypeSymKey should be successful")
+	mstub.MockTransactionEnd("t3")
+
+	// add asset1 (datatype1)
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	key1 := data_model.Key{ID: "key1", Type: global.KEY_TYPE_SYM, KeyBytes: test_utils.GenerateSymKey()}
+	asset1 := data_model.Asset{
+		AssetId:      asset_mgmt_i.GetAssetId("test", "asset1"),
+		AssetKeyId:   key1.ID,
+		AssetKeyHash: crypto.Hash(key1.KeyBytes),
+		Datatypes:    []string{"datatype1"},
+		PrivateData:  test_utils.CreateTestAssetData("private1"),
+		PublicData:   test_utils.CreateTestAssetData("public1"),
+		OwnerIds:     []string{caller.ID},
+		Metadata:     make(map[string]string)}
+	err = asset_mgmt_i.GetAssetManager(stub, caller).AddAsset(asset1, key1, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	mstub.MockTransactionEnd("t4")
+
+	consentKey := test_utils.GenerateSymKey()
+	putConsentAndCheckAccess := func(txID string, consent data_model.Consent, expectedAccess bool) {
+		mstub.MockTransactionStart(txID + "-put")
+		stub := cached_stub.NewCachedStub(mstub)
+		err := consent_mgmt.PutConsentWithParams(stub, caller, consent, consentKey)
+		test_utils.AssertTrue(t, err == nil, "PutConsent should be successful")
+		mstub.MockTransactionEnd(txID + "-put")
+
+		mstub.MockTransactionStart(txID + "-check")
+		stub = cached_stub.NewCachedStub(mstub)
+		accessControl := data_model.AccessControl{UserId: user.ID, AssetId: asset1.AssetId, Access: global.ACCESS_READ}
+		hasAccess, err := GetUserAccessManager(stub, user).CheckAccess(accessControl)
+		test_utils.AssertTrue(t, err == nil, "Expected CheckAccess to succeed.")
+		test_utils.AssertTrue(t, hasAccess == expectedAccess, "Unexpected access for consent "+txID)
+		mstub.MockTransactionEnd(txID + "-check")
+	}
+
+	// consent that activates in the future
+	consent := generateConsent(caller.ID, user.ID, global.ACCESS_READ, "datatype1")
+	consent.NotBefore = consent.ConsentDate + 60*60
+	putConsentAndCheckAccess("notBefore", consent, false)
+
+	// consent that is active on another day of the week only
+	weekday := int(time.Now().UTC().Weekday())
+	consent.NotBefore = 0
+	consent.ValidityWindows = []data_model.ConsentWindow{{Weekdays: []int{(weekday + 1) % 7}, StartHour: 0, EndHour: 24}}
+	putConsentAndCheckAccess("otherDay", consent, false)
+
+	// consent that is active today
+	consent.ValidityWindows = append(consent.ValidityWindows, data_model.ConsentWindow{Weekdays: []int{weekday}, StartHour: 0, EndHour: 24})
+	putConsentAndCheckAccess("today", consent, true)
+
+	// consent that has expired
+	consent.ValidityWindows = nil
+	consent.ExpirationDate = consent.ConsentDate - 1
+	putConsentAndCheckAccess("expired", consent, false)
+
+	checkAccess := func(txID string) bool {
+		mstub.MockTransactionStart(txID)
+		defer mstub.MockTransactionEnd(txID)
+		stub := cached_stub.NewCachedStub(mstub)
+		accessControl := data_model.AccessControl{UserId: user.ID, AssetId: asset1.AssetId, Access: global.ACCESS_READ}
+		hasAccess, err := GetUserAccessManager(stub, user).CheckAccess(accessControl)
+		test_utils.AssertTrue(t, err == nil, "Expected CheckAccess to succeed.")
+		return hasAccess
+	}
+
+	// expired consent put before its time constraints were saved in edge data
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	consentID := consent_mgmt.GetConsentID("datatype1", user.ID, caller.ID)
+	symKeyID := datatype_i.GetDatatypeKeyID("datatype1", caller.ID)
+	edgeValue, edgeData, err := key_mgmt_i.GetAccessEdge(stub, consentID, symKeyID)
+	test_utils.AssertTrue(t, err == nil && len(edgeValue) > 0, "Expected GetAccessEdge to succeed")
+	test_utils.AssertTrue(t, len(edgeData[global.EDGEDATA_EXPIRATION_DATE]) > 0, "Expected expiration date in edge data")
+	delete(edgeData, global.EDGEDATA_EXPIRATION_DATE)
+	err = key_mgmt_i.UpdateAccessEdge(stub, consentID, symKeyID, edgeValue, edgeData)
+	test_utils.AssertTrue(t, err == nil, "Expected UpdateAccessEdge to succeed")
+	mstub.MockTransactionEnd("t5")
+	test_utils.AssertTrue(t, checkAccess("t6"), "Expected consent without time constraints in edge data to give access")
+
+	// only a caller with access to the consent key can update the edge data
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	other := test_utils.CreateTestUser("other")
+	err = consent_mgmt.UpdateConsentEdgeDataWithParams(stub, other, consentID)
+	test_utils.AssertTrue(t, err != nil, "Expected UpdateConsentEdgeData without consent key to fail")
+	mstub.MockTransactionEnd("t7")
+
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = consent_mgmt.UpdateConsentEdgeData(stub, caller, []string{consentID})
+	test_utils.AssertTrue(t, err == nil, "UpdateConsentEdgeData should be successful")
+	mstub.MockTransactionEnd("t8")
+	test_utils.AssertTrue(t, !checkAccess("t9"), "Expected expired consent not to give access after UpdateConsentEdgeData")
+}
+
 // Tests group ADMIN access to an asset which is owned by the group
 func TestCheckAccess_groupAdmin(t *testing.T) {
 
@@ -1103,3 +1225,124 @@ func TestGetKey(t *testing.T) {
 	test_utils.AssertTrue(t, reflect.DeepEqual(key1, key1Result), "Expected key1")
 	mstub.MockTransactionEnd("t1")
 }
+
+func TestDenyAccess(t *testing.T) {
+	logger.SetLevel(shim.LogDebug)
+	t.Log("Running TestDenyAccess")
+	mstub := setup(t)
+
+	owner := test_utils.CreateTestUser("owner")
+	member1 := test_utils.CreateTestUser("member1")
+	member2 := test_utils.CreateTestUser("member2")
+	group := test_utils.CreateTestGroup("group")
+
+	// register users and group, and put members in group as admins
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	for _, u := range []data_model.User{owner, member1, member2} {
+		err := user_mgmt_i.RegisterUserWithParams(stub, u, u, false)
+		test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	}
+	err := user_mgmt_i.RegisterOrgWithParams(stub, group, group, false)
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterOrg to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	for _, memberID := range []string{member1.ID, member2.ID} {
+		err = user_mgmt_i.PutUserInGroup(stub, group, memberID, group.ID, true)
+		test_utils.AssertTrue(t, err == nil, "Expected PutUserInGroup to succeed")
+	}
+	mstub.MockTransactionEnd("t2")
+
+	// owner adds an asset and gives group read access
+	asset := test_utils.CreateTestAsset(assetId)
+	assetKey := test_utils.CreateSymKey("assetKey")
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = asset_mgmt_i.GetAssetManager(stub, owner).AddAsset(asset, assetKey, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	mstub.MockTransactionEnd("t3")
+
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetUserAccessManager(stub, owner).AddAccess(data_model.AccessControl{UserId: group.ID, AssetId: asset.AssetId, Access: global.ACCESS_READ})
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess to succeed")
+	mstub.MockTransactionEnd("t4")
+
+	checkAccess := func(member data_model.User) bool {
+		uam := GetUserAccessManager(stub, member)
+		hasAccess, err := uam.CheckAccess(data_model.AccessControl{UserId: member.ID, AssetId: asset.AssetId, Access: global.ACCESS_READ})
+		test_utils.AssertTrue(t, err == nil, "Expected CheckAccess to succeed")
+		path, _, err := uam.SlowCheckAccessToKey(assetKey.ID)
+		test_utils.AssertTrue(t, err == nil, "Expected SlowCheckAccessToKey to succeed")
+		test_utils.AssertTrue(t, hasAccess == (path != nil), "Expected CheckAccess and SlowCheckAccessToKey to agree")
+		return hasAccess
+	}
+
+	// both members have access through group
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	test_utils.AssertTrue(t, checkAccess(member1), "Expected member1 to have access")
+	test_utils.AssertTrue(t, checkAccess(member2), "Expected member2 to have access")
+	member1Path, _, _ := GetUserAccessManager(stub, member1).SlowCheckAccessToKey(assetKey.ID)
+	mstub.MockTransactionEnd("t5")
+
+	// invalid deny entries
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	uam := GetUserAccessManager(stub, owner)
+	err = uam.AddAccess(data_model.AccessControl{UserId: "unknown", AssetId: asset.AssetId, Access: global.ACCESS_DENY})
+	test_utils.AssertTrue(t, err != nil, "Expected deny entry for unknown user to fail")
+	err = GetUserAccessManager(stub, member2).AddAccess(data_model.AccessControl{UserId: member1.ID, AssetId: asset.AssetId, Access: global.ACCESS_DENY})
+	test_utils.AssertTrue(t, err != nil, "Expected deny entry by non owner to fail")
+	err = uam.AddAccess(data_model.AccessControl{UserId: member1.ID, AssetId: asset_mgmt_i.GetAssetId("data_model.Asset", "unknown"), Access: global.ACCESS_DENY})
+	test_utils.AssertTrue(t, err != nil, "Expected deny entry for unknown asset to fail")
+	mstub.MockTransactionEnd("t6")
+
+	// owner denies member1
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetUserAccessManager(stub, owner).AddAccess(data_model.AccessControl{UserId: member1.ID, AssetId: asset.AssetId, Access: global.ACCESS_DENY})
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess with deny to succeed")
+	mstub.MockTransactionEnd("t7")
+
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	test_utils.AssertFalse(t, checkAccess(member1), "Expected member1 to be denied access")
+	test_utils.AssertTrue(t, checkAccess(member2), "Expected member2 to have access")
+	_, err = asset_mgmt_i.GetAssetManager(stub, member1).GetAssetKey(asset.AssetId, member1Path)
+	test_utils.AssertTrue(t, err != nil, "Expected GetAssetKey by member1 to fail")
+	mstub.MockTransactionEnd("t8")
+
+	// owner denies group
+	mstub.MockTransactionStart("t9")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = GetUserAccessManager(stub, owner).AddAccess(data_model.AccessControl{UserId: group.ID, AssetId: asset.AssetId, Access: global.ACCESS_DENY})
+	test_utils.AssertTrue(t, err == nil, "Expected AddAccess with deny to succeed")
+	mstub.MockTransactionEnd("t9")
+
+	mstub.MockTransactionStart("t10")
+	stub = cached_stub.NewCachedStub(mstub)
+	test_utils.AssertFalse(t, checkAccess(member2), "Expected member2 to be denied access")
+	mstub.MockTransactionEnd("t10")
+
+	// remove deny entries
+	mstub.MockTransactionStart("t11")
+	stub = cached_stub.NewCachedStub(mstub)
+	uam = GetUserAccessManager(stub, owner)
+	for _, deniedID := range []string{member1.ID, group.ID} {
+		err = uam.RemoveAccess(data_model.AccessControl{UserId: deniedID, AssetId: asset.AssetId, Access: global.ACCESS_DENY})
+		test_utils.AssertTrue(t, err == nil, "Expected RemoveAccess with deny to succeed")
+	}
+	mstub.MockTransactionEnd("t11")
+
+	mstub.MockTransactionStart("t12")
+	stub = cached_stub.NewCachedStub(mstub)
+	test_utils.AssertTrue(t, checkAccess(member1), "Expected member1 to have access")
+	test_utils.AssertTrue(t, checkAccess(member2), "Expected member2 to have access")
+	member1AssetKey, err := asset_mgmt_i.GetAssetManager(stub, member1).GetAssetKey(asset.AssetId, member1Path)
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetKey by member1 to succeed")
+	test_utils.AssertTrue(t, reflect.DeepEqual(member1AssetKey.KeyBytes, assetKey.KeyBytes), "Expected asset key")
+	mstub.MockTransactionEnd("t12")
+}
@@ -20,6 +20,7 @@ import (
 	"common/bchcls/internal/user_mgmt_i/user_mgmt_c"
 	"common/bchcls/utils"
 
+	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"sort"
@@ -203,9 +204,12 @@ func RegisterSubgroup(stub cached_stub.CachedStubInterface, caller data_model.Us
 
 	// Set the subgroup's keys from B64
 	// If any of these fail, they will return nil for the key. That will trigger an "invalid keys" error in RegisterSubgroupWithParams.
+	// Keys can be RSA, EC P-256, or Ed25519 keys. PrivateKey and PublicKey are only set for RSA keys.
 	subgroup.SymKey, _ = crypto.ParseSymKeyB64(subgroup.SymKeyB64)
-	subgroup.PublicKey, _ = crypto.ParsePublicKeyB64(subgroup.PublicKeyB64)
-	subgroup.PrivateKey, _ = crypto.ParsePrivateKeyB64(subgroup.PrivateKeyB64)
+	publicKey, _ := crypto.ParseAnyPublicKeyB64(subgroup.PublicKeyB64)
+	subgroup.PublicKey, _ = publicKey.(*rsa.PublicKey)
+	privateKey, _ := crypto.ParseAnyPrivateKeyB64(subgroup.PrivateKeyB64)
+	subgroup.PrivateKey, _ = privateKey.(*rsa.PrivateKey)
 
 	// Parse parentGroupID from args[1]
 	parentGroupID := args[1]
@@ -249,7 +253,7 @@ func RegisterSubgroupWithParams(stub cached_stub.CachedStubInterface, caller dat
 	}
 
 	// Check that the subgroup's keys were provided
-	if subgroup.PrivateKey == nil || subgroup.PublicKey == nil || !crypto.ValidateSymKey(subgroup.SymKey) {
+	if !hasPrivateKey(subgroup) || !hasPublicKey(subgroup) || !crypto.ValidateSymKey(subgroup.SymKey) {
 		logger.Errorf("Public, private, and sym keys must be provided to register a new subgroup.")
 		return errors.New("Public, private, and sym keys must be provided to register a new subgroup.")
 	}
@@ -283,7 +287,7 @@ func RegisterSubgroupWithParams(stub cached_stub.CachedStubInterface, caller dat
 		logger.Error(errMsg)
 		return errors.New(errMsg)
 	}
-	if parentGroup.PrivateKey == nil {
+	if !hasPrivateKey(parentGroup) {
 		logger.Errorf("PrivateKey of parentGroup \"%v\" cannot be nil", parentGroup.ID)
 		return errors.Errorf("PrivateKey of parentGroup \"%v\" cannot be nil", parentGroup.ID)
 	}
@@ -394,7 +398,7 @@ func RemoveSubgroupFromGroup(stub cached_stub.CachedStubInterface, caller data_m
 		logger.Error(errMsg)
 		return errors.New(errMsg)
 	}
-	if subgroup.PrivateKey == nil {
+	if !hasPrivateKey(subgroup) {
 		errMsg := "subgroup.PrivateKey cannot be nil"
 		logger.Error(errMsg)
 		return errors.New(errMsg)
@@ -425,7 +429,7 @@ func RemoveSubgroupFromGroup(stub cached_stub.CachedStubInterface, caller data_m
 		logger.Error(errMsg)
 		return errors.New(errMsg)
 	}
-	if group.PrivateKey == nil {
+	if !hasPrivateKey(group) {
 		errMsg := "group.PrivateKey cannot be nil"
 		logger.Error(errMsg)
 		return errors.New(errMsg)
@@ -927,3 +931,21 @@ func RemoveAuditorPermissionOfGroup(stub cached_stub.CachedStubInterface, caller
 
 	return nil
 }
+
+// hasPrivateKey returns true if the user or group has an RSA, EC P-256, or Ed25519 private key.
+func hasPrivateKey(user data_model.User) bool {
+	if user.PrivateKey != nil {
+		return true
+	}
+	privateKey, err := crypto.ParseAnyPrivateKeyB64(user.PrivateKeyB64)
+	return err == nil && privateKey != nil
+}
+
+// hasPublicKey returns true if the user or group has an RSA, EC P-256, or Ed25519 public key.
+func hasPublicKey(user data_model.User) bool {
+	if user.PublicKey != nil {
+		return true
+	}
+	publicKey, err := crypto.ParseAnyPublicKeyB64(user.PublicKeyB64)
+	return err == nil && publicKey != nil
+}
@@ -12,11 +12,16 @@ package user_mgmt_i
 import (
 	"common/bchcls/cached_stub"
 	"common/bchcls/crypto"
+	"common/bchcls/custom_errors"
 	"common/bchcls/data_model"
+	"common/bchcls/internal/asset_mgmt_i"
 	"common/bchcls/internal/key_mgmt_i"
 	"common/bchcls/internal/user_mgmt_i/user_mgmt_c"
 	"common/bchcls/utils"
 
+	"bytes"
+	"crypto/rsa"
+
 	"github.com/pkg/errors"
 )
 
@@ -184,3 +189,136 @@ func ConvertAdminPathToSymKeyPath(adminPath []string) (keyPath []string, err err
 	}
 	return keyPath, nil
 }
+
+// RotateUserKeys replaces a user's private/public key pair and/or sym key with newKeys.
+// Caller must be the user or must have access to the user's private and sym keys.
+// Empty fields of newKeys are not rotated. If PrivateKey is set, PublicKey must be the matching public key.
+// Key IDs stay the same: every key graph edge from and to the user's old keys is re-encrypted with the new keys,
+// including the derived private-key-hash sym key and log sym key. The user asset is re-encrypted with the new sym key.
+// Returns the user with the new keys and the IDs of the keys that were replaced.
+// Keys in newKeys that are the same as the user's current keys are not replaced.
+// If the caller is the user, the caller object still holds the old keys after this function returns.
+func RotateUserKeys(stub cached_stub.CachedStubInterface, caller data_model.User, userId string, newKeys data_model.Keys) (data_model.User, []string, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerId: %v, userId: %v", caller.ID, userId)
+
+	// get user with current keys
+	user, err := GetUserData(stub, caller, userId, true, true)
+	if err != nil {
+		custom_err := &custom_errors.GetUserError{ID: userId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return data_model.User{}, nil, errors.Wrap(err, custom_err.Error())
+	}
+	if len(user.ID) == 0 {
+		custom_err := &custom_errors.GetUserError{ID: userId}
+		logger.Errorf("%v", custom_err)
+		return data_model.User{}, nil, errors.WithStack(custom_err)
+	}
+	if len(user.PrivateKeyB64) == 0 || len(user.SymKey) == 0 {
+		logger.Errorf("Caller %v does not have access to the keys of user %v", caller.ID, userId)
+		return data_model.User{}, nil, errors.New("Caller does not have access to the user's private and sym keys")
+	}
+
+	newUser := user
+	rotatePrivateKey := false
+	rotateSymKey := false
+
+	// new private and public keys
+	if len(newKeys.PrivateKey) > 0 || len(newKeys.PublicKey) > 0 {
+		privateKeyBytes, err := crypto.DecodeStringB64(newKeys.PrivateKey)
+		if err != nil || len(privateKeyBytes) == 0 {
+			custom_err := &custom_errors.ParseKeyError{Type: "private key"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return data_model.User{}, nil, errors.WithStack(custom_err)
+		}
+		privateKey, err := crypto.ParseAnyPrivateKey(privateKeyBytes)
+		if err != nil {
+			custom_err := &custom_errors.ParseKeyError{Type: "private key"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return data_model.User{}, nil, errors.Wrap(err, custom_err.Error())
+		}
+		publicKeyBytes, err := crypto.DecodeStringB64(newKeys.PublicKey)
+		if err != nil || len(publicKeyBytes) == 0 {
+			custom_err := &custom_errors.ParseKeyError{Type: "public key"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return data_model.User{}, nil, errors.WithStack(custom_err)
+		}
+		publicKey, err := crypto.ParseAnyPublicKey(publicKeyBytes)
+		if err != nil {
+			custom_err := &custom_errors.ParseKeyError{Type: "public key"}
+			logger.Errorf("%v: %v", custom_err, err)
+			return data_model.User{}, nil, errors.Wrap(err, custom_err.Error())
+		}
+		derivedPublicKeyBytes, err := crypto.GetPublicKeyBytesFromPrivateKey(privateKeyBytes)
+		if err != nil || !bytes.Equal(derivedPublicKeyBytes, publicKeyBytes) {
+			logger.Error("Private and public keys do not match")
+			return data_model.User{}, nil, errors.New("Private and public keys do not match")
+		}
+		if !bytes.Equal(privateKeyBytes, user.GetPrivateKey().KeyBytes) {
+			rotatePrivateKey = true
+			newUser.PrivateKeyB64 = crypto.EncodeToB64String(privateKeyBytes)
+			newUser.PrivateKey, _ = privateKey.(*rsa.PrivateKey)
+			newUser.PublicKeyB64 = crypto.EncodeToB64String(publicKeyBytes)
+			newUser.PublicKey, _ = publicKey.(*rsa.PublicKey)
+		}
+	}
+
+	// new sym key
+	if len(newKeys.SymKey) > 0 {
+		symKeyBytes, err := crypto.DecodeStringB64(newKeys.SymKey)
+		if err != nil || !crypto.ValidateSymKey(symKeyBytes) {
+			custom_err := &custom_errors.InvalidKeyError{KeyId: user.GetSymKeyId()}
+			logger.Errorf("%v: %v", custom_err, err)
+			return data_model.User{}, nil, errors.WithStack(custom_err)
+		}
+		if !bytes.Equal(symKeyBytes, user.SymKey) {
+			rotateSymKey = true
+			newUser.SymKey = symKeyBytes
+			newUser.SymKeyB64 = crypto.EncodeToB64String(symKeyBytes)
+		}
+	}
+
+	if !rotatePrivateKey && !rotateSymKey {
+		logger.Error("No new keys to rotate")
+		return data_model.User{}, nil, errors.New("No new keys to rotate")
+	}
+
+	// rotate keys in the key graph
+	oldKeyList := []data_model.Key{}
+	newKeyList := []data_model.Key{}
+	if rotatePrivateKey {
+		oldKeyList = append(oldKeyList, user.GetPrivateKey(), user.GetPrivateKeyHashSymKey())
+		newKeyList = append(newKeyList, newUser.GetPrivateKey(), newUser.GetPrivateKeyHashSymKey())
+	}
+	if rotateSymKey {
+		oldKeyList = append(oldKeyList, user.GetSymKey(), user.GetLogSymKey())
+		newKeyList = append(newKeyList, newUser.GetSymKey(), newUser.GetLogSymKey())
+	}
+	rotatedKeyIds := []string{}
+	for _, oldKey := range oldKeyList {
+		rotatedKeyIds = append(rotatedKeyIds, oldKey.ID)
+	}
+	err = key_mgmt_i.RotateKeys(stub, oldKeyList, newKeyList)
+	if err != nil {
+		logger.Errorf("Failed to rotate keys of user %v: %v", userId, err)
+		return data_model.User{}, nil, errors.Wrapf(err, "Failed to rotate keys of user %v", userId)
+	}
+
+	// save user asset with the new public key and sym key
+	am := asset_mgmt_i.GetAssetManager(stub, caller)
+	userAsset, err := am.GetAsset(GetUserAssetID(userId), user.GetSymKey())
+	if err != nil || userAsset == nil || len(userAsset.AssetId) == 0 {
+		custom_err := &custom_errors.GetUserError{ID: userId}
+		logger.Errorf("%v: %v", custom_err, err)
+		return data_model.User{}, nil, errors.WithStack(custom_err)
+	}
+	userAsset.PublicData = getPublicData(newUser)
+	err = asset_mgmt_i.ReplaceAssetKey(stub, *userAsset, newUser.GetSymKey())
+	if err != nil {
+		logger.Errorf("Failed to save user %v: %v", userId, err)
+		return data_model.User{}, nil, errors.Wrapf(err, "Failed to save user %v", userId)
+	}
+
+	logger.Infof("Successfully rotated keys of user %v", userId)
+	return newUser, rotatedKeyIds, nil
+}
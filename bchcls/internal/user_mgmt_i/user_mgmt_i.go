@@ -25,6 +25,7 @@ import (
 	"common/bchcls/simple_rule"
 	"common/bchcls/utils"
 
+	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -131,7 +132,8 @@ func ConvertFromAsset(asset *data_model.Asset) data_model.User {
 		u.SolutionPrivateData = privateData.SolutionPrivateData
 	}
 
-	u.PublicKey, _ = crypto.ParsePublicKeyB64(u.PublicKeyB64)
+	publicKey, _ := crypto.ParseAnyPublicKeyB64(u.PublicKeyB64)
+	u.PublicKey, _ = publicKey.(*rsa.PublicKey)
 	u.PrivateKey = nil
 	u.SymKey = nil
 
@@ -264,7 +266,8 @@ func GetUserData(stub cached_stub.CachedStubInterface, caller data_model.User, u
 		privKey, _ := GetUserPrivateKey(stub, caller, userID, assetPrivkeyPath)
 		if len(privKey.KeyBytes) > 0 {
 			userToReturn.PrivateKeyB64 = crypto.EncodeToB64String(privKey.KeyBytes)
-			userToReturn.PrivateKey, _ = crypto.ParsePrivateKey(privKey.KeyBytes)
+			privateKey, _ := crypto.ParseAnyPrivateKey(privKey.KeyBytes)
+			userToReturn.PrivateKey, _ = privateKey.(*rsa.PrivateKey)
 		} else {
 			logger.Warningf("Unable to get private key of the user %v", userID)
 		}
@@ -321,6 +324,9 @@ func commitToLedger(stub cached_stub.CachedStubInterface,
 // ==================================================================================
 
 // GetCallerData gets keys from TMAP and returns the caller's data from the ledger.
+// KMS key IDs in TMAP are only used for registered callers, and must match the KMS key IDs in the caller's user data.
+// The sym key is obtained first, since the KMS key IDs are in the caller's private data, which can only be
+// decrypted with the caller's own sym key.
 func GetCallerData(stub cached_stub.CachedStubInterface) (data_model.User, error) {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 
@@ -333,36 +339,18 @@ func GetCallerData(stub cached_stub.CachedStubInterface) (data_model.User, error
 		return caller, errors.New("Unable to get Transient Map")
 	}
 
-	// get priv key
-	prk1, ok := tmap["prvkey"]
-	if ok != true || prk1 == nil {
-		logger.Error("Unable to get prvkey from transient")
-		return caller, errors.New("Unable to parse private key from transitent")
-	}
-	privateKeyB64 := base64.StdEncoding.EncodeToString(prk1)
-	privkey, err := crypto.ParsePrivateKeyB64(privateKeyB64)
-	if err != nil || privkey == nil {
-		logger.Errorf("Unable to parse prvkey from transient: %v", err)
-		return caller, errors.New("Unable to parse private key from transitent")
-	}
-
-	// get pub key
-	puk1, ok := tmap["pubkey"]
-	if ok != true || puk1 == nil {
-		logger.Error("Unable to get pubkey from transient")
-		return caller, errors.New("Unable to get public key from transitent")
-	}
-	publicKeyB64 := base64.StdEncoding.EncodeToString(puk1)
-	pubkey, err := crypto.ParsePublicKeyB64(publicKeyB64)
-	if err != nil || pubkey == nil {
-		logger.Errorf("Unable to parse pubkey from transient: %v", err)
-		return caller, errors.New("Unable to parse public key from transitent")
+	certid, ok := tmap["id"]
+	if ok != true || certid == nil {
+		logger.Error("Unable to get id from transient")
+		return caller, errors.New("Unable to get id from transitent")
 	}
+	caller.ID = string(certid[:])
+	caller.Role = ""
 
 	//get sym key
-	sym1, ok := tmap["symkey"]
-	if ok != true || sym1 == nil {
-		logger.Error("Unable to get symkey from transient")
+	sym1, err := getTransientKey(stub, tmap, "symkey", "kmssymkeyid")
+	if err != nil || sym1 == nil {
+		logger.Errorf("Unable to get symkey from transient: %v", err)
 		return caller, errors.New("Unable to get sym key from transitent")
 	}
 	symKeyB64 := base64.StdEncoding.EncodeToString(sym1)
@@ -371,19 +359,6 @@ func GetCallerData(stub cached_stub.CachedStubInterface) (data_model.User, error
 		logger.Errorf("Unable to parse symkey from transient: %v", err)
 		return caller, errors.New("Unable to parse sym key from transitent")
 	}
-
-	certid, ok := tmap["id"]
-	if ok != true || certid == nil {
-		logger.Error("Unable to get id from transient")
-		return caller, errors.New("Unable to get id from transitent")
-	}
-
-	caller.ID = string(certid[:])
-	caller.Role = ""
-	caller.PrivateKey = privkey
-	caller.PrivateKeyB64 = privateKeyB64
-	caller.PublicKey = pubkey
-	caller.PublicKeyB64 = publicKeyB64
 	caller.SymKey = symkey
 	caller.SymKeyB64 = symKeyB64
 
@@ -409,15 +384,65 @@ func GetCallerData(stub cached_stub.CachedStubInterface) (data_model.User, error
 	}
 	logger.Debugf("checkUserInfo: %v %v", function, checkUserInfo)
 
+	// the caller's private data can only be decrypted with the caller's sym key
 	userInfo, err := GetUserData(stub, caller, caller.ID, false, true)
-
+	userFound := err == nil
 	if err != nil {
 		logger.Errorf("Unable to get user: %v", err)
 		if checkUserInfo {
 			return caller, errors.New("Unable to get user")
 		}
+	}
 
-	} else {
+	// KMS key IDs must belong to the caller
+	kmsKeyIds := map[string]string{
+		"kmssymkeyid": userInfo.KmsSymKeyId,
+		"kmsprvkeyid": userInfo.KmsPrivateKeyId,
+		"kmspubkeyid": userInfo.KmsPublicKeyId,
+	}
+	for keyName, kmsKeyIdName := range map[string]string{"symkey": "kmssymkeyid", "prvkey": "kmsprvkeyid", "pubkey": "kmspubkeyid"} {
+		if key, ok := tmap[keyName]; ok && key != nil {
+			continue
+		}
+		if !userFound || len(kmsKeyIds[kmsKeyIdName]) == 0 || string(tmap[kmsKeyIdName]) != kmsKeyIds[kmsKeyIdName] {
+			logger.Errorf("The %v in transient does not match the caller's user data", kmsKeyIdName)
+			return data_model.User{}, errors.Errorf("The %v in transient does not match the caller's user data", kmsKeyIdName)
+		}
+	}
+
+	// get priv key
+	prk1, err := getTransientKey(stub, tmap, "prvkey", "kmsprvkeyid")
+	if err != nil || prk1 == nil {
+		logger.Errorf("Unable to get prvkey from transient: %v", err)
+		return caller, errors.New("Unable to parse private key from transitent")
+	}
+	privateKeyB64 := base64.StdEncoding.EncodeToString(prk1)
+	privkey, err := crypto.ParseAnyPrivateKeyB64(privateKeyB64)
+	if err != nil || privkey == nil {
+		logger.Errorf("Unable to parse prvkey from transient: %v", err)
+		return caller, errors.New("Unable to parse private key from transitent")
+	}
+
+	// get pub key
+	puk1, err := getTransientKey(stub, tmap, "pubkey", "kmspubkeyid")
+	if err != nil || puk1 == nil {
+		logger.Errorf("Unable to get pubkey from transient: %v", err)
+		return caller, errors.New("Unable to get public key from transitent")
+	}
+	publicKeyB64 := base64.StdEncoding.EncodeToString(puk1)
+	pubkey, err := crypto.ParseAnyPublicKeyB64(publicKeyB64)
+	if err != nil || pubkey == nil {
+		logger.Errorf("Unable to parse pubkey from transient: %v", err)
+		return caller, errors.New("Unable to parse public key from transitent")
+	}
+
+	// PrivateKey and PublicKey are only set for RSA keys
+	caller.PrivateKey, _ = privkey.(*rsa.PrivateKey)
+	caller.PrivateKeyB64 = privateKeyB64
+	caller.PublicKey, _ = pubkey.(*rsa.PublicKey)
+	caller.PublicKeyB64 = publicKeyB64
+
+	if userFound {
 		caller.Email = userInfo.Email
 		caller.IsGroup = userInfo.IsGroup
 		caller.Name = userInfo.Name
@@ -436,6 +461,50 @@ func GetCallerData(stub cached_stub.CachedStubInterface) (data_model.User, error
 	return caller, nil
 }
 
+// getTransientKey returns the key in the keyName transient map entry.
+// If there is no such entry, it gets the key from the registered key provider using
+// the KMS key ID in the kmsKeyIdName transient map entry.
+func getTransientKey(stub cached_stub.CachedStubInterface, tmap map[string][]byte, keyName string, kmsKeyIdName string) ([]byte, error) {
+	if key, ok := tmap[keyName]; ok && key != nil {
+		return key, nil
+	}
+	kmsKeyId, ok := tmap[kmsKeyIdName]
+	if !ok || len(kmsKeyId) == 0 {
+		return nil, errors.Errorf("Neither %v nor %v found in transient map", keyName, kmsKeyIdName)
+	}
+	return key_mgmt_i.GetKeyByKmsId(stub, string(kmsKeyId))
+}
+
+// getUserKeysFromKeyProvider sets the user's missing private, public, and sym keys
+// using the user's KMS key IDs.
+func getUserKeysFromKeyProvider(stub cached_stub.CachedStubInterface, user *data_model.User) error {
+	if len(user.PrivateKeyB64) == 0 && len(user.KmsPrivateKeyId) > 0 {
+		keyBytes, err := key_mgmt_i.GetKeyByKmsId(stub, user.KmsPrivateKeyId)
+		if err != nil {
+			logger.Errorf("Failed to get private key of user %v from key provider: %v", user.ID, err)
+			return errors.Wrapf(err, "Failed to get private key of user %v from key provider", user.ID)
+		}
+		user.PrivateKeyB64 = crypto.EncodeToB64String(keyBytes)
+	}
+	if len(user.PublicKeyB64) == 0 && len(user.KmsPublicKeyId) > 0 {
+		keyBytes, err := key_mgmt_i.GetKeyByKmsId(stub, user.KmsPublicKeyId)
+		if err != nil {
+			logger.Errorf("Failed to get public key of user %v from key provider: %v", user.ID, err)
+			return errors.Wrapf(err, "Failed to get public key of user %v from key provider", user.ID)
+		}
+		user.PublicKeyB64 = crypto.EncodeToB64String(keyBytes)
+	}
+	if len(user.SymKeyB64) == 0 && len(user.KmsSymKeyId) > 0 {
+		keyBytes, err := key_mgmt_i.GetKeyByKmsId(stub, user.KmsSymKeyId)
+		if err != nil {
+			logger.Errorf("Failed to get sym key of user %v from key provider: %v", user.ID, err)
+			return errors.Wrapf(err, "Failed to get sym key of user %v from key provider", user.ID)
+		}
+		user.SymKeyB64 = crypto.EncodeToB64String(keyBytes)
+	}
+	return nil
+}
+
 // RegisterUser registers or updates a user.
 //
 // args = [ user, allowAccess ]
@@ -529,7 +598,15 @@ func registerUserInternal(stub cached_stub.CachedStubInterface, caller data_mode
 		logger.Debug("Got UserKey from caller")
 	}
 
-	// 2. if existing user, try to get symkey and public key from ledger
+	// 2. if new user, get keys that were not provided from the key provider
+	if !existingUser {
+		err = getUserKeysFromKeyProvider(stub, &user)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 3. if existing user, try to get symkey and public key from ledger
 	if existingUser {
 		logger.Debug("trying to get user sym keys from ledger")
 		userSymKey, err := GetUserSymKey(stub, caller, user.ID)
@@ -562,22 +639,30 @@ func registerUserInternal(stub cached_stub.CachedStubInterface, caller data_mode
 	}
 
 	// Now, parse keys
+	// Keys can be RSA, EC P-256, or Ed25519 keys. PrivateKey and PublicKey are only set for RSA keys.
 	if len(user.PrivateKeyB64) > 0 {
-		privateKey, err := crypto.ParsePrivateKeyB64(user.PrivateKeyB64)
+		privateKey, err := crypto.ParseAnyPrivateKeyB64(user.PrivateKeyB64)
 		if err != nil || privateKey == nil {
 			logger.Errorf("Invalid privte key: %v", err)
 			return errors.Wrap(err, "Invalid private key")
 		} else {
-			user.PrivateKey = privateKey
+			user.PrivateKey, _ = privateKey.(*rsa.PrivateKey)
 		}
 	}
 	if len(user.PublicKeyB64) > 0 {
-		publicKey, err := crypto.ParsePublicKeyB64(user.PublicKeyB64)
+		publicKey, err := crypto.ParseAnyPublicKeyB64(user.PublicKeyB64)
 		if err != nil || publicKey == nil {
 			logger.Errorf("Invalid public key: %v", err)
 			return errors.Wrap(err, "Invalid public key")
 		} else {
-			user.PublicKey = publicKey
+			user.PublicKey, _ = publicKey.(*rsa.PublicKey)
+		}
+	}
+	if len(user.PrivateKeyB64) > 0 && len(user.PublicKeyB64) > 0 {
+		privateKeyBytes, _ := crypto.DecodeStringB64(user.PrivateKeyB64)
+		if crypto.GetKeyType(privateKeyBytes) != user.GetKeyType() {
+			logger.Errorf("Private and public key types do not match")
+			return errors.New("Private and public key types do not match")
 		}
 	}
 	if len(user.SymKeyB64) > 0 {
@@ -745,7 +830,8 @@ func getUpdatedUserObject(existingPublicData data_model.UserPublicData, existing
 	newUser.Role = existingPublicData.Role
 	newUser.IsGroup = existingPublicData.IsGroup
 	newUser.PublicKeyB64 = existingPublicData.PublicKeyB64
-	newUser.PublicKey, _ = crypto.ParsePublicKeyB64(existingPublicData.PublicKeyB64)
+	publicKey, _ := crypto.ParseAnyPublicKeyB64(existingPublicData.PublicKeyB64)
+	newUser.PublicKey, _ = publicKey.(*rsa.PublicKey)
 	newUser.KmsPrivateKeyId = existingPrivateData.KmsPrivateKeyId
 	newUser.KmsPublicKeyId = existingPrivateData.KmsPublicKeyId
 	newUser.KmsSymKeyId = existingPrivateData.KmsSymKeyId
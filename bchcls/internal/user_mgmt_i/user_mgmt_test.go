@@ -22,12 +22,17 @@ import (
 	"common/bchcls/internal/datatype_i"
 	"common/bchcls/internal/key_mgmt_i"
 	"common/bchcls/internal/user_mgmt_i/user_mgmt_c"
+	"common/bchcls/key_mgmt/key_provider"
 	"common/bchcls/test_utils"
 	"common/bchcls/utils"
 
+	"bytes"
 	"crypto/rsa"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"runtime/debug"
 	"strconv"
@@ -38,6 +43,24 @@ import (
 	//"github.com/pkg/errors"
 )
 
+// transientMockStub returns tmap as the transient map of every transaction.
+type transientMockStub struct {
+	*test_utils.NewMockStub
+	tmap map[string][]byte
+	args []string
+}
+
+func (stub *transientMockStub) GetTransient() (map[string][]byte, error) {
+	return stub.tmap, nil
+}
+
+func (stub *transientMockStub) GetFunctionAndParameters() (string, []string) {
+	if len(stub.args) == 0 {
+		return stub.NewMockStub.GetFunctionAndParameters()
+	}
+	return stub.args[0], stub.args[1:]
+}
+
 // Call this before each test for stub setup
 func setup(t *testing.T) *test_utils.NewMockStub {
 	mstub := test_utils.CreateNewMockStub(t)
@@ -448,6 +471,69 @@ func TestRegisterSubgroup(t *testing.T) {
 	mstub.MockTransactionEnd("t1")
 }
 
+// Tests RegisterSubgroup and RemoveSubgroupFromGroup with EC keys
+func TestRegisterSubgroup_ECKeys(t *testing.T) {
+	logger.Info("TestRegisterSubgroup_ECKeys function called")
+	mstub := setup(t)
+
+	// Register parentOrg with EC P-256 keys
+	parentOrg := createTestGroupWithKeyType("parentOrg", global.KEY_TYPE_EC_P256)
+	parentOrgBytes, _ := json.Marshal(&parentOrg)
+	args := []string{string(parentOrgBytes), "false"}
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	_, err := RegisterOrg(stub, parentOrg, args)
+	mstub.MockTransactionEnd("t1")
+	test_utils.AssertTrue(t, err == nil, "RegisterOrg should be successful")
+
+	// Register subOrg with Ed25519 keys
+	subOrg := createTestGroupWithKeyType("subOrg", global.KEY_TYPE_ED25519)
+	subOrgBytes, _ := json.Marshal(&subOrg)
+	args = []string{string(subOrgBytes), parentOrg.ID}
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, err = RegisterSubgroup(stub, parentOrg, args)
+	test_utils.AssertTrue(t, err == nil, "RegisterSubgroup should be successful")
+	mstub.MockTransactionEnd("t2")
+
+	// Confirm that subgroup exists and parentOrg can get its private key
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	subgroupIDs, err := SlowGetSubgroups(stub, parentOrg.ID)
+	test_utils.AssertTrue(t, err == nil, "GetSubgroups should be successful")
+	test_utils.AssertTrue(t, len(subgroupIDs) == 1 && subgroupIDs[0] == subOrg.ID, "GetSubgroups should have returned subOrg.ID")
+	ledgerSubgroup, err := GetUserData(stub, parentOrg, subOrg.ID, true, false)
+	test_utils.AssertTrue(t, err == nil, "GetUserData should be successful")
+	test_utils.AssertTrue(t, ledgerSubgroup.PrivateKeyB64 == subOrg.PrivateKeyB64, "Expected subOrg private key")
+	test_utils.AssertTrue(t, ledgerSubgroup.GetKeyType() == global.KEY_TYPE_ED25519, "Expected Ed25519 key type")
+	mstub.MockTransactionEnd("t3")
+
+	// Remove subgroup
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	err = RemoveSubgroupFromGroup(stub, parentOrg, subOrg.ID, parentOrg.ID)
+	test_utils.AssertTrue(t, err == nil, "RemoveSubgroupFromGroup should be successful")
+	mstub.MockTransactionEnd("t4")
+
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	subgroupIDs, err = SlowGetSubgroups(stub, parentOrg.ID)
+	test_utils.AssertTrue(t, err == nil, "GetSubgroups should be successful")
+	test_utils.AssertTrue(t, len(subgroupIDs) == 0, "Expected no subgroups")
+	mstub.MockTransactionEnd("t5")
+}
+
+// createTestGroupWithKeyType creates a test group with random keys of the given key type.
+func createTestGroupWithKeyType(groupID string, keyType string) data_model.User {
+	testGroup := test_utils.CreateTestGroup(groupID)
+	testUser := test_utils.CreateTestUserWithKeyType(groupID, keyType)
+	testGroup.PrivateKey = nil
+	testGroup.PrivateKeyB64 = testUser.PrivateKeyB64
+	testGroup.PublicKey = nil
+	testGroup.PublicKeyB64 = testUser.PublicKeyB64
+	return testGroup
+}
+
 // Tests RegisterSubgroup
 func TestRegisterSubgroup_MissingKeys(t *testing.T) {
 	logger.Info("TestRegisterSubgroup function called")
@@ -1563,6 +1649,192 @@ func TestRegisterUser(t *testing.T) {
 	mstub.MockTransactionEnd("t1")
 }
 
+func TestRegisterUser_ECKeys(t *testing.T) {
+	logger.Info("TestRegisterUser_ECKeys function called")
+	mstub := setup(t)
+
+	// Register an RSA caller
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	caller := test_utils.CreateTestUser("callerID")
+	callerBytes, _ := json.Marshal(&caller)
+	_, err := RegisterUser(stub, caller, []string{string(callerBytes), "false"})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	for _, keyType := range []string{global.KEY_TYPE_EC_P256, global.KEY_TYPE_ED25519} {
+		// Register a user with EC keys and allow access from caller
+		mstub.MockTransactionStart("t1")
+		stub = cached_stub.NewCachedStub(mstub)
+		user1 := test_utils.CreateTestUserWithKeyType("user_"+keyType, keyType)
+		test_utils.AssertTrue(t, user1.GetKeyType() == keyType, "Expected user key type "+keyType)
+		userBytes, _ := json.Marshal(&user1)
+		_, err = RegisterUser(stub, caller, []string{string(userBytes), "true"})
+		test_utils.AssertTrue(t, err == nil, "Expected RegisterUser to succeed")
+		mstub.MockTransactionEnd("t1")
+
+		mstub.MockTransactionStart("t1")
+		stub = cached_stub.NewCachedStub(mstub)
+		// user's sym key can be decrypted with the user's EC private key
+		symKey, err := key_mgmt_i.SlowVerifyAccessAndGetKey(stub, user1.GetPubPrivKeyId(), user1.GetPrivateKey().KeyBytes, user1.GetSymKeyId())
+		test_utils.AssertTrue(t, err == nil, "Expected SlowVerifyAccessAndGetKey to succeed")
+		test_utils.AssertTrue(t, bytes.Equal(symKey, user1.SymKey), "Expected user sym key")
+
+		returnedUser, err := GetUserData(stub, user1, user1.ID, true, true)
+		test_utils.AssertTrue(t, err == nil, "Expected GetUserData to succeed")
+		test_utils.AssertTrue(t, returnedUser.PublicKeyB64 == user1.PublicKeyB64, "Expected EC public key")
+		test_utils.AssertTrue(t, returnedUser.GetKeyType() == keyType, "Expected user key type "+keyType)
+		test_utils.AssertTrue(t, returnedUser.PublicKey == nil, "Expected no RSA public key")
+
+		// caller can still read user data
+		returnedUser, err = GetUserData(stub, caller, user1.ID, false, true)
+		test_utils.AssertTrue(t, err == nil, "Expected GetUserData to succeed")
+		test_utils.AssertTrue(t, returnedUser.Email == user1.Email, "Expected user private data")
+		mstub.MockTransactionEnd("t1")
+	}
+
+	// Mismatching key types should fail
+	mstub.MockTransactionStart("t1")
+	stub = cached_stub.NewCachedStub(mstub)
+	user2 := test_utils.CreateTestUserWithKeyType("userID2", global.KEY_TYPE_EC_P256)
+	user2.PublicKeyB64 = caller.PublicKeyB64
+	userBytes, _ := json.Marshal(&user2)
+	_, err = RegisterUser(stub, caller, []string{string(userBytes), "false"})
+	test_utils.AssertTrue(t, err != nil, "Expected RegisterUser to fail")
+	mstub.MockTransactionEnd("t1")
+}
+
+func TestGetCallerData_KeyProvider(t *testing.T) {
+	logger.Info("TestGetCallerData_KeyProvider function called")
+	mstub := setup(t)
+
+	// Store user keys in a local file key provider
+	user1 := test_utils.CreateTestUser("user1")
+	user2 := test_utils.CreateTestUserWithKeyType("user2", global.KEY_TYPE_EC_P256)
+	dir, err := ioutil.TempDir("", "key_provider")
+	test_utils.AssertTrue(t, err == nil, "Expected TempDir to succeed")
+	defer os.RemoveAll(dir)
+	for _, user := range []data_model.User{user1, user2} {
+		ioutil.WriteFile(filepath.Join(dir, user.ID+"-prv"), []byte(user.PrivateKeyB64), 0600)
+		ioutil.WriteFile(filepath.Join(dir, user.ID+"-pub"), []byte(user.PublicKeyB64), 0600)
+		ioutil.WriteFile(filepath.Join(dir, user.ID+"-sym"), []byte(user.SymKeyB64), 0600)
+	}
+	providerType := "test.LocalFile"
+	err = key_mgmt_i.RegisterKeyProviderImpl(providerType, key_provider.LocalFileKeyProviderImpl{Directory: dir})
+	test_utils.AssertTrue(t, err == nil, "Expected RegisterKeyProviderImpl to succeed")
+	err = key_mgmt_i.RegisterKeyProviderImpl(providerType, key_provider.LocalFileKeyProviderImpl{Directory: dir})
+	test_utils.AssertTrue(t, err != nil, "Expected RegisterKeyProviderImpl to fail for an existing type")
+
+	// Register user1 with raw keys and user2 with KMS key IDs only
+	RegisterUserForTest(t, mstub, user1, user1, false)
+	user2Kms := user2
+	user2Kms.PrivateKeyB64 = ""
+	user2Kms.PublicKeyB64 = ""
+	user2Kms.SymKeyB64 = ""
+	user2Kms.SymKey = nil
+	user2Kms.KmsPrivateKeyId = key_provider.GetKmsKeyId(providerType, user2.ID+"-prv")
+	user2Kms.KmsPublicKeyId = key_provider.GetKmsKeyId(providerType, user2.ID+"-pub")
+	user2Kms.KmsSymKeyId = key_provider.GetKmsKeyId(providerType, user2.ID+"-sym")
+	RegisterUserForTest(t, mstub, user1, user2Kms, false)
+
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	returnedUser, err := GetUserData(stub, user2, user2.ID, true, true)
+	test_utils.AssertTrue(t, err == nil, "Expected GetUserData to succeed")
+	test_utils.AssertTrue(t, returnedUser.PublicKeyB64 == user2.PublicKeyB64, "Expected public key from key provider")
+	test_utils.AssertTrue(t, returnedUser.KmsPrivateKeyId == user2Kms.KmsPrivateKeyId, "Expected KMS private key ID")
+	mstub.MockTransactionEnd("t1")
+
+	// Get caller data with KMS key IDs in the transient map
+	tstub := &transientMockStub{NewMockStub: mstub}
+	tstub.tmap = map[string][]byte{
+		"id":          []byte(user2.ID),
+		"kmsprvkeyid": []byte(user2Kms.KmsPrivateKeyId),
+		"kmspubkeyid": []byte(user2Kms.KmsPublicKeyId),
+		"kmssymkeyid": []byte(user2Kms.KmsSymKeyId),
+	}
+	mstub.MockTransactionStart("t1")
+	stub = cached_stub.NewCachedStub(tstub)
+	caller, err := GetCallerData(stub)
+	test_utils.AssertTrue(t, err == nil, "Expected GetCallerData to succeed")
+	test_utils.AssertTrue(t, caller.ID == user2.ID, "Expected caller ID")
+	test_utils.AssertTrue(t, caller.PrivateKeyB64 == user2.PrivateKeyB64, "Expected private key from key provider")
+	test_utils.AssertTrue(t, bytes.Equal(caller.SymKey, user2.SymKey), "Expected sym key from key provider")
+	test_utils.AssertTrue(t, caller.Email == user2.Email, "Expected caller private data")
+	mstub.MockTransactionEnd("t1")
+
+	// Raw keys take precedence over KMS key IDs
+	tstub.tmap = test_utils.GetTransientMapFromUser(user1)
+	tstub.tmap["kmsprvkeyid"] = []byte(user2Kms.KmsPrivateKeyId)
+	mstub.MockTransactionStart("t1")
+	stub = cached_stub.NewCachedStub(tstub)
+	caller, err = GetCallerData(stub)
+	test_utils.AssertTrue(t, err == nil, "Expected GetCallerData to succeed")
+	test_utils.AssertTrue(t, caller.PrivateKeyB64 == user1.PrivateKeyB64, "Expected private key from transient map")
+	mstub.MockTransactionEnd("t1")
+
+	// Unknown key provider type, missing key, and invalid key ID should fail
+	for _, kmsKeyId := range []string{
+		key_provider.GetKmsKeyId("unknownType", user2.ID+"-prv"),
+		key_provider.GetKmsKeyId(providerType, "noKey"),
+		key_provider.GetKmsKeyId(providerType, "../"+user2.ID+"-prv"),
+		user2.ID + "-prv",
+	} {
+		tstub.tmap = map[string][]byte{
+			"id":          []byte(user2.ID),
+			"kmsprvkeyid": []byte(kmsKeyId),
+			"kmspubkeyid": []byte(user2Kms.KmsPublicKeyId),
+			"kmssymkeyid": []byte(user2Kms.KmsSymKeyId),
+		}
+		mstub.MockTransactionStart("t1")
+		stub = cached_stub.NewCachedStub(tstub)
+		_, err = GetCallerData(stub)
+		test_utils.AssertTrue(t, err != nil, "Expected GetCallerData to fail for "+kmsKeyId)
+		mstub.MockTransactionEnd("t1")
+	}
+
+	// KMS key IDs of another user should fail
+	user3 := test_utils.CreateTestUser("user3")
+	RegisterUserForTest(t, mstub, user3, user3, false)
+	for _, tmap := range []map[string][]byte{
+		{
+			"id":          []byte(user3.ID),
+			"kmsprvkeyid": []byte(user2Kms.KmsPrivateKeyId),
+			"kmspubkeyid": []byte(user2Kms.KmsPublicKeyId),
+			"kmssymkeyid": []byte(user2Kms.KmsSymKeyId),
+		},
+		{
+			"id":          []byte(user3.ID),
+			"symkey":      []byte(user3.SymKey),
+			"kmsprvkeyid": []byte(user2Kms.KmsPrivateKeyId),
+			"kmspubkeyid": []byte(user2Kms.KmsPublicKeyId),
+		},
+	} {
+		tstub.tmap = tmap
+		mstub.MockTransactionStart("t1")
+		stub = cached_stub.NewCachedStub(tstub)
+		_, err = GetCallerData(stub)
+		test_utils.AssertTrue(t, err != nil, "Expected GetCallerData to fail for KMS key IDs of another user")
+		mstub.MockTransactionEnd("t1")
+	}
+
+	// KMS key IDs can't be used by a caller that is not registered
+	user4 := test_utils.CreateTestUser("user4")
+	user4Bytes, _ := json.Marshal(&user4)
+	tstub.tmap = map[string][]byte{
+		"id":          []byte(user4.ID),
+		"symkey":      []byte(user4.SymKey),
+		"kmsprvkeyid": []byte(user2Kms.KmsPrivateKeyId),
+		"kmspubkeyid": []byte(user2Kms.KmsPublicKeyId),
+	}
+	tstub.args = []string{"registerUser", string(user4Bytes), "false"}
+	mstub.MockTransactionStart("t1")
+	stub = cached_stub.NewCachedStub(tstub)
+	_, err = GetCallerData(stub)
+	test_utils.AssertTrue(t, err != nil, "Expected GetCallerData to fail for KMS key IDs of an unregistered caller")
+	mstub.MockTransactionEnd("t1")
+}
+
 func TestRegisterUser_OffChain(t *testing.T) {
 	logger.SetLevel(shim.LogDebug)
 	logger.Info("TestRegisterUser_OffChain function called")
@@ -1928,6 +2200,117 @@ func TestGetUserPublicKey(t *testing.T) {
 	mstub.MockTransactionEnd("t1")
 }
 
+func TestRotateUserKeys(t *testing.T) {
+	logger.Info("TestRotateUserKeys function called")
+	mstub := setup(t)
+
+	// Create caller and user, caller has access to the user's keys
+	mstub.MockTransactionStart("t1")
+	stub := cached_stub.NewCachedStub(mstub)
+	caller := test_utils.CreateTestUser("callerID")
+	err := registerUserInternal(stub, caller, caller, false)
+	test_utils.AssertTrue(t, err == nil, "Expected registerUserInternal to succeed")
+	user := test_utils.CreateTestUser("userID")
+	user.Email = "user@example.com"
+	err = registerUserInternal(stub, caller, user, true)
+	test_utils.AssertTrue(t, err == nil, "Expected registerUserInternal to succeed")
+	mstub.MockTransactionEnd("t1")
+
+	// Add an asset owned by the user
+	mstub.MockTransactionStart("t2")
+	stub = cached_stub.NewCachedStub(mstub)
+	asset := data_model.Asset{}
+	asset.AssetId = asset_mgmt_i.GetAssetId("data_model.Asset", "asset1")
+	asset.Datatypes = []string{}
+	asset.Metadata = make(map[string]string)
+	asset.PublicData = []byte(`{"public":"public data"}`)
+	asset.PrivateData = []byte(`{"private":"private data"}`)
+	asset.OwnerIds = []string{user.ID}
+	assetKey := test_utils.GenerateSymKey()
+	assetKeyObj := data_model.Key{ID: "asset1key", KeyBytes: assetKey, Type: global.KEY_TYPE_SYM}
+	err = asset_mgmt_i.GetAssetManager(stub, user).AddAsset(asset, assetKeyObj, true)
+	test_utils.AssertTrue(t, err == nil, "Expected AddAsset to succeed")
+	mstub.MockTransactionEnd("t2")
+
+	// Missing public key
+	newKeyUser := test_utils.CreateTestUserWithKeyType("newKeys", global.KEY_TYPE_EC_P256)
+	mstub.MockTransactionStart("t3")
+	stub = cached_stub.NewCachedStub(mstub)
+	_, _, err = RotateUserKeys(stub, user, user.ID, data_model.Keys{PrivateKey: newKeyUser.PrivateKeyB64})
+	test_utils.AssertTrue(t, err != nil, "Expected RotateUserKeys to fail")
+	_, _, err = RotateUserKeys(stub, user, user.ID, data_model.Keys{})
+	test_utils.AssertTrue(t, err != nil, "Expected RotateUserKeys to fail")
+	mstub.MockTransactionEnd("t3")
+
+	// Rotate private and sym keys
+	mstub.MockTransactionStart("t4")
+	stub = cached_stub.NewCachedStub(mstub)
+	newKeys := data_model.Keys{PrivateKey: newKeyUser.PrivateKeyB64, PublicKey: newKeyUser.PublicKeyB64, SymKey: newKeyUser.SymKeyB64}
+	newUser, rotatedKeyIds, err := RotateUserKeys(stub, user, user.ID, newKeys)
+	test_utils.AssertTrue(t, err == nil, "Expected RotateUserKeys to succeed")
+	test_utils.AssertTrue(t, len(rotatedKeyIds) == 4, "Expected 4 rotated keys")
+	test_utils.AssertTrue(t, newUser.PublicKeyB64 == newKeyUser.PublicKeyB64, "Expected new public key")
+	test_utils.AssertTrue(t, newUser.SymKeyB64 == newKeyUser.SymKeyB64, "Expected new sym key")
+	mstub.MockTransactionEnd("t4")
+
+	// Key IDs are unchanged, old keys no longer work
+	mstub.MockTransactionStart("t5")
+	stub = cached_stub.NewCachedStub(mstub)
+	test_utils.AssertTrue(t, newUser.GetPubPrivKeyId() == user.GetPubPrivKeyId(), "Expected same key id")
+	valid, err := key_mgmt_i.ValidateKey(stub, user.GetPrivateKey(), true)
+	test_utils.AssertTrue(t, err == nil && !valid, "Expected old private key to be invalid")
+	valid, err = key_mgmt_i.ValidateKey(stub, newUser.GetPrivateKeyHashSymKey(), true)
+	test_utils.AssertTrue(t, err == nil && valid, "Expected new private key hash sym key to be valid")
+	valid, err = key_mgmt_i.ValidateKey(stub, newUser.GetLogSymKey(), true)
+	test_utils.AssertTrue(t, err == nil && valid, "Expected new log sym key to be valid")
+	_, err = key_mgmt_i.GetKey(stub, []string{user.GetPubPrivKeyId(), user.GetSymKeyId()}, user.GetPrivateKey().KeyBytes)
+	test_utils.AssertTrue(t, err != nil, "Expected GetKey with old private key to fail")
+	mstub.MockTransactionEnd("t5")
+
+	// User can get own data and asset with new keys
+	mstub.MockTransactionStart("t6")
+	stub = cached_stub.NewCachedStub(mstub)
+	userData, err := GetUserData(stub, newUser, user.ID, true, true)
+	test_utils.AssertTrue(t, err == nil, "Expected GetUserData to succeed")
+	test_utils.AssertTrue(t, userData.PublicKeyB64 == newKeyUser.PublicKeyB64, "Expected new public key")
+	test_utils.AssertTrue(t, userData.Email == user.Email, "Expected to decrypt private data")
+	am := asset_mgmt_i.GetAssetManager(stub, newUser)
+	key, err := am.GetAssetKey(asset.AssetId, []string{newUser.GetPubPrivKeyId(), assetKeyObj.ID})
+	test_utils.AssertTrue(t, err == nil, "Expected GetAssetKey to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(key.KeyBytes, assetKey), "Expected asset key")
+	mstub.MockTransactionEnd("t6")
+
+	// Caller with access can still get the user's new keys
+	mstub.MockTransactionStart("t7")
+	stub = cached_stub.NewCachedStub(mstub)
+	userKeys, err := GetUserKeys(stub, caller, user.ID)
+	test_utils.AssertTrue(t, err == nil, "Expected GetUserKeys to succeed")
+	test_utils.AssertTrue(t, userKeys.PrivateKey == newKeyUser.PrivateKeyB64, "Expected new private key")
+	test_utils.AssertTrue(t, userKeys.SymKey == newKeyUser.SymKeyB64, "Expected new sym key")
+	userPublicKey, err := GetUserPublicKey(stub, caller, user.ID)
+	test_utils.AssertTrue(t, err == nil, "Expected GetUserPublicKey to succeed")
+	test_utils.AssertTrue(t, bytes.Equal(userPublicKey.KeyBytes, newUser.GetPublicKey().KeyBytes), "Expected new public key")
+	mstub.MockTransactionEnd("t7")
+
+	// Caller rotates only the sym key of the user back to the original
+	// The unchanged private and public keys are not rotated
+	mstub.MockTransactionStart("t8")
+	stub = cached_stub.NewCachedStub(mstub)
+	newKeys = data_model.Keys{PrivateKey: newKeyUser.PrivateKeyB64, PublicKey: newKeyUser.PublicKeyB64, SymKey: user.SymKeyB64}
+	newUser, rotatedKeyIds, err = RotateUserKeys(stub, caller, user.ID, newKeys)
+	test_utils.AssertTrue(t, err == nil, "Expected RotateUserKeys to succeed")
+	test_utils.AssertTrue(t, reflect.DeepEqual(rotatedKeyIds, []string{user.GetSymKeyId(), user.GetLogSymKeyId()}), "Expected only sym keys to be rotated")
+	test_utils.AssertTrue(t, newUser.PrivateKeyB64 == newKeyUser.PrivateKeyB64, "Expected private key to stay the same")
+	mstub.MockTransactionEnd("t8")
+
+	mstub.MockTransactionStart("t9")
+	stub = cached_stub.NewCachedStub(mstub)
+	userKeys, err = GetUserKeys(stub, caller, user.ID)
+	test_utils.AssertTrue(t, err == nil, "Expected GetUserKeys to succeed")
+	test_utils.AssertTrue(t, userKeys.SymKey == user.SymKeyB64, "Expected original sym key")
+	mstub.MockTransactionEnd("t9")
+}
+
 func TestGetUsers(t *testing.T) {
 	logger.Info("TestGetUsers function called")
 	mstub := setup(t)
@@ -71,6 +71,7 @@ import (
 	"common/bchcls/internal/common/global"
 	"common/bchcls/internal/key_mgmt_i"
 	"common/bchcls/internal/metering_i"
+	"common/bchcls/key_mgmt/key_provider"
 	"common/bchcls/utils"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
@@ -90,6 +91,28 @@ const KEY_TYPE_PUBLIC = global.KEY_TYPE_PUBLIC
 // KEY_TYPE_SYM is a Key.Type option that specifies a sym key.
 const KEY_TYPE_SYM = global.KEY_TYPE_SYM
 
+// KEY_TYPE_RSA is the asymmetric key type of RSA public and private keys.
+const KEY_TYPE_RSA = global.KEY_TYPE_RSA
+
+// KEY_TYPE_EC_P256 is the asymmetric key type of EC P-256 public and private keys.
+const KEY_TYPE_EC_P256 = global.KEY_TYPE_EC_P256
+
+// KEY_TYPE_ED25519 is the asymmetric key type of Ed25519 public and private keys.
+const KEY_TYPE_ED25519 = global.KEY_TYPE_ED25519
+
+// EDGEDATA_ENCRYPTION_SCHEME is an AddAccess edgeData key that specifies how the target key is encrypted
+// when the start key is a public or private key.
+const EDGEDATA_ENCRYPTION_SCHEME = global.EDGEDATA_ENCRYPTION_SCHEME
+
+// ENCRYPTION_SCHEME_PKCS1V15 is the default EDGEDATA_ENCRYPTION_SCHEME option (RSA PKCS#1 v1.5).
+const ENCRYPTION_SCHEME_PKCS1V15 = global.ENCRYPTION_SCHEME_PKCS1V15
+
+// ENCRYPTION_SCHEME_OAEP is an EDGEDATA_ENCRYPTION_SCHEME option that specifies RSA-OAEP encryption.
+const ENCRYPTION_SCHEME_OAEP = global.ENCRYPTION_SCHEME_OAEP
+
+// ENCRYPTION_SCHEME_HYBRID is an EDGEDATA_ENCRYPTION_SCHEME option that specifies RSA-OAEP wrapped sym key encryption.
+const ENCRYPTION_SCHEME_HYBRID = global.ENCRYPTION_SCHEME_HYBRID
+
 // GetPubPrivKeyId returns the ID that should be assigned to a public or private key.
 func GetPubPrivKeyId(id string) string {
 	return key_mgmt_i.GetPubPrivKeyId(id)
@@ -137,3 +160,23 @@ func VerifyAccessPath(stub cached_stub.CachedStubInterface, path []string) (bool
 
 	return key_mgmt_i.VerifyAccessPath(stub, path)
 }
+
+// RegisterKeyProviderImpl allows a solution to register a KMS or HSM key provider as providerType.
+// Once registered, callers can pass KMS key IDs of the form "<providerType>:<keyId>" in the
+// "kmsprvkeyid", "kmspubkeyid", and "kmssymkeyid" transient map entries instead of raw keys, and users can
+// be registered with KmsPrivateKeyId, KmsPublicKeyId, and KmsSymKeyId instead of raw keys.
+// Key providers must only be registered from the solution's main function, before the chaincode is started,
+// since they are needed to get the caller's keys in GetCallerData. This method is not tied to a caller,
+// so it must never be called while handling a transaction.
+func RegisterKeyProviderImpl(providerType string, implementation key_provider.KeyProviderInterface) error {
+	return key_mgmt_i.RegisterKeyProviderImpl(providerType, implementation)
+}
+
+// GetKeyByKmsId returns the key bytes of the key identified by kmsKeyId from the registered key provider.
+func GetKeyByKmsId(stub cached_stub.CachedStubInterface, kmsKeyId string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return key_mgmt_i.GetKeyByKmsId(stub, kmsKeyId)
+}
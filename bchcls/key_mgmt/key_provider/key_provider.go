@@ -0,0 +1,93 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+// Package key_provider defines the interface used to get user keys from a key management
+// service (KMS) or hardware security module (HSM) instead of passing raw keys in the transient map.
+//
+// A KMS key ID has the format "<providerType>:<keyId>", where providerType is the type
+// the KeyProviderInterface implementation is registered with, and keyId identifies the key
+// within that provider. The KmsPublicKeyId, KmsPrivateKeyId, and KmsSymKeyId fields of
+// data_model.User hold KMS key IDs.
+//
+// This package also includes LocalFileKeyProviderImpl, a file-backed implementation for testing.
+package key_provider
+
+import (
+	"common/bchcls/cached_stub"
+	"common/bchcls/crypto"
+	"common/bchcls/internal/common/global"
+
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// KMS_KEY_ID_SEPARATOR separates the key provider type from the provider's key ID in a KMS key ID.
+const KMS_KEY_ID_SEPARATOR = global.KMS_KEY_ID_SEPARATOR
+
+// KeyProviderInterface needs to be implemented for a specific KMS or HSM to get user keys by KMS key ID.
+type KeyProviderInterface interface {
+	// IsReady is a lightweight test method to see if a key provider is ready for use.
+	// It is called before calling GetKey.
+	IsReady() bool
+
+	// GetKey returns the key bytes of the key identified by keyId.
+	// Private and public keys must be returned in the same format as the "prvkey" and "pubkey"
+	// transient map entries, and sym keys in the same format as the "symkey" entry.
+	// Returns an error if the key does not exist.
+	GetKey(stub cached_stub.CachedStubInterface, keyId string) ([]byte, error)
+}
+
+// GetKmsKeyId returns the KMS key ID of the key identified by keyId in the key provider registered as providerType.
+func GetKmsKeyId(providerType string, keyId string) string {
+	return providerType + KMS_KEY_ID_SEPARATOR + keyId
+}
+
+// ParseKmsKeyId returns the key provider type and the provider's key ID of a KMS key ID.
+func ParseKmsKeyId(kmsKeyId string) (string, string, error) {
+	parts := strings.SplitN(kmsKeyId, KMS_KEY_ID_SEPARATOR, 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", errors.Errorf("Invalid KMS key ID: %v", kmsKeyId)
+	}
+	return parts[0], parts[1], nil
+}
+
+// LocalFileKeyProviderImpl is a KeyProviderInterface implementation that reads keys from files in Directory.
+// Each file is named after its keyId and contains the base64 encoded key.
+// It is meant for testing; keys must not be stored in plain files in production.
+type LocalFileKeyProviderImpl struct {
+	Directory string
+}
+
+// IsReady returns true if Directory exists.
+func (p LocalFileKeyProviderImpl) IsReady() bool {
+	if len(p.Directory) == 0 {
+		return false
+	}
+	files, err := ioutil.ReadDir(p.Directory)
+	return err == nil && files != nil
+}
+
+// GetKey reads and decodes the file named keyId in Directory.
+func (p LocalFileKeyProviderImpl) GetKey(stub cached_stub.CachedStubInterface, keyId string) ([]byte, error) {
+	if len(keyId) == 0 || keyId != filepath.Base(keyId) || keyId == "." || keyId == ".." {
+		return nil, errors.Errorf("Invalid key ID: %v", keyId)
+	}
+	keyB64, err := ioutil.ReadFile(filepath.Join(p.Directory, keyId))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read key %v", keyId)
+	}
+	keyBytes, err := crypto.DecodeStringB64(strings.TrimSpace(string(keyB64)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode key %v", keyId)
+	}
+	return keyBytes, nil
+}
@@ -0,0 +1,95 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+// Package key_recovery handles recovery of user private keys through guardians.
+//
+// A user's private key is split into one share per guardian with Shamir's secret sharing.
+// The client splits the key and passes the shares to SetupKeyRecovery, which checks them and stores
+// each share as an asset that only the guardian can decrypt. If the user loses
+// their private key, any threshold of the guardians can get their shares with GetKeyRecoveryShare.
+// The shares are passed to RecoverUserKeys, which reconstructs the private key and rotates the
+// user's keys to new keys.
+package key_recovery
+
+import (
+	"common/bchcls/cached_stub"
+	"common/bchcls/data_model"
+	"common/bchcls/internal/key_mgmt_i/key_recovery_i"
+	"common/bchcls/internal/metering_i"
+	"common/bchcls/user_mgmt/user_keys"
+	"common/bchcls/utils"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
+)
+
+var logger = shim.NewLogger("key_recovery")
+
+// SetupKeyRecovery stores one share of the private key of user userId for each guardian.
+// shares[i] is the share of guardianIds[i], and any threshold of the shares can be combined to recover the
+// private key. threshold must be at least 2.
+// The client creates the shares with crypto.SplitSecret(privateKey, len(guardianIds), threshold) and passes them
+// to the chaincode in the transient map. They are not created in the chaincode, since the random shares would
+// differ between endorsers. The shares are checked against the user's private key before they are saved.
+// Only the guardian can decrypt their share; the user's sym key is not given access to it.
+// If key recovery was set up before, the shares are replaced, and the shares of guardians who are no longer
+// in guardianIds are deleted. Shares that were already given out remain valid until the user's keys are rotated.
+// SetupKeyRecovery must be called again after the user's keys are rotated.
+// Caller must be the user or must have access to the user's private key.
+func SetupKeyRecovery(stub cached_stub.CachedStubInterface, caller data_model.User, userId string, guardianIds []string, threshold int, shares [][]byte) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return key_recovery_i.SetupKeyRecovery(stub, caller, userId, guardianIds, threshold, shares)
+}
+
+// GetKeyRecoveryPolicy returns the key recovery policy of a user.
+// Returns an empty policy if key recovery was not set up for the user.
+func GetKeyRecoveryPolicy(stub cached_stub.CachedStubInterface, userId string) (data_model.KeyRecoveryPolicy, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return key_recovery_i.GetKeyRecoveryPolicy(stub, userId)
+}
+
+// GetKeyRecoveryShare returns the caller's share of the private key of user userId.
+// Caller must be a guardian of the user.
+func GetKeyRecoveryShare(stub cached_stub.CachedStubInterface, caller data_model.User, userId string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return key_recovery_i.GetKeyRecoveryShare(stub, caller, userId)
+}
+
+// RecoverUserKeys reconstructs the private key of user userId from guardians' shares and rotates
+// the user's keys to newKeys. newKeys must contain a new private and public key, and can contain a new sym key.
+// At least threshold shares are required, and the reconstructed private key must match the user's public key.
+// The rotation is done by user_keys.RotateUserKeys with the user as the caller.
+// Shares should be passed to the chaincode in the transient map, so that they are not saved in the transaction.
+func RecoverUserKeys(stub cached_stub.CachedStubInterface, caller data_model.User, userId string, shares [][]byte, newKeys data_model.Keys) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerId: %v, userId: %v", caller.ID, userId)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	if len(newKeys.PrivateKey) == 0 {
+		logger.Error("New private key is required")
+		return errors.New("New private key is required")
+	}
+
+	user, err := key_recovery_i.RecoverUserPrivateKey(stub, caller, userId, shares)
+	if err != nil {
+		return err
+	}
+	_, err = user_keys.RotateUserKeys(stub, user, userId, newKeys)
+	return err
+}
@@ -107,6 +107,7 @@ type NewMockStub struct {
 	args           [][]byte
 	cc             shim.Chaincode
 	signedProposal *peer.SignedProposal
+	history        map[string][]*queryresult.KeyModification
 }
 
 // GetState returns an item stored in NewMockStub.
@@ -144,7 +145,11 @@ func (stub *NewMockStub) MockTransactionStart(txid string) {
 // MockTransactionEnd returns a transaction ID.
 func (stub *NewMockStub) MockTransactionEnd(txid string) {
 	//save to state
+	if stub.history == nil {
+		stub.history = make(map[string][]*queryresult.KeyModification)
+	}
 	for k, d := range stub.deleted {
+		stub.history[k] = append(stub.history[k], &queryresult.KeyModification{TxId: txid, Value: copyData(stub.cache[k]), Timestamp: stub.TxTimestamp, IsDelete: d})
 		//logger.Debugf("Save to Ledger key:%v delete:%v", k, d)
 		if d == true {
 			err := stub.MockStub.DelState(k)
@@ -182,6 +187,11 @@ func (stub *NewMockStub) GetStateByRange(startKey, endKey string) (shim.StateQue
 	return NewFixedMockStateRangeQueryIterator(stub, startKey, endKey), nil
 }
 
+// GetHistoryForKey returns the values committed for the key by each transaction, oldest first.
+func (stub *NewMockStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &MockHistoryQueryIterator{modifications: stub.history[key]}, nil
+}
+
 // GetTransient returns transient map of the transaction
 func (stub *NewMockStub) GetTransient() (map[string][]byte, error) {
 	return stub.tmap, nil
@@ -377,6 +387,39 @@ func (iter *FixedMockStateRangeQueryIterator) Next() (*queryresult.KV, error) {
 	return nil, errors.New("FixedMockStateRangeQueryIterator.Next() went past end of range")
 }
 
+/*****************************
+ History Query Iterator
+*****************************/
+
+// MockHistoryQueryIterator iterates over the history of a key recorded by NewMockStub.
+type MockHistoryQueryIterator struct {
+	modifications []*queryresult.KeyModification
+	current       int
+	closed        bool
+}
+
+// HasNext returns true if the history query iterator contains additional key modifications.
+func (iter *MockHistoryQueryIterator) HasNext() bool {
+	return !iter.closed && iter.current < len(iter.modifications)
+}
+
+// Next returns the next key modification in the history query iterator.
+func (iter *MockHistoryQueryIterator) Next() (*queryresult.KeyModification, error) {
+	if !iter.HasNext() {
+		logger.Error("MockHistoryQueryIterator.Next() called when it does not HaveNext()")
+		return nil, errors.New("MockHistoryQueryIterator.Next() called when it does not HaveNext()")
+	}
+	modification := iter.modifications[iter.current]
+	iter.current++
+	return modification, nil
+}
+
+// Close closes the history query iterator.
+func (iter *MockHistoryQueryIterator) Close() error {
+	iter.closed = true
+	return nil
+}
+
 // CreateExampleMockStub returns a mock stub without *testing.T object, for use in godoc examples.
 func CreateExampleMockStub() *NewMockStub {
 	stub := shim.NewMockStub("mockStub", new(MockChaincode))
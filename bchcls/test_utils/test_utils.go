@@ -13,6 +13,7 @@
 package test_utils
 
 import (
+	"common/bchcls/crypto"
 	"common/bchcls/data_model"
 	"common/bchcls/internal/common/global"
 
@@ -222,6 +223,28 @@ func CreateTestUser(userID string) data_model.User {
 	return testUser
 }
 
+// CreateTestUserWithKeyType creates a test user with random keys of the given type:
+// global.KEY_TYPE_RSA, global.KEY_TYPE_EC_P256, or global.KEY_TYPE_ED25519.
+func CreateTestUserWithKeyType(userID string, keyType string) data_model.User {
+	testUser := CreateTestUser(userID)
+	var privateKey interface{}
+	switch keyType {
+	case global.KEY_TYPE_EC_P256:
+		privateKey = crypto.GenerateECPrivateKey()
+	case global.KEY_TYPE_ED25519:
+		privateKey = crypto.GenerateEd25519PrivateKey()
+	default:
+		return testUser
+	}
+	privateKeyBytes, _ := crypto.MarshalAnyPrivateKey(privateKey)
+	publicKeyBytes, _ := crypto.MarshalAnyPublicKey(crypto.GetPublicKeyOf(privateKey))
+	testUser.PrivateKey = nil
+	testUser.PrivateKeyB64 = base64.StdEncoding.EncodeToString(privateKeyBytes)
+	testUser.PublicKey = nil
+	testUser.PublicKeyB64 = base64.StdEncoding.EncodeToString(publicKeyBytes)
+	return testUser
+}
+
 // CreateTestGroup creates a test group with random keys.
 func CreateTestGroup(groupID string) data_model.User {
 	testGroup := data_model.User{}
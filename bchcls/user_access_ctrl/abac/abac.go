@@ -0,0 +1,105 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+// Package abac handles attribute-based access policies on top of asset access.
+//
+// An access policy has a read rule and a write rule, simple_rule expressions over the attributes of the caller
+// (role, groups, and solution public data) and of the asset (datatypes, owners, metadata, and public data).
+// The AssetManager evaluates the policy of an asset's namespace, its IndexTableName, in addition to checking
+// the caller's access to the asset key, so a policy can only take access away. System admins are not
+// restricted by access policies.
+package abac
+
+import (
+	"common/bchcls/cached_stub"
+	"common/bchcls/data_model"
+	"common/bchcls/internal/metering_i"
+	"common/bchcls/internal/user_access_ctrl_i/abac_i"
+	"common/bchcls/utils"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var logger = shim.NewLogger("abac")
+
+// PutAccessPolicy adds an access policy or updates the existing access policy of a namespace.
+// Caller must be a system admin.
+//
+// args = [policy]
+//
+// policy is a data_model.AccessPolicy in JSON format.
+func PutAccessPolicy(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return abac_i.PutAccessPolicy(stub, caller, args)
+}
+
+// PutAccessPolicyWithParams adds an access policy or updates the existing access policy of a namespace.
+// It takes a data_model.AccessPolicy as argument instead of args in JSON format.
+// "WithParams" functions should only be called from within the chaincode.
+func PutAccessPolicyWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, policy data_model.AccessPolicy) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, policy: %v", caller.ID, policy)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return abac_i.PutAccessPolicyWithParams(stub, caller, policy)
+}
+
+// GetAccessPolicy returns the access policy of a namespace.
+// Returns an empty access policy if the namespace does not have one.
+//
+// args = [namespace]
+func GetAccessPolicy(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return abac_i.GetAccessPolicy(stub, caller, args)
+}
+
+// GetAccessPolicyWithParams returns the access policy of the given namespace.
+// Returns an empty access policy if the namespace does not have one.
+// "WithParams" functions should only be called from within the chaincode.
+func GetAccessPolicyWithParams(stub cached_stub.CachedStubInterface, namespace string) (data_model.AccessPolicy, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("namespace: %v", namespace)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return abac_i.GetAccessPolicyWithParams(stub, namespace)
+}
+
+// DeleteAccessPolicy deletes the access policy of a namespace.
+// Caller must be a system admin.
+//
+// args = [namespace]
+func DeleteAccessPolicy(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return abac_i.DeleteAccessPolicy(stub, caller, args)
+}
+
+// DeleteAccessPolicyWithParams deletes the access policy of the given namespace.
+// "WithParams" functions should only be called from within the chaincode.
+func DeleteAccessPolicyWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, namespace string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, namespace: %v", caller.ID, namespace)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return abac_i.DeleteAccessPolicyWithParams(stub, caller, namespace)
+}
@@ -0,0 +1,206 @@
+/*******************************************************************************
+ *
+ *
+ * (c) Copyright Merative US L.P. and others 2020-2022 
+ *
+ * SPDX-Licence-Identifier: Apache 2.0
+ *
+ *******************************************************************************/
+
+// Package rbac handles role-based access control on top of user roles and groups.
+//
+// A role is a named set of permissions, such as PERMISSION_INVOKE on function names, or ACCESS_READ and
+// ACCESS_WRITE on asset namespaces. Roles are bound to users and groups with BindRole. A role bound to a group
+// applies to all members of the group and of its subgroups. Solution chaincode calls Authorize to check that
+// the caller has a permission on a resource before performing an operation. System admins have every permission.
+package rbac
+
+import (
+	"common/bchcls/cached_stub"
+	"common/bchcls/data_model"
+	"common/bchcls/internal/common/global"
+	"common/bchcls/internal/metering_i"
+	"common/bchcls/internal/user_access_ctrl_i/rbac_i"
+	"common/bchcls/utils"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var logger = shim.NewLogger("rbac")
+
+// PERMISSION_INVOKE is a RolePermission.Permission option that specifies permission to invoke a function.
+const PERMISSION_INVOKE = global.PERMISSION_INVOKE
+
+// PERMISSION_READ is a RolePermission.Permission option that specifies permission to read assets of a namespace.
+const PERMISSION_READ = global.ACCESS_READ
+
+// PERMISSION_WRITE is a RolePermission.Permission option that specifies permission to write assets of a namespace.
+// It also gives PERMISSION_READ.
+const PERMISSION_WRITE = global.ACCESS_WRITE
+
+// PutRole adds a role or updates an existing role.
+// Caller must be a system admin or have PERMISSION_INVOKE on "PutRole".
+//
+// args = [role]
+//
+// role is a data_model.Role in JSON format.
+func PutRole(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.PutRole(stub, caller, args)
+}
+
+// PutRoleWithParams adds a role or updates an existing role.
+// It takes a data_model.Role as argument instead of args in JSON format.
+// "WithParams" functions should only be called from within the chaincode.
+func PutRoleWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, role data_model.Role) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, role: %v", caller.ID, role)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.PutRoleWithParams(stub, caller, role)
+}
+
+// GetRole returns a role.
+// Returns an empty role if the role does not exist.
+//
+// args = [roleID]
+func GetRole(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.GetRole(stub, caller, args)
+}
+
+// GetRoleWithParams returns the role with the given roleID.
+// Returns an empty role if the role does not exist.
+// "WithParams" functions should only be called from within the chaincode.
+func GetRoleWithParams(stub cached_stub.CachedStubInterface, roleID string) (data_model.Role, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("roleID: %v", roleID)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.GetRoleWithParams(stub, roleID)
+}
+
+// DeleteRole deletes a role and all of its role bindings.
+// Caller must be a system admin or have PERMISSION_INVOKE on "DeleteRole".
+//
+// args = [roleID]
+func DeleteRole(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.DeleteRole(stub, caller, args)
+}
+
+// DeleteRoleWithParams deletes the role with the given roleID and all of its role bindings.
+// "WithParams" functions should only be called from within the chaincode.
+func DeleteRoleWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, roleID string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, roleID: %v", caller.ID, roleID)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.DeleteRoleWithParams(stub, caller, roleID)
+}
+
+// BindRole binds a role to a user or group.
+// A role bound to a group applies to all members of the group and of its subgroups.
+// Caller must be a system admin or have PERMISSION_INVOKE on "BindRole".
+//
+// args = [roleID, principalID]
+//
+// principalID is the ID of the user or group.
+func BindRole(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.BindRole(stub, caller, args)
+}
+
+// BindRoleWithParams binds the role with the given roleID to the user or group with the given principalID.
+// "WithParams" functions should only be called from within the chaincode.
+func BindRoleWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, roleID string, principalID string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, roleID: %v, principalID: %v", caller.ID, roleID, principalID)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.BindRoleWithParams(stub, caller, roleID, principalID)
+}
+
+// UnbindRole removes a role binding from a user or group.
+// Caller must be a system admin or have PERMISSION_INVOKE on "UnbindRole".
+//
+// args = [roleID, principalID]
+func UnbindRole(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.UnbindRole(stub, caller, args)
+}
+
+// UnbindRoleWithParams removes the binding of the role with the given roleID from the user or group
+// with the given principalID.
+// "WithParams" functions should only be called from within the chaincode.
+func UnbindRoleWithParams(stub cached_stub.CachedStubInterface, caller data_model.User, roleID string, principalID string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, roleID: %v, principalID: %v", caller.ID, roleID, principalID)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.UnbindRoleWithParams(stub, caller, roleID, principalID)
+}
+
+// GetRoleIDs returns the IDs of the roles bound directly to a user or group.
+// Roles the user gets from the groups it's a member of are not included.
+//
+// args = [principalID]
+func GetRoleIDs(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, args: %v", caller.ID, args)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.GetRoleIDs(stub, caller, args)
+}
+
+// GetRoleIDsWithParams returns the IDs of the roles bound directly to the user or group with the given principalID.
+// "WithParams" functions should only be called from within the chaincode.
+func GetRoleIDsWithParams(stub cached_stub.CachedStubInterface, principalID string) ([]string, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("principalID: %v", principalID)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.GetRoleIDsWithParams(stub, principalID)
+}
+
+// Authorize returns nil if the caller has permission on resource, and an AuthorizationError otherwise.
+// System admins have every permission. Other callers have the permissions of the roles bound to them,
+// and of the roles bound to the groups they're a direct or indirect member of.
+//
+// permission is PERMISSION_INVOKE for a function name, ACCESS_READ or ACCESS_WRITE for an asset namespace,
+// or any permission defined by the solution.
+func Authorize(stub cached_stub.CachedStubInterface, caller data_model.User, permission string, resource string) error {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerID: %v, permission: %v, resource: %v", caller.ID, permission, resource)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	return rbac_i.Authorize(stub, caller, permission, resource)
+}
@@ -42,6 +42,10 @@ const ACCESS_WRITE = global.ACCESS_WRITE
 // ACCESS_WRITE_ONLY is an AccessControl.Access option that specifies write access without read access.
 const ACCESS_WRITE_ONLY = global.ACCESS_WRITE_ONLY
 
+// ACCESS_DENY is an AccessControl.Access option that specifies a deny entry, which takes precedence over any
+// access path to the asset.
+const ACCESS_DENY = global.ACCESS_DENY
+
 // EDGEDATA_ACCESS_TYPE is a key used in edgeData (of type map[string]string).
 const EDGEDATA_ACCESS_TYPE = global.EDGEDATA_ACCESS_TYPE
 
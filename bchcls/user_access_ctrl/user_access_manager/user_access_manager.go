@@ -30,6 +30,9 @@ type UserAccessManager interface {
 	// Write access is given by adding read access and setting its access type of access graph edge data to "write".
 	// Adding write access will give both read and write access.
 	// If the asset already exists, there is no need to provide accessControl.AssetKey. This function will retrieve it.
+	// If accessControl.Access is ACCESS_DENY, a deny entry is added for the user or group instead, which takes
+	// precedence over any access path to the asset.
+	// If accessControl.NotBefore or accessControl.ExpirationDate is set, the access is only in effect between them.
 	AddAccess(accessControl data_model.AccessControl) error
 
 	// AddAccessByKey adds read access from startKey to targetKey.
@@ -42,6 +45,7 @@ type UserAccessManager interface {
 	// Write access is removed by removing user as an asset owner.
 	// Removing read access will remove both read and write access.
 	// Removing write access will keep read access.
+	// If accessControl.Access is ACCESS_DENY, the deny entry of the user or group is removed.
 	// Caller must be asset owner.
 	RemoveAccess(accessControl data_model.AccessControl) error
 
@@ -76,6 +80,8 @@ type UserAccessManager interface {
 	//  2. user has a read consent for the asset
 	//  3. user has a read consent for a datatype of the asset
 	//  5. user is a direct admin of a group that has read access
+	//
+	// In all cases, it returns false if the user or one of the user's groups has a deny entry for the asset.
 	CheckAccess(accessControl data_model.AccessControl) (bool, error)
 
 	// GetAccessData returns an access control object for the userId and assetId.
@@ -84,6 +90,8 @@ type UserAccessManager interface {
 
 	// SlowCheckAccessToKey traverses the path from caller to targetKey in the key graph.
 	// Returns an access path and filters.
+	// Keys the caller or one of the caller's groups has a deny entry for are not traversed.
+	// Time-bound access edges that are not in effect are not traversed either.
 	SlowCheckAccessToKey(targetKeyID string) ([]string, data_model.AccessControlFilters, error)
 
 	// GetKey returns a key given keyID.
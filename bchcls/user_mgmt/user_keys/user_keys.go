@@ -13,11 +13,15 @@ package user_keys
 import (
 	"common/bchcls/cached_stub"
 	"common/bchcls/data_model"
+	"common/bchcls/internal/asset_mgmt_i"
+	"common/bchcls/internal/common/global"
+	"common/bchcls/internal/history_i"
 	"common/bchcls/internal/metering_i"
 	"common/bchcls/internal/user_mgmt_i"
 	"common/bchcls/utils"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
 )
 
 var logger = shim.NewLogger("user_keys")
@@ -89,3 +93,50 @@ func ConvertAdminPathToSymKeyPath(adminPath []string) (keyPath []string, err err
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 	return user_mgmt_i.ConvertAdminPathToSymKeyPath(adminPath)
 }
+
+// RotateUserKeys replaces a user's private/public key pair and/or sym key, for example after the keys were compromised.
+// Caller must be the user or must have access to the user's private and sym keys.
+// newKeys contains base64 encoded keys; empty fields are not rotated. If a new private key is given,
+// the matching public key must also be given.
+// Key IDs stay the same, and every key graph edge from and to the user's old keys is re-encrypted with the new keys.
+// Keys in newKeys that are the same as the user's current keys are not rotated.
+// Returns the user with the new keys.
+// The rotation is recorded in a transaction log encrypted with the user's new log sym key. The log's Data
+// is the list of rotated key IDs, Field1 is the userId, and Field2 is the user's new public key.
+// If the caller is the user, the caller must use the new keys in subsequent transactions.
+// Transaction logs recorded before a sym key rotation remain encrypted with the previous log sym key.
+func RotateUserKeys(stub cached_stub.CachedStubInterface, caller data_model.User, userId string, newKeys data_model.Keys) (data_model.User, error) {
+	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
+	logger.Debugf("callerId: %v, userId: %v", caller.ID, userId)
+
+	_ = metering_i.SetEnvAndAddRow(stub)
+
+	user, rotatedKeyIds, err := user_mgmt_i.RotateUserKeys(stub, caller, userId, newKeys)
+	if err != nil {
+		return data_model.User{}, err
+	}
+
+	// record the rotation
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		logger.Errorf("Failed to get transaction timestamp: %v", err)
+		return data_model.User{}, errors.Wrap(err, "Failed to get transaction timestamp")
+	}
+	transactionLog := data_model.TransactionLog{
+		TransactionID: stub.GetTxID(),
+		Namespace:     global.USER_ASSET_NAMESPACE,
+		FunctionName:  "RotateUserKeys",
+		CallerID:      caller.ID,
+		Timestamp:     txTimestamp.GetSeconds(),
+		Data:          rotatedKeyIds,
+		Field1:        userId,
+		Field2:        user.PublicKeyB64,
+	}
+	historyManager := history_i.GetHistoryManager(asset_mgmt_i.GetAssetManager(stub, caller))
+	err = historyManager.PutInvokeTransactionLog(transactionLog, user.GetLogSymKey())
+	if err != nil {
+		logger.Errorf("Failed to save key rotation log for user %v: %v", userId, err)
+		return data_model.User{}, errors.Wrapf(err, "Failed to save key rotation log for user %v", userId)
+	}
+	return user, nil
+}
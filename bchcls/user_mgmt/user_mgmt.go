@@ -114,6 +114,10 @@ func GetUserData(stub cached_stub.CachedStubInterface, caller data_model.User, u
 // ==================================================================================
 
 // GetCallerData gets keys from TMAP and returns the caller's data from the ledger.
+// If the "prvkey", "pubkey", or "symkey" entry is missing, the key is obtained from a key provider
+// registered via key_mgmt.RegisterKeyProviderImpl, using the KMS key ID in the "kmsprvkeyid",
+// "kmspubkeyid", or "kmssymkeyid" entry respectively. KMS key IDs are only accepted for registered callers,
+// and must match the KMS key IDs in the caller's user data. A caller that is registering itself must pass raw keys.
 func GetCallerData(stub cached_stub.CachedStubInterface) (data_model.User, error) {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 
@@ -129,6 +133,8 @@ func GetCallerData(stub cached_stub.CachedStubInterface) (data_model.User, error
 // user is the data_model.User to add or update.
 // If allowAccess is true and a new user is being registered, gives the caller access to the user's private key.
 // If allowAccess is true and a new group is being registered, makes the caller an admin of the group.
+// Keys of a new user that are not provided are obtained from the registered key provider using the
+// user's KmsPrivateKeyId, KmsPublicKeyId, and KmsSymKeyId.
 func RegisterUser(stub cached_stub.CachedStubInterface, caller data_model.User, args []string) ([]byte, error) {
 	defer utils.ExitFnLogger(logger, utils.EnterFnLogger(logger))
 	logger.Debugf("RegisterUser args: %v", args)